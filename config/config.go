@@ -1,24 +1,27 @@
 package config
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/duke-git/lancet/v2/slice"
 
+	"github.com/becheran/wildmatch-go"
 	"github.com/gofrs/uuid/v5"
 	"github.com/gorilla/securecookie"
 	"github.com/jinzhu/configor"
 	"github.com/muety/wakapi/data"
 	"github.com/muety/wakapi/utils"
-	"github.com/robfig/cron/v3"
 	"log/slog"
 )
 
@@ -36,8 +39,12 @@ const (
 	KeyLastImportSuccess            = "last_successful_import" // last actual successful import
 	KeyFirstHeartbeat               = "first_heartbeat"
 	KeySubscriptionNotificationSent = "sub_reminder"
+	KeySubscriptionRenewalReminder  = "sub_renewal_reminder" // end of the billing period the last reminder was sent for
+	KeyInactivityReminderSent       = "inactivity_reminder"
 	KeyNewsbox                      = "newsbox"
 	KeyInviteCode                   = "invite"
+	KeyExportSigningKey             = "export_signing_key"
+	KeyImportSnapshot               = "import_snapshot"
 
 	SessionKeyDefault = "default"
 
@@ -46,6 +53,7 @@ const (
 
 	ErrUnauthorized        = "401 unauthorized"
 	ErrBadRequest          = "400 bad request"
+	ErrForbidden           = "403 forbidden"
 	ErrNotFound            = "404 not found"
 	ErrInternalServerError = "500 internal server error"
 )
@@ -65,6 +73,38 @@ const (
 	MailProviderSmtp = "smtp"
 )
 
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+)
+
+const (
+	DownsampleDaily  = "daily"
+	DownsampleHourly = "hourly"
+)
+
+const (
+	LateHeartbeatsRecompute = "recompute"
+	LateHeartbeatsReject    = "reject"
+)
+
+const (
+	HeartbeatsMissingFieldsDefaults = "defaults"
+	HeartbeatsMissingFieldsReject   = "reject"
+)
+
+const (
+	UnknownApiKeysReject    = "reject"
+	UnknownApiKeysProvision = "provision"
+)
+
+const (
+	IPRestrictedRoutesAdmin   = "admin"   // /api/admin/*, /api/orgs/*, user impersonation and restoration, rotating other users' api keys, flushing all summary caches
+	IPRestrictedRoutesMetrics = "metrics" // /api/metrics
+)
+
+var IPRestrictedRouteGroups = []string{IPRestrictedRoutesAdmin, IPRestrictedRoutesMetrics}
+
 var emailProviders = []string{
 	MailProviderSmtp,
 }
@@ -77,6 +117,7 @@ const colorsFile = "data/colors.json"
 var leaderboardScopes = []string{"24_hours", "week", "month", "year", "7_days", "14_days", "30_days", "6_months", "12_months", "all_time"}
 
 var cfg *Config
+var shuttingDown atomic.Bool
 var env string
 
 type appConfig struct {
@@ -90,19 +131,54 @@ type appConfig struct {
 	ImportBackoffMin          int                          `yaml:"import_backoff_min" default:"5" env:"WAKAPI_IMPORT_BACKOFF_MIN"`
 	ImportMaxRate             int                          `yaml:"import_max_rate" default:"24" env:"WAKAPI_IMPORT_MAX_RATE"` // at max one successful import every x hours
 	ImportBatchSize           int                          `yaml:"import_batch_size" default:"50" env:"WAKAPI_IMPORT_BATCH_SIZE"`
+	MaxConcurrentJobs         int                          `yaml:"max_concurrent_jobs" default:"0" env:"WAKAPI_MAX_CONCURRENT_JOBS"` // 0 for number of cpus, -1 for unlimited
 	InactiveDays              int                          `yaml:"inactive_days" default:"7" env:"WAKAPI_INACTIVE_DAYS"`
+	ActiveDayThresholdSec     int                          `yaml:"active_day_threshold_sec" default:"0" env:"WAKAPI_ACTIVE_DAY_THRESHOLD_SEC"`  // users may override this
+	InactivityReminderDays    int                          `yaml:"inactivity_reminder_days" default:"0" env:"WAKAPI_INACTIVITY_REMINDER_DAYS"`  // 0 to disable
+	InactivityCooldownDays    int                          `yaml:"inactivity_cooldown_days" default:"30" env:"WAKAPI_INACTIVITY_COOLDOWN_DAYS"` // minimum days between two reminders
 	HeartbeatMaxAge           string                       `yaml:"heartbeat_max_age" default:"4320h" env:"WAKAPI_HEARTBEAT_MAX_AGE"`
+	CollapseSameTimestamps    bool                         `yaml:"collapse_same_timestamps" default:"false" env:"WAKAPI_COLLAPSE_SAME_TIMESTAMPS"`
+	UnknownBranchPattern      string                       `yaml:"unknown_branch_pattern" default:"^(HEAD|[0-9a-f]{7,40})$" env:"WAKAPI_UNKNOWN_BRANCH_PATTERN"` // branch names not denoting an actual branch, e.g. detached commits
+	HeartbeatBufferSec        int                          `yaml:"heartbeat_buffer_sec" default:"0" env:"WAKAPI_HEARTBEAT_BUFFER_SEC"`                           // 0 to disable buffering
+	HeartbeatBufferSize       int                          `yaml:"heartbeat_buffer_size" default:"1000" env:"WAKAPI_HEARTBEAT_BUFFER_SIZE"`
+	HeartbeatMaxFieldLen      int                          `yaml:"heartbeat_max_field_length" default:"2048" env:"WAKAPI_HEARTBEAT_MAX_FIELD_LENGTH"` // 0 to only apply column sizes
+	TruncateHeartbeats        bool                         `yaml:"truncate_heartbeats" default:"true" env:"WAKAPI_TRUNCATE_HEARTBEATS"`               // otherwise oversized heartbeats are skipped
+	MaxHeartbeats             int                          `yaml:"max_heartbeats" default:"0" env:"WAKAPI_MAX_HEARTBEATS"`                            // per user, 0 for unlimited
+	MaxHeartbeatsSubscribed   int                          `yaml:"max_heartbeats_subscribed" default:"0" env:"WAKAPI_MAX_HEARTBEATS_SUBSCRIBED"`      // per user with an active subscription, 0 for unlimited
+	MaxAliasesPerType         int                          `yaml:"max_aliases_per_type" default:"100" env:"WAKAPI_MAX_ALIASES_PER_TYPE"`              // per user and summary type, 0 for unlimited
+	DuplicateProjectThreshold float64                      `yaml:"duplicate_project_threshold" default:"0.75" env:"WAKAPI_DUPLICATE_PROJECT_THRESHOLD"`
 	CountCacheTTLMin          int                          `yaml:"count_cache_ttl_min" default:"30" env:"WAKAPI_COUNT_CACHE_TTL_MIN"`
+	SummaryCacheTTLMin        int                          `yaml:"summary_cache_ttl_min" default:"1440" env:"WAKAPI_SUMMARY_CACHE_TTL_MIN"`
+	PublicCacheMaxAgeSec      int                          `yaml:"public_cache_max_age_sec" default:"3600" env:"WAKAPI_PUBLIC_CACHE_MAX_AGE_SEC"` // 0 to require revalidation
 	DataRetentionMonths       int                          `yaml:"data_retention_months" default:"-1" env:"WAKAPI_DATA_RETENTION_MONTHS"`
 	DataCleanupDryRun         bool                         `yaml:"data_cleanup_dry_run" default:"false" env:"WAKAPI_DATA_CLEANUP_DRY_RUN"` // for debugging only
+	DownsampleAfterDays       int                          `yaml:"downsample_after_days" default:"0" env:"WAKAPI_DOWNSAMPLE_AFTER_DAYS"`
+	DownsampleGranularity     string                       `yaml:"downsample_granularity" default:"daily" env:"WAKAPI_DOWNSAMPLE_GRANULARITY"`
+	LateHeartbeats            string                       `yaml:"late_heartbeats" default:"recompute" env:"WAKAPI_LATE_HEARTBEATS"`
+	LateHeartbeatsHorizonDays int                          `yaml:"late_heartbeats_horizon_days" default:"7" env:"WAKAPI_LATE_HEARTBEATS_HORIZON_DAYS"`
+	HeartbeatsMissingFields   string                       `yaml:"heartbeats_missing_fields" default:"defaults" env:"WAKAPI_HEARTBEATS_MISSING_FIELDS"`
+	InferTimezones            bool                         `yaml:"infer_timezones" default:"true" env:"WAKAPI_INFER_TIMEZONES"`
 	MaxInactiveMonths         int                          `yaml:"max_inactive_months" default:"-1" env:"WAKAPI_MAX_INACTIVE_MONTHS"`
+	AccountDeletionGraceDays  int                          `yaml:"account_deletion_grace_days" default:"7" env:"WAKAPI_ACCOUNT_DELETION_GRACE_DAYS"`
+	ExportDir                 string                       `yaml:"export_dir" default:"" env:"WAKAPI_EXPORT_DIR"` // defaults to a sub-directory of the system's temp dir
+	ExportLinkExpiryHours     int                          `yaml:"export_link_expiry_hours" default:"24" env:"WAKAPI_EXPORT_LINK_EXPIRY_HOURS"`
 	WarmCaches                bool                         `yaml:"warm_caches" default:"true" env:"WAKAPI_WARM_CACHES"`
+	WarmSummaryCaches         bool                         `yaml:"warm_summary_caches" default:"false" env:"WAKAPI_WARM_SUMMARY_CACHES"`
+	WarmSummaryCachesDays     int                          `yaml:"warm_summary_caches_days" default:"3" env:"WAKAPI_WARM_SUMMARY_CACHES_DAYS"`
+	WebhooksEnabled           bool                         `yaml:"webhooks_enabled" default:"false" env:"WAKAPI_WEBHOOKS_ENABLED"`
+	PublicStats               bool                         `yaml:"public_stats" default:"false" env:"WAKAPI_PUBLIC_STATS"`
+	OrgsEnabled               bool                         `yaml:"orgs_enabled" default:"false" env:"WAKAPI_ORGS_ENABLED"`
+	UnknownLabel              string                       `yaml:"unknown_label" default:"Unknown" env:"WAKAPI_UNKNOWN_LABEL"`
+	HideUnknown               bool                         `yaml:"hide_unknown" default:"false" env:"WAKAPI_HIDE_UNKNOWN"` // users may override this
+	MinPluginVersions         string                       `yaml:"min_plugin_versions" default:"" env:"WAKAPI_MIN_PLUGIN_VERSIONS"`
 	AvatarURLTemplate         string                       `yaml:"avatar_url_template" default:"api/avatar/{username_hash}.svg" env:"WAKAPI_AVATAR_URL_TEMPLATE"`
 	SupportContact            string                       `yaml:"support_contact" default:"hostmaster@wakapi.dev" env:"WAKAPI_SUPPORT_CONTACT"`
 	DateFormat                string                       `yaml:"date_format" default:"Mon, 02 Jan 2006" env:"WAKAPI_DATE_FORMAT"`
 	DateTimeFormat            string                       `yaml:"datetime_format" default:"Mon, 02 Jan 2006 15:04" env:"WAKAPI_DATETIME_FORMAT"`
 	CustomLanguages           map[string]string            `yaml:"custom_languages"`
+	CategoryRules             []CategoryRule               `yaml:"category_rules"`
 	Colors                    map[string]map[string]string `yaml:"-"`
+	unknownBranchRegex        *regexp.Regexp
 }
 
 type securityConfig struct {
@@ -114,17 +190,36 @@ type securityConfig struct {
 	DisableFrontpage bool `yaml:"disable_frontpage" default:"false" env:"WAKAPI_DISABLE_FRONTPAGE"`
 	// this is actually a pepper (https://en.wikipedia.org/wiki/Pepper_(cryptography))
 	PasswordSalt               string                     `yaml:"password_salt" default:"" env:"WAKAPI_PASSWORD_SALT"`
+	PasswordHashAlgorithm      string                     `yaml:"password_hash_algorithm" default:"argon2id" env:"WAKAPI_PASSWORD_HASH_ALGORITHM"` // argon2id or bcrypt
+	BcryptCost                 int                        `yaml:"bcrypt_cost" default:"10" env:"WAKAPI_BCRYPT_COST"`
+	PasswordMinLength          int                        `yaml:"password_min_length" default:"0" env:"WAKAPI_PASSWORD_MIN_LENGTH"`     // 0 to disable, passwords need at least 6 characters regardless
+	PasswordCharClasses        int                        `yaml:"password_char_classes" default:"0" env:"WAKAPI_PASSWORD_CHAR_CLASSES"` // out of lower case, upper case, digits and others, 0 to disable
+	PasswordBlockCommon        bool                       `yaml:"password_block_common" default:"false" env:"WAKAPI_PASSWORD_BLOCK_COMMON"`
 	InsecureCookies            bool                       `yaml:"insecure_cookies" default:"false" env:"WAKAPI_INSECURE_COOKIES"`
 	CookieMaxAgeSec            int                        `yaml:"cookie_max_age" default:"172800" env:"WAKAPI_COOKIE_MAX_AGE"`
+	SessionMaxAgeSec           int                        `yaml:"session_max_age" default:"0" env:"WAKAPI_SESSION_MAX_AGE"`           // absolute lifetime of login sessions, 0 to disable
+	SessionIdleTimeoutSec      int                        `yaml:"session_idle_timeout" default:"0" env:"WAKAPI_SESSION_IDLE_TIMEOUT"` // lifetime of login sessions without activity, 0 to disable
+	CookieSameSite             string                     `yaml:"cookie_same_site" default:"lax" env:"WAKAPI_COOKIE_SAME_SITE"`       // lax, strict or none
+	CookieHttpOnly             bool                       `yaml:"cookie_http_only" default:"true" env:"WAKAPI_COOKIE_HTTP_ONLY"`
+	CookieDomain               string                     `yaml:"cookie_domain" default:"" env:"WAKAPI_COOKIE_DOMAIN"` // empty for the current host only
 	TrustedHeaderAuth          bool                       `yaml:"trusted_header_auth" default:"false" env:"WAKAPI_TRUSTED_HEADER_AUTH"`
 	TrustedHeaderAuthKey       string                     `yaml:"trusted_header_auth_key" default:"Remote-User" env:"WAKAPI_TRUSTED_HEADER_AUTH_KEY"`
-	TrustReverseProxyIps       string                     `yaml:"trust_reverse_proxy_ips" default:"" env:"WAKAPI_TRUST_REVERSE_PROXY_IPS"` // comma-separated list of trusted reverse proxy ips
+	TrustReverseProxyIps       string                     `yaml:"trust_reverse_proxy_ips" default:"" env:"WAKAPI_TRUST_REVERSE_PROXY_IPS"`        // comma-separated list of trusted reverse proxy ips
+	UnknownApiKeys             string                     `yaml:"unknown_api_keys" default:"reject" env:"WAKAPI_UNKNOWN_API_KEYS"`                // reject or provision
+	ProvisionAllowedIps        string                     `yaml:"provision_allowed_ips" default:"" env:"WAKAPI_PROVISION_ALLOWED_IPS"`            // comma-separated list of ips or ranges to auto-provision users from
+	IpAllowlist                string                     `yaml:"ip_allowlist" default:"" env:"WAKAPI_IP_ALLOWLIST"`                              // comma-separated list of ips or ranges allowed to access restricted routes (see ip_restricted_routes), any if empty
+	IpDenylist                 string                     `yaml:"ip_denylist" default:"" env:"WAKAPI_IP_DENYLIST"`                                // comma-separated list of ips or ranges denied access to restricted routes, takes precedence over the allowlist
+	IpRestrictedRoutes         string                     `yaml:"ip_restricted_routes" default:"admin,metrics" env:"WAKAPI_IP_RESTRICTED_ROUTES"` // comma-separated list of route groups to apply allow- and denylist to, out of admin and metrics
 	SignupMaxRate              string                     `yaml:"signup_max_rate" default:"5/1h" env:"WAKAPI_SIGNUP_MAX_RATE"`
 	LoginMaxRate               string                     `yaml:"login_max_rate" default:"10/1m" env:"WAKAPI_LOGIN_MAX_RATE"`
 	PasswordResetMaxRate       string                     `yaml:"password_reset_max_rate" default:"5/1h" env:"WAKAPI_PASSWORD_RESET_MAX_RATE"`
+	HeartbeatsMaxRate          string                     `yaml:"heartbeats_max_rate" default:"" env:"WAKAPI_HEARTBEATS_MAX_RATE"`
 	SecureCookie               *securecookie.SecureCookie `yaml:"-"`
 	SessionKey                 []byte                     `yaml:"-"`
 	trustReverseProxyIpsParsed []net.IPNet
+	provisionAllowedIpsParsed  []net.IPNet
+	ipAllowlistParsed          []net.IPNet
+	ipDenylistParsed           []net.IPNet
 }
 
 type dbConfig struct {
@@ -138,9 +233,12 @@ type dbConfig struct {
 	Charset                 string `default:"utf8mb4" env:"WAKAPI_DB_CHARSET"`
 	Type                    string `yaml:"dialect" default:"sqlite3" env:"WAKAPI_DB_TYPE"`
 	DSN                     string `yaml:"DSN" default:"" env:"WAKAPI_DB_DSN"`
+	ReplicaDSN              string `yaml:"replica_dsn" default:"" env:"WAKAPI_DB_REPLICA_DSN"`
 	MaxConn                 uint   `yaml:"max_conn" default:"2" env:"WAKAPI_DB_MAX_CONNECTIONS"`
 	Ssl                     bool   `default:"false" env:"WAKAPI_DB_SSL"`
 	AutoMigrateFailSilently bool   `yaml:"automigrate_fail_silently" default:"false" env:"WAKAPI_DB_AUTOMIGRATE_FAIL_SILENTLY"`
+	// queries taking longer than this are logged as warnings along with their statement, 0 to disable
+	SlowQueryThresholdMs int `yaml:"slow_query_threshold_ms" default:"0" env:"WAKAPI_DB_SLOW_QUERY_THRESHOLD_MS"`
 }
 
 type serverConfig struct {
@@ -154,6 +252,16 @@ type serverConfig struct {
 	PublicUrl        string `yaml:"public_url" default:"http://localhost:3000" env:"WAKAPI_PUBLIC_URL"`
 	TlsCertPath      string `yaml:"tls_cert_path" default:"" env:"WAKAPI_TLS_CERT_PATH"`
 	TlsKeyPath       string `yaml:"tls_key_path" default:"" env:"WAKAPI_TLS_KEY_PATH"`
+	// cross-origin resource sharing for /api routes, disabled (same-origin only) unless allowed origins are given
+	CorsAllowedOrigins   string `yaml:"cors_allowed_origins" default:"" env:"WAKAPI_CORS_ALLOWED_ORIGINS"` // comma-separated list of origins (or * for any)
+	CorsAllowedMethods   string `yaml:"cors_allowed_methods" default:"GET,POST,PUT,DELETE" env:"WAKAPI_CORS_ALLOWED_METHODS"`
+	CorsAllowedHeaders   string `yaml:"cors_allowed_headers" default:"Authorization,Content-Type,Accept,X-Machine-Name" env:"WAKAPI_CORS_ALLOWED_HEADERS"`
+	CorsAllowCredentials bool   `yaml:"cors_allow_credentials" default:"false" env:"WAKAPI_CORS_ALLOW_CREDENTIALS"`
+	// on termination, readiness is reported as failed for shutdown_delay_sec before closing the listeners, then in-flight requests and running jobs are given shutdown_timeout_sec to finish
+	ShutdownDelaySec   int `yaml:"shutdown_delay_sec" default:"0" env:"WAKAPI_SHUTDOWN_DELAY_SEC"`
+	ShutdownTimeoutSec int `yaml:"shutdown_timeout_sec" default:"30" env:"WAKAPI_SHUTDOWN_TIMEOUT_SEC"`
+	// requests taking longer than this are logged as warnings along with their route, 0 to disable
+	SlowRequestThresholdMs int `yaml:"slow_request_threshold_ms" default:"0" env:"WAKAPI_SLOW_REQUEST_THRESHOLD_MS"`
 }
 
 type subscriptionsConfig struct {
@@ -163,6 +271,8 @@ type subscriptionsConfig struct {
 	StripeSecretKey      string `yaml:"stripe_secret_key" env:"WAKAPI_SUBSCRIPTIONS_STRIPE_SECRET_KEY"`
 	StripeEndpointSecret string `yaml:"stripe_endpoint_secret" env:"WAKAPI_SUBSCRIPTIONS_STRIPE_ENDPOINT_SECRET"`
 	StandardPriceId      string `yaml:"standard_price_id" env:"WAKAPI_SUBSCRIPTIONS_STANDARD_PRICE_ID"`
+	TrialPeriodDays      int    `yaml:"trial_period_days" default:"0" env:"WAKAPI_SUBSCRIPTIONS_TRIAL_PERIOD_DAYS"`
+	RenewalReminderDays  int    `yaml:"renewal_reminder_days" default:"0" env:"WAKAPI_SUBSCRIPTIONS_RENEWAL_REMINDER_DAYS"`
 	StandardPrice        string `yaml:"-"`
 }
 
@@ -175,19 +285,69 @@ type sentryConfig struct {
 }
 
 type mailConfig struct {
-	Enabled  bool           `env:"WAKAPI_MAIL_ENABLED" default:"true"`
-	Provider string         `env:"WAKAPI_MAIL_PROVIDER" default:"smtp"`
-	Smtp     SMTPMailConfig `yaml:"smtp"`
-	Sender   string         `env:"WAKAPI_MAIL_SENDER" yaml:"sender"`
+	Enabled      bool           `env:"WAKAPI_MAIL_ENABLED" default:"true"`
+	Provider     string         `env:"WAKAPI_MAIL_PROVIDER" default:"smtp"`
+	Smtp         SMTPMailConfig `yaml:"smtp"`
+	Sender       string         `env:"WAKAPI_MAIL_SENDER" yaml:"sender"`
+	TemplatesDir string         `yaml:"templates_dir" env:"WAKAPI_MAIL_TEMPLATES_DIR"`           // optional directory with templates overriding the built-in ones
+	MaxAttempts  int            `yaml:"max_attempts" default:"6" env:"WAKAPI_MAIL_MAX_ATTEMPTS"` // per mail, failed mails are queued and retried with exponential backoff, 1 disables retries
 }
 
 type SMTPMailConfig struct {
-	Host       string `env:"WAKAPI_MAIL_SMTP_HOST"`
-	Port       uint   `env:"WAKAPI_MAIL_SMTP_PORT"`
-	Username   string `env:"WAKAPI_MAIL_SMTP_USER"`
-	Password   string `env:"WAKAPI_MAIL_SMTP_PASS"`
-	TLS        bool   `env:"WAKAPI_MAIL_SMTP_TLS"`
-	SkipVerify bool   `env:"WAKAPI_MAIL_SMTP_SKIP_VERIFY"`
+	Host       string               `env:"WAKAPI_MAIL_SMTP_HOST"`
+	Port       uint                 `env:"WAKAPI_MAIL_SMTP_PORT"`
+	Username   string               `env:"WAKAPI_MAIL_SMTP_USER"`
+	Password   string               `env:"WAKAPI_MAIL_SMTP_PASS"`
+	TLS        bool                 `env:"WAKAPI_MAIL_SMTP_TLS"`
+	SkipVerify bool                 `env:"WAKAPI_MAIL_SMTP_SKIP_VERIFY"`
+	TimeoutSec int                  `yaml:"timeout_sec" default:"10" env:"WAKAPI_MAIL_SMTP_TIMEOUT_SEC"` // per server, for connecting and every single command
+	Fallbacks  []SMTPFallbackConfig `yaml:"fallbacks"`                                                   // tried in order if sending via the primary server fails
+}
+
+type objectStoreConfig struct {
+	Endpoint        string `yaml:"endpoint" env:"WAKAPI_OBJECT_STORE_ENDPOINT"` // e.g. https://s3.eu-central-1.amazonaws.com, object store is disabled if empty
+	Region          string `yaml:"region" default:"us-east-1" env:"WAKAPI_OBJECT_STORE_REGION"`
+	Bucket          string `yaml:"bucket" env:"WAKAPI_OBJECT_STORE_BUCKET"`
+	Prefix          string `yaml:"prefix" default:"exports/" env:"WAKAPI_OBJECT_STORE_PREFIX"`
+	AccessKeyId     string `yaml:"access_key_id" env:"WAKAPI_OBJECT_STORE_ACCESS_KEY_ID"`
+	SecretAccessKey string `yaml:"secret_access_key" env:"WAKAPI_OBJECT_STORE_SECRET_ACCESS_KEY"`
+	PathStyle       bool   `yaml:"path_style" default:"true" env:"WAKAPI_OBJECT_STORE_PATH_STYLE"` // bucket as part of the path instead of the host name, required by most self-hosted stores
+}
+
+// SMTPFallbackConfig has the same fields as SMTPMailConfig, but no env tags, as these would otherwise apply to every list item
+type SMTPFallbackConfig struct {
+	Host       string
+	Port       uint
+	Username   string
+	Password   string
+	TLS        bool
+	SkipVerify bool
+	TimeoutSec int `yaml:"timeout_sec"` // defaults to the primary server's timeout
+}
+
+// CategoryRule assigns a category to heartbeats, which were sent without one. Empty fields match anything, entity may contain wildcards.
+type CategoryRule struct {
+	Category      string
+	Entity        string
+	Type          string
+	Language      string
+	entityPattern *wildmatch.WildMatch
+}
+
+func (r *CategoryRule) Matches(entity, entityType, language string) bool {
+	if r.Type != "" && !strings.EqualFold(r.Type, entityType) {
+		return false
+	}
+	if r.Language != "" && !strings.EqualFold(r.Language, language) {
+		return false
+	}
+	if r.Entity == "" {
+		return true
+	}
+	if r.entityPattern == nil {
+		return wildmatch.NewWildMatch(r.Entity).IsMatch(entity)
+	}
+	return r.entityPattern.IsMatch(entity)
 }
 
 type Config struct {
@@ -197,6 +357,8 @@ type Config struct {
 	SkipMigrations bool   `yaml:"skip_migrations" env:"WAKAPI_SKIP_MIGRATIONS"`
 	InstanceId     string `yaml:"-"` // only temporary, changes between runs
 	EnablePprof    bool   `yaml:"enable_pprof" env:"WAKAPI_ENABLE_PPROF"`
+	Maintenance    bool   `yaml:"maintenance" env:"WAKAPI_MAINTENANCE"` // only makes the readiness probe fail, e.g. to drain traffic before database maintenance
+	LogFormat      string `yaml:"log_format" default:"" env:"WAKAPI_LOG_FORMAT"` // one of LogFormatText or LogFormatJson, depends on env if empty
 	App            appConfig
 	Security       securityConfig
 	Db             dbConfig
@@ -204,6 +366,7 @@ type Config struct {
 	Subscriptions  subscriptionsConfig
 	Sentry         sentryConfig
 	Mail           mailConfig
+	ObjectStore    objectStoreConfig `yaml:"object_store"`
 }
 
 func (c *Config) CreateCookie(name, value string) *http.Cookie {
@@ -219,10 +382,11 @@ func (c *Config) createCookie(name, value, path string, maxAge int) *http.Cookie
 		Name:     name,
 		Value:    value,
 		Path:     path,
+		Domain:   c.Security.CookieDomain,
 		MaxAge:   maxAge,
 		Secure:   !c.Security.InsecureCookies,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+		HttpOnly: c.Security.CookieHttpOnly,
+		SameSite: c.Security.GetCookieSameSite(),
 	}
 }
 
@@ -238,6 +402,17 @@ func (c *appConfig) GetCustomLanguages() map[string]string {
 	return utils.CloneStringMap(c.CustomLanguages, false)
 }
 
+// GetMinPluginVersions parses the comma-separated list of plugin/version pairs into the minimum recommended version per plugin name (lower case)
+func (c *appConfig) GetMinPluginVersions() map[string]string {
+	versions := make(map[string]string)
+	for _, item := range splitCommaList(c.MinPluginVersions) {
+		if plugin, version, ok := strings.Cut(item, "/"); ok {
+			versions[strings.ToLower(strings.TrimSpace(plugin))] = strings.TrimPrefix(strings.TrimSpace(version), "v")
+		}
+	}
+	return versions
+}
+
 func (c *appConfig) GetLanguageColors() map[string]string {
 	return utils.CloneStringMap(c.Colors["languages"], true)
 }
@@ -251,80 +426,105 @@ func (c *appConfig) GetOSColors() map[string]string {
 }
 
 func (c *appConfig) GetAggregationTimeCron() string {
-	if strings.Contains(c.AggregationTime, ":") {
-		// old gocron format, e.g. "15:04"
-		timeParts := strings.Split(c.AggregationTime, ":")
-		h, err := strconv.Atoi(timeParts[0])
-		if err != nil {
-			Log().Fatal(err.Error())
-		}
+	return mustCron(parseDailyCron(c.AggregationTime))
+}
 
-		m, err := strconv.Atoi(timeParts[1])
-		if err != nil {
-			Log().Fatal(err.Error())
-		}
+func (c *appConfig) GetWeeklyReportCron() string {
+	return mustCron(parseWeeklyCron(c.ReportTimeWeekly))
+}
+
+func (c *appConfig) GetLeaderboardGenerationTimeCron() []string {
+	crons := []string{}
+	for _, s := range utils.SplitMulti(c.LeaderboardGenerationTime, ",", ";") {
+		crons = append(crons, mustCron(parseDailyCron(strings.TrimSpace(s))))
+	}
+	return crons
+}
 
-		return fmt.Sprintf("0 %d %d * * *", m, h)
+// parseDailyCron converts either a cron expression or a time of day in old gocron format (e.g. "15:04") into a secondly cron expression
+func parseDailyCron(s string) (string, error) {
+	if !strings.Contains(s, ":") {
+		return utils.CronPadToSecondly(s), nil
 	}
 
-	return utils.CronPadToSecondly(c.AggregationTime)
+	h, m, err := parseTimeOfDay(s)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("0 %d %d * * *", m, h), nil
 }
 
-func (c *appConfig) GetWeeklyReportCron() string {
-	if strings.Contains(c.ReportTimeWeekly, ",") {
-		// old gocron format, e.g. "fri,18:00"
-		split := strings.Split(c.ReportTimeWeekly, ",")
-		weekday := utils.ParseWeekday(split[0])
-		timeParts := strings.Split(split[1], ":")
-
-		h, err := strconv.Atoi(timeParts[0])
-		if err != nil {
-			Log().Fatal(err.Error())
-		}
+// parseWeeklyCron converts either a cron expression or a weekday and time of day in old gocron format (e.g. "fri,18:00") into a secondly cron expression
+func parseWeeklyCron(s string) (string, error) {
+	if !strings.Contains(s, ",") {
+		return utils.CronPadToSecondly(s), nil
+	}
 
-		m, err := strconv.Atoi(timeParts[1])
-		if err != nil {
-			Log().Fatal(err.Error())
-		}
+	split := strings.SplitN(s, ",", 2)
+	weekday := utils.ParseWeekday(split[0])
+	h, m, err := parseTimeOfDay(split[1])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("0 %d %d * * %d", m, h, weekday), nil
+}
 
-		return fmt.Sprintf("0 %d %d * * %d", m, h, weekday)
+func parseTimeOfDay(s string) (int, int, error) {
+	timeParts := strings.Split(s, ":")
+	if len(timeParts) != 2 {
+		return 0, 0, fmt.Errorf("invalid time of day '%s', expected hh:mm", s)
 	}
+	h, err := strconv.Atoi(timeParts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	m, err := strconv.Atoi(timeParts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return h, m, nil
+}
 
-	return utils.CronPadToSecondly(c.ReportTimeWeekly)
+// mustCron is only meant for config values, which fail in Validate already if invalid
+func mustCron(cron string, err error) string {
+	if err != nil {
+		Log().Fatal(err.Error())
+	}
+	return cron
 }
 
-func (c *appConfig) GetLeaderboardGenerationTimeCron() []string {
-	crons := []string{}
+func (c *appConfig) GetExportDir() string {
+	if c.ExportDir == "" {
+		return filepath.Join(os.TempDir(), "wakapi_exports")
+	}
+	return c.ExportDir
+}
 
-	var parse func(string) string
+func (c *appConfig) ExportLinkExpiry() time.Duration {
+	return time.Duration(c.ExportLinkExpiryHours) * time.Hour
+}
 
-	if strings.Contains(c.LeaderboardGenerationTime, ":") {
-		// old gocron format, e.g. "15:04"
-		parse = func(s string) string {
-			timeParts := strings.Split(s, ":")
-			h, err := strconv.Atoi(timeParts[0])
-			if err != nil {
-				Log().Fatal(err.Error())
-			}
+func (c *appConfig) HeartbeatBufferInterval() time.Duration {
+	return time.Duration(c.HeartbeatBufferSec) * time.Second
+}
 
-			m, err := strconv.Atoi(timeParts[1])
-			if err != nil {
-				Log().Fatal(err.Error())
-			}
+func (c *appConfig) HeartbeatBufferingEnabled() bool {
+	return c.HeartbeatBufferSec > 0
+}
 
-			return fmt.Sprintf("0 %d %d * * *", m, h)
-		}
-	} else {
-		parse = func(s string) string {
-			return utils.CronPadToSecondly(s)
-		}
+// GetMaxConcurrentJobs returns the maximum number of background jobs to run at the same time, 0 meaning unlimited
+func (c *appConfig) GetMaxConcurrentJobs() int {
+	if c.MaxConcurrentJobs < 0 {
+		return 0
 	}
-
-	for _, s := range utils.SplitMulti(c.LeaderboardGenerationTime, ",", ";") {
-		crons = append(crons, parse(strings.TrimSpace(s)))
+	if c.MaxConcurrentJobs == 0 {
+		return max(utils.AllCPUs(), 2)
 	}
+	return c.MaxConcurrentJobs
+}
 
-	return crons
+func (c *appConfig) SummaryCacheTTL() time.Duration {
+	return time.Duration(c.SummaryCacheTTLMin) * time.Minute
 }
 
 func (c *appConfig) HeartbeatsMaxAge() time.Duration {
@@ -332,19 +532,100 @@ func (c *appConfig) HeartbeatsMaxAge() time.Duration {
 	return d
 }
 
+// DownsampledBefore returns the point in time before which raw heartbeats are replaced by summaries, zero if downsampling is disabled
+func (c *appConfig) DownsampledBefore() time.Time {
+	if c.DownsampleAfterDays <= 0 {
+		return time.Time{}
+	}
+	return utils.BeginOfToday(time.Local).AddDate(0, 0, -c.DownsampleAfterDays)
+}
+
+// LateHeartbeatsCutoff returns the point in time before which incoming heartbeats are rejected, zero if there is none.
+// With downsampling, the raw heartbeats before its cutoff are gone, so late ones could neither be deduplicated against them nor recomputed into the day's summary without discarding the downsampled time.
+// Additionally, with late_heartbeats set to 'reject', heartbeats older than the horizon are rejected to keep summaries stable.
+func (c *appConfig) LateHeartbeatsCutoff() time.Time {
+	cutoff := c.DownsampledBefore()
+	if c.LateHeartbeats == LateHeartbeatsReject {
+		if horizon := utils.BeginOfToday(time.Local).AddDate(0, 0, -c.LateHeartbeatsHorizonDays); horizon.After(cutoff) {
+			cutoff = horizon
+		}
+	}
+	return cutoff
+}
+
+func (c *appConfig) ParseUnknownBranchPattern() error {
+	c.unknownBranchRegex = nil
+	if c.UnknownBranchPattern == "" {
+		return nil
+	}
+	regex, err := regexp.Compile(c.UnknownBranchPattern)
+	if err != nil {
+		return err
+	}
+	c.unknownBranchRegex = regex
+	return nil
+}
+
+func (c *appConfig) ParseCategoryRules() {
+	for i := range c.CategoryRules {
+		c.CategoryRules[i].entityPattern = wildmatch.NewWildMatch(c.CategoryRules[i].Entity)
+	}
+}
+
+// ClassifyCategory returns the category of the first of category_rules matching the given heartbeat properties, or an empty string if none matches
+func (c *appConfig) ClassifyCategory(entity, entityType, language string) string {
+	for i := range c.CategoryRules {
+		if c.CategoryRules[i].Matches(entity, entityType, language) {
+			return c.CategoryRules[i].Category
+		}
+	}
+	return ""
+}
+
+// IsUnknownBranch returns whether the given branch name doesn't denote an actual branch, i.e. is empty or matches unknown_branch_pattern
+func (c *appConfig) IsUnknownBranch(branch string) bool {
+	return branch == "" || (c.unknownBranchRegex != nil && c.unknownBranchRegex.MatchString(branch))
+}
+
+// GetCookieSameSite returns the same site mode for cookies, defaults to lax
+func (c *securityConfig) GetCookieSameSite() http.SameSite {
+	switch strings.ToLower(c.CookieSameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
 func (c *securityConfig) ParseTrustReverseProxyIPs() {
-	c.trustReverseProxyIpsParsed = make([]net.IPNet, 0)
+	c.trustReverseProxyIpsParsed = parseIPNets(c.TrustReverseProxyIps)
+}
 
-	for _, ip := range strings.Split(c.TrustReverseProxyIps, ",") {
+func (c *securityConfig) ParseProvisionAllowedIPs() {
+	c.provisionAllowedIpsParsed = parseIPNets(c.ProvisionAllowedIps)
+}
+
+func (c *securityConfig) ParseIPAccessLists() {
+	c.ipAllowlistParsed = parseIPNets(c.IpAllowlist)
+	c.ipDenylistParsed = parseIPNets(c.IpDenylist)
+}
+
+// parseIPNets parses a comma-separated list of single ips or address ranges
+func parseIPNets(list string) []net.IPNet {
+	ipNets := make([]net.IPNet, 0)
+
+	for _, ip := range strings.Split(list, ",") {
 		// the config value is empty by default
-		if ip == "" {
+		if ip = strings.TrimSpace(ip); ip == "" {
 			continue
 		}
 
 		// try parse as address range
 		_, parsedIpNet, err := net.ParseCIDR(ip)
 		if err == nil {
-			c.trustReverseProxyIpsParsed = append(c.trustReverseProxyIpsParsed, *parsedIpNet)
+			ipNets = append(ipNets, *parsedIpNet)
 			continue
 		}
 
@@ -356,18 +637,70 @@ func (c *securityConfig) ParseTrustReverseProxyIPs() {
 				ipBits = net.IPv6len * 8
 			}
 			ipNet := net.IPNet{IP: parsedIp, Mask: net.CIDRMask(ipBits, ipBits)}
-			c.trustReverseProxyIpsParsed = append(c.trustReverseProxyIpsParsed, ipNet)
+			ipNets = append(ipNets, ipNet)
 			continue
 		}
 
-		slog.Warn("failed to parse reverse proxy ip ranges")
+		slog.Warn("failed to parse ip ranges", "value", ip)
 	}
+
+	return ipNets
 }
 
 func (c *securityConfig) TrustReverseProxyIPs() []net.IPNet {
 	return c.trustReverseProxyIpsParsed
 }
 
+func (c *securityConfig) ProvisionAllowedIPs() []net.IPNet {
+	return c.provisionAllowedIpsParsed
+}
+
+func (c *securityConfig) IPAllowlist() []net.IPNet {
+	return c.ipAllowlistParsed
+}
+
+func (c *securityConfig) IPDenylist() []net.IPNet {
+	return c.ipDenylistParsed
+}
+
+func (c *securityConfig) GetIPRestrictedRoutes() []string {
+	return splitCommaList(c.IpRestrictedRoutes)
+}
+
+// IsIPRestricted tells whether access to the given route group (see IPRestrictedRouteGroups) is limited by the ip allow- or denylist
+func (c *securityConfig) IsIPRestricted(group string) bool {
+	if len(c.ipAllowlistParsed) == 0 && len(c.ipDenylistParsed) == 0 {
+		return false
+	}
+	return slices.Contains(c.GetIPRestrictedRoutes(), group)
+}
+
+// IsProvisioningEnabled tells whether users are to be created for yet unknown api keys, which only applies while signup is open
+func (c *securityConfig) IsProvisioningEnabled() bool {
+	return c.UnknownApiKeys == UnknownApiKeysProvision && c.AllowSignup && len(c.provisionAllowedIpsParsed) > 0
+}
+
+// GetSecretsKey returns a key to encrypt sensitive user data (e.g. 2fa secrets) with, derived from the password pepper, which is not stored in the database
+func (c *securityConfig) GetSecretsKey() []byte {
+	sum := sha256.Sum256([]byte("wakapi_secrets_" + c.PasswordSalt))
+	return sum[:]
+}
+
+func (c *securityConfig) GetPasswordHashOptions() utils.PasswordHashOptions {
+	return utils.PasswordHashOptions{
+		Algorithm:  c.PasswordHashAlgorithm,
+		BcryptCost: c.BcryptCost,
+	}
+}
+
+func (c *securityConfig) GetSessionMaxAge() time.Duration {
+	return time.Duration(c.SessionMaxAgeSec) * time.Second
+}
+
+func (c *securityConfig) GetSessionIdleTimeout() time.Duration {
+	return time.Duration(c.SessionIdleTimeoutSec) * time.Second
+}
+
 func (c *securityConfig) GetSignupMaxRate() (int, time.Duration) {
 	return c.parseRate(c.SignupMaxRate)
 }
@@ -380,11 +713,27 @@ func (c *securityConfig) GetPasswordResetMaxRate() (int, time.Duration) {
 	return c.parseRate(c.PasswordResetMaxRate)
 }
 
+// GetHeartbeatsMaxRate returns the maximum number of heartbeat requests per user within the given window, 0 if unlimited
+func (c *securityConfig) GetHeartbeatsMaxRate() (int, time.Duration) {
+	if c.HeartbeatsMaxRate == "" {
+		return 0, 0
+	}
+	return c.parseRate(c.HeartbeatsMaxRate)
+}
+
 func (c *securityConfig) parseRate(rate string) (int, time.Duration) {
+	limit, window, err := parseRate(rate)
+	if err != nil {
+		Log().Fatal("failed to parse rate pattern", "rate", rate) // not reached for configs, which passed Validate
+	}
+	return limit, window
+}
+
+func parseRate(rate string) (int, time.Duration, error) {
 	pattern := regexp.MustCompile("(\\d+)/(\\d+)([smh])")
 	matches := pattern.FindStringSubmatch(rate)
 	if len(matches) != 4 {
-		Log().Fatal("failed to parse rate pattern", "rate", rate)
+		return 0, 0, fmt.Errorf("invalid rate '%s'", rate)
 	}
 
 	limit, _ := strconv.Atoi(matches[1])
@@ -400,7 +749,35 @@ func (c *securityConfig) parseRate(rate string) (int, time.Duration) {
 		windowScale = time.Hour
 	}
 
-	return limit, time.Duration(window) * windowScale
+	return limit, time.Duration(window) * windowScale, nil
+}
+
+func (c *serverConfig) GetShutdownDelay() time.Duration {
+	return time.Duration(c.ShutdownDelaySec) * time.Second
+}
+
+func (c *serverConfig) GetShutdownTimeout() time.Duration {
+	return time.Duration(c.ShutdownTimeoutSec) * time.Second
+}
+
+func (c *serverConfig) CorsEnabled() bool {
+	return len(c.GetCorsAllowedOrigins()) > 0
+}
+
+func (c *serverConfig) GetCorsAllowedOrigins() []string {
+	return splitCommaList(c.CorsAllowedOrigins)
+}
+
+func (c *serverConfig) GetCorsAllowedMethods() []string {
+	return splitCommaList(c.CorsAllowedMethods)
+}
+
+func (c *serverConfig) GetCorsAllowedHeaders() []string {
+	return splitCommaList(c.CorsAllowedHeaders)
+}
+
+func (c *dbConfig) HasReplica() bool {
+	return c.ReplicaDSN != ""
 }
 
 func (c *dbConfig) IsSQLite() bool {
@@ -423,14 +800,64 @@ func (c *serverConfig) GetPublicUrl() string {
 	return strings.TrimSuffix(c.PublicUrl, "/")
 }
 
+// GetBaseUrl returns the public url including the base path, i.e. the prefix for generating absolute links to any of Wakapi's routes
+func (c *serverConfig) GetBaseUrl() string {
+	return c.GetPublicUrl() + strings.TrimSuffix(c.BasePath, "/")
+}
+
+// QueueEnabled returns whether outbound mails are persisted and retried upon failure
+func (c *mailConfig) QueueEnabled() bool {
+	return c.Enabled && c.MaxAttempts > 1
+}
+
+func (c *objectStoreConfig) IsEnabled() bool {
+	return c.Endpoint != ""
+}
+
 func (c *SMTPMailConfig) ConnStr() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
 
+func (c *SMTPMailConfig) GetTimeout() time.Duration {
+	return time.Duration(c.TimeoutSec) * time.Second
+}
+
+// GetServers returns the primary smtp server followed by all fallback servers, in the order they are to be tried in
+func (c *SMTPMailConfig) GetServers() []SMTPMailConfig {
+	servers := []SMTPMailConfig{*c}
+	servers[0].Fallbacks = nil
+	for _, f := range c.Fallbacks {
+		timeoutSec := f.TimeoutSec
+		if timeoutSec <= 0 {
+			timeoutSec = c.TimeoutSec
+		}
+		servers = append(servers, SMTPMailConfig{
+			Host:       f.Host,
+			Port:       f.Port,
+			Username:   f.Username,
+			Password:   f.Password,
+			TLS:        f.TLS,
+			SkipVerify: f.SkipVerify,
+			TimeoutSec: timeoutSec,
+		})
+	}
+	return servers
+}
+
 func IsDev(env string) bool {
 	return env == "dev" || env == "development"
 }
 
+func splitCommaList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func readColors() map[string]map[string]string {
 	// Read language colors
 	// Source:
@@ -471,6 +898,15 @@ func resolveDbDialect(dbType string) string {
 	return dbType
 }
 
+// SetShuttingDown marks the application as being terminated, which makes it report as not ready anymore
+func SetShuttingDown(shutdown bool) {
+	shuttingDown.Store(shutdown)
+}
+
+func IsShuttingDown() bool {
+	return shuttingDown.Load()
+}
+
 func Set(config *Config) {
 	cfg = config
 }
@@ -480,14 +916,43 @@ func Get() *Config {
 }
 
 func Load(configFlag string, version string) *Config {
+	config, err := read(configFlag, version)
+	if err != nil {
+		Log().Fatal("failed to read config", "error", err)
+	}
+
+	if errs := config.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			Log().Error("invalid config", "error", err)
+		}
+		Log().Fatal("aborting due to invalid config")
+	}
+
+	Set(config)
+	return Get()
+}
+
+// Check reads the config the same way as Load does, but instead of aborting, it returns all problems found.
+// In addition to what's required for wakapi to start up, it also checks for settings that would only cause failures at runtime.
+func Check(configFlag string, version string) (*Config, []error) {
+	config, err := read(configFlag, version)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	Set(config)
+	return Get(), append(config.Validate(), config.validateRuntime()...)
+}
+
+func read(configFlag string, version string) (*Config, error) {
 	config := &Config{}
 	if err := configor.New(&configor.Config{}).Load(config, configFlag); err != nil {
-		Log().Fatal("failed to read config", err)
+		return nil, err
 	}
 
 	env = config.Env
 
-	InitLogger(config.IsDev())
+	InitLogger(config.IsDev(), config.LogFormat)
 
 	config.Version = strings.TrimSpace(version)
 	tagVersionMatch, _ := regexp.MatchString(`\d+\.\d+\.\d+`, version)
@@ -512,6 +977,10 @@ func Load(configFlag string, version string) *Config {
 	config.Security.SecureCookie = securecookie.New(hashKey, blockKey)
 	config.Security.SessionKey = sessionKey
 	config.Security.ParseTrustReverseProxyIPs()
+	config.Security.ParseProvisionAllowedIPs()
+	config.Security.ParseIPAccessLists()
+	config.App.ParseUnknownBranchPattern() // invalid patterns are reported by validation
+	config.App.ParseCategoryRules()
 
 	config.Server.BasePath = strings.TrimSuffix(config.Server.BasePath, "/")
 
@@ -539,51 +1008,17 @@ func Load(configFlag string, version string) *Config {
 		slog.Warn(dataRetentionWarning)
 	}
 
-	// some validation checks
-	if config.Server.ListenIpV4 == "-" && config.Server.ListenIpV6 == "-" && config.Server.ListenSocket == "" {
-		Log().Fatal("either of listen_ipv4 or listen_ipv6 or listen_socket must be set")
-	}
-	if config.Db.MaxConn <= 0 {
-		Log().Fatal("you must allow at least one database connection")
+	if config.App.DownsampleAfterDays > 0 {
+		slog.Warn(fmt.Sprintf("⚠️ heartbeats older than %d days will be replaced by %s summaries", config.App.DownsampleAfterDays, config.App.DownsampleGranularity))
 	}
+
 	if config.Db.MaxConn > 1 && config.Db.IsSQLite() {
 		slog.Warn("with sqlite, only a single connection is supported") // otherwise 'PRAGMA foreign_keys=ON' would somehow have to be set for every connection in the pool
 		config.Db.MaxConn = 1
 	}
-	if config.Mail.Provider != "" && utils.FindString(config.Mail.Provider, emailProviders, "") == "" {
-		Log().Fatal("unknown mail provider", "provider", config.Mail.Provider)
-	}
-	if _, err := time.ParseDuration(config.App.HeartbeatMaxAge); err != nil {
-		Log().Fatal("invalid duration set for heartbeat_max_age")
-	}
 	if config.Security.TrustedHeaderAuth && len(config.Security.trustReverseProxyIpsParsed) == 0 {
 		config.Security.TrustedHeaderAuth = false
 	}
-	if d, err := time.Parse(config.App.DateFormat, config.App.DateFormat); err != nil || !d.Equal(time.Date(2006, time.January, 2, 0, 0, 0, 0, d.Location())) {
-		Log().Fatal("invalid date format", "format", config.App.DateFormat)
-	}
-	if d, err := time.Parse(config.App.DateTimeFormat, config.App.DateTimeFormat); err != nil || !d.Equal(time.Date(2006, time.January, 2, 15, 4, 0, 0, d.Location())) {
-		Log().Fatal("invalid datetime format", "format", config.App.DateTimeFormat)
-	}
-
-	cronParser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
-
-	if _, err := cronParser.Parse(config.App.GetWeeklyReportCron()); err != nil {
-		Log().Fatal("invalid cron expression for report_time_weekly")
-	}
-	if _, err := cronParser.Parse(config.App.GetAggregationTimeCron()); err != nil {
-		Log().Fatal("invalid cron expression for aggregation_time")
-	}
-	for _, c := range config.App.GetLeaderboardGenerationTimeCron() {
-		if _, err := cronParser.Parse(c); err != nil {
-			Log().Fatal("invalid cron expression for leaderboard_generation_time")
-		}
-	}
-
-	// see models/interval.go
-	if !slice.Contain[string](leaderboardScopes, config.App.LeaderboardScope) {
-		Log().Fatal("leaderboard scope is not a valid constant")
-	}
 
 	// deprecation notices
 	if strings.Contains(config.App.AggregationTime, ":") {
@@ -596,8 +1031,7 @@ func Load(configFlag string, version string) *Config {
 		slog.Warn("you're using deprecated syntax for 'leaderboard_generation_time', please change it to a semicolon-separated list if valid cron expressions")
 	}
 
-	Set(config)
-	return Get()
+	return config, nil
 }
 
 func Empty() *Config {
@@ -59,6 +59,25 @@ func (c *dbConfig) GetDialector() gorm.Dialector {
 	return nil
 }
 
+// GetReplicaDialector returns a dialector for the read replica database, which is expected to be of the same type as the primary one
+func (c *dbConfig) GetReplicaDialector() gorm.Dialector {
+	if !c.HasReplica() {
+		return nil
+	}
+
+	replicaConfig := *c
+	replicaConfig.DSN = c.ReplicaDSN
+
+	switch c.Dialect {
+	case SQLDialectSqlite:
+		replicaConfig.Name = c.ReplicaDSN
+	case SQLDialectMssql:
+		return sqlserver.Open(c.ReplicaDSN)
+	}
+
+	return replicaConfig.GetDialector()
+}
+
 func mysqlConnectionString(config *dbConfig) string {
 	if len(config.DSN) > 0 {
 		return config.DSN
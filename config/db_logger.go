@@ -0,0 +1,60 @@
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+const slowQueryMaxStatementLength = 2000 // e.g. batch inserts would otherwise flood the logs
+
+// SlowQueryLogger wraps another gorm logger and additionally logs every query taking longer than the threshold as a warning, using the application's logger (and thus its log format).
+// Statements are only rendered for slow queries, so the overhead for all others is a single time measurement.
+// Bound values (e.g. password hashes or api keys) are replaced by placeholders, except for queries run via gorm's Scan, which renders statements before passing them on.
+type SlowQueryLogger struct {
+	logger.Interface
+	threshold time.Duration
+}
+
+// NewSlowQueryLogger returns the given logger as is if the threshold is not positive
+func NewSlowQueryLogger(delegate logger.Interface, threshold time.Duration) logger.Interface {
+	if threshold <= 0 {
+		return delegate
+	}
+	return &SlowQueryLogger{Interface: delegate, threshold: threshold}
+}
+
+func (l *SlowQueryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &SlowQueryLogger{Interface: l.Interface.LogMode(level), threshold: l.threshold}
+}
+
+// ParamsFilter implements gorm.ParamsFilter to render statements without their bound values, also for the wrapped logger
+func (l *SlowQueryLogger) ParamsFilter(_ context.Context, sql string, _ ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+func (l *SlowQueryLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	l.Interface.Trace(ctx, begin, fc, err)
+
+	elapsed := time.Since(begin)
+	if elapsed <= l.threshold {
+		return
+	}
+
+	sql, rows := fc()
+	if len(sql) > slowQueryMaxStatementLength {
+		sql = sql[:slowQueryMaxStatementLength] + "..."
+	}
+
+	attrs := []any{"duration", elapsed, "rows", rows, "sql", sql, "caller", utils.FileWithLineNum()}
+	if reqId := middleware.GetReqID(ctx); reqId != "" {
+		attrs = append(attrs, "request_id", reqId) // only if the query was run with the request's context
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	Log().Warn("slow database query", attrs...)
+}
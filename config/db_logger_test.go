@@ -0,0 +1,79 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSlowQueryLogger_Trace(t *testing.T) {
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(newLogHandler(&buf, false, LogFormatJson)))
+	sentryLogger = nil
+	defer InitLogger(true, "")
+
+	delegate := logger.Default.LogMode(logger.Silent)
+	assert.Same(t, delegate, NewSlowQueryLogger(delegate, 0))
+
+	sut := NewSlowQueryLogger(delegate, 100*time.Millisecond)
+
+	var rendered int
+	fc := func(sql string) func() (string, int64) {
+		return func() (string, int64) {
+			rendered++
+			return sql, 3
+		}
+	}
+
+	sut.Trace(context.Background(), time.Now(), fc("SELECT 1"), nil)
+	assert.Empty(t, buf.String())
+	assert.Zero(t, rendered) // statements of fast queries aren't even rendered
+
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+	sut.LogMode(logger.Silent).Trace(ctx, time.Now().Add(-time.Second), fc("SELECT * FROM summaries"), nil)
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "slow database query", entry["msg"])
+	assert.Equal(t, "SELECT * FROM summaries", entry["sql"])
+	assert.Equal(t, float64(3), entry["rows"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.GreaterOrEqual(t, entry["duration"], float64(time.Second))
+
+	buf.Reset()
+	entry = map[string]interface{}{}
+	sut.Trace(context.Background(), time.Now().Add(-time.Second), fc(strings.Repeat("x", 5000)), nil)
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Len(t, entry["sql"], slowQueryMaxStatementLength+3)
+	assert.NotContains(t, entry, "request_id")
+}
+
+func TestSlowQueryLogger_Trace_NoParams(t *testing.T) {
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(newLogHandler(&buf, false, LogFormatJson)))
+	sentryLogger = nil
+	defer InitLogger(true, "")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: NewSlowQueryLogger(logger.Default.LogMode(logger.Silent), time.Nanosecond)})
+	assert.Nil(t, err)
+
+	var result int
+	assert.Nil(t, db.Raw("SELECT count(*) FROM sqlite_master WHERE name = ?", "secret-api-key").Row().Scan(&result))
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "slow database query", entry["msg"])
+	assert.Equal(t, "SELECT count(*) FROM sqlite_master WHERE name = ?", entry["sql"])
+	assert.NotContains(t, buf.String(), "secret-api-key")
+}
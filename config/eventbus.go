@@ -11,12 +11,18 @@ const (
 	TopicUser               = "user.*"
 	TopicHeartbeat          = "heartbeat.*"
 	TopicProjectLabel       = "project_label.*"
+	TopicDefaultBranch      = "default_branch.*"
 	EventUserUpdate         = "user.update"
 	EventUserDelete         = "user.delete"
+	EventUserOrgUpdate      = "user.org_update"
 	EventHeartbeatCreate    = "heartbeat.create"
+	EventHeartbeatQuota     = "heartbeat.quota"
 	EventProjectLabelCreate = "project_label.create"
 	EventProjectLabelDelete = "project_label.delete"
+	EventDefaultBranchSet   = "default_branch.set"
+	EventDefaultBranchUnset = "default_branch.unset"
 	EventWakatimeFailure    = "wakatime.failure"
+	EventSummaryCreate      = "summary.create"
 	FieldPayload            = "payload"
 	FieldUser               = "user"
 	FieldUserId             = "user.id"
@@ -5,9 +5,12 @@ import (
 	"github.com/muety/artifex/v2"
 	"github.com/muety/wakapi/utils"
 	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var jobQueues map[string]*artifex.Dispatcher
+var jobQueues map[string]*JobQueue
 var jobCounts map[string]int
 
 const (
@@ -17,16 +20,46 @@ const (
 	QueueMails        = "wakapi.mail"
 	QueueImports      = "wakapi.imports"
 	QueueHousekeeping = "wakapi.housekeeping"
+	QueueExports      = "wakapi.exports"
+	QueueWebhooks     = "wakapi.webhooks"
 )
 
+// queues whose jobs are latency-sensitive and get precedence over all others when competing for a job slot
+var priorityQueues = map[string]bool{
+	QueueProcessing: true,
+	QueueMails:      true,
+	QueueWebhooks:   true,
+}
+
+// jobs of all queues except the default one (which is only used to schedule and fan out other jobs) share a limited number of slots
+var jobSlots = newPrioritySemaphore(func() int {
+	if cfg == nil {
+		return 0
+	}
+	return cfg.App.GetMaxConcurrentJobs()
+})
+
 type JobQueueMetrics struct {
 	Queue        string
-	EnqueuedJobs int
+	EnqueuedJobs int // waiting for a worker
+	WaitingJobs  int // assigned a worker, but waiting for a job slot
+	RunningJobs  int
 	FinishedJobs int
 }
 
+// JobQueue wraps a job dispatcher to have its jobs wait for a free job slot before running
+type JobQueue struct {
+	name       string
+	dispatcher *artifex.Dispatcher
+	limited    bool
+	priority   bool
+	waiting    atomic.Int32
+	running    atomic.Int32
+	closed     atomic.Bool
+}
+
 func init() {
-	jobQueues = make(map[string]*artifex.Dispatcher)
+	jobQueues = make(map[string]*JobQueue)
 }
 
 func StartJobs() {
@@ -36,6 +69,8 @@ func StartJobs() {
 	InitQueue(QueueMails, 1)
 	InitQueue(QueueImports, 1)
 	InitQueue(QueueHousekeeping, utils.HalfCPUs())
+	InitQueue(QueueExports, 1)
+	InitQueue(QueueWebhooks, 1)
 }
 
 func InitQueue(name string, workers int) error {
@@ -43,16 +78,21 @@ func InitQueue(name string, workers int) error {
 		return fmt.Errorf("queue '%s' already existing", name)
 	}
 	slog.Info("creating job queue", "name", name, "workers", workers)
-	jobQueues[name] = artifex.NewDispatcher(workers, 4096)
-	jobQueues[name].Start()
+	jobQueues[name] = &JobQueue{
+		name:       name,
+		dispatcher: artifex.NewDispatcher(workers, 4096),
+		limited:    name != QueueDefault,
+		priority:   priorityQueues[name],
+	}
+	jobQueues[name].dispatcher.Start()
 	return nil
 }
 
-func GetDefaultQueue() *artifex.Dispatcher {
+func GetDefaultQueue() *JobQueue {
 	return GetQueue(QueueDefault)
 }
 
-func GetQueue(name string) *artifex.Dispatcher {
+func GetQueue(name string) *JobQueue {
 	if _, ok := jobQueues[name]; !ok {
 		InitQueue(name, 1)
 	}
@@ -65,6 +105,8 @@ func GetQueueMetrics() []*JobQueueMetrics {
 		metrics = append(metrics, &JobQueueMetrics{
 			Queue:        name,
 			EnqueuedJobs: queue.CountEnqueued(),
+			WaitingJobs:  int(queue.waiting.Load()),
+			RunningJobs:  int(queue.running.Load()),
 			FinishedJobs: queue.CountDispatched(),
 		})
 	}
@@ -76,3 +118,123 @@ func CloseQueues() {
 		q.Stop()
 	}
 }
+
+// ShutdownQueues stops all queues from starting any further jobs and waits for the ones currently running to finish, but at most for the given timeout.
+// Jobs not started yet are discarded, as they're only held in memory anyway. Returns whether all running jobs finished in time.
+func ShutdownQueues(timeout time.Duration) bool {
+	for _, q := range jobQueues {
+		q.closed.Store(true)
+		q.Stop()
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		running := make(map[string]int)
+		for name, q := range jobQueues {
+			if n := q.running.Load(); n > 0 {
+				running[name] = int(n)
+			}
+		}
+		if len(running) == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			slog.Warn("background jobs still running after shutdown timeout", "queues", running)
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (q *JobQueue) Dispatch(run func()) error {
+	return q.dispatcher.Dispatch(q.wrap(run))
+}
+
+func (q *JobQueue) DispatchIn(run func(), duration time.Duration) error {
+	return q.dispatcher.DispatchIn(q.wrap(run), duration)
+}
+
+func (q *JobQueue) DispatchEvery(run func(), interval time.Duration) (*artifex.DispatchTicker, error) {
+	return q.dispatcher.DispatchEvery(q.wrap(run), interval)
+}
+
+func (q *JobQueue) DispatchCron(run func(), cronStr string) (*artifex.DispatchCron, error) {
+	return q.dispatcher.DispatchCron(q.wrap(run), cronStr)
+}
+
+func (q *JobQueue) CountEnqueued() int {
+	return q.dispatcher.CountEnqueued()
+}
+
+func (q *JobQueue) CountDispatched() int {
+	return q.dispatcher.CountDispatched()
+}
+
+func (q *JobQueue) Stop() {
+	q.dispatcher.Stop()
+}
+
+func (q *JobQueue) wrap(run func()) func() {
+	return func() {
+		// dispatched before shutdown, but not started yet
+		if q.closed.Load() {
+			return
+		}
+
+		if q.limited {
+			q.waiting.Add(1)
+			jobSlots.Acquire(q.priority)
+			q.waiting.Add(-1)
+			defer jobSlots.Release()
+
+			if q.closed.Load() {
+				return
+			}
+		}
+
+		q.running.Add(1)
+		defer q.running.Add(-1)
+		run()
+	}
+}
+
+// prioritySemaphore is a counting semaphore, which grants slots to waiting high-priority acquirers before any low-priority ones
+type prioritySemaphore struct {
+	limit       func() int // 0 for unlimited
+	cond        *sync.Cond
+	used        int
+	waitingHigh int
+}
+
+func newPrioritySemaphore(limit func() int) *prioritySemaphore {
+	return &prioritySemaphore{limit: limit, cond: sync.NewCond(&sync.Mutex{})}
+}
+
+func (s *prioritySemaphore) Acquire(highPriority bool) {
+	s.cond.L.Lock()
+	defer s.cond.L.Unlock()
+
+	if highPriority {
+		s.waitingHigh++
+		defer func() { s.waitingHigh-- }()
+	}
+	for !s.available(highPriority) {
+		s.cond.Wait()
+	}
+	s.used++
+}
+
+func (s *prioritySemaphore) Release() {
+	s.cond.L.Lock()
+	s.used--
+	s.cond.L.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *prioritySemaphore) available(highPriority bool) bool {
+	limit := s.limit()
+	if limit <= 0 {
+		return true
+	}
+	return s.used < limit && (highPriority || s.waitingHigh == 0)
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrioritySemaphore_Limit(t *testing.T) {
+	sut := newPrioritySemaphore(func() int { return 1 })
+	sut.Acquire(false)
+
+	acquired := make(chan bool)
+	go func() {
+		sut.Acquire(false)
+		acquired <- true
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired slot beyond limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sut.Release()
+	assert.True(t, <-acquired)
+}
+
+func TestPrioritySemaphore_Unlimited(t *testing.T) {
+	sut := newPrioritySemaphore(func() int { return 0 })
+	for i := 0; i < 100; i++ {
+		sut.Acquire(false)
+	}
+	assert.Equal(t, 100, sut.used)
+}
+
+func TestPrioritySemaphore_HighPriorityFirst(t *testing.T) {
+	sut := newPrioritySemaphore(func() int { return 1 })
+	sut.Acquire(false)
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+
+	acquire := func(name string, highPriority bool) {
+		defer wg.Done()
+		sut.Acquire(highPriority)
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+		sut.Release()
+	}
+
+	wg.Add(1)
+	go acquire("low", false)
+	time.Sleep(50 * time.Millisecond) // low-priority acquirer waits first
+	wg.Add(1)
+	go acquire("high", true)
+	time.Sleep(50 * time.Millisecond)
+
+	sut.Release()
+	wg.Wait()
+
+	assert.Equal(t, []string{"high", "low"}, order)
+}
+
+func TestShutdownQueues(t *testing.T) {
+	q := GetQueue("wakapi.test.shutdown")
+
+	started, finished := make(chan bool), make(chan bool, 1)
+	assert.Nil(t, q.Dispatch(func() {
+		started <- true
+		time.Sleep(100 * time.Millisecond)
+		finished <- true
+	}))
+	<-started
+
+	assert.True(t, ShutdownQueues(1*time.Second))
+	assert.Len(t, finished, 1) // running job was waited for
+	assert.Error(t, q.Dispatch(func() {}))
+}
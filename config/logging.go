@@ -1,16 +1,27 @@
 package config
 
 import (
+	"io"
 	"log/slog"
 	"os"
 )
 
-func InitLogger(isDev bool) {
-	var handler slog.Handler
+func InitLogger(isDev bool, format string) {
+	slog.SetDefault(slog.New(newLogHandler(os.Stdout, isDev, format)))
+	sentryLogger = nil // rebuild on next use to wrap the new default handler
+}
+
+func newLogHandler(w io.Writer, isDev bool, format string) slog.Handler {
+	level := slog.LevelInfo
 	if isDev {
-		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
-	} else {
-		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})
+		level = slog.LevelDebug
+	}
+	if format == "" && !isDev {
+		format = LogFormatJson
+	}
+
+	if format == LogFormatJson {
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
 	}
-	slog.SetDefault(slog.New(handler))
+	return slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})
 }
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPrincipal struct{ id string }
+
+func (p *testPrincipal) GetPrincipalIdentity() string { return p.id }
+
+func TestLog_RequestJson(t *testing.T) {
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(newLogHandler(&buf, false, LogFormatJson)))
+	sentryLogger = nil
+	defer InitLogger(true, "")
+
+	r := httptest.NewRequest(http.MethodGet, "/api/summary?interval=today", nil)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, "req-1"))
+	r = r.WithContext(context.WithValue(r.Context(), "principal", &testPrincipal{id: "user1"}))
+
+	Log().Request(r).Error("something failed", "error", nil)
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "ERROR", entry["level"])
+	assert.Equal(t, "something failed", entry["msg"])
+	assert.NotEmpty(t, entry["time"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, map[string]interface{}{"method": "GET", "path": "/api/summary"}, entry["http"])
+	assert.Equal(t, map[string]interface{}{"id": "user1"}, entry["user"])
+	assert.NotContains(t, entry, "request")
+
+	// request fields must not leak into subsequent log calls
+	buf.Reset()
+	Log().Error("another failure")
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.NotContains(t, buf.String(), "req-1")
+}
+
+func TestLog_RequestNil(t *testing.T) {
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(newLogHandler(&buf, false, LogFormatJson)))
+	sentryLogger = nil
+	defer InitLogger(true, "")
+
+	assert.NotPanics(t, func() {
+		Log().Request(nil).Warn("no request", "user", nil)
+		Log().Request(httptest.NewRequest(http.MethodGet, "/", nil)).Warn("anonymous request")
+	})
+	assert.Contains(t, buf.String(), "anonymous request")
+	assert.NotContains(t, buf.String(), `"user":{`)
+}
+
+func Test_newLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	slog.New(newLogHandler(&buf, true, "")).Info("hello")
+	assert.Contains(t, buf.String(), "msg=hello")
+
+	buf.Reset()
+	slog.New(newLogHandler(&buf, true, LogFormatJson)).Info("hello")
+	assert.Contains(t, buf.String(), `"msg":"hello"`)
+
+	buf.Reset()
+	slog.New(newLogHandler(&buf, false, LogFormatText)).Info("hello")
+	assert.Contains(t, buf.String(), "msg=hello")
+}
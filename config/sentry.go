@@ -2,6 +2,7 @@ package config
 
 import (
 	"github.com/getsentry/sentry-go"
+	"github.com/go-chi/chi/v5/middleware"
 	slogmulti "github.com/samber/slog-multi"
 	slogsentry "github.com/samber/slog-sentry/v2"
 	"log/slog"
@@ -59,12 +60,26 @@ func (l *SentryLogger) Fatal(msg string, args ...any) {
 	os.Exit(1)
 }
 
+// Request returns a logger enriched with request-scoped fields, i.e. the raw request (only passed on to sentry), its id and path and the requesting user
 func (l *SentryLogger) Request(r *http.Request) *slog.Logger {
-	l.Logger = l.Logger.With("request", r)
+	if r == nil {
+		return l.Logger
+	}
+
+	requestAttrs := []any{slog.String("method", r.Method)}
+	if r.URL != nil {
+		requestAttrs = append(requestAttrs, slog.String("path", r.URL.Path))
+	}
+
+	logger := l.Logger.With("request", r)
+	if reqId := middleware.GetReqID(r.Context()); reqId != "" {
+		logger = logger.With(slog.String("request_id", reqId))
+	}
+	logger = logger.With(slog.Group("http", requestAttrs...))
 	if uid := getPrincipal(r); uid != "" {
-		l.Logger = l.Logger.With(slog.Group("user", slog.String("id", uid)))
+		logger = logger.With(slog.Group("user", slog.String("id", uid)))
 	}
-	return l.Logger
+	return logger
 }
 
 var heartbeatsRouteRegex = regexp.MustCompile(`^POST /api/(?:compat/wakatime/)?(?:v1/)?(?:users/[\w\d-_]+/)?heartbeats?(?:\.bulk)?$`)
@@ -110,8 +125,8 @@ func getPrincipal(r *http.Request) string {
 		GetPrincipalIdentity() string
 	}
 
-	if p := r.Context().Value("principal"); p != nil {
-		return p.(principalIdentityGetter).GetPrincipalIdentity()
+	if p, ok := r.Context().Value("principal").(principalIdentityGetter); ok && p != nil {
+		return p.GetPrincipalIdentity()
 	}
 	return ""
 }
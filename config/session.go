@@ -9,6 +9,20 @@ var sessionStore *sessions.CookieStore
 func GetSessionStore() *sessions.CookieStore {
 	if sessionStore == nil {
 		sessionStore = sessions.NewCookieStore(Get().Security.SessionKey)
+		sessionStore.Options = newSessionOptions(Get())
 	}
 	return sessionStore
 }
+
+// session cookies share the attributes of all other cookies, e.g. to not get dropped when redirected back from a cross-site page, like the payment provider's checkout
+func newSessionOptions(c *Config) *sessions.Options {
+	cookie := c.CreateCookie("", "")
+	return &sessions.Options{
+		Path:     cookie.Path,
+		Domain:   cookie.Domain,
+		MaxAge:   cookie.MaxAge,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		SameSite: cookie.SameSite,
+	}
+}
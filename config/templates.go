@@ -3,6 +3,8 @@ package config
 const (
 	IndexTemplate         = "index.tpl.html"
 	LoginTemplate         = "login.tpl.html"
+	LoginTotpTemplate     = "login-2fa.tpl.html"
+	LoginRestoreTemplate  = "login-restore.tpl.html"
 	ImprintTemplate       = "imprint.tpl.html"
 	SignupTemplate        = "signup.tpl.html"
 	SetPasswordTemplate   = "set-password.tpl.html"
@@ -0,0 +1,346 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/duke-git/lancet/v2/slice"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/muety/wakapi/utils"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var minPluginVersionRegex = regexp.MustCompile(`^[\w.-]+\s*/\s*v?\d+(\.\d+)*$`)
+var maxRateRegex = regexp.MustCompile(`^\d+/\d+[smh]$`)
+
+// Validate checks for problems that prevent wakapi from starting up and returns all of them at once
+func (c *Config) Validate() []error {
+	var errs []error
+	fail := func(msg string, args ...any) {
+		errs = append(errs, fmt.Errorf(msg, args...))
+	}
+
+	if c.Server.ListenIpV4 == "-" && c.Server.ListenIpV6 == "-" && c.Server.ListenSocket == "" {
+		fail("either of listen_ipv4 or listen_ipv6 or listen_socket must be set")
+	}
+	if c.Db.MaxConn <= 0 {
+		fail("you must allow at least one database connection")
+	}
+	if c.Db.GetDialector() == nil {
+		fail("unknown database dialect '%s'", c.Db.Type)
+	}
+	if c.LogFormat != "" && c.LogFormat != LogFormatText && c.LogFormat != LogFormatJson {
+		fail("log_format must be one of '%s' or '%s'", LogFormatText, LogFormatJson)
+	}
+	if c.Mail.Provider != "" && utils.FindString(c.Mail.Provider, emailProviders, "") == "" {
+		fail("unknown mail provider '%s'", c.Mail.Provider)
+	}
+	if _, err := time.ParseDuration(c.App.HeartbeatMaxAge); err != nil {
+		fail("invalid duration set for heartbeat_max_age")
+	}
+	if _, err := regexp.Compile(c.App.UnknownBranchPattern); err != nil {
+		fail("invalid regular expression set for unknown_branch_pattern")
+	}
+	if c.Subscriptions.TrialPeriodDays < 0 || c.Subscriptions.TrialPeriodDays > 730 {
+		fail("trial_period_days must be between 0 and 730") // limit imposed by stripe
+	}
+	if c.Subscriptions.RenewalReminderDays < 0 {
+		fail("renewal_reminder_days must not be negative")
+	}
+	if c.App.HeartbeatBufferSec < 0 {
+		fail("heartbeat_buffer_sec must not be negative")
+	}
+	if c.App.HeartbeatBufferingEnabled() && c.App.HeartbeatBufferSize <= 0 {
+		fail("heartbeat_buffer_size must be positive when buffering is enabled")
+	}
+	if c.App.HeartbeatMaxFieldLen < 0 {
+		fail("heartbeat_max_field_length must not be negative")
+	}
+	if c.App.MaxHeartbeats < 0 || c.App.MaxHeartbeatsSubscribed < 0 {
+		fail("max_heartbeats and max_heartbeats_subscribed must not be negative")
+	}
+	if c.App.MaxAliasesPerType < 0 {
+		fail("max_aliases_per_type must not be negative")
+	}
+	if c.App.DuplicateProjectThreshold < 0 || c.App.DuplicateProjectThreshold > 1 {
+		fail("duplicate_project_threshold must be between 0 and 1")
+	}
+	if c.App.WarmSummaryCaches && c.App.WarmSummaryCachesDays <= 0 {
+		fail("warm_summary_caches_days must be positive when summary cache warming is enabled")
+	}
+	if c.App.PublicCacheMaxAgeSec < 0 {
+		fail("public_cache_max_age_sec must not be negative")
+	}
+	if c.App.ActiveDayThresholdSec < 0 {
+		fail("active_day_threshold_sec must not be negative")
+	}
+	if c.App.InactivityReminderDays < 0 {
+		fail("inactivity_reminder_days must not be negative")
+	}
+	if c.App.InactivityReminderDays > 0 && c.App.InactivityCooldownDays < c.App.InactivityReminderDays {
+		fail("inactivity_cooldown_days must not be less than inactivity_reminder_days")
+	}
+	if c.App.MaxConcurrentJobs < -1 {
+		fail("max_concurrent_jobs must be -1 (unlimited), 0 (number of cpus) or positive")
+	}
+	if c.App.SummaryCacheTTLMin <= 0 {
+		fail("summary_cache_ttl_min must be positive")
+	}
+	if c.App.ExportLinkExpiryHours <= 0 {
+		fail("export_link_expiry_hours must be positive")
+	}
+	if c.App.DownsampleAfterDays < 0 || c.App.DownsampleAfterDays == 1 {
+		fail("downsample_after_days must be 0 (disabled) or at least 2") // yesterday's summary might not have been aggregated yet
+	}
+	if c.App.DownsampleGranularity != DownsampleDaily && c.App.DownsampleGranularity != DownsampleHourly {
+		fail("downsample_granularity must be one of '%s' or '%s'", DownsampleDaily, DownsampleHourly)
+	}
+	if c.App.LateHeartbeats != LateHeartbeatsRecompute && c.App.LateHeartbeats != LateHeartbeatsReject {
+		fail("late_heartbeats must be one of '%s' or '%s'", LateHeartbeatsRecompute, LateHeartbeatsReject)
+	}
+	if c.App.LateHeartbeats == LateHeartbeatsReject && c.App.LateHeartbeatsHorizonDays < 1 {
+		fail("late_heartbeats_horizon_days must be at least 1") // today's heartbeats are never late
+	}
+	if c.App.HeartbeatsMissingFields != HeartbeatsMissingFieldsDefaults && c.App.HeartbeatsMissingFields != HeartbeatsMissingFieldsReject {
+		fail("heartbeats_missing_fields must be one of '%s' or '%s'", HeartbeatsMissingFieldsDefaults, HeartbeatsMissingFieldsReject)
+	}
+	for i, rule := range c.App.CategoryRules {
+		if rule.Category == "" || (rule.Entity == "" && rule.Type == "" && rule.Language == "") {
+			fail("category_rules[%d] must have a category and at least one of entity, type or language", i)
+		}
+	}
+	for _, item := range splitCommaList(c.App.MinPluginVersions) {
+		if !minPluginVersionRegex.MatchString(item) {
+			fail("invalid entry '%s' in min_plugin_versions, expected plugin/version (e.g. 'vscode-wakatime/24.0.0')", item)
+		}
+	}
+	if c.Security.PasswordHashAlgorithm != utils.PasswordHashArgon2Id && c.Security.PasswordHashAlgorithm != utils.PasswordHashBcrypt {
+		fail("invalid password hash algorithm '%s'", c.Security.PasswordHashAlgorithm)
+	}
+	if c.Security.BcryptCost < bcrypt.MinCost || c.Security.BcryptCost > bcrypt.MaxCost {
+		fail("bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if c.Security.PasswordMinLength < 0 {
+		fail("password_min_length must not be negative")
+	}
+	if c.Security.PasswordCharClasses < 0 || c.Security.PasswordCharClasses > 4 {
+		fail("password_char_classes must be between 0 and 4")
+	}
+	if !slice.Contain([]string{"lax", "strict", "none"}, strings.ToLower(c.Security.CookieSameSite)) {
+		fail("cookie_same_site must be one of 'lax', 'strict' or 'none'")
+	}
+	if c.Security.GetCookieSameSite() == http.SameSiteNoneMode && c.Security.InsecureCookies {
+		fail("cookie_same_site 'none' requires secure cookies, i.e. insecure_cookies must be false") // rejected by browsers otherwise
+	}
+	if c.Security.CookieMaxAgeSec < 0 {
+		fail("cookie_max_age must not be negative")
+	}
+	if c.Security.SessionMaxAgeSec < 0 || c.Security.SessionIdleTimeoutSec < 0 {
+		fail("session_max_age and session_idle_timeout must not be negative")
+	}
+	if c.Security.HeartbeatsMaxRate != "" && !maxRateRegex.MatchString(c.Security.HeartbeatsMaxRate) {
+		fail("invalid heartbeats_max_rate '%s', expected <max_req>/<multiplier><unit> (e.g. '600/1h')", c.Security.HeartbeatsMaxRate)
+	}
+	for _, rate := range [][2]string{{"signup_max_rate", c.Security.SignupMaxRate}, {"login_max_rate", c.Security.LoginMaxRate}, {"password_reset_max_rate", c.Security.PasswordResetMaxRate}} {
+		if _, _, err := parseRate(rate[1]); err != nil {
+			fail("invalid %s '%s', expected <max_req>/<multiplier><unit> (e.g. '5/1h')", rate[0], rate[1])
+		}
+	}
+	if c.Security.UnknownApiKeys != UnknownApiKeysReject && c.Security.UnknownApiKeys != UnknownApiKeysProvision {
+		fail("unknown_api_keys must be one of '%s' or '%s'", UnknownApiKeysReject, UnknownApiKeysProvision)
+	}
+	if c.Security.UnknownApiKeys == UnknownApiKeysProvision && len(c.Security.ProvisionAllowedIPs()) == 0 {
+		fail("unknown_api_keys '%s' requires at least one valid entry in provision_allowed_ips", UnknownApiKeysProvision) // never provision users for arbitrary clients
+	}
+	for _, group := range c.Security.GetIPRestrictedRoutes() {
+		if !slice.Contain(IPRestrictedRouteGroups, group) {
+			fail("invalid route group '%s' in ip_restricted_routes, must be one of %s", group, strings.Join(IPRestrictedRouteGroups, ", "))
+		}
+	}
+	if len(c.Security.IPAllowlist()) != len(splitCommaList(c.Security.IpAllowlist)) || len(c.Security.IPDenylist()) != len(splitCommaList(c.Security.IpDenylist)) {
+		fail("ip_allowlist and ip_denylist must only contain valid ips or cidr ranges") // silently ignoring entries might grant access unintentionally
+	}
+	if c.Server.CorsAllowCredentials && slice.Contain(c.Server.GetCorsAllowedOrigins(), "*") {
+		fail("cors_allow_credentials must not be combined with a wildcard origin in cors_allowed_origins")
+	}
+	if c.Server.ShutdownDelaySec < 0 {
+		fail("shutdown_delay_sec must not be negative")
+	}
+	if c.Server.ShutdownTimeoutSec <= 0 {
+		fail("shutdown_timeout_sec must be positive")
+	}
+	if c.Server.SlowRequestThresholdMs < 0 || c.Db.SlowQueryThresholdMs < 0 {
+		fail("slow_request_threshold_ms and slow_query_threshold_ms must not be negative")
+	}
+	if d, err := time.Parse(c.App.DateFormat, c.App.DateFormat); err != nil || !d.Equal(time.Date(2006, time.January, 2, 0, 0, 0, 0, d.Location())) {
+		fail("invalid date format '%s'", c.App.DateFormat)
+	}
+	if d, err := time.Parse(c.App.DateTimeFormat, c.App.DateTimeFormat); err != nil || !d.Equal(time.Date(2006, time.January, 2, 15, 4, 0, 0, d.Location())) {
+		fail("invalid datetime format '%s'", c.App.DateTimeFormat)
+	}
+
+	cronParser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+	parseCron := func(expr string, err error) error {
+		if err != nil {
+			return err
+		}
+		_, err = cronParser.Parse(expr)
+		return err
+	}
+
+	if err := parseCron(parseWeeklyCron(c.App.ReportTimeWeekly)); err != nil {
+		fail("invalid cron expression for report_time_weekly")
+	}
+	if err := parseCron(parseDailyCron(c.App.AggregationTime)); err != nil {
+		fail("invalid cron expression for aggregation_time")
+	}
+	for _, s := range utils.SplitMulti(c.App.LeaderboardGenerationTime, ",", ";") {
+		if err := parseCron(parseDailyCron(strings.TrimSpace(s))); err != nil {
+			fail("invalid cron expression for leaderboard_generation_time")
+			break
+		}
+	}
+
+	// see models/interval.go
+	if !slice.Contain[string](leaderboardScopes, c.App.LeaderboardScope) {
+		fail("leaderboard scope is not a valid constant")
+	}
+
+	return errs
+}
+
+// validateRuntime checks for settings that don't prevent wakapi from starting up, but will make individual features fail later on
+func (c *Config) validateRuntime() []error {
+	var errs []error
+	fail := func(msg string, args ...any) {
+		errs = append(errs, fmt.Errorf(msg, args...))
+	}
+
+	if u, err := url.Parse(c.Server.PublicUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fail("public_url must be an absolute http(s) url")
+	}
+	if (c.Server.TlsCertPath == "") != (c.Server.TlsKeyPath == "") {
+		fail("tls_cert_path and tls_key_path must either both be set or both be empty")
+	}
+
+	if err := c.Db.validateConnection(); err != nil {
+		fail("invalid database connection settings: %v", err)
+	}
+	if c.Db.HasReplica() {
+		if err := c.Db.validateReplicaConnection(); err != nil {
+			fail("invalid database replica_dsn: %v", err)
+		}
+	}
+
+	if c.Mail.Enabled {
+		if _, err := netmail.ParseAddress(c.Mail.Sender); err != nil {
+			fail("mail sender '%s' is not a valid e-mail address", c.Mail.Sender)
+		}
+		if c.Mail.Provider == MailProviderSmtp {
+			if c.Mail.Smtp.Host == "" {
+				fail("smtp host must be set when mail is enabled")
+			}
+			if c.Mail.Smtp.Port == 0 {
+				fail("smtp port must be set when mail is enabled")
+			}
+			if c.Mail.Smtp.TimeoutSec <= 0 {
+				fail("smtp timeout_sec must be positive")
+			}
+			for i, f := range c.Mail.Smtp.Fallbacks {
+				if f.Host == "" || f.Port == 0 {
+					fail("host and port must be set for smtp fallback server #%d", i+1)
+				}
+			}
+		}
+	}
+	if c.ObjectStore.IsEnabled() {
+		if endpoint, err := url.Parse(c.ObjectStore.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			fail("object_store endpoint '%s' must be an http or https url", c.ObjectStore.Endpoint)
+		}
+		if c.ObjectStore.Bucket == "" || c.ObjectStore.Region == "" {
+			fail("object_store bucket and region must be set when an endpoint is configured")
+		}
+		if c.ObjectStore.AccessKeyId == "" || c.ObjectStore.SecretAccessKey == "" {
+			fail("object_store access_key_id and secret_access_key must be set when an endpoint is configured")
+		}
+	}
+	if c.Mail.TemplatesDir != "" {
+		if info, err := os.Stat(c.Mail.TemplatesDir); err != nil || !info.IsDir() {
+			fail("mail templates_dir '%s' is not a directory", c.Mail.TemplatesDir)
+		}
+	}
+
+	if c.Subscriptions.Enabled {
+		required := map[string]string{
+			"stripe_api_key":         c.Subscriptions.StripeApiKey,
+			"stripe_secret_key":      c.Subscriptions.StripeSecretKey,
+			"stripe_endpoint_secret": c.Subscriptions.StripeEndpointSecret,
+			"standard_price_id":      c.Subscriptions.StandardPriceId,
+		}
+		for _, key := range []string{"stripe_api_key", "stripe_secret_key", "stripe_endpoint_secret", "standard_price_id"} {
+			if required[key] == "" {
+				fail("subscriptions.%s must be set when subscriptions are enabled", key)
+			}
+		}
+	}
+
+	return errs
+}
+
+func (c *dbConfig) validateConnection() error {
+	switch c.Dialect {
+	case SQLDialectSqlite:
+		if c.Name == "" {
+			return errors.New("name must be set to the database file path")
+		}
+	case SQLDialectMysql:
+		if c.DSN == "" && c.Host == "" && c.Socket == "" {
+			return errors.New("either of dsn, host or socket must be set")
+		}
+		if _, err := mysql.ParseDSN(mysqlConnectionString(c)); err != nil {
+			return err
+		}
+	case SQLDialectPostgres:
+		if c.DSN == "" && c.Host == "" {
+			return errors.New("either of dsn or host must be set")
+		}
+		if _, err := pgconn.ParseConfig(postgresConnectionString(c)); err != nil {
+			return err
+		}
+	case SQLDialectMssql:
+		if c.Host == "" {
+			return errors.New("host must be set")
+		}
+		if _, err := msdsn.Parse(mssqlConnectionString(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// see GetReplicaDialector
+func (c *dbConfig) validateReplicaConnection() error {
+	replicaConfig := *c
+	replicaConfig.DSN = c.ReplicaDSN
+
+	switch c.Dialect {
+	case SQLDialectSqlite:
+		replicaConfig.Name = c.ReplicaDSN
+	case SQLDialectMssql:
+		_, err := msdsn.Parse(c.ReplicaDSN)
+		return err
+	}
+
+	return replicaConfig.validateConnection()
+}
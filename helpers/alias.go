@@ -0,0 +1,118 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/muety/wakapi/models"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseAliasRules decodes an alias rules file, either json or yaml, e.g.:
+//
+//	projects:
+//	  wakapi:
+//	    - wakapi-mobile
+//	    - wakapi-*
+//	languages:
+//	  Go:
+//	    - golang
+func ParseAliasRules(data []byte) (models.AliasRules, error) {
+	var rules models.AliasRules
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("empty alias rules file")
+	}
+
+	// yaml is a superset of json in theory, but tab-indented json is not accepted by the yaml parser
+	if trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &rules); err != nil {
+			return nil, fmt.Errorf("invalid json: %v", err)
+		}
+	} else if err := yaml.Unmarshal(trimmed, &rules); err != nil {
+		return nil, fmt.Errorf("invalid yaml: %v", err)
+	}
+
+	return rules, nil
+}
+
+// AliasesFromRules converts the rules into the user's aliases. If any original name is mapped to different keys, no aliases are returned, but the list of conflicts instead.
+func AliasesFromRules(rules models.AliasRules, userId string) ([]*models.Alias, []*models.AliasRuleConflict, error) {
+	fields := make([]string, 0, len(rules))
+	for field := range rules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	aliases := make([]*models.Alias, 0)
+	conflicts := make([]*models.AliasRuleConflict, 0)
+
+	for _, field := range fields {
+		summaryType, ok := SummaryFieldType(strings.ToLower(field))
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown alias type '%s'", field)
+		}
+
+		keys := make([]string, 0, len(rules[field]))
+		for key := range rules[field] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		aliasKeys := make(map[string][]string) // value -> keys
+		aliasValues := make([]string, 0)       // values in order of first occurrence
+
+		for _, key := range keys {
+			for _, value := range rules[field][key] {
+				alias := &models.Alias{Type: summaryType, UserID: userId, Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)}
+				if !alias.IsValid() {
+					return nil, nil, fmt.Errorf("invalid alias '%s' -> '%s' for type '%s'", value, key, field)
+				}
+
+				if existing, ok := aliasKeys[alias.Value]; !ok {
+					aliasValues = append(aliasValues, alias.Value)
+					aliases = append(aliases, alias)
+				} else if existing[len(existing)-1] == alias.Key {
+					continue // duplicate
+				}
+				aliasKeys[alias.Value] = append(aliasKeys[alias.Value], alias.Key)
+			}
+		}
+
+		for _, value := range aliasValues {
+			if len(aliasKeys[value]) > 1 {
+				conflicts = append(conflicts, &models.AliasRuleConflict{Type: field, Value: value, Keys: aliasKeys[value]})
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, conflicts, nil
+	}
+	return aliases, nil, nil
+}
+
+// AliasRulesFromAliases converts the user's aliases into rules, as opposed to AliasesFromRules
+func AliasRulesFromAliases(aliases []*models.Alias) models.AliasRules {
+	rules := make(models.AliasRules)
+	for _, a := range aliases {
+		field, ok := SummaryTypeField(a.Type)
+		if !ok {
+			continue
+		}
+		if _, ok := rules[field]; !ok {
+			rules[field] = make(map[string][]string)
+		}
+		rules[field][a.Key] = append(rules[field][a.Key], a.Value)
+	}
+	for _, keys := range rules {
+		for _, values := range keys {
+			sort.Strings(values)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,89 @@
+package helpers
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseAliasRules(t *testing.T) {
+	yamlRules := []byte(`
+projects:
+  wakapi:
+    - wakapi-mobile
+    - wakapi-*
+languages:
+  Go:
+    - golang
+`)
+	jsonRules := []byte("{\n\t\"projects\": {\"wakapi\": [\"wakapi-mobile\", \"wakapi-*\"]},\n\t\"languages\": {\"Go\": [\"golang\"]}\n}")
+
+	expected := models.AliasRules{
+		"projects":  {"wakapi": {"wakapi-mobile", "wakapi-*"}},
+		"languages": {"Go": {"golang"}},
+	}
+
+	rules, err := ParseAliasRules(yamlRules)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, rules)
+
+	rules, err = ParseAliasRules(jsonRules)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, rules)
+
+	_, err = ParseAliasRules([]byte("projects: [foo"))
+	assert.Error(t, err)
+
+	_, err = ParseAliasRules([]byte(" "))
+	assert.Error(t, err)
+}
+
+func TestAliasesFromRules(t *testing.T) {
+	aliases, conflicts, err := AliasesFromRules(models.AliasRules{
+		"projects": {"wakapi": {"wakapi-mobile", "wakapi-*", "wakapi-mobile"}},
+		"editors":  {"VSCode": {"vscode"}},
+	}, "john")
+	assert.Nil(t, err)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, []*models.Alias{
+		{Type: models.SummaryEditor, UserID: "john", Key: "VSCode", Value: "vscode"},
+		{Type: models.SummaryProject, UserID: "john", Key: "wakapi", Value: "wakapi-mobile"},
+		{Type: models.SummaryProject, UserID: "john", Key: "wakapi", Value: "wakapi-*"},
+	}, aliases)
+
+	aliases, conflicts, err = AliasesFromRules(models.AliasRules{
+		"projects":  {"wakapi": {"wakapi-mobile"}, "anchr": {"wakapi-mobile", "anchr-web"}},
+		"languages": {"Go": {"wakapi-mobile"}},
+	}, "john")
+	assert.Nil(t, err)
+	assert.Nil(t, aliases)
+	assert.Equal(t, []*models.AliasRuleConflict{
+		{Type: "projects", Value: "wakapi-mobile", Keys: []string{"anchr", "wakapi"}},
+	}, conflicts)
+
+	_, _, err = AliasesFromRules(models.AliasRules{"foo": {"bar": {"baz"}}}, "john")
+	assert.Error(t, err)
+
+	_, _, err = AliasesFromRules(models.AliasRules{"projects": {"wakapi": {"*"}}}, "john")
+	assert.Error(t, err)
+}
+
+func TestAliasRulesFromAliases(t *testing.T) {
+	aliases := []*models.Alias{
+		{Type: models.SummaryProject, UserID: "john", Key: "wakapi", Value: "wakapi-mobile"},
+		{Type: models.SummaryEditor, UserID: "john", Key: "VSCode", Value: "vscode"},
+		{Type: models.SummaryProject, UserID: "john", Key: "wakapi", Value: "wakapi-*"},
+	}
+
+	rules := AliasRulesFromAliases(aliases)
+	assert.Equal(t, models.AliasRules{
+		"projects": {"wakapi": {"wakapi-*", "wakapi-mobile"}},
+		"editors":  {"VSCode": {"vscode"}},
+	}, rules)
+
+	// round trip
+	result, conflicts, err := AliasesFromRules(rules, "john")
+	assert.Nil(t, err)
+	assert.Empty(t, conflicts)
+	assert.ElementsMatch(t, aliases, result)
+}
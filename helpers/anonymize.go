@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/duke-git/lancet/v2/slice"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+)
+
+var anonymizedLabels = map[uint8]string{
+	models.SummaryProject:  "Project",
+	models.SummaryLanguage: "Language",
+	models.SummaryEditor:   "Editor",
+	models.SummaryLabel:    "Label",
+	models.SummaryBranch:   "Branch",
+	models.SummaryEntity:   "File",
+}
+
+// AnonymizeKey returns a pseudonym for the given entity key (e.g. "Project 3fa2c1d0"), which is stable for the same user.
+// It's derived using a server-side secret, so that real names can't be confirmed by hashing guesses.
+func AnonymizeKey(user *models.User, entityType uint8, key string) string {
+	mac := hmac.New(sha256.New, conf.Get().Security.GetSecretsKey())
+	mac.Write([]byte(fmt.Sprintf("%s:%d:%s", user.ID, entityType, key)))
+	label, ok := anonymizedLabels[entityType]
+	if !ok {
+		label = "Item"
+	}
+	return fmt.Sprintf("%s %s", label, hex.EncodeToString(mac.Sum(nil)[:4]))
+}
+
+// AnonymizeProjects returns a copy of the summary with the keys of the given projects (e.g. private ones) replaced by pseudonyms
+func AnonymizeProjects(summary *models.Summary, user *models.User, projects []string) *models.Summary {
+	if len(projects) == 0 {
+		return summary
+	}
+	return summary.WithAnonymizedKeys([]uint8{models.SummaryProject}, func(t uint8, key string) string {
+		if slice.Contain(projects, key) {
+			return AnonymizeKey(user, t, key)
+		}
+		return key
+	})
+}
+
+// AnonymizeSummary returns a copy of the summary with keys replaced according to the user's anonymization settings
+func AnonymizeSummary(summary *models.Summary, user *models.User) *models.Summary {
+	types := user.AnonymizedTypes()
+	if len(types) == 0 {
+		return summary
+	}
+	return summary.WithAnonymizedKeys(types, func(t uint8, key string) string {
+		return AnonymizeKey(user, t, key)
+	})
+}
@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	"testing"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymizeKey(t *testing.T) {
+	conf.Set(conf.Empty())
+
+	user1, user2 := &models.User{ID: "user1"}, &models.User{ID: "user2"}
+
+	key := AnonymizeKey(user1, models.SummaryProject, "wakapi")
+	assert.Regexp(t, `^Project [0-9a-f]{8}$`, key)
+	assert.Equal(t, key, AnonymizeKey(user1, models.SummaryProject, "wakapi"))
+	assert.NotEqual(t, key, AnonymizeKey(user1, models.SummaryProject, "anchr"))
+	assert.NotEqual(t, key, AnonymizeKey(user2, models.SummaryProject, "wakapi"))
+	assert.Regexp(t, `^Language [0-9a-f]{8}$`, AnonymizeKey(user1, models.SummaryLanguage, "Go"))
+}
+
+func TestAnonymizeSummary(t *testing.T) {
+	conf.Set(conf.Empty())
+
+	user := &models.User{ID: "user1", AnonymizeProjects: true}
+	summary := &models.Summary{
+		Projects:  models.SummaryItems{{Type: models.SummaryProject, Key: "wakapi"}},
+		Languages: models.SummaryItems{{Type: models.SummaryLanguage, Key: "Go"}},
+	}
+
+	result := AnonymizeSummary(summary, user)
+	assert.Equal(t, AnonymizeKey(user, models.SummaryProject, "wakapi"), result.Projects[0].Key)
+	assert.Equal(t, "Go", result.Languages[0].Key)
+
+	user.AnonymizeProjects = false
+	assert.Same(t, summary, AnonymizeSummary(summary, user))
+}
+
+func TestAnonymizeProjects(t *testing.T) {
+	conf.Set(conf.Empty())
+
+	user := &models.User{ID: "user1"}
+	summary := &models.Summary{
+		Projects: models.SummaryItems{
+			{Type: models.SummaryProject, Key: "wakapi"},
+			{Type: models.SummaryProject, Key: "secret-project"},
+		},
+	}
+
+	result := AnonymizeProjects(summary, user, []string{"secret-project"})
+	assert.Equal(t, "wakapi", result.Projects[0].Key)
+	assert.Equal(t, AnonymizeKey(user, models.SummaryProject, "secret-project"), result.Projects[1].Key)
+	assert.Equal(t, "secret-project", summary.Projects[1].Key)
+	assert.Same(t, summary, AnonymizeProjects(summary, user, []string{}))
+}
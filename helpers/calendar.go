@@ -0,0 +1,23 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+)
+
+// CalendarToken returns a read-only token, which grants access to the user's calendar feed, so that it can be subscribed to without exposing the api key.
+// It's derived from the api key, hence resetting the api key invalidates it as well.
+func CalendarToken(user *models.User) string {
+	mac := hmac.New(sha256.New, conf.Get().Security.GetSecretsKey())
+	mac.Write([]byte("calendar:" + user.ID + ":" + user.ApiKey))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// IsValidCalendarToken tells whether the given token grants access to the user's calendar feed
+func IsValidCalendarToken(user *models.User, token string) bool {
+	return token != "" && hmac.Equal([]byte(token), []byte(CalendarToken(user)))
+}
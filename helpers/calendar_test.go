@@ -0,0 +1,24 @@
+package helpers
+
+import (
+	"testing"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarToken(t *testing.T) {
+	conf.Set(conf.Empty())
+
+	user := &models.User{ID: "user1", ApiKey: "e0bd0751-0734-4bc5-8b53-ba2f0d5f3a2a"}
+	token := CalendarToken(user)
+
+	assert.Regexp(t, `^[0-9a-f]{32}$`, token)
+	assert.True(t, IsValidCalendarToken(user, token))
+	assert.False(t, IsValidCalendarToken(user, ""))
+	assert.False(t, IsValidCalendarToken(&models.User{ID: "user2", ApiKey: user.ApiKey}, token))
+
+	user.ApiKey = "53cb6a8c-9ad6-4e5f-a1c9-5a9a1f1e8b7d"
+	assert.False(t, IsValidCalendarToken(user, token))
+}
@@ -3,9 +3,13 @@ package helpers
 import (
 	"fmt"
 	"github.com/muety/wakapi/config"
+	"regexp"
+	"strconv"
 	"time"
 )
 
+var relativeDateTimeRegex = regexp.MustCompile(`^(?:now)?-(\d{1,6})([mhdw])$`)
+
 // ParseDateTimeTZ attempts to parse the given date string from multiple formats.
 // First, a time-zoned date-time string (e.g. 2006-01-02T15:04:05+02:00) is tried
 // Second, a non-time-zoned date-time string (e.g. 2006-01-02 15:04:05) is tried at the given zone
@@ -24,6 +28,32 @@ func ParseDateTimeTZ(date string, tz *time.Location) (time.Time, error) {
 	return time.ParseInLocation(config.SimpleDateFormat, date, tz)
 }
 
+// ParseRelativeDateTimeTZ parses a point in time relative to the current time, i.e. "now" or "-<n><unit>" (optionally prefixed with "now") with unit m (minutes), h (hours), d (days) or w (weeks), e.g. "-30d".
+// Days and weeks are calendar days in the given zone, so that e.g. "-1d" always refers to the same time of day yesterday, regardless of daylight saving time.
+// The second return value tells whether the string is in relative syntax at all.
+func ParseRelativeDateTimeTZ(date string, tz *time.Location) (time.Time, bool) {
+	now := time.Now().In(tz)
+	if date == "now" {
+		return now, true
+	}
+
+	match := relativeDateTimeRegex.FindStringSubmatch(date)
+	if match == nil {
+		return time.Time{}, false
+	}
+	n, _ := strconv.Atoi(match[1])
+	switch match[2] {
+	case "m":
+		return now.Add(-time.Duration(n) * time.Minute), true
+	case "h":
+		return now.Add(-time.Duration(n) * time.Hour), true
+	case "d":
+		return now.AddDate(0, 0, -n), true
+	default:
+		return now.AddDate(0, 0, -n*7), true
+	}
+}
+
 func FormatDate(date time.Time) string {
 	return date.Format(config.SimpleDateFormat)
 }
@@ -0,0 +1,32 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRelativeDateTimeTZ(t *testing.T) {
+	tz, _ := time.LoadLocation("America/Los_Angeles")
+	now := time.Now().In(tz)
+
+	result, ok := ParseRelativeDateTimeTZ("now", tz)
+	assert.True(t, ok)
+	assert.WithinDuration(t, now, result, time.Second)
+	assert.Equal(t, tz, result.Location())
+
+	result, _ = ParseRelativeDateTimeTZ("-90m", tz)
+	assert.WithinDuration(t, now.Add(-90*time.Minute), result, time.Second)
+	result, _ = ParseRelativeDateTimeTZ("now-12h", tz)
+	assert.WithinDuration(t, now.Add(-12*time.Hour), result, time.Second)
+	result, _ = ParseRelativeDateTimeTZ("-30d", tz)
+	assert.WithinDuration(t, now.AddDate(0, 0, -30), result, time.Second)
+	result, _ = ParseRelativeDateTimeTZ("-2w", tz)
+	assert.WithinDuration(t, now.AddDate(0, 0, -14), result, time.Second)
+
+	for _, tc := range []string{"", "2021-02-07", "30d", "+30d", "-30y", "-d", "now+1h", "-1234567d"} {
+		_, ok := ParseRelativeDateTimeTZ(tc, tz)
+		assert.False(t, ok, tc)
+	}
+}
@@ -3,22 +3,39 @@ package helpers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
 	"net/http"
 )
 
-func ExtractCookieAuth(r *http.Request, config *config.Config) (username *string, err error) {
+func ExtractCookieAuth(r *http.Request, config *config.Config) (*models.Session, error) {
 	cookie, err := r.Cookie(models.AuthCookieKey)
 	if err != nil {
 		return nil, errors.New("missing authentication")
 	}
 
-	if err := config.Security.SecureCookie.Decode(models.AuthCookieKey, cookie.Value, &username); err != nil {
+	var session models.Session
+	if err := config.Security.SecureCookie.Decode(models.AuthCookieKey, cookie.Value, &session); err != nil || session.UserID == "" {
 		return nil, errors.New("cookie is invalid")
 	}
 
-	return username, nil
+	return &session, nil
+}
+
+func ExtractImpersonation(r *http.Request, config *config.Config) (*models.Impersonation, error) {
+	cookie, err := r.Cookie(models.ImpersonationCookieKey)
+	if err != nil {
+		return nil, errors.New("not impersonating")
+	}
+
+	var impersonation models.Impersonation
+	if err := config.Security.SecureCookie.Decode(models.ImpersonationCookieKey, cookie.Value, &impersonation); err != nil {
+		return nil, errors.New("cookie is invalid")
+	}
+
+	return &impersonation, nil
 }
 
 func RespondJSON(w http.ResponseWriter, r *http.Request, status int, object interface{}) {
@@ -28,3 +45,62 @@ func RespondJSON(w http.ResponseWriter, r *http.Request, status int, object inte
 		config.Log().Request(r).Error("error while writing json response", "error", err)
 	}
 }
+
+// RespondNegotiated responds with the given object encoded as MessagePack if requested by the client's Accept header, or as JSON otherwise
+func RespondNegotiated(w http.ResponseWriter, r *http.Request, status int, object interface{}) {
+	w.Header().Add("Vary", "Accept")
+	if !utils.AcceptsMsgpack(r) {
+		RespondJSON(w, r, status, object)
+		return
+	}
+
+	body, err := utils.MarshalMsgpack(object)
+	if err != nil {
+		config.Log().Request(r).Error("error while encoding msgpack response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(config.ErrInternalServerError))
+		return
+	}
+	w.Header().Set("Content-Type", utils.MimeTypeMsgpack)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// RespondCacheable writes the given body along with cache headers and a weak etag, or only responds with 304 if the client's copy is still up-to-date.
+// Public responses may be cached by proxies (e.g. shields.io's) for the configured duration, others must be revalidated by the client on every use.
+func RespondCacheable(w http.ResponseWriter, r *http.Request, contentType string, body []byte, public bool) {
+	etag := utils.WeakETag(body)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControlHeader(public, config.Get().App.PublicCacheMaxAgeSec))
+
+	if utils.IsNotModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// RespondJSONCacheable is like RespondJSON with status 200, but sets cache headers as described for RespondCacheable
+func RespondJSONCacheable(w http.ResponseWriter, r *http.Request, object interface{}, public bool) {
+	body, err := json.Marshal(object)
+	if err != nil {
+		config.Log().Request(r).Error("error while encoding json response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(config.ErrInternalServerError))
+		return
+	}
+	RespondCacheable(w, r, "application/json", append(body, '\n'), public)
+}
+
+func cacheControlHeader(public bool, maxAgeSec int) string {
+	if !public {
+		return "private, no-cache"
+	}
+	if maxAgeSec <= 0 {
+		return "public, no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", maxAgeSec)
+}
@@ -0,0 +1,43 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRespondCacheable(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.PublicCacheMaxAgeSec = 3600
+	config.Set(cfg)
+
+	body := []byte("<svg></svg>")
+
+	w := httptest.NewRecorder()
+	RespondCacheable(w, httptest.NewRequest("GET", "/", nil), "image/svg+xml", body, true)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "public, max-age=3600", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.Equal(t, body, w.Body.Bytes())
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	RespondCacheable(w, r, "image/svg+xml", body, true)
+	assert.Equal(t, 304, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	RespondCacheable(w, httptest.NewRequest("GET", "/", nil), "image/svg+xml", body, false)
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+
+	cfg.App.PublicCacheMaxAgeSec = 0
+	w = httptest.NewRecorder()
+	RespondCacheable(w, httptest.NewRequest("GET", "/", nil), "image/svg+xml", body, true)
+	assert.Equal(t, "public, no-cache", w.Header().Get("Cache-Control"))
+}
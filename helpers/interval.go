@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/utils"
+	"strings"
 	"time"
 )
 
@@ -34,6 +35,21 @@ func ResolveIntervalRawTZ(interval string, tz *time.Location) (err error, from,
 	return ResolveIntervalTZ(parsed, tz)
 }
 
+// ResolveUserIntervalRaw additionally supports the given user's custom range presets (e.g. "preset:sprint"), resolved in their timezone
+func ResolveUserIntervalRaw(interval string, user *models.User) (err error, from, to time.Time) {
+	if !strings.HasPrefix(interval, models.RangePresetPrefix) {
+		return ResolveIntervalRawTZ(interval, user.TZ())
+	}
+
+	presets, _ := models.ParseRangePresets(user.RangePresets) // validated on save
+	preset := presets.Get(strings.TrimPrefix(interval, models.RangePresetPrefix))
+	if preset == nil {
+		return errors.New("unknown range preset"), time.Time{}, time.Time{}
+	}
+	from, to = preset.Resolve(user.TZ())
+	return nil, from, to
+}
+
 func ResolveIntervalTZ(interval *models.IntervalKey, tz *time.Location) (err error, from, to time.Time) {
 	now := time.Now().In(tz)
 	to = now
@@ -2,6 +2,7 @@ package helpers
 
 import (
 	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -25,3 +26,24 @@ func TestResolveMaximumRange_EdgeCases(t *testing.T) {
 	_, maximumInterval := ResolveMaximumRange(-1)
 	assert.Equal(t, models.IntervalAny, maximumInterval)
 }
+
+func TestResolveUserIntervalRaw(t *testing.T) {
+	tz, _ := time.LoadLocation("America/New_York")
+	user := &models.User{Location: tz.String(), RangePresets: "sprint: 14d\nq1: 2024-01-01..2024-03-31"}
+
+	err, from, to := ResolveUserIntervalRaw("preset:q1", user)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, tz), from)
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, tz), to)
+
+	err, from, _ = ResolveUserIntervalRaw("preset:sprint", user)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.BeginOfToday(tz).AddDate(0, 0, -13), from)
+
+	err, from, _ = ResolveUserIntervalRaw("today", user)
+	assert.Nil(t, err)
+	assert.Equal(t, utils.BeginOfToday(tz), from)
+
+	err, _, _ = ResolveUserIntervalRaw("preset:unknown", user)
+	assert.NotNil(t, err)
+}
@@ -2,8 +2,10 @@ package helpers
 
 import (
 	"errors"
+	"fmt"
 	"github.com/muety/wakapi/models"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -15,19 +17,31 @@ func ParseSummaryParams(r *http.Request) (*models.SummaryParams, error) {
 	var from, to time.Time
 
 	if interval := params.Get("interval"); interval != "" {
-		err, from, to = ResolveIntervalRawTZ(interval, user.TZ())
+		err, from, to = ResolveUserIntervalRaw(interval, user)
+	} else if rangeParam := params.Get("range"); rangeParam != "" {
+		err, from, to = ResolveUserIntervalRaw(rangeParam, user)
 	} else if start := params.Get("start"); start != "" {
-		err, from, to = ResolveIntervalRawTZ(start, user.TZ())
+		err, from, to = ResolveUserIntervalRaw(start, user)
 	} else {
-		from, err = ParseDateTimeTZ(params.Get("from"), user.TZ())
-		if err != nil {
-			return nil, errors.New("missing or invalid 'from' parameter")
+		var fromRelative, toRelative bool
+		if from, fromRelative = ParseRelativeDateTimeTZ(params.Get("from"), user.TZ()); !fromRelative {
+			if from, err = ParseDateTimeTZ(params.Get("from"), user.TZ()); err != nil {
+				return nil, errors.New("missing or invalid 'from' parameter")
+			}
 		}
 
-		to, err = ParseDateTimeTZ(params.Get("to"), user.TZ())
-		if err != nil {
-			return nil, errors.New("missing or invalid 'to' parameter")
+		if to, toRelative = ParseRelativeDateTimeTZ(params.Get("to"), user.TZ()); !toRelative {
+			if to, err = ParseDateTimeTZ(params.Get("to"), user.TZ()); err != nil {
+				return nil, errors.New("missing or invalid 'to' parameter")
+			}
 		}
+
+		if (fromRelative || toRelative) && !from.Before(to) {
+			return nil, errors.New("'from' must be before 'to'")
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	recompute := params.Get("recompute") != "" && params.Get("recompute") != "false"
@@ -72,9 +86,69 @@ func ParseSummaryFilters(r *http.Request) *models.Filters {
 	if q := r.URL.Query().Get("category"); q != "" {
 		filters.With(models.SummaryCategory, q)
 	}
+	if q := r.URL.Query().Get("dominant_branch"); q != "" && q != "false" {
+		filters.DominantBranch = true
+	}
+	if q := r.URL.Query().Get("write_only"); q != "" && q != "false" {
+		filters.WriteOnly = true
+	}
 	return filters
 }
 
+// SummaryFieldTotal is the pseudo field to request a summary's total time only, alongside the actual summary types
+const SummaryFieldTotal = "total"
+
+var summaryFields = map[string]uint8{
+	"projects":          models.SummaryProject,
+	"languages":         models.SummaryLanguage,
+	"editors":           models.SummaryEditor,
+	"operating_systems": models.SummaryOS,
+	"machines":          models.SummaryMachine,
+	"labels":            models.SummaryLabel,
+	"branches":          models.SummaryBranch,
+	"entities":          models.SummaryEntity,
+	"categories":        models.SummaryCategory,
+}
+
+// SummaryFieldType returns the summary type for the given field name (e.g. "languages")
+func SummaryFieldType(name string) (uint8, bool) {
+	t, ok := summaryFields[name]
+	return t, ok
+}
+
+// SummaryTypeField returns the field name (e.g. "languages") for the given summary type, as opposed to SummaryFieldType
+func SummaryTypeField(summaryType uint8) (string, bool) {
+	for name, t := range summaryFields {
+		if t == summaryType {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// ParseSummaryFields parses the comma-separated 'fields' parameter into the set of requested field names, nil if absent
+func ParseSummaryFields(r *http.Request) (map[string]uint8, error) {
+	q := r.URL.Query().Get("fields")
+	if q == "" {
+		return nil, nil
+	}
+
+	fields := make(map[string]uint8)
+	for _, name := range strings.Split(q, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == SummaryFieldTotal {
+			fields[name] = models.SummaryUnknown
+			continue
+		}
+		t, ok := summaryFields[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid 'fields' parameter, unknown field '%s'", name)
+		}
+		fields[name] = t
+	}
+	return fields, nil
+}
+
 func extractUser(r *http.Request) *models.User {
 	type principalGetter interface {
 		GetPrincipal() *models.User
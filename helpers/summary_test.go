@@ -0,0 +1,87 @@
+package helpers
+
+import (
+	"context"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type principalHolder struct {
+	user *models.User
+}
+
+func (p *principalHolder) GetPrincipal() *models.User {
+	return p.user
+}
+
+func TestParseSummaryFields(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/summary?interval=today", nil)
+	fields, err := ParseSummaryFields(r)
+	assert.Nil(t, err)
+	assert.Nil(t, fields)
+
+	r = httptest.NewRequest("GET", "/api/summary?fields=total,%20Projects,operating_systems", nil)
+	fields, err = ParseSummaryFields(r)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]uint8{
+		SummaryFieldTotal:   models.SummaryUnknown,
+		"projects":          models.SummaryProject,
+		"operating_systems": models.SummaryOS,
+	}, fields)
+
+	r = httptest.NewRequest("GET", "/api/summary?fields=total,foo", nil)
+	fields, err = ParseSummaryFields(r)
+	assert.Error(t, err)
+	assert.Nil(t, fields)
+}
+
+func TestParseSummaryFilters(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/summary?interval=today", nil)
+	filters := ParseSummaryFilters(r)
+	assert.Equal(t, 0, filters.Count())
+
+	r = httptest.NewRequest("GET", "/api/summary?interval=today&machine=muety-desktop", nil)
+	filters = ParseSummaryFilters(r)
+	assert.Equal(t, 1, filters.Count())
+	assert.Equal(t, models.OrFilter{"muety-desktop"}, filters.Machine)
+	assert.True(t, filters.MatchDuration(&models.Duration{Machine: "muety-desktop"}))
+	assert.False(t, filters.MatchDuration(&models.Duration{Machine: "muety-laptop"}))
+	assert.False(t, filters.WriteOnly)
+
+	r = httptest.NewRequest("GET", "/api/summary?interval=today&write_only=true", nil)
+	filters = ParseSummaryFilters(r)
+	assert.True(t, filters.WriteOnly)
+	assert.True(t, filters.IsEmpty()) // not an entity filter
+}
+
+func TestParseSummaryParams_Relative(t *testing.T) {
+	user := &models.User{ID: "user1", Location: "Europe/Berlin"}
+	request := func(query string) (*models.SummaryParams, error) {
+		r := httptest.NewRequest("GET", "/api/summary?"+query, nil)
+		r = r.WithContext(context.WithValue(r.Context(), "principal", &principalHolder{user: user}))
+		return ParseSummaryParams(r)
+	}
+
+	params, err := request("from=-30d&to=now")
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, -30), params.From, time.Second)
+	assert.WithinDuration(t, time.Now(), params.To, time.Second)
+	assert.Equal(t, user.TZ(), params.From.Location())
+
+	params, err = request("from=2021-02-07&to=-1h")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2021, 2, 7, 0, 0, 0, 0, user.TZ()), params.From)
+
+	_, err = request("from=now&to=-1h")
+	assert.Error(t, err)
+	_, err = request("from=-30x&to=now")
+	assert.Error(t, err)
+
+	// absolute dates keep working as before
+	params, err = request("from=2021-02-08&to=2021-02-07")
+	assert.Nil(t, err)
+	assert.True(t, params.To.Before(params.From))
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"io/fs"
 	"log"
@@ -9,7 +11,10 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/duke-git/lancet/v2/condition"
@@ -63,30 +68,55 @@ var (
 	userRepository            repositories.IUserRepository
 	languageMappingRepository repositories.ILanguageMappingRepository
 	projectLabelRepository    repositories.IProjectLabelRepository
+	archivedProjectRepository repositories.IArchivedProjectRepository
+	defaultBranchRepository   repositories.IProjectDefaultBranchRepository
+	projectMetadataRepository repositories.IProjectMetadataRepository
+	componentRuleRepository   repositories.IProjectComponentRuleRepository
 	summaryRepository         repositories.ISummaryRepository
 	leaderboardRepository     *repositories.LeaderboardRepository
 	keyValueRepository        repositories.IKeyValueRepository
 	diagnosticsRepository     repositories.IDiagnosticsRepository
 	metricsRepository         *repositories.MetricsRepository
+	webhookRepository         repositories.IWebhookRepository
+	orgRepository             repositories.IOrgRepository
+	queuedMailRepository      repositories.IQueuedMailRepository
+	userSessionRepository     repositories.IUserSessionRepository
 )
 
 var (
 	aliasService           services.IAliasService
+	aliasRecomputeService  services.IAliasRecomputeService
 	heartbeatService       services.IHeartbeatService
 	userService            services.IUserService
 	languageMappingService services.ILanguageMappingService
 	projectLabelService    services.IProjectLabelService
+	projectArchiveService  services.IProjectArchiveService
+	defaultBranchService   services.IProjectDefaultBranchService
+	projectMetadataService services.IProjectMetadataService
+	componentService       services.IProjectComponentService
+	duplicateService       services.IProjectDuplicateService
 	durationService        services.IDurationService
+	entityService          services.IEntityService
 	summaryService         services.ISummaryService
 	leaderboardService     services.ILeaderboardService
 	aggregationService     services.IAggregationService
+	lateHeartbeatService   services.ILateHeartbeatService
+	projectActivityService services.IProjectActivityService
 	mailService            services.IMailService
 	keyValueService        services.IKeyValueService
 	reportService          services.IReportService
+	exportService          services.IExportService
+	settingsProfileService services.ISettingsProfileService
+	totpService            services.ITotpService
+	importSnapshotService  services.IImportSnapshotService
 	activityService        services.IActivityService
+	yearReviewService      services.IYearReviewService
 	diagnosticsService     services.IDiagnosticsService
 	housekeepingService    services.IHousekeepingService
 	miscService            services.IMiscService
+	webhookService         services.IWebhookService
+	orgService             services.IOrgService
+	rateLimitService       services.IRateLimitService
 )
 
 // TODO: Refactor entire project to be structured after business domains
@@ -113,12 +143,20 @@ var (
 func main() {
 	var versionFlag = flag.Bool("version", false, "print version")
 	var configFlag = flag.String("config", conf.DefaultConfigPath, "config file location")
+	var regenerateFlag = flag.Bool("regenerate-summaries", false, "recompute daily summaries between -from and -to (optionally only for -user) and exit")
+	var fromFlag = flag.String("from", "", "first day (e.g. 2024-01-01) to regenerate summaries for")
+	var toFlag = flag.String("to", time.Now().AddDate(0, 0, -1).Format(conf.SimpleDateFormat), "last day (e.g. 2024-01-31) to regenerate summaries for")
+	var userFlag = flag.String("user", "", "user to regenerate summaries for (all users if empty)")
 	flag.Parse()
 
 	if *versionFlag {
 		print(version)
 		os.Exit(0)
 	}
+	if flag.Arg(0) == "validate-config" {
+		flag.CommandLine.Parse(flag.Args()[1:]) // allow flags after the command as well
+		os.Exit(validateConfig(*configFlag, os.Stdout))
+	}
 	config = conf.Load(*configFlag, version)
 
 	// Configure Swagger docs
@@ -127,14 +165,14 @@ func main() {
 	slog.Info("Wakapi", "version", version)
 
 	// Set up GORM
-	gormLogger := logger.New(
+	gormLogger := conf.NewSlowQueryLogger(logger.New(
 		log.New(os.Stdout, "", log.LstdFlags),
 		logger.Config{
 			SlowThreshold: time.Minute,
 			Colorful:      false,
 			LogLevel:      logger.Silent,
 		},
-	)
+	), time.Duration(config.Db.SlowQueryThresholdMs)*time.Millisecond)
 
 	// Connect to database
 	var err error
@@ -155,6 +193,27 @@ func main() {
 	sqlDb.SetMaxOpenConns(int(config.Db.MaxConn))
 	defer sqlDb.Close()
 
+	// Connect to read replica, if configured
+	dbReplica := db
+	if config.Db.HasReplica() {
+		slog.Info("using read replica for read-heavy queries")
+		dbReplica, err = gorm.Open(config.Db.GetReplicaDialector(), &gorm.Config{Logger: gormLogger}, conf.GetWakapiDBOpts(&config.Db))
+		if err != nil {
+			conf.Log().Fatal("could not connect to read replica database", "error", err)
+		}
+
+		if config.IsDev() {
+			dbReplica = dbReplica.Debug()
+		}
+		sqlDbReplica, err := dbReplica.DB()
+		if err != nil {
+			conf.Log().Fatal("could not connect to read replica database", "error", err)
+		}
+		sqlDbReplica.SetMaxIdleConns(int(config.Db.MaxConn))
+		sqlDbReplica.SetMaxOpenConns(int(config.Db.MaxConn))
+		defer sqlDbReplica.Close()
+	}
+
 	// Migrate database schema
 	if !config.SkipMigrations {
 		migrations.Run(db, config)
@@ -162,43 +221,81 @@ func main() {
 
 	// Repositories
 	aliasRepository = repositories.NewAliasRepository(db)
-	heartbeatRepository = repositories.NewHeartbeatRepository(db)
+	heartbeatRepository = repositories.NewHeartbeatRepository(db).WithReadReplica(dbReplica)
 	userRepository = repositories.NewUserRepository(db)
 	languageMappingRepository = repositories.NewLanguageMappingRepository(db)
 	projectLabelRepository = repositories.NewProjectLabelRepository(db)
-	summaryRepository = repositories.NewSummaryRepository(db)
-	leaderboardRepository = repositories.NewLeaderboardRepository(db)
+	archivedProjectRepository = repositories.NewArchivedProjectRepository(db)
+	defaultBranchRepository = repositories.NewProjectDefaultBranchRepository(db)
+	projectMetadataRepository = repositories.NewProjectMetadataRepository(db)
+	componentRuleRepository = repositories.NewProjectComponentRuleRepository(db)
+	summaryRepository = repositories.NewSummaryRepository(db).WithReadReplica(dbReplica)
+	leaderboardRepository = repositories.NewLeaderboardRepository(db).WithReadReplica(dbReplica)
 	keyValueRepository = repositories.NewKeyValueRepository(db)
 	diagnosticsRepository = repositories.NewDiagnosticsRepository(db)
 	metricsRepository = repositories.NewMetricsRepository(db)
+	webhookRepository = repositories.NewWebhookRepository(db)
+	orgRepository = repositories.NewOrgRepository(db)
+	queuedMailRepository = repositories.NewQueuedMailRepository(db)
+	userSessionRepository = repositories.NewUserSessionRepository(db)
 
 	// Services
-	mailService = mail.NewMailService()
+	mailService = mail.NewMailService(queuedMailRepository)
 	aliasService = services.NewAliasService(aliasRepository)
-	userService = services.NewUserService(mailService, userRepository)
+	userService = services.NewUserService(mailService, userRepository, userSessionRepository)
 	languageMappingService = services.NewLanguageMappingService(languageMappingRepository)
 	projectLabelService = services.NewProjectLabelService(projectLabelRepository)
 	heartbeatService = services.NewHeartbeatService(heartbeatRepository, languageMappingService)
-	durationService = services.NewDurationService(heartbeatService)
+	projectArchiveService = services.NewProjectArchiveService(archivedProjectRepository, userService, heartbeatService)
+	defaultBranchService = services.NewProjectDefaultBranchService(defaultBranchRepository)
+	projectMetadataService = services.NewProjectMetadataService(projectMetadataRepository, aliasService)
+	componentService = services.NewProjectComponentService(componentRuleRepository)
+	duplicateService = services.NewProjectDuplicateService(heartbeatService, aliasService)
+	durationService = services.NewDurationService(heartbeatService, defaultBranchService)
+	entityService = services.NewEntityService(durationService)
 	summaryService = services.NewSummaryService(summaryRepository, heartbeatService, durationService, aliasService, projectLabelService)
 	aggregationService = services.NewAggregationService(userService, summaryService, heartbeatService)
+	aliasRecomputeService = services.NewAliasRecomputeService(aggregationService, summaryService)
+	lateHeartbeatService = services.NewLateHeartbeatService(userService, summaryService, aggregationService)
 	keyValueService = services.NewKeyValueService(keyValueRepository)
 	reportService = services.NewReportService(summaryService, userService, mailService)
-	activityService = services.NewActivityService(summaryService)
+	exportService = services.NewExportService(heartbeatService, summaryService, aliasService, projectLabelService, languageMappingService, defaultBranchService, projectArchiveService, keyValueService, mailService)
+	settingsProfileService = services.NewSettingsProfileService(userService, aliasService, languageMappingService, projectLabelService, defaultBranchService)
+	totpService = services.NewTotpService(userService)
+	importSnapshotService = services.NewImportSnapshotService(keyValueService, summaryService)
+	activityService = services.NewActivityService(summaryService, durationService)
+	yearReviewService = services.NewYearReviewService(summaryService)
 	diagnosticsService = services.NewDiagnosticsService(diagnosticsRepository)
 	housekeepingService = services.NewHousekeepingService(userService, heartbeatService, summaryService)
 	miscService = services.NewMiscService(userService, heartbeatService, summaryService, keyValueService, mailService)
+	webhookService = services.NewWebhookService(webhookRepository)
+	projectActivityService = services.NewProjectActivityService(userService, projectMetadataService, webhookService)
+	orgService = services.NewOrgService(orgRepository, userService, summaryService, keyValueService)
+	rateLimitService = services.NewRateLimitService()
 
 	if config.App.LeaderboardEnabled {
 		leaderboardService = services.NewLeaderboardService(leaderboardRepository, summaryService, userService)
 	}
 
+	if *regenerateFlag {
+		if err := regenerateSummaries(*fromFlag, *toFlag, *userFlag); err != nil {
+			conf.Log().Fatal("failed to regenerate summaries", "error", err)
+		}
+		os.Exit(0)
+	}
+
 	// Schedule background tasks
 	go conf.StartJobs()
 	go aggregationService.Schedule()
+	go lateHeartbeatService.Schedule()
 	go reportService.Schedule()
+	go exportService.Schedule()
 	go housekeepingService.Schedule()
 	go miscService.Schedule()
+	go projectArchiveService.Schedule()
+	go webhookService.Schedule()
+	go projectActivityService.Schedule()
+	go mailService.Schedule()
 
 	if config.App.LeaderboardEnabled {
 		go leaderboardService.Schedule()
@@ -208,33 +305,52 @@ func main() {
 
 	// API Handlers
 	healthApiHandler := api.NewHealthApiHandler(db)
-	heartbeatApiHandler := api.NewHeartbeatApiHandler(userService, heartbeatService, languageMappingService)
-	summaryApiHandler := api.NewSummaryApiHandler(userService, summaryService)
+	heartbeatApiHandler := api.NewHeartbeatApiHandler(userService, heartbeatService, languageMappingService, rateLimitService, projectMetadataService)
+	summaryApiHandler := api.NewSummaryApiHandler(userService, summaryService, heartbeatService, projectMetadataService, componentService, keyValueService)
+	compareApiHandler := api.NewCompareApiHandler(userService, summaryService, projectMetadataService)
+	dashboardApiHandler := api.NewDashboardApiHandler(userService, summaryService)
 	metricsHandler := api.NewMetricsHandler(userService, summaryService, heartbeatService, leaderboardService, keyValueService, metricsRepository)
 	diagnosticsHandler := api.NewDiagnosticsApiHandler(userService, diagnosticsService)
 	avatarHandler := api.NewAvatarHandler()
 	activityHandler := api.NewActivityApiHandler(userService, activityService)
-	badgeHandler := api.NewBadgeHandler(userService, summaryService)
+	yearReviewHandler := api.NewYearReviewApiHandler(userService, yearReviewService, projectMetadataService)
+	badgeHandler := api.NewBadgeHandler(userService, summaryService, projectMetadataService)
 	captchaHandler := api.NewCaptchaHandler()
+	userApiHandler := api.NewUserApiHandler(userService)
+	userMetricsHandler := api.NewUserMetricsHandler(userService, summaryService, heartbeatService)
+	settingsProfileHandler := api.NewSettingsProfileApiHandler(userService, settingsProfileService)
+	exportApiHandler := api.NewExportApiHandler(userService, exportService)
+	mailApiHandler := api.NewMailApiHandler(userService, mailService)
+	leaderboardApiHandler := api.NewLeaderboardApiHandler(userService, leaderboardService)
+	projectApiHandler := api.NewProjectApiHandler(userService, projectArchiveService, defaultBranchService, projectMetadataService, componentService, duplicateService)
+	webhookApiHandler := api.NewWebhookApiHandler(userService, webhookService)
+	aliasApiHandler := api.NewAliasApiHandler(userService, aliasService, aliasRecomputeService)
+	entityApiHandler := api.NewEntityApiHandler(userService, entityService)
+	durationApiHandler := api.NewDurationApiHandler(userService, durationService)
+	calendarApiHandler := api.NewCalendarApiHandler(userService, durationService)
+	importsApiHandler := api.NewImportsApiHandler(userService, importSnapshotService)
+	orgApiHandler := api.NewOrgApiHandler(userService, orgService, leaderboardService)
+	rateLimitApiHandler := api.NewRateLimitApiHandler(userService, rateLimitService)
+	publicStatsHandler := api.NewPublicStatsHandler(keyValueService, heartbeatService)
 
 	// Compat Handlers
 	wakatimeV1StatusBarHandler := wtV1Routes.NewStatusBarHandler(userService, summaryService)
 	wakatimeV1AllHandler := wtV1Routes.NewAllTimeHandler(userService, summaryService)
 	wakatimeV1SummariesHandler := wtV1Routes.NewSummariesHandler(userService, summaryService)
-	wakatimeV1StatsHandler := wtV1Routes.NewStatsHandler(userService, summaryService)
+	wakatimeV1StatsHandler := wtV1Routes.NewStatsHandler(userService, summaryService, projectMetadataService, keyValueService)
 	wakatimeV1UsersHandler := wtV1Routes.NewUsersHandler(userService, heartbeatService)
-	wakatimeV1ProjectsHandler := wtV1Routes.NewProjectsHandler(userService, heartbeatService)
+	wakatimeV1ProjectsHandler := wtV1Routes.NewProjectsHandler(userService, heartbeatService, projectArchiveService, projectMetadataService)
 	wakatimeV1HeartbeatsHandler := wtV1Routes.NewHeartbeatHandler(userService, heartbeatService)
 	wakatimeV1LeadersHandler := wtV1Routes.NewLeadersHandler(userService, leaderboardService)
-	shieldV1BadgeHandler := shieldsV1Routes.NewBadgeHandler(summaryService, userService)
+	shieldV1BadgeHandler := shieldsV1Routes.NewBadgeHandler(summaryService, userService, projectMetadataService)
 
 	// MVC Handlers
 	summaryHandler := routes.NewSummaryHandler(summaryService, userService, keyValueService)
-	settingsHandler := routes.NewSettingsHandler(userService, heartbeatService, summaryService, aliasService, aggregationService, languageMappingService, projectLabelService, keyValueService, mailService)
+	settingsHandler := routes.NewSettingsHandler(userService, heartbeatService, summaryService, aliasService, aggregationService, languageMappingService, projectLabelService, defaultBranchService, keyValueService, mailService, exportService, totpService, importSnapshotService, aliasRecomputeService)
 	subscriptionHandler := routes.NewSubscriptionHandler(userService, mailService, keyValueService)
-	projectsHandler := routes.NewProjectsHandler(userService, heartbeatService)
+	projectsHandler := routes.NewProjectsHandler(userService, heartbeatService, projectArchiveService)
 	homeHandler := routes.NewHomeHandler(userService, keyValueService)
-	loginHandler := routes.NewLoginHandler(userService, mailService, keyValueService)
+	loginHandler := routes.NewLoginHandler(userService, mailService, keyValueService, totpService)
 	imprintHandler := routes.NewImprintHandler(keyValueService)
 	leaderboardHandler := condition.TernaryOperator[bool, routes.Handler](config.App.LeaderboardEnabled, routes.NewLeaderboardHandler(userService, leaderboardService), routes.NewNoopHandler())
 
@@ -244,17 +360,22 @@ func main() {
 	// Setup Routing
 	router := chi.NewRouter()
 	router.Use(
+		middlewares.NewBasePathMiddleware(config.Server.BasePath), // must come first, as subsequent middlewares and routing act on the stripped path
 		middleware.CleanPath,
 		middleware.StripSlashes,
 		middleware.Recoverer,
+		middlewares.NewRequestIdMiddleware(),
 		middlewares.NewPrincipalMiddleware(),
 		middlewares.NewLoggingMiddleware(slog.Info, []string{
 			"/assets",
 			"/favicon",
 			"/service-worker.js",
 			"/api/health",
+			"/healthz",
+			"/readyz",
 			"/api/avatar",
-		}),
+		}, time.Duration(config.Server.SlowRequestThresholdMs)*time.Millisecond),
+		middlewares.NewIPFilterMiddleware(),
 	)
 	if config.Sentry.Dsn != "" {
 		router.Use(middlewares.NewSentryMiddleware())
@@ -265,12 +386,16 @@ func main() {
 	rootRouter.Use(middlewares.NewSecurityMiddleware())
 
 	apiRouter := chi.NewRouter()
+	if config.Server.CorsEnabled() {
+		apiRouter.Use(middlewares.NewCorsMiddleware())
+	}
 
 	// Hook sub routers
 	router.Mount("/", rootRouter)
 	router.Mount("/api", apiRouter)
 
 	// Route registrations
+	healthApiHandler.RegisterProbeRoutes(rootRouter)
 	homeHandler.RegisterRoutes(rootRouter)
 	loginHandler.RegisterRoutes(rootRouter)
 	imprintHandler.RegisterRoutes(rootRouter)
@@ -283,12 +408,15 @@ func main() {
 
 	// API route registrations
 	summaryApiHandler.RegisterRoutes(apiRouter)
+	compareApiHandler.RegisterRoutes(apiRouter)
+	dashboardApiHandler.RegisterRoutes(apiRouter)
 	healthApiHandler.RegisterRoutes(apiRouter)
 	heartbeatApiHandler.RegisterRoutes(apiRouter)
 	metricsHandler.RegisterRoutes(apiRouter)
 	diagnosticsHandler.RegisterRoutes(apiRouter)
 	avatarHandler.RegisterRoutes(apiRouter)
 	activityHandler.RegisterRoutes(apiRouter)
+	yearReviewHandler.RegisterRoutes(apiRouter)
 	badgeHandler.RegisterRoutes(apiRouter)
 	wakatimeV1StatusBarHandler.RegisterRoutes(apiRouter)
 	wakatimeV1AllHandler.RegisterRoutes(apiRouter)
@@ -300,6 +428,22 @@ func main() {
 	wakatimeV1LeadersHandler.RegisterRoutes(apiRouter)
 	shieldV1BadgeHandler.RegisterRoutes(apiRouter)
 	captchaHandler.RegisterRoutes(apiRouter)
+	userApiHandler.RegisterRoutes(apiRouter)
+	userMetricsHandler.RegisterRoutes(apiRouter)
+	settingsProfileHandler.RegisterRoutes(apiRouter)
+	exportApiHandler.RegisterRoutes(apiRouter)
+	mailApiHandler.RegisterRoutes(apiRouter)
+	leaderboardApiHandler.RegisterRoutes(apiRouter)
+	projectApiHandler.RegisterRoutes(apiRouter)
+	webhookApiHandler.RegisterRoutes(apiRouter)
+	aliasApiHandler.RegisterRoutes(apiRouter)
+	entityApiHandler.RegisterRoutes(apiRouter)
+	durationApiHandler.RegisterRoutes(apiRouter)
+	calendarApiHandler.RegisterRoutes(apiRouter)
+	importsApiHandler.RegisterRoutes(apiRouter)
+	orgApiHandler.RegisterRoutes(apiRouter)
+	rateLimitApiHandler.RegisterRoutes(apiRouter)
+	publicStatsHandler.RegisterRoutes(apiRouter)
 
 	// Static Routes
 	// https://github.com/golang/go/issues/43431
@@ -327,6 +471,26 @@ func main() {
 
 	// Listen HTTP
 	listen(router)
+
+	// let running background jobs finish, which might still produce heartbeats
+	slog.Info("waiting for running background jobs to finish", "timeout", config.Server.GetShutdownTimeout())
+	if conf.ShutdownQueues(config.Server.GetShutdownTimeout()) {
+		slog.Info("all background jobs finished")
+	}
+
+	// retry pending mails once more, remaining ones are retried upon next start
+	slog.Info("flushing outbound mail queue")
+	if err := mailService.FlushQueue(); err != nil {
+		conf.Log().Error("failed to flush mail queue on shutdown", "error", err)
+	}
+
+	// persist heartbeats still held in memory (see heartbeat_buffer_sec)
+	slog.Info("flushing heartbeat buffer")
+	if err := heartbeatService.Flush(); err != nil {
+		conf.Log().Error("failed to flush heartbeat buffer on shutdown", "error", err)
+	}
+
+	slog.Info("shutdown complete")
 }
 
 func listen(handler http.Handler) {
@@ -374,7 +538,7 @@ func listen(handler http.Handler) {
 		if s4 != nil {
 			slog.Info("👉 Listening for HTTPS... ✅", "address", s4.Addr)
 			go func() {
-				if err := s4.ListenAndServeTLS(config.Server.TlsCertPath, config.Server.TlsKeyPath); err != nil {
+				if err := s4.ListenAndServeTLS(config.Server.TlsCertPath, config.Server.TlsKeyPath); err != nil && !errors.Is(err, http.ErrServerClosed) {
 					conf.Log().Fatal(err.Error())
 				}
 			}()
@@ -382,7 +546,7 @@ func listen(handler http.Handler) {
 		if s6 != nil {
 			slog.Info("👉 Listening for HTTPS... ✅", "address", s6.Addr)
 			go func() {
-				if err := s6.ListenAndServeTLS(config.Server.TlsCertPath, config.Server.TlsKeyPath); err != nil {
+				if err := s6.ListenAndServeTLS(config.Server.TlsCertPath, config.Server.TlsKeyPath); err != nil && !errors.Is(err, http.ErrServerClosed) {
 					conf.Log().Fatal(err.Error())
 				}
 			}()
@@ -397,7 +561,7 @@ func listen(handler http.Handler) {
 				if err := os.Chmod(config.Server.ListenSocket, os.FileMode(config.Server.ListenSocketMode)); err != nil {
 					slog.Warn("failed to set user permissions for unix socket", "error", err)
 				}
-				if err := sSocket.ServeTLS(unixListener, config.Server.TlsCertPath, config.Server.TlsKeyPath); err != nil {
+				if err := sSocket.ServeTLS(unixListener, config.Server.TlsCertPath, config.Server.TlsKeyPath); err != nil && !errors.Is(err, http.ErrServerClosed) {
 					conf.Log().Fatal(err.Error())
 				}
 			}()
@@ -406,7 +570,7 @@ func listen(handler http.Handler) {
 		if s4 != nil {
 			slog.Info("👉 Listening for HTTP... ✅", "address", s4.Addr)
 			go func() {
-				if err := s4.ListenAndServe(); err != nil {
+				if err := s4.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 					conf.Log().Fatal(err.Error())
 				}
 			}()
@@ -414,7 +578,7 @@ func listen(handler http.Handler) {
 		if s6 != nil {
 			slog.Info("👉 Listening for HTTP... ✅", "address", s6.Addr)
 			go func() {
-				if err := s6.ListenAndServe(); err != nil {
+				if err := s6.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 					conf.Log().Fatal(err.Error())
 				}
 			}()
@@ -429,12 +593,51 @@ func listen(handler http.Handler) {
 				if err := os.Chmod(config.Server.ListenSocket, os.FileMode(config.Server.ListenSocketMode)); err != nil {
 					slog.Warn("failed to set user permissions for unix socket", "error", err)
 				}
-				if err := sSocket.Serve(unixListener); err != nil {
+				if err := sSocket.Serve(unixListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 					conf.Log().Fatal(err.Error())
 				}
 			}()
 		}
 	}
 
-	<-make(chan interface{}, 1)
+	// wait for termination signal, then let pending requests finish
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+	slog.Info("received termination signal, shutting down", "signal", sig.String())
+	conf.SetShuttingDown(true)
+
+	go func() {
+		<-sigs
+		slog.Warn("received second termination signal, exiting immediately")
+		os.Exit(1)
+	}()
+
+	// keep serving while reporting as not ready, so that load balancers (e.g. kubernetes services) can stop routing traffic here first
+	if delay := config.Server.GetShutdownDelay(); delay > 0 {
+		slog.Info("reporting as not ready before closing listeners", "delay", delay)
+		time.Sleep(delay)
+	}
+
+	slog.Info("stopped accepting new connections, draining in-flight requests", "timeout", config.Server.GetShutdownTimeout())
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Server.GetShutdownTimeout())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, s := range []*http.Server{s4, s6, sSocket} {
+		if s == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				slog.Warn("failed to shut down server gracefully", "error", err)
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	slog.Info("all listeners closed")
 }
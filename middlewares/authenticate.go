@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	conf "github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/models"
@@ -21,9 +22,17 @@ const (
 )
 
 var (
-	errEmptyKey = fmt.Errorf("the api_key is empty")
+	errEmptyKey       = fmt.Errorf("the api_key is empty")
+	errAccountDeleted = fmt.Errorf("the account is pending deletion")
+	errSessionExpired = fmt.Errorf("the session is expired")
 )
 
+// paths never to be accessed while impersonating another user, even if read-only, in addition to any non-read requests
+var impersonationForbiddenPaths = []string{"/settings", "/subscription", "/api/users", "/api/admin"}
+
+// paths to be accessible while impersonating another user, even though not read-only
+var impersonationPermittedPaths = []string{"/logout"}
+
 type AuthenticateMiddleware struct {
 	config               *conf.Config
 	userSrvc             services.IUserService
@@ -31,6 +40,7 @@ type AuthenticateMiddleware struct {
 	optionalForMethods   []string
 	redirectTarget       string // optional
 	redirectErrorMessage string // optional
+	autoProvisioning     bool   // whether to create users for unknown api keys, if enabled and permitted by config
 }
 
 func NewAuthenticateMiddleware(userService services.IUserService) *AuthenticateMiddleware {
@@ -62,6 +72,12 @@ func (m *AuthenticateMiddleware) WithRedirectErrorMessage(message string) *Authe
 	return m
 }
 
+// WithAutoProvisioning lets unknown api keys create a new user instead of being rejected, as long as security.unknown_api_keys is set to provision, signup is allowed and the client is allowlisted
+func (m *AuthenticateMiddleware) WithAutoProvisioning() *AuthenticateMiddleware {
+	m.autoProvisioning = true
+	return m
+}
+
 func (m *AuthenticateMiddleware) Handler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		m.ServeHTTP(w, r, h.ServeHTTP)
@@ -70,9 +86,19 @@ func (m *AuthenticateMiddleware) Handler(h http.Handler) http.Handler {
 
 func (m *AuthenticateMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	var user *models.User
+	var impersonation *models.Impersonation
 
-	user, err := m.tryGetUserByCookie(r)
-	if err != nil {
+	user, session, err := m.tryGetUserByCookie(r)
+	if err == nil {
+		if m.config.Security.SessionIdleTimeoutSec > 0 && session.NeedsRefresh() {
+			m.refreshSession(w, r, session)
+		}
+		user, impersonation = m.tryImpersonate(r, user)
+	} else {
+		if errors.Is(err, errSessionExpired) {
+			conf.Log().Request(r).Info("logging out expired session", "userID", session.UserID)
+			http.SetCookie(w, m.config.GetClearCookie(models.AuthCookieKey))
+		}
 		user, err = m.tryGetUserByApiKeyHeader(r)
 	}
 	if err != nil {
@@ -81,6 +107,13 @@ func (m *AuthenticateMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Reques
 	if err != nil && m.config.Security.TrustedHeaderAuth {
 		user, err = m.tryGetUserByTrustedHeader(r)
 	}
+	if err != nil && m.autoProvisioning && m.config.Security.IsProvisioningEnabled() {
+		user, err = m.tryProvisionUserByApiKeyHeader(r)
+	}
+	if err == nil && user != nil && user.IsSoftDeleted() {
+		// accounts pending deletion must neither log in nor send data
+		user, err = nil, errAccountDeleted
+	}
 
 	if err != nil || user == nil {
 		if m.isOptional(r) {
@@ -103,10 +136,34 @@ func (m *AuthenticateMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if impersonation != nil {
+		if !isPermittedWhileImpersonating(r) {
+			conf.Log().Request(r).Warn("rejected impersonated request", "adminID", impersonation.AdminID, "userID", user.ID, "method", r.Method, "path", r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("not permitted while impersonating another user"))
+			return
+		}
+		conf.Log().Request(r).Info("serving impersonated request", "adminID", impersonation.AdminID, "userID", user.ID, "method", r.Method, "path", r.URL.Path)
+	}
+
 	SetPrincipal(r, user)
 	next(w, r)
 }
 
+// tryImpersonate returns the user impersonated by the given admin, if any, or the admin themselves otherwise
+func (m *AuthenticateMiddleware) tryImpersonate(r *http.Request, admin *models.User) (*models.User, *models.Impersonation) {
+	impersonation, err := helpers.ExtractImpersonation(r, m.config)
+	if err != nil || !admin.IsAdmin || impersonation.AdminID != admin.ID || impersonation.IsExpired() {
+		return admin, nil
+	}
+
+	user, err := m.userSrvc.GetUserById(impersonation.UserID)
+	if err != nil || user.IsAdmin {
+		return admin, nil
+	}
+	return user.AsImpersonatedBy(admin), impersonation
+}
+
 func (m *AuthenticateMiddleware) isOptional(r *http.Request) bool {
 	for _, p := range m.optionalForPaths {
 		if strings.HasPrefix(r.URL.Path, p) || r.URL.Path == p {
@@ -121,6 +178,30 @@ func (m *AuthenticateMiddleware) isOptional(r *http.Request) bool {
 	return false
 }
 
+// isRemoteAddrIn tells whether the request's immediate peer address is part of any of the given ranges
+func isRemoteAddrIn(r *http.Request, ipNets []net.IPNet) bool {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return slice.ContainBy[net.IPNet](ipNets, func(ipNet net.IPNet) bool {
+		return ipNet.Contains(addr.IP)
+	})
+}
+
+// isPermittedWhileImpersonating tells whether the request is read-only and must not reveal the impersonated user's settings or billing
+func isPermittedWhileImpersonating(r *http.Request) bool {
+	if slice.Contain(impersonationPermittedPaths, r.URL.Path) {
+		return true
+	}
+	for _, p := range impersonationForbiddenPaths {
+		if strings.HasPrefix(r.URL.Path, p) {
+			return false
+		}
+	}
+	return r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+}
+
 func (m *AuthenticateMiddleware) tryGetUserByApiKeyHeader(r *http.Request) (*models.User, error) {
 	key, err := utils.ExtractBearerAuth(r)
 	if err != nil {
@@ -159,28 +240,75 @@ func (m *AuthenticateMiddleware) tryGetUserByTrustedHeader(r *http.Request) (*mo
 	if remoteUser == "" {
 		return nil, errors.New("trusted header field empty")
 	}
-	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err != nil || !slice.ContainBy[net.IPNet](m.config.Security.TrustReverseProxyIPs(), func(ipNet net.IPNet) bool {
-		return ipNet.Contains(addr.IP) // if err != nil, addr is nil
-	}) {
+	if !isRemoteAddrIn(r, m.config.Security.TrustReverseProxyIPs()) {
 		return nil, errors.New("reverse proxy not trusted")
 	}
 
 	return m.userSrvc.GetUserById(remoteUser)
 }
 
-func (m *AuthenticateMiddleware) tryGetUserByCookie(r *http.Request) (*models.User, error) {
-	username, err := helpers.ExtractCookieAuth(r, m.config)
+// tryProvisionUserByApiKeyHeader creates a new user for the api key in the authorization header, if any, after it was found to not belong to any existing user
+func (m *AuthenticateMiddleware) tryProvisionUserByApiKeyHeader(r *http.Request) (*models.User, error) {
+	key, err := utils.ExtractBearerAuth(r)
 	if err != nil {
 		return nil, err
 	}
+	if !isRemoteAddrIn(r, m.config.Security.ProvisionAllowedIPs()) {
+		conf.Log().Request(r).Warn("rejected unknown api key from client not allowed for auto-provisioning", "remoteAddr", r.RemoteAddr)
+		return nil, errors.New("client not allowed for auto-provisioning")
+	}
 
-	user, err := m.userSrvc.GetUserById(*username)
+	user, err := m.userSrvc.ProvisionByApiKey(strings.TrimSpace(key))
 	if err != nil {
+		conf.Log().Request(r).Warn("failed to auto-provision user for unknown api key", "remoteAddr", r.RemoteAddr, "error", err)
 		return nil, err
 	}
 
+	conf.Log().Request(r).Info("auto-provisioned user for unknown api key", "userID", user.ID, "remoteAddr", r.RemoteAddr)
+	return user, nil
+}
+
+func (m *AuthenticateMiddleware) tryGetUserByCookie(r *http.Request) (*models.User, *models.Session, error) {
+	session, err := helpers.ExtractCookieAuth(r, m.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := m.userSrvc.GetUserById(session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// no need to check password here, as securecookie decoding will fail anyway,
 	// if cookie is not properly signed
 
-	return user, nil
+	if session.IsExpired(m.config.Security.GetSessionMaxAge(), m.config.Security.GetSessionIdleTimeout()) || session.IsRevoked(user) {
+		return nil, session, errSessionExpired
+	}
+
+	// looked up on every request, so that revoked sessions are rejected right away on all instances
+	if session.ID != "" {
+		persisted, err := m.userSrvc.GetSession(session.ID)
+		if err != nil || persisted.UserID != user.ID {
+			return nil, session, errSessionExpired
+		}
+		if persisted.NeedsRefresh() {
+			if err := m.userSrvc.TouchSession(persisted); err != nil {
+				conf.Log().Request(r).Warn("failed to update session activity", "userID", user.ID, "error", err)
+			}
+		}
+	}
+
+	return user, session, nil
+}
+
+// refreshSession re-issues the auth cookie with the session's last activity updated, which the idle timeout is relative to
+func (m *AuthenticateMiddleware) refreshSession(w http.ResponseWriter, r *http.Request, session *models.Session) {
+	session.LastSeenAt = time.Now()
+	encoded, err := m.config.Security.SecureCookie.Encode(models.AuthCookieKey, session)
+	if err != nil {
+		conf.Log().Request(r).Error("failed to encode secure cookie", "error", err)
+		return
+	}
+	http.SetCookie(w, m.config.CreateCookie(models.AuthCookieKey, encoded))
 }
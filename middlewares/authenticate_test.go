@@ -2,11 +2,15 @@ package middlewares
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"github.com/gorilla/securecookie"
 	"github.com/muety/wakapi/config"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/muety/wakapi/mocks"
 	"github.com/muety/wakapi/models"
@@ -185,4 +189,226 @@ func TestAuthenticateMiddleware_tryGetUserByTrustedHeader_Success(t *testing.T)
 	}
 }
 
+func TestAuthenticateMiddleware_ServeHTTP_AutoProvisioning(t *testing.T) {
+	testApiKey := "b9d9f6f0-3b5a-4d3e-9f5e-2c1a7e4d8b6f"
+	testUser := &models.User{ID: "user-b9d9f6f03b5a", ApiKey: testApiKey}
+
+	cfg := config.Empty()
+	cfg.Security.AllowSignup = true
+	cfg.Security.UnknownApiKeys = config.UnknownApiKeysProvision
+	cfg.Security.ProvisionAllowedIps = "192.168.178.0/24"
+	cfg.Security.ParseProvisionAllowedIPs()
+	config.Set(cfg)
+
+	serve := func(sut *AuthenticateMiddleware, remoteAddr string) (int, *models.User) {
+		var principal *models.User
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/heartbeat", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(testApiKey))))
+		req.RemoteAddr = remoteAddr
+		NewPrincipalMiddleware()(sut.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal = GetPrincipal(r)
+		}))).ServeHTTP(rec, req)
+		return rec.Code, principal
+	}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserByKey", testApiKey).Return((*models.User)(nil), errors.New("record not found"))
+	userServiceMock.On("ProvisionByApiKey", testApiKey).Return(testUser, nil)
+
+	// only for middlewares explicitly opting in
+	code, _ := serve(NewAuthenticateMiddleware(userServiceMock), "192.168.178.35:54654")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	userServiceMock.AssertNotCalled(t, "ProvisionByApiKey", testApiKey)
+
+	// only for allowlisted clients
+	code, _ = serve(NewAuthenticateMiddleware(userServiceMock).WithAutoProvisioning(), "10.0.0.1:54654")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	userServiceMock.AssertNotCalled(t, "ProvisionByApiKey", testApiKey)
+
+	code, principal := serve(NewAuthenticateMiddleware(userServiceMock).WithAutoProvisioning(), "192.168.178.35:54654")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, testUser, principal)
+	userServiceMock.AssertNumberOfCalls(t, "ProvisionByApiKey", 1)
+
+	// only while signup is open
+	cfg.Security.AllowSignup = false
+	code, _ = serve(NewAuthenticateMiddleware(userServiceMock).WithAutoProvisioning(), "192.168.178.35:54654")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	userServiceMock.AssertNumberOfCalls(t, "ProvisionByApiKey", 1)
+}
+
+func TestAuthenticateMiddleware_ServeHTTP_SessionLifetime(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.SecureCookie = securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	cfg.Security.SessionMaxAgeSec = 86400
+	cfg.Security.SessionIdleTimeoutSec = 3600
+	config.Set(cfg)
+
+	testApiKey := "z5uig69cn9ut93n"
+	testUser := &models.User{ID: "user01", ApiKey: testApiKey}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", testUser.ID).Return(testUser, nil)
+	userServiceMock.On("GetUserByKey", testApiKey).Return(testUser, nil)
+
+	sut := NewAuthenticateMiddleware(userServiceMock)
+
+	serve := func(session *models.Session, apiKey string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/summary", nil)
+		if session != nil {
+			encoded, _ := cfg.Security.SecureCookie.Encode(models.AuthCookieKey, session)
+			req.AddCookie(&http.Cookie{Name: models.AuthCookieKey, Value: encoded})
+		}
+		if apiKey != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", base64.StdEncoding.EncodeToString([]byte(apiKey))))
+		}
+		NewPrincipalMiddleware()(sut.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))).ServeHTTP(rec, req)
+		return rec
+	}
+	sessionCookie := func(rec *httptest.ResponseRecorder) *http.Cookie {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == models.AuthCookieKey {
+				return c
+			}
+		}
+		return nil
+	}
+
+	rec := serve(models.NewSession(testUser), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, sessionCookie(rec)) // recently active, no need to refresh
+
+	// last activity gets refreshed
+	inactive := models.NewSession(testUser)
+	inactive.LastSeenAt = time.Now().Add(-10 * time.Minute)
+	rec = serve(inactive, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var refreshed models.Session
+	assert.Nil(t, cfg.Security.SecureCookie.Decode(models.AuthCookieKey, sessionCookie(rec).Value, &refreshed))
+	assert.WithinDuration(t, time.Now(), refreshed.LastSeenAt, time.Second)
+	assert.Equal(t, inactive.IssuedAt.Unix(), refreshed.IssuedAt.Unix())
+
+	// idle, too old or revoked
+	idle := models.NewSession(testUser)
+	idle.LastSeenAt = time.Now().Add(-2 * time.Hour)
+	old := models.NewSession(testUser)
+	old.IssuedAt = time.Now().Add(-25 * time.Hour)
+	revokedAt := models.CustomTime(time.Now())
+	revoked := models.NewSession(testUser)
+	revoked.IssuedAt = revokedAt.T().Add(-1 * time.Minute)
+
+	testUser.SessionsRevokedAt = &revokedAt
+	for _, session := range []*models.Session{idle, old, revoked} {
+		rec = serve(session, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, -1, sessionCookie(rec).MaxAge) // cleared
+	}
+
+	// api keys are not affected
+	rec = serve(old, testApiKey)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAuthenticateMiddleware_tryImpersonate(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.SecureCookie = securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	config.Set(cfg)
+
+	admin := &models.User{ID: "admin01", IsAdmin: true}
+	otherAdmin := &models.User{ID: "admin02", IsAdmin: true}
+	testUser := &models.User{ID: "user01", ApiKey: "z5uig69cn9ut93n"}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", testUser.ID).Return(testUser, nil)
+	userServiceMock.On("GetUserById", otherAdmin.ID).Return(otherAdmin, nil)
+
+	sut := NewAuthenticateMiddleware(userServiceMock)
+
+	newRequest := func(impersonation *models.Impersonation) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/summary", nil)
+		encoded, _ := cfg.Security.SecureCookie.Encode(models.ImpersonationCookieKey, impersonation)
+		r.AddCookie(&http.Cookie{Name: models.ImpersonationCookieKey, Value: encoded})
+		return r
+	}
+
+	result, impersonation := sut.tryImpersonate(newRequest(models.NewImpersonation(admin, testUser)), admin)
+	assert.NotNil(t, impersonation)
+	assert.Equal(t, testUser.ID, result.ID)
+	assert.Equal(t, admin.ID, result.ImpersonatedBy)
+	assert.Empty(t, result.ApiKey)
+	assert.NotEmpty(t, testUser.ApiKey) // original left untouched
+
+	expired := models.NewImpersonation(admin, testUser)
+	expired.ExpiresAt = time.Now().Add(-1 * time.Minute)
+
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/summary", nil), // not impersonating
+		newRequest(expired), // expired
+		newRequest(models.NewImpersonation(otherAdmin, testUser)), // issued to another admin
+		newRequest(models.NewImpersonation(admin, otherAdmin)),    // admins cannot be impersonated
+	} {
+		result, impersonation := sut.tryImpersonate(r, admin)
+		assert.Nil(t, impersonation)
+		assert.Equal(t, admin, result)
+	}
+
+	result, impersonation = sut.tryImpersonate(newRequest(models.NewImpersonation(admin, testUser)), &models.User{ID: admin.ID}) // no longer admin
+	assert.Nil(t, impersonation)
+	assert.False(t, result.IsImpersonated())
+}
+
+func TestAuthenticateMiddleware_isPermittedWhileImpersonating(t *testing.T) {
+	assert.True(t, isPermittedWhileImpersonating(httptest.NewRequest(http.MethodGet, "/summary", nil)))
+	assert.True(t, isPermittedWhileImpersonating(httptest.NewRequest(http.MethodGet, "/api/summary", nil)))
+	assert.True(t, isPermittedWhileImpersonating(httptest.NewRequest(http.MethodPost, "/logout", nil)))
+	assert.False(t, isPermittedWhileImpersonating(httptest.NewRequest(http.MethodPost, "/api/heartbeat", nil)))
+	assert.False(t, isPermittedWhileImpersonating(httptest.NewRequest(http.MethodDelete, "/api/summary/cache", nil)))
+	assert.False(t, isPermittedWhileImpersonating(httptest.NewRequest(http.MethodGet, "/settings", nil)))
+	assert.False(t, isPermittedWhileImpersonating(httptest.NewRequest(http.MethodGet, "/subscription/success", nil)))
+	assert.False(t, isPermittedWhileImpersonating(httptest.NewRequest(http.MethodPost, "/api/users/user01/impersonation", nil)))
+}
+
 // TODO: somehow test cookie auth function
+
+func TestAuthenticateMiddleware_ServeHTTP_PersistedSession(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.SecureCookie = securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	config.Set(cfg)
+
+	revokedAt := models.CustomTime(time.Now())
+	testUser := &models.User{ID: "user01", SessionsRevokedAt: &revokedAt}
+
+	active := &models.UserSession{ID: "session01", UserID: testUser.ID, LastSeenAt: models.CustomTime(time.Now().Add(-10 * time.Minute))}
+	foreign := &models.UserSession{ID: "session02", UserID: "user02", LastSeenAt: models.CustomTime(time.Now())}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", testUser.ID).Return(testUser, nil)
+	userServiceMock.On("GetSession", active.ID).Return(active, nil)
+	userServiceMock.On("GetSession", foreign.ID).Return(foreign, nil)
+	userServiceMock.On("GetSession", "session03").Return((*models.UserSession)(nil), errors.New("record not found"))
+	userServiceMock.On("TouchSession", active).Return(nil)
+
+	sut := NewAuthenticateMiddleware(userServiceMock)
+
+	serve := func(sessionId string) *httptest.ResponseRecorder {
+		session := models.NewSession(testUser)
+		session.ID = sessionId
+		session.IssuedAt = revokedAt.T().Add(-1 * time.Minute) // persisted sessions are not subject to revoking all at once
+		encoded, _ := cfg.Security.SecureCookie.Encode(models.AuthCookieKey, session)
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/summary", nil)
+		req.AddCookie(&http.Cookie{Name: models.AuthCookieKey, Value: encoded})
+		NewPrincipalMiddleware()(sut.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))).ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve(active.ID).Code)
+	userServiceMock.AssertCalled(t, "TouchSession", active)
+
+	// revoked or belonging to someone else
+	assert.Equal(t, http.StatusUnauthorized, serve("session03").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(foreign.ID).Code)
+}
@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BasePathMiddleware strips the configured base path (e.g. "/wakapi") from request paths, so that Wakapi can be served under a sub-path
+// no matter whether the reverse proxy in front of it removes the prefix itself or passes requests on unmodified.
+type BasePathMiddleware struct {
+	handler  http.Handler
+	basePath string
+}
+
+func NewBasePathMiddleware(basePath string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return &BasePathMiddleware{handler: h, basePath: strings.TrimSuffix(basePath, "/")}
+	}
+}
+
+func (m *BasePathMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.basePath == "" || (r.URL.Path != m.basePath && !strings.HasPrefix(r.URL.Path, m.basePath+"/")) {
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, m.basePath), "/")
+	if r.URL.RawPath != "" {
+		r2.URL.RawPath = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.RawPath, m.basePath), "/")
+	}
+	m.handler.ServeHTTP(w, r2)
+}
@@ -0,0 +1,63 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasePathMiddleware(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(NewBasePathMiddleware("/wakapi/"), middleware.CleanPath, middleware.StripSlashes)
+
+	rootRouter, apiRouter := chi.NewRouter(), chi.NewRouter()
+	router.Mount("/", rootRouter)
+	router.Mount("/api", apiRouter)
+
+	respondPath := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(r.URL.Path)) }
+	rootRouter.Get("/", respondPath)
+	rootRouter.Get("/summary", respondPath)
+	apiRouter.Get("/summary", respondPath)
+	apiRouter.Get("/compat/wakatime/v1/users/{user}/stats", respondPath)
+	router.Get("/assets/*", respondPath)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantPath   string
+	}{
+		{"/wakapi", http.StatusOK, "/"},
+		{"/wakapi/", http.StatusOK, "/"},
+		{"/wakapi/summary", http.StatusOK, "/summary"},
+		{"/wakapi/api/summary", http.StatusOK, "/api/summary"},
+		{"/wakapi/api/compat/wakatime/v1/users/current/stats", http.StatusOK, "/api/compat/wakatime/v1/users/current/stats"},
+		{"/wakapi/assets/css/app.css", http.StatusOK, "/assets/css/app.css"},
+		{"/api/summary", http.StatusOK, "/api/summary"}, // prefix already stripped by reverse proxy
+		{"/wakapifoo/summary", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantPath, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestBasePathMiddleware_NoBasePath(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(NewBasePathMiddleware(""))
+	router.Get("/wakapi/summary", func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/wakapi/summary", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,20 @@
+package middlewares
+
+import (
+	"net/http"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/rs/cors"
+)
+
+// NewCorsMiddleware returns a handler to add CORS headers to responses and to answer preflight requests according to the server's cors_* settings.
+// Preflight requests are answered before authentication, as browsers never send credentials (like the api key header) with them.
+func NewCorsMiddleware() func(http.Handler) http.Handler {
+	cfg := conf.Get()
+	return cors.New(cors.Options{
+		AllowedOrigins:   cfg.Server.GetCorsAllowedOrigins(),
+		AllowedMethods:   cfg.Server.GetCorsAllowedMethods(),
+		AllowedHeaders:   cfg.Server.GetCorsAllowedHeaders(),
+		AllowCredentials: cfg.Server.CorsAllowCredentials,
+	}).Handler
+}
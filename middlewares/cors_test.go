@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorsMiddleware_Preflight(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Server.CorsAllowedOrigins = "https://dash.example.org"
+	cfg.Server.CorsAllowedMethods = "GET,POST"
+	cfg.Server.CorsAllowedHeaders = "Authorization"
+	config.Set(cfg)
+
+	var called bool
+	sut := NewCorsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	// allowed origin
+	req := httptest.NewRequest(http.MethodOptions, "/api/summary", nil)
+	req.Header.Set("Origin", "https://dash.example.org")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "authorization") // browsers send lowercase header names
+	rec := httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+
+	assert.False(t, called)
+	assert.Equal(t, "https://dash.example.org", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), "authorization")
+
+	// disallowed origin
+	req = httptest.NewRequest(http.MethodOptions, "/api/summary", nil)
+	req.Header.Set("Origin", "https://evil.example.org")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	rec = httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// actual request
+	req = httptest.NewRequest(http.MethodGet, "/api/summary", nil)
+	req.Header.Set("Origin", "https://dash.example.org")
+	rec = httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+
+	assert.True(t, called)
+	assert.Equal(t, "https://dash.example.org", rec.Header().Get("Access-Control-Allow-Origin"))
+}
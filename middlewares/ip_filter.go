@@ -0,0 +1,130 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/duke-git/lancet/v2/slice"
+	conf "github.com/muety/wakapi/config"
+)
+
+// ipRestrictedRoute matches requests either by path prefix or, if a method is given, by method and path pattern (see path.Match), and optionally only if the given condition holds as well
+type ipRestrictedRoute struct {
+	group   string
+	method  string
+	pattern string
+	when    func(r *http.Request) bool
+}
+
+var ipRestrictedRoutes = []ipRestrictedRoute{
+	{group: conf.IPRestrictedRoutesAdmin, pattern: "/api/admin"},
+	{group: conf.IPRestrictedRoutesAdmin, method: http.MethodPost, pattern: "/api/users/*/impersonation"},
+	{group: conf.IPRestrictedRoutesAdmin, method: http.MethodPost, pattern: "/api/users/*/restore"},
+	{group: conf.IPRestrictedRoutesAdmin, method: http.MethodPost, pattern: "/api/users/*/api_key/rotate", when: func(r *http.Request) bool {
+		return requestPath(r) != "/api/users/current/api_key/rotate" // other than the own one, only admins may rotate
+	}},
+	{group: conf.IPRestrictedRoutesAdmin, method: http.MethodDelete, pattern: "/api/summary/cache", when: func(r *http.Request) bool {
+		return r.URL.Query().Get("all") == "true" // flushing all users' caches is reserved to admins
+	}},
+	{group: conf.IPRestrictedRoutesAdmin, pattern: "/api/orgs"},
+	{group: conf.IPRestrictedRoutesMetrics, pattern: "/api/metrics"},
+}
+
+func (route ipRestrictedRoute) matches(r *http.Request) bool {
+	p := requestPath(r)
+	if route.method == "" {
+		return (p == route.pattern || strings.HasPrefix(p, route.pattern+"/")) && (route.when == nil || route.when(r))
+	}
+	matched, _ := path.Match(route.pattern, p)
+	return matched && r.Method == route.method && (route.when == nil || route.when(r))
+}
+
+// requestPath returns the cleaned, escaped request path, i.e. the same one chi routes by, so that a route can't be reached by a path that slips through the filter
+func requestPath(r *http.Request) string {
+	return path.Clean("/" + r.URL.EscapedPath())
+}
+
+// IPFilterMiddleware limits access to the route groups listed in ip_restricted_routes to clients matching the ip_allowlist (if any) and not matching the ip_denylist.
+// Has to be applied before routing, as paths are matched against the request url.
+type IPFilterMiddleware struct {
+	config  *conf.Config
+	handler http.Handler
+}
+
+func NewIPFilterMiddleware() func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return &IPFilterMiddleware{config: conf.Get(), handler: h}
+	}
+}
+
+func (m *IPFilterMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range ipRestrictedRoutes {
+		if !m.config.Security.IsIPRestricted(route.group) || !route.matches(r) {
+			continue
+		}
+		if ip := clientIP(r, m.config.Security.TrustReverseProxyIPs()); !isIPAllowed(ip, m.config.Security.IPAllowlist(), m.config.Security.IPDenylist()) {
+			conf.Log().Request(r).Warn("denied access to ip-restricted route", "group", route.group, "ip", ip, "remoteAddr", r.RemoteAddr)
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(conf.ErrForbidden))
+			return
+		}
+		break
+	}
+	m.handler.ServeHTTP(w, r)
+}
+
+// ClientIP returns the request's originating ip (see clientIP) as a string, empty if it can't be determined
+func ClientIP(r *http.Request) string {
+	if ip := clientIP(r, conf.Get().Security.TrustReverseProxyIPs()); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// clientIP returns the request's originating ip, or nil if it can't be determined (e.g. when listening on a unix socket).
+// X-Forwarded-For is only considered for requests received from a trusted reverse proxy, in which case the right-most address not belonging to a trusted proxy is used,
+// as all addresses left of it could have been spoofed by the client.
+func clientIP(r *http.Request, trustedProxies []net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isIPIn(ip, trustedProxies) {
+		return ip
+	}
+
+	forwarded := make([]string, 0)
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		forwardedIp := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if forwardedIp == nil {
+			break // malformed, so don't trust anything left of it either
+		}
+		ip = forwardedIp
+		if !isIPIn(ip, trustedProxies) {
+			break
+		}
+	}
+	return ip
+}
+
+func isIPAllowed(ip net.IP, allowlist, denylist []net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	if isIPIn(ip, denylist) {
+		return false
+	}
+	return len(allowlist) == 0 || isIPIn(ip, allowlist)
+}
+
+func isIPIn(ip net.IP, ipNets []net.IPNet) bool {
+	return slice.ContainBy[net.IPNet](ipNets, func(ipNet net.IPNet) bool {
+		return ipNet.Contains(ip)
+	})
+}
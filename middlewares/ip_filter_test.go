@@ -0,0 +1,141 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPFilterMiddleware_ServeHTTP(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.IpAllowlist = "192.168.0.0/24, 2001:db8::/32"
+	cfg.Security.IpDenylist = "192.168.0.66, 2001:db8:1::/48"
+	cfg.Security.IpRestrictedRoutes = "admin,metrics"
+	cfg.Security.ParseIPAccessLists()
+	config.Set(cfg)
+
+	sut := NewIPFilterMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		remoteAddr string
+		want       int
+	}{
+		{"ipv4 in allowlist", http.MethodGet, "/api/admin/mail/queue", "192.168.0.10:51234", http.StatusOK},
+		{"ipv4 not in allowlist", http.MethodGet, "/api/admin/mail/queue", "10.0.0.1:51234", http.StatusForbidden},
+		{"ipv4 in denylist", http.MethodGet, "/api/metrics", "192.168.0.66:51234", http.StatusForbidden},
+		{"ipv6 in allowlist", http.MethodGet, "/api/metrics", "[2001:db8::1]:51234", http.StatusOK},
+		{"ipv6 not in allowlist", http.MethodGet, "/api/metrics", "[2001:db9::1]:51234", http.StatusForbidden},
+		{"ipv6 in denylist", http.MethodGet, "/api/admin", "[2001:db8:1::1]:51234", http.StatusForbidden},
+		{"ipv4-mapped ipv6 in allowlist", http.MethodGet, "/api/metrics", "[::ffff:192.168.0.10]:51234", http.StatusOK},
+		{"unknown address", http.MethodGet, "/api/metrics", "@", http.StatusForbidden},
+		{"unrestricted route", http.MethodGet, "/api/summary", "10.0.0.1:51234", http.StatusOK},
+		{"unrestricted route with common prefix", http.MethodGet, "/api/administrators", "10.0.0.1:51234", http.StatusOK},
+		{"unclean path", http.MethodGet, "/api/summary/../admin//mail/queue/", "10.0.0.1:51234", http.StatusForbidden},
+		{"impersonation", http.MethodPost, "/api/users/john/impersonation", "10.0.0.1:51234", http.StatusForbidden},
+		{"impersonation in allowlist", http.MethodPost, "/api/users/john/impersonation", "192.168.0.10:51234", http.StatusOK},
+		{"restore", http.MethodPost, "/api/users/john/restore/", "10.0.0.1:51234", http.StatusForbidden},
+		{"restore with escaped user", http.MethodPost, "/api/users/jo%2Fhn/restore", "10.0.0.1:51234", http.StatusForbidden},
+		{"org creation", http.MethodPost, "/api/orgs", "10.0.0.1:51234", http.StatusForbidden},
+		{"org creation in allowlist", http.MethodPost, "/api/orgs", "192.168.0.10:51234", http.StatusOK},
+		{"org listing", http.MethodGet, "/api/orgs", "10.0.0.1:51234", http.StatusForbidden},
+		{"org invite", http.MethodPost, "/api/orgs/acme/invites", "10.0.0.1:51234", http.StatusForbidden},
+		{"org member removal", http.MethodDelete, "/api/orgs/acme/members/john", "10.0.0.1:51234", http.StatusForbidden},
+		{"org report", http.MethodGet, "/api/orgs/acme/report", "10.0.0.1:51234", http.StatusForbidden},
+		{"api key rotation of other user", http.MethodPost, "/api/users/john/api_key/rotate", "10.0.0.1:51234", http.StatusForbidden},
+		{"api key rotation of other user in allowlist", http.MethodPost, "/api/users/john/api_key/rotate", "192.168.0.10:51234", http.StatusOK},
+		{"api key rotation of current user", http.MethodPost, "/api/users/current/api_key/rotate", "10.0.0.1:51234", http.StatusOK},
+		{"flushing all summary caches", http.MethodDelete, "/api/summary/cache?all=true", "10.0.0.1:51234", http.StatusForbidden},
+		{"flushing own summary cache", http.MethodDelete, "/api/summary/cache", "10.0.0.1:51234", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+			sut.ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestIPFilterMiddleware_ServeHTTP_RestrictedRoutes(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.IpAllowlist = "127.0.0.1"
+	cfg.Security.IpRestrictedRoutes = "metrics"
+	cfg.Security.ParseIPAccessLists()
+	config.Set(cfg)
+
+	sut := NewIPFilterMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/mail/queue", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	sut.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/api/metrics", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	sut.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestIPFilterMiddleware_ServeHTTP_NoRestriction(t *testing.T) {
+	config.Set(config.Empty())
+
+	sut := NewIPFilterMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/mail/queue", nil)
+	r.RemoteAddr = "10.0.0.1:51234"
+	sut.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestClientIP(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.TrustReverseProxyIps = "172.17.0.1, 10.0.0.0/8"
+	cfg.Security.ParseTrustReverseProxyIPs()
+	trustedProxies := cfg.Security.TrustReverseProxyIPs()
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor []string
+		want          string
+	}{
+		{"no proxy", "192.168.0.10:51234", nil, "192.168.0.10"},
+		{"untrusted proxy", "192.168.0.10:51234", []string{"1.2.3.4"}, "192.168.0.10"},
+		{"trusted proxy", "172.17.0.1:51234", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"trusted proxy without header", "172.17.0.1:51234", nil, "172.17.0.1"},
+		{"spoofed header", "172.17.0.1:51234", []string{"127.0.0.1, 1.2.3.4"}, "1.2.3.4"},
+		{"chained trusted proxies", "172.17.0.1:51234", []string{"1.2.3.4, 10.0.0.5"}, "1.2.3.4"},
+		{"multiple headers", "172.17.0.1:51234", []string{"127.0.0.1", "1.2.3.4, 10.0.0.5"}, "1.2.3.4"},
+		{"ipv6 client", "172.17.0.1:51234", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"malformed header", "172.17.0.1:51234", []string{"1.2.3.4, unknown"}, "172.17.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/metrics", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, h := range tt.xForwardedFor {
+				r.Header.Add("X-Forwarded-For", h)
+			}
+			assert.Equal(t, tt.want, clientIP(r, trustedProxies).String())
+		})
+	}
+}
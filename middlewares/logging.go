@@ -4,6 +4,9 @@ package middlewares
 // Alternatively, we could use https://github.com/samber/slog-chi, however, it pulls in another bunch of dependencies and log messages are more verbose and feel almost little bloated
 
 import (
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	conf "github.com/muety/wakapi/config"
 	"io"
 	"net/http"
 	"strings"
@@ -16,14 +19,17 @@ type LoggingMiddleware struct {
 	handler         http.Handler
 	logFunc         logFunc
 	excludePrefixes []string
+	slowThreshold   time.Duration
 }
 
-func NewLoggingMiddleware(logFunc logFunc, excludePrefixes []string) func(http.Handler) http.Handler {
+// NewLoggingMiddleware logs every request not matching any of the excluded path prefixes using logFunc and, if slowThreshold is positive, additionally warns about requests taking longer than that
+func NewLoggingMiddleware(logFunc logFunc, excludePrefixes []string, slowThreshold time.Duration) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return &LoggingMiddleware{
 			handler:         h,
 			logFunc:         logFunc,
 			excludePrefixes: excludePrefixes,
+			slowThreshold:   slowThreshold,
 		}
 	}
 }
@@ -51,7 +57,26 @@ func (lg *LoggingMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"bytes", ww.BytesWritten(),
 		"addr", readUserIP(r),
 		"user", readUserID(r),
+		"request_id", middleware.GetReqID(r.Context()),
 	)
+	if lg.slowThreshold > 0 && duration > lg.slowThreshold {
+		conf.Log().Request(r).Warn("slow request",
+			"route", readRoutePattern(r),
+			"status", ww.Status(),
+			"duration", duration,
+			"user", readUserID(r),
+		)
+	}
+}
+
+// readRoutePattern returns the pattern of the route that handled the request (e.g. /api/summary or /api/compat/wakatime/v1/users/{user}/stats/{range}), or the plain path if not available
+func readRoutePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return r.URL.Path
 }
 
 func readUserIP(r *http.Request) string {
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/muety/wakapi/services"
+)
+
+// RateLimitMiddleware rejects requests of users who exhausted their request budget with '429 too many requests'. Must be placed after the AuthenticateMiddleware, as requests without principal are never limited.
+type RateLimitMiddleware struct {
+	rateLimitSrvc services.IRateLimitService
+	handler       http.Handler
+}
+
+func NewRateLimitMiddleware(rateLimitService services.IRateLimitService) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return &RateLimitMiddleware{rateLimitSrvc: rateLimitService, handler: h}
+	}
+}
+
+func (m *RateLimitMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user := GetPrincipal(r); user != nil && !m.rateLimitSrvc.Consume(w, r, user) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("429 too many requests"))
+		return
+	}
+	m.handler.ServeHTTP(w, r)
+}
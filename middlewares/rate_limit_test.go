@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitMiddleware_ServeHTTP(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.HeartbeatsMaxRate = "1/1h"
+	config.Set(cfg)
+
+	user := &models.User{ID: "AdminUser"}
+	sut := NewRateLimitMiddleware(services.NewRateLimitService())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	handler := NewPrincipalMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test-Auth") != "" {
+			SetPrincipal(r, user)
+		}
+		sut.ServeHTTP(w, r)
+	}))
+
+	request := func(authenticated bool) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/heartbeat", nil)
+		if authenticated {
+			req.Header.Set("X-Test-Auth", "1")
+		}
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("when within budget", func(t *testing.T) {
+		rec := request(true)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	})
+
+	t.Run("when budget exhausted", func(t *testing.T) {
+		rec := request(true)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("when unauthenticated", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, request(false).Code)
+	})
+}
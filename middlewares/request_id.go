@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gofrs/uuid/v5"
+)
+
+const HeaderRequestId = "X-Request-ID"
+
+var requestIdRegex = regexp.MustCompile(`^[\w\-.:/+=]{1,128}$`)
+
+// RequestIdMiddleware assigns an id to every request, or takes the one passed by the client or a reverse proxy, and stores it to the request context,
+// where it is picked up by chi's middleware.GetReqID() and therefore by config.Log().Request(). The id is sent back as a response header and, to allow
+// users to reference it in bug reports, also appended to plain text error responses. Only api responses are assumed to be plain text when no content type is set,
+// as that's how api handlers write their errors, while web pages might be rendered without setting any.
+type RequestIdMiddleware struct {
+	handler http.Handler
+}
+
+func NewRequestIdMiddleware() func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return &RequestIdMiddleware{h}
+	}
+}
+
+func (m *RequestIdMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(HeaderRequestId)
+	if !requestIdRegex.MatchString(requestId) {
+		requestId = uuid.Must(uuid.NewV4()).String()
+	}
+
+	w.Header().Set(HeaderRequestId, requestId)
+	ww := wrapWriter(w)
+	m.handler.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, requestId)))
+
+	if ww.Status() >= http.StatusBadRequest && isPlainTextResponse(ww, strings.HasPrefix(r.URL.Path, "/api/")) {
+		fmt.Fprintf(ww, "\nrequest id: %s\n", requestId)
+	}
+}
+
+func GetRequestId(r *http.Request) string {
+	return middleware.GetReqID(r.Context())
+}
+
+func isPlainTextResponse(w http.ResponseWriter, defaultPlain bool) bool {
+	if w.Header().Get("Content-Length") != "" || w.Header().Get("Content-Encoding") != "" {
+		return false // can't append anything without breaking the response
+	}
+	contentType := w.Header().Get("Content-Type")
+	if contentType == "" {
+		return defaultPlain
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/plain"
+}
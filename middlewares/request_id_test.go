@@ -0,0 +1,91 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIdMiddleware_Propagate(t *testing.T) {
+	var seenId string
+	sut := NewRequestIdMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenId = middleware.GetReqID(r.Context())
+	}))
+
+	// incoming id is honored
+	req := httptest.NewRequest(http.MethodGet, "/api/summary", nil)
+	req.Header.Set(HeaderRequestId, "proxy-1234")
+	rec := httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+
+	assert.Equal(t, "proxy-1234", seenId)
+	assert.Equal(t, "proxy-1234", rec.Header().Get(HeaderRequestId))
+
+	// invalid incoming id is replaced
+	req = httptest.NewRequest(http.MethodGet, "/api/summary", nil)
+	req.Header.Set(HeaderRequestId, "<script>"+strings.Repeat("a", 200))
+	rec = httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+
+	assert.Len(t, seenId, 36)
+	assert.Equal(t, seenId, rec.Header().Get(HeaderRequestId))
+}
+
+func TestRequestIdMiddleware_ErrorBody(t *testing.T) {
+	sut := NewRequestIdMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/plain":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("bad request"))
+		case "/plain":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("bad request"))
+		case "/page":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<html><body>not found</body></html>"))
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"bad request"}`))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/plain", nil)
+	req.Header.Set(HeaderRequestId, "abc")
+	rec := httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+	assert.Equal(t, "bad request\nrequest id: abc\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/plain", nil)
+	req.Header.Set(HeaderRequestId, "abc")
+	rec = httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+	assert.Equal(t, "bad request\nrequest id: abc\n", rec.Body.String())
+
+	// web pages without content type are left untouched
+	req = httptest.NewRequest(http.MethodGet, "/page", nil)
+	req.Header.Set(HeaderRequestId, "abc")
+	rec = httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+	assert.Equal(t, "<html><body>not found</body></html>", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/json", nil)
+	req.Header.Set(HeaderRequestId, "abc")
+	rec = httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+	assert.Equal(t, `{"error":"bad request"}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/ok", nil)
+	req.Header.Set(HeaderRequestId, "abc")
+	rec = httptest.NewRecorder()
+	sut.ServeHTTP(rec, req)
+	assert.Equal(t, "ok", rec.Body.String())
+	assert.Equal(t, "abc", rec.Header().Get(HeaderRequestId))
+}
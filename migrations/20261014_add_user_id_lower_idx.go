@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"gorm.io/gorm"
+)
+
+// enforce user names to be unique case-insensitively on database level, in addition to the check performed at signup
+// mysql and mssql compare case-insensitively by default already, so only postgres and sqlite need an index on the lower-cased name
+// if older databases already contain colliding users (e.g. "Bob" and "bob"), the index is not created and the migration is retried on every start, until an admin resolved the collisions
+func init() {
+	const name = "20261014-add_user_id_lower_idx"
+	f := migrationFunc{
+		name: name,
+		f: func(db *gorm.DB, cfg *config.Config) error {
+			if !cfg.Db.IsPostgres() && !cfg.Db.IsSQLite() {
+				return nil
+			}
+			if hasRun(name, db) {
+				return nil
+			}
+
+			var collisions []string
+			if err := db.
+				Model(&models.User{}).
+				Select("lower(id)").
+				Group("lower(id)").
+				Having("count(*) > 1").
+				Scan(&collisions).Error; err != nil {
+				return err
+			}
+
+			if len(collisions) > 0 {
+				slog.Warn("found users whose names only differ by case, please rename (foreign keys cascade on update) or delete all but one of each of them in the database to have unique user names enforced", "names", strings.Join(collisions, ", "))
+				return nil
+			}
+
+			if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_user_id_lower ON users (lower(id))").Error; err != nil {
+				return err
+			}
+
+			setHasRun(name, db)
+			return nil
+		},
+	}
+
+	registerPostMigration(f)
+}
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"sort"
 	"strings"
+	"sync/atomic"
 )
 
 type gormMigrationFunc func(db *gorm.DB) error
@@ -21,6 +22,7 @@ type migrationFuncs []migrationFunc
 var (
 	preMigrations  migrationFuncs
 	postMigrations migrationFuncs
+	completed      atomic.Bool
 )
 
 func GetMigrationFunc(cfg *config.Config) gormMigrationFunc {
@@ -30,6 +32,12 @@ func GetMigrationFunc(cfg *config.Config) gormMigrationFunc {
 			if err := db.AutoMigrate(&models.User{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
 				return err
 			}
+			if err := db.AutoMigrate(&models.Org{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
+				return err
+			}
+			if err := db.AutoMigrate(&models.UserSession{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
+				return err
+			}
 			if err := db.AutoMigrate(&models.KeyStringValue{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
 				return err
 			}
@@ -51,6 +59,27 @@ func GetMigrationFunc(cfg *config.Config) gormMigrationFunc {
 			if err := db.AutoMigrate(&models.ProjectLabel{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
 				return err
 			}
+			if err := db.AutoMigrate(&models.ArchivedProject{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
+				return err
+			}
+			if err := db.AutoMigrate(&models.ProjectDefaultBranch{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
+				return err
+			}
+			if err := db.AutoMigrate(&models.ProjectMetadata{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
+				return err
+			}
+			if err := db.AutoMigrate(&models.ProjectComponentRule{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
+				return err
+			}
+			if err := db.AutoMigrate(&models.Webhook{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
+				return err
+			}
+			if err := db.AutoMigrate(&models.WebhookDelivery{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
+				return err
+			}
+			if err := db.AutoMigrate(&models.QueuedMail{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
+				return err
+			}
 			if err := db.AutoMigrate(&models.Diagnostics{}); err != nil && !cfg.Db.AutoMigrateFailSilently {
 				return err
 			}
@@ -74,6 +103,12 @@ func Run(db *gorm.DB, cfg *config.Config) {
 	RunPreMigrations(db, cfg)
 	RunSchemaMigrations(db, cfg)
 	RunPostMigrations(db, cfg)
+	completed.Store(true)
+}
+
+// Applied tells whether all migrations have run in this process (or were skipped deliberately)
+func Applied(cfg *config.Config) bool {
+	return cfg.SkipMigrations || completed.Load()
 }
 
 func RunSchemaMigrations(db *gorm.DB, cfg *config.Config) {
@@ -0,0 +1,27 @@
+package mocks
+
+import (
+	"time"
+
+	datastructure "github.com/duke-git/lancet/v2/datastructure/set"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type AggregationServiceMock struct {
+	mock.Mock
+}
+
+func (m *AggregationServiceMock) Schedule() {
+	m.Called()
+}
+
+func (m *AggregationServiceMock) AggregateSummaries(s datastructure.Set[string]) error {
+	args := m.Called(s)
+	return args.Error(0)
+}
+
+func (m *AggregationServiceMock) RegenerateSummaries(u *models.User, t time.Time, t2 time.Time, f func(int, int)) (int, error) {
+	args := m.Called(u, t, t2, f)
+	return args.Int(0), args.Error(1)
+}
@@ -53,3 +53,13 @@ func (m *AliasServiceMock) DeleteMulti(a []*models.Alias) error {
 	args := m.Called(a)
 	return args.Error(0)
 }
+
+func (m *AliasServiceMock) ApplyRules(s string, a []*models.Alias) (*models.AliasRulesResult, error) {
+	args := m.Called(s, a)
+	return args.Get(0).(*models.AliasRulesResult), args.Error(1)
+}
+
+func (m *AliasServiceMock) ReplaceRules(s string, a []*models.Alias) (*models.AliasRulesResult, error) {
+	args := m.Called(s, a)
+	return args.Get(0).(*models.AliasRulesResult), args.Error(1)
+}
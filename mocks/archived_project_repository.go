@@ -0,0 +1,20 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type ArchivedProjectRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *ArchivedProjectRepositoryMock) GetByUser(s string) ([]*models.ArchivedProject, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.ArchivedProject), args.Error(1)
+}
+
+func (m *ArchivedProjectRepositoryMock) Upsert(p *models.ArchivedProject) (*models.ArchivedProject, error) {
+	args := m.Called(p)
+	return args.Get(0).(*models.ArchivedProject), args.Error(1)
+}
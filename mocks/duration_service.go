@@ -14,3 +14,8 @@ func (m *DurationServiceMock) Get(time time.Time, time2 time.Time, user *models.
 	args := m.Called(time, time2, user, f)
 	return args.Get(0).(models.Durations), args.Error(1)
 }
+
+func (m *DurationServiceMock) GetWithEntities(time time.Time, time2 time.Time, user *models.User, f *models.Filters) (models.Durations, error) {
+	args := m.Called(time, time2, user, f)
+	return args.Get(0).(models.Durations), args.Error(1)
+}
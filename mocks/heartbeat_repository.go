@@ -0,0 +1,122 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type HeartbeatRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *HeartbeatRepositoryMock) InsertBatch(heartbeats []*models.Heartbeat) error {
+	args := m.Called(heartbeats)
+	return args.Error(0)
+}
+
+func (m *HeartbeatRepositoryMock) InsertBatchCounted(heartbeats []*models.Heartbeat) (int64, error) {
+	args := m.Called(heartbeats)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetAll() ([]*models.Heartbeat, error) {
+	args := m.Called()
+	return args.Get(0).([]*models.Heartbeat), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetAllWithin(t time.Time, t2 time.Time, u *models.User) ([]*models.Heartbeat, error) {
+	args := m.Called(t, t2, u)
+	return args.Get(0).([]*models.Heartbeat), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetAllWithinPaginated(t time.Time, t2 time.Time, u *models.User, c *models.HeartbeatCursor, i int) ([]*models.Heartbeat, error) {
+	args := m.Called(t, t2, u, c, i)
+	return args.Get(0).([]*models.Heartbeat), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetAllWithinByEntityPaginated(t time.Time, t2 time.Time, u *models.User, e string, c *models.HeartbeatCursor, i int) ([]*models.Heartbeat, error) {
+	args := m.Called(t, t2, u, e, c, i)
+	return args.Get(0).([]*models.Heartbeat), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetAllWithinByFilters(t time.Time, t2 time.Time, u *models.User, f map[string][]string) ([]*models.Heartbeat, error) {
+	args := m.Called(t, t2, u, f)
+	return args.Get(0).([]*models.Heartbeat), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetLatestByFilters(u *models.User, f map[string][]string) (*models.Heartbeat, error) {
+	args := m.Called(u, f)
+	return args.Get(0).(*models.Heartbeat), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetFirstByUsers() ([]*models.TimeByUser, error) {
+	args := m.Called()
+	return args.Get(0).([]*models.TimeByUser), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetLastByUsers() ([]*models.TimeByUser, error) {
+	args := m.Called()
+	return args.Get(0).([]*models.TimeByUser), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetLatestByUser(u *models.User) (*models.Heartbeat, error) {
+	args := m.Called(u)
+	return args.Get(0).(*models.Heartbeat), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetLatestByOriginAndUser(s string, u *models.User) (*models.Heartbeat, error) {
+	args := m.Called(s, u)
+	return args.Get(0).(*models.Heartbeat), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) Count(b bool) (int64, error) {
+	args := m.Called(b)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) CountByUser(u *models.User) (int64, error) {
+	args := m.Called(u)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) CountByUsers(u []*models.User) ([]*models.CountByUser, error) {
+	args := m.Called(u)
+	return args.Get(0).([]*models.CountByUser), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetEntitySetByUser(t uint8, s string) ([]string, error) {
+	args := m.Called(t, s)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetExistingHashes(s []string) ([]string, error) {
+	args := m.Called(s)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) DeleteBefore(t time.Time) error {
+	args := m.Called(t)
+	return args.Error(0)
+}
+
+func (m *HeartbeatRepositoryMock) DeleteByUser(u *models.User) error {
+	args := m.Called(u)
+	return args.Error(0)
+}
+
+func (m *HeartbeatRepositoryMock) DeleteByUserBefore(u *models.User, t time.Time) error {
+	args := m.Called(u, t)
+	return args.Error(0)
+}
+
+func (m *HeartbeatRepositoryMock) GetUserProjectStats(u *models.User, t time.Time, t2 time.Time, i int, i2 int) ([]*models.ProjectStats, error) {
+	args := m.Called(u, t, t2, i, i2)
+	return args.Get(0).([]*models.ProjectStats), args.Error(1)
+}
+
+func (m *HeartbeatRepositoryMock) GetLatestReceivedWithin(t time.Time, t2 time.Time, u *models.User) (*models.Heartbeat, error) {
+	args := m.Called(t, t2, u)
+	return args.Get(0).(*models.Heartbeat), args.Error(1)
+}
@@ -21,6 +21,16 @@ func (m *HeartbeatServiceMock) InsertBatch(h []*models.Heartbeat) error {
 	return args.Error(0)
 }
 
+func (m *HeartbeatServiceMock) InsertImported(h []*models.Heartbeat) (int, error) {
+	args := m.Called(h)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *HeartbeatServiceMock) Flush() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *HeartbeatServiceMock) Count(a bool) (int64, error) {
 	args := m.Called(a)
 	return int64(args.Int(0)), args.Error(1)
@@ -28,12 +38,17 @@ func (m *HeartbeatServiceMock) Count(a bool) (int64, error) {
 
 func (m *HeartbeatServiceMock) CountByUser(user *models.User) (int64, error) {
 	args := m.Called(user)
-	return args.Get(0).(int64), args.Error(0)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *HeartbeatServiceMock) CheckQuota(user *models.User) error {
+	args := m.Called(user)
+	return args.Error(0)
 }
 
 func (m *HeartbeatServiceMock) CountByUsers(users []*models.User) ([]*models.CountByUser, error) {
 	args := m.Called(users)
-	return args.Get(0).([]*models.CountByUser), args.Error(0)
+	return args.Get(0).([]*models.CountByUser), args.Error(1)
 }
 
 func (m *HeartbeatServiceMock) GetAllWithin(time time.Time, time2 time.Time, user *models.User) ([]*models.Heartbeat, error) {
@@ -41,6 +56,16 @@ func (m *HeartbeatServiceMock) GetAllWithin(time time.Time, time2 time.Time, use
 	return args.Get(0).([]*models.Heartbeat), args.Error(1)
 }
 
+func (m *HeartbeatServiceMock) GetAllWithinPaginated(time time.Time, time2 time.Time, user *models.User, cursor *models.HeartbeatCursor, limit int) ([]*models.Heartbeat, error) {
+	args := m.Called(time, time2, user, cursor, limit)
+	return args.Get(0).([]*models.Heartbeat), args.Error(1)
+}
+
+func (m *HeartbeatServiceMock) GetAllWithinByEntityPaginated(time time.Time, time2 time.Time, user *models.User, entity string, cursor *models.HeartbeatCursor, limit int) ([]*models.Heartbeat, error) {
+	args := m.Called(time, time2, user, entity, cursor, limit)
+	return args.Get(0).([]*models.Heartbeat), args.Error(1)
+}
+
 func (m *HeartbeatServiceMock) GetAllWithinByFilters(time time.Time, time2 time.Time, user *models.User, filters *models.Filters) ([]*models.Heartbeat, error) {
 	args := m.Called(time, time2, user, filters)
 	return args.Get(0).([]*models.Heartbeat), args.Error(1)
@@ -71,6 +96,11 @@ func (m *HeartbeatServiceMock) GetEntitySetByUser(u uint8, user string) ([]strin
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (m *HeartbeatServiceMock) GetExistingHashes(s []string) ([]string, error) {
+	args := m.Called(s)
+	return args.Get(0).([]string), args.Error(1)
+}
+
 func (m *HeartbeatServiceMock) DeleteBefore(time time.Time) error {
 	args := m.Called(time)
 	return args.Error(0)
@@ -90,3 +120,8 @@ func (m *HeartbeatServiceMock) GetUserProjectStats(u *models.User, t, t2 time.Ti
 	args := m.Called(u, t, t2, p, b)
 	return args.Get(0).([]*models.ProjectStats), args.Error(1)
 }
+
+func (m *HeartbeatServiceMock) GetLatestReceivedWithin(t time.Time, t2 time.Time, u *models.User) (*models.Heartbeat, error) {
+	args := m.Called(t, t2, u)
+	return args.Get(0).(*models.Heartbeat), args.Error(1)
+}
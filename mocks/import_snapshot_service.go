@@ -0,0 +1,35 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type ImportSnapshotServiceMock struct {
+	mock.Mock
+}
+
+func (m *ImportSnapshotServiceMock) Capture(user *models.User) (*models.ImportSnapshot, error) {
+	args := m.Called(user)
+	return args.Get(0).(*models.ImportSnapshot), args.Error(1)
+}
+
+func (m *ImportSnapshotServiceMock) Complete(user *models.User, snapshot *models.ImportSnapshot) (*models.ImportDiff, error) {
+	args := m.Called(user, snapshot)
+	return args.Get(0).(*models.ImportDiff), args.Error(1)
+}
+
+func (m *ImportSnapshotServiceMock) GetById(user *models.User, id string) (*models.ImportSnapshot, error) {
+	args := m.Called(user, id)
+	return args.Get(0).(*models.ImportSnapshot), args.Error(1)
+}
+
+func (m *ImportSnapshotServiceMock) GetLatest(user *models.User) (*models.ImportSnapshot, error) {
+	args := m.Called(user)
+	return args.Get(0).(*models.ImportSnapshot), args.Error(1)
+}
+
+func (m *ImportSnapshotServiceMock) GetByUser(user *models.User) ([]*models.ImportSnapshot, error) {
+	args := m.Called(user)
+	return args.Get(0).([]*models.ImportSnapshot), args.Error(1)
+}
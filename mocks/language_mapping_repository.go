@@ -0,0 +1,35 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type LanguageMappingRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *LanguageMappingRepositoryMock) GetAll() ([]*models.LanguageMapping, error) {
+	args := m.Called()
+	return args.Get(0).([]*models.LanguageMapping), args.Error(1)
+}
+
+func (m *LanguageMappingRepositoryMock) GetById(u uint) (*models.LanguageMapping, error) {
+	args := m.Called(u)
+	return args.Get(0).(*models.LanguageMapping), args.Error(1)
+}
+
+func (m *LanguageMappingRepositoryMock) GetByUser(s string) ([]*models.LanguageMapping, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.LanguageMapping), args.Error(1)
+}
+
+func (m *LanguageMappingRepositoryMock) Insert(l *models.LanguageMapping) (*models.LanguageMapping, error) {
+	args := m.Called(l)
+	return args.Get(0).(*models.LanguageMapping), args.Error(1)
+}
+
+func (m *LanguageMappingRepositoryMock) Delete(u uint) error {
+	args := m.Called(u)
+	return args.Error(0)
+}
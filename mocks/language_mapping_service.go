@@ -0,0 +1,40 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type LanguageMappingServiceMock struct {
+	mock.Mock
+}
+
+func (m *LanguageMappingServiceMock) GetById(u uint) (*models.LanguageMapping, error) {
+	args := m.Called(u)
+	return args.Get(0).(*models.LanguageMapping), args.Error(1)
+}
+
+func (m *LanguageMappingServiceMock) GetByUser(s string) ([]*models.LanguageMapping, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.LanguageMapping), args.Error(1)
+}
+
+func (m *LanguageMappingServiceMock) ResolveByUser(s string) (map[string]string, error) {
+	args := m.Called(s)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+func (m *LanguageMappingServiceMock) ResolveDetectionByUser(s string) (map[string]string, error) {
+	args := m.Called(s)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+func (m *LanguageMappingServiceMock) Create(l *models.LanguageMapping) (*models.LanguageMapping, error) {
+	args := m.Called(l)
+	return args.Get(0).(*models.LanguageMapping), args.Error(1)
+}
+
+func (m *LanguageMappingServiceMock) Delete(l *models.LanguageMapping) error {
+	args := m.Called(l)
+	return args.Error(0)
+}
@@ -0,0 +1,25 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type OrgRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *OrgRepositoryMock) GetAll() ([]*models.Org, error) {
+	args := m.Called()
+	return args.Get(0).([]*models.Org), args.Error(1)
+}
+
+func (m *OrgRepositoryMock) GetById(id string) (*models.Org, error) {
+	args := m.Called(id)
+	return args.Get(0).(*models.Org), args.Error(1)
+}
+
+func (m *OrgRepositoryMock) Insert(org *models.Org) (*models.Org, error) {
+	args := m.Called(org)
+	return args.Get(0).(*models.Org), args.Error(1)
+}
@@ -0,0 +1,39 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type ProjectArchiveServiceMock struct {
+	mock.Mock
+}
+
+func (m *ProjectArchiveServiceMock) Schedule() {
+	m.Called()
+}
+
+func (m *ProjectArchiveServiceMock) GetArchived(s string) (map[string]bool, error) {
+	args := m.Called(s)
+	return args.Get(0).(map[string]bool), args.Error(1)
+}
+
+func (m *ProjectArchiveServiceMock) Archive(u *models.User, s string) error {
+	args := m.Called(u, s)
+	return args.Error(0)
+}
+
+func (m *ProjectArchiveServiceMock) Unarchive(u *models.User, s string) error {
+	args := m.Called(u, s)
+	return args.Error(0)
+}
+
+func (m *ProjectArchiveServiceMock) FilterProjectStats(u *models.User, p []*models.ProjectStats) ([]*models.ProjectStats, error) {
+	args := m.Called(u, p)
+	return args.Get(0).([]*models.ProjectStats), args.Error(1)
+}
+
+func (m *ProjectArchiveServiceMock) AutoArchive(u *models.User) (int, error) {
+	args := m.Called(u)
+	return args.Int(0), args.Error(1)
+}
@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type ProjectComponentRuleRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *ProjectComponentRuleRepositoryMock) GetById(u uint) (*models.ProjectComponentRule, error) {
+	args := m.Called(u)
+	return args.Get(0).(*models.ProjectComponentRule), args.Error(1)
+}
+
+func (m *ProjectComponentRuleRepositoryMock) GetByUser(s string) ([]*models.ProjectComponentRule, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.ProjectComponentRule), args.Error(1)
+}
+
+func (m *ProjectComponentRuleRepositoryMock) Insert(r *models.ProjectComponentRule) (*models.ProjectComponentRule, error) {
+	args := m.Called(r)
+	return args.Get(0).(*models.ProjectComponentRule), args.Error(1)
+}
+
+func (m *ProjectComponentRuleRepositoryMock) Delete(u uint) error {
+	args := m.Called(u)
+	return args.Error(0)
+}
@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type ProjectComponentServiceMock struct {
+	mock.Mock
+}
+
+func (m *ProjectComponentServiceMock) GetByUser(s string) ([]*models.ProjectComponentRule, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.ProjectComponentRule), args.Error(1)
+}
+
+func (m *ProjectComponentServiceMock) GetByUserAndProject(s1, s2 string) ([]*models.ProjectComponentRule, error) {
+	args := m.Called(s1, s2)
+	return args.Get(0).([]*models.ProjectComponentRule), args.Error(1)
+}
+
+func (m *ProjectComponentServiceMock) Create(r *models.ProjectComponentRule) (*models.ProjectComponentRule, error) {
+	args := m.Called(r)
+	return args.Get(0).(*models.ProjectComponentRule), args.Error(1)
+}
+
+func (m *ProjectComponentServiceMock) Delete(u *models.User, id uint) error {
+	args := m.Called(u, id)
+	return args.Error(0)
+}
@@ -0,0 +1,25 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type ProjectDefaultBranchRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *ProjectDefaultBranchRepositoryMock) GetByUser(s string) ([]*models.ProjectDefaultBranch, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.ProjectDefaultBranch), args.Error(1)
+}
+
+func (m *ProjectDefaultBranchRepositoryMock) Upsert(b *models.ProjectDefaultBranch) (*models.ProjectDefaultBranch, error) {
+	args := m.Called(b)
+	return args.Get(0).(*models.ProjectDefaultBranch), args.Error(1)
+}
+
+func (m *ProjectDefaultBranchRepositoryMock) Delete(s1, s2 string) error {
+	args := m.Called(s1, s2)
+	return args.Error(0)
+}
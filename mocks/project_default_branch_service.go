@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type ProjectDefaultBranchServiceMock struct {
+	mock.Mock
+}
+
+func (m *ProjectDefaultBranchServiceMock) GetByUser(s string) ([]*models.ProjectDefaultBranch, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.ProjectDefaultBranch), args.Error(1)
+}
+
+func (m *ProjectDefaultBranchServiceMock) GetMapped(s string) (map[string]string, error) {
+	args := m.Called(s)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+func (m *ProjectDefaultBranchServiceMock) Set(u *models.User, s1, s2 string) error {
+	args := m.Called(u, s1, s2)
+	return args.Error(0)
+}
+
+func (m *ProjectDefaultBranchServiceMock) Unset(u *models.User, s string) error {
+	args := m.Called(u, s)
+	return args.Error(0)
+}
@@ -0,0 +1,25 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type ProjectMetadataRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *ProjectMetadataRepositoryMock) GetByUser(s string) ([]*models.ProjectMetadata, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.ProjectMetadata), args.Error(1)
+}
+
+func (m *ProjectMetadataRepositoryMock) Upsert(p *models.ProjectMetadata) (*models.ProjectMetadata, error) {
+	args := m.Called(p)
+	return args.Get(0).(*models.ProjectMetadata), args.Error(1)
+}
+
+func (m *ProjectMetadataRepositoryMock) Delete(s1, s2 string) error {
+	args := m.Called(s1, s2)
+	return args.Error(0)
+}
@@ -0,0 +1,40 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type ProjectMetadataServiceMock struct {
+	mock.Mock
+}
+
+func (m *ProjectMetadataServiceMock) GetByUser(s string) ([]*models.ProjectMetadata, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.ProjectMetadata), args.Error(1)
+}
+
+func (m *ProjectMetadataServiceMock) GetMapped(s string) (map[string]*models.ProjectMetadata, error) {
+	args := m.Called(s)
+	return args.Get(0).(map[string]*models.ProjectMetadata), args.Error(1)
+}
+
+func (m *ProjectMetadataServiceMock) Resolve(s string, p []string) (map[string]*models.ProjectMetadata, error) {
+	args := m.Called(s, p)
+	return args.Get(0).(map[string]*models.ProjectMetadata), args.Error(1)
+}
+
+func (m *ProjectMetadataServiceMock) GetPrivate(s string, p []string) ([]string, error) {
+	args := m.Called(s, p)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *ProjectMetadataServiceMock) Set(p *models.ProjectMetadata) error {
+	args := m.Called(p)
+	return args.Error(0)
+}
+
+func (m *ProjectMetadataServiceMock) Unset(u *models.User, s string) error {
+	args := m.Called(u, s)
+	return args.Error(0)
+}
@@ -26,6 +26,21 @@ func (m *SummaryServiceMock) Summarize(t time.Time, t2 time.Time, u *models.User
 	return args.Get(0).(*models.Summary), args.Error(1)
 }
 
+func (m *SummaryServiceMock) Cumulative(t time.Time, t2 time.Time, u *models.User, f *models.Filters) (*models.CumulativeSummary, error) {
+	args := m.Called(t, t2, u, f)
+	return args.Get(0).(*models.CumulativeSummary), args.Error(1)
+}
+
+func (m *SummaryServiceMock) Rollup(t time.Time, t2 time.Time, u *models.User, f *models.Filters, s string) ([]*models.SummaryRollup, error) {
+	args := m.Called(t, t2, u, f, s)
+	return args.Get(0).([]*models.SummaryRollup), args.Error(1)
+}
+
+func (m *SummaryServiceMock) GetByUserWithin(u *models.User, t time.Time, t2 time.Time) ([]*models.Summary, error) {
+	args := m.Called(u, t, t2)
+	return args.Get(0).([]*models.Summary), args.Error(1)
+}
+
 func (m *SummaryServiceMock) GetLatestByUser() ([]*models.TimeByUser, error) {
 	args := m.Called()
 	return args.Get(0).([]*models.TimeByUser), args.Error(1)
@@ -41,7 +56,32 @@ func (m *SummaryServiceMock) DeleteByUserBefore(s string, t time.Time) error {
 	return args.Error(0)
 }
 
+func (m *SummaryServiceMock) DeleteByUserWithin(s string, t time.Time, t2 time.Time) error {
+	args := m.Called(s, t, t2)
+	return args.Error(0)
+}
+
 func (m *SummaryServiceMock) Insert(s *models.Summary) error {
 	args := m.Called(s)
 	return args.Error(0)
 }
+
+func (m *SummaryServiceMock) FlushCache(s string) int {
+	args := m.Called(s)
+	return args.Int(0)
+}
+
+func (m *SummaryServiceMock) FlushAllCaches() int {
+	args := m.Called()
+	return args.Int(0)
+}
+
+func (m *SummaryServiceMock) SummarizeBranchesAcrossProjects(t time.Time, t2 time.Time, u *models.User, f *models.Filters, p []string) ([]*models.BranchAcrossProjects, error) {
+	args := m.Called(t, t2, u, f, p)
+	return args.Get(0).([]*models.BranchAcrossProjects), args.Error(1)
+}
+
+func (m *SummaryServiceMock) SummarizeComponents(t time.Time, t2 time.Time, u *models.User, f *models.Filters, r []*models.ProjectComponentRule) (models.SummaryItems, error) {
+	args := m.Called(t, t2, u, f, r)
+	return args.Get(0).(models.SummaryItems), args.Error(1)
+}
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -19,6 +20,11 @@ func (m *UserServiceMock) GetUserByKey(s string) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *UserServiceMock) GetUserByMetricsToken(s string) (*models.User, error) {
+	args := m.Called(s)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
 func (m *UserServiceMock) GetUserByEmail(s string) (*models.User, error) {
 	args := m.Called(s)
 	return args.Get(0).(*models.User), args.Error(1)
@@ -54,11 +60,21 @@ func (m *UserServiceMock) GetAllByLeaderboard(b bool) ([]*models.User, error) {
 	panic("implement me")
 }
 
+func (m *UserServiceMock) GetByOrg(s string) ([]*models.User, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.User), args.Error(1)
+}
+
 func (m *UserServiceMock) GetAllByReports(b bool) ([]*models.User, error) {
 	args := m.Called(b)
 	return args.Get(0).([]*models.User), args.Error(1)
 }
 
+func (m *UserServiceMock) GetAllDeletionDue() ([]*models.User, error) {
+	args := m.Called()
+	return args.Get(0).([]*models.User), args.Error(1)
+}
+
 func (m *UserServiceMock) GetUserByStripeCustomerId(s string) (*models.User, error) {
 	args := m.Called(s)
 	return args.Get(0).(*models.User), args.Error(1)
@@ -69,6 +85,11 @@ func (m *UserServiceMock) GetActive(b bool) ([]*models.User, error) {
 	return args.Get(0).([]*models.User), args.Error(1)
 }
 
+func (m *UserServiceMock) Query(query *models.UserQuery, pageParams *utils.PageParams) ([]*models.UserWithActivity, int64, error) {
+	args := m.Called(query, pageParams)
+	return args.Get(0).([]*models.UserWithActivity), args.Get(1).(int64), args.Error(2)
+}
+
 func (m *UserServiceMock) Count() (int64, error) {
 	args := m.Called()
 	return int64(args.Int(0)), args.Error(1)
@@ -79,6 +100,16 @@ func (m *UserServiceMock) CreateOrGet(signup *models.Signup, isAdmin bool) (*mod
 	return args.Get(0).(*models.User), args.Bool(1), args.Error(2)
 }
 
+func (m *UserServiceMock) ProvisionByApiKey(key string) (*models.User, error) {
+	args := m.Called(key)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *UserServiceMock) UpdateOrgMembership(user *models.User) (*models.User, error) {
+	args := m.Called(user)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
 func (m *UserServiceMock) Update(user *models.User) (*models.User, error) {
 	args := m.Called(user)
 	return args.Get(0).(*models.User), args.Error(1)
@@ -89,11 +120,46 @@ func (m *UserServiceMock) Delete(user *models.User) error {
 	return args.Error(0)
 }
 
+func (m *UserServiceMock) SoftDelete(user *models.User) (*models.User, error) {
+	args := m.Called(user)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *UserServiceMock) Restore(user *models.User) (*models.User, error) {
+	args := m.Called(user)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *UserServiceMock) UpgradePasswordHash(user *models.User, password string) (bool, error) {
+	args := m.Called(user, password)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *UserServiceMock) ResetApiKey(user *models.User) (*models.User, error) {
 	args := m.Called(user)
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *UserServiceMock) ResetMetricsToken(user *models.User) (*models.User, error) {
+	args := m.Called(user)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *UserServiceMock) RevokeMetricsToken(user *models.User) (*models.User, error) {
+	args := m.Called(user)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *UserServiceMock) InferLocation(user *models.User, location string) (bool, error) {
+	args := m.Called(user, location)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *UserServiceMock) SetLastPlugin(user *models.User, plugin, version string) (bool, error) {
+	args := m.Called(user, plugin, version)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *UserServiceMock) ToggleBadges(user *models.User) (*models.User, error) {
 	args := m.Called(user)
 	return args.Get(0).(*models.User), args.Error(1)
@@ -109,6 +175,41 @@ func (m *UserServiceMock) GenerateResetToken(user *models.User) (*models.User, e
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *UserServiceMock) CreateSession(user *models.User, s1, s2 string) (*models.UserSession, error) {
+	args := m.Called(user, s1, s2)
+	return args.Get(0).(*models.UserSession), args.Error(1)
+}
+
+func (m *UserServiceMock) GetSession(s string) (*models.UserSession, error) {
+	args := m.Called(s)
+	return args.Get(0).(*models.UserSession), args.Error(1)
+}
+
+func (m *UserServiceMock) GetSessions(user *models.User) ([]*models.UserSession, error) {
+	args := m.Called(user)
+	return args.Get(0).([]*models.UserSession), args.Error(1)
+}
+
+func (m *UserServiceMock) TouchSession(session *models.UserSession) error {
+	args := m.Called(session)
+	return args.Error(0)
+}
+
+func (m *UserServiceMock) RevokeSession(user *models.User, s string) error {
+	args := m.Called(user, s)
+	return args.Error(0)
+}
+
+func (m *UserServiceMock) RevokeSessions(user *models.User, s string) error {
+	args := m.Called(user, s)
+	return args.Error(0)
+}
+
+func (m *UserServiceMock) DeleteStaleSessions() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *UserServiceMock) FlushCache() {
 	m.Called()
 }
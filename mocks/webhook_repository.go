@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type WebhookRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *WebhookRepositoryMock) GetById(id uint) (*models.Webhook, error) {
+	args := m.Called(id)
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *WebhookRepositoryMock) GetByUser(s string) ([]*models.Webhook, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.Webhook), args.Error(1)
+}
+
+func (m *WebhookRepositoryMock) Insert(w *models.Webhook) (*models.Webhook, error) {
+	args := m.Called(w)
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *WebhookRepositoryMock) Delete(id uint) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *WebhookRepositoryMock) InsertDelivery(d *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	args := m.Called(d)
+	return args.Get(0).(*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *WebhookRepositoryMock) UpdateDelivery(d *models.WebhookDelivery) error {
+	args := m.Called(d)
+	return args.Error(0)
+}
+
+func (m *WebhookRepositoryMock) GetDeliveriesByWebhook(id uint, limit int) ([]*models.WebhookDelivery, error) {
+	args := m.Called(id, limit)
+	return args.Get(0).([]*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *WebhookRepositoryMock) GetDueDeliveries(t time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	args := m.Called(t, limit)
+	return args.Get(0).([]*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *WebhookRepositoryMock) DeleteDeliveriesBefore(t time.Time) error {
+	args := m.Called(t)
+	return args.Error(0)
+}
@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+)
+
+type WebhookServiceMock struct {
+	mock.Mock
+}
+
+func (m *WebhookServiceMock) Schedule() {
+	m.Called()
+}
+
+func (m *WebhookServiceMock) GetByUser(s string) ([]*models.Webhook, error) {
+	args := m.Called(s)
+	return args.Get(0).([]*models.Webhook), args.Error(1)
+}
+
+func (m *WebhookServiceMock) Create(user *models.User, s string, events []string) (*models.Webhook, error) {
+	args := m.Called(user, s, events)
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *WebhookServiceMock) Delete(user *models.User, id uint) error {
+	args := m.Called(user, id)
+	return args.Error(0)
+}
+
+func (m *WebhookServiceMock) GetDeliveries(user *models.User, id uint, limit int) ([]*models.WebhookDelivery, error) {
+	args := m.Called(user, id, limit)
+	return args.Get(0).([]*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *WebhookServiceMock) Ping(user *models.User, id uint) (*models.WebhookDelivery, error) {
+	args := m.Called(user, id)
+	return args.Get(0).(*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *WebhookServiceMock) Dispatch(user *models.User, event string, data interface{}) error {
+	args := m.Called(user, event, data)
+	return args.Error(0)
+}
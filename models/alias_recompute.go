@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+const (
+	AliasRecomputeRunning  = "running"
+	AliasRecomputeFinished = "finished"
+	AliasRecomputeFailed   = "failed"
+)
+
+const (
+	AliasRecomputeDefaultDays = 30  // range to recompute if none is given, counting back from today
+	AliasRecomputeMaxDays     = 366 // to keep recomputes bounded, older data can still be recomputed in multiple steps
+)
+
+// AliasRecompute is the state of a user's (possibly still running) recompute of their summaries within a range, e.g. to retroactively apply newly created aliases
+type AliasRecompute struct {
+	Status     string     `json:"status"`
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	DaysDone   int        `json:"days_done"`
+	DaysTotal  int        `json:"days_total"`
+	Progress   float64    `json:"progress"` // share of days recomputed so far, between 0 and 1
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func (r *AliasRecompute) IsRunning() bool {
+	return r.Status == AliasRecomputeRunning
+}
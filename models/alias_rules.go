@@ -0,0 +1,20 @@
+package models
+
+// AliasRules maps summary field names (e.g. "projects") to alias keys and, for each key, the list of original names (possibly containing wildcards) to be aliased
+type AliasRules map[string]map[string][]string
+
+// AliasRuleConflict describes a single original name, which a rules file maps to more than one alias key
+type AliasRuleConflict struct {
+	Type  string   `json:"type"`
+	Value string   `json:"value"`
+	Keys  []string `json:"keys"`
+}
+
+type AliasRulesResult struct {
+	Created   int                  `json:"created"`
+	Updated   int                  `json:"updated"` // existing aliases of the same original name, which got mapped to a different key
+	Unchanged int                  `json:"unchanged"`
+	Deleted   int                  `json:"deleted,omitempty"` // only when replacing all of the user's aliases
+	Conflicts []*AliasRuleConflict `json:"conflicts,omitempty"`
+	Recompute *AliasRecompute      `json:"recompute,omitempty"` // only if requested to retroactively apply the rules
+}
@@ -0,0 +1,19 @@
+package models
+
+const MaxAutoArchiveDays = 3650
+
+// ArchivedProject holds a project's archive state for a user. Archived projects are hidden from project listings, but still count towards all totals.
+// A record with Archived = false remembers that a project was unarchived manually, which auto-archiving respects until the project sees new activity.
+type ArchivedProject struct {
+	ID        uint       `json:"-" gorm:"primary_key"`
+	User      *User      `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID    string     `json:"-" gorm:"not null; uniqueIndex:idx_archived_project_user_project"`
+	Project   string     `json:"project" gorm:"not null; size:255; uniqueIndex:idx_archived_project_user_project"`
+	Archived  bool       `json:"archived" gorm:"type:bool"`
+	Automatic bool       `json:"automatic" gorm:"type:bool"` // whether archived by the auto-archiving job
+	UpdatedAt CustomTime `json:"updated_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+}
+
+func (p *ArchivedProject) IsValid() bool {
+	return p.UserID != "" && p.Project != ""
+}
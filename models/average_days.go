@@ -0,0 +1,32 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/duke-git/lancet/v2/datetime"
+)
+
+// AverageDays returns the number of days to divide the total coding time between from and to by to get a daily average, according to the given averaging mode:
+//   - AverageModeCalendar (or empty): every day of the range
+//   - AverageModeActiveDays: only the given number of active days
+//   - AverageModeSinceFirst: only the days since the day of the first heartbeat, or every day of the range if the first heartbeat is unknown (zero) or before the range
+func AverageDays(mode string, from, to, firstHeartbeat time.Time, activeDays int) int {
+	calendarDays := int(to.Sub(from).Hours() / 24)
+
+	switch mode {
+	case AverageModeActiveDays:
+		return activeDays
+	case AverageModeSinceFirst:
+		if firstHeartbeat.IsZero() || !firstHeartbeat.After(from) {
+			return calendarDays
+		}
+		if !firstHeartbeat.Before(to) {
+			return 0
+		}
+		skippedDays := max(int(math.Round(datetime.BeginOfDay(firstHeartbeat.In(from.Location())).Sub(from).Hours()/24)), 0)
+		return max(calendarDays-skippedDays, 1)
+	default:
+		return calendarDays
+	}
+}
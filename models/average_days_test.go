@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAverageDays(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 30)
+
+	assert.Equal(t, 30, AverageDays("", from, to, time.Time{}, 5))
+	assert.Equal(t, 30, AverageDays(AverageModeCalendar, from, to, from.AddDate(0, 0, 10), 5))
+	assert.Equal(t, 5, AverageDays(AverageModeActiveDays, from, to, time.Time{}, 5))
+	assert.Equal(t, 0, AverageDays(AverageModeActiveDays, from, to, time.Time{}, 0))
+
+	// counting from the day of the first heartbeat
+	assert.Equal(t, 20, AverageDays(AverageModeSinceFirst, from, to, from.AddDate(0, 0, 10), 0))
+	assert.Equal(t, 20, AverageDays(AverageModeSinceFirst, from, to, from.AddDate(0, 0, 10).Add(15*time.Hour), 0))
+	assert.Equal(t, 1, AverageDays(AverageModeSinceFirst, from, to, to.Add(-1*time.Hour), 0))
+	assert.Equal(t, 30, AverageDays(AverageModeSinceFirst, from, to, from.AddDate(-1, 0, 0), 0))
+	assert.Equal(t, 30, AverageDays(AverageModeSinceFirst, from, to, time.Time{}, 0)) // unknown
+	assert.Equal(t, 0, AverageDays(AverageModeSinceFirst, from, to, to.AddDate(0, 0, 1), 0))
+
+	// ranges not starting at midnight
+	assert.Equal(t, 7, AverageDays(AverageModeSinceFirst, from.Add(10*time.Hour), from.AddDate(0, 0, 7).Add(10*time.Hour), from.Add(12*time.Hour), 0))
+}
+
+func TestCumulativeSummary_ActiveDays(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	sut := NewCumulativeSummary(from, from.AddDate(0, 0, 4))
+	sut.Add(from, 0)
+	sut.Add(from.AddDate(0, 0, 1), 30*time.Second)
+	sut.Add(from.AddDate(0, 0, 2), 2*time.Hour)
+	sut.Add(from.AddDate(0, 0, 3), 10*time.Minute)
+
+	assert.Equal(t, 3, sut.ActiveDays(0))
+	assert.Equal(t, 2, sut.ActiveDays(1*time.Minute))
+	assert.Equal(t, 1, sut.ActiveDays(1*time.Hour))
+}
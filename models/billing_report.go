@@ -0,0 +1,121 @@
+package models
+
+import (
+	"math"
+	"sort"
+)
+
+const BillingReportUnbilledNote = "projects without an hourly rate are not billed, set one via the project's metadata"
+
+// currencies without minor units, any other is rounded to cents
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true, "KMF": true, "KRW": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// BillingReport turns a summary's project times into billable amounts according to each project's hourly rate.
+// As amounts in different currencies can't be summed up, there is one grand total per currency.
+type BillingReport struct {
+	From     CustomTime           `json:"from" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	To       CustomTime           `json:"to" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	Items    []*BillingReportItem `json:"items"`
+	Totals   []*BillingTotal      `json:"totals"`
+	Unbilled []string             `json:"unbilled"` // projects with coding time, but without an hourly rate
+	Note     string               `json:"note,omitempty"`
+}
+
+type BillingReportItem struct {
+	Project    string  `json:"project"`
+	Total      int64   `json:"total"` // seconds
+	Hours      float64 `json:"hours"` // rounded to two decimals
+	HourlyRate float64 `json:"hourly_rate"`
+	Currency   string  `json:"currency"`
+	Amount     float64 `json:"amount"` // rounded to the currency's minor unit
+}
+
+type BillingTotal struct {
+	Currency string  `json:"currency"`
+	Total    int64   `json:"total"` // seconds
+	Hours    float64 `json:"hours"`
+	Amount   float64 `json:"amount"` // sum of the items' rounded amounts, so that invoice lines add up
+}
+
+// NewBillingReport bills every project of the (aliased) summary that has an hourly rate in the given metadata, mapped by displayed project name (see IProjectMetadataService.Resolve)
+func NewBillingReport(summary *Summary, metadata map[string]*ProjectMetadata) *BillingReport {
+	report := &BillingReport{
+		From:     summary.FromTime,
+		To:       summary.ToTime,
+		Items:    make([]*BillingReportItem, 0),
+		Totals:   make([]*BillingTotal, 0),
+		Unbilled: make([]string, 0),
+	}
+
+	totals := make(map[string]*BillingTotal)
+	for _, p := range summary.Projects {
+		seconds := int64(p.TotalFixed().Seconds())
+		if seconds == 0 {
+			continue
+		}
+
+		m, ok := metadata[p.Key]
+		if !ok || !m.IsBillable() {
+			report.Unbilled = append(report.Unbilled, p.Key)
+			continue
+		}
+
+		hours := float64(seconds) / 3600
+		item := &BillingReportItem{
+			Project:    p.Key,
+			Total:      seconds,
+			Hours:      roundBillingAmount(hours, 2),
+			HourlyRate: m.HourlyRate,
+			Currency:   m.Currency,
+			Amount:     roundBillingAmount(hours*m.HourlyRate, CurrencyDecimals(m.Currency)),
+		}
+		report.Items = append(report.Items, item)
+
+		if _, ok := totals[m.Currency]; !ok {
+			totals[m.Currency] = &BillingTotal{Currency: m.Currency}
+			report.Totals = append(report.Totals, totals[m.Currency])
+		}
+		totals[m.Currency].Total += seconds
+		totals[m.Currency].Amount += item.Amount
+	}
+
+	for _, t := range report.Totals {
+		t.Hours = roundBillingAmount(float64(t.Total)/3600, 2)
+		t.Amount = roundBillingAmount(t.Amount, CurrencyDecimals(t.Currency)) // avoid floating point artifacts from summing up
+	}
+
+	sort.Slice(report.Items, func(i, j int) bool {
+		if report.Items[i].Currency != report.Items[j].Currency {
+			return report.Items[i].Currency < report.Items[j].Currency
+		}
+		if report.Items[i].Amount != report.Items[j].Amount {
+			return report.Items[i].Amount > report.Items[j].Amount
+		}
+		return report.Items[i].Project < report.Items[j].Project
+	})
+	sort.Slice(report.Totals, func(i, j int) bool {
+		return report.Totals[i].Currency < report.Totals[j].Currency
+	})
+	sort.Strings(report.Unbilled)
+
+	if len(report.Unbilled) > 0 {
+		report.Note = BillingReportUnbilledNote
+	}
+	return report
+}
+
+// CurrencyDecimals returns the number of decimals amounts in the given currency are rounded to
+func CurrencyDecimals(currency string) int {
+	if zeroDecimalCurrencies[currency] {
+		return 0
+	}
+	return 2
+}
+
+func roundBillingAmount(amount float64, decimals int) float64 {
+	factor := math.Pow(10, float64(decimals))
+	return math.Round(amount*factor) / factor
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBillingReport(t *testing.T) {
+	summary := &Summary{
+		Projects: []*SummaryItem{
+			{Type: SummaryProject, Key: "wakapi", Total: 5400},    // 1.5 h
+			{Type: SummaryProject, Key: "anchr", Total: 1000},     // 0.2777 h
+			{Type: SummaryProject, Key: "telepush", Total: 3600},  // 1 h
+			{Type: SummaryProject, Key: "mininote", Total: 7200},  // 2 h
+			{Type: SummaryProject, Key: "hobby", Total: 1800},     // no rate
+			{Type: SummaryProject, Key: "colorized", Total: 1800}, // currency only
+		},
+	}
+	metadata := map[string]*ProjectMetadata{
+		"wakapi":    {Project: "wakapi", HourlyRate: 80, Currency: "EUR"},
+		"anchr":     {Project: "anchr", HourlyRate: 80, Currency: "EUR"},
+		"telepush":  {Project: "telepush", HourlyRate: 95.5, Currency: "USD"},
+		"mininote":  {Project: "mininote", HourlyRate: 3333.3, Currency: "JPY"},
+		"colorized": {Project: "colorized", Color: "#00b4d8", Currency: "EUR"},
+	}
+
+	report := NewBillingReport(summary, metadata)
+
+	assert.Len(t, report.Items, 4)
+	assert.Equal(t, "wakapi", report.Items[0].Project)
+	assert.Equal(t, 1.5, report.Items[0].Hours)
+	assert.Equal(t, 120.0, report.Items[0].Amount)
+	assert.Equal(t, "anchr", report.Items[1].Project)
+	assert.Equal(t, 0.28, report.Items[1].Hours)
+	assert.Equal(t, 22.22, report.Items[1].Amount)
+	assert.Equal(t, "JPY", report.Items[2].Currency)
+	assert.Equal(t, 6667.0, report.Items[2].Amount)
+	assert.Equal(t, "USD", report.Items[3].Currency)
+	assert.Equal(t, 95.5, report.Items[3].Amount)
+
+	assert.Len(t, report.Totals, 3)
+	assert.Equal(t, &BillingTotal{Currency: "EUR", Total: 6400, Hours: 1.78, Amount: 142.22}, report.Totals[0])
+	assert.Equal(t, &BillingTotal{Currency: "JPY", Total: 7200, Hours: 2, Amount: 6667}, report.Totals[1])
+	assert.Equal(t, &BillingTotal{Currency: "USD", Total: 3600, Hours: 1, Amount: 95.5}, report.Totals[2])
+
+	assert.Equal(t, []string{"colorized", "hobby"}, report.Unbilled)
+	assert.Equal(t, BillingReportUnbilledNote, report.Note)
+}
+
+func TestNewBillingReport_AllBilled(t *testing.T) {
+	summary := &Summary{
+		Projects: []*SummaryItem{
+			{Type: SummaryProject, Key: "wakapi", Total: 3600},
+			{Type: SummaryProject, Key: "idle", Total: 0},
+		},
+	}
+	metadata := map[string]*ProjectMetadata{
+		"wakapi": {Project: "wakapi", HourlyRate: 50, Currency: "EUR"},
+	}
+
+	report := NewBillingReport(summary, metadata)
+
+	assert.Len(t, report.Items, 1)
+	assert.Empty(t, report.Unbilled)
+	assert.Empty(t, report.Note)
+}
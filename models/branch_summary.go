@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// BranchAcrossProjects is the combined time spent on equally named branches of multiple projects, e.g. for a feature spanning several repositories
+type BranchAcrossProjects struct {
+	Branch   string        `json:"branch"`
+	Total    time.Duration `json:"total" swaggertype:"primitive,integer"` // seconds
+	Projects SummaryItems  `json:"projects"`                              // share of every project, seconds
+}
@@ -13,6 +13,7 @@ type HeartbeatsViewModel struct {
 
 type HeartbeatResponseViewModel struct {
 	Responses [][]interface{} `json:"responses"`
+	Ignored   int             `json:"ignored"` // number of heartbeats dropped due to the user's ignore patterns (not part of wakatime's api)
 }
 
 type HeartbeatResponseData struct {
@@ -12,13 +12,15 @@ type LeadersViewModel struct {
 }
 
 type LeadersCurrentUser struct {
-	Rank int   `json:"rank"`
-	Page int   `json:"page"`
-	User *User `json:"user"`
+	Rank       int     `json:"rank"`
+	Percentile float64 `json:"percentile"` // not part of wakatime's api, top x percent of all participants
+	Page       int     `json:"page"`
+	User       *User   `json:"user"`
 }
 
 type LeadersEntry struct {
 	Rank         int                  `json:"rank"`
+	Percentile   float64              `json:"percentile"` // not part of wakatime's api, top x percent of all participants
 	RunningTotal *LeadersRunningTotal `json:"running_total"`
 	User         *User                `json:"user"`
 }
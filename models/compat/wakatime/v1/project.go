@@ -17,4 +17,7 @@ type Project struct {
 	HumanReadableLastHeartbeatAt string    `json:"human_readable_last_heartbeat_at"`
 	UrlencodedName               string    `json:"urlencoded_name"`
 	CreatedAt                    time.Time `json:"created_at"`
+	Color                        string    `json:"color,omitempty"`
+	Icon                         string    `json:"icon,omitempty"`        // not part of wakatime's api
+	Description                  string    `json:"description,omitempty"` // not part of wakatime's api
 }
@@ -15,51 +15,76 @@ type StatsViewModel struct {
 }
 
 type StatsData struct {
-	Username                  string            `json:"username"`
-	UserId                    string            `json:"user_id"`
-	Start                     string            `json:"start"`
-	End                       string            `json:"end"`
-	Status                    string            `json:"status"`
-	TotalSeconds              float64           `json:"total_seconds"`
-	DailyAverage              float64           `json:"daily_average"`
-	DaysIncludingHolidays     int               `json:"days_including_holidays"`
-	Range                     string            `json:"range"`
-	HumanReadableRange        string            `json:"human_readable_range"`
-	HumanReadableTotal        string            `json:"human_readable_total"`
-	HumanReadableDailyAverage string            `json:"human_readable_daily_average"`
-	IsCodingActivityVisible   bool              `json:"is_coding_activity_visible"`
-	IsOtherUsageVisible       bool              `json:"is_other_usage_visible"`
-	Editors                   []*SummariesEntry `json:"editors"`
-	Languages                 []*SummariesEntry `json:"languages"`
-	Machines                  []*SummariesEntry `json:"machines"`
-	Projects                  []*SummariesEntry `json:"projects"`
-	OperatingSystems          []*SummariesEntry `json:"operating_systems"`
-	Branches                  []*SummariesEntry `json:"branches,omitempty"`
-	Categories                []*SummariesEntry `json:"categories"`
+	Username                                        string            `json:"username"`
+	UserId                                          string            `json:"user_id"`
+	Start                                           string            `json:"start"`
+	End                                             string            `json:"end"`
+	Status                                          string            `json:"status"`
+	Timezone                                        string            `json:"timezone"`
+	TotalSeconds                                    float64           `json:"total_seconds"` // excluding unknown languages, like wakatime does for its 'Other' language
+	TotalSecondsIncludingOtherLanguage              float64           `json:"total_seconds_including_other_language"`
+	DailyAverage                                    float64           `json:"daily_average"`
+	DailyAverageIncludingOtherLanguage              float64           `json:"daily_average_including_other_language"`
+	DaysIncludingHolidays                           int               `json:"days_including_holidays"`
+	DaysMinusHolidays                               int               `json:"days_minus_holidays"`
+	Holidays                                        int               `json:"holidays"`
+	Range                                           string            `json:"range"`
+	HumanReadableRange                              string            `json:"human_readable_range"`
+	HumanReadableTotal                              string            `json:"human_readable_total"`
+	HumanReadableTotalIncludingOtherLanguage        string            `json:"human_readable_total_including_other_language"`
+	HumanReadableDailyAverage                       string            `json:"human_readable_daily_average"`
+	HumanReadableDailyAverageIncludingOtherLanguage string            `json:"human_readable_daily_average_including_other_language"`
+	IsCodingActivityVisible                         bool              `json:"is_coding_activity_visible"`
+	IsOtherUsageVisible                             bool              `json:"is_other_usage_visible"`
+	BestDay                                         *StatsBestDay     `json:"best_day"`
+	Editors                                         []*SummariesEntry `json:"editors"`
+	Languages                                       []*SummariesEntry `json:"languages"`
+	Machines                                        []*SummariesEntry `json:"machines"`
+	Projects                                        []*SummariesEntry `json:"projects"`
+	OperatingSystems                                []*SummariesEntry `json:"operating_systems"`
+	Branches                                        []*SummariesEntry `json:"branches,omitempty"`
+	Categories                                      []*SummariesEntry `json:"categories"`
 }
 
-func NewStatsFrom(summary *models.Summary, filters *models.Filters) *StatsViewModel {
+type StatsBestDay struct {
+	Date         string  `json:"date"`
+	Text         string  `json:"text"`
+	TotalSeconds float64 `json:"total_seconds"`
+}
+
+// NewStatsFrom converts the summary into wakatime stats, whose daily averages are computed over the given number of days (see models.AverageDays), while days_including_holidays always refers to the full range
+func NewStatsFrom(summary *models.Summary, filters *models.Filters, averageDays int) *StatsViewModel {
 	totalTime := summary.TotalTime()
+	totalTimeKnown := totalTime - summary.TotalTimeByKey(models.SummaryLanguage, models.UnknownSummaryKey)
 	numDays := int(summary.ToTime.T().Sub(summary.FromTime.T()).Hours() / 24)
 
 	data := &StatsData{
-		Username:              summary.UserID,
-		UserId:                summary.UserID,
-		Start:                 summary.FromTime.T().Format(time.RFC3339),
-		End:                   summary.ToTime.T().Format(time.RFC3339),
-		Status:                "ok",
-		TotalSeconds:          totalTime.Seconds(),
-		DaysIncludingHolidays: numDays,
-		HumanReadableTotal:    helpers.FmtWakatimeDuration(totalTime),
+		Username:                                 summary.UserID,
+		UserId:                                   summary.UserID,
+		Start:                                    summary.FromTime.T().Format(time.RFC3339),
+		End:                                      summary.ToTime.T().Format(time.RFC3339),
+		Status:                                   "ok",
+		TotalSeconds:                             totalTimeKnown.Seconds(),
+		TotalSecondsIncludingOtherLanguage:       totalTime.Seconds(),
+		DaysIncludingHolidays:                    numDays,
+		DaysMinusHolidays:                        numDays,
+		Holidays:                                 0, // not implemented, because we don't track user location
+		HumanReadableTotal:                       helpers.FmtWakatimeDuration(totalTimeKnown),
+		HumanReadableTotalIncludingOtherLanguage: helpers.FmtWakatimeDuration(totalTime),
 	}
 
-	if numDays > 0 {
-		data.DailyAverage = totalTime.Seconds() / float64(numDays)
-		data.HumanReadableDailyAverage = helpers.FmtWakatimeDuration(totalTime / time.Duration(numDays))
+	if averageDays > 0 {
+		data.DailyAverage = totalTimeKnown.Seconds() / float64(averageDays)
+		data.DailyAverageIncludingOtherLanguage = totalTime.Seconds() / float64(averageDays)
+		data.HumanReadableDailyAverage = helpers.FmtWakatimeDuration(totalTimeKnown / time.Duration(averageDays))
+		data.HumanReadableDailyAverageIncludingOtherLanguage = helpers.FmtWakatimeDuration(totalTime / time.Duration(averageDays))
 	}
 	if math.IsInf(data.DailyAverage, 0) || math.IsNaN(data.DailyAverage) {
 		data.DailyAverage = 0
 	}
+	if math.IsInf(data.DailyAverageIncludingOtherLanguage, 0) || math.IsNaN(data.DailyAverageIncludingOtherLanguage) {
+		data.DailyAverageIncludingOtherLanguage = 0
+	}
 
 	editors := make([]*SummariesEntry, len(summary.Editors))
 	for i, e := range summary.Editors {
@@ -114,3 +139,28 @@ func NewStatsFrom(summary *models.Summary, filters *models.Filters) *StatsViewMo
 		Data: data,
 	}
 }
+
+// NewStatsBestDayFrom determines the day with the most coding time among the given summaries, which are added up per day (in the given timezone) first to account for summaries of less than a day. Returns nil if none of them has any coding time.
+func NewStatsBestDayFrom(summaries []*models.Summary, tz *time.Location) *StatsBestDay {
+	days := make([]string, 0)
+	totals := make(map[string]time.Duration)
+	for _, s := range summaries {
+		day := s.FromTime.T().In(tz).Format(time.DateOnly)
+		if _, ok := totals[day]; !ok {
+			days = append(days, day)
+		}
+		totals[day] += s.TotalTime()
+	}
+
+	var bestDay *StatsBestDay
+	for _, day := range days {
+		if total := totals[day]; total > 0 && (bestDay == nil || total.Seconds() > bestDay.TotalSeconds) {
+			bestDay = &StatsBestDay{
+				Date:         day,
+				Text:         helpers.FmtWakatimeDuration(total),
+				TotalSeconds: total.Seconds(),
+			}
+		}
+	}
+	return bestDay
+}
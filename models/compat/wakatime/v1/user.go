@@ -45,7 +45,7 @@ func NewFromUser(user *models.User) *User {
 	avatarURL := user.AvatarURL(cfg.App.AvatarURLTemplate)
 
 	if !strings.HasPrefix(avatarURL, "http") {
-		avatarURL = fmt.Sprintf("%s%s/%s", cfg.Server.GetPublicUrl(), cfg.Server.BasePath, avatarURL)
+		avatarURL = fmt.Sprintf("%s/%s", cfg.Server.GetBaseUrl(), avatarURL)
 	}
 
 	return &User{
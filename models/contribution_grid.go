@@ -0,0 +1,70 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+const ContributionGridLevels = 4
+
+// ContributionGrid holds the coding time of every day of a calendar year, laid out in week columns starting on Monday, similar to GitHub's contribution graph.
+// The first and last week are padded with nil days outside the year, so that every week holds exactly seven days. Days in the future are nil as well.
+type ContributionGrid struct {
+	Year     int                     `json:"year"`
+	Timezone string                  `json:"timezone"`
+	Total    int64                   `json:"total"` // seconds
+	Max      int64                   `json:"max"`   // seconds of the most active day
+	Weeks    []*ContributionGridWeek `json:"weeks"`
+}
+
+type ContributionGridWeek struct {
+	Start string                  `json:"start"` // date of the week's monday
+	Days  [7]*ContributionGridDay `json:"days"`  // monday to sunday
+}
+
+type ContributionGridDay struct {
+	Date  string `json:"date"`
+	Total int64  `json:"total"` // seconds
+	Level int    `json:"level"` // intensity from 0 (no activity) to 4, relative to the most active day
+}
+
+// NewContributionGrid lays out the given daily totals, which are expected to span from the year's first day up to either its last day or today
+func NewContributionGrid(year int, tz *time.Location, days []*CumulativeSummaryDay) *ContributionGrid {
+	grid := &ContributionGrid{
+		Year:     year,
+		Timezone: tz.String(),
+		Weeks:    []*ContributionGridWeek{},
+	}
+
+	for _, d := range days {
+		grid.Total += int64(d.Total.Seconds())
+		grid.Max = max(grid.Max, int64(d.Total.Seconds()))
+	}
+
+	totals := make(map[string]int64, len(days))
+	for _, d := range days {
+		totals[d.Date.Format(time.DateOnly)] = int64(d.Total.Seconds())
+	}
+
+	first := time.Date(year, 1, 1, 0, 0, 0, 0, tz)
+	weekStart := first.AddDate(0, 0, -(int(first.Weekday())+6)%7) // monday on or before jan 1st
+	for ; weekStart.Year() <= year; weekStart = weekStart.AddDate(0, 0, 7) {
+		week := &ContributionGridWeek{Start: weekStart.Format(time.DateOnly)}
+		for i := range week.Days {
+			date := weekStart.AddDate(0, 0, i).Format(time.DateOnly)
+			if total, ok := totals[date]; ok {
+				week.Days[i] = &ContributionGridDay{Date: date, Total: total, Level: grid.level(total)}
+			}
+		}
+		grid.Weeks = append(grid.Weeks, week)
+	}
+
+	return grid
+}
+
+func (g *ContributionGrid) level(total int64) int {
+	if total <= 0 || g.Max <= 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(total) / float64(g.Max) * ContributionGridLevels))
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewContributionGrid(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Berlin")
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, tz)
+
+	summary := NewCumulativeSummary(from, from.AddDate(1, 0, 0))
+	for d := from; d.Year() == 2025; d = d.AddDate(0, 0, 1) {
+		summary.Add(d, 0)
+	}
+	summary.Days[0].Total = 2 * time.Hour
+	summary.Days[1].Total = 30 * time.Minute
+	summary.Days[364].Total = 1 * time.Hour
+
+	sut := NewContributionGrid(2025, tz, summary.Days)
+
+	assert.Equal(t, 2025, sut.Year)
+	assert.Equal(t, "Europe/Berlin", sut.Timezone)
+	assert.Equal(t, int64(3.5*3600), sut.Total)
+	assert.Equal(t, int64(2*3600), sut.Max)
+	assert.Len(t, sut.Weeks, 53)
+
+	// jan 1st, 2025 is a wednesday, dec 31st a wednesday, too
+	first, last := sut.Weeks[0], sut.Weeks[52]
+	assert.Equal(t, "2024-12-30", first.Start)
+	assert.Nil(t, first.Days[0])
+	assert.Nil(t, first.Days[1])
+	assert.Equal(t, &ContributionGridDay{Date: "2025-01-01", Total: 7200, Level: 4}, first.Days[2])
+	assert.Equal(t, &ContributionGridDay{Date: "2025-01-02", Total: 1800, Level: 1}, first.Days[3])
+	assert.Equal(t, &ContributionGridDay{Date: "2025-01-03", Total: 0, Level: 0}, first.Days[4])
+	assert.Equal(t, "2025-12-29", last.Start)
+	assert.Equal(t, &ContributionGridDay{Date: "2025-12-31", Total: 3600, Level: 2}, last.Days[2])
+	assert.Nil(t, last.Days[3])
+
+	for _, w := range sut.Weeks {
+		start, _ := time.Parse(time.DateOnly, w.Start)
+		assert.Equal(t, time.Monday, start.Weekday())
+	}
+}
+
+func TestNewContributionGrid_Partial(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	summary := NewCumulativeSummary(from, from.AddDate(0, 0, 10))
+	for i := 0; i < 10; i++ {
+		summary.Add(from.AddDate(0, 0, i), 0)
+	}
+
+	sut := NewContributionGrid(2024, time.UTC, summary.Days)
+
+	// full year layout, but days not yet passed are missing
+	assert.Len(t, sut.Weeks, 53)
+	assert.Equal(t, "2024-01-01", sut.Weeks[0].Start)
+	assert.Equal(t, &ContributionGridDay{Date: "2024-01-10"}, sut.Weeks[1].Days[2])
+	assert.Nil(t, sut.Weeks[1].Days[3])
+	assert.Zero(t, sut.Total)
+	assert.Zero(t, sut.Max)
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// CumulativeSummary holds the running total of coding time at the end of every day within a range
+type CumulativeSummary struct {
+	From time.Time
+	To   time.Time
+	Days []*CumulativeSummaryDay
+}
+
+type CumulativeSummaryDay struct {
+	Date       time.Time // beginning of the day
+	Total      time.Duration
+	Cumulative time.Duration // including this day
+}
+
+func NewCumulativeSummary(from, to time.Time) *CumulativeSummary {
+	return &CumulativeSummary{
+		From: from,
+		To:   to,
+		Days: []*CumulativeSummaryDay{},
+	}
+}
+
+// Add appends the next day, advancing the running total by the given total (which may well be zero)
+func (s *CumulativeSummary) Add(date time.Time, total time.Duration) {
+	var cumulative time.Duration
+	if len(s.Days) > 0 {
+		cumulative = s.Days[len(s.Days)-1].Cumulative
+	}
+	s.Days = append(s.Days, &CumulativeSummaryDay{
+		Date:       date,
+		Total:      total,
+		Cumulative: cumulative + total,
+	})
+}
+
+func (s *CumulativeSummary) TotalTime() time.Duration {
+	if len(s.Days) == 0 {
+		return 0
+	}
+	return s.Days[len(s.Days)-1].Cumulative
+}
+
+// ActiveDays counts the days with coding time of at least the given threshold, see Summary.IsActiveDay
+func (s *CumulativeSummary) ActiveDays(threshold time.Duration) int {
+	var n int
+	for _, d := range s.Days {
+		if d.Total > 0 && d.Total >= threshold {
+			n++
+		}
+	}
+	return n
+}
@@ -1,6 +1,12 @@
 package models
 
-import "sort"
+import (
+	"sort"
+	"time"
+
+	"github.com/duke-git/lancet/v2/slice"
+	conf "github.com/muety/wakapi/config"
+)
 
 type Durations []*Duration
 
@@ -9,6 +15,9 @@ func (d Durations) Len() int {
 }
 
 func (d Durations) Less(i, j int) bool {
+	if d[i].Time.T().Equal(d[j].Time.T()) {
+		return d[i].GroupHash < d[j].GroupHash // for a deterministic order of durations starting at the same time
+	}
 	return d[i].Time.T().Before(d[j].Time.T())
 }
 
@@ -44,3 +53,145 @@ func (d *Durations) Last() *Duration {
 	}
 	return (*d)[d.Len()-1]
 }
+
+// WithDominantBranches returns a copy of the durations, in which every coding session is entirely attributed to the branch most time was spent on within it.
+// A session is a series of durations within the same project, each starting at most maxGap after the previous one ended. Brief switches to other branches
+// are hereby counted towards the dominant one, at the cost of branch totals no longer being exact.
+func (d Durations) WithDominantBranches(maxGap time.Duration) Durations {
+	result := make(Durations, len(d))
+	for i, e := range d {
+		copied := *e
+		result[i] = &copied
+	}
+	sort.Sort(result)
+
+	type session struct {
+		end     time.Time
+		members []*Duration
+	}
+
+	closeSession := func(s *session) {
+		totals := make(map[string]time.Duration)
+		for _, e := range s.members {
+			totals[e.Branch] += e.Duration
+		}
+		var dominant string
+		for branch, total := range totals {
+			if total > totals[dominant] || (total == totals[dominant] && branch < dominant) {
+				dominant = branch
+			}
+		}
+		for _, e := range s.members {
+			e.Branch = dominant
+		}
+	}
+
+	sessions := make(map[string]*session) // currently open session per project
+	for _, e := range result {
+		s, ok := sessions[e.Project]
+		if ok && e.Time.T().Sub(s.end) > maxGap {
+			closeSession(s)
+			ok = false
+		}
+		if !ok {
+			s = &session{}
+			sessions[e.Project] = s
+		}
+		s.members = append(s.members, e)
+		if end := e.Time.T().Add(e.Duration); end.After(s.end) {
+			s.end = end
+		}
+	}
+	for _, s := range sessions {
+		closeSession(s)
+	}
+
+	return result
+}
+
+// CappedPerProjectAndDay returns the durations sorted by time, with any time beyond the given maximum per project and day (in the given timezone) cut off.
+// The earliest time of every day is kept, i.e. the duration reaching the cap is shortened and all later ones of that project and day are dropped.
+func (d Durations) CappedPerProjectAndDay(max time.Duration, tz *time.Location) Durations {
+	sorted := make(Durations, len(d))
+	copy(sorted, d)
+	sort.Sort(sorted)
+
+	result := make(Durations, 0, len(sorted))
+	counted := make(map[string]time.Duration) // by day and project
+	for _, e := range sorted {
+		key := e.Time.T().In(tz).Format(conf.SimpleDateFormat) + "/" + e.Project
+		remaining := max - counted[key]
+		if remaining <= 0 {
+			continue
+		}
+		if e.Duration > remaining {
+			copied := *e
+			copied.Duration = remaining
+			e = &copied
+		}
+		counted[key] += e.Duration
+		result = append(result, e)
+	}
+	return result
+}
+
+// Clipped returns the durations overlapping the given range, with their parts outside of it cut off
+func (d Durations) Clipped(from, to time.Time) Durations {
+	result := make(Durations, 0, len(d))
+	for _, e := range d {
+		start, end := e.Time.T(), e.Time.T().Add(e.Duration)
+		if !end.After(from) || !start.Before(to) {
+			continue
+		}
+		if start.Before(from) || end.After(to) {
+			copied := *e
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			copied.Time = CustomTime(start)
+			copied.Duration = end.Sub(start)
+			e = &copied
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// CodingSession is a period of continuous work on a single project, see WithDominantBranches for how sessions are determined
+type CodingSession struct {
+	Project   string
+	Start     time.Time
+	End       time.Time
+	Duration  time.Duration // actual coding time, excluding gaps between durations
+	Languages []string      // in order of first appearance
+}
+
+// Sessions merges the durations into coding sessions per project, sorted by start time
+func (d Durations) Sessions(maxGap time.Duration) []*CodingSession {
+	sorted := make(Durations, len(d))
+	copy(sorted, d)
+	sort.Sort(sorted)
+
+	sessions := make([]*CodingSession, 0)
+	open := make(map[string]*CodingSession) // currently open session per project
+	for _, e := range sorted {
+		s, ok := open[e.Project]
+		if !ok || e.Time.T().Sub(s.End) > maxGap {
+			s = &CodingSession{Project: e.Project, Start: e.Time.T(), End: e.Time.T(), Languages: []string{}}
+			open[e.Project] = s
+			sessions = append(sessions, s)
+		}
+		s.Duration += e.Duration
+		if end := e.Time.T().Add(e.Duration); end.After(s.End) {
+			s.End = end
+		}
+		if e.Language != "" && !slice.Contain(s.Languages, e.Language) {
+			s.Languages = append(s.Languages, e.Language)
+		}
+	}
+
+	return sessions
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDurations_WithDominantBranches(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(min int) CustomTime {
+		return CustomTime(t0.Add(time.Duration(min) * time.Minute))
+	}
+
+	sut := Durations{
+		// session 1 in project "wakapi", mostly on "main"
+		{Project: "wakapi", Branch: "main", Time: at(0), Duration: 20 * time.Minute},
+		{Project: "wakapi", Branch: "fix", Time: at(21), Duration: 2 * time.Minute},
+		{Project: "wakapi", Branch: "main", Time: at(24), Duration: 10 * time.Minute},
+		// concurrent session in another project
+		{Project: "other", Branch: "dev", Time: at(5), Duration: 1 * time.Minute},
+		// session 2 in project "wakapi", after a longer break
+		{Project: "wakapi", Branch: "main", Time: at(60), Duration: 1 * time.Minute},
+		{Project: "wakapi", Branch: "feature", Time: at(62), Duration: 5 * time.Minute},
+	}
+
+	result := sut.WithDominantBranches(2 * time.Minute)
+	assert.Len(t, result, 6)
+
+	branches := make(map[int]string)
+	for _, d := range result {
+		branches[int(d.Time.T().Sub(t0).Minutes())] = d.Branch
+	}
+	assert.Equal(t, map[int]string{0: "main", 21: "main", 24: "main", 5: "dev", 60: "feature", 62: "feature"}, branches)
+
+	// original durations are left untouched
+	assert.Equal(t, "fix", sut[1].Branch)
+	assert.Equal(t, "main", sut[4].Branch)
+}
+
+func TestDurations_Sessions(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(min int) CustomTime {
+		return CustomTime(t0.Add(time.Duration(min) * time.Minute))
+	}
+
+	sut := Durations{
+		{Project: "wakapi", Language: "Go", Time: at(24), Duration: 10 * time.Minute},
+		{Project: "wakapi", Language: "Go", Time: at(0), Duration: 20 * time.Minute},
+		{Project: "wakapi", Language: "Markdown", Time: at(21), Duration: 2 * time.Minute},
+		{Project: "other", Language: "Python", Time: at(5), Duration: 1 * time.Minute},
+		{Project: "wakapi", Language: "Go", Time: at(60), Duration: 5 * time.Minute},
+	}
+
+	result := sut.Sessions(2 * time.Minute)
+	assert.Len(t, result, 3)
+	assert.Equal(t, &CodingSession{Project: "wakapi", Start: t0, End: at(34).T(), Duration: 32 * time.Minute, Languages: []string{"Go", "Markdown"}}, result[0])
+	assert.Equal(t, "other", result[1].Project)
+	assert.Equal(t, at(60).T(), result[2].Start)
+	assert.Equal(t, 5*time.Minute, result[2].Duration)
+	assert.Equal(t, at(24), sut[0].Time) // original order is left untouched
+}
+
+func TestDurations_CappedPerProjectAndDay(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	at := func(hours float64) CustomTime {
+		return CustomTime(t0.Add(time.Duration(hours * float64(time.Hour))))
+	}
+
+	sut := Durations{
+		{Project: "wakapi", Time: at(4), Duration: 10 * time.Hour}, // editor left open
+		{Project: "wakapi", Time: at(0), Duration: 3 * time.Hour},
+		{Project: "other", Time: at(3), Duration: 1 * time.Hour},
+		{Project: "wakapi", Time: at(14), Duration: 1 * time.Hour}, // beyond cap
+		{Project: "wakapi", Time: at(24), Duration: 2 * time.Hour}, // next day
+	}
+
+	result := sut.CappedPerProjectAndDay(8*time.Hour, time.UTC)
+	assert.Len(t, result, 4)
+	assert.Equal(t, at(0), result[0].Time)
+	assert.Equal(t, "other", result[1].Project)
+	assert.Equal(t, 1*time.Hour, result[1].Duration)
+	assert.Equal(t, at(4), result[2].Time)
+	assert.Equal(t, 5*time.Hour, result[2].Duration)
+	assert.Equal(t, at(24), result[3].Time)
+	assert.Equal(t, 2*time.Hour, result[3].Duration)
+	assert.Equal(t, 10*time.Hour, sut[0].Duration) // original left untouched
+
+	// in the user's timezone, the long duration starts on the next day, along with all later ones
+	result = sut.CappedPerProjectAndDay(8*time.Hour, time.FixedZone("UTC+12", 12*60*60))
+	assert.Len(t, result, 3)
+	assert.Equal(t, 3*time.Hour, result[0].Duration)
+	assert.Equal(t, 8*time.Hour, result[2].Duration)
+}
+
+func TestDurations_Clipped(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	sut := Durations{
+		{Project: "wakapi", Time: CustomTime(t0), Duration: 2 * time.Hour},
+		{Project: "wakapi", Time: CustomTime(t0.Add(3 * time.Hour)), Duration: 1 * time.Hour},
+		{Project: "wakapi", Time: CustomTime(t0.Add(5 * time.Hour)), Duration: 3 * time.Hour},
+		{Project: "wakapi", Time: CustomTime(t0.Add(9 * time.Hour)), Duration: 1 * time.Hour},
+	}
+
+	result := sut.Clipped(t0.Add(1*time.Hour), t0.Add(6*time.Hour))
+	assert.Len(t, result, 3)
+	assert.Equal(t, CustomTime(t0.Add(1*time.Hour)), result[0].Time)
+	assert.Equal(t, 1*time.Hour, result[0].Duration)
+	assert.Same(t, sut[1], result[1])
+	assert.Equal(t, CustomTime(t0.Add(5*time.Hour)), result[2].Time)
+	assert.Equal(t, 1*time.Hour, result[2].Duration)
+	assert.Equal(t, 2*time.Hour, sut[0].Duration) // original left untouched
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+var urlSchemePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.\-]*://`)
+
+// EntityNormalization rewrites url-like entities at ingest time, as reported by web-based editors (e.g. "https://vscode.dev/github/muety/wakapi/main.go?ref=abc#L12"),
+// so that the same file isn't accounted once per distinct query string or fragment.
+// Only entities starting with a scheme (other than "file") are considered urls, so that plain file paths containing '?' or '#' are left untouched.
+type EntityNormalization struct {
+	StripQuery bool // strip query string and fragment
+	StripHost  bool // strip scheme and host, leaving only the path, only applies to file heartbeats, because browsing activity is identified by the host
+}
+
+func (n EntityNormalization) IsEmpty() bool {
+	return !n.StripQuery && !n.StripHost
+}
+
+func (n EntityNormalization) Apply(entity, entityType string) string {
+	scheme := urlSchemePattern.FindString(entity)
+	if scheme == "" || n.IsEmpty() {
+		return entity
+	}
+	isFileUri := strings.EqualFold(scheme, "file://")
+
+	if n.StripQuery && !isFileUri {
+		if i := strings.IndexAny(entity[len(scheme):], "?#"); i >= 0 {
+			entity = entity[:len(scheme)+i]
+		}
+	}
+	if n.StripHost && entityType == "file" {
+		// never strip the whole entity, e.g. if there is no path
+		if i := strings.Index(entity[len(scheme):], "/"); i >= 0 && len(scheme)+i < len(entity)-1 {
+			entity = entity[len(scheme)+i:]
+		}
+	}
+	return entity
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntityNormalization_Apply(t *testing.T) {
+	url := "https://vscode.dev/github/muety/wakapi/main.go?ref=abc#L12"
+
+	assert.True(t, EntityNormalization{}.IsEmpty())
+	assert.Equal(t, url, EntityNormalization{}.Apply(url, "file"))
+
+	assert.Equal(t, "https://vscode.dev/github/muety/wakapi/main.go", EntityNormalization{StripQuery: true}.Apply(url, "file"))
+	assert.Equal(t, "https://vscode.dev/main.go", EntityNormalization{StripQuery: true}.Apply("https://vscode.dev/main.go#L1?foo", "file"))
+	assert.Equal(t, "/github/muety/wakapi/main.go", EntityNormalization{StripQuery: true, StripHost: true}.Apply(url, "file"))
+	assert.Equal(t, "/github/muety/wakapi/main.go?ref=abc#L12", EntityNormalization{StripHost: true}.Apply(url, "file"))
+
+	// host is kept for browsing activity
+	assert.Equal(t, "https://wakapi.dev/settings", EntityNormalization{StripQuery: true, StripHost: true}.Apply("https://wakapi.dev/settings?tab=1", "url"))
+
+	// never strips the entire entity
+	assert.Equal(t, "https://vscode.dev", EntityNormalization{StripQuery: true, StripHost: true}.Apply("https://vscode.dev?foo", "file"))
+	assert.Equal(t, "https://vscode.dev/", EntityNormalization{StripHost: true}.Apply("https://vscode.dev/", "file"))
+
+	// plain file paths and file uris are left untouched, as '?' and '#' are legitimate characters in file names
+	testCases := []string{
+		"/home/user/dev/what?.md",
+		"/home/user/dev/c#/Program.cs",
+		`C:\dev\notes#1.txt`,
+		"src/query?x=1.go",
+		"file:///home/user/dev/c#/Program.cs",
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc, EntityNormalization{StripQuery: true}.Apply(tc, "file"), tc)
+	}
+	assert.Equal(t, "/home/user/dev/c#/Program.cs", EntityNormalization{StripQuery: true, StripHost: true}.Apply("file:///home/user/dev/c#/Program.cs", "file"))
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"github.com/duke-git/lancet/v2/slice"
 	"github.com/mitchellh/hashstructure/v2"
 	"log/slog"
 )
@@ -16,7 +17,10 @@ type Filters struct {
 	Branch             OrFilter
 	Entity             OrFilter
 	Category           OrFilter
-	SelectFilteredOnly bool // flag indicating to drop all Entity types from a summary except the single one filtered by
+	SelectFilteredOnly bool    // flag indicating to drop all Entity types from a summary except the single one filtered by
+	SelectFields       []uint8 // summary types to compute, all if empty
+	DominantBranch     bool    // attribute every coding session to its dominant branch, instead of splitting by exact branch times, see Durations.WithDominantBranches
+	WriteOnly          bool    // only count heartbeats flagged as is_write (i.e. file saves), giving an "actual editing" view as opposed to time spent viewing files
 }
 
 type OrFilter []string
@@ -61,6 +65,26 @@ func (f *Filters) WithSelectFilteredOnly() *Filters {
 	return f
 }
 
+func (f *Filters) WithSelectFields(types ...uint8) *Filters {
+	// labels are derived from projects, so these have to be computed as well
+	if slice.Contain(types, SummaryLabel) && !slice.Contain(types, SummaryProject) {
+		types = append(types, SummaryProject)
+	}
+	f.SelectFields = append(f.SelectFields, types...)
+	return f
+}
+
+// IsSelected returns whether the given summary type is to be computed, which is the case for all types unless SelectFields is set
+func (f *Filters) IsSelected(entity uint8) bool {
+	return f == nil || len(f.SelectFields) == 0 || slice.Contain(f.SelectFields, entity)
+}
+
+func (f *Filters) SelectedTypes(types []uint8) []uint8 {
+	return slice.Filter(types, func(_ int, t uint8) bool {
+		return f.IsSelected(t)
+	})
+}
+
 func (f *Filters) WithMultiple(entity uint8, keys []string) *Filters {
 	switch entity {
 	case SummaryProject:
@@ -191,7 +215,7 @@ func (f *Filters) MatchHeartbeat(h *Heartbeat) bool {
 		(f.Language == nil || f.Language.MatchAny(h.Language)) &&
 		(f.Editor == nil || f.Editor.MatchAny(h.Editor)) &&
 		(f.Machine == nil || f.Machine.MatchAny(h.Machine)) &&
-		(f.Category == nil || f.Machine.MatchAny(h.Category))
+		(f.Category == nil || f.Category.MatchAny(h.Category))
 }
 
 func (f *Filters) MatchDuration(d *Duration) bool {
@@ -200,6 +224,7 @@ func (f *Filters) MatchDuration(d *Duration) bool {
 		(f.Language == nil || f.Language.MatchAny(d.Language)) &&
 		(f.Editor == nil || f.Editor.MatchAny(d.Editor)) &&
 		(f.Machine == nil || f.Machine.MatchAny(d.Machine)) &&
+		(f.Branch == nil || f.Branch.MatchAny(d.Branch)) && // durations' branches are already normalized to projects' default branches, unlike heartbeats'
 		(f.Category == nil || f.Category.MatchAny(d.Category))
 }
 
@@ -103,6 +103,11 @@ func (suite *FiltersTestSuite) TestFilters_Match() {
 	sut4 := &Filters{}
 	assert.True(suite.T(), sut4.MatchHeartbeat(heartbeats[0]))
 	assert.True(suite.T(), sut4.MatchHeartbeat(heartbeats[1]))
+
+	heartbeats[0].Category = "debugging"
+	sut5 := NewFiltersWith(SummaryCategory, "debugging")
+	assert.True(suite.T(), sut5.MatchHeartbeat(heartbeats[0]))
+	assert.False(suite.T(), sut5.MatchHeartbeat(heartbeats[1]))
 }
 
 func (suite *FiltersTestSuite) TestFilters_One() {
@@ -158,3 +163,19 @@ func (suite *FiltersTestSuite) TestFilters_WithProjectLabels() {
 	assert.Contains(suite.T(), sut2.Project, "anchr")
 	assert.Contains(suite.T(), sut2.Label, "oss")
 }
+
+func (suite *FiltersTestSuite) TestFilters_SelectedTypes() {
+	all := PersistedSummaryTypes()
+
+	assert.Equal(suite.T(), all, (&Filters{}).SelectedTypes(all))
+	assert.Equal(suite.T(), all, (*Filters)(nil).SelectedTypes(all))
+
+	sut := (&Filters{}).WithSelectFields(SummaryLanguage, SummaryEditor)
+	assert.Equal(suite.T(), []uint8{SummaryLanguage, SummaryEditor}, sut.SelectedTypes(all))
+	assert.True(suite.T(), sut.IsSelected(SummaryLanguage))
+	assert.False(suite.T(), sut.IsSelected(SummaryProject))
+
+	sut = (&Filters{}).WithSelectFields(SummaryLabel)
+	assert.Equal(suite.T(), []uint8{SummaryProject}, sut.SelectedTypes(all))
+	assert.True(suite.T(), sut.IsSelected(SummaryLabel))
+}
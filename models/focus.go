@@ -0,0 +1,119 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	conf "github.com/muety/wakapi/config"
+)
+
+const (
+	FocusLevelProject = "project"
+	FocusLevelFile    = "file"
+)
+
+var FocusLevels = []string{FocusLevelProject, FocusLevelFile}
+
+// FocusFigures describe how fragmented coding time is. A focus block is a period of uninterrupted work on the same project (or file), which ends
+// either by switching to another one or by taking a break longer than the heartbeats timeout. Only the former counts as a context switch.
+type FocusFigures struct {
+	Total        int64 `json:"total"` // seconds
+	Switches     int   `json:"switches"`
+	FocusBlocks  int   `json:"focus_blocks"`
+	AverageFocus int64 `json:"average_focus"` // seconds
+	LongestFocus int64 `json:"longest_focus"` // seconds
+}
+
+type FocusDay struct {
+	Date string `json:"date" example:"2006-01-02"`
+	FocusFigures
+}
+
+// FocusStats holds focus figures for the whole range and for every day with coding activity, in the user's timezone
+type FocusStats struct {
+	From     time.Time   `json:"from"`
+	To       time.Time   `json:"to"`
+	Timezone string      `json:"timezone"`
+	Level    string      `json:"level"`
+	Days     []*FocusDay `json:"days"`
+	FocusFigures
+}
+
+type focusBlock struct {
+	key      string
+	end      time.Time
+	duration time.Duration
+}
+
+func (f *FocusFigures) addBlock(duration time.Duration) {
+	seconds := int64(duration.Seconds())
+	f.Total += seconds
+	f.FocusBlocks++
+	f.AverageFocus = f.Total / int64(f.FocusBlocks)
+	if seconds > f.LongestFocus {
+		f.LongestFocus = seconds
+	}
+}
+
+// NewFocusStats splits the given durations into focus blocks by project or by file (see FocusLevels), where durations starting more than maxGap after the
+// previous one ended are considered a break, just like for coding sessions (see Durations.Sessions). Blocks never span across days.
+func NewFocusStats(from, to time.Time, tz *time.Location, level string, durations Durations, maxGap time.Duration) *FocusStats {
+	stats := &FocusStats{
+		From:     from,
+		To:       to,
+		Timezone: tz.String(),
+		Level:    level,
+		Days:     []*FocusDay{},
+	}
+
+	sorted := make(Durations, len(durations))
+	copy(sorted, durations)
+	sort.Sort(sorted)
+
+	focusKey := func(d *Duration) string {
+		if level == FocusLevelFile {
+			return d.Entity
+		}
+		return d.Project
+	}
+
+	var day *FocusDay
+	var block *focusBlock // currently open one
+
+	closeBlock := func() {
+		if block != nil {
+			day.addBlock(block.duration)
+			stats.addBlock(block.duration)
+		}
+		block = nil
+	}
+
+	for _, d := range sorted {
+		key, start, end := focusKey(d), d.Time.T(), d.Time.T().Add(d.Duration)
+
+		if date := start.In(tz).Format(conf.SimpleDateFormat); day == nil || day.Date != date {
+			closeBlock()
+			day = &FocusDay{Date: date}
+			stats.Days = append(stats.Days, day)
+		}
+		if block != nil && start.Sub(block.end) > maxGap {
+			closeBlock()
+		}
+		if block != nil && block.key != key {
+			closeBlock()
+			day.Switches++
+			stats.Switches++
+		}
+
+		if block == nil {
+			block = &focusBlock{key: key}
+		}
+		block.duration += d.Duration
+		if end.After(block.end) {
+			block.end = end
+		}
+	}
+	closeBlock()
+
+	return stats
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFocusStats(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(min int) CustomTime {
+		return CustomTime(t0.Add(time.Duration(min) * time.Minute))
+	}
+
+	durations := Durations{
+		// day 1: wakapi (split by language), switch to other, switch back to wakapi, break, wakapi again
+		{Project: "wakapi", Entity: "main.go", Language: "Go", Time: at(0), Duration: 20 * time.Minute},
+		{Project: "wakapi", Entity: "README.md", Language: "Markdown", Time: at(20), Duration: 10 * time.Minute},
+		{Project: "other", Entity: "app.py", Language: "Python", Time: at(30), Duration: 5 * time.Minute},
+		{Project: "wakapi", Entity: "main.go", Language: "Go", Time: at(35), Duration: 5 * time.Minute},
+		{Project: "wakapi", Entity: "main.go", Language: "Go", Time: at(60), Duration: 10 * time.Minute},
+		// day 2: different project than the day before, which is no switch
+		{Project: "other", Entity: "app.py", Language: "Python", Time: at(24 * 60), Duration: 30 * time.Minute},
+	}
+
+	from, to := t0, t0.AddDate(0, 0, 2)
+
+	t.Run("by project", func(t *testing.T) {
+		sut := NewFocusStats(from, to, time.UTC, FocusLevelProject, durations, 2*time.Minute)
+
+		assert.Equal(t, FocusLevelProject, sut.Level)
+		assert.Len(t, sut.Days, 2)
+		assert.Equal(t, &FocusDay{Date: "2024-01-01", FocusFigures: FocusFigures{Total: 50 * 60, Switches: 2, FocusBlocks: 4, AverageFocus: 50 * 60 / 4, LongestFocus: 30 * 60}}, sut.Days[0])
+		assert.Equal(t, &FocusDay{Date: "2024-01-02", FocusFigures: FocusFigures{Total: 30 * 60, FocusBlocks: 1, AverageFocus: 30 * 60, LongestFocus: 30 * 60}}, sut.Days[1])
+		assert.Equal(t, FocusFigures{Total: 80 * 60, Switches: 2, FocusBlocks: 5, AverageFocus: 80 * 60 / 5, LongestFocus: 30 * 60}, sut.FocusFigures)
+	})
+
+	t.Run("by file", func(t *testing.T) {
+		sut := NewFocusStats(from, to, time.UTC, FocusLevelFile, durations, 2*time.Minute)
+
+		assert.Len(t, sut.Days, 2)
+		assert.Equal(t, 3, sut.Days[0].Switches)
+		assert.Equal(t, 5, sut.Days[0].FocusBlocks)
+		assert.Equal(t, int64(20*60), sut.Days[0].LongestFocus)
+		assert.Equal(t, int64(80*60), sut.Total)
+	})
+
+	t.Run("in user's timezone", func(t *testing.T) {
+		tz := time.FixedZone("UTC-11", -11*60*60)
+		sut := NewFocusStats(from, to, tz, FocusLevelProject, durations, 2*time.Minute)
+
+		// local midnight is at 11:00 utc, so that the last block of day 1 already belongs to the same local day as day 2
+		assert.Len(t, sut.Days, 2)
+		assert.Equal(t, "2023-12-31", sut.Days[0].Date)
+		assert.Equal(t, 2, sut.Days[0].Switches)
+		assert.Equal(t, 3, sut.Days[0].FocusBlocks)
+		assert.Equal(t, "2024-01-01", sut.Days[1].Date)
+		assert.Equal(t, 0, sut.Days[1].Switches)
+		assert.Equal(t, 2, sut.Days[1].FocusBlocks)
+		assert.Equal(t, "UTC-11", sut.Timezone)
+	})
+
+	t.Run("without durations", func(t *testing.T) {
+		sut := NewFocusStats(from, to, time.UTC, FocusLevelProject, Durations{}, 2*time.Minute)
+
+		assert.Empty(t, sut.Days)
+		assert.Zero(t, sut.FocusBlocks)
+		assert.Zero(t, sut.AverageFocus)
+	})
+}
@@ -2,8 +2,11 @@ package models
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"log/slog"
 
@@ -11,10 +14,28 @@ import (
 	"github.com/mitchellh/hashstructure/v2"
 )
 
+const DefaultHeartbeatType = "file"
+
+// sizes of text columns with a fixed size, see struct tags below.
+// indexed columns without an explicit size become varchar(191) on mysql, so they're limited to that on all databases.
+var heartbeatColumnSizes = map[string]int{
+	"type":             255,
+	"category":         255,
+	"project":          191,
+	"branch":           191,
+	"language":         191,
+	"editor":           191,
+	"operating_system": 191,
+	"machine":          191,
+	"user_agent":       255,
+	"origin":           255,
+	"origin_id":        255,
+}
+
 type Heartbeat struct {
 	ID               uint64     `json:"-" gorm:"primary_key" hash:"ignore"`
 	User             *User      `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" hash:"ignore"`
-	UserID           string     `json:"-" gorm:"not null; index:idx_time_user; index:idx_user_project"` // idx_user_project is for quickly fetching a user's project list (settings page)
+	UserID           string     `json:"-" gorm:"not null; index:idx_time_user; index:idx_user_project; index:idx_user_created"` // idx_user_project is for quickly fetching a user's project list (settings page)
 	Entity           string     `json:"entity" gorm:"not null"`
 	Type             string     `json:"type" gorm:"size:255"`
 	Category         string     `json:"category" gorm:"size:255"`
@@ -30,7 +51,7 @@ type Heartbeat struct {
 	Hash             string     `json:"-" gorm:"type:varchar(17); uniqueIndex"`
 	Origin           string     `json:"-" hash:"ignore" gorm:"type:varchar(255)"`
 	OriginId         string     `json:"-" hash:"ignore" gorm:"type:varchar(255)"`
-	CreatedAt        CustomTime `json:"created_at" gorm:"timeScale:3" swaggertype:"primitive,number" hash:"ignore"` // https://gorm.io/docs/conventions.html#CreatedAt
+	CreatedAt        CustomTime `json:"created_at" gorm:"timeScale:3; index:idx_user_created" swaggertype:"primitive,number" hash:"ignore"` // https://gorm.io/docs/conventions.html#CreatedAt, idx_user_created is for finding a user's most recently received heartbeats
 	Lines            int        `json:"lines,omitempty" hash:"ignore"`
 	LineNo           int        `json:"lineno,omitempty" hash:"ignore"`
 	CursorPos        int        `json:"cursorpos,omitempty" hash:"ignore"`
@@ -48,12 +69,75 @@ func (h *Heartbeat) Timely(maxAge time.Duration) bool {
 	return now.Sub(h.Time.T()) <= maxAge && h.Time.T().Sub(now) < 1*time.Hour
 }
 
+// MissingFields returns the names of all fields left empty by the client, without which a heartbeat can't be attributed properly.
+// Time is required as well, but can't be defaulted and is checked by Valid instead.
+func (h *Heartbeat) MissingFields() []string {
+	missing := make([]string, 0)
+	if strings.TrimSpace(h.Entity) == "" {
+		missing = append(missing, "entity")
+	}
+	if strings.TrimSpace(h.Type) == "" {
+		missing = append(missing, "type")
+	}
+	return missing
+}
+
+// FillMissingFields sets defaults for all fields reported by MissingFields
+func (h *Heartbeat) FillMissingFields() *Heartbeat {
+	if strings.TrimSpace(h.Entity) == "" {
+		h.Entity = UnknownSummaryKey
+	}
+	if strings.TrimSpace(h.Type) == "" {
+		h.Type = DefaultHeartbeatType
+	}
+	return h
+}
+
 func (h *Heartbeat) Sanitize() *Heartbeat {
 	h.OperatingSystem = strutil.Capitalize(h.OperatingSystem)
 	h.Editor = strutil.Capitalize(h.Editor)
 	return h
 }
 
+// OversizedFields returns the names of all text fields exceeding either the given maximum length (0 for none) or their column size
+func (h *Heartbeat) OversizedFields(maxLength int) []string {
+	oversized := make([]string, 0)
+	for name, field := range h.textFields() {
+		if utf8.RuneCountInString(*field) > fieldMaxLength(name, maxLength) {
+			oversized = append(oversized, name)
+		}
+	}
+	sort.Strings(oversized)
+	return oversized
+}
+
+// Truncate cuts off all text fields exceeding either the given maximum length (0 for none) or their column size and returns the names of the truncated fields
+func (h *Heartbeat) Truncate(maxLength int) []string {
+	truncated := h.OversizedFields(maxLength)
+	fields := h.textFields()
+	for _, name := range truncated {
+		*fields[name] = string([]rune(*fields[name])[:fieldMaxLength(name, maxLength)])
+	}
+	return truncated
+}
+
+func (h *Heartbeat) textFields() map[string]*string {
+	return map[string]*string{
+		"entity":           &h.Entity,
+		"type":             &h.Type,
+		"category":         &h.Category,
+		"project":          &h.Project,
+		"branch":           &h.Branch,
+		"language":         &h.Language,
+		"editor":           &h.Editor,
+		"operating_system": &h.OperatingSystem,
+		"machine":          &h.Machine,
+		"user_agent":       &h.UserAgent,
+		"origin":           &h.Origin,
+		"origin_id":        &h.OriginId,
+	}
+}
+
 func (h *Heartbeat) Augment(languageMappings map[string]string) {
 	maxPrec := -1 // precision / mapping complexity -> more concrete ones shall take precedence
 	for ending, value := range languageMappings {
@@ -64,6 +148,17 @@ func (h *Heartbeat) Augment(languageMappings map[string]string) {
 	}
 }
 
+// DetectLanguage sets a file heartbeat's language by its extension, either if missing or, with override set, regardless of the language sent by the client.
+// Mappings are expected to be lower case, see LanguageByExtension.
+func (h *Heartbeat) DetectLanguage(mappings map[string]string, override bool) {
+	if h.Type != DefaultHeartbeatType || (h.Language != "" && !override) {
+		return
+	}
+	if language := LanguageByExtension(h.Entity, mappings); language != "" {
+		h.Language = language
+	}
+}
+
 func (h *Heartbeat) GetKey(t uint8) (key string) {
 	switch t {
 	case SummaryProject:
@@ -163,3 +258,13 @@ func GetEntityColumn(t uint8) string {
 		"branch",
 	}[t]
 }
+
+func fieldMaxLength(name string, maxLength int) int {
+	if size, ok := heartbeatColumnSizes[name]; ok && (maxLength <= 0 || size < maxLength) {
+		return size
+	}
+	if maxLength <= 0 {
+		return math.MaxInt
+	}
+	return maxLength
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 	"time"
 )
@@ -53,6 +54,71 @@ func TestHeartbeat_Augment(t *testing.T) {
 	assert.Equal(t, "PHP 8", sut3.Language)
 }
 
+func TestHeartbeat_DetectLanguage(t *testing.T) {
+	testMappings := map[string]string{
+		"go":   "Go",
+		"ts":   "TypeScript",
+		"d.ts": "TypeScript Declarations",
+		"tsx":  "TSX",
+	}
+
+	newHeartbeat := func(entity, language string) *Heartbeat {
+		return &Heartbeat{Entity: entity, Type: DefaultHeartbeatType, Language: language}
+	}
+
+	sut1 := newHeartbeat("~/dev/main.go", "")
+	sut2 := newHeartbeat("~/dev/types.d.ts", "")
+	sut3 := newHeartbeat("~/dev/App.TSX", "")
+	sut4 := newHeartbeat("~/dev/main.go", "Golang")
+	sut5 := newHeartbeat("~/dev/Makefile", "")
+	sut6 := &Heartbeat{Entity: "github.com/main.go", Type: "domain"}
+
+	for _, hb := range []*Heartbeat{sut1, sut2, sut3, sut4, sut5, sut6} {
+		hb.DetectLanguage(testMappings, false)
+	}
+
+	assert.Equal(t, "Go", sut1.Language)
+	assert.Equal(t, "TypeScript Declarations", sut2.Language) // more specific one takes precedence
+	assert.Equal(t, "TSX", sut3.Language)
+	assert.Equal(t, "Golang", sut4.Language) // sent by client
+	assert.Empty(t, sut5.Language)
+	assert.Empty(t, sut6.Language) // not a file
+
+	sut4.DetectLanguage(testMappings, true)
+	sut5.Language = "Makefile"
+	sut5.DetectLanguage(testMappings, true)
+	assert.Equal(t, "Go", sut4.Language)
+	assert.Equal(t, "Makefile", sut5.Language) // kept if nothing matches
+}
+
+func TestLanguageByExtension_Defaults(t *testing.T) {
+	for file, language := range map[string]string{
+		"main.go":      "Go",
+		"script.py":    "Python",
+		"index.js":     "JavaScript",
+		"config.cjs":   "JavaScript",
+		"App.jsx":      "JSX",
+		"server.ts":    "TypeScript",
+		"Page.tsx":     "TSX",
+		"Main.java":    "Java",
+		"lib.rs":       "Rust",
+		"main.cpp":     "C++",
+		"Program.cs":   "C#",
+		"style.scss":   "SCSS",
+		"README.md":    "Markdown",
+		"compose.yml":  "YAML",
+		"deploy.sh":    "Bash",
+		"Cargo.toml":   "TOML",
+		"notebook.txt": "",
+	} {
+		assert.Equal(t, language, LanguageByExtension(file, DefaultLanguageMappings), file)
+	}
+
+	for ext := range DefaultLanguageMappings {
+		assert.Equal(t, strings.ToLower(ext), ext) // expected to be lower case
+	}
+}
+
 func TestHeartbeat_GetKey(t *testing.T) {
 	sut := &Heartbeat{
 		Project: "wakapi",
@@ -128,3 +194,52 @@ func TestHeartbeat_Unmarshal_IgnoreID(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotContains(t, raw3, "\"id\":")
 }
+
+func TestHeartbeatCursor_RoundTrip(t *testing.T) {
+	sut := &HeartbeatCursor{Time: time.UnixMilli(1619335137332), ID: 42}
+
+	parsed, err := ParseHeartbeatCursor(sut.String())
+	assert.Nil(t, err)
+	assert.True(t, sut.Time.Equal(parsed.Time))
+	assert.Equal(t, sut.ID, parsed.ID)
+
+	_, err = ParseHeartbeatCursor("not a cursor")
+	assert.NotNil(t, err)
+}
+
+func TestHeartbeat_OversizedFields(t *testing.T) {
+	sut := &Heartbeat{
+		Entity:    "/home/user/" + strings.Repeat("a", 100),
+		Branch:    "main",
+		Project:   strings.Repeat("p", 192),
+		UserAgent: strings.Repeat("b", 300),
+	}
+	assert.Equal(t, []string{"entity", "project", "user_agent"}, sut.OversizedFields(100))
+	assert.Equal(t, []string{"project", "user_agent"}, sut.OversizedFields(0)) // column sizes still apply
+}
+
+func TestHeartbeat_Truncate(t *testing.T) {
+	sut := &Heartbeat{
+		Entity:    "/home/user/" + strings.Repeat("ä", 100),
+		Branch:    "main",
+		UserAgent: strings.Repeat("b", 300),
+	}
+	assert.Equal(t, []string{"entity", "user_agent"}, sut.Truncate(20))
+	assert.Equal(t, "/home/user/"+strings.Repeat("ä", 9), sut.Entity) // cut at character, not byte boundaries
+	assert.Equal(t, "main", sut.Branch)
+	assert.Equal(t, strings.Repeat("b", 20), sut.UserAgent)
+	assert.Empty(t, sut.OversizedFields(20))
+}
+
+func TestHeartbeat_MissingFields(t *testing.T) {
+	sut := &Heartbeat{Entity: " ", Project: "wakapi"}
+	assert.Equal(t, []string{"entity", "type"}, sut.MissingFields())
+
+	sut.FillMissingFields()
+	assert.Equal(t, UnknownSummaryKey, sut.Entity)
+	assert.Equal(t, DefaultHeartbeatType, sut.Type)
+	assert.Empty(t, sut.MissingFields())
+
+	sut = &Heartbeat{Entity: "main.go", Type: "file"}
+	assert.Empty(t, sut.MissingFields())
+}
@@ -1,6 +1,14 @@
 package models
 
-import "sort"
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Heartbeats []*Heartbeat
 
@@ -36,3 +44,39 @@ func (h *Heartbeats) Last() *Heartbeat {
 	}
 	return (*h)[h.Len()-1]
 }
+
+// HeartbeatCursor identifies a position within a time-ordered list of heartbeats.
+// Ties on timestamp are broken by id, so that paging through heartbeats stays stable even if new ones are inserted concurrently.
+type HeartbeatCursor struct {
+	Time time.Time
+	ID   uint64
+}
+
+func NewHeartbeatCursor(heartbeat *Heartbeat) *HeartbeatCursor {
+	return &HeartbeatCursor{Time: heartbeat.Time.T(), ID: heartbeat.ID}
+}
+
+func ParseHeartbeatCursor(encoded string) (*HeartbeatCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(string(decoded), "_")
+	if len(parts) != 2 {
+		return nil, errors.New("invalid cursor")
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &HeartbeatCursor{Time: time.UnixMilli(ts), ID: id}, nil
+}
+
+func (c *HeartbeatCursor) String() string {
+	// timestamps are stored with millisecond precision (see CustomTime)
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d_%d", c.Time.UnixMilli(), c.ID)))
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// HourlyActivity holds coding time per hour of day (0-23), and optionally per day of week (0 = Sunday) and hour of day, in the user's timezone
+type HourlyActivity struct {
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Timezone string        `json:"timezone"`
+	Hours    [24]int64     `json:"hours"`              // seconds
+	Weekdays *[7][24]int64 `json:"weekdays,omitempty"` // seconds
+}
+
+func NewHourlyActivity(from, to time.Time, tz *time.Location, withWeekdays bool) *HourlyActivity {
+	a := &HourlyActivity{
+		From:     from,
+		To:       to,
+		Timezone: tz.String(),
+	}
+	if withWeekdays {
+		a.Weekdays = &[7][24]int64{}
+	}
+	return a
+}
+
+// Add distributes the given interval over all hour buckets it spans
+func (a *HourlyActivity) Add(start time.Time, duration time.Duration, tz *time.Location) {
+	t, end := start.In(tz), start.In(tz).Add(duration)
+	for t.Before(end) {
+		// beginning of the next local hour (not using truncate, as it ignores non-full-hour zone offsets)
+		next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, tz).Add(time.Hour)
+		if !next.After(t) {
+			next = t.Add(time.Hour)
+		}
+		if next.After(end) {
+			next = end
+		}
+
+		seconds := int64(next.Sub(t).Seconds())
+		a.Hours[t.Hour()] += seconds
+		if a.Weekdays != nil {
+			a.Weekdays[t.Weekday()][t.Hour()] += seconds
+		}
+		t = next
+	}
+}
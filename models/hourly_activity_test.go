@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHourlyActivity_Add(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Berlin")
+	sut := NewHourlyActivity(time.Time{}, time.Time{}, tz, true)
+
+	// monday, 2024-01-01 09:45 local time, for 30 minutes
+	sut.Add(time.Date(2024, 1, 1, 8, 45, 0, 0, time.UTC), 30*time.Minute, tz)
+
+	assert.Equal(t, int64(15*60), sut.Hours[9])
+	assert.Equal(t, int64(15*60), sut.Hours[10])
+	assert.Equal(t, int64(15*60), sut.Weekdays[time.Monday][9])
+	assert.Equal(t, int64(15*60), sut.Weekdays[time.Monday][10])
+	assert.Equal(t, "Europe/Berlin", sut.Timezone)
+}
+
+func TestHourlyActivity_Add_AcrossMidnight(t *testing.T) {
+	sut := NewHourlyActivity(time.Time{}, time.Time{}, time.UTC, true)
+
+	// sunday 23:30 to monday 00:10
+	sut.Add(time.Date(2024, 1, 7, 23, 30, 0, 0, time.UTC), 40*time.Minute, time.UTC)
+
+	assert.Equal(t, int64(30*60), sut.Weekdays[time.Sunday][23])
+	assert.Equal(t, int64(10*60), sut.Weekdays[time.Monday][0])
+	assert.Equal(t, int64(30*60), sut.Hours[23])
+	assert.Equal(t, int64(10*60), sut.Hours[0])
+}
+
+func TestHourlyActivity_Add_HalfHourOffset(t *testing.T) {
+	tz, _ := time.LoadLocation("Asia/Kolkata") // utc+05:30
+	sut := NewHourlyActivity(time.Time{}, time.Time{}, tz, false)
+
+	// 10:50 to 11:10 local time
+	sut.Add(time.Date(2024, 1, 1, 5, 20, 0, 0, time.UTC), 20*time.Minute, tz)
+
+	assert.Equal(t, int64(10*60), sut.Hours[10])
+	assert.Equal(t, int64(10*60), sut.Hours[11])
+	assert.Nil(t, sut.Weekdays)
+}
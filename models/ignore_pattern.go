@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/becheran/wildmatch-go"
+)
+
+const (
+	ignorePrefixProject = "project:"
+	ignorePrefixEntity  = "entity:"
+	ignorePrefixRegex   = "regex:"
+)
+
+const (
+	MaxIgnorePatterns      = 100
+	MaxIgnorePatternLength = 256
+	// upper bound for evaluating regular expressions per request, go's regexp engine guarantees linear time, but with lots of patterns and heartbeats, this still adds up
+	IgnoreRegexTimeout = 100 * time.Millisecond
+)
+
+// IgnorePattern causes heartbeats to be dropped at ingest time.
+// Syntax (one pattern per line): [project:|entity:][regex:]<pattern>, where patterns are globs (* and ?) unless prefixed with "regex:".
+// Patterns without a field prefix are matched against the entity (e.g. file path). Lines starting with # are comments.
+type IgnorePattern struct {
+	Raw      string
+	Field    uint8 // SummaryProject or SummaryEntity
+	wildcard *wildmatch.WildMatch
+	regex    *regexp.Regexp
+}
+
+type IgnorePatterns []*IgnorePattern
+
+func ParseIgnorePatterns(text string) (IgnorePatterns, error) {
+	patterns := make(IgnorePatterns, 0)
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(line) > MaxIgnorePatternLength {
+			return nil, fmt.Errorf("pattern in line %d exceeds %d characters", i+1, MaxIgnorePatternLength)
+		}
+
+		pattern, err := parseIgnorePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in line %d: %v", i+1, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	if len(patterns) > MaxIgnorePatterns {
+		return nil, fmt.Errorf("at most %d patterns allowed", MaxIgnorePatterns)
+	}
+
+	return patterns, nil
+}
+
+func parseIgnorePattern(line string) (*IgnorePattern, error) {
+	pattern := &IgnorePattern{Raw: line, Field: SummaryEntity}
+
+	if strings.HasPrefix(line, ignorePrefixProject) {
+		pattern.Field = SummaryProject
+		line = strings.TrimPrefix(line, ignorePrefixProject)
+	} else if strings.HasPrefix(line, ignorePrefixEntity) {
+		line = strings.TrimPrefix(line, ignorePrefixEntity)
+	}
+
+	if strings.HasPrefix(line, ignorePrefixRegex) {
+		re, err := regexp.Compile(strings.TrimPrefix(line, ignorePrefixRegex))
+		if err != nil {
+			return nil, err
+		}
+		pattern.regex = re
+		return pattern, nil
+	}
+
+	if line == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	pattern.wildcard = wildmatch.NewWildMatch(line)
+	return pattern, nil
+}
+
+func (p *IgnorePattern) IsRegex() bool {
+	return p.regex != nil
+}
+
+func (p *IgnorePattern) Matches(heartbeat *Heartbeat) bool {
+	value := heartbeat.Entity
+	if p.Field == SummaryProject {
+		value = heartbeat.Project
+	}
+
+	if p.regex != nil {
+		return p.regex.MatchString(value)
+	}
+	return p.wildcard.IsMatch(value)
+}
+
+// Matches checks whether any pattern applies to the given heartbeat.
+// Once the deadline has passed, regular expressions are skipped (in favor of rather keeping a heartbeat than wrongly dropping it).
+func (p IgnorePatterns) Matches(heartbeat *Heartbeat, deadline time.Time) bool {
+	for _, pattern := range p {
+		if pattern.IsRegex() && time.Now().After(deadline) {
+			continue
+		}
+		if pattern.Matches(heartbeat) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIgnorePatterns(t *testing.T) {
+	patterns, err := ParseIgnorePatterns("# comment\n*/node_modules/*\n\nproject:scratch*\nregex:\\.tmp$\nproject:regex:^test-\\d+$\n")
+	assert.Nil(t, err)
+	assert.Len(t, patterns, 4)
+	assert.Equal(t, SummaryEntity, patterns[0].Field)
+	assert.Equal(t, SummaryProject, patterns[1].Field)
+	assert.True(t, patterns[2].IsRegex())
+	assert.True(t, patterns[3].IsRegex())
+	assert.Equal(t, SummaryProject, patterns[3].Field)
+
+	_, err = ParseIgnorePatterns("regex:(unclosed")
+	assert.ErrorContains(t, err, "line 1")
+
+	_, err = ParseIgnorePatterns("project:")
+	assert.NotNil(t, err)
+}
+
+func TestIgnorePatterns_Matches(t *testing.T) {
+	patterns, _ := ParseIgnorePatterns("*/node_modules/*\nproject:scratch*\nregex:\\.tmp$\nproject:regex:^test-\\d+$")
+	deadline := time.Now().Add(time.Minute)
+
+	testCases := []struct {
+		heartbeat *Heartbeat
+		expected  bool
+	}{
+		{&Heartbeat{Entity: "/home/user/wakapi/node_modules/lodash/index.js", Project: "wakapi"}, true},
+		{&Heartbeat{Entity: "/home/user/wakapi/main.go", Project: "wakapi"}, false},
+		{&Heartbeat{Entity: "/home/user/scratchpad/main.go", Project: "scratchpad"}, true},
+		{&Heartbeat{Entity: "/home/user/wakapi/scratch.go", Project: "wakapi"}, false},
+		{&Heartbeat{Entity: "/tmp/foo.tmp", Project: ""}, true},
+		{&Heartbeat{Entity: "/home/user/test-42/main.go", Project: "test-42"}, true},
+		{&Heartbeat{Entity: "/home/user/test-42a/main.go", Project: "test-42a"}, false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, patterns.Matches(tc.heartbeat, deadline), tc.heartbeat.Entity)
+	}
+
+	// regular expressions are skipped once the deadline has passed
+	assert.False(t, patterns.Matches(&Heartbeat{Entity: "/tmp/foo.tmp"}, time.Now().Add(-time.Second)))
+	assert.True(t, patterns.Matches(&Heartbeat{Entity: "/a/node_modules/b"}, time.Now().Add(-time.Second)))
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// ImpersonationMaxDuration is the time after which an impersonation ends automatically
+const ImpersonationMaxDuration = 30 * time.Minute
+
+// Impersonation lets an admin see wakapi through the eyes of another user for support purposes, read-only and for a limited time
+type Impersonation struct {
+	AdminID   string    `json:"admin_id"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewImpersonation(admin, user *User) *Impersonation {
+	return &Impersonation{
+		AdminID:   admin.ID,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(ImpersonationMaxDuration),
+	}
+}
+
+func (i *Impersonation) IsExpired() bool {
+	return !time.Now().Before(i.ExpiresAt)
+}
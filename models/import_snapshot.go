@@ -0,0 +1,103 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// ImportSnapshot captures a user's coding time totals right before a data import (keyed by the import job's id), to later compare them against the totals after the import
+type ImportSnapshot struct {
+	ID         string        `json:"id"`
+	UserID     string        `json:"user_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Before     *ImportTotals `json:"before"`
+	After      *ImportTotals `json:"after,omitempty"`
+}
+
+// ImportTotals holds total coding time in seconds per project and per language
+type ImportTotals struct {
+	Projects  map[string]int64 `json:"projects"`
+	Languages map[string]int64 `json:"languages"`
+}
+
+type ImportDiff struct {
+	ID         string            `json:"id"`
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	Finished   bool              `json:"finished"`
+	Added      int64             `json:"added"` // in seconds
+	Projects   []*ImportDiffItem `json:"projects"`
+	Languages  []*ImportDiffItem `json:"languages"`
+}
+
+type ImportDiffItem struct {
+	Key    string `json:"key"`
+	Before int64  `json:"before"` // in seconds
+	After  int64  `json:"after"`  // in seconds
+	Added  int64  `json:"added"`  // in seconds
+}
+
+func NewImportTotals(summary *Summary) *ImportTotals {
+	totals := &ImportTotals{
+		Projects:  make(map[string]int64, len(summary.Projects)),
+		Languages: make(map[string]int64, len(summary.Languages)),
+	}
+	for _, item := range summary.Projects {
+		totals.Projects[item.Key] += int64(item.TotalFixed().Seconds())
+	}
+	for _, item := range summary.Languages {
+		totals.Languages[item.Key] += int64(item.TotalFixed().Seconds())
+	}
+	return totals
+}
+
+func (t *ImportTotals) Total() (total int64) {
+	for _, v := range t.Projects {
+		total += v
+	}
+	return total
+}
+
+// Diff compares the totals before and after the import, only including projects and languages whose time changed, sorted by added time.
+// Diffs of imports that haven't finished yet are empty.
+func (s *ImportSnapshot) Diff() *ImportDiff {
+	diff := &ImportDiff{
+		ID:         s.ID,
+		CreatedAt:  s.CreatedAt,
+		FinishedAt: s.FinishedAt,
+		Finished:   s.After != nil,
+		Projects:   []*ImportDiffItem{},
+		Languages:  []*ImportDiffItem{},
+	}
+	if s.Before == nil || s.After == nil {
+		return diff
+	}
+
+	diff.Added = s.After.Total() - s.Before.Total()
+	diff.Projects = diffImportTotals(s.Before.Projects, s.After.Projects)
+	diff.Languages = diffImportTotals(s.Before.Languages, s.After.Languages)
+	return diff
+}
+
+func diffImportTotals(before, after map[string]int64) []*ImportDiffItem {
+	items := make([]*ImportDiffItem, 0)
+	for key, v := range after {
+		if v != before[key] {
+			items = append(items, &ImportDiffItem{Key: key, Before: before[key], After: v, Added: v - before[key]})
+		}
+	}
+	for key, v := range before {
+		if _, ok := after[key]; !ok && v != 0 {
+			items = append(items, &ImportDiffItem{Key: key, Before: v, Added: -v})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Added == items[j].Added {
+			return items[i].Key < items[j].Key
+		}
+		return items[i].Added > items[j].Added
+	})
+	return items
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportSnapshot_Diff(t *testing.T) {
+	snapshot := &ImportSnapshot{
+		ID: "test",
+		Before: &ImportTotals{
+			Projects:  map[string]int64{"wakapi": 600, "anchr": 300, "legacy": 120},
+			Languages: map[string]int64{"Go": 1020},
+		},
+	}
+
+	diff := snapshot.Diff()
+	assert.False(t, diff.Finished)
+	assert.Empty(t, diff.Projects)
+
+	snapshot.After = &ImportTotals{
+		Projects:  map[string]int64{"wakapi": 1200, "anchr": 300, "telepush": 60},
+		Languages: map[string]int64{"Go": 1500, "Python": 60},
+	}
+
+	diff = snapshot.Diff()
+	assert.True(t, diff.Finished)
+	assert.Equal(t, int64(1560-1020), diff.Added)
+	assert.Equal(t, []*ImportDiffItem{
+		{Key: "wakapi", Before: 600, After: 1200, Added: 600},
+		{Key: "telepush", Before: 0, After: 60, Added: 60},
+		{Key: "legacy", Before: 120, After: 0, Added: -120}, // e.g. renamed through an alias in the meantime
+	}, diff.Projects)
+	assert.Equal(t, []*ImportDiffItem{
+		{Key: "Go", Before: 1020, After: 1500, Added: 480},
+		{Key: "Python", Before: 0, After: 60, Added: 60},
+	}, diff.Languages)
+}
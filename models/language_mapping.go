@@ -1,5 +1,7 @@
 package models
 
+import "strings"
+
 type LanguageMapping struct {
 	ID        uint   `json:"id" gorm:"primary_key"`
 	User      *User  `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
@@ -19,3 +21,75 @@ func (m *LanguageMapping) validateLanguage() bool {
 func (m *LanguageMapping) validateExtension() bool {
 	return len(m.Extension) >= 1
 }
+
+// DefaultLanguageMappings are common file extensions and their languages, by which heartbeats' languages are detected upon ingest (see Heartbeat.DetectLanguage).
+// They are overridden by the server's custom_languages and the user's own mappings.
+var DefaultLanguageMappings = map[string]string{
+	"go":     "Go",
+	"py":     "Python",
+	"ipynb":  "Python",
+	"js":     "JavaScript",
+	"mjs":    "JavaScript",
+	"cjs":    "JavaScript",
+	"jsx":    "JSX",
+	"ts":     "TypeScript",
+	"mts":    "TypeScript",
+	"tsx":    "TSX",
+	"java":   "Java",
+	"kt":     "Kotlin",
+	"kts":    "Kotlin",
+	"rs":     "Rust",
+	"rb":     "Ruby",
+	"php":    "PHP",
+	"c":      "C",
+	"h":      "C",
+	"cpp":    "C++",
+	"cc":     "C++",
+	"hpp":    "C++",
+	"cs":     "C#",
+	"swift":  "Swift",
+	"scala":  "Scala",
+	"dart":   "Dart",
+	"lua":    "Lua",
+	"r":      "R",
+	"ex":     "Elixir",
+	"exs":    "Elixir",
+	"erl":    "Erlang",
+	"hs":     "Haskell",
+	"clj":    "Clojure",
+	"ml":     "OCaml",
+	"sh":     "Bash",
+	"bash":   "Bash",
+	"zsh":    "Zsh",
+	"ps1":    "PowerShell",
+	"sql":    "SQL",
+	"html":   "HTML",
+	"htm":    "HTML",
+	"css":    "CSS",
+	"scss":   "SCSS",
+	"sass":   "Sass",
+	"less":   "Less",
+	"vue":    "Vue",
+	"svelte": "Svelte",
+	"astro":  "Astro",
+	"json":   "JSON",
+	"yaml":   "YAML",
+	"yml":    "YAML",
+	"toml":   "TOML",
+	"xml":    "XML",
+	"md":     "Markdown",
+	"tf":     "HCL",
+}
+
+// LanguageByExtension returns the language of the most specific of the mappings matching the file name's extension (e.g. 'd.ts' takes precedence over 'ts'), or an empty string, if none does.
+// Extensions are compared case-insensitively and expected to be lower case.
+func LanguageByExtension(fileName string, mappings map[string]string) string {
+	fileName = strings.ToLower(fileName)
+	language, maxPrec := "", -1
+	for ending, value := range mappings {
+		if ok, prec := strings.HasSuffix(fileName, "."+ending), strings.Count(ending, "."); ok && prec > maxPrec {
+			language, maxPrec = value, prec
+		}
+	}
+	return language
+}
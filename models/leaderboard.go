@@ -22,7 +22,16 @@ type LeaderboardItem struct {
 // https://github.com/go-gorm/gorm/issues/5284#issuecomment-1107775806
 type LeaderboardItemRanked struct {
 	LeaderboardItem
-	Rank uint
+	Rank         uint
+	Participants uint // number of users with any coding time within the same ranking
+}
+
+// Percentile returns the share of participants ranked the same or better, in percent, e.g. 5 for being among the top 5 %
+func (l *LeaderboardItemRanked) Percentile() float64 {
+	if l.Participants == 0 || l.Rank > l.Participants {
+		return 100
+	}
+	return float64((l.Rank*1000+l.Participants-1)/l.Participants) / 10 // rounded up to one decimal
 }
 
 func (l1 *LeaderboardItemRanked) Equals(l2 *LeaderboardItemRanked) bool {
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaderboardItemRanked_Percentile(t *testing.T) {
+	assert.Equal(t, 0.1, (&LeaderboardItemRanked{Rank: 1, Participants: 1000}).Percentile())
+	assert.Equal(t, 33.4, (&LeaderboardItemRanked{Rank: 1, Participants: 3}).Percentile()) // rounded up, never claiming a better position
+	assert.Equal(t, 50.0, (&LeaderboardItemRanked{Rank: 2, Participants: 4}).Percentile())
+	assert.Equal(t, 100.0, (&LeaderboardItemRanked{Rank: 4, Participants: 4}).Percentile())
+	assert.Equal(t, 100.0, (&LeaderboardItemRanked{Rank: 5, Participants: 4}).Percentile()) // e.g. entries without any coding time
+	assert.Equal(t, 100.0, (&LeaderboardItemRanked{Rank: 1}).Percentile())
+}
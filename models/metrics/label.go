@@ -5,6 +5,9 @@ import (
 	"strings"
 )
 
+// label values may contain arbitrary user-defined strings (e.g. project names)
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
 type Labels []Label
 
 type Label struct {
@@ -24,5 +27,5 @@ func (l Labels) Print() string {
 }
 
 func (l Label) Print() string {
-	return fmt.Sprintf("%s=\"%s\"", l.Key, l.Value)
+	return fmt.Sprintf("%s=\"%s\"", l.Key, labelValueEscaper.Replace(l.Value))
 }
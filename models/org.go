@@ -0,0 +1,42 @@
+package models
+
+import "regexp"
+
+const MaxOrgNameLength = 255
+
+var orgIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,63}$`)
+
+// Org is a tenant in multi-tenant mode (see app.orgs_enabled). Users belong to at most one org, whose admins manage its members and see org-scoped leaderboards and reports.
+// Org admins can't see or act on anything outside their org, while super admins (User.IsAdmin) still see everything.
+type Org struct {
+	ID        string     `json:"id" gorm:"primary_key"`
+	Name      string     `json:"name"`
+	CreatedAt CustomTime `json:"created_at" gorm:"default:CURRENT_TIMESTAMP" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+}
+
+// OrgMember is an org's member as shown to its admins, deliberately not exposing any credentials
+type OrgMember struct {
+	UserID    string     `json:"user_id"`
+	Email     string     `json:"email"`
+	OrgAdmin  bool       `json:"org_admin"`
+	CreatedAt CustomTime `json:"created_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+}
+
+// OrgReportItem is a member's total coding time within the report's interval
+type OrgReportItem struct {
+	UserID string `json:"user_id"`
+	Total  int64  `json:"total"` // in seconds
+}
+
+func NewOrgMember(user *User) *OrgMember {
+	return &OrgMember{
+		UserID:    user.ID,
+		Email:     user.Email,
+		OrgAdmin:  user.OrgAdmin,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func (o *Org) IsValid() bool {
+	return orgIdPattern.MatchString(o.ID) && o.Name != "" && len(o.Name) <= MaxOrgNameLength
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrg_IsValid(t *testing.T) {
+	assert.True(t, (&Org{ID: "acme", Name: "ACME Corp."}).IsValid())
+	assert.True(t, (&Org{ID: "acme-dev_2", Name: "ACME Corp."}).IsValid())
+	assert.False(t, (&Org{ID: "acme", Name: ""}).IsValid())
+	assert.False(t, (&Org{ID: "a", Name: "ACME Corp."}).IsValid())
+	assert.False(t, (&Org{ID: "ACME", Name: "ACME Corp."}).IsValid())
+	assert.False(t, (&Org{ID: "-acme", Name: "ACME Corp."}).IsValid())
+	assert.False(t, (&Org{ID: "acme corp", Name: "ACME Corp."}).IsValid())
+	assert.False(t, (&Org{ID: strings.Repeat("a", 65), Name: "ACME Corp."}).IsValid())
+	assert.False(t, (&Org{ID: "acme", Name: strings.Repeat("a", MaxOrgNameLength+1)}).IsValid())
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/data"
+)
+
+var (
+	commonPasswords     map[string]bool
+	commonPasswordsOnce sync.Once
+)
+
+// ValidatePasswordPolicy checks a new password against the server's password policy, which is disabled by default, and describes the first violated rule.
+// It is meant to be called on the plaintext password before hashing it, the password itself is never included in the error.
+func ValidatePasswordPolicy(password string) error {
+	policy := conf.Get().Security
+
+	if utf8.RuneCountInString(password) < policy.PasswordMinLength {
+		return fmt.Errorf("password must be at least %d characters long", policy.PasswordMinLength)
+	}
+	if countCharClasses(password) < policy.PasswordCharClasses {
+		return fmt.Errorf("password must contain at least %d of the following: lower case letters, upper case letters, digits and special characters", policy.PasswordCharClasses)
+	}
+	if policy.PasswordBlockCommon && isCommonPassword(password) {
+		return errors.New("password is too common, please choose a different one")
+	}
+	return nil
+}
+
+func countCharClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+func isCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = make(map[string]bool)
+		scanner := bufio.NewScanner(bytes.NewReader(data.CommonPasswordsFile))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				commonPasswords[strings.ToLower(line)] = true
+			}
+		}
+	})
+	return commonPasswords[strings.ToLower(password)]
+}
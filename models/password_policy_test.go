@@ -0,0 +1,32 @@
+package models
+
+import (
+	"testing"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePasswordPolicy(t *testing.T) {
+	cfg := conf.Empty()
+	conf.Set(cfg)
+
+	assert.Nil(t, ValidatePasswordPolicy("123456"), "policy must be disabled by default")
+
+	cfg.Security.PasswordMinLength = 10
+	assert.EqualError(t, ValidatePasswordPolicy("abcdefghi"), "password must be at least 10 characters long")
+	assert.Nil(t, ValidatePasswordPolicy("abcdefghij"))
+	assert.Nil(t, ValidatePasswordPolicy("äöüäöüäöüä"), "length is counted in characters, not bytes")
+
+	cfg.Security.PasswordCharClasses = 3
+	assert.ErrorContains(t, ValidatePasswordPolicy("abcdefghij"), "at least 3 of the following")
+	assert.ErrorContains(t, ValidatePasswordPolicy("abcdefghij12"), "at least 3 of the following")
+	assert.Nil(t, ValidatePasswordPolicy("Abcdefghij12"))
+	assert.Nil(t, ValidatePasswordPolicy("abcdefghij1!"))
+
+	cfg.Security.PasswordMinLength = 0
+	cfg.Security.PasswordCharClasses = 0
+	cfg.Security.PasswordBlockCommon = true
+	assert.EqualError(t, ValidatePasswordPolicy("Password123"), "password is too common, please choose a different one")
+	assert.Nil(t, ValidatePasswordPolicy("correct horse battery staple"))
+}
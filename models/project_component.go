@@ -0,0 +1,51 @@
+package models
+
+import "strings"
+
+const MaxProjectComponentRulesPerUser = 100
+
+// ProjectComponentRule derives a component (e.g. of a monorepo) from the paths of the files worked on within a project, without having to split up the project itself
+type ProjectComponentRule struct {
+	ID         uint   `json:"id" gorm:"primary_key"`
+	User       *User  `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID     string `json:"-" gorm:"not null; index:idx_project_component_rule_user"`
+	Project    string `json:"project" gorm:"not null; size:255"`
+	PathPrefix string `json:"path_prefix" gorm:"not null; size:255"`
+	Label      string `json:"label" gorm:"not null; type:varchar(64)"`
+}
+
+func (r *ProjectComponentRule) IsValid() bool {
+	return r.UserID != "" &&
+		r.Project != "" &&
+		normalizeComponentPath(r.PathPrefix) != "/" &&
+		r.Label != "" &&
+		len(r.Label) <= 64
+}
+
+// Matches checks whether the entity's path contains the rule's prefix as a sequence of entire path segments.
+// As the project's root directory is not known, prefixes are relative to any directory, e.g. 'services/api' matches '/home/john/dev/monorepo/services/api/main.go'.
+func (r *ProjectComponentRule) Matches(entity string) bool {
+	return strings.Contains(normalizeComponentPath(entity), normalizeComponentPath(r.PathPrefix))
+}
+
+// ResolveProjectComponent returns the label of the most specific, i.e. longest, of the given rules matching the entity, or an empty string if none matches
+func ResolveProjectComponent(rules []*ProjectComponentRule, entity string) string {
+	var match *ProjectComponentRule
+	for _, r := range rules {
+		if r.Matches(entity) && (match == nil || len(normalizeComponentPath(r.PathPrefix)) > len(normalizeComponentPath(match.PathPrefix))) {
+			match = r
+		}
+	}
+	if match == nil {
+		return ""
+	}
+	return match.Label
+}
+
+func normalizeComponentPath(path string) string {
+	path = strings.Trim(strings.ReplaceAll(strings.TrimSpace(path), "\\", "/"), "/")
+	if path == "" {
+		return "/"
+	}
+	return "/" + path + "/"
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectComponentRule_Matches(t *testing.T) {
+	rule := &ProjectComponentRule{PathPrefix: "services/api"}
+
+	assert.True(t, rule.Matches("/home/john/dev/monorepo/services/api/main.go"))
+	assert.True(t, rule.Matches("C:\\dev\\monorepo\\services\\api\\main.go"))
+	assert.True(t, rule.Matches("services/api/main.go"))
+	assert.False(t, rule.Matches("/home/john/dev/monorepo/services/api-gateway/main.go"))
+	assert.False(t, rule.Matches("/home/john/dev/monorepo/myservices/api/main.go"))
+	assert.False(t, rule.Matches("/home/john/dev/monorepo/web/index.ts"))
+}
+
+func TestProjectComponentRule_IsValid(t *testing.T) {
+	assert.True(t, (&ProjectComponentRule{UserID: "john", Project: "monorepo", PathPrefix: "web", Label: "frontend"}).IsValid())
+	assert.False(t, (&ProjectComponentRule{UserID: "john", Project: "monorepo", PathPrefix: " / ", Label: "frontend"}).IsValid())
+	assert.False(t, (&ProjectComponentRule{UserID: "john", Project: "monorepo", PathPrefix: "web"}).IsValid())
+	assert.False(t, (&ProjectComponentRule{UserID: "john", PathPrefix: "web", Label: "frontend"}).IsValid())
+}
+
+func TestResolveProjectComponent(t *testing.T) {
+	rules := []*ProjectComponentRule{
+		{PathPrefix: "services/api/v2", Label: "api-v2"},
+		{PathPrefix: "services/api", Label: "api"},
+	}
+
+	assert.Equal(t, "api", ResolveProjectComponent(rules, "/monorepo/services/api/main.go"))
+	assert.Equal(t, "api-v2", ResolveProjectComponent(rules, "/monorepo/services/api/v2/main.go"))
+	assert.Equal(t, "", ResolveProjectComponent(rules, "/monorepo/go.mod"))
+}
@@ -0,0 +1,14 @@
+package models
+
+// ProjectDefaultBranch holds the branch a user's project falls back to for heartbeats without a meaningful branch name (e.g. 'HEAD' on a detached checkout, see unknown_branch_pattern)
+type ProjectDefaultBranch struct {
+	ID      uint   `json:"-" gorm:"primary_key"`
+	User    *User  `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID  string `json:"-" gorm:"not null; uniqueIndex:idx_project_default_branch_user_project"`
+	Project string `json:"project" gorm:"not null; size:255; uniqueIndex:idx_project_default_branch_user_project"`
+	Branch  string `json:"branch" gorm:"not null; size:255"`
+}
+
+func (b *ProjectDefaultBranch) IsValid() bool {
+	return b.UserID != "" && b.Project != "" && b.Branch != ""
+}
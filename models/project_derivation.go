@@ -0,0 +1,36 @@
+package models
+
+import "strings"
+
+const MaxProjectDerivationRootLength = 255
+
+// ProjectDerivation infers the project of file heartbeats sent without one (e.g. by editors that can't detect projects) from the entity's path.
+// For instance, with root "/home/user/dev" and segment 1, "/home/user/dev/wakapi/main.go" is attributed to project "wakapi".
+// Explicitly provided project names are never overridden. Paths are matched with forward slashes, so the same root applies to Windows paths, too.
+type ProjectDerivation struct {
+	Root    string // path prefix below which projects are located
+	Segment int    // which folder below root to use as project name, starting at 1
+}
+
+func (d ProjectDerivation) IsEmpty() bool {
+	return strings.Trim(d.Root, `/\`) == ""
+}
+
+func (d ProjectDerivation) Apply(project, entity, entityType string) string {
+	if project != "" || entityType != "file" || d.IsEmpty() {
+		return project
+	}
+
+	root := strings.TrimRight(strings.ReplaceAll(d.Root, `\`, "/"), "/") + "/"
+	path := strings.ReplaceAll(entity, `\`, "/")
+	if !strings.HasPrefix(path, root) {
+		return project
+	}
+
+	// last segment is the file itself, which doesn't qualify as project
+	segments := strings.Split(strings.TrimPrefix(path, root), "/")
+	if segment := max(d.Segment, 1); segment < len(segments) && segments[segment-1] != "" {
+		return segments[segment-1]
+	}
+	return project
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectDerivation_Apply(t *testing.T) {
+	sut := ProjectDerivation{Root: "/home/user/dev", Segment: 1}
+
+	assert.True(t, ProjectDerivation{}.IsEmpty())
+	assert.True(t, ProjectDerivation{Root: "/"}.IsEmpty())
+	assert.Equal(t, "", ProjectDerivation{}.Apply("", "/home/user/dev/wakapi/main.go", "file"))
+
+	assert.Equal(t, "wakapi", sut.Apply("", "/home/user/dev/wakapi/main.go", "file"))
+	assert.Equal(t, "wakapi", sut.Apply("", "/home/user/dev/wakapi/routes/api/heartbeat.go", "file"))
+	assert.Equal(t, "wakapi", ProjectDerivation{Root: "/home/user/dev/", Segment: 0}.Apply("", "/home/user/dev/wakapi/main.go", "file"))
+	assert.Equal(t, "routes", ProjectDerivation{Root: "/home/user/dev", Segment: 2}.Apply("", "/home/user/dev/wakapi/routes/api/heartbeat.go", "file"))
+	assert.Equal(t, "wakapi", ProjectDerivation{Root: `C:\Users\user\dev`, Segment: 1}.Apply("", `C:\Users\user\dev\wakapi\main.go`, "file"))
+
+	// explicit project names are kept
+	assert.Equal(t, "other", sut.Apply("other", "/home/user/dev/wakapi/main.go", "file"))
+
+	// no matching folder
+	assert.Equal(t, "", sut.Apply("", "/home/user/dev/notes.md", "file"))
+	assert.Equal(t, "", sut.Apply("", "/home/user/development/wakapi/main.go", "file"))
+	assert.Equal(t, "", sut.Apply("", "/tmp/wakapi/main.go", "file"))
+	assert.Equal(t, "", ProjectDerivation{Root: "/home/user/dev", Segment: 3}.Apply("", "/home/user/dev/wakapi/main.go", "file"))
+	assert.Equal(t, "", sut.Apply("", "/home/user/dev//main.go", "file"))
+
+	// only applies to files
+	assert.Equal(t, "", sut.Apply("", "/home/user/dev/wakapi", "app"))
+}
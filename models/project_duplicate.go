@@ -0,0 +1,84 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/muety/wakapi/utils"
+)
+
+const (
+	ProjectDuplicateCase       = "case"       // names differing in case, surrounding whitespace or trailing slashes only
+	ProjectDuplicateSeparators = "separators" // additionally differing in separators, e.g. "my-app" and "my_app"
+	ProjectDuplicateSuffix     = "suffix"     // additionally differing in a branch-like suffix, e.g. "wakapi" and "wakapi-main"
+	ProjectDuplicateSimilar    = "similar"    // fuzzy match, e.g. a typo
+
+	projectDuplicateMinFuzzyLength = 4 // fuzzy matching of very short names yields too many false positives
+)
+
+var (
+	projectSeparatorsReplacer = strings.NewReplacer("-", "", "_", "", ".", "", " ", "")
+	projectSuffixPattern      = regexp.MustCompile(`([-_. ](main|master|develop|dev|git))+$`)
+)
+
+// ProjectDuplicate is a suggestion to merge one project into another (by creating a project alias), because their names likely refer to the same project
+type ProjectDuplicate struct {
+	Project    string  `json:"project"`    // suggested alias target
+	Duplicate  string  `json:"duplicate"`  // suggested to be aliased to project
+	Confidence float64 `json:"confidence"` // between 0 and 1
+	Reason     string  `json:"reason"`     // one of case, separators, suffix or similar
+}
+
+// NewProjectDuplicate compares two project names in several steps of increasingly lenient normalization, with decreasing confidence.
+// The shorter name (or, if equally long, the lexicographically smaller one) is suggested as alias target. Returns nil for equal names and names too short to be compared fuzzily.
+func NewProjectDuplicate(a, b string) *ProjectDuplicate {
+	if a == b {
+		return nil
+	}
+	if len(b) < len(a) || (len(a) == len(b) && b < a) {
+		a, b = b, a
+	}
+
+	duplicate := &ProjectDuplicate{Project: a, Duplicate: b}
+
+	caseA, sepA, suffixA := normalizeProject(a)
+	caseB, sepB, suffixB := normalizeProject(b)
+
+	switch {
+	case caseA == caseB:
+		duplicate.Confidence, duplicate.Reason = 1, ProjectDuplicateCase
+	case sepA == sepB && sepA != "":
+		duplicate.Confidence, duplicate.Reason = 0.95, ProjectDuplicateSeparators
+	case suffixA == suffixB && suffixA != "":
+		duplicate.Confidence, duplicate.Reason = 0.9, ProjectDuplicateSuffix
+	case min(len([]rune(suffixA)), len([]rune(suffixB))) >= projectDuplicateMinFuzzyLength:
+		// scaled, so that fuzzy matches always rank below the exact ones
+		duplicate.Confidence, duplicate.Reason = 0.9*utils.Similarity(suffixA, suffixB), ProjectDuplicateSimilar
+	default:
+		return nil
+	}
+
+	return duplicate
+}
+
+// ProjectDuplicateKeys returns the normalized names by which exact (i.e. non-fuzzy) duplicates of the project can be found, without comparing it to every other project.
+// Two names are exact duplicates only if they share at least one key.
+func ProjectDuplicateKeys(project string) []string {
+	caseKey, sep, suffix := normalizeProject(project)
+	keys := []string{"case:" + caseKey}
+	if sep != "" {
+		keys = append(keys, "separators:"+sep)
+	}
+	if suffix != "" {
+		keys = append(keys, "suffix:"+suffix)
+	}
+	return keys
+}
+
+// normalizeProject returns the project name in increasingly lenient normalizations (see NewProjectDuplicate)
+func normalizeProject(project string) (caseKey, sepKey, suffixKey string) {
+	caseKey = strings.ToLower(strings.TrimRight(strings.TrimSpace(project), `/\`))
+	sepKey = projectSeparatorsReplacer.Replace(caseKey)
+	suffixKey = projectSeparatorsReplacer.Replace(projectSuffixPattern.ReplaceAllString(caseKey, ""))
+	return caseKey, sepKey, suffixKey
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProjectDuplicate(t *testing.T) {
+	testCases := []struct {
+		a, b       string
+		project    string
+		duplicate  string
+		confidence float64
+		reason     string
+	}{
+		{"wakapi", "Wakapi", "Wakapi", "wakapi", 1, ProjectDuplicateCase},
+		{"wakapi", "wakapi/ ", "wakapi", "wakapi/ ", 1, ProjectDuplicateCase},
+		{"my_app", "My-App", "My-App", "my_app", 0.95, ProjectDuplicateSeparators},
+		{"wakapi-main", "wakapi", "wakapi", "wakapi-main", 0.9, ProjectDuplicateSuffix},
+		{"Wakapi_Master", "wakapi", "wakapi", "Wakapi_Master", 0.9, ProjectDuplicateSuffix},
+		{"wakapi", "wakapy", "wakapi", "wakapy", 0.75, ProjectDuplicateSimilar},
+	}
+
+	for _, tc := range testCases {
+		result := NewProjectDuplicate(tc.a, tc.b)
+		if assert.NotNil(t, result, tc.a) {
+			assert.Equal(t, tc.project, result.Project, tc.a)
+			assert.Equal(t, tc.duplicate, result.Duplicate, tc.a)
+			assert.InDelta(t, tc.confidence, result.Confidence, 0.001, tc.a)
+			assert.Equal(t, tc.reason, result.Reason, tc.a)
+		}
+	}
+
+	// order of arguments doesn't matter
+	assert.Equal(t, NewProjectDuplicate("wakapi", "wakapi-main"), NewProjectDuplicate("wakapi-main", "wakapi"))
+
+	assert.Nil(t, NewProjectDuplicate("wakapi", "wakapi"))
+	assert.Nil(t, NewProjectDuplicate("api", "app")) // too short for fuzzy matching
+	assert.Less(t, NewProjectDuplicate("main", "master").Confidence, 0.5)
+	assert.Less(t, NewProjectDuplicate("wakapi", "anchr").Confidence, 0.5)
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxProjectIconLength        = 8 // runes, as emojis may consist of several code points (e.g. including skin tone modifiers or zero width joiners)
+	MaxProjectDescriptionLength = 255
+	MaxProjectHourlyRate        = 1_000_000
+)
+
+var (
+	projectColorRegex    = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	projectCurrencyRegex = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// ProjectMetadata holds optional information on a user's project, mostly presentational (e.g. to be rendered by dashboards), and its visibility
+type ProjectMetadata struct {
+	ID             uint    `json:"-" gorm:"primary_key"`
+	User           *User   `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID         string  `json:"-" gorm:"not null; uniqueIndex:idx_project_metadata_user_project"`
+	Project        string  `json:"project" gorm:"not null; size:255; uniqueIndex:idx_project_metadata_user_project"`
+	Color          string  `json:"color,omitempty" gorm:"size:7"`
+	Icon           string  `json:"icon,omitempty" gorm:"size:64"`
+	Description    string  `json:"description,omitempty" gorm:"size:1024"`
+	Private        bool    `json:"private,omitempty" gorm:"default:false; type:bool"`         // shown as pseudonym to others, even if the user shares projects in general
+	HourlyRate     float64 `json:"hourly_rate,omitempty"`                                     // for billing reports, 0 if not billable
+	Currency       string  `json:"currency,omitempty" gorm:"size:3"`                          // iso 4217 code of the hourly rate, e.g. 'EUR'
+	NotifyActivity bool    `json:"notify_activity,omitempty" gorm:"default:false; type:bool"` // whether to send project.started and project.stopped webhook events for the project
+}
+
+func (m *ProjectMetadata) IsValid() bool {
+	return m.UserID != "" &&
+		m.Project != "" &&
+		m.validateColor() &&
+		m.validateIcon() &&
+		m.validateRate() &&
+		utf8.RuneCountInString(m.Description) <= MaxProjectDescriptionLength
+}
+
+func (m *ProjectMetadata) IsEmpty() bool {
+	return m.Color == "" && m.Icon == "" && m.Description == "" && !m.Private && m.HourlyRate == 0 && m.Currency == "" && !m.NotifyActivity
+}
+
+// IsBillable tells whether time spent on the project can be billed, i.e. whether it has an hourly rate
+func (m *ProjectMetadata) IsBillable() bool {
+	return m.HourlyRate > 0 && m.Currency != ""
+}
+
+func (m *ProjectMetadata) validateColor() bool {
+	return m.Color == "" || projectColorRegex.MatchString(m.Color)
+}
+
+// validateRate requires a currency along with every hourly rate, while a currency may be set on its own
+func (m *ProjectMetadata) validateRate() bool {
+	if m.HourlyRate < 0 || m.HourlyRate > MaxProjectHourlyRate {
+		return false
+	}
+	if m.Currency == "" {
+		return m.HourlyRate == 0
+	}
+	return projectCurrencyRegex.MatchString(m.Currency)
+}
+
+func (m *ProjectMetadata) validateIcon() bool {
+	if utf8.RuneCountInString(m.Icon) > MaxProjectIconLength {
+		return false
+	}
+	return !strings.ContainsFunc(m.Icon, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectMetadata_IsValid(t *testing.T) {
+	valid := []*ProjectMetadata{
+		{UserID: "john", Project: "wakapi", Color: "#00b4d8"},
+		{UserID: "john", Project: "wakapi", Color: "#FFF", Icon: "🚀"},
+		{UserID: "john", Project: "wakapi", Icon: "👩🏽‍💻"},
+		{UserID: "john", Project: "wakapi", Icon: "WK", Description: "Coding statistics"},
+		{UserID: "john", Project: "wakapi", HourlyRate: 80.5, Currency: "EUR"},
+		{UserID: "john", Project: "wakapi", Currency: "USD"},
+	}
+	invalid := []*ProjectMetadata{
+		{Project: "wakapi", Color: "#00b4d8"},
+		{UserID: "john", Color: "#00b4d8"},
+		{UserID: "john", Project: "wakapi", Color: "00b4d8"},
+		{UserID: "john", Project: "wakapi", Color: "#00b4d"},
+		{UserID: "john", Project: "wakapi", Color: "red"},
+		{UserID: "john", Project: "wakapi", Icon: "rocket ship"},
+		{UserID: "john", Project: "wakapi", Icon: "averylongicon"},
+		{UserID: "john", Project: "wakapi", Description: strings.Repeat("a", MaxProjectDescriptionLength+1)},
+		{UserID: "john", Project: "wakapi", HourlyRate: 80},
+		{UserID: "john", Project: "wakapi", HourlyRate: 80, Currency: "euro"},
+		{UserID: "john", Project: "wakapi", HourlyRate: -1, Currency: "EUR"},
+		{UserID: "john", Project: "wakapi", HourlyRate: MaxProjectHourlyRate + 1, Currency: "EUR"},
+	}
+
+	for _, m := range valid {
+		assert.True(t, m.IsValid(), m)
+	}
+	for _, m := range invalid {
+		assert.False(t, m.IsValid(), m)
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import "strings"
+
+const MaxProjectStripPrefixLength = 255
+
+// ProjectNormalization rewrites project names at ingest time, so that variants of the same project (e.g. "MyApp" and "myapp ") collapse into one.
+// Steps are applied in fixed order: trim whitespace, strip prefix, lowercase. Thus, the prefix is matched case-sensitively against the trimmed name.
+// Aliases, ignore patterns and project labels all refer to the normalized name.
+type ProjectNormalization struct {
+	Trim        bool
+	StripPrefix string
+	Lowercase   bool
+}
+
+func (n ProjectNormalization) IsEmpty() bool {
+	return !n.Trim && n.StripPrefix == "" && !n.Lowercase
+}
+
+func (n ProjectNormalization) Apply(project string) string {
+	if n.Trim {
+		project = strings.TrimSpace(project)
+	}
+	if n.StripPrefix != "" {
+		// never strip the whole name, as heartbeats without project would be accounted as "unknown" otherwise
+		if stripped := strings.TrimPrefix(project, n.StripPrefix); stripped != "" {
+			project = stripped
+		}
+	}
+	if n.Lowercase {
+		project = strings.ToLower(project)
+	}
+	return project
+}
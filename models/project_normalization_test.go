@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectNormalization_Apply(t *testing.T) {
+	assert.True(t, ProjectNormalization{}.IsEmpty())
+	assert.Equal(t, " MyApp ", ProjectNormalization{}.Apply(" MyApp "))
+
+	assert.Equal(t, "MyApp", ProjectNormalization{Trim: true}.Apply(" MyApp "))
+	assert.Equal(t, "myapp", ProjectNormalization{Trim: true, Lowercase: true}.Apply(" MyApp "))
+	assert.Equal(t, "myapp", ProjectNormalization{Trim: true, StripPrefix: "work/", Lowercase: true}.Apply("  work/MyApp"))
+
+	// prefix is stripped after trimming
+	assert.Equal(t, "  work/MyApp", ProjectNormalization{StripPrefix: "work/"}.Apply("  work/MyApp"))
+
+	// prefix is stripped before lowercasing, thus matched case-sensitively
+	assert.Equal(t, "work/myapp", ProjectNormalization{StripPrefix: "work/", Lowercase: true}.Apply("Work/MyApp"))
+
+	// never strips the entire name
+	assert.Equal(t, "work/", ProjectNormalization{StripPrefix: "work/"}.Apply("work/"))
+}
+
+func TestProjectNormalization_WithAliases(t *testing.T) {
+	n := ProjectNormalization{Trim: true, Lowercase: true}
+
+	// aliases refer to normalized project names
+	var resolver AliasResolver = func(t uint8, k string) string {
+		if t == SummaryProject && k == "myapp-mobile" {
+			return "myapp"
+		}
+		return k
+	}
+
+	sut := &Summary{
+		Projects: []*SummaryItem{
+			{Type: SummaryProject, Key: n.Apply("MyApp"), Total: 10},
+			{Type: SummaryProject, Key: n.Apply(" MyApp-Mobile "), Total: 5},
+			{Type: SummaryProject, Key: n.Apply("Other"), Total: 1},
+		},
+	}
+
+	sut = sut.WithResolvedAliases(resolver)
+	assert.Len(t, sut.Projects, 2)
+	assert.Equal(t, "myapp", sut.Projects[0].Key)
+	assert.Equal(t, "other", sut.Projects[1].Key)
+	assert.EqualValues(t, 15, sut.Projects[0].Total)
+}
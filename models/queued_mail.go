@@ -0,0 +1,58 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	QueuedMailPending    = "pending"
+	QueuedMailSent       = "sent"
+	QueuedMailDeadLetter = "dead_letter" // all attempts failed, no further retries
+)
+
+// QueuedMail persists an outbound mail along with the outcome of the (latest) attempt to send it, so that it can be retried after transient failures
+type QueuedMail struct {
+	ID            uint        `json:"id" gorm:"primary_key"`
+	From          string      `json:"from"`
+	To            string      `json:"to" gorm:"size:1024"` // comma-separated
+	Subject       string      `json:"subject"`
+	Body          string      `json:"-" gorm:"type:text"` // cleared once sent or dead-lettered
+	Type          string      `json:"-"`
+	Status        string      `json:"status" gorm:"index:idx_queued_mail_status"` // one of QueuedMailPending, QueuedMailSent, QueuedMailDeadLetter
+	Attempts      int         `json:"attempts"`
+	Error         string      `json:"error"` // of the latest attempt
+	NextAttemptAt *CustomTime `json:"next_attempt_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	CreatedAt     CustomTime  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP; index:idx_queued_mail_created_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+}
+
+func NewQueuedMail(mail *Mail) *QueuedMail {
+	now := CustomTime(time.Now())
+	return &QueuedMail{
+		From:          mail.From.String(),
+		To:            strings.Join(mail.To.Strings(), ","),
+		Subject:       mail.Subject,
+		Body:          mail.Body,
+		Type:          mail.Type,
+		Status:        QueuedMailPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	}
+}
+
+// Mail restores the mail to be sent
+func (m *QueuedMail) Mail() *Mail {
+	to := make(MailAddresses, 0)
+	for _, addr := range strings.Split(m.To, ",") {
+		if addr != "" {
+			to = append(to, MailAddress(addr))
+		}
+	}
+	return &Mail{
+		From:    MailAddress(m.From),
+		To:      to,
+		Subject: m.Subject,
+		Body:    m.Body,
+		Type:    m.Type,
+	}
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duke-git/lancet/v2/datetime"
+)
+
+const (
+	RangePresetPrefix        = "preset:" // for use as interval, e.g. "preset:sprint"
+	MaxRangePresets          = 20
+	MaxRangePresetNameLength = 32
+)
+
+var (
+	rangePresetNameRegex     = regexp.MustCompile(`^[a-z0-9_-]+$`)
+	rangePresetRelativeRegex = regexp.MustCompile(`^(\d+)\s*([dwm])$`)
+)
+
+// RangePreset is a named, user-defined time range to be used as interval shortcut.
+// Syntax (one preset per line): <name>: <n>d|<n>w|<n>m for the last n days, weeks or months (including today), or <yyyy-mm-dd>..<yyyy-mm-dd> for a fixed range (both days inclusive).
+// Names consist of lower case letters, digits, dashes and underscores. Lines starting with # are comments.
+type RangePreset struct {
+	Name   string
+	Raw    string
+	days   int
+	months int
+	start  string // fixed ranges only, resolved in the user's timezone at query time
+	end    string
+}
+
+type RangePresets []*RangePreset
+
+func ParseRangePresets(text string) (RangePresets, error) {
+	presets := make(RangePresets, 0)
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		preset, err := parseRangePreset(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preset in line %d: %v", i+1, err)
+		}
+		if presets.Get(preset.Name) != nil {
+			return nil, fmt.Errorf("duplicate preset '%s' in line %d", preset.Name, i+1)
+		}
+		presets = append(presets, preset)
+	}
+
+	if len(presets) > MaxRangePresets {
+		return nil, fmt.Errorf("at most %d presets allowed", MaxRangePresets)
+	}
+
+	return presets, nil
+}
+
+func parseRangePreset(line string) (*RangePreset, error) {
+	name, definition, ok := strings.Cut(line, ":")
+	if !ok {
+		return nil, fmt.Errorf("expected <name>: <range>")
+	}
+
+	preset := &RangePreset{Name: strings.TrimSpace(name), Raw: line}
+	definition = strings.ToLower(strings.TrimSpace(definition))
+
+	if len(preset.Name) > MaxRangePresetNameLength || !rangePresetNameRegex.MatchString(preset.Name) {
+		return nil, fmt.Errorf("name must consist of at most %d lower case letters, digits, dashes or underscores", MaxRangePresetNameLength)
+	}
+
+	if match := rangePresetRelativeRegex.FindStringSubmatch(definition); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		if n < 1 || n > 3660 {
+			return nil, fmt.Errorf("length must be between 1 and 3660")
+		}
+		switch match[2] {
+		case "d":
+			preset.days = n
+		case "w":
+			preset.days = n * 7
+		case "m":
+			preset.months = n
+		}
+		return preset, nil
+	}
+
+	if start, end, ok := strings.Cut(definition, ".."); ok {
+		preset.start, preset.end = strings.TrimSpace(start), strings.TrimSpace(end)
+		startDate, err1 := time.Parse(time.DateOnly, preset.start)
+		endDate, err2 := time.Parse(time.DateOnly, preset.end)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("dates must be formatted as yyyy-mm-dd")
+		}
+		if endDate.Before(startDate) {
+			return nil, fmt.Errorf("end must not be before start")
+		}
+		return preset, nil
+	}
+
+	return nil, fmt.Errorf("expected <n>d, <n>w, <n>m or <yyyy-mm-dd>..<yyyy-mm-dd>")
+}
+
+func (p RangePresets) Get(name string) *RangePreset {
+	for _, preset := range p {
+		if preset.Name == name {
+			return preset
+		}
+	}
+	return nil
+}
+
+func (p RangePresets) Names() []string {
+	names := make([]string, len(p))
+	for i, preset := range p {
+		names[i] = preset.Name
+	}
+	return names
+}
+
+// Resolve returns the preset's actual time range relative to the current time in the given timezone
+func (p *RangePreset) Resolve(tz *time.Location) (from, to time.Time) {
+	now := time.Now().In(tz)
+	today := datetime.BeginOfDay(now)
+
+	if p.start != "" {
+		from, _ = time.ParseInLocation(time.DateOnly, p.start, tz)
+		to, _ = time.ParseInLocation(time.DateOnly, p.end, tz)
+		return from, to.AddDate(0, 0, 1)
+	}
+	if p.months > 0 {
+		return today.AddDate(0, -p.months, 1), now
+	}
+	return today.AddDate(0, 0, -p.days+1), now
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/duke-git/lancet/v2/datetime"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRangePresets(t *testing.T) {
+	presets, err := ParseRangePresets("# comment\nsprint: 14d\n\nq1-2024: 2024-01-01..2024-03-31\nquarter: 3m\nfortnight: 2 w\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"sprint", "q1-2024", "quarter", "fortnight"}, presets.Names())
+	assert.Equal(t, 14, presets.Get("sprint").days)
+	assert.Equal(t, 14, presets.Get("fortnight").days)
+	assert.Equal(t, 3, presets.Get("quarter").months)
+	assert.Nil(t, presets.Get("unknown"))
+
+	testCases := []string{
+		"sprint 14d",
+		"Sprint: 14d",
+		"sprint: 0d",
+		"sprint: 14y",
+		"q1: 2024-03-31..2024-01-01",
+		"q1: 2024-01-01..",
+		"sprint: 14d\nsprint: 7d",
+	}
+	for _, tc := range testCases {
+		_, err := ParseRangePresets(tc)
+		assert.NotNil(t, err, tc)
+	}
+}
+
+func TestRangePreset_Resolve(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Berlin")
+	presets, _ := ParseRangePresets("sprint: 14d\nquarter: 3m\nq1: 2024-01-01..2024-03-31")
+	today := datetime.BeginOfDay(time.Now().In(tz))
+
+	from, to := presets.Get("sprint").Resolve(tz)
+	assert.Equal(t, today.AddDate(0, 0, -13), from)
+	assert.WithinDuration(t, time.Now(), to, time.Second)
+	assert.Equal(t, tz, from.Location())
+
+	from, _ = presets.Get("quarter").Resolve(tz)
+	assert.Equal(t, today.AddDate(0, -3, 1), from)
+
+	from, to = presets.Get("q1").Resolve(tz)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, tz), from)
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, tz), to)
+}
@@ -0,0 +1,11 @@
+package models
+
+// RateLimitStatus describes a user's current usage of their request budget within the (sliding) rate limit window
+type RateLimitStatus struct {
+	Enabled   bool       `json:"enabled"`
+	Limit     int        `json:"limit"`
+	Used      int        `json:"used"`
+	Remaining int        `json:"remaining"`
+	WindowSec int        `json:"window_sec"`
+	ResetAt   CustomTime `json:"reset_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+}
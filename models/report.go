@@ -2,10 +2,31 @@ package models
 
 import "time"
 
+// ImportPreview summarizes what a data import would do, without it actually being performed (dry run)
+type ImportPreview struct {
+	NumHeartbeats int // new heartbeats that would be imported
+	NumDuplicates int // heartbeats that would be skipped, because already existing
+	NumDays       int // distinct days covered by new heartbeats
+	From          time.Time
+	To            time.Time
+}
+
 type Report struct {
 	From           time.Time
 	To             time.Time
 	User           *User
 	Summary        *Summary
 	DailySummaries []*Summary
+	ActiveDays     int // number of days with coding time above the user's active day threshold
+}
+
+func (r *Report) CountActiveDays() int {
+	var n int
+	threshold := r.User.ActiveDayThreshold()
+	for _, s := range r.DailySummaries {
+		if s != nil && s.IsActiveDay(threshold) {
+			n++
+		}
+	}
+	return n
 }
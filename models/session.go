@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Session is the content of the auth cookie of an interactive (i.e. browser) login, access by api key doesn't involve sessions
+type Session struct {
+	ID         string    `json:"id,omitempty"` // of the persisted UserSession, empty for sessions issued before sessions were persisted
+	UserID     string    `json:"user_id"`
+	IssuedAt   time.Time `json:"issued_at"`
+	LastSeenAt time.Time `json:"last_seen_at"` // only updated every once in a while, see SessionActivityInterval
+}
+
+// SessionActivityInterval is how often a session's last activity is refreshed at most, to not re-issue the cookie on every request
+const SessionActivityInterval = time.Minute
+
+func NewSession(user *User) *Session {
+	now := time.Now()
+	return &Session{
+		UserID:     user.ID,
+		IssuedAt:   now,
+		LastSeenAt: now,
+	}
+}
+
+// IsExpired tells whether the session exceeds the given absolute or idle lifetime (0 to disable either)
+func (s *Session) IsExpired(maxAge, idleTimeout time.Duration) bool {
+	now := time.Now()
+	return (maxAge > 0 && now.Sub(s.IssuedAt) > maxAge) || (idleTimeout > 0 && now.Sub(s.LastSeenAt) > idleTimeout)
+}
+
+// IsRevoked tells whether the session was issued before the user logged out all of their sessions.
+// Persisted sessions are revoked by deleting their UserSession instead, so that others can be revoked while keeping the current one.
+func (s *Session) IsRevoked(user *User) bool {
+	return s.ID == "" && user.SessionsRevokedAt != nil && s.IssuedAt.Before(user.SessionsRevokedAt.T())
+}
+
+// NeedsRefresh tells whether the session's last activity is to be updated
+func (s *Session) NeedsRefresh() bool {
+	return time.Since(s.LastSeenAt) > SessionActivityInterval
+}
+
+// UserSession persists a login session's metadata, so that users can see where they're logged in and revoke individual sessions, which takes effect immediately on all server instances
+type UserSession struct {
+	ID         string     `json:"id" gorm:"primary_key; size:36"`
+	User       *User      `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID     string     `json:"-" gorm:"not null; index:idx_user_session_user"`
+	CreatedAt  CustomTime `json:"created_at" gorm:"default:CURRENT_TIMESTAMP" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	LastSeenAt CustomTime `json:"last_seen_at" gorm:"default:CURRENT_TIMESTAMP; index:idx_user_session_last_seen" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"` // only updated every SessionActivityInterval
+	UserAgent  string     `json:"user_agent" gorm:"type:varchar(255)"`
+	IP         string     `json:"ip" gorm:"type:varchar(64)"`
+	Current    bool       `json:"current" gorm:"-"` // whether it's the session of the request
+}
+
+// NeedsRefresh tells whether the session's last activity is to be updated
+func (s *UserSession) NeedsRefresh() bool {
+	return time.Since(s.LastSeenAt.T()) > SessionActivityInterval
+}
@@ -0,0 +1,154 @@
+package models
+
+const SettingsProfileVersion = 1
+
+const (
+	SettingsImportMerge   = "merge"   // entries of the profile are added to the existing ones, replacing those of the same name
+	SettingsImportReplace = "replace" // existing entries not contained in the profile are removed
+)
+
+// SettingsProfile is a portable bundle of a user's settings, e.g. to copy them to an account on another instance.
+// Unlike archive exports, it contains no data at all, and neither credentials (password, api keys, 2fa) nor billing or account details (name, e-mail).
+type SettingsProfile struct {
+	Version          int                         `json:"version"`
+	ExportedAt       CustomTime                  `json:"exported_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	Preferences      *SettingsProfilePreferences `json:"preferences"`
+	Aliases          AliasRules                  `json:"aliases"`           // same format as alias rules files
+	LanguageMappings map[string]string           `json:"language_mappings"` // file extension -> language
+	ProjectLabels    map[string][]string         `json:"project_labels"`    // project -> labels
+	DefaultBranches  map[string]string           `json:"default_branches"`  // project -> branch
+}
+
+type SettingsProfilePreferences struct {
+	Location               string `json:"location"`
+	ShareDataMaxDays       int    `json:"share_data_max_days"`
+	ShareEditors           bool   `json:"share_editors"`
+	ShareLanguages         bool   `json:"share_languages"`
+	ShareProjects          bool   `json:"share_projects"`
+	ShareOSs               bool   `json:"share_oss"`
+	ShareMachines          bool   `json:"share_machines"`
+	ShareLabels            bool   `json:"share_labels"`
+	AnonymizeProjects      bool   `json:"anonymize_projects"`
+	AnonymizeLanguages     bool   `json:"anonymize_languages"`
+	AnonymizeEditors       bool   `json:"anonymize_editors"`
+	NewProjectsPrivate     bool   `json:"new_projects_private"`
+	PublicLeaderboard      bool   `json:"public_leaderboard"`
+	ReportsWeekly          bool   `json:"reports_weekly"`
+	InactivityReminders    bool   `json:"inactivity_reminders"`
+	ProjectNameTrim        bool   `json:"project_name_trim"`
+	ProjectNamePrefix      string `json:"project_name_prefix"`
+	ProjectNameLowercase   bool   `json:"project_name_lowercase"`
+	EntityStripQuery       bool   `json:"entity_strip_query"`
+	EntityStripHost        bool   `json:"entity_strip_host"`
+	ProjectPathRoot        string `json:"project_path_root"`
+	ProjectPathSegment     int    `json:"project_path_segment"`
+	ExcludeUnknownProjects bool   `json:"exclude_unknown_projects"`
+	ServerTimestamps       bool   `json:"server_timestamps"`
+	OverrideLanguages      bool   `json:"override_languages"`
+	HeartbeatsTimeoutSec   int    `json:"heartbeats_timeout_sec"`
+	DefaultSummaryInterval string `json:"default_summary_interval"`
+	IgnorePatterns         string `json:"ignore_patterns"` // newline-separated
+	RangePresets           string `json:"range_presets"`   // newline-separated
+	AutoArchiveDays        int    `json:"auto_archive_days"`
+	ActiveDayThresholdSec  int    `json:"active_day_threshold_sec"`
+	DailyProjectCapHours   int    `json:"daily_project_cap_hours"`
+	MachineOverlapMode     string `json:"machine_overlap_mode"`
+	UnknownBucket          string `json:"unknown_bucket"`
+	AverageMode            string `json:"average_mode"`
+}
+
+// SettingsImportCounts tells how the entries of one kind (e.g. aliases) of an imported profile were applied
+type SettingsImportCounts struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"` // existing entries of the same name (e.g. file extension), which got a different value
+	Unchanged int `json:"unchanged"`
+	Deleted   int `json:"deleted"` // only when replacing
+}
+
+type SettingsImportResult struct {
+	Mode             string                `json:"mode"`
+	Aliases          *SettingsImportCounts `json:"aliases"`
+	LanguageMappings *SettingsImportCounts `json:"language_mappings"`
+	ProjectLabels    *SettingsImportCounts `json:"project_labels"`
+	DefaultBranches  *SettingsImportCounts `json:"default_branches"`
+}
+
+func NewSettingsProfilePreferences(user *User) *SettingsProfilePreferences {
+	return &SettingsProfilePreferences{
+		Location:               user.Location,
+		ShareDataMaxDays:       user.ShareDataMaxDays,
+		ShareEditors:           user.ShareEditors,
+		ShareLanguages:         user.ShareLanguages,
+		ShareProjects:          user.ShareProjects,
+		ShareOSs:               user.ShareOSs,
+		ShareMachines:          user.ShareMachines,
+		ShareLabels:            user.ShareLabels,
+		AnonymizeProjects:      user.AnonymizeProjects,
+		AnonymizeLanguages:     user.AnonymizeLanguages,
+		AnonymizeEditors:       user.AnonymizeEditors,
+		NewProjectsPrivate:     user.NewProjectsPrivate,
+		PublicLeaderboard:      user.PublicLeaderboard,
+		ReportsWeekly:          user.ReportsWeekly,
+		InactivityReminders:    user.InactivityReminders,
+		ProjectNameTrim:        user.ProjectNameTrim,
+		ProjectNamePrefix:      user.ProjectNamePrefix,
+		ProjectNameLowercase:   user.ProjectNameLowercase,
+		EntityStripQuery:       user.EntityStripQuery,
+		EntityStripHost:        user.EntityStripHost,
+		ProjectPathRoot:        user.ProjectPathRoot,
+		ProjectPathSegment:     user.ProjectPathSegment,
+		ExcludeUnknownProjects: user.ExcludeUnknownProjects,
+		ServerTimestamps:       user.ServerTimestamps,
+		OverrideLanguages:      user.OverrideLanguages,
+		HeartbeatsTimeoutSec:   user.HeartbeatsTimeoutSec,
+		DefaultSummaryInterval: user.DefaultSummaryInterval,
+		IgnorePatterns:         user.IgnorePatterns,
+		RangePresets:           user.RangePresets,
+		AutoArchiveDays:        user.AutoArchiveDays,
+		ActiveDayThresholdSec:  user.ActiveDayThresholdSec,
+		DailyProjectCapHours:   user.DailyProjectCapHours,
+		MachineOverlapMode:     user.MachineOverlapMode,
+		UnknownBucket:          user.UnknownBucket,
+		AverageMode:            user.AverageMode,
+	}
+}
+
+// ApplyTo overwrites the user's preferences with these ones, which are expected to be validated before
+func (p *SettingsProfilePreferences) ApplyTo(user *User) {
+	user.LocationFixed = user.LocationFixed || p.Location != user.Location // also when unset, so it's not inferred again
+	user.Location = p.Location
+	user.ShareDataMaxDays = p.ShareDataMaxDays
+	user.ShareEditors = p.ShareEditors
+	user.ShareLanguages = p.ShareLanguages
+	user.ShareProjects = p.ShareProjects
+	user.ShareOSs = p.ShareOSs
+	user.ShareMachines = p.ShareMachines
+	user.ShareLabels = p.ShareLabels
+	user.AnonymizeProjects = p.AnonymizeProjects
+	user.AnonymizeLanguages = p.AnonymizeLanguages
+	user.AnonymizeEditors = p.AnonymizeEditors
+	user.NewProjectsPrivate = p.NewProjectsPrivate
+	user.PublicLeaderboard = p.PublicLeaderboard
+	user.ReportsWeekly = p.ReportsWeekly
+	user.InactivityReminders = p.InactivityReminders
+	user.ProjectNameTrim = p.ProjectNameTrim
+	user.ProjectNamePrefix = p.ProjectNamePrefix
+	user.ProjectNameLowercase = p.ProjectNameLowercase
+	user.EntityStripQuery = p.EntityStripQuery
+	user.EntityStripHost = p.EntityStripHost
+	user.ProjectPathRoot = p.ProjectPathRoot
+	user.ProjectPathSegment = p.ProjectPathSegment
+	user.ExcludeUnknownProjects = p.ExcludeUnknownProjects
+	user.ServerTimestamps = p.ServerTimestamps
+	user.OverrideLanguages = p.OverrideLanguages
+	user.HeartbeatsTimeoutSec = p.HeartbeatsTimeoutSec
+	user.DefaultSummaryInterval = p.DefaultSummaryInterval
+	user.IgnorePatterns = p.IgnorePatterns
+	user.RangePresets = p.RangePresets
+	user.AutoArchiveDays = p.AutoArchiveDays
+	user.ActiveDayThresholdSec = p.ActiveDayThresholdSec
+	user.DailyProjectCapHours = p.DailyProjectCapHours
+	user.MachineOverlapMode = p.MachineOverlapMode
+	user.UnknownBucket = p.UnknownBucket
+	user.AverageMode = p.AverageMode
+}
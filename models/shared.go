@@ -15,10 +15,13 @@ import (
 )
 
 const (
-	UserKey               = "user"
-	ImprintKey            = "imprint"
-	AuthCookieKey         = "wakapi_auth"
-	PersistentIntervalKey = "wakapi_summary_interval"
+	UserKey                 = "user"
+	ImprintKey              = "imprint"
+	AuthCookieKey           = "wakapi_auth"
+	TotpPendingCookieKey    = "wakapi_2fa_pending"
+	RestorePendingCookieKey = "wakapi_restore_pending"
+	ImpersonationCookieKey  = "wakapi_impersonation"
+	PersistentIntervalKey   = "wakapi_summary_interval"
 )
 
 type KeyStringValue struct {
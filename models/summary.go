@@ -51,6 +51,8 @@ type Summary struct {
 	Entities         SummaryItems `json:"entities" gorm:"-"` // entities are not persisted, but calculated at runtime in case a project Filter is applied
 	Categories       SummaryItems `json:"categories" gorm:"-"`
 	NumHeartbeats    int          `json:"-"`
+
+	ProjectMetadata map[string]*ProjectMetadata `json:"project_metadata,omitempty" gorm:"-"` // not persisted, but only attached to api responses
 }
 
 type SummaryItems []*SummaryItem
@@ -303,6 +305,12 @@ func (s *Summary) TotalTime() time.Duration {
 	return timeSum * time.Second
 }
 
+// IsActiveDay tells whether the summary has any coding time of at least the given threshold. Only meaningful for summaries spanning a single day.
+func (s *Summary) IsActiveDay(threshold time.Duration) bool {
+	total := s.TotalTime()
+	return total > 0 && total >= threshold
+}
+
 func (s *Summary) TotalTimeBy(entityType uint8) (timeSum time.Duration) {
 	mappedItems := s.MappedItems()
 	if items := mappedItems[entityType]; len(*items) > 0 {
@@ -412,6 +420,58 @@ func (s *Summary) WithResolvedAliases(resolve AliasResolver) *Summary {
 	return s
 }
 
+// WithAnonymizedKeys returns a copy of the summary with the keys of all items of the given types replaced by the given function's result
+// the summary itself is left untouched, as it might be cached and shared among requests
+func (s *Summary) WithAnonymizedKeys(types []uint8, anonymize func(t uint8, key string) string) *Summary {
+	summary := *s
+	for _, t := range types {
+		items := s.GetByType(t)
+		if *items == nil {
+			continue
+		}
+		anonymized := make(SummaryItems, len(*items))
+		for i, item := range *items {
+			itemCopy := *item
+			if item.Key != UnknownSummaryKey {
+				itemCopy.Key = anonymize(t, item.Key)
+			}
+			anonymized[i] = &itemCopy
+		}
+		summary.SetByType(t, &anonymized)
+	}
+	return &summary
+}
+
+// WithUnknownBucket returns a copy of the summary, in which all unknown languages and editors are merged into a single item with the given label or, if hide is set, left out
+// the summary itself is left untouched, as it might be cached and shared among requests
+func (s *Summary) WithUnknownBucket(label string, hide bool) *Summary {
+	summary := *s
+	for _, t := range []uint8{SummaryLanguage, SummaryEditor} {
+		items := s.GetByType(t)
+		if *items == nil {
+			continue
+		}
+		var bucket *SummaryItem
+		bucketed := make(SummaryItems, 0, len(*items))
+		for _, item := range *items {
+			if item.Key != "" && item.Key != UnknownSummaryKey {
+				bucketed = append(bucketed, item)
+				continue
+			}
+			if hide {
+				continue
+			}
+			if bucket == nil {
+				bucket = &SummaryItem{Type: t, Key: label}
+				bucketed = append(bucketed, bucket)
+			}
+			bucket.Total += item.Total
+		}
+		summary.SetByType(t, &bucketed)
+	}
+	return &summary
+}
+
 func (s *Summary) findFirstPresentType() (uint8, error) {
 	for _, t := range s.Types() {
 		if s.TotalTimeBy(t) != 0 {
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	RollupMonth = "month"
+	RollupYear  = "year"
+)
+
+// SummaryRollup holds the totals of a calendar month or year, e.g. for long-term trends, instead of having to fetch all of its daily summaries.
+// Periods at the edges of the requested range are cut off, but labeled just like complete ones.
+type SummaryRollup struct {
+	Period           string       `json:"period" example:"2024-03"` // e.g. '2024-03' for months or '2024' for years
+	From             CustomTime   `json:"from" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	To               CustomTime   `json:"to" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	Total            int64        `json:"total"` // seconds
+	Projects         SummaryItems `json:"projects"`
+	Languages        SummaryItems `json:"languages"`
+	Editors          SummaryItems `json:"editors"`
+	OperatingSystems SummaryItems `json:"operating_systems"`
+	Machines         SummaryItems `json:"machines"`
+	Labels           SummaryItems `json:"labels"`
+	Categories       SummaryItems `json:"categories"`
+}
+
+func IsValidRollup(granularity string) bool {
+	return granularity == RollupMonth || granularity == RollupYear
+}
+
+func NewSummaryRollup(granularity string, from, to time.Time, summary *Summary) *SummaryRollup {
+	period := from.Format("2006-01")
+	if granularity == RollupYear {
+		period = from.Format("2006")
+	}
+	return &SummaryRollup{
+		Period:           period,
+		From:             CustomTime(from),
+		To:               CustomTime(to),
+		Total:            int64(summary.TotalTime().Seconds()),
+		Projects:         summary.Projects,
+		Languages:        summary.Languages,
+		Editors:          summary.Editors,
+		OperatingSystems: summary.OperatingSystems,
+		Machines:         summary.Machines,
+		Labels:           summary.Labels,
+		Categories:       summary.Categories,
+	}
+}
@@ -73,6 +73,20 @@ func TestSummary_TotalTimeBy(t *testing.T) {
 	assert.Zero(t, sut.TotalTimeBy(SummaryOS))
 }
 
+func TestSummary_IsActiveDay(t *testing.T) {
+	sut := &Summary{
+		Languages: []*SummaryItem{
+			{Type: SummaryLanguage, Key: "Go", Total: 50},
+			{Type: SummaryLanguage, Key: "Java", Total: 20},
+		},
+	}
+
+	assert.True(t, sut.IsActiveDay(0))
+	assert.True(t, sut.IsActiveDay(70*time.Second))
+	assert.False(t, sut.IsActiveDay(71*time.Second))
+	assert.False(t, (&Summary{}).IsActiveDay(0))
+}
+
 func TestSummary_TotalTimeByFilters(t *testing.T) {
 	testDuration1, testDuration2, testDuration3 := 10*time.Minute, 5*time.Minute, 20*time.Minute
 
@@ -169,6 +183,60 @@ func TestSummary_WithResolvedAliases(t *testing.T) {
 	assert.Empty(t, sut.Machines)
 }
 
+func TestSummary_WithAnonymizedKeys(t *testing.T) {
+	sut := &Summary{
+		Projects: []*SummaryItem{
+			{Type: SummaryProject, Key: "wakapi", Total: 10},
+			{Type: SummaryProject, Key: UnknownSummaryKey, Total: 5},
+		},
+		Languages: []*SummaryItem{
+			{Type: SummaryLanguage, Key: "Go", Total: 15},
+		},
+	}
+
+	result := sut.WithAnonymizedKeys([]uint8{SummaryProject, SummaryEditor}, func(t uint8, k string) string {
+		return "anon-" + k
+	})
+
+	assert.Equal(t, "anon-wakapi", result.Projects[0].Key)
+	assert.Equal(t, UnknownSummaryKey, result.Projects[1].Key)
+	assert.Equal(t, "Go", result.Languages[0].Key)
+	assert.Nil(t, result.Editors)
+	assert.Equal(t, sut.TotalTime(), result.TotalTime())
+	assert.Equal(t, "wakapi", sut.Projects[0].Key) // original left untouched
+}
+
+func TestSummary_WithUnknownBucket(t *testing.T) {
+	sut := &Summary{
+		Projects: []*SummaryItem{
+			{Type: SummaryProject, Key: "wakapi", Total: 30},
+			{Type: SummaryProject, Key: UnknownSummaryKey, Total: 5},
+		},
+		Languages: []*SummaryItem{
+			{Type: SummaryLanguage, Key: "Go", Total: 20},
+			{Type: SummaryLanguage, Key: "", Total: 10},
+			{Type: SummaryLanguage, Key: UnknownSummaryKey, Total: 5},
+		},
+		Editors: []*SummaryItem{
+			{Type: SummaryEditor, Key: "vscode", Total: 35},
+		},
+	}
+
+	result := sut.WithUnknownBucket("Unknown", false)
+	assert.Len(t, result.Languages, 2)
+	assert.Equal(t, "Unknown", result.Languages[1].Key)
+	assert.Equal(t, 15*time.Second, result.TotalTimeByKey(SummaryLanguage, "Unknown"))
+	assert.Len(t, result.Editors, 1)
+	assert.Equal(t, UnknownSummaryKey, result.Projects[1].Key) // projects are not affected
+	assert.Equal(t, sut.TotalTime(), result.TotalTime())
+	assert.Len(t, sut.Languages, 3) // original left untouched
+
+	result = sut.WithUnknownBucket("Unknown", true)
+	assert.Len(t, result.Languages, 1)
+	assert.Equal(t, "Go", result.Languages[0].Key)
+	assert.Equal(t, sut.TotalTime(), result.TotalTime())
+}
+
 func TestSummary_KeepOnly(t *testing.T) {
 	newSummary := func() *Summary {
 		return &Summary{
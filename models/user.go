@@ -15,6 +15,24 @@ const (
 	DefaultHeartbeatsTimeout = 2 * time.Minute
 	MinHeartbeatsTimeout     = 30 * time.Second
 	MaxHeartbeatsTimeout     = 5 * time.Minute
+	MaxActiveDayThreshold    = 8 * time.Hour
+	MaxDailyProjectCap       = 24 * time.Hour
+)
+
+const (
+	MachineOverlapMerge    = "merge"    // time spent coding on multiple machines in parallel is counted once (wall-clock time)
+	MachineOverlapAdditive = "additive" // time spent coding on multiple machines in parallel is counted for every machine (effort time)
+)
+
+const (
+	UnknownBucketShow = "show" // unknown languages and editors are summed up as one labeled item in summary breakdowns
+	UnknownBucketHide = "hide" // unknown languages and editors are left out from summary breakdowns
+)
+
+const (
+	AverageModeCalendar   = "calendar"    // daily averages are computed over every day of the range
+	AverageModeActiveDays = "active_days" // daily averages are computed over the days of the range with coding time above the user's active day threshold
+	AverageModeSinceFirst = "since_first" // daily averages are computed over the days of the range since (and including) the day of the user's first heartbeat
 )
 
 func init() {
@@ -24,10 +42,12 @@ func init() {
 type User struct {
 	ID                     string      `json:"id" gorm:"primary_key"`
 	ApiKey                 string      `json:"api_key" gorm:"unique; default:NULL"`
+	MetricsToken           string      `json:"-" gorm:"uniqueIndex:idx_user_metrics_token; default:NULL"` // only grants scraping the user's personal metrics, see /api/users/current/metrics
 	Email                  string      `json:"email" gorm:"index:idx_user_email; size:255"`
 	Location               string      `json:"location"`
+	LocationFixed          bool        `json:"-" gorm:"default:false; type:bool"` // time zone was inferred or set by the user, so it's never inferred (again), see UserService.InferLocation
 	Password               string      `json:"-"`
-	CreatedAt              CustomTime  `gorm:"default:CURRENT_TIMESTAMP" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	CreatedAt              CustomTime  `gorm:"default:CURRENT_TIMESTAMP; index:idx_user_created_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
 	LastLoggedInAt         CustomTime  `gorm:"default:CURRENT_TIMESTAMP" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
 	ShareDataMaxDays       int         `json:"-"`
 	ShareEditors           bool        `json:"-" gorm:"default:false; type:bool"`
@@ -36,19 +56,54 @@ type User struct {
 	ShareOSs               bool        `json:"-" gorm:"default:false; type:bool; column:share_oss"`
 	ShareMachines          bool        `json:"-" gorm:"default:false; type:bool"`
 	ShareLabels            bool        `json:"-" gorm:"default:false; type:bool"`
+	AnonymizeProjects      bool        `json:"-" gorm:"default:false; type:bool"` // also applies to labels, branches and files
+	AnonymizeLanguages     bool        `json:"-" gorm:"default:false; type:bool"`
+	AnonymizeEditors       bool        `json:"-" gorm:"default:false; type:bool"`
+	NewProjectsPrivate     bool        `json:"-" gorm:"default:false; type:bool"` // mark projects private when their first heartbeat comes in, see ProjectMetadata.Private
 	IsAdmin                bool        `json:"-" gorm:"default:false; type:bool"`
+	OrgID                  *string     `json:"-" gorm:"index:idx_user_org"`
+	OrgAdmin               bool        `json:"-" gorm:"default:false; type:bool"` // manages members of their org, see Org
 	HasData                bool        `json:"-" gorm:"default:false; type:bool"`
 	WakatimeApiKey         string      `json:"-"` // for relay middleware and imports
 	WakatimeApiUrl         string      `json:"-"` // for relay middleware and imports
 	ResetToken             string      `json:"-"`
 	ReportsWeekly          bool        `json:"-" gorm:"default:false; type:bool"`
+	InactivityReminders    bool        `json:"-" gorm:"default:false; type:bool"` // opted in to be reminded by mail after not coding for a while
 	PublicLeaderboard      bool        `json:"-" gorm:"default:false; type:bool"`
-	SubscribedUntil        *CustomTime `json:"-" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	SubscribedUntil        *CustomTime `json:"-" gorm:"index:idx_user_subscribed_until" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
 	SubscriptionRenewal    *CustomTime `json:"-" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	SubscriptionTrialEnd   *CustomTime `json:"-" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"` // only set while the subscription is in its trial period
 	StripeCustomerId       string      `json:"-"`
 	InvitedBy              string      `json:"-"`
+	ProjectNameTrim        bool        `json:"-" gorm:"default:false; type:bool"`
+	ProjectNamePrefix      string      `json:"-"` // prefix to strip from project names, see ProjectNormalization
+	ProjectNameLowercase   bool        `json:"-" gorm:"default:false; type:bool"`
+	EntityStripQuery       bool        `json:"-" gorm:"default:false; type:bool"`
+	EntityStripHost        bool        `json:"-" gorm:"default:false; type:bool"`
+	ProjectPathRoot        string      `json:"-"` // path below which to derive projects from folder names, see ProjectDerivation
+	ProjectPathSegment     int         `json:"-" gorm:"default:1"`
 	ExcludeUnknownProjects bool        `json:"-"`
+	ServerTimestamps       bool        `json:"-" gorm:"default:false; type:bool"`
+	OverrideLanguages      bool        `json:"-" gorm:"default:false; type:bool"`
 	HeartbeatsTimeoutSec   int         `json:"-" gorm:"default:120"` // https://github.com/muety/wakapi/issues/156
+	DefaultSummaryInterval string      `json:"-"`                    // dashboard interval to use if none is given explicitly, empty means none
+	SoftDeletedAt          *CustomTime `json:"-" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	SessionsRevokedAt      *CustomTime `json:"-" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	IgnorePatterns         string      `json:"-" gorm:"type:text"` // newline-separated, see IgnorePattern
+	RangePresets           string      `json:"-" gorm:"type:text"` // newline-separated, see RangePreset
+	AutoArchiveDays        int         `json:"-"`                  // archive projects without heartbeats for this many days, 0 to disable
+	ActiveDayThresholdSec  int         `json:"-"`                  // minimum coding time for a day to count as active, 0 to use the server default
+	DailyProjectCapHours   int         `json:"-"`                  // maximum coding time counted per project and day, 0 for unlimited, see Durations.CappedPerProjectAndDay
+	MachineOverlapMode     string      `json:"-"`                  // MachineOverlapMerge or MachineOverlapAdditive, empty means the former
+	UnknownBucket          string      `json:"-"`                  // UnknownBucketShow or UnknownBucketHide, empty means the server default (hide_unknown)
+	AverageMode            string      `json:"-"`                  // AverageModeCalendar, AverageModeActiveDays or AverageModeSinceFirst, empty means the former
+	LastPlugin             string      `json:"-" gorm:"size:64"`   // editor plugin (e.g. vscode-wakatime) most recently sent heartbeats with, see utils.ParsePluginVersion
+	LastPluginVersion      string      `json:"-" gorm:"size:32"`   // version of LastPlugin
+	TotpSecret             string      `json:"-"`                  // encrypted, already set during enrollment, while TotpEnabled is only set after successful verification
+	TotpEnabled            bool        `json:"-" gorm:"default:false; type:bool"`
+	TotpRecoveryCodes      string      `json:"-" gorm:"type:text"` // comma-separated hashes of unused recovery codes
+	TotpLastStep           int64       `json:"-"`                  // time step of the last accepted code, to prevent replays
+	ImpersonatedBy         string      `json:"-" gorm:"-"`         // id of the admin currently impersonating this user, only set on the principal of impersonated requests
 }
 
 type Login struct {
@@ -66,6 +121,7 @@ type Signup struct {
 	Captcha        string `schema:"captcha"`
 	InviteCode     string `schema:"invite_code"`
 	InvitedBy      string `schema:"-"`
+	OrgID          string `schema:"-"` // org the invite code was pinned to, if any
 }
 
 type SetPasswordRequest struct {
@@ -85,10 +141,11 @@ type CredentialsReset struct {
 }
 
 type UserDataUpdate struct {
-	Email             string `schema:"email"`
-	Location          string `schema:"location"`
-	ReportsWeekly     bool   `schema:"reports_weekly"`
-	PublicLeaderboard bool   `schema:"public_leaderboard"`
+	Email               string `schema:"email"`
+	Location            string `schema:"location"`
+	ReportsWeekly       bool   `schema:"reports_weekly"`
+	InactivityReminders bool   `schema:"inactivity_reminders"`
+	PublicLeaderboard   bool   `schema:"public_leaderboard"`
 }
 
 type TimeByUser struct {
@@ -101,6 +158,25 @@ type CountByUser struct {
 	Count int64
 }
 
+// UserQuerySortFields are the columns users can be sorted by when querying them
+var UserQuerySortFields = []string{"id", "created_at", "last_logged_in_at", "last_active_at", "subscribed_until"}
+
+// UserQuery holds the criteria for listing users, e.g. for the admin api, nil fields are disregarded
+type UserQuery struct {
+	ActiveAfter     *time.Time // last heartbeat not older than this
+	HasSubscription *bool
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+	OrgID           *string
+	SortBy          string // one of UserQuerySortFields, defaults to id
+	SortDesc        bool
+}
+
+type UserWithActivity struct {
+	User         `gorm:"embedded"`
+	LastActiveAt *CustomTime // time of the user's latest heartbeat, nil if none
+}
+
 func (u *User) Identity() string {
 	return u.ID
 }
@@ -116,6 +192,11 @@ func (u *User) TZ() *time.Location {
 	return tz
 }
 
+// HasLocation tells whether the user has configured a time zone, as opposed to summaries falling back to the server's one
+func (u *User) HasLocation() bool {
+	return u.Location != "" && u.Location != "Local"
+}
+
 // TZOffset returns the time difference between the user's current time zone and UTC
 // TODO: is this actually working??
 func (u *User) TZOffset() time.Duration {
@@ -142,6 +223,60 @@ func (u *User) HeartbeatsTimeout() time.Duration {
 	return DefaultHeartbeatsTimeout
 }
 
+// CountsMachinesAdditively returns whether parallel activity on multiple machines is summed up instead of merged into wall-clock time
+func (u *User) CountsMachinesAdditively() bool {
+	return u.MachineOverlapMode == MachineOverlapAdditive
+}
+
+// AsImpersonatedBy returns a copy of the user as seen by the given admin while impersonating them, i.e. stripped of all credentials and privileges
+func (u *User) AsImpersonatedBy(admin *User) *User {
+	impersonated := *u
+	impersonated.ApiKey = ""
+	impersonated.Password = ""
+	impersonated.ResetToken = ""
+	impersonated.WakatimeApiKey = ""
+	impersonated.TotpSecret = ""
+	impersonated.TotpRecoveryCodes = ""
+	impersonated.IsAdmin = false
+	impersonated.OrgAdmin = false
+	impersonated.ImpersonatedBy = admin.ID
+	return &impersonated
+}
+
+func (u *User) IsImpersonated() bool {
+	return u.ImpersonatedBy != ""
+}
+
+// HidesUnknownBucket returns whether to leave out unknown languages and editors from this user's summary breakdowns, falling back to the server default
+// HasOutdatedPlugin returns whether the plugin most recently used by the user is older than the given minimum version for that plugin, see config.GetMinPluginVersions
+func (u *User) HasOutdatedPlugin(minVersions map[string]string) bool {
+	if u.LastPlugin == "" || u.LastPluginVersion == "" {
+		return false
+	}
+	minVersion, ok := minVersions[strings.ToLower(u.LastPlugin)]
+	return ok && utils.CompareVersions(u.LastPluginVersion, minVersion) < 0
+}
+
+func (u *User) HidesUnknownBucket() bool {
+	if u.UnknownBucket == "" {
+		return conf.Get().App.HideUnknown
+	}
+	return u.UnknownBucket == UnknownBucketHide
+}
+
+// ActiveDayThreshold returns the minimum coding time for a day to count as active (e.g. in reports) for this user, falling back to the server default
+func (u *User) ActiveDayThreshold() time.Duration {
+	if u.ActiveDayThresholdSec > 0 {
+		return time.Duration(u.ActiveDayThresholdSec) * time.Second
+	}
+	return time.Duration(conf.Get().App.ActiveDayThresholdSec) * time.Second
+}
+
+// DailyProjectCap returns the maximum coding time to be counted per project and day for this user, 0 meaning unlimited
+func (u *User) DailyProjectCap() time.Duration {
+	return time.Duration(u.DailyProjectCapHours) * time.Hour
+}
+
 // WakaTimeURL returns the user's effective WakaTime URL, i.e. a custom one (which could also point to another Wakapi instance) or fallback if not specified otherwise.
 func (u *User) WakaTimeURL(fallback string) string {
 	if u.WakatimeApiUrl != "" {
@@ -159,6 +294,11 @@ func (u *User) HasActiveSubscriptionStrict() bool {
 	return u.SubscribedUntil != nil && u.SubscribedUntil.T().After(time.Now())
 }
 
+// IsSubscriptionTrial returns true if the user's subscription is currently in its free trial period
+func (u *User) IsSubscriptionTrial() bool {
+	return u.HasActiveSubscriptionStrict() && u.SubscriptionTrialEnd != nil && u.SubscriptionTrialEnd.T().After(time.Now())
+}
+
 // SubscriptionExpiredSince returns if a user's subscription has expiration and the duration since when that happened.
 // Returns (false, <negative duration>), if subscription hasn't expired, yet.
 // Returns (false, 0), if subscriptions are not enabled in the first place.
@@ -184,10 +324,94 @@ func (u *User) MinDataAge() time.Time {
 	return time.Now().AddDate(0, -retentionMonths, 0)
 }
 
+// HeartbeatQuota returns the maximum number of heartbeats the user may store, 0 for unlimited
+func (u *User) HeartbeatQuota() int64 {
+	if u.HasActiveSubscription() {
+		return int64(conf.Get().App.MaxHeartbeatsSubscribed)
+	}
+	return int64(conf.Get().App.MaxHeartbeats)
+}
+
+// IsSoftDeleted returns true if the user has requested their account to be deleted, but it is still within the recovery window
+func (u *User) IsSoftDeleted() bool {
+	return u.SoftDeletedAt != nil
+}
+
+// HardDeletionDue returns the point in time after which a soft-deleted user's account and data will be removed permanently
+func (u *User) HardDeletionDue() time.Time {
+	if u.SoftDeletedAt == nil {
+		return time.Time{}
+	}
+	return u.SoftDeletedAt.T().AddDate(0, 0, conf.Get().App.AccountDeletionGraceDays)
+}
+
 func (u *User) AnyDataShared() bool {
 	return u.ShareDataMaxDays != 0 && (u.ShareEditors || u.ShareLanguages || u.ShareProjects || u.ShareOSs || u.ShareMachines || u.ShareLabels)
 }
 
+func (u *User) ProjectNormalization() ProjectNormalization {
+	return ProjectNormalization{
+		Trim:        u.ProjectNameTrim,
+		StripPrefix: u.ProjectNamePrefix,
+		Lowercase:   u.ProjectNameLowercase,
+	}
+}
+
+func (u *User) EntityNormalization() EntityNormalization {
+	return EntityNormalization{
+		StripQuery: u.EntityStripQuery,
+		StripHost:  u.EntityStripHost,
+	}
+}
+
+func (u *User) ProjectDerivation() ProjectDerivation {
+	return ProjectDerivation{
+		Root:    u.ProjectPathRoot,
+		Segment: u.ProjectPathSegment,
+	}
+}
+
+// BelongsTo returns whether the user is a member of the given org
+func (u *User) BelongsTo(orgId string) bool {
+	return u.OrgID != nil && *u.OrgID == orgId
+}
+
+// OrgScope returns the org whose members the user may see in org-bounded views, i.e. their own org or none ("") for users not belonging to any
+func (u *User) OrgScope() string {
+	if u.OrgID == nil {
+		return ""
+	}
+	return *u.OrgID
+}
+
+// CanManageOrg returns whether the user is allowed to manage the given org's members, which is super admins and the org's own admins
+func (u *User) CanManageOrg(orgId string) bool {
+	return u.IsAdmin || (u.OrgAdmin && u.BelongsTo(orgId))
+}
+
+// CanManageUser returns whether the user is allowed to perform admin actions on the given other user
+func (u *User) CanManageUser(other *User) bool {
+	if u.IsAdmin {
+		return true
+	}
+	return !other.IsAdmin && other.OrgID != nil && u.CanManageOrg(*other.OrgID)
+}
+
+// AnonymizedTypes returns the summary types whose keys are to be replaced by pseudonyms when shown to anyone but the user themselves
+func (u *User) AnonymizedTypes() []uint8 {
+	types := make([]uint8, 0)
+	if u.AnonymizeProjects {
+		types = append(types, SummaryProject, SummaryLabel, SummaryBranch, SummaryEntity)
+	}
+	if u.AnonymizeLanguages {
+		types = append(types, SummaryLanguage)
+	}
+	if u.AnonymizeEditors {
+		types = append(types, SummaryEditor)
+	}
+	return types
+}
+
 func (c *CredentialsReset) IsValid() bool {
 	return ValidatePassword(c.PasswordNew) &&
 		c.PasswordNew == c.PasswordRepeat
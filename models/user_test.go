@@ -21,6 +21,12 @@ func TestUser_TZ(t *testing.T) {
 	assert.InDelta(t, time.Duration(offset2*int(time.Second)), sut2.TZOffset(), float64(1*time.Second))
 }
 
+func TestUser_HasLocation(t *testing.T) {
+	assert.False(t, (&User{}).HasLocation())
+	assert.False(t, (&User{Location: "Local"}).HasLocation())
+	assert.True(t, (&User{Location: "Europe/Berlin"}).HasLocation())
+}
+
 func TestUser_MinDataAge(t *testing.T) {
 	c := conf.Load("", "")
 
@@ -58,3 +64,75 @@ func TestUser_MinDataAge(t *testing.T) {
 	sut = &User{SubscribedUntil: &until1}
 	assert.Zero(t, sut.MinDataAge())
 }
+
+func TestUser_HardDeletionDue(t *testing.T) {
+	c := conf.Load("", "")
+	c.App.AccountDeletionGraceDays = 7
+
+	sut := &User{}
+	assert.False(t, sut.IsSoftDeleted())
+	assert.Zero(t, sut.HardDeletionDue())
+
+	deletedAt := CustomTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	sut = &User{SoftDeletedAt: &deletedAt}
+	assert.True(t, sut.IsSoftDeleted())
+	assert.Equal(t, time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC), sut.HardDeletionDue())
+}
+
+func TestUser_IsSubscriptionTrial(t *testing.T) {
+	future := CustomTime(time.Now().Add(24 * time.Hour))
+	past := CustomTime(time.Now().Add(-24 * time.Hour))
+
+	assert.False(t, (&User{}).IsSubscriptionTrial())
+	assert.False(t, (&User{SubscribedUntil: &future}).IsSubscriptionTrial())
+	assert.True(t, (&User{SubscribedUntil: &future, SubscriptionTrialEnd: &future}).IsSubscriptionTrial())
+	assert.False(t, (&User{SubscribedUntil: &future, SubscriptionTrialEnd: &past}).IsSubscriptionTrial())
+	assert.False(t, (&User{SubscribedUntil: &past, SubscriptionTrialEnd: &future}).IsSubscriptionTrial())
+}
+
+func TestUser_ActiveDayThreshold(t *testing.T) {
+	c := conf.Load("", "")
+	c.App.ActiveDayThresholdSec = 300
+
+	sut := &User{}
+	assert.Equal(t, 5*time.Minute, sut.ActiveDayThreshold())
+
+	sut.ActiveDayThresholdSec = 60
+	assert.Equal(t, 1*time.Minute, sut.ActiveDayThreshold())
+}
+
+func TestUser_HasOutdatedPlugin(t *testing.T) {
+	minVersions := map[string]string{"vscode-wakatime": "24.0.0", "goland-wakatime": "11.0.1"}
+
+	assert.True(t, (&User{LastPlugin: "vscode-wakatime", LastPluginVersion: "23.9.12"}).HasOutdatedPlugin(minVersions))
+	assert.True(t, (&User{LastPlugin: "GoLand-wakatime", LastPluginVersion: "11.0.0"}).HasOutdatedPlugin(minVersions))
+	assert.False(t, (&User{LastPlugin: "vscode-wakatime", LastPluginVersion: "24.0.0"}).HasOutdatedPlugin(minVersions))
+	assert.False(t, (&User{LastPlugin: "emacs-wakatime", LastPluginVersion: "0.0.1"}).HasOutdatedPlugin(minVersions))
+	assert.False(t, (&User{}).HasOutdatedPlugin(minVersions))
+}
+
+func TestUser_CanManageOrg(t *testing.T) {
+	org1, org2 := "org1", "org2"
+
+	superAdmin := &User{ID: "admin", IsAdmin: true}
+	orgAdmin := &User{ID: "org_admin", OrgID: &org1, OrgAdmin: true}
+	member := &User{ID: "member", OrgID: &org1}
+	otherMember := &User{ID: "other_member", OrgID: &org2}
+	noMember := &User{ID: "no_member"}
+	orgSuperAdmin := &User{ID: "org_super_admin", OrgID: &org1, IsAdmin: true}
+
+	assert.True(t, superAdmin.CanManageOrg(org1))
+	assert.True(t, superAdmin.CanManageOrg(org2))
+	assert.True(t, orgAdmin.CanManageOrg(org1))
+	assert.False(t, orgAdmin.CanManageOrg(org2))
+	assert.False(t, member.CanManageOrg(org1))
+	assert.False(t, noMember.CanManageOrg(org1))
+
+	assert.True(t, superAdmin.CanManageUser(otherMember))
+	assert.True(t, superAdmin.CanManageUser(noMember))
+	assert.True(t, orgAdmin.CanManageUser(member))
+	assert.False(t, orgAdmin.CanManageUser(otherMember))
+	assert.False(t, orgAdmin.CanManageUser(noMember))
+	assert.False(t, orgAdmin.CanManageUser(orgSuperAdmin))
+	assert.False(t, member.CanManageUser(orgAdmin))
+}
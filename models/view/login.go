@@ -8,6 +8,11 @@ type LoginViewModel struct {
 	InviteCode  string
 }
 
+type RestoreAccountViewModel struct {
+	LoginViewModel
+	DeletionDue string
+}
+
 type SetPasswordViewModel struct {
 	LoginViewModel
 	Token string
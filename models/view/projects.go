@@ -11,9 +11,15 @@ import (
 
 type ProjectsViewModel struct {
 	SharedLoggedInViewModel
-	Projects   []*models.ProjectStats
-	PageParams *utils.PageParams
-	maxCount   int64
+	Projects         []*models.ProjectStats
+	PageParams       *utils.PageParams
+	ArchivedProjects map[string]bool
+	IncludeArchived  bool
+	maxCount         int64
+}
+
+func (s *ProjectsViewModel) IsArchived(project string) bool {
+	return s.ArchivedProjects[project]
 }
 
 func (s *ProjectsViewModel) LangIcon(lang string) string {
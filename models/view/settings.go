@@ -7,15 +7,26 @@ import (
 
 type SettingsViewModel struct {
 	SharedLoggedInViewModel
-	LanguageMappings    []*models.LanguageMapping
-	Aliases             []*SettingsVMCombinedAlias
-	Labels              []*SettingsVMCombinedLabel
-	Projects            []string
-	SubscriptionPrice   string
-	DataRetentionMonths int
-	UserFirstData       time.Time
-	SupportContact      string
-	InviteLink          string
+	LanguageMappings         []*models.LanguageMapping
+	Aliases                  []*SettingsVMCombinedAlias
+	Labels                   []*SettingsVMCombinedLabel
+	DefaultBranches          []*models.ProjectDefaultBranch
+	Projects                 []string
+	SubscriptionPrice        string
+	SubscriptionTrialDays    int
+	DataRetentionMonths      int
+	AccountDeletionGraceDays int
+	ExportLinkExpiryHours    int
+	ActiveDayThresholdSec    int // server default
+	InactivityReminderDays   int // 0 if disabled on the server
+	UnknownLabel             string
+	UserFirstData            time.Time
+	SupportContact           string
+	InviteLink               string
+	TotpSecret               string
+	TotpUri                  string
+	RecoveryCodes            []string
+	ImportFormats            []*SettingsVMImportFormat
 }
 
 type SettingsVMCombinedAlias struct {
@@ -24,6 +35,12 @@ type SettingsVMCombinedAlias struct {
 	Values []string
 }
 
+type SettingsVMImportFormat struct {
+	Name   string
+	Title  string
+	Accept string
+}
+
 type SettingsVMCombinedLabel struct {
 	Key    string
 	Values []string
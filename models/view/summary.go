@@ -17,6 +17,27 @@ type SummaryViewModel struct {
 	RawQuery            string
 	UserFirstData       time.Time
 	DataRetentionMonths int
+	AverageDays         int // number of days to compute the daily average over, according to the user's averaging mode, see models.AverageDays
+}
+
+func (s SummaryViewModel) DailyAverage() time.Duration {
+	if s.AverageDays <= 0 {
+		return 0
+	}
+	return s.TotalTime() / time.Duration(s.AverageDays)
+}
+
+// AverageModeLabel describes which days the daily average refers to
+func (s SummaryViewModel) AverageModeLabel() string {
+	if s.SharedLoggedInViewModel.User != nil {
+		switch s.SharedLoggedInViewModel.User.AverageMode {
+		case models.AverageModeActiveDays:
+			return "per active day"
+		case models.AverageModeSinceFirst:
+			return "per day since first heartbeat"
+		}
+	}
+	return "per day"
 }
 
 func (s SummaryViewModel) UserDataExpiring() bool {
@@ -28,6 +49,19 @@ func (s SummaryViewModel) UserDataExpiring() bool {
 		time.Now().AddDate(0, -cfg.App.DataRetentionMonths, 0).After(s.UserFirstData)
 }
 
+// RangePresets returns the names of the user's custom time ranges
+func (s SummaryViewModel) RangePresets() []string {
+	if s.SharedLoggedInViewModel.User == nil {
+		return nil
+	}
+	presets, _ := models.ParseRangePresets(s.SharedLoggedInViewModel.User.RangePresets)
+	return presets.Names()
+}
+
+func (s SummaryViewModel) PluginOutdated() bool {
+	return s.SharedLoggedInViewModel.User.HasOutdatedPlugin(conf.Get().App.GetMinPluginVersions())
+}
+
 func (s *SummaryViewModel) WithSuccess(m string) *SummaryViewModel {
 	s.SetSuccess(m)
 	return s
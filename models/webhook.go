@@ -0,0 +1,83 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/duke-git/lancet/v2/slice"
+)
+
+const (
+	WebhookEventDailySummary   = "summary.daily"   // a user's summary for the previous day was aggregated
+	WebhookEventProjectStarted = "project.started" // a user started working on a project, which they opted in for activity notifications
+	WebhookEventProjectStopped = "project.stopped" // a user stopped working on such project, i.e. didn't send heartbeats for it for a while
+	WebhookEventPing           = "ping"            // sent on request only, to test a webhook
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed" // all attempts failed, no further retries
+)
+
+const MaxWebhooksPerUser = 10
+
+// WebhookEvents are all events a webhook can subscribe to
+var WebhookEvents = []string{WebhookEventDailySummary, WebhookEventProjectStarted, WebhookEventProjectStopped}
+
+// Webhook is a user-registered url to which Wakapi sends POST requests upon certain events. Payloads are signed with the webhook's secret.
+type Webhook struct {
+	ID        uint       `json:"id" gorm:"primary_key"`
+	User      *User      `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID    string     `json:"-" gorm:"not null; index:idx_webhook_user"`
+	Url       string     `json:"url" gorm:"not null; size:2048"`
+	Secret    string     `json:"-"`                  // only revealed once, upon creation
+	Events    string     `json:"-" gorm:"size:1024"` // comma-separated, see WebhookEvents
+	CreatedAt CustomTime `json:"created_at" gorm:"default:CURRENT_TIMESTAMP" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+}
+
+// WebhookDelivery records an event to be sent to a webhook and the outcome of the (latest) attempt to do so
+type WebhookDelivery struct {
+	ID            uint        `json:"id" gorm:"primary_key"`
+	Webhook       *Webhook    `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	WebhookID     uint        `json:"-" gorm:"not null; index:idx_webhook_delivery_webhook"`
+	Event         string      `json:"event"`
+	Payload       string      `json:"-" gorm:"type:text"`
+	Status        string      `json:"status" gorm:"index:idx_webhook_delivery_status"` // one of WebhookDeliveryPending, WebhookDeliverySucceeded, WebhookDeliveryFailed
+	Attempts      int         `json:"attempts"`
+	StatusCode    int         `json:"status_code"` // response status of the latest attempt, 0 if none was received
+	Error         string      `json:"error"`
+	NextAttemptAt *CustomTime `json:"next_attempt_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	CreatedAt     CustomTime  `json:"created_at" gorm:"default:CURRENT_TIMESTAMP; index:idx_webhook_delivery_created_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+}
+
+// ProjectActivity is the data of project.started and project.stopped events
+type ProjectActivity struct {
+	Project   string      `json:"project"`
+	StartedAt CustomTime  `json:"started_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	StoppedAt *CustomTime `json:"stopped_at,omitempty" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"` // time of the last heartbeat, only set once stopped
+	Duration  int64       `json:"duration"`                                                                                  // in seconds, 0 when started
+}
+
+func (w *Webhook) EventList() []string {
+	if w.Events == "" {
+		return []string{}
+	}
+	return strings.Split(w.Events, ",")
+}
+
+// Subscribes tells whether the webhook wants to be notified about the given event, pings are always accepted
+func (w *Webhook) Subscribes(event string) bool {
+	return event == WebhookEventPing || slice.Contain(w.EventList(), event)
+}
+
+func (w *Webhook) IsValid() bool {
+	u, err := url.Parse(w.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	events := w.EventList()
+	return w.UserID != "" && w.Secret != "" && len(events) > 0 && slice.Every(events, func(_ int, e string) bool {
+		return slice.Contain(WebhookEvents, e)
+	})
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const YearReviewTopItems = 5
+
+// YearReview recaps a user's calendar year, e.g. for a shareable "year in review" page or image
+type YearReview struct {
+	Year          int                 `json:"year"`
+	From          CustomTime          `json:"from" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	To            CustomTime          `json:"to" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"` // now, if the year isn't over yet
+	Total         int64               `json:"total"`                                                                   // seconds
+	Hours         float64             `json:"hours"`                                                                   // rounded to one decimal
+	ActiveDays    int                 `json:"active_days"`                                                             // according to the user's active day threshold
+	Projects      SummaryItems        `json:"projects"`                                                                // top ones only
+	Languages     SummaryItems        `json:"languages"`                                                               // top ones only
+	Months        []*YearReviewPeriod `json:"months"`
+	BusiestMonth  *YearReviewPeriod   `json:"busiest_month"` // nil without any activity
+	BusiestDay    *YearReviewPeriod   `json:"busiest_day"`   // nil without any activity
+	LongestStreak *YearReviewStreak   `json:"longest_streak"`
+}
+
+type YearReviewPeriod struct {
+	Period string `json:"period" example:"2024-03"` // '2024-03' for months or '2024-03-15' for days
+	Total  int64  `json:"total"`                    // seconds
+}
+
+type YearReviewStreak struct {
+	Days int        `json:"days"`
+	From CustomTime `json:"from" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"` // beginning of the streak's first day, zero without any active day
+	To   CustomTime `json:"to" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`   // end of the streak's last day
+}
+
+// NewYearReview assembles the review from the year's total rollup, its monthly rollups and its daily totals.
+// Streaks only count days with at least the given threshold of coding time, see Summary.IsActiveDay.
+func NewYearReview(year int, total *SummaryRollup, months []*SummaryRollup, days *CumulativeSummary, threshold time.Duration) *YearReview {
+	review := &YearReview{
+		Year:          year,
+		From:          total.From,
+		To:            total.To,
+		Total:         total.Total,
+		Hours:         math.Round(float64(total.Total)/360) / 10,
+		ActiveDays:    days.ActiveDays(threshold),
+		Projects:      topYearReviewItems(total.Projects),
+		Languages:     topYearReviewItems(total.Languages),
+		Months:        make([]*YearReviewPeriod, len(months)),
+		LongestStreak: &YearReviewStreak{},
+	}
+
+	for i, m := range months {
+		review.Months[i] = &YearReviewPeriod{Period: m.Period, Total: m.Total}
+		if m.Total > 0 && (review.BusiestMonth == nil || m.Total > review.BusiestMonth.Total) {
+			review.BusiestMonth = review.Months[i]
+		}
+	}
+
+	var streak int
+	for i, d := range days.Days {
+		if d.Total > 0 && (review.BusiestDay == nil || int64(d.Total.Seconds()) > review.BusiestDay.Total) {
+			review.BusiestDay = &YearReviewPeriod{Period: d.Date.Format(time.DateOnly), Total: int64(d.Total.Seconds())}
+		}
+
+		if d.Total == 0 || d.Total < threshold {
+			streak = 0
+			continue
+		}
+		streak++
+		if streak > review.LongestStreak.Days {
+			review.LongestStreak = &YearReviewStreak{
+				Days: streak,
+				From: CustomTime(days.Days[i-streak+1].Date),
+				To:   CustomTime(d.Date.AddDate(0, 0, 1)),
+			}
+		}
+	}
+
+	return review
+}
+
+// topYearReviewItems returns copies of the items with the most coding time
+func topYearReviewItems(items SummaryItems) SummaryItems {
+	top := make(SummaryItems, len(items))
+	for i, item := range items {
+		top[i] = &SummaryItem{Type: item.Type, Key: item.Key, Total: item.Total}
+	}
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].Total > top[j].Total
+	})
+	if len(top) > YearReviewTopItems {
+		top = top[:YearReviewTopItems]
+	}
+	return top
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewYearReview(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	total := &SummaryRollup{
+		Period: "2024",
+		From:   CustomTime(from),
+		To:     CustomTime(to),
+		Total:  9000,
+		Projects: SummaryItems{
+			{Type: SummaryProject, Key: "wakapi", Total: 1800},
+			{Type: SummaryProject, Key: "anchr", Total: 5400},
+		},
+		Languages: SummaryItems{
+			{Type: SummaryLanguage, Key: "Go", Total: 9000},
+		},
+	}
+	for i := 0; i < 6; i++ {
+		total.Languages = append(total.Languages, &SummaryItem{Type: SummaryLanguage, Key: string(rune('A' + i)), Total: time.Duration(i)})
+	}
+	months := []*SummaryRollup{
+		{Period: "2024-01", Total: 1800},
+		{Period: "2024-02", Total: 7200},
+		{Period: "2024-03", Total: 0},
+	}
+
+	days := NewCumulativeSummary(from, to)
+	days.Add(from, 30*time.Minute)
+	days.Add(from.AddDate(0, 0, 1), 0)
+	days.Add(from.AddDate(0, 0, 2), 1*time.Hour)
+	days.Add(from.AddDate(0, 0, 3), 4*time.Second)
+	days.Add(from.AddDate(0, 0, 4), 1*time.Hour)
+	days.Add(from.AddDate(0, 0, 5), 10*time.Minute)
+
+	review := NewYearReview(2024, total, months, days, 1*time.Minute)
+
+	assert.Equal(t, 2024, review.Year)
+	assert.Equal(t, int64(9000), review.Total)
+	assert.Equal(t, 2.5, review.Hours)
+	assert.Equal(t, 4, review.ActiveDays)
+
+	assert.Len(t, review.Projects, 2)
+	assert.Equal(t, "anchr", review.Projects[0].Key)
+	assert.Len(t, review.Languages, YearReviewTopItems)
+	assert.Equal(t, "Go", review.Languages[0].Key)
+	assert.Equal(t, time.Duration(1800), total.Projects[0].Total) // original left untouched
+
+	assert.Len(t, review.Months, 3)
+	assert.Equal(t, &YearReviewPeriod{Period: "2024-02", Total: 7200}, review.BusiestMonth)
+	assert.Equal(t, &YearReviewPeriod{Period: "2024-01-03", Total: 3600}, review.BusiestDay)
+
+	// day 4 is below the threshold
+	assert.Equal(t, 2, review.LongestStreak.Days)
+	assert.Equal(t, from.AddDate(0, 0, 4), review.LongestStreak.From.T())
+	assert.Equal(t, from.AddDate(0, 0, 6), review.LongestStreak.To.T())
+}
+
+func TestNewYearReview_Empty(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	days := NewCumulativeSummary(from, to)
+	days.Add(from, 0)
+
+	review := NewYearReview(2024, &SummaryRollup{From: CustomTime(from), To: CustomTime(to)}, []*SummaryRollup{{Period: "2024-01"}}, days, 0)
+
+	assert.Zero(t, review.Total)
+	assert.Empty(t, review.Projects)
+	assert.Nil(t, review.BusiestMonth)
+	assert.Nil(t, review.BusiestDay)
+	assert.Zero(t, review.LongestStreak.Days)
+}
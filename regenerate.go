@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+)
+
+// regenerateSummaries recomputes and persists daily summaries between the given dates (both inclusive, interpreted in server-local time, like persisted summaries) for either a single or all users.
+// It is intended to be run from the command line (see -regenerate-summaries flag). Summaries are replaced day by day, so another Wakapi instance serving the same database
+// keeps working meanwhile. However, the aggregation lock only applies within this process, so it should not be run while that instance is generating summaries (see app.aggregation_time).
+func regenerateSummaries(fromDate, toDate, userId string) error {
+	from, err := time.Parse(conf.SimpleDateFormat, fromDate)
+	if err != nil {
+		return errors.New("invalid or missing -from date")
+	}
+	to, err := time.Parse(conf.SimpleDateFormat, toDate)
+	if err != nil {
+		return errors.New("invalid or missing -to date")
+	}
+	if to.Before(from) {
+		return errors.New("-to date must not be before -from date")
+	}
+	if !time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.Local).Before(utils.BeginOfToday(time.Local)) {
+		return errors.New("-to date must be before today, as today's summary is not complete, yet")
+	}
+
+	var users []*models.User
+	if userId != "" {
+		user, err := userService.GetUserById(userId)
+		if err != nil {
+			return fmt.Errorf("user '%s' not found", userId)
+		}
+		users = []*models.User{user}
+	} else if users, err = userService.GetAll(); err != nil {
+		return err
+	}
+
+	var total int
+	for i, user := range users {
+		userFrom := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+		userTo := time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, time.Local)
+
+		slog.Info("regenerating summaries", "userID", user.ID, "user", fmt.Sprintf("%d/%d", i+1, len(users)), "from", userFrom, "to", userTo)
+
+		n, err := aggregationService.RegenerateSummaries(user, userFrom, userTo, func(done, all int) {
+			if done%30 == 0 || done == all {
+				slog.Info("regenerating summaries", "userID", user.ID, "days", fmt.Sprintf("%d/%d", done, all))
+			}
+		})
+		total += n
+		if err != nil {
+			conf.Log().Error("failed to regenerate summaries", "userID", user.ID, "error", err)
+			continue
+		}
+	}
+
+	slog.Info("finished regenerating summaries", "users", len(users), "summaries", total)
+	return nil
+}
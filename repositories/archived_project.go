@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ArchivedProjectRepository struct {
+	config *config.Config
+	db     *gorm.DB
+}
+
+func NewArchivedProjectRepository(db *gorm.DB) *ArchivedProjectRepository {
+	return &ArchivedProjectRepository{config: config.Get(), db: db}
+}
+
+func (r *ArchivedProjectRepository) GetByUser(userId string) ([]*models.ArchivedProject, error) {
+	if userId == "" {
+		return []*models.ArchivedProject{}, nil
+	}
+	var projects []*models.ArchivedProject
+	if err := r.db.
+		Where(&models.ArchivedProject{UserID: userId}).
+		Find(&projects).Error; err != nil {
+		return projects, err
+	}
+	return projects, nil
+}
+
+func (r *ArchivedProjectRepository) Upsert(project *models.ArchivedProject) (*models.ArchivedProject, error) {
+	if !project.IsValid() {
+		return nil, errors.New("invalid archived project")
+	}
+	result := r.db.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "project"}},
+			DoUpdates: clause.AssignmentColumns([]string{"archived", "automatic", "updated_at"}),
+		}).
+		Create(project)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+	return project, nil
+}
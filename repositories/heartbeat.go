@@ -16,11 +16,18 @@ import (
 
 type HeartbeatRepository struct {
 	db     *gorm.DB
+	reads  *readRouter
 	config *conf.Config
 }
 
 func NewHeartbeatRepository(db *gorm.DB) *HeartbeatRepository {
-	return &HeartbeatRepository{config: conf.Get(), db: db}
+	return &HeartbeatRepository{config: conf.Get(), db: db, reads: newReadRouter(db)}
+}
+
+// WithReadReplica makes expensive statistics queries be served by the given replica database
+func (r *HeartbeatRepository) WithReadReplica(replica *gorm.DB) *HeartbeatRepository {
+	r.reads.withReplica(replica)
+	return r
 }
 
 // Use with caution!!
@@ -33,31 +40,44 @@ func (r *HeartbeatRepository) GetAll() ([]*models.Heartbeat, error) {
 }
 
 func (r *HeartbeatRepository) InsertBatch(heartbeats []*models.Heartbeat) error {
+	_, err := r.InsertBatchCounted(heartbeats)
+	return err
+}
+
+// InsertBatchCounted inserts the heartbeats like InsertBatch and returns the number of them actually written, i.e. excluding already existing ones
+func (r *HeartbeatRepository) InsertBatchCounted(heartbeats []*models.Heartbeat) (int64, error) {
+	r.reads.markWrite(slice.Unique(slice.Map(heartbeats, func(i int, h *models.Heartbeat) string {
+		return h.UserID
+	}))...)
 
 	// sqlserver on conflict has bug https://github.com/go-gorm/sqlserver/issues/100
 	// As a workaround, insert one by one, and ignore duplicate key error
 	if r.db.Dialector.Name() == (sqlserver.Dialector{}).Name() {
+		var n int64
 		for _, h := range heartbeats {
 			err := r.db.Create(h).Error
 			if err != nil {
 				if strings.Contains(err.Error(), "Cannot insert duplicate key row in object 'dbo.heartbeats' with unique index 'idx_heartbeats_hash'") {
 					// ignored
 				} else {
-					return err
+					return n, err
 				}
+			} else {
+				n++
 			}
 		}
-		return nil
+		return n, nil
 	}
 
-	if err := r.db.
+	result := r.db.
 		Clauses(clause.OnConflict{
 			DoNothing: true,
 		}).
-		Create(&heartbeats).Error; err != nil {
-		return err
+		Create(&heartbeats)
+	if err := result.Error; err != nil {
+		return 0, err
 	}
-	return nil
+	return result.RowsAffected, nil
 }
 
 func (r *HeartbeatRepository) GetLatestByUser(user *models.User) (*models.Heartbeat, error) {
@@ -97,6 +117,40 @@ func (r *HeartbeatRepository) GetAllWithin(from, to time.Time, user *models.User
 		Where("time >= ?", from.Local()).
 		Where("time < ?", to.Local()).
 		Order("time asc").
+		Order("id asc").
+		Find(&heartbeats).Error; err != nil {
+		return nil, err
+	}
+	return heartbeats, nil
+}
+
+// GetAllWithinPaginated returns at most limit heartbeats within the given interval, ordered by time and id, starting after the given cursor (if any)
+func (r *HeartbeatRepository) GetAllWithinPaginated(from, to time.Time, user *models.User, after *models.HeartbeatCursor, limit int) ([]*models.Heartbeat, error) {
+	return r.GetAllWithinByEntityPaginated(from, to, user, "", after, limit)
+}
+
+// GetAllWithinByEntityPaginated is like GetAllWithinPaginated, but only returns heartbeats whose entity contains the given substring (case-insensitively), unless empty
+func (r *HeartbeatRepository) GetAllWithinByEntityPaginated(from, to time.Time, user *models.User, entity string, after *models.HeartbeatCursor, limit int) ([]*models.Heartbeat, error) {
+	var heartbeats []*models.Heartbeat
+
+	q := r.db.
+		Where(&models.Heartbeat{UserID: user.ID}).
+		Where("time >= ?", from.Local()).
+		Where("time < ?", to.Local())
+
+	// can't make use of an index on entity, but the range is already narrowed down by the user and time index
+	if entity != "" {
+		q = q.Where("lower(entity) like ? escape '!'", "%"+utils.EscapeLike(strings.ToLower(entity))+"%")
+	}
+
+	if after != nil {
+		q = q.Where("time > ? or (time = ? and id > ?)", after.Time.Local(), after.Time.Local(), after.ID)
+	}
+
+	if err := q.
+		Order("time asc").
+		Order("id asc").
+		Limit(limit).
 		Find(&heartbeats).Error; err != nil {
 		return nil, err
 	}
@@ -134,6 +188,22 @@ func (r *HeartbeatRepository) GetLatestByFilters(user *models.User, filterMap ma
 	return heartbeat, nil
 }
 
+// GetLatestReceivedWithin returns the heartbeat within the given range, which was received last (as opposed to the one with the latest time)
+func (r *HeartbeatRepository) GetLatestReceivedWithin(from, to time.Time, user *models.User) (*models.Heartbeat, error) {
+	var heartbeat *models.Heartbeat
+
+	if err := r.db.
+		Where(&models.Heartbeat{UserID: user.ID}).
+		Where("time >= ?", from.Local()).
+		Where("time < ?", to.Local()).
+		Order("created_at desc").
+		Limit(1).
+		Scan(&heartbeat).Error; err != nil {
+		return nil, err
+	}
+	return heartbeat, nil
+}
+
 func (r *HeartbeatRepository) GetFirstByUsers() ([]*models.TimeByUser, error) {
 	var result []*models.TimeByUser
 	r.db.Raw("with agg as (select " + utils.QuoteSql(r.db, "user_id, min(time) as %s", "time") + " from heartbeats group by user_id) " +
@@ -220,6 +290,21 @@ func (r *HeartbeatRepository) GetEntitySetByUser(entityType uint8, userId string
 	return results, nil
 }
 
+// GetExistingHashes returns the subset of the given heartbeat hashes that are already present in the database
+func (r *HeartbeatRepository) GetExistingHashes(hashes []string) ([]string, error) {
+	var results []string
+	if len(hashes) == 0 {
+		return results, nil
+	}
+	if err := r.db.
+		Model(&models.Heartbeat{}).
+		Where("hash in ?", hashes).
+		Pluck("hash", &results).Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (r *HeartbeatRepository) DeleteBefore(t time.Time) error {
 	if err := r.db.
 		Where("time <= ?", t.Local()).
@@ -230,6 +315,7 @@ func (r *HeartbeatRepository) DeleteBefore(t time.Time) error {
 }
 
 func (r *HeartbeatRepository) DeleteByUser(user *models.User) error {
+	r.reads.markWrite(user.ID)
 	if err := r.db.
 		Where("user_id = ?", user.ID).
 		Delete(models.Heartbeat{}).Error; err != nil {
@@ -239,6 +325,7 @@ func (r *HeartbeatRepository) DeleteByUser(user *models.User) error {
 }
 
 func (r *HeartbeatRepository) DeleteByUserBefore(user *models.User, t time.Time) error {
+	r.reads.markWrite(user.ID)
 	if err := r.db.
 		Where("user_id = ?", user.ID).
 		Where("time <= ?", t.Local()).
@@ -312,7 +399,7 @@ func (r *HeartbeatRepository) GetUserProjectStats(user *models.User, from, to ti
 
 	query += limitOffsetClause
 
-	if err := r.db.
+	if err := r.reads.forUser(user.ID).
 		Raw(query, args...).
 		Scan(&projectStats).Error; err != nil {
 		return nil, err
@@ -7,12 +7,23 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+// participants are only counted if they have any coding time, analogous to the leaderboard cutting off empty entries
+const rankedColumns = "rank() over (partition by \"key\" order by total desc) as \"rank\", " +
+	"sum(case when total > 0 then 1 else 0 end) over (partition by \"key\") as \"participants\""
+
 type LeaderboardRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *readRouter
 }
 
 func NewLeaderboardRepository(db *gorm.DB) *LeaderboardRepository {
-	return &LeaderboardRepository{db: db}
+	return &LeaderboardRepository{db: db, reads: newReadRouter(db)}
+}
+
+// WithReadReplica makes leaderboard retrieval queries be served by the given replica database
+func (r *LeaderboardRepository) WithReadReplica(replica *gorm.DB) *LeaderboardRepository {
+	r.reads.withReplica(replica)
+	return r
 }
 
 func (r *LeaderboardRepository) InsertBatch(items []*models.LeaderboardItem) error {
@@ -43,17 +54,20 @@ func (r *LeaderboardRepository) CountUsers(excludeZero bool) (int64, error) {
 	return count, err
 }
 
-func (r *LeaderboardRepository) GetAllAggregatedByInterval(key *models.IntervalKey, by *uint8, limit, skip int) ([]*models.LeaderboardItemRanked, error) {
+// GetAllAggregatedByInterval ranks all users, or only members of the given org, if any ("" for users not belonging to any org)
+func (r *LeaderboardRepository) GetAllAggregatedByInterval(key *models.IntervalKey, by *uint8, orgId *string, limit, skip int) ([]*models.LeaderboardItemRanked, error) {
 	// TODO: distinct by (user, key) to filter out potential duplicates ?
 
 	var items []*models.LeaderboardItemRanked
-	subq := r.db.
+	db := r.reads.any()
+	subq := db.
 		Table("leaderboard_items").
-		Select("*, rank() over (partition by \"key\" order by total desc) as \"rank\"").
+		Select("*, "+rankedColumns).
 		Where("\"interval\" in ?", *key)
 	subq = utils.WhereNullable(subq, "\"by\"", by)
+	subq = r.withOrgScope(db, subq, orgId)
 
-	q := r.db.Table("(?) as ranked", subq)
+	q := db.Table("(?) as ranked", subq)
 	q = r.withPaging(q, limit, skip)
 
 	if err := q.Find(&items).Error; err != nil {
@@ -64,13 +78,14 @@ func (r *LeaderboardRepository) GetAllAggregatedByInterval(key *models.IntervalK
 
 func (r *LeaderboardRepository) GetAggregatedByUserAndInterval(userId string, key *models.IntervalKey, by *uint8, limit, skip int) ([]*models.LeaderboardItemRanked, error) {
 	var items []*models.LeaderboardItemRanked
-	subq := r.db.
+	db := r.reads.any()
+	subq := db.
 		Table("leaderboard_items").
-		Select("*, rank() over (partition by \"key\" order by total desc) as \"rank\"").
+		Select("*, "+rankedColumns).
 		Where("\"interval\" in ?", *key)
 	subq = utils.WhereNullable(subq, "\"by\"", by)
 
-	q := r.db.Table("(?) as ranked", subq).Where("user_id = ?", userId)
+	q := db.Table("(?) as ranked", subq).Where("user_id = ?", userId)
 	q = r.withPaging(q, limit, skip)
 
 	if err := q.Find(&items).Error; err != nil {
@@ -98,6 +113,20 @@ func (r *LeaderboardRepository) DeleteByUserAndInterval(userId string, key *mode
 	return nil
 }
 
+// withOrgScope filters before ranking, so that ranks are relative to the org
+func (r *LeaderboardRepository) withOrgScope(db, q *gorm.DB, orgId *string) *gorm.DB {
+	if orgId == nil {
+		return q
+	}
+	members := db.Table("users").Select("id")
+	if *orgId == "" {
+		members = members.Where("org_id is null")
+	} else {
+		members = members.Where("org_id = ?", *orgId)
+	}
+	return q.Where("user_id in (?)", members)
+}
+
 func (r *LeaderboardRepository) withPaging(q *gorm.DB, limit, skip int) *gorm.DB {
 	if limit > 0 {
 		q = q.Where("\"rank\" <= ?", skip+limit)
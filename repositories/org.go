@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"gorm.io/gorm"
+)
+
+type OrgRepository struct {
+	config *config.Config
+	db     *gorm.DB
+}
+
+func NewOrgRepository(db *gorm.DB) *OrgRepository {
+	return &OrgRepository{config: config.Get(), db: db}
+}
+
+func (r *OrgRepository) GetAll() ([]*models.Org, error) {
+	var orgs []*models.Org
+	if err := r.db.Order("id asc").Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+func (r *OrgRepository) GetById(id string) (*models.Org, error) {
+	org := &models.Org{}
+	if err := r.db.Where(&models.Org{ID: id}).First(org).Error; err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (r *OrgRepository) Insert(org *models.Org) (*models.Org, error) {
+	if !org.IsValid() {
+		return nil, errors.New("invalid org")
+	}
+	if err := r.db.Create(org).Error; err != nil {
+		return nil, err
+	}
+	return org, nil
+}
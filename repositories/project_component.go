@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"gorm.io/gorm"
+)
+
+type ProjectComponentRuleRepository struct {
+	config *config.Config
+	db     *gorm.DB
+}
+
+func NewProjectComponentRuleRepository(db *gorm.DB) *ProjectComponentRuleRepository {
+	return &ProjectComponentRuleRepository{config: config.Get(), db: db}
+}
+
+func (r *ProjectComponentRuleRepository) GetById(id uint) (*models.ProjectComponentRule, error) {
+	rule := &models.ProjectComponentRule{}
+	if err := r.db.Where(&models.ProjectComponentRule{ID: id}).First(rule).Error; err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+func (r *ProjectComponentRuleRepository) GetByUser(userId string) ([]*models.ProjectComponentRule, error) {
+	if userId == "" {
+		return []*models.ProjectComponentRule{}, nil
+	}
+	var rules []*models.ProjectComponentRule
+	if err := r.db.
+		Where(&models.ProjectComponentRule{UserID: userId}).
+		Order("project asc").
+		Order("path_prefix asc").
+		Find(&rules).Error; err != nil {
+		return rules, err
+	}
+	return rules, nil
+}
+
+func (r *ProjectComponentRuleRepository) Insert(rule *models.ProjectComponentRule) (*models.ProjectComponentRule, error) {
+	if !rule.IsValid() {
+		return nil, errors.New("invalid project component rule")
+	}
+	result := r.db.Create(rule)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (r *ProjectComponentRuleRepository) Delete(id uint) error {
+	return r.db.
+		Where("id = ?", id).
+		Delete(models.ProjectComponentRule{}).Error
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ProjectDefaultBranchRepository struct {
+	config *config.Config
+	db     *gorm.DB
+}
+
+func NewProjectDefaultBranchRepository(db *gorm.DB) *ProjectDefaultBranchRepository {
+	return &ProjectDefaultBranchRepository{config: config.Get(), db: db}
+}
+
+func (r *ProjectDefaultBranchRepository) GetByUser(userId string) ([]*models.ProjectDefaultBranch, error) {
+	if userId == "" {
+		return []*models.ProjectDefaultBranch{}, nil
+	}
+	var branches []*models.ProjectDefaultBranch
+	if err := r.db.
+		Where(&models.ProjectDefaultBranch{UserID: userId}).
+		Order("project asc").
+		Find(&branches).Error; err != nil {
+		return branches, err
+	}
+	return branches, nil
+}
+
+func (r *ProjectDefaultBranchRepository) Upsert(branch *models.ProjectDefaultBranch) (*models.ProjectDefaultBranch, error) {
+	if !branch.IsValid() {
+		return nil, errors.New("invalid default branch")
+	}
+	result := r.db.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "project"}},
+			DoUpdates: clause.AssignmentColumns([]string{"branch"}),
+		}).
+		Create(branch)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+	return branch, nil
+}
+
+func (r *ProjectDefaultBranchRepository) Delete(userId, project string) error {
+	if userId == "" || project == "" {
+		return errors.New("invalid input")
+	}
+	return r.db.
+		Where("user_id = ?", userId).
+		Where("project = ?", project).
+		Delete(&models.ProjectDefaultBranch{}).Error
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ProjectMetadataRepository struct {
+	config *config.Config
+	db     *gorm.DB
+}
+
+func NewProjectMetadataRepository(db *gorm.DB) *ProjectMetadataRepository {
+	return &ProjectMetadataRepository{config: config.Get(), db: db}
+}
+
+func (r *ProjectMetadataRepository) GetByUser(userId string) ([]*models.ProjectMetadata, error) {
+	if userId == "" {
+		return []*models.ProjectMetadata{}, nil
+	}
+	var metadata []*models.ProjectMetadata
+	if err := r.db.
+		Where(&models.ProjectMetadata{UserID: userId}).
+		Order("project asc").
+		Find(&metadata).Error; err != nil {
+		return metadata, err
+	}
+	return metadata, nil
+}
+
+func (r *ProjectMetadataRepository) Upsert(metadata *models.ProjectMetadata) (*models.ProjectMetadata, error) {
+	if !metadata.IsValid() {
+		return nil, errors.New("invalid project metadata")
+	}
+	result := r.db.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "project"}},
+			DoUpdates: clause.AssignmentColumns([]string{"color", "icon", "description", "private", "hourly_rate", "currency", "notify_activity"}),
+		}).
+		Create(metadata)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (r *ProjectMetadataRepository) Delete(userId, project string) error {
+	if userId == "" || project == "" {
+		return errors.New("invalid input")
+	}
+	return r.db.
+		Where("user_id = ?", userId).
+		Where("project = ?", project).
+		Delete(&models.ProjectMetadata{}).Error
+}
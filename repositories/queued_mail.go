@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"gorm.io/gorm"
+)
+
+type QueuedMailRepository struct {
+	config *config.Config
+	db     *gorm.DB
+}
+
+func NewQueuedMailRepository(db *gorm.DB) *QueuedMailRepository {
+	return &QueuedMailRepository{config: config.Get(), db: db}
+}
+
+func (r *QueuedMailRepository) Insert(mail *models.QueuedMail) (*models.QueuedMail, error) {
+	if err := r.db.Create(mail).Error; err != nil {
+		return nil, err
+	}
+	return mail, nil
+}
+
+func (r *QueuedMailRepository) Update(mail *models.QueuedMail) error {
+	return r.db.Model(mail).Updates(map[string]interface{}{
+		"status":          mail.Status,
+		"attempts":        mail.Attempts,
+		"error":           mail.Error,
+		"next_attempt_at": mail.NextAttemptAt,
+		"body":            mail.Body,
+	}).Error
+}
+
+// GetByStatus returns the latest mails of the given status, most recent first
+func (r *QueuedMailRepository) GetByStatus(status string, limit int) ([]*models.QueuedMail, error) {
+	var mails []*models.QueuedMail
+	if err := r.db.
+		Where("status = ?", status).
+		Order("created_at desc").
+		Limit(limit).
+		Find(&mails).Error; err != nil {
+		return mails, err
+	}
+	return mails, nil
+}
+
+// GetDue returns pending mails whose next attempt is due at the given time, oldest first
+func (r *QueuedMailRepository) GetDue(t time.Time, limit int) ([]*models.QueuedMail, error) {
+	var mails []*models.QueuedMail
+	if err := r.db.
+		Where("status = ?", models.QueuedMailPending).
+		Where("next_attempt_at <= ?", t.Local()).
+		Order("next_attempt_at asc").
+		Limit(limit).
+		Find(&mails).Error; err != nil {
+		return mails, err
+	}
+	return mails, nil
+}
+
+// DeleteFinishedBefore deletes sent and dead-lettered mails, but keeps pending ones regardless of their age
+func (r *QueuedMailRepository) DeleteFinishedBefore(t time.Time) error {
+	return r.db.
+		Where("status != ?", models.QueuedMailPending).
+		Where("created_at < ?", t.Local()).
+		Delete(models.QueuedMail{}).Error
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"gorm.io/gorm"
+)
+
+// time during which reads for a user are served by the primary after they wrote data, to compensate for replication lag
+const replicaPinDuration = 1 * time.Minute
+
+// readRouter decides whether a read-only query can be served by the (optional) read replica or needs to go to the primary database.
+// Read-after-write consistency is ensured by pinning a user's reads to the primary for a while after any write on their behalf.
+type readRouter struct {
+	primary    *gorm.DB
+	replica    *gorm.DB
+	lastWrites *cache.Cache
+}
+
+func newReadRouter(primary *gorm.DB) *readRouter {
+	return &readRouter{
+		primary:    primary,
+		replica:    primary,
+		lastWrites: cache.New(replicaPinDuration, replicaPinDuration),
+	}
+}
+
+func (r *readRouter) withReplica(replica *gorm.DB) *readRouter {
+	if replica != nil {
+		r.replica = replica
+	}
+	return r
+}
+
+func (r *readRouter) hasReplica() bool {
+	return r.replica != r.primary
+}
+
+// markWrite has to be called for every write affecting the given users
+func (r *readRouter) markWrite(userIds ...string) {
+	if !r.hasReplica() {
+		return
+	}
+	for _, id := range userIds {
+		r.lastWrites.SetDefault(id, true)
+	}
+}
+
+// forUser returns the database to run a user-specific read query on
+func (r *readRouter) forUser(userId string) *gorm.DB {
+	if _, pinned := r.lastWrites.Get(userId); pinned {
+		return r.primary
+	}
+	return r.replica
+}
+
+// any returns the database to run a non user-specific read query on, for which slightly outdated results are acceptable
+func (r *readRouter) any() *gorm.DB {
+	return r.replica
+}
@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
 	"time"
 )
 
@@ -18,10 +19,14 @@ type IAliasRepository interface {
 
 type IHeartbeatRepository interface {
 	InsertBatch([]*models.Heartbeat) error
+	InsertBatchCounted([]*models.Heartbeat) (int64, error)
 	GetAll() ([]*models.Heartbeat, error)
 	GetAllWithin(time.Time, time.Time, *models.User) ([]*models.Heartbeat, error)
+	GetAllWithinPaginated(time.Time, time.Time, *models.User, *models.HeartbeatCursor, int) ([]*models.Heartbeat, error)
+	GetAllWithinByEntityPaginated(time.Time, time.Time, *models.User, string, *models.HeartbeatCursor, int) ([]*models.Heartbeat, error)
 	GetAllWithinByFilters(time.Time, time.Time, *models.User, map[string][]string) ([]*models.Heartbeat, error)
 	GetLatestByFilters(*models.User, map[string][]string) (*models.Heartbeat, error)
+	GetLatestReceivedWithin(time.Time, time.Time, *models.User) (*models.Heartbeat, error)
 	GetFirstByUsers() ([]*models.TimeByUser, error)
 	GetLastByUsers() ([]*models.TimeByUser, error)
 	GetLatestByUser(*models.User) (*models.Heartbeat, error)
@@ -30,6 +35,7 @@ type IHeartbeatRepository interface {
 	CountByUser(*models.User) (int64, error)
 	CountByUsers([]*models.User) ([]*models.CountByUser, error)
 	GetEntitySetByUser(uint8, string) ([]string, error)
+	GetExistingHashes([]string) ([]string, error)
 	DeleteBefore(time.Time) error
 	DeleteByUser(*models.User) error
 	DeleteByUserBefore(*models.User, time.Time) error
@@ -64,6 +70,60 @@ type IProjectLabelRepository interface {
 	Delete(uint) error
 }
 
+type IArchivedProjectRepository interface {
+	GetByUser(string) ([]*models.ArchivedProject, error)
+	Upsert(*models.ArchivedProject) (*models.ArchivedProject, error)
+}
+
+type IProjectDefaultBranchRepository interface {
+	GetByUser(string) ([]*models.ProjectDefaultBranch, error)
+	Upsert(*models.ProjectDefaultBranch) (*models.ProjectDefaultBranch, error)
+	Delete(string, string) error
+}
+
+type IProjectMetadataRepository interface {
+	GetByUser(string) ([]*models.ProjectMetadata, error)
+	Upsert(*models.ProjectMetadata) (*models.ProjectMetadata, error)
+	Delete(string, string) error
+}
+
+type IProjectComponentRuleRepository interface {
+	GetById(uint) (*models.ProjectComponentRule, error)
+	GetByUser(string) ([]*models.ProjectComponentRule, error)
+	Insert(*models.ProjectComponentRule) (*models.ProjectComponentRule, error)
+	Delete(uint) error
+}
+
+type IWebhookRepository interface {
+	GetById(uint) (*models.Webhook, error)
+	GetByUser(string) ([]*models.Webhook, error)
+	Insert(*models.Webhook) (*models.Webhook, error)
+	Delete(uint) error
+	InsertDelivery(*models.WebhookDelivery) (*models.WebhookDelivery, error)
+	UpdateDelivery(*models.WebhookDelivery) error
+	GetDeliveriesByWebhook(uint, int) ([]*models.WebhookDelivery, error)
+	GetDueDeliveries(time.Time, int) ([]*models.WebhookDelivery, error)
+	DeleteDeliveriesBefore(time.Time) error
+}
+
+type IQueuedMailRepository interface {
+	Insert(*models.QueuedMail) (*models.QueuedMail, error)
+	Update(*models.QueuedMail) error
+	GetByStatus(string, int) ([]*models.QueuedMail, error)
+	GetDue(time.Time, int) ([]*models.QueuedMail, error)
+	DeleteFinishedBefore(time.Time) error
+}
+
+type IUserSessionRepository interface {
+	Insert(*models.UserSession) (*models.UserSession, error)
+	GetById(string) (*models.UserSession, error)
+	GetByUser(string) ([]*models.UserSession, error)
+	Touch(*models.UserSession) error
+	Delete(string, string) (int64, error)
+	DeleteByUserExcept(string, string) error
+	DeleteStale(time.Time, time.Time) error
+}
+
 type ISummaryRepository interface {
 	Insert(*models.Summary) error
 	GetAll() ([]*models.Summary, error)
@@ -71,31 +131,44 @@ type ISummaryRepository interface {
 	GetLastByUser() ([]*models.TimeByUser, error)
 	DeleteByUser(string) error
 	DeleteByUserBefore(string, time.Time) error
+	DeleteByUserWithin(string, time.Time, time.Time) error
 }
 
 type IUserRepository interface {
 	FindOne(user models.User) (*models.User, error)
+	FindOneIgnoreCase(string) (*models.User, error)
 	GetByIds([]string) ([]*models.User, error)
 	GetAll() ([]*models.User, error)
 	GetMany([]string) ([]*models.User, error)
 	GetAllByReports(bool) ([]*models.User, error)
 	GetAllByLeaderboard(bool) ([]*models.User, error)
+	GetByOrg(string) ([]*models.User, error)
 	GetByLoggedInBefore(time.Time) ([]*models.User, error)
+	GetBySoftDeletedBefore(time.Time) ([]*models.User, error)
 	GetByLoggedInAfter(time.Time) ([]*models.User, error)
 	GetByLastActiveAfter(time.Time) ([]*models.User, error)
+	Query(*models.UserQuery, *utils.PageParams) ([]*models.UserWithActivity, int64, error)
 	Count() (int64, error)
 	InsertOrGet(*models.User) (*models.User, bool, error)
 	Update(*models.User) (*models.User, error)
 	UpdateField(*models.User, string, interface{}) (*models.User, error)
+	UpdateOrgMembership(*models.User) (*models.User, error)
+	UpdatePassword(*models.User, string, string) error
 	Delete(*models.User) error
 }
 
+type IOrgRepository interface {
+	GetAll() ([]*models.Org, error)
+	GetById(string) (*models.Org, error)
+	Insert(*models.Org) (*models.Org, error)
+}
+
 type ILeaderboardRepository interface {
 	InsertBatch([]*models.LeaderboardItem) error
 	CountAllByUser(string) (int64, error)
 	CountUsers(bool) (int64, error)
 	DeleteByUser(string) error
 	DeleteByUserAndInterval(string, *models.IntervalKey) error
-	GetAllAggregatedByInterval(*models.IntervalKey, *uint8, int, int) ([]*models.LeaderboardItemRanked, error)
+	GetAllAggregatedByInterval(*models.IntervalKey, *uint8, *string, int, int) ([]*models.LeaderboardItemRanked, error)
 	GetAggregatedByUserAndInterval(string, *models.IntervalKey, *uint8, int, int) ([]*models.LeaderboardItemRanked, error)
 }
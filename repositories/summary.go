@@ -11,11 +11,18 @@ import (
 )
 
 type SummaryRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	reads *readRouter
 }
 
 func NewSummaryRepository(db *gorm.DB) *SummaryRepository {
-	return &SummaryRepository{db: db}
+	return &SummaryRepository{db: db, reads: newReadRouter(db)}
+}
+
+// WithReadReplica makes summary retrieval queries be served by the given replica database
+func (r *SummaryRepository) WithReadReplica(replica *gorm.DB) *SummaryRepository {
+	r.reads.withReplica(replica)
+	return r
 }
 
 func (r *SummaryRepository) GetAll() ([]*models.Summary, error) {
@@ -27,7 +34,7 @@ func (r *SummaryRepository) GetAll() ([]*models.Summary, error) {
 		return nil, err
 	}
 
-	if err := r.populateItems(summaries, []clause.Interface{}); err != nil {
+	if err := r.populateItems(r.db, summaries, []clause.Interface{}); err != nil {
 		return nil, err
 	}
 
@@ -35,6 +42,7 @@ func (r *SummaryRepository) GetAll() ([]*models.Summary, error) {
 }
 
 func (r *SummaryRepository) Insert(summary *models.Summary) error {
+	r.reads.markWrite(summary.UserID)
 
 	if err := r.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(summary).Error; err != nil {
@@ -87,6 +95,7 @@ func (r *SummaryRepository) Insert(summary *models.Summary) error {
 
 func (r *SummaryRepository) GetByUserWithin(user *models.User, from, to time.Time) ([]*models.Summary, error) {
 	var summaries []*models.Summary
+	db := r.reads.forUser(user.ID)
 
 	queryConditions := []clause.Interface{
 		clause.Where{Exprs: r.db.Statement.BuildCondition("user_id = ?", user.ID)},
@@ -94,7 +103,7 @@ func (r *SummaryRepository) GetByUserWithin(user *models.User, from, to time.Tim
 		clause.Where{Exprs: r.db.Statement.BuildCondition("to_time <= ?", to.Local())},
 	}
 
-	q := r.db.Model(&models.Summary{}).
+	q := db.Model(&models.Summary{}).
 		Order("from_time asc")
 
 	for _, c := range queryConditions {
@@ -106,7 +115,7 @@ func (r *SummaryRepository) GetByUserWithin(user *models.User, from, to time.Tim
 		return nil, err
 	}
 
-	if err := r.populateItems(summaries, queryConditions); err != nil {
+	if err := r.populateItems(db, summaries, queryConditions); err != nil {
 		return nil, err
 	}
 
@@ -124,6 +133,7 @@ func (r *SummaryRepository) GetLastByUser() ([]*models.TimeByUser, error) {
 }
 
 func (r *SummaryRepository) DeleteByUser(userId string) error {
+	r.reads.markWrite(userId)
 	if err := r.db.
 		Where("user_id = ?", userId).
 		Delete(models.Summary{}).Error; err != nil {
@@ -133,6 +143,7 @@ func (r *SummaryRepository) DeleteByUser(userId string) error {
 }
 
 func (r *SummaryRepository) DeleteByUserBefore(userId string, t time.Time) error {
+	r.reads.markWrite(userId)
 	if err := r.db.
 		Where("user_id = ?", userId).
 		Where("to_time <= ?", t.Local()).
@@ -142,15 +153,27 @@ func (r *SummaryRepository) DeleteByUserBefore(userId string, t time.Time) error
 	return nil
 }
 
+func (r *SummaryRepository) DeleteByUserWithin(userId string, from, to time.Time) error {
+	r.reads.markWrite(userId)
+	if err := r.db.
+		Where("user_id = ?", userId).
+		Where("from_time >= ?", from.Local()).
+		Where("to_time <= ?", to.Local()).
+		Delete(models.Summary{}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
 // inplace
-func (r *SummaryRepository) populateItems(summaries []*models.Summary, conditions []clause.Interface) error {
+func (r *SummaryRepository) populateItems(db *gorm.DB, summaries []*models.Summary, conditions []clause.Interface) error {
 	var items []*models.SummaryItem
 
 	summaryMap := slice.GroupWith[*models.Summary, uint](summaries, func(s *models.Summary) uint {
 		return s.ID
 	})
 
-	q := r.db.Model(&models.SummaryItem{}).
+	q := db.Model(&models.SummaryItem{}).
 		Select("summary_items.*").
 		Joins("cross join summaries").
 		Where("summary_items.summary_id = summaries.id").
@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/duke-git/lancet/v2/condition"
+	"github.com/duke-git/lancet/v2/slice"
 	"time"
 
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
@@ -27,6 +29,15 @@ func (r *UserRepository) FindOne(attributes models.User) (*models.User, error) {
 	return u, nil
 }
 
+// FindOneIgnoreCase returns a user whose id equals the given one case-insensitively, regardless of the database's collation
+func (r *UserRepository) FindOneIgnoreCase(id string) (*models.User, error) {
+	u := &models.User{}
+	if err := r.db.Where("lower(id) = lower(?)", id).First(u).Error; err != nil {
+		return u, err
+	}
+	return u, nil
+}
+
 func (r *UserRepository) GetByIds(userIds []string) ([]*models.User, error) {
 	var users []*models.User
 	if err := r.db.
@@ -61,7 +72,10 @@ func (r *UserRepository) GetMany(ids []string) ([]*models.User, error) {
 
 func (r *UserRepository) GetAllByReports(reportsEnabled bool) ([]*models.User, error) {
 	var users []*models.User
-	if err := r.db.Where(&models.User{ReportsWeekly: reportsEnabled}).Find(&users).Error; err != nil {
+	if err := r.db.
+		Where(&models.User{ReportsWeekly: reportsEnabled}).
+		Where("soft_deleted_at is null").
+		Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
@@ -69,7 +83,32 @@ func (r *UserRepository) GetAllByReports(reportsEnabled bool) ([]*models.User, e
 
 func (r *UserRepository) GetAllByLeaderboard(leaderboardEnabled bool) ([]*models.User, error) {
 	var users []*models.User
-	if err := r.db.Where(&models.User{PublicLeaderboard: leaderboardEnabled}).Find(&users).Error; err != nil {
+	if err := r.db.
+		Where(&models.User{PublicLeaderboard: leaderboardEnabled}).
+		Where("soft_deleted_at is null").
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *UserRepository) GetByOrg(orgId string) ([]*models.User, error) {
+	var users []*models.User
+	if err := r.db.
+		Where("org_id = ?", orgId).
+		Order("id asc").
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetBySoftDeletedBefore returns all users, who requested their account to be deleted before t
+func (r *UserRepository) GetBySoftDeletedBefore(t time.Time) ([]*models.User, error) {
+	var users []*models.User
+	if err := r.db.
+		Where("soft_deleted_at is not null and soft_deleted_at <= ?", t).
+		Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
@@ -102,6 +141,63 @@ func (r *UserRepository) GetByLastActiveAfter(t time.Time) ([]*models.User, erro
 	return r.GetByIds(userIds)
 }
 
+// Returns the users matching the given query together with the time of their latest heartbeat, as well as the total number of matches
+func (r *UserRepository) Query(query *models.UserQuery, pageParams *utils.PageParams) ([]*models.UserWithActivity, int64, error) {
+	subQuery := r.db.Model(&models.Heartbeat{}).
+		Select("user_id, max(time) as last_active_at").
+		Group("user_id")
+
+	q := r.db.
+		Table("users").
+		Joins("left join (?) as agg on agg.user_id = users.id", subQuery)
+
+	if query.ActiveAfter != nil {
+		q = q.Where("agg.last_active_at >= ?", query.ActiveAfter.Local())
+	}
+	if query.HasSubscription != nil {
+		if *query.HasSubscription {
+			q = q.Where("users.subscribed_until >= ?", time.Now().Local())
+		} else {
+			q = q.Where("users.subscribed_until is null or users.subscribed_until < ?", time.Now().Local())
+		}
+	}
+	if query.CreatedAfter != nil {
+		q = q.Where("users.created_at >= ?", query.CreatedAfter.Local())
+	}
+	if query.CreatedBefore != nil {
+		q = q.Where("users.created_at < ?", query.CreatedBefore.Local())
+	}
+	if query.OrgID != nil {
+		q = q.Where("users.org_id = ?", *query.OrgID)
+	}
+	q = q.Session(&gorm.Session{})
+
+	var count int64
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	sortColumn := "users.id"
+	if query.SortBy == "last_active_at" {
+		sortColumn = "agg.last_active_at"
+	} else if slice.Contain(models.UserQuerySortFields, query.SortBy) {
+		sortColumn = "users." + query.SortBy
+	}
+
+	var users []*models.UserWithActivity
+	q = q.
+		Select("users.*, agg.last_active_at").
+		Order(clause.OrderByColumn{Column: clause.Column{Name: sortColumn, Raw: true}, Desc: query.SortDesc}).
+		Order("users.id")
+	if pageParams != nil && pageParams.Limit() > 0 {
+		q = q.Limit(pageParams.Limit()).Offset(pageParams.Offset())
+	}
+	if err := q.Scan(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, count, nil
+}
+
 func (r *UserRepository) Count() (int64, error) {
 	var count int64
 	if err := r.db.
@@ -138,19 +234,52 @@ func (r *UserRepository) Update(user *models.User) (*models.User, error) {
 		"share_projects":           user.ShareProjects,
 		"share_machines":           user.ShareMachines,
 		"share_labels":             user.ShareLabels,
+		"anonymize_projects":       user.AnonymizeProjects,
+		"anonymize_languages":      user.AnonymizeLanguages,
+		"anonymize_editors":        user.AnonymizeEditors,
+		"new_projects_private":     user.NewProjectsPrivate,
 		"wakatime_api_key":         user.WakatimeApiKey,
 		"wakatime_api_url":         user.WakatimeApiUrl,
 		"has_data":                 user.HasData,
 		"reset_token":              user.ResetToken,
 		"location":                 user.Location,
+		"location_fixed":           user.LocationFixed,
 		"reports_weekly":           user.ReportsWeekly,
+		"inactivity_reminders":     user.InactivityReminders,
 		"public_leaderboard":       user.PublicLeaderboard,
 		"subscribed_until":         user.SubscribedUntil,
 		"subscription_renewal":     user.SubscriptionRenewal,
+		"subscription_trial_end":   user.SubscriptionTrialEnd,
 		"stripe_customer_id":       user.StripeCustomerId,
 		"invited_by":               user.InvitedBy,
 		"exclude_unknown_projects": user.ExcludeUnknownProjects,
+		"unknown_bucket":           user.UnknownBucket,
+		"average_mode":             user.AverageMode,
+		"server_timestamps":        user.ServerTimestamps,
+		"override_languages":       user.OverrideLanguages,
 		"heartbeats_timeout_sec":   user.HeartbeatsTimeoutSec,
+		"default_summary_interval": user.DefaultSummaryInterval,
+		"ignore_patterns":          user.IgnorePatterns,
+		"range_presets":            user.RangePresets,
+		"project_name_trim":        user.ProjectNameTrim,
+		"project_name_prefix":      user.ProjectNamePrefix,
+		"project_name_lowercase":   user.ProjectNameLowercase,
+		"entity_strip_query":       user.EntityStripQuery,
+		"entity_strip_host":        user.EntityStripHost,
+		"project_path_root":        user.ProjectPathRoot,
+		"project_path_segment":     user.ProjectPathSegment,
+		"auto_archive_days":        user.AutoArchiveDays,
+		"active_day_threshold_sec": user.ActiveDayThresholdSec,
+		"daily_project_cap_hours":  user.DailyProjectCapHours,
+		"machine_overlap_mode":     user.MachineOverlapMode,
+		"totp_secret":              user.TotpSecret,
+		"totp_enabled":             user.TotpEnabled,
+		"totp_recovery_codes":      user.TotpRecoveryCodes,
+		"totp_last_step":           user.TotpLastStep,
+		"last_plugin":              user.LastPlugin,
+		"last_plugin_version":      user.LastPluginVersion,
+		"soft_deleted_at":          user.SoftDeletedAt,
+		"sessions_revoked_at":      user.SessionsRevokedAt,
 	}
 
 	result := r.db.Model(user).Updates(updateMap)
@@ -174,6 +303,37 @@ func (r *UserRepository) UpdateField(user *models.User, key string, value interf
 	return user, nil
 }
 
+// UpdateOrgMembership persists the user's org and org admin flag, which are deliberately left out of Update, so that membership can never be reverted by updating a stale copy of the user
+func (r *UserRepository) UpdateOrgMembership(user *models.User) (*models.User, error) {
+	if err := r.db.
+		Model(user).
+		Select("org_id", "org_admin").
+		Updates(map[string]interface{}{
+			"org_id":    user.OrgID,
+			"org_admin": user.OrgAdmin,
+		}).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdatePassword replaces the user's password hash, unless it was changed in the meantime
+func (r *UserRepository) UpdatePassword(user *models.User, oldHash, newHash string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where(&models.User{ID: user.ID}).
+			Where("password = ?", oldHash).
+			Update("password", newHash)
+		if err := result.Error; err != nil {
+			return err
+		}
+		if result.RowsAffected != 1 {
+			return errors.New("password was changed concurrently")
+		}
+		return nil
+	})
+}
+
 func (r *UserRepository) Delete(user *models.User) error {
 	return r.db.Delete(user).Error
 }
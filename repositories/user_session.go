@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"gorm.io/gorm"
+)
+
+type UserSessionRepository struct {
+	config *config.Config
+	db     *gorm.DB
+}
+
+func NewUserSessionRepository(db *gorm.DB) *UserSessionRepository {
+	return &UserSessionRepository{config: config.Get(), db: db}
+}
+
+func (r *UserSessionRepository) Insert(session *models.UserSession) (*models.UserSession, error) {
+	if err := r.db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *UserSessionRepository) GetById(id string) (*models.UserSession, error) {
+	session := &models.UserSession{}
+	if err := r.db.Where(&models.UserSession{ID: id}).First(session).Error; err != nil {
+		return session, err
+	}
+	return session, nil
+}
+
+// GetByUser returns all of the user's sessions, most recently active first
+func (r *UserSessionRepository) GetByUser(userId string) ([]*models.UserSession, error) {
+	var sessions []*models.UserSession
+	if err := r.db.
+		Where(&models.UserSession{UserID: userId}).
+		Order("last_seen_at desc").
+		Find(&sessions).Error; err != nil {
+		return sessions, err
+	}
+	return sessions, nil
+}
+
+func (r *UserSessionRepository) Touch(session *models.UserSession) error {
+	return r.db.Model(session).Update("last_seen_at", session.LastSeenAt).Error
+}
+
+// Delete deletes the user's session with the given id, returning the number of deleted sessions, i.e. 0 if there is no such session of the user
+func (r *UserSessionRepository) Delete(userId, id string) (int64, error) {
+	result := r.db.
+		Where("user_id = ?", userId).
+		Where("id = ?", id).
+		Delete(models.UserSession{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteByUserExcept deletes all of the user's sessions apart from the given one (empty to delete all)
+func (r *UserSessionRepository) DeleteByUserExcept(userId, exceptId string) error {
+	return r.db.
+		Where("user_id = ?", userId).
+		Where("id != ?", exceptId).
+		Delete(models.UserSession{}).Error
+}
+
+// DeleteStale deletes all sessions inactive since or created before the given times (zero to ignore either)
+func (r *UserSessionRepository) DeleteStale(lastSeenBefore, createdBefore time.Time) error {
+	q := r.db.Where("last_seen_at < ?", lastSeenBefore.Local())
+	if !createdBefore.IsZero() {
+		q = q.Or("created_at < ?", createdBefore.Local())
+	}
+	return q.Delete(models.UserSession{}).Error
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"gorm.io/gorm"
+)
+
+type WebhookRepository struct {
+	config *config.Config
+	db     *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{config: config.Get(), db: db}
+}
+
+func (r *WebhookRepository) GetById(id uint) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	if err := r.db.Where(&models.Webhook{ID: id}).First(webhook).Error; err != nil {
+		return webhook, err
+	}
+	return webhook, nil
+}
+
+func (r *WebhookRepository) GetByUser(userId string) ([]*models.Webhook, error) {
+	if userId == "" {
+		return []*models.Webhook{}, nil
+	}
+	var webhooks []*models.Webhook
+	if err := r.db.
+		Where(&models.Webhook{UserID: userId}).
+		Order("id asc").
+		Find(&webhooks).Error; err != nil {
+		return webhooks, err
+	}
+	return webhooks, nil
+}
+
+func (r *WebhookRepository) Insert(webhook *models.Webhook) (*models.Webhook, error) {
+	if !webhook.IsValid() {
+		return nil, errors.New("invalid webhook")
+	}
+	result := r.db.Create(webhook)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (r *WebhookRepository) Delete(id uint) error {
+	return r.db.
+		Where("id = ?", id).
+		Delete(models.Webhook{}).Error
+}
+
+func (r *WebhookRepository) InsertDelivery(delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	result := r.db.Create(delivery)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (r *WebhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Model(delivery).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"status_code":     delivery.StatusCode,
+		"error":           delivery.Error,
+		"next_attempt_at": delivery.NextAttemptAt,
+	}).Error
+}
+
+// GetDeliveriesByWebhook returns the webhook's latest deliveries, most recent first
+func (r *WebhookRepository) GetDeliveriesByWebhook(webhookId uint, limit int) ([]*models.WebhookDelivery, error) {
+	var deliveries []*models.WebhookDelivery
+	if err := r.db.
+		Where(&models.WebhookDelivery{WebhookID: webhookId}).
+		Order("created_at desc").
+		Order("id desc").
+		Limit(limit).
+		Find(&deliveries).Error; err != nil {
+		return deliveries, err
+	}
+	return deliveries, nil
+}
+
+// GetDueDeliveries returns pending deliveries whose next attempt is due at the given time, including their webhooks
+func (r *WebhookRepository) GetDueDeliveries(t time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	var deliveries []*models.WebhookDelivery
+	if err := r.db.
+		Preload("Webhook").
+		Where("status = ?", models.WebhookDeliveryPending).
+		Where("next_attempt_at <= ?", t.Local()).
+		Order("next_attempt_at asc").
+		Limit(limit).
+		Find(&deliveries).Error; err != nil {
+		return deliveries, err
+	}
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) DeleteDeliveriesBefore(t time.Time) error {
+	return r.db.
+		Where("created_at < ?", t.Local()).
+		Delete(models.WebhookDelivery{}).Error
+}
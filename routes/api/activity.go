@@ -1,6 +1,7 @@
 package api
 
 import (
+	"github.com/duke-git/lancet/v2/slice"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	conf "github.com/muety/wakapi/config"
@@ -11,6 +12,7 @@ import (
 	"github.com/muety/wakapi/utils"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -42,6 +44,9 @@ func (h *ActivityApiHandler) RegisterRoutes(router chi.Router) {
 		middleware.Compress(9, "image/svg+xml"),
 	)
 	r.Get("/chart/{userWithExt}", h.GetActivityChart)
+	r.Get("/hours", h.GetHourlyActivity)
+	r.Get("/grid", h.GetContributionGrid)
+	r.Get("/focus", h.GetFocus)
 
 	router.Mount("/activity", r)
 }
@@ -59,7 +64,7 @@ func (h *ActivityApiHandler) GetActivityChart(w http.ResponseWriter, r *http.Req
 		return
 	}
 	requestedUser, err := h.userService.GetUserById(userWithExtPattern.ReplaceAllString(userWithExt, ""))
-	if err != nil {
+	if err != nil || requestedUser.IsSoftDeleted() {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
@@ -86,3 +91,144 @@ func (h *ActivityApiHandler) GetActivityChart(w http.ResponseWriter, r *http.Req
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(chart))
 }
+
+// @Summary Retrieve coding time by hour of day
+// @Description Buckets the coding time within the given range by hour of day (0-23) in the user's timezone, optionally also by day of week (0 = Sunday) for a full heatmap. Values are in seconds.
+// @ID get-activity-hours
+// @Tags activity
+// @Produce json
+// @Param interval query string false "Interval identifier" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time)
+// @Param from query string false "Start date (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
+// @Param weekdays query bool false "Whether to additionally bucket by day of week"
+// @Param project query string false "Project to filter by"
+// @Param language query string false "Language to filter by"
+// @Security ApiKeyAuth
+// @Success 200 {object} models.HourlyActivity
+// @Router /activity/hours [get]
+func (h *ActivityApiHandler) GetHourlyActivity(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	params, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	withWeekdays := r.URL.Query().Has("weekdays") && r.URL.Query().Get("weekdays") != "false"
+
+	activity, err := h.activityService.GetHourly(user, params.From, params.To, params.Filters, withWeekdays)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get hourly activity for user", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, activity)
+}
+
+// @Summary Retrieve focus metrics
+// @Description Measures how fragmented coding time within the given range was, both in total and per day (in the user's timezone, only days with activity are listed). A focus block is a period of uninterrupted work on the same project or, if level is 'file', the same file. It ends either by a context switch to another one or by a break longer than the user's heartbeats timeout, i.e. the same sessions summaries are computed from. Durations are in seconds.
+// @ID get-activity-focus
+// @Tags activity
+// @Produce json
+// @Param interval query string false "Interval identifier" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time)
+// @Param from query string false "Start date (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
+// @Param level query string false "What counts as a context switch, a change of project (default) or of file" Enums(project, file)
+// @Param project query string false "Project to filter by"
+// @Param language query string false "Language to filter by"
+// @Security ApiKeyAuth
+// @Success 200 {object} models.FocusStats
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Router /activity/focus [get]
+func (h *ActivityApiHandler) GetFocus(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	params, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	level := models.FocusLevelProject
+	if levelParam := r.URL.Query().Get("level"); levelParam != "" {
+		if !slice.Contain(models.FocusLevels, levelParam) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid level"))
+			return
+		}
+		level = levelParam
+	}
+
+	focus, err := h.activityService.GetFocus(user, params.From, params.To, params.Filters, level)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get focus metrics for user", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, focus)
+}
+
+// @Summary Retrieve coding time per day of a year
+// @Description Returns the coding time of every day of the given calendar year in the user's timezone, including days without activity, laid out in week columns (Monday to Sunday) for GitHub-style contribution heatmaps. Days outside the year or in the future are null. Values are in seconds.
+// @ID get-activity-grid
+// @Tags activity
+// @Produce json
+// @Param year query int false "Calendar year (default: current year)"
+// @Param project query string false "Project to filter by"
+// @Security ApiKeyAuth
+// @Success 200 {object} models.ContributionGrid
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Router /activity/grid [get]
+func (h *ActivityApiHandler) GetContributionGrid(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	year := time.Now().In(user.TZ()).Year()
+	if yearParam := r.URL.Query().Get("year"); yearParam != "" {
+		parsedYear, err := strconv.Atoi(yearParam)
+		if err != nil || parsedYear < 1970 || parsedYear > year {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid year"))
+			return
+		}
+		year = parsedYear
+	}
+
+	var filters *models.Filters
+	if project := r.URL.Query().Get("project"); project != "" {
+		filters = models.NewFiltersWith(models.SummaryProject, project)
+	}
+
+	grid, err := h.activityService.GetContributionGrid(user, year, filters)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get contribution grid for user", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, grid)
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+	"github.com/muety/wakapi/utils"
+)
+
+// max. size of uploaded alias rules files
+const aliasRulesMaxBytes = 1 << 20
+
+type AliasApiHandler struct {
+	config        *conf.Config
+	userSrvc      services.IUserService
+	aliasSrvc     services.IAliasService
+	recomputeSrvc services.IAliasRecomputeService
+}
+
+func NewAliasApiHandler(userService services.IUserService, aliasService services.IAliasService, recomputeService services.IAliasRecomputeService) *AliasApiHandler {
+	return &AliasApiHandler{
+		config:        conf.Get(),
+		userSrvc:      userService,
+		aliasSrvc:     aliasService,
+		recomputeSrvc: recomputeService,
+	}
+}
+
+func (h *AliasApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Post("/rules", h.PostRules)
+	r.Get("/recompute", h.GetRecompute)
+	r.Post("/recompute", h.PostRecompute)
+
+	router.Mount("/aliases", r)
+}
+
+// @Summary Import alias rules
+// @Description Creates aliases in bulk from a rules file, either as request body or as multipart form file named 'rules'. The file is json or yaml and maps summary field names (e.g. 'projects', 'languages', 'editors') to alias keys, each with a list of original names (wildcards allowed) to be mapped to it. Existing aliases of the same original name are updated. Rules that would exceed the maximum number of aliases per type or make aliases form a cycle (e.g. a to b and b back to a) are rejected as a whole. If the file maps any original name to multiple keys, nothing is imported and the conflicts are returned instead.
+// @ID post-alias-rules
+// @Tags aliases
+// @Accept json
+// @Accept plain
+// @Accept mpfd
+// @Produce json
+// @Param rules body models.AliasRules true "Alias rules, e.g. {\"projects\": {\"wakapi\": [\"wakapi-mobile\", \"wakapi-*\"]}}"
+// @Param recompute query bool false "Whether to retroactively apply the aliases to the last 30 days' summaries (see /aliases/recompute)"
+// @Security ApiKeyAuth
+// @Success 200 {object} models.AliasRulesResult
+// @Failure 400 {string} string "bad request"
+// @Failure 409 {object} models.AliasRulesResult
+// @Router /aliases/rules [post]
+func (h *AliasApiHandler) PostRules(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, aliasRulesMaxBytes)
+
+	var reader io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("rules")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("missing rules file"))
+			return
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(conf.ErrBadRequest))
+		return
+	}
+
+	rules, err := helpers.ParseAliasRules(data)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	aliases, conflicts, err := helpers.AliasesFromRules(rules, user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if len(conflicts) > 0 {
+		helpers.RespondJSON(w, r, http.StatusConflict, &models.AliasRulesResult{Conflicts: conflicts})
+		return
+	}
+
+	result, err := h.aliasSrvc.ApplyRules(user.ID, aliases)
+	if errors.Is(err, services.ErrAliasLimitExceeded) || errors.Is(err, services.ErrAliasCycle) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to apply alias rules", "userID", user.ID, "error", err)
+		return
+	}
+
+	if r.URL.Query().Get("recompute") == "true" {
+		from, to := defaultRecomputeRange()
+		if result.Recompute, err = h.recomputeSrvc.Start(user, from, to); errors.Is(err, services.ErrAliasRecomputeInProgress) {
+			result.Recompute = h.recomputeSrvc.GetStatus(user.ID)
+		} else if err != nil {
+			conf.Log().Request(r).Error("failed to start recompute after applying alias rules", "userID", user.ID, "error", err)
+		}
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, result)
+}
+
+// @Summary Get the state of the latest summary recompute
+// @Description Reports the progress of the user's most recent recompute (see POST /aliases/recompute), as days processed so far out of the total. The state is not persisted across server restarts.
+// @ID get-alias-recompute
+// @Tags aliases
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.AliasRecompute
+// @Failure 404 {string} string "not found"
+// @Router /aliases/recompute [get]
+func (h *AliasApiHandler) GetRecompute(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	recompute := h.recomputeSrvc.GetStatus(user.ID)
+	if recompute == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, recompute)
+}
+
+// @Summary Retroactively apply aliases
+// @Description Makes summaries computed before an alias was created reflect it, by flushing the user's cached summaries and regenerating the persisted ones within the given range in the background. The range defaults to the last 30 days and must not exceed 366 days, today is always excluded, as it isn't persisted yet. Only one recompute may run per user at a time, poll GET /aliases/recompute for its progress.
+// @ID post-alias-recompute
+// @Tags aliases
+// @Produce json
+// @Param from query string false "Start date (e.g. '2021-02-07')"
+// @Param to query string false "End date, exclusive (e.g. '2021-02-08')"
+// @Security ApiKeyAuth
+// @Success 202 {object} models.AliasRecompute
+// @Failure 400 {string} string "bad request"
+// @Failure 409 {string} string "conflict"
+// @Router /aliases/recompute [post]
+func (h *AliasApiHandler) PostRecompute(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	from, to := defaultRecomputeRange()
+	if fromParam := r.URL.Query().Get("from"); fromParam != "" {
+		parsed, err := helpers.ParseDateTimeTZ(fromParam, user.TZ())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid 'from' parameter"))
+			return
+		}
+		from = parsed
+	}
+	if toParam := r.URL.Query().Get("to"); toParam != "" {
+		parsed, err := helpers.ParseDateTimeTZ(toParam, user.TZ())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid 'to' parameter"))
+			return
+		}
+		to = parsed
+	}
+
+	recompute, err := h.recomputeSrvc.Start(user, from, to)
+	if errors.Is(err, services.ErrAliasRecomputeRange) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if errors.Is(err, services.ErrAliasRecomputeInProgress) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to start recompute", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusAccepted, recompute)
+}
+
+// defaultRecomputeRange covers the last days up until the beginning of today, server-local, as summaries are persisted per server-local day
+func defaultRecomputeRange() (from, to time.Time) {
+	to = utils.BeginOfToday(time.Local)
+	return to.AddDate(0, 0, -models.AliasRecomputeDefaultDays), to
+}
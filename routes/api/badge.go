@@ -1,11 +1,13 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"github.com/duke-git/lancet/v2/maputil"
 	"github.com/duke-git/lancet/v2/slice"
 	"github.com/go-chi/chi/v5"
 	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/middlewares"
 	"github.com/muety/wakapi/models"
 	v1 "github.com/muety/wakapi/models/compat/shields/v1"
@@ -19,18 +21,20 @@ import (
 )
 
 type BadgeHandler struct {
-	config      *conf.Config
-	cache       *cache.Cache
-	userSrvc    services.IUserService
-	summarySrvc services.ISummaryService
+	config              *conf.Config
+	cache               *cache.Cache
+	userSrvc            services.IUserService
+	summarySrvc         services.ISummaryService
+	projectMetadataSrvc services.IProjectMetadataService
 }
 
-func NewBadgeHandler(userService services.IUserService, summaryService services.ISummaryService) *BadgeHandler {
+func NewBadgeHandler(userService services.IUserService, summaryService services.ISummaryService, projectMetadataService services.IProjectMetadataService) *BadgeHandler {
 	return &BadgeHandler{
-		config:      conf.Get(),
-		cache:       cache.New(time.Hour, time.Hour),
-		userSrvc:    userService,
-		summarySrvc: summaryService,
+		config:              conf.Get(),
+		cache:               cache.New(time.Hour, time.Hour),
+		userSrvc:            userService,
+		summarySrvc:         summaryService,
+		projectMetadataSrvc: projectMetadataService,
 	}
 }
 
@@ -44,12 +48,12 @@ func (h *BadgeHandler) RegisterRoutes(router chi.Router) {
 func (h *BadgeHandler) Get(w http.ResponseWriter, r *http.Request) {
 	authorizedUser := middlewares.GetPrincipal(r)
 	user, err := h.userSrvc.GetUserById(chi.URLParam(r, "user"))
-	if err != nil {
+	if err != nil || user.IsSoftDeleted() {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	interval, filters, err := routeutils.GetBadgeParams(r.URL.Path, authorizedUser, user)
+	interval, filters, err := routeutils.GetBadgeParams(r.URL.Path, authorizedUser, user, h.projectMetadataSrvc)
 	if err != nil {
 		w.WriteHeader(http.StatusForbidden)
 		w.Write([]byte(err.Error()))
@@ -60,10 +64,18 @@ func (h *BadgeHandler) Get(w http.ResponseWriter, r *http.Request) {
 	cacheKey := fmt.Sprintf("%s_%v_%s_%s", user.ID, *interval.Key, filters.Hash(), r.URL.RawQuery)
 	noCache := utils.IsNoCache(r, 1*time.Hour)
 	if cacheResult, ok := h.cache.Get(cacheKey); ok && !noCache {
-		respondSvg(w, cacheResult.([]byte))
+		respondSvg(w, r, cacheResult.([]byte), authorizedUser == nil)
 		return
 	}
 
+	if authorizedUser == nil || authorizedUser.ID != user.ID {
+		if filters, err = h.resolveAnonymizedFilters(user, interval, filters); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+
 	params := &models.SummaryParams{
 		From:    interval.Start,
 		To:      interval.End,
@@ -92,12 +104,36 @@ func (h *BadgeHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	badgeSvg, err := badge.RenderBytes(badgeData.Label, badgeData.Message, badge.Color(badgeData.Color))
 	h.cache.SetDefault(cacheKey, badgeSvg)
-	respondSvg(w, badgeSvg)
+	respondSvg(w, r, badgeSvg, authorizedUser == nil)
+}
+
+// resolveAnonymizedFilters translates a filter by pseudonym (e.g. "project:Project 3fa2c1d0") back to the real entity key for users who chose to anonymize the respective entity type
+// filtering by real names is refused in that case, as it would allow to probe for them
+func (h *BadgeHandler) resolveAnonymizedFilters(user *models.User, interval *models.KeyedInterval, filters *models.Filters) (*models.Filters, error) {
+	ok, entityType, keys := filters.One()
+	if !ok || !slice.Contain(user.AnonymizedTypes(), entityType) {
+		return filters, nil
+	}
+
+	summary, err, _ := routeutils.LoadUserSummaryByParams(h.summarySrvc, &models.SummaryParams{
+		From:    interval.Start,
+		To:      interval.End,
+		User:    user,
+		Filters: (&models.Filters{}).WithSelectFields(entityType),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range *summary.GetByType(entityType) {
+		if helpers.AnonymizeKey(user, entityType, item.Key) == keys[0] {
+			return models.NewFiltersWith(entityType, item.Key).WithSelectFilteredOnly(), nil
+		}
+	}
+	return nil, errors.New("unknown anonymized entity")
 }
 
-func respondSvg(w http.ResponseWriter, data []byte) {
-	w.Header().Set("Content-Type", "image/svg+xml")
-	w.Header().Set("Cache-Control", "max-age=3600")
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+// badges requested without authentication only ever show public data and may thus be cached by proxies
+func respondSvg(w http.ResponseWriter, r *http.Request, data []byte, public bool) {
+	helpers.RespondCacheable(w, r, "image/svg+xml", data, public)
 }
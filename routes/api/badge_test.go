@@ -53,7 +53,7 @@ func TestBadgeHandler_Get(t *testing.T) {
 	summaryServiceMock := new(mocks.SummaryServiceMock)
 	summaryServiceMock.On("Aliased", mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), &user1, mock.Anything, mock.Anything).Return(&summary1, nil)
 
-	badgeHandler := NewBadgeHandler(userServiceMock, summaryServiceMock)
+	badgeHandler := NewBadgeHandler(userServiceMock, summaryServiceMock, new(mocks.ProjectMetadataServiceMock))
 	badgeHandler.RegisterRoutes(apiRouter)
 
 	t.Run("when requesting badge", func(t *testing.T) {
@@ -120,6 +120,65 @@ func TestBadgeHandler_Get(t *testing.T) {
 	})
 }
 
+func TestBadgeHandler_Get_PrivateProject(t *testing.T) {
+	config.Set(config.Empty())
+
+	router := chi.NewRouter()
+	apiRouter := chi.NewRouter()
+	apiRouter.Use(middlewares.NewPrincipalMiddleware())
+	router.Mount("/api", apiRouter)
+
+	user := &models.User{ID: "user2", ShareDataMaxDays: 30, ShareProjects: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", "user2").Return(user, nil)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Aliased", mock.Anything, mock.Anything, user, mock.Anything, mock.Anything).Return(&models.Summary{User: user, UserID: user.ID}, nil)
+
+	projectMetadataServiceMock := new(mocks.ProjectMetadataServiceMock)
+	projectMetadataServiceMock.On("GetPrivate", "user2", []string{"secret"}).Return([]string{"secret"}, nil)
+	projectMetadataServiceMock.On("GetPrivate", "user2", []string{"wakapi"}).Return([]string{}, nil)
+
+	NewBadgeHandler(userServiceMock, summaryServiceMock, projectMetadataServiceMock).RegisterRoutes(apiRouter)
+
+	get := func(project string) int {
+		rec := httptest.NewRecorder()
+		req := withUrlParam(httptest.NewRequest(http.MethodGet, "/api/badge/{user}/interval:week/project:"+project, nil), "user", "user2")
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, get("secret"))
+	assert.Equal(t, http.StatusOK, get("wakapi"))
+}
+
+func TestBadgeHandler_Get_SoftDeleted(t *testing.T) {
+	config.Set(config.Empty())
+
+	router := chi.NewRouter()
+	apiRouter := chi.NewRouter()
+	apiRouter.Use(middlewares.NewPrincipalMiddleware())
+	router.Mount("/api", apiRouter)
+
+	deletedAt := models.CustomTime(time.Now())
+	user := &models.User{ID: "user2", ShareDataMaxDays: 30, ShareLanguages: true, SoftDeletedAt: &deletedAt}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", "user2").Return(user, nil)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+
+	NewBadgeHandler(userServiceMock, summaryServiceMock, nil).RegisterRoutes(apiRouter)
+
+	rec := httptest.NewRecorder()
+	req := withUrlParam(httptest.NewRequest(http.MethodGet, "/api/badge/{user}/interval:week/language:go", nil), "user", "user2")
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	summaryServiceMock.AssertNotCalled(t, "Aliased", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestBadgeHandler_EntityPattern(t *testing.T) {
 	type test struct {
 		test string
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+	"github.com/muety/wakapi/utils"
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	calendarDefaultDays = 14
+	calendarMaxDays     = 90 // to keep feeds reasonably small, as calendar apps poll them regularly
+	calendarCacheTtl    = 30 * time.Minute
+	calendarTimeFormat  = "20060102T150405Z"
+	calendarLineLength  = 75 // max. line length in octets as per rfc 5545
+)
+
+var (
+	userWithIcsExtPattern = regexp.MustCompile(`\.ics$`)
+	calendarTextEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+)
+
+type calendarSubscriptionResponse struct {
+	Url  string `json:"url"`
+	Days int    `json:"days"`
+}
+
+type CalendarApiHandler struct {
+	config       *conf.Config
+	cache        *cache.Cache
+	userSrvc     services.IUserService
+	durationSrvc services.IDurationService
+}
+
+func NewCalendarApiHandler(userService services.IUserService, durationService services.IDurationService) *CalendarApiHandler {
+	return &CalendarApiHandler{
+		config:       conf.Get(),
+		cache:        cache.New(calendarCacheTtl, time.Hour),
+		userSrvc:     userService,
+		durationSrvc: durationService,
+	}
+}
+
+func (h *CalendarApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).WithOptionalFor("/api/calendar/feed/").Handler)
+	r.Get("/subscription", h.GetSubscription)
+	r.Get("/feed/{userWithExt}", h.GetFeed)
+
+	router.Mount("/calendar", r)
+}
+
+// @Summary Retrieve the calendar subscription url
+// @Description Returns a stable url of the user's calendar feed, which can be subscribed to in calendar apps. The url contains a read-only token instead of the api key and becomes invalid once the api key is reset.
+// @ID get-calendar-subscription
+// @Tags calendar
+// @Produce json
+// @Param days query int false "Number of past days to include in the feed (default: 14, max: 90)"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.calendarSubscriptionResponse
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Router /calendar/subscription [get]
+func (h *CalendarApiHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	days, err := parseCalendarDays(r.URL.Query().Get("days"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondJSON(w, r, http.StatusOK, calendarSubscriptionResponse{
+		Url:  fmt.Sprintf("%s/api/calendar/feed/%s.ics?token=%s&days=%d", h.config.Server.GetBaseUrl(), user.ID, helpers.CalendarToken(user), days),
+		Days: days,
+	})
+}
+
+// @Summary Retrieve coding sessions as iCalendar feed
+// @Description Generates an iCalendar (.ics) feed with one event per coding session within the past days, titled by project. Requires either regular authentication or the token contained in the subscription url. Feeds are cached for 30 minutes.
+// @ID get-calendar-feed
+// @Tags calendar
+// @Produce text/calendar
+// @Param userWithExt path string true "User ID followed by '.ics'"
+// @Param token query string false "Calendar token as contained in the subscription url"
+// @Param days query int false "Number of past days to include (default: 14, max: 90)"
+// @Security ApiKeyAuth
+// @Success 200 {string} string
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Router /calendar/feed/{userWithExt} [get]
+func (h *CalendarApiHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	// see activity chart for why the extension is not part of the route pattern
+	userWithExt := chi.URLParam(r, "userWithExt")
+	if !strings.HasSuffix(userWithExt, ".ics") {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	requestedUserId := userWithIcsExtPattern.ReplaceAllString(userWithExt, "")
+
+	// calendar apps can't authenticate, so the token serves as an alternative
+	user := middlewares.GetPrincipal(r)
+	if user == nil || user.ID != requestedUserId {
+		requestedUser, err := h.userSrvc.GetUserById(requestedUserId)
+		if err != nil || requestedUser.IsSoftDeleted() || !helpers.IsValidCalendarToken(requestedUser, r.URL.Query().Get("token")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(conf.ErrUnauthorized))
+			return
+		}
+		user = requestedUser
+	}
+
+	days, err := parseCalendarDays(r.URL.Query().Get("days"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	feed, err := h.loadFeed(user, days)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to generate calendar feed", "userID", user.ID, "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename=\"wakapi.ics\"")
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(calendarCacheTtl.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(feed))
+}
+
+func (h *CalendarApiHandler) loadFeed(user *models.User, days int) (string, error) {
+	cacheKey := fmt.Sprintf("%s_%d", user.ID, days)
+	if cacheResult, ok := h.cache.Get(cacheKey); ok {
+		return cacheResult.(string), nil
+	}
+
+	to := time.Now().In(user.TZ())
+	from := utils.BeginOfToday(user.TZ()).AddDate(0, 0, -days+1)
+
+	durations, err := h.durationSrvc.Get(from, to, user, nil)
+	if err != nil {
+		return "", err
+	}
+
+	feed := renderCalendar(user, durations.Sessions(user.HeartbeatsTimeout()), to)
+	h.cache.SetDefault(cacheKey, feed)
+	return feed, nil
+}
+
+// renderCalendar generates an rfc 5545 compliant calendar with one event per coding session
+func renderCalendar(user *models.User, sessions []*models.CodingSession, now time.Time) string {
+	var sb strings.Builder
+	writeLine := func(line string) {
+		sb.WriteString(foldCalendarLine(line))
+		sb.WriteString("\r\n")
+	}
+
+	writeLine("BEGIN:VCALENDAR")
+	writeLine("VERSION:2.0")
+	writeLine("PRODID:-//Wakapi//Coding Sessions//EN")
+	writeLine("CALSCALE:GREGORIAN")
+	writeLine("METHOD:PUBLISH")
+	writeLine("X-WR-CALNAME:" + escapeCalendarText(fmt.Sprintf("Wakapi (%s)", user.ID)))
+	writeLine("X-PUBLISHED-TTL:PT30M")
+
+	for _, s := range sessions {
+		project := s.Project
+		if project == "" {
+			project = models.UnknownSummaryKey
+		}
+		uidHash := sha256.Sum256([]byte(user.ID + ":" + s.Project))
+
+		writeLine("BEGIN:VEVENT")
+		writeLine(fmt.Sprintf("UID:%d-%s@wakapi", s.Start.Unix(), hex.EncodeToString(uidHash[:6])))
+		writeLine("DTSTAMP:" + now.UTC().Format(calendarTimeFormat))
+		writeLine("DTSTART:" + s.Start.UTC().Format(calendarTimeFormat))
+		writeLine("DTEND:" + s.End.UTC().Format(calendarTimeFormat))
+		writeLine("SUMMARY:" + escapeCalendarText(project))
+		description := "Coding time: " + helpers.FmtWakatimeDuration(s.Duration)
+		if len(s.Languages) > 0 {
+			description += "\nLanguages: " + strings.Join(s.Languages, ", ")
+		}
+		writeLine("DESCRIPTION:" + escapeCalendarText(description))
+		writeLine("TRANSP:TRANSPARENT")
+		writeLine("END:VEVENT")
+	}
+
+	writeLine("END:VCALENDAR")
+	return sb.String()
+}
+
+func escapeCalendarText(text string) string {
+	return calendarTextEscaper.Replace(text)
+}
+
+// foldCalendarLine splits lines longer than 75 octets into multiple ones, each continued one starting with a space, without breaking multi-byte characters
+func foldCalendarLine(line string) string {
+	if len(line) <= calendarLineLength {
+		return line
+	}
+
+	var sb strings.Builder
+	var n int
+	for _, c := range line {
+		size := len(string(c))
+		if n+size > calendarLineLength {
+			sb.WriteString("\r\n ")
+			n = 1
+		}
+		sb.WriteRune(c)
+		n += size
+	}
+	return sb.String()
+}
+
+func parseCalendarDays(param string) (int, error) {
+	if param == "" {
+		return calendarDefaultDays, nil
+	}
+	days, err := strconv.Atoi(param)
+	if err != nil || days < 1 || days > calendarMaxDays {
+		return 0, fmt.Errorf("'days' must be between 1 and %d", calendarMaxDays)
+	}
+	return days, nil
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCalendarApiHandler_GetFeed(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01", ApiKey: "e0bd0751-0734-4bc5-8b53-ba2f0d5f3a2a"}
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", user.ID).Return(user, nil)
+	durationServiceMock := new(mocks.DurationServiceMock)
+	durationServiceMock.On("Get", mock.Anything, mock.Anything, user, mock.Anything).Return(models.Durations{
+		{Project: "wakapi", Language: "Go", Time: models.CustomTime(t0), Duration: 20 * time.Minute},
+		{Project: "wakapi", Language: "Markdown", Time: models.CustomTime(t0.Add(21 * time.Minute)), Duration: 5 * time.Minute},
+		{Project: "other, project", Language: "Go", Time: models.CustomTime(t0.Add(2 * time.Hour)), Duration: 10 * time.Minute},
+	}, nil)
+
+	var principal *models.User
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if principal != nil {
+				middlewares.SetPrincipal(r, principal)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	sut := NewCalendarApiHandler(userServiceMock, durationServiceMock)
+	router.Get("/calendar/subscription", sut.GetSubscription)
+	router.Get("/calendar/feed/{userWithExt}", sut.GetFeed)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/calendar/feed/testuser01.ics")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = get("/calendar/feed/testuser01.ics?token=invalid")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = get("/calendar/feed/testuser01.ics?token=" + helpers.CalendarToken(user))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "private, max-age=1800", rec.Header().Get("Cache-Control"))
+
+	feed := rec.Body.String()
+	assert.True(t, strings.HasPrefix(feed, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(feed, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 2, strings.Count(feed, "BEGIN:VEVENT"))
+	assert.Contains(t, feed, "DTSTART:20240101T100000Z\r\nDTEND:20240101T102600Z\r\nSUMMARY:wakapi\r\n")
+	assert.Contains(t, feed, "DESCRIPTION:Coding time: 0 hrs 25 mins\\nLanguages: Go\\, Markdown\r\n")
+	assert.Contains(t, feed, "SUMMARY:other\\, project\r\n")
+
+	// own feed, served from cache
+	principal = user
+	rec = get("/calendar/feed/testuser01.ics")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, feed, rec.Body.String())
+	durationServiceMock.AssertNumberOfCalls(t, "Get", 1)
+
+	rec = get("/calendar/feed/testuser01.ics?days=91")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = get("/calendar/feed/testuser01.json")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = get("/calendar/subscription?days=30")
+	var subscription calendarSubscriptionResponse
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &subscription))
+	assert.True(t, strings.HasSuffix(subscription.Url, "/api/calendar/feed/testuser01.ics?token="+helpers.CalendarToken(user)+"&days=30"))
+}
+
+func Test_foldCalendarLine(t *testing.T) {
+	assert.Equal(t, "SUMMARY:wakapi", foldCalendarLine("SUMMARY:wakapi"))
+
+	folded := foldCalendarLine("DESCRIPTION:" + strings.Repeat("ä", 40))
+	lines := strings.Split(folded, "\r\n")
+	assert.Len(t, lines, 2)
+	assert.LessOrEqual(t, len(lines[0]), 75)
+	assert.True(t, strings.HasPrefix(lines[1], " "))
+	assert.Equal(t, "DESCRIPTION:"+strings.Repeat("ä", 40), strings.ReplaceAll(folded, "\r\n ", ""))
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	routeutils "github.com/muety/wakapi/routes/utils"
+	"github.com/muety/wakapi/services"
+	"github.com/muety/wakapi/utils"
+)
+
+// categories compared by default, if no 'fields' parameter is given
+var compareDefaultFields = []string{"projects", "languages", "editors", "operating_systems", "machines"}
+
+type CompareApiHandler struct {
+	config              *conf.Config
+	userSrvc            services.IUserService
+	summarySrvc         services.ISummaryService
+	projectMetadataSrvc services.IProjectMetadataService
+}
+
+type compareSideResponse struct {
+	UserID     string                      `json:"user_id"`
+	From       models.CustomTime           `json:"from" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	To         models.CustomTime           `json:"to" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	Total      int64                       `json:"total"`      // seconds
+	Categories map[string]map[string]int64 `json:"categories"` // field name -> key -> seconds
+}
+
+type compareDeltaResponse struct {
+	Total      int64                       `json:"total"`
+	Categories map[string]map[string]int64 `json:"categories"`
+}
+
+type compareResponse struct {
+	A     *compareSideResponse  `json:"a"`
+	B     *compareSideResponse  `json:"b"`
+	Delta *compareDeltaResponse `json:"delta"` // a minus b
+}
+
+func NewCompareApiHandler(userService services.IUserService, summaryService services.ISummaryService, projectMetadataService services.IProjectMetadataService) *CompareApiHandler {
+	return &CompareApiHandler{
+		config:              conf.Get(),
+		userSrvc:            userService,
+		summarySrvc:         summaryService,
+		projectMetadataSrvc: projectMetadataService,
+	}
+}
+
+func (h *CompareApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/", h.Get)
+
+	router.Mount("/compare", r)
+}
+
+// @Summary Compare two summaries side by side
+// @Description Compares the requesting user's stats within one time range (a) with either another time range or another user (b). Comparing with other users requires both to have opted in to the public leaderboard and only includes categories and time ranges the other user chose to share. Filters are only supported when comparing time ranges of the requesting user.
+// @ID get-compare
+// @Tags summary
+// @Produce json
+// @Param interval query string false "Interval identifier for a" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time)
+// @Param from query string false "Start date for a (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date for a (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
+// @Param compare_interval query string false "Interval identifier for b, same as a's if omitted"
+// @Param compare_from query string false "Start date for b"
+// @Param compare_to query string false "End date for b"
+// @Param compare_user query string false "User for b, requesting user if omitted"
+// @Param fields query string false "Comma-separated list of categories to compare (e.g. 'languages,editors')"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.compareResponse
+// @Failure 400 {string} string "bad request"
+// @Failure 403 {string} string "forbidden"
+// @Router /compare [get]
+func (h *CompareApiHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	paramsA, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	fields, err := helpers.ParseSummaryFields(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if fields == nil {
+		fields = map[string]uint8{}
+		for _, name := range compareDefaultFields {
+			fields[name], _ = helpers.SummaryFieldType(name)
+		}
+	}
+	delete(fields, helpers.SummaryFieldTotal) // always included
+
+	otherUser := user
+	if userParam := r.URL.Query().Get("compare_user"); userParam != "" && userParam != user.ID {
+		if otherUser, err = h.userSrvc.GetUserById(userParam); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("user not found or not opted in to comparisons"))
+			return
+		}
+		// users comparing themselves with others have to be open to comparisons themselves and, in multi-tenant mode, belong to the same org
+		if !h.config.App.LeaderboardEnabled || !user.PublicLeaderboard || !otherUser.PublicLeaderboard || (h.config.App.OrgsEnabled && user.OrgScope() != otherUser.OrgScope()) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("user not found or not opted in to comparisons"))
+			return
+		}
+		// filters would reveal whether the other user has data for keys they did not share
+		if hasFilters(paramsA) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("filters are not supported when comparing with other users"))
+			return
+		}
+	}
+
+	fromB, toB, err := parseCompareRange(r.URL.Query(), otherUser.TZ())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	} else if fromB.IsZero() {
+		fromB, toB = paramsA.From, paramsA.To
+	}
+
+	// other users' data is only available within the range they chose to share
+	if otherUser.ID != user.ID && otherUser.ShareDataMaxDays >= 0 && fromB.Before(utils.BeginOfToday(otherUser.TZ()).AddDate(0, 0, -otherUser.ShareDataMaxDays)) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("requested time range for comparison exceeds what the user chose to share"))
+		return
+	}
+
+	if otherUser.ID == user.ID && fromB.Equal(paramsA.From) && toB.Equal(paramsA.To) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("nothing to compare, either 'compare_user' or a different time range for comparison must be given"))
+		return
+	}
+
+	paramsB := &models.SummaryParams{
+		From:    fromB,
+		To:      toB,
+		User:    otherUser,
+		Filters: paramsA.Filters,
+	}
+
+	summaryA, err, status := routeutils.LoadUserSummaryByParams(h.summarySrvc, paramsA)
+	if err != nil {
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	summaryB, err, status := routeutils.LoadUserSummaryByParams(h.summarySrvc, paramsB)
+	if err != nil {
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	fieldsB := fields
+	if otherUser.ID != user.ID {
+		if summaryB, err = routeutils.AnonymizeSharedSummary(summaryB, otherUser, h.projectMetadataSrvc); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(conf.ErrInternalServerError))
+			conf.Log().Request(r).Error("failed to anonymize compared summary", "userID", otherUser.ID, "error", err)
+			return
+		}
+		fieldsB = sharedFields(otherUser, fields)
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, newCompareResponse(newCompareSide(summaryA, fields), newCompareSide(summaryB, fieldsB)))
+}
+
+// parseCompareRange parses the time range to compare with, returns zero times if none is given
+func parseCompareRange(params url.Values, tz *time.Location) (from, to time.Time, err error) {
+	if interval := params.Get("compare_interval"); interval != "" {
+		if err, from, to = helpers.ResolveIntervalRawTZ(interval, tz); err != nil {
+			return from, to, errors.New("invalid 'compare_interval' parameter")
+		}
+		return from, to, nil
+	}
+	if params.Get("compare_from") == "" && params.Get("compare_to") == "" {
+		return from, to, nil
+	}
+	if from, err = helpers.ParseDateTimeTZ(params.Get("compare_from"), tz); err != nil {
+		return from, to, errors.New("missing or invalid 'compare_from' parameter")
+	}
+	if to, err = helpers.ParseDateTimeTZ(params.Get("compare_to"), tz); err != nil {
+		return from, to, errors.New("missing or invalid 'compare_to' parameter")
+	}
+	return from, to, nil
+}
+
+// hasFilters returns whether any summary filters were requested
+func hasFilters(params *models.SummaryParams) bool {
+	return params.Filters != nil && !params.Filters.IsEmpty()
+}
+
+// sharedFields returns the subset of fields the given user permits others to see
+func sharedFields(user *models.User, fields map[string]uint8) map[string]uint8 {
+	permitted := map[uint8]bool{
+		models.SummaryProject:  user.ShareProjects,
+		models.SummaryLanguage: user.ShareLanguages,
+		models.SummaryEditor:   user.ShareEditors,
+		models.SummaryOS:       user.ShareOSs,
+		models.SummaryMachine:  user.ShareMachines,
+		models.SummaryLabel:    user.ShareLabels,
+	}
+	result := make(map[string]uint8)
+	for name, t := range fields {
+		if permitted[t] {
+			result[name] = t
+		}
+	}
+	return result
+}
+
+func newCompareSide(summary *models.Summary, fields map[string]uint8) *compareSideResponse {
+	side := &compareSideResponse{
+		UserID:     summary.UserID,
+		From:       summary.FromTime,
+		To:         summary.ToTime,
+		Total:      int64(summary.TotalTime().Seconds()),
+		Categories: make(map[string]map[string]int64, len(fields)),
+	}
+	for name, t := range fields {
+		side.Categories[name] = make(map[string]int64)
+		for _, item := range *summary.GetByType(t) {
+			side.Categories[name][item.Key] += int64(item.TotalFixed().Seconds())
+		}
+	}
+	return side
+}
+
+func newCompareResponse(a, b *compareSideResponse) *compareResponse {
+	delta := &compareDeltaResponse{
+		Total:      a.Total - b.Total,
+		Categories: make(map[string]map[string]int64),
+	}
+	// deltas are only meaningful for categories present on both sides
+	for name, itemsA := range a.Categories {
+		itemsB, ok := b.Categories[name]
+		if !ok {
+			continue
+		}
+		delta.Categories[name] = make(map[string]int64)
+		for key, total := range itemsA {
+			delta.Categories[name][key] += total
+		}
+		for key, total := range itemsB {
+			delta.Categories[name][key] -= total
+		}
+	}
+	return &compareResponse{A: a, B: b, Delta: delta}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCompareApiHandler_Get_OtherUser(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.LeaderboardEnabled = true
+	config.Set(cfg)
+
+	user := &models.User{ID: "user1", PublicLeaderboard: true}
+	otherUser := &models.User{ID: "user2", PublicLeaderboard: true, ShareLanguages: true, ShareDataMaxDays: 7}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", "user2").Return(otherUser, nil)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Aliased", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&models.Summary{}, nil)
+
+	projectMetadataServiceMock := new(mocks.ProjectMetadataServiceMock)
+	projectMetadataServiceMock.On("GetPrivate", "user2", mock.Anything).Return([]string{}, nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/compare", NewCompareApiHandler(userServiceMock, summaryServiceMock, projectMetadataServiceMock).Get)
+
+	t.Run("when comparing within the shared range", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/compare?interval=7_days&compare_user=user2", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("when comparing beyond the shared range", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/compare?interval=7_days&compare_user=user2&compare_interval=30_days", nil))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("when comparing with a user of another org", func(t *testing.T) {
+		cfg.App.OrgsEnabled = true
+		defer func() { cfg.App.OrgsEnabled = false }()
+
+		org1, org2 := "org1", "org2"
+		user.OrgID, otherUser.OrgID = &org1, &org2
+		defer func() { user.OrgID, otherUser.OrgID = nil, nil }()
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/compare?interval=7_days&compare_user=user2", nil))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		otherUser.OrgID = &org1
+
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/compare?interval=7_days&compare_user=user2", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func Test_newCompareResponse(t *testing.T) {
+	summaryA := &models.Summary{
+		UserID: "user1",
+		Languages: models.SummaryItems{
+			{Type: models.SummaryLanguage, Key: "Go", Total: 3600},
+			{Type: models.SummaryLanguage, Key: "Java", Total: 600},
+		},
+	}
+	summaryB := &models.Summary{
+		UserID: "user2",
+		Languages: models.SummaryItems{
+			{Type: models.SummaryLanguage, Key: "Go", Total: 1800},
+			{Type: models.SummaryLanguage, Key: "Python", Total: 1200},
+		},
+	}
+
+	fields := map[string]uint8{"languages": models.SummaryLanguage, "editors": models.SummaryEditor}
+	result := newCompareResponse(newCompareSide(summaryA, fields), newCompareSide(summaryB, map[string]uint8{"languages": models.SummaryLanguage}))
+
+	assert.Equal(t, int64(4200), result.A.Total)
+	assert.Equal(t, int64(3000), result.B.Total)
+	assert.Equal(t, int64(1200), result.Delta.Total)
+	assert.Equal(t, map[string]int64{"Go": 1800, "Java": 600, "Python": -1200}, result.Delta.Categories["languages"])
+	assert.Empty(t, result.A.Categories["editors"])
+	assert.NotContains(t, result.Delta.Categories, "editors") // not present on both sides
+}
+
+func Test_sharedFields(t *testing.T) {
+	user := &models.User{ShareLanguages: true}
+	fields := map[string]uint8{"languages": models.SummaryLanguage, "projects": models.SummaryProject, "categories": models.SummaryCategory}
+	assert.Equal(t, map[string]uint8{"languages": models.SummaryLanguage}, sharedFields(user, fields))
+}
+
+func Test_hasFilters(t *testing.T) {
+	assert.False(t, hasFilters(&models.SummaryParams{}))
+	assert.False(t, hasFilters(&models.SummaryParams{Filters: &models.Filters{}}))
+	assert.True(t, hasFilters(&models.SummaryParams{Filters: models.NewFiltersWith(models.SummaryProject, "wakapi")}))
+}
+
+func Test_parseCompareRange(t *testing.T) {
+	from, to, err := parseCompareRange(url.Values{}, time.UTC)
+	assert.Nil(t, err)
+	assert.True(t, from.IsZero() && to.IsZero())
+
+	from, to, err = parseCompareRange(url.Values{"compare_from": {"2024-01-01"}, "compare_to": {"2024-02-01"}}, time.UTC)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), to)
+
+	_, _, err = parseCompareRange(url.Values{"compare_from": {"2024-01-01"}}, time.UTC)
+	assert.Error(t, err)
+
+	_, _, err = parseCompareRange(url.Values{"compare_interval": {"foo"}}, time.UTC)
+	assert.Error(t, err)
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/duke-git/lancet/v2/datetime"
+	"github.com/duke-git/lancet/v2/slice"
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	routeutils "github.com/muety/wakapi/routes/utils"
+	"github.com/muety/wakapi/services"
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	dashboardSectionToday  = "today"
+	dashboardSectionRecent = "recent"
+	dashboardSectionTop    = "top"
+	dashboardSectionStreak = "streak"
+
+	dashboardDefaultTopLimit = 5
+	dashboardMaxTopLimit     = 50
+	dashboardMaxStreakDays   = 365 // how many days to look back at most when counting streaks
+)
+
+var dashboardSections = []string{dashboardSectionToday, dashboardSectionRecent, dashboardSectionTop, dashboardSectionStreak}
+
+type DashboardApiHandler struct {
+	config      *conf.Config
+	cache       *cache.Cache
+	userSrvc    services.IUserService
+	summarySrvc services.ISummaryService
+}
+
+type dashboardTopResponse struct {
+	Projects  []*models.SummaryItem `json:"projects"`
+	Languages []*models.SummaryItem `json:"languages"`
+}
+
+type dashboardStreakResponse struct {
+	Current     int  `json:"current"`      // consecutive active days up to today, or up to yesterday if not active yet today
+	ActiveToday bool `json:"active_today"` // whether today's coding time already reached the active day threshold
+}
+
+type dashboardResponse struct {
+	Today  *models.Summary          `json:"today,omitempty"`
+	Recent *models.Summary          `json:"recent,omitempty"`
+	Top    *dashboardTopResponse    `json:"top,omitempty"`
+	Streak *dashboardStreakResponse `json:"streak,omitempty"`
+}
+
+func NewDashboardApiHandler(userService services.IUserService, summaryService services.ISummaryService) *DashboardApiHandler {
+	return &DashboardApiHandler{
+		config:      conf.Get(),
+		cache:       cache.New(time.Hour, time.Hour),
+		userSrvc:    userService,
+		summarySrvc: summaryService,
+	}
+}
+
+func (h *DashboardApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/", h.Get)
+
+	router.Mount("/dashboard", r)
+}
+
+// @Summary Retrieve everything needed to render a dashboard in one call
+// @Description Assembles today's summary, a summary of a recent time range, the top projects and languages within that range and the current streak of active days. Sections are loaded concurrently and summaries are served from cache where available.
+// @ID get-dashboard
+// @Tags summary
+// @Produce json
+// @Param sections query string false "Comma-separated list of sections to include, all if omitted" Enums(today, recent, top, streak)
+// @Param interval query string false "Interval identifier of the recent time range (default: 'last_7_days'), custom range presets are supported"
+// @Param top query int false "Maximum number of top projects and languages (default: 5)"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.dashboardResponse
+// @Failure 400 {string} string "bad request"
+// @Router /dashboard [get]
+func (h *DashboardApiHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	sections, err := parseDashboardSections(r.URL.Query().Get("sections"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = (*models.IntervalPast7Days)[1]
+	}
+	err, recentFrom, recentTo := helpers.ResolveUserIntervalRaw(interval, user)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid 'interval' parameter"))
+		return
+	}
+
+	topLimit := dashboardDefaultTopLimit
+	if topParam := r.URL.Query().Get("top"); topParam != "" {
+		if topLimit, err = strconv.Atoi(topParam); err != nil || topLimit < 1 || topLimit > dashboardMaxTopLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("'top' must be between 1 and %d", dashboardMaxTopLimit)))
+			return
+		}
+	}
+
+	now := time.Now().In(user.TZ())
+	today := datetime.BeginOfDay(now)
+
+	var (
+		wg                      sync.WaitGroup
+		todaySummary, recent    *models.Summary
+		streakUntilYesterday    int
+		errToday, errRecent     error
+		errStreak               error
+		needsToday, needsRecent = sections[dashboardSectionToday] || sections[dashboardSectionStreak], sections[dashboardSectionRecent] || sections[dashboardSectionTop]
+	)
+
+	if needsToday {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			todaySummary, errToday = h.loadSummary(today, now, user)
+		}()
+	}
+	if needsRecent {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recent, errRecent = h.loadSummary(recentFrom, recentTo, user)
+		}()
+	}
+	if sections[dashboardSectionStreak] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			streakUntilYesterday, errStreak = h.loadStreakUntil(today, user)
+		}()
+	}
+
+	wg.Wait()
+
+	for _, err := range []error{errToday, errRecent, errStreak} {
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(conf.ErrInternalServerError))
+			conf.Log().Request(r).Error("failed to load dashboard", "userID", user.ID, "error", err)
+			return
+		}
+	}
+
+	response := &dashboardResponse{}
+	if sections[dashboardSectionToday] {
+		response.Today = todaySummary
+	}
+	if sections[dashboardSectionRecent] {
+		response.Recent = recent
+	}
+	if sections[dashboardSectionTop] {
+		sorted := recent.Sorted()
+		response.Top = &dashboardTopResponse{
+			Projects:  topSummaryItems(sorted.Projects, topLimit),
+			Languages: topSummaryItems(sorted.Languages, topLimit),
+		}
+	}
+	if sections[dashboardSectionStreak] {
+		activeToday := todaySummary.IsActiveDay(user.ActiveDayThreshold())
+		response.Streak = &dashboardStreakResponse{Current: streakUntilYesterday, ActiveToday: activeToday}
+		if activeToday {
+			response.Streak.Current++
+		}
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, response)
+}
+
+func (h *DashboardApiHandler) loadSummary(from, to time.Time, user *models.User) (*models.Summary, error) {
+	summary, err, _ := routeutils.LoadUserSummaryByParams(h.summarySrvc, &models.SummaryParams{
+		From: from,
+		To:   to,
+		User: user,
+	})
+	return summary, err
+}
+
+// loadStreakUntil counts the consecutive active days right before the given day, which is excluded itself.
+// Past days won't change (apart from imports), so results are cached per user and day.
+func (h *DashboardApiHandler) loadStreakUntil(day time.Time, user *models.User) (int, error) {
+	cacheKey := fmt.Sprintf("%s_%s_%d", user.ID, day.Format(time.DateOnly), user.ActiveDayThreshold())
+	if cacheResult, ok := h.cache.Get(cacheKey); ok {
+		return cacheResult.(int), nil
+	}
+
+	var streak int
+	for ; streak < dashboardMaxStreakDays; streak++ {
+		to := day.AddDate(0, 0, -streak)
+		summary, err := h.loadSummary(to.AddDate(0, 0, -1), to, user)
+		if err != nil {
+			return 0, err
+		}
+		if !summary.IsActiveDay(user.ActiveDayThreshold()) {
+			break
+		}
+	}
+
+	h.cache.SetDefault(cacheKey, streak)
+	return streak, nil
+}
+
+// parseDashboardSections parses a comma-separated list of section names, defaulting to all sections
+func parseDashboardSections(param string) (map[string]bool, error) {
+	sections := make(map[string]bool)
+	if strings.TrimSpace(param) == "" {
+		for _, s := range dashboardSections {
+			sections[s] = true
+		}
+		return sections, nil
+	}
+
+	for _, s := range strings.Split(param, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if !slice.Contain(dashboardSections, s) {
+			return nil, fmt.Errorf("invalid section '%s', must be one of %s", s, strings.Join(dashboardSections, ", "))
+		}
+		sections[s] = true
+	}
+	return sections, nil
+}
+
+func topSummaryItems(items models.SummaryItems, limit int) []*models.SummaryItem {
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
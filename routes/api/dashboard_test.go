@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/duke-git/lancet/v2/datetime"
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDashboardApiHandler_Get(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01"}
+	today := datetime.BeginOfDay(time.Now().In(user.TZ()))
+
+	activeDay := func() *models.Summary {
+		return &models.Summary{
+			Projects: models.SummaryItems{
+				{Type: models.SummaryProject, Key: "wakapi", Total: 1800},
+				{Type: models.SummaryProject, Key: "anchr", Total: 3600},
+			},
+			Languages: models.SummaryItems{
+				{Type: models.SummaryLanguage, Key: "Go", Total: 5400},
+			},
+		}
+	}
+	startsAt := func(day time.Time) interface{} {
+		return mock.MatchedBy(func(t time.Time) bool { return t.Equal(day) })
+	}
+
+	// active today and on the two preceding days, inactive three days ago
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Aliased", startsAt(today), mock.Anything, user, mock.Anything, mock.Anything).Return(activeDay(), nil)
+	summaryServiceMock.On("Aliased", startsAt(today.AddDate(0, 0, -1)), mock.Anything, user, mock.Anything, mock.Anything).Return(activeDay(), nil)
+	summaryServiceMock.On("Aliased", startsAt(today.AddDate(0, 0, -2)), mock.Anything, user, mock.Anything, mock.Anything).Return(activeDay(), nil)
+	summaryServiceMock.On("Aliased", startsAt(today.AddDate(0, 0, -3)), mock.Anything, user, mock.Anything, mock.Anything).Return(&models.Summary{}, nil)
+	summaryServiceMock.On("Aliased", mock.Anything, mock.Anything, user, mock.Anything, mock.Anything).Return(activeDay(), nil) // last 7 days
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/dashboard", NewDashboardApiHandler(new(mocks.UserServiceMock), summaryServiceMock).Get)
+
+	get := func(query string) (*httptest.ResponseRecorder, map[string]json.RawMessage) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dashboard"+query, nil))
+		var result map[string]json.RawMessage
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec, result
+	}
+
+	rec, result := get("?top=1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, result, "today")
+	assert.Contains(t, result, "recent")
+
+	var top dashboardTopResponse
+	assert.Nil(t, json.Unmarshal(result["top"], &top))
+	assert.Len(t, top.Projects, 1)
+	assert.Equal(t, "anchr", top.Projects[0].Key)
+	assert.Equal(t, "Go", top.Languages[0].Key)
+
+	var streak dashboardStreakResponse
+	assert.Nil(t, json.Unmarshal(result["streak"], &streak))
+	assert.Equal(t, dashboardStreakResponse{Current: 3, ActiveToday: true}, streak)
+
+	// only requested sections are included, past days of the streak are served from cache
+	rec, result = get("?sections=streak")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, result, "today")
+	assert.NotContains(t, result, "recent")
+	assert.NotContains(t, result, "top")
+	assert.Contains(t, result, "streak")
+	summaryServiceMock.AssertNumberOfCalls(t, "Aliased", 1+1+3+1) // today, last 7 days, three days back until inactive, today again
+
+	rec, _ = get("?sections=today,goals")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, _ = get("?top=0")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
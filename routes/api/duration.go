@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/duke-git/lancet/v2/datetime"
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+	"github.com/muety/wakapi/utils"
+)
+
+type durationItem struct {
+	Start         models.CustomTime `json:"start" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	End           models.CustomTime `json:"end" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	Duration      float64           `json:"duration"` // seconds
+	Project       string            `json:"project"`
+	Language      string            `json:"language"`
+	Editor        string            `json:"editor"`
+	Machine       string            `json:"machine"`
+	Branch        string            `json:"branch"`
+	NumHeartbeats int               `json:"num_heartbeats"`
+}
+
+type durationsResponse struct {
+	Date       string          `json:"date" example:"2006-01-02"`
+	TimeoutSec int             `json:"timeout_sec"` // max. gap between two heartbeats to still be counted as one session
+	Total      float64         `json:"total"`       // seconds
+	Data       []*durationItem `json:"data"`
+}
+
+type DurationApiHandler struct {
+	config       *conf.Config
+	userSrvc     services.IUserService
+	durationSrvc services.IDurationService
+}
+
+func NewDurationApiHandler(userService services.IUserService, durationService services.IDurationService) *DurationApiHandler {
+	return &DurationApiHandler{
+		config:       conf.Get(),
+		userSrvc:     userService,
+		durationSrvc: durationService,
+	}
+}
+
+func (h *DurationApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/", h.Get)
+
+	router.Mount("/durations", r)
+}
+
+// @Summary Retrieve coding sessions of a day
+// @Description Lists the durations (i.e. coding sessions) of the given day in chronological order, exactly as computed from heartbeats for summaries, that is, after applying the user's heartbeats timeout. Intended to debug and verify summary totals.
+// @ID get-durations
+// @Tags summary
+// @Produce json
+// @Param date query string false "Day to list sessions of (e.g. '2021-02-07'), defaults to today"
+// @Param project query string false "Only include sessions of the given project"
+// @Param write_only query bool false "Whether to only consider heartbeats flagged as is_write (i.e. file saves)"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.durationsResponse
+// @Failure 400 {string} string "bad request"
+// @Router /durations [get]
+func (h *DurationApiHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	from := utils.BeginOfToday(user.TZ())
+	if dateParam := r.URL.Query().Get("date"); dateParam != "" {
+		date, err := helpers.ParseDateTimeTZ(dateParam, user.TZ())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid 'date' parameter"))
+			return
+		}
+		from = datetime.BeginOfDay(date.In(user.TZ()))
+	}
+	to := from.AddDate(0, 0, 1)
+
+	var filters *models.Filters
+	if project := r.URL.Query().Get("project"); project != "" {
+		filters = models.NewFiltersWith(models.SummaryProject, project)
+	}
+	if q := r.URL.Query().Get("write_only"); q != "" && q != "false" {
+		if filters == nil {
+			filters = &models.Filters{}
+		}
+		filters.WriteOnly = true
+	}
+
+	durations, err := h.durationSrvc.Get(from, to, user, filters)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to compute durations", "userID", user.ID, "error", err)
+		return
+	}
+
+	result := &durationsResponse{
+		Date:       helpers.FormatDate(from),
+		TimeoutSec: int(user.HeartbeatsTimeout().Seconds()),
+		Data:       make([]*durationItem, 0, len(durations)),
+	}
+	for _, d := range durations.Sorted() {
+		result.Total += d.Duration.Seconds()
+		result.Data = append(result.Data, &durationItem{
+			Start:         d.Time,
+			End:           models.CustomTime(d.Time.T().Add(d.Duration)),
+			Duration:      d.Duration.Seconds(),
+			Project:       d.Project,
+			Language:      d.Language,
+			Editor:        d.Editor,
+			Machine:       d.Machine,
+			Branch:        d.Branch,
+			NumHeartbeats: d.NumHeartbeats,
+		})
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, result)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDurationApiHandler_Get(t *testing.T) {
+	config.Set(config.Empty())
+
+	tz, _ := time.LoadLocation("Europe/Berlin")
+	user := &models.User{ID: "testuser01", Location: "Europe/Berlin", HeartbeatsTimeoutSec: 120}
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, tz)
+
+	durationServiceMock := new(mocks.DurationServiceMock)
+	durationServiceMock.On("Get", day, day.AddDate(0, 0, 1), user, mock.Anything).Return(models.Durations{
+		{Time: models.CustomTime(day.Add(10 * time.Hour)), Duration: 30 * time.Minute, Project: "wakapi", NumHeartbeats: 12},
+		{Time: models.CustomTime(day.Add(9 * time.Hour)), Duration: 15 * time.Minute, Project: "anchr", NumHeartbeats: 5},
+	}, nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/durations", NewDurationApiHandler(nil, durationServiceMock).Get)
+
+	t.Run("when requesting a day", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/durations?date=2024-03-10", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var res struct {
+			durationsResponse
+			Data []struct {
+				durationItem
+				Start string `json:"start"`
+				End   string `json:"end"`
+			} `json:"data"`
+		}
+		assert.Nil(t, json.NewDecoder(rec.Body).Decode(&res))
+		assert.Equal(t, "2024-03-10", res.Date)
+		assert.Equal(t, 120, res.TimeoutSec)
+		assert.Equal(t, float64(45*60), res.Total)
+		assert.Len(t, res.Data, 2)
+		assert.Equal(t, "anchr", res.Data[0].Project) // chronological
+		end, _ := time.Parse(time.RFC3339, res.Data[0].End)
+		assert.True(t, day.Add(9*time.Hour+15*time.Minute).Equal(end))
+		assert.Equal(t, float64(30*60), res.Data[1].Duration)
+		assert.Equal(t, 12, res.Data[1].NumHeartbeats)
+
+		durationServiceMock.AssertCalled(t, "Get", day, day.AddDate(0, 0, 1), user, (*models.Filters)(nil))
+	})
+
+	t.Run("when filtering by project", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/durations?date=2024-03-10&project=wakapi", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		durationServiceMock.AssertCalled(t, "Get", day, day.AddDate(0, 0, 1), user, mock.MatchedBy(func(f *models.Filters) bool {
+			return f != nil && f.Project.Exists() && f.Project[0] == "wakapi"
+		}))
+	})
+
+	t.Run("when passing an invalid date", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/durations?date=yesterday", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
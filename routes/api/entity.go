@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/services"
+)
+
+const (
+	entitiesDefaultLimit = 10
+	entitiesMaxLimit     = 100
+)
+
+type entityResponse struct {
+	Entity string `json:"entity"`
+	Total  int64  `json:"total"` // seconds
+}
+
+type EntityApiHandler struct {
+	config     *conf.Config
+	userSrvc   services.IUserService
+	entitySrvc services.IEntityService
+}
+
+func NewEntityApiHandler(userService services.IUserService, entityService services.IEntityService) *EntityApiHandler {
+	return &EntityApiHandler{
+		config:     conf.Get(),
+		userSrvc:   userService,
+		entitySrvc: entityService,
+	}
+}
+
+func (h *EntityApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/", h.Get)
+
+	router.Mount("/entities", r)
+}
+
+// @Summary Retrieve the files most worked on within a project
+// @Description Returns the entities (usually files) of the given project the requesting user spent the most time with. File paths are considered private and are neither exposed publicly nor to other users.
+// @ID get-entities
+// @Tags projects
+// @Produce json
+// @Param project query string true "Project to list files of"
+// @Param interval query string false "Interval identifier" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time)
+// @Param from query string false "Start date (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
+// @Param limit query int false "Maximum number of files to return (default 10, at most 100)"
+// @Security ApiKeyAuth
+// @Success 200 {array} api.entityResponse
+// @Failure 400 {string} string "bad request"
+// @Router /entities [get]
+func (h *EntityApiHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing 'project' parameter"))
+		return
+	}
+
+	limit := entitiesDefaultLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitParam); err != nil || limit < 1 || limit > entitiesMaxLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid 'limit' parameter"))
+			return
+		}
+	}
+
+	params, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	items, err := h.entitySrvc.GetTop(params.From, params.To, user, project, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get top entities", "userID", user.ID, "project", project, "error", err)
+		return
+	}
+
+	result := make([]*entityResponse, len(items))
+	for i, item := range items {
+		result[i] = &entityResponse{Entity: item.Key, Total: int64(item.TotalFixed().Seconds())}
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, result)
+}
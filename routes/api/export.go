@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/services"
+)
+
+type ExportApiHandler struct {
+	config     *conf.Config
+	userSrvc   services.IUserService
+	exportSrvc services.IExportService
+}
+
+func NewExportApiHandler(userService services.IUserService, exportService services.IExportService) *ExportApiHandler {
+	return &ExportApiHandler{
+		userSrvc:   userService,
+		exportSrvc: exportService,
+		config:     conf.Get(),
+	}
+}
+
+func (h *ExportApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	// downloads are authorized by the link's signature instead
+	r.Get("/{id}", h.Get)
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+		r.Post("/", h.Post)
+	})
+
+	router.Mount("/exports", r)
+}
+
+// @Summary Request an export of all heartbeats or all data
+// @Description Generates the export in the background and sends a signed, expiring download link to the user's e-mail address once finished. Format 'zip' produces an archive of all the user's data, that is, profile and settings, heartbeats, summaries, aliases, projects and language mappings, excluding credentials like password hashes or api keys.
+// @ID post-export
+// @Tags export
+// @Param format query string false "Export format (csv, json or zip), defaults to csv"
+// @Security ApiKeyAuth
+// @Success 202
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Router /exports [post]
+func (h *ExportApiHandler) Post(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	if user.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("an e-mail address is required to receive the download link"))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.ExportFormatCsv
+	}
+
+	if err := h.exportSrvc.RequestExport(user, format); err != nil {
+		if errors.Is(err, services.ErrInvalidExportFormat) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to request export", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusAccepted, struct{}{})
+}
+
+// @Summary Download a previously generated export
+// @Description Only accessible through the signed link sent via e-mail, which is valid for a single export and expires after a configurable time.
+// @ID get-export
+// @Tags export
+// @Param id path string true "Export id"
+// @Param expires query string true "Expiry timestamp (as included in the link)"
+// @Param signature query string true "Signature (as included in the link)"
+// @Produce octet-stream
+// @Success 200 {file} file
+// @Failure 404 {string} string "not found"
+// @Router /exports/{id} [get]
+func (h *ExportApiHandler) Get(w http.ResponseWriter, r *http.Request) {
+	exportId := chi.URLParam(r, "id")
+
+	location, err := h.exportSrvc.ResolveSignedUrl(exportId, r.URL.Query().Get("expires"), r.URL.Query().Get("signature"))
+	if err != nil {
+		if !errors.Is(err, services.ErrInvalidExportLink) {
+			conf.Log().Request(r).Error("failed to resolve export link", "error", err)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if location.Url != "" {
+		http.Redirect(w, r, location.Url, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", services.ExportContentDisposition(exportId))
+	http.ServeFile(w, r, location.Path)
+}
@@ -5,21 +5,36 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/migrations"
 	"gorm.io/gorm"
 )
 
 type HealthApiHandler struct {
-	db *gorm.DB
+	config *conf.Config
+	db     *gorm.DB
+}
+
+type probeResponse struct {
+	Status string          `json:"status"`
+	Checks map[string]bool `json:"checks,omitempty"` // true for every passing check
 }
 
 func NewHealthApiHandler(db *gorm.DB) *HealthApiHandler {
-	return &HealthApiHandler{db: db}
+	return &HealthApiHandler{config: conf.Get(), db: db}
 }
 
 func (h *HealthApiHandler) RegisterRoutes(router chi.Router) {
 	router.Get("/health", h.Get)
 }
 
+// RegisterProbeRoutes registers kubernetes-style liveness and readiness probes, which are expected at the root level
+func (h *HealthApiHandler) RegisterProbeRoutes(router chi.Router) {
+	router.Get("/healthz", h.GetLiveness)
+	router.Get("/readyz", h.GetReadiness)
+}
+
 // @Summary Check the application's health status
 // @ID get-health
 // @Tags misc
@@ -28,12 +43,46 @@ func (h *HealthApiHandler) RegisterRoutes(router chi.Router) {
 // @Router /health [get]
 func (h *HealthApiHandler) Get(w http.ResponseWriter, r *http.Request) {
 	var dbStatus int
-	if sqlDb, err := h.db.DB(); err == nil {
-		if err := sqlDb.Ping(); err == nil {
-			dbStatus = 1
-		}
+	if h.pingDb() {
+		dbStatus = 1
 	}
 
 	w.Header().Set("Content-Type", "text/plain")
 	w.Write([]byte(fmt.Sprintf("app=1\ndb=%d", dbStatus)))
 }
+
+// GetLiveness only tells that the process is up and serving requests
+func (h *HealthApiHandler) GetLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondJSON(w, r, http.StatusOK, probeResponse{Status: "ok"})
+}
+
+// GetReadiness tells whether the application is ready to serve traffic, i.e. database is reachable, migrations are applied and neither in maintenance mode nor shutting down
+func (h *HealthApiHandler) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]bool{
+		"db":          h.pingDb(),
+		"migrations":  migrations.Applied(h.config),
+		"maintenance": !h.config.Maintenance,
+		"shutdown":    !conf.IsShuttingDown(),
+	}
+
+	status, code := "ready", http.StatusOK
+	for _, ok := range checks {
+		if !ok {
+			status, code = "unavailable", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondJSON(w, r, code, probeResponse{Status: status, Checks: checks})
+}
+
+func (h *HealthApiHandler) pingDb() bool {
+	if sqlDb, err := h.db.DB(); err == nil {
+		if err := sqlDb.Ping(); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestHealthApiHandler_Probes(t *testing.T) {
+	cfg := config.Empty()
+	cfg.SkipMigrations = true
+	config.Set(cfg)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.Nil(t, err)
+
+	router := chi.NewRouter()
+	NewHealthApiHandler(db).RegisterProbeRoutes(router)
+
+	get := func(path string) (int, probeResponse) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body probeResponse
+		json.NewDecoder(rec.Body).Decode(&body)
+		return rec.Code, body
+	}
+
+	t.Run("when alive", func(t *testing.T) {
+		code, body := get("/healthz")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "ok", body.Status)
+	})
+
+	t.Run("when ready", func(t *testing.T) {
+		code, body := get("/readyz")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "ready", body.Status)
+		assert.True(t, body.Checks["db"])
+	})
+
+	t.Run("when in maintenance", func(t *testing.T) {
+		cfg.Maintenance = true
+		defer func() { cfg.Maintenance = false }()
+
+		code, body := get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "unavailable", body.Status)
+		assert.False(t, body.Checks["maintenance"])
+	})
+
+	t.Run("when shutting down", func(t *testing.T) {
+		config.SetShuttingDown(true)
+		defer config.SetShuttingDown(false)
+
+		code, body := get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.False(t, body.Checks["shutdown"])
+	})
+
+	t.Run("when migrations pending", func(t *testing.T) {
+		cfg.SkipMigrations = false
+		defer func() { cfg.SkipMigrations = true }()
+
+		code, body := get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.False(t, body.Checks["migrations"])
+	})
+}
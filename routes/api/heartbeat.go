@@ -1,7 +1,12 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/duke-git/lancet/v2/condition"
+	datastructure "github.com/duke-git/lancet/v2/datastructure/set"
+	"github.com/duke-git/lancet/v2/slice"
 	"github.com/go-chi/chi/v5"
 	"github.com/muety/wakapi/helpers"
 	"github.com/rs/cors"
@@ -14,41 +19,54 @@ import (
 	"github.com/muety/wakapi/services"
 	"github.com/muety/wakapi/utils"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/muety/wakapi/models"
 )
 
+var (
+	errInvalidHeartbeat = errors.New("invalid heartbeat object")
+	errLateHeartbeat    = errors.New("heartbeat is too old, as its day's summary was already finalized")
+	errMissingFields    = errors.New("heartbeat is missing required fields")
+)
+
 type HeartbeatApiHandler struct {
 	config              *conf.Config
 	userSrvc            services.IUserService
 	heartbeatSrvc       services.IHeartbeatService
 	languageMappingSrvc services.ILanguageMappingService
+	rateLimitSrvc       services.IRateLimitService
+	projectMetadataSrvc services.IProjectMetadataService
 }
 
-func NewHeartbeatApiHandler(userService services.IUserService, heartbeatService services.IHeartbeatService, languageMappingService services.ILanguageMappingService) *HeartbeatApiHandler {
+func NewHeartbeatApiHandler(userService services.IUserService, heartbeatService services.IHeartbeatService, languageMappingService services.ILanguageMappingService, rateLimitService services.IRateLimitService, projectMetadataService services.IProjectMetadataService) *HeartbeatApiHandler {
 	return &HeartbeatApiHandler{
 		config:              conf.Get(),
 		userSrvc:            userService,
 		heartbeatSrvc:       heartbeatService,
 		languageMappingSrvc: languageMappingService,
+		rateLimitSrvc:       rateLimitService,
+		projectMetadataSrvc: projectMetadataService,
 	}
 }
 
 func (h *HeartbeatApiHandler) RegisterRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
-		r.Use(
-			middlewares.NewAuthenticateMiddleware(h.userSrvc).WithOptionalForMethods(http.MethodOptions).Handler,
-			customMiddleware.NewWakatimeRelayMiddleware().Handler,
-		)
+		r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).WithOptionalForMethods(http.MethodOptions).WithAutoProvisioning().Handler)
+		if h.rateLimitSrvc != nil {
+			r.Use(middlewares.NewRateLimitMiddleware(h.rateLimitSrvc)) // before relaying, so that rejected heartbeats aren't forwarded either
+		}
+		r.Use(customMiddleware.NewWakatimeRelayMiddleware().Handler)
 		// see https://github.com/muety/wakapi/issues/203
 		r.Post("/heartbeat", h.Post)
 		r.Post("/heartbeats", h.Post)
 		r.Post("/users/{user}/heartbeats", h.Post)
-		r.Post("/users/{user}/heartbeats.bulk", h.Post)
+		r.Post("/users/{user}/heartbeats.bulk", h.PostBulk)
 		r.Post("/v1/users/{user}/heartbeats", h.Post)
-		r.Post("/v1/users/{user}/heartbeats.bulk", h.Post)
+		r.Post("/v1/users/{user}/heartbeats.bulk", h.PostBulk)
 		r.Post("/compat/wakatime/v1/users/{user}/heartbeats", h.Post)
-		r.Post("/compat/wakatime/v1/users/{user}/heartbeats.bulk", h.Post)
+		r.Post("/compat/wakatime/v1/users/{user}/heartbeats.bulk", h.PostBulk)
 
 		// https://github.com/muety/wakapi/issues/690
 		for _, route := range r.Routes() {
@@ -71,6 +89,10 @@ func (h *HeartbeatApiHandler) Post(w http.ResponseWriter, r *http.Request) {
 		return // response was already sent by util function
 	}
 
+	if !h.checkQuota(w, r, user) {
+		return
+	}
+
 	var heartbeats []*models.Heartbeat
 	heartbeats, err = routeutils.ParseHeartbeats(r)
 	if err != nil {
@@ -80,15 +102,132 @@ func (h *HeartbeatApiHandler) Post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err, found := slice.FindBy(h.prepareHeartbeats(r, user, heartbeats), func(_ int, err error) bool { return err != nil }); found {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	ignored, err := h.persistHeartbeats(r, user, heartbeats)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusCreated, constructSuccessResponse(&heartbeats, ignored))
+}
+
+// @Summary Push new heartbeats in bulk
+// @Description Other than the single heartbeat endpoints, invalid heartbeats do not fail the whole batch, but are reported individually in the per-item responses.
+// @ID post-heartbeats-bulk
+// @Tags heartbeat
+// @Accept json
+// @Param heartbeat body []models.Heartbeat true "Multiple heartbeats"
+// @Param user path string true "Username (or current)"
+// @Security ApiKeyAuth
+// @Success 202 {object} v1.HeartbeatResponseViewModel
+// @Router /compat/wakatime/v1/users/{user}/heartbeats.bulk [post]
+func (h *HeartbeatApiHandler) PostBulk(w http.ResponseWriter, r *http.Request) {
+	user, err := routeutils.CheckEffectiveUser(w, r, h.userSrvc, "current")
+	if err != nil {
+		return // response was already sent by util function
+	}
+
+	if !h.checkQuota(w, r, user) {
+		return
+	}
+
+	heartbeats, err := routeutils.ParseHeartbeats(r)
+	if err != nil {
+		conf.Log().Request(r).Error("error occurred", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	errs := h.prepareHeartbeats(r, user, heartbeats)
+
+	valid := make([]*models.Heartbeat, 0, len(heartbeats))
+	for i, hb := range heartbeats {
+		if errs[i] == nil {
+			valid = append(valid, hb)
+		}
+	}
+
+	validIgnored, err := h.persistHeartbeats(r, user, valid)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		return
+	}
+
+	// map back to positions in the original batch
+	ignored := make([]bool, len(heartbeats))
+	for i, j := 0, 0; i < len(heartbeats); i++ {
+		if errs[i] == nil {
+			ignored[i] = validIgnored[j]
+			j++
+		}
+	}
+
+	helpers.RespondJSON(w, r, http.StatusAccepted, constructBulkResponse(errs, ignored))
+}
+
+// serverTimestampOffset returns by how much to shift the given heartbeats' times, so that the latest of them is set to the time of receipt, while keeping the time between them
+func serverTimestampOffset(heartbeats []*models.Heartbeat, receivedAt time.Time) time.Duration {
+	var latest time.Time
+	for _, hb := range heartbeats {
+		if hb != nil && hb.Time.T().After(latest) {
+			latest = hb.Time.T()
+		}
+	}
+	if latest.IsZero() {
+		return 0
+	}
+	return receivedAt.Sub(latest)
+}
+
+// checkQuota responds with an error and returns false if the user has exhausted their heartbeat quota
+func (h *HeartbeatApiHandler) checkQuota(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	err := h.heartbeatSrvc.CheckQuota(user)
+	if errors.Is(err, services.ErrHeartbeatQuotaExceeded) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(fmt.Sprintf("maximum number of %d stored heartbeats reached, new heartbeats are rejected until space is freed up", user.HeartbeatQuota())))
+		return false
+	}
+	if err != nil {
+		conf.Log().Request(r).Warn("failed to check heartbeat quota", "userID", user.ID, "error", err) // don't reject heartbeats because of this
+	}
+	return true
+}
+
+// prepareHeartbeats fills in request-level defaults and placeholders (inplace!) and returns a validation error per heartbeat (nil if valid)
+func (h *HeartbeatApiHandler) prepareHeartbeats(r *http.Request, user *models.User, heartbeats []*models.Heartbeat) []error {
 	userAgent := r.Header.Get("User-Agent")
 	opSys, editor, _ := utils.ParseUserAgent(userAgent)
 	machineName := r.Header.Get("X-Machine-Name")
 
-	for _, hb := range heartbeats {
+	errs := make([]error, len(heartbeats))
+	normalization := user.ProjectNormalization()
+	entityNormalization := user.EntityNormalization()
+	derivation := user.ProjectDerivation()
+	receivedAt := models.CustomTime(time.Now())
+	lateCutoff := h.config.App.LateHeartbeatsCutoff()
+	rejectMissing := h.config.App.HeartbeatsMissingFields == conf.HeartbeatsMissingFieldsReject
+	languageMappings := h.resolveLanguageDetection(r, user)
+
+	var nMissingRejected, nMissingDefaulted int
+
+	var serverTimeOffset time.Duration
+	if user.ServerTimestamps {
+		serverTimeOffset = serverTimestampOffset(heartbeats, receivedAt.T())
+	}
+
+	for i, hb := range heartbeats {
 		if hb == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("invalid heartbeat object"))
-			return
+			errs[i] = errInvalidHeartbeat
+			continue
 		}
 
 		// TODO: unit test this
@@ -102,7 +241,25 @@ func (h *HeartbeatApiHandler) Post(w http.ResponseWriter, r *http.Request) {
 			machineName = hb.Machine
 		}
 
+		if missing := hb.MissingFields(); len(missing) > 0 {
+			if rejectMissing {
+				errs[i] = fmt.Errorf("%w: %s", errMissingFields, strings.Join(missing, ", "))
+				nMissingRejected++
+				continue
+			}
+			hb.FillMissingFields()
+			nMissingDefaulted++
+		}
+
 		hb = fillPlaceholders(hb, user, h.heartbeatSrvc)
+		hb.Entity = entityNormalization.Apply(hb.Entity, hb.Type)
+		hb.DetectLanguage(languageMappings, user.OverrideLanguages)
+		hb.Project = normalization.Apply(derivation.Apply(hb.Project, hb.Entity, hb.Type))
+
+		// categories sent by the plugin always take precedence over the server's rules
+		if hb.Category == "" {
+			hb.Category = h.config.App.ClassifyCategory(hb.Entity, hb.Type, hb.Language)
+		}
 
 		hb.User = user
 		hb.UserID = user.ID
@@ -111,39 +268,140 @@ func (h *HeartbeatApiHandler) Post(w http.ResponseWriter, r *http.Request) {
 		hb.Editor = editor
 		hb.UserAgent = userAgent
 
+		// for clients with unreliable clocks, applied before validation, so skewed heartbeats aren't rejected as being untimely
+		if user.ServerTimestamps && !hb.Time.T().IsZero() {
+			hb.Time = models.CustomTime(hb.Time.T().Add(serverTimeOffset))
+		}
+
 		if !hb.Valid() || !hb.Timely(h.config.App.HeartbeatsMaxAge()) {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("invalid heartbeat object"))
-			return
+			errs[i] = errInvalidHeartbeat
+			continue
+		}
+		if hb.Time.T().Before(lateCutoff) {
+			errs[i] = errLateHeartbeat
+			continue
 		}
 
 		hb.Hashed()
 	}
 
-	if err := h.heartbeatSrvc.InsertBatch(heartbeats); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(conf.ErrInternalServerError))
+	if nMissingRejected > 0 || nMissingDefaulted > 0 {
+		conf.Log().Request(r).Info("received heartbeats missing required fields", "userID", user.ID, "total", len(heartbeats), "rejected", nMissingRejected, "defaulted", nMissingDefaulted)
+	}
+
+	return errs
+}
+
+// persistHeartbeats drops heartbeats matching the user's ignore patterns and stores the remaining ones, returning which ones were ignored
+func (h *HeartbeatApiHandler) persistHeartbeats(r *http.Request, user *models.User, heartbeats []*models.Heartbeat) ([]bool, error) {
+	ignorePatterns, err := models.ParseIgnorePatterns(user.IgnorePatterns)
+	if err != nil {
+		conf.Log().Request(r).Warn("failed to parse ignore patterns", "userID", user.ID, "error", err)
+	}
+
+	ignoreDeadline := time.Now().Add(models.IgnoreRegexTimeout)
+	ignored := make([]bool, len(heartbeats))
+	accepted := make([]*models.Heartbeat, 0, len(heartbeats))
+	for i, hb := range heartbeats {
+		if ignored[i] = ignorePatterns.Matches(hb, ignoreDeadline); !ignored[i] {
+			accepted = append(accepted, hb)
+		}
+	}
+	if time.Now().After(ignoreDeadline) {
+		conf.Log().Request(r).Warn("timeout while evaluating ignore patterns, skipped remaining regular expressions", "userID", user.ID)
+	}
+
+	// has to happen before inserting, as that will make the projects known
+	if user.NewProjectsPrivate && h.projectMetadataSrvc != nil {
+		h.markNewProjectsPrivate(r, user, accepted)
+	}
+
+	if err := h.heartbeatSrvc.InsertBatch(accepted); err != nil {
 		conf.Log().Request(r).Error("failed to batch-insert heartbeats", "error", err)
-		return
+		return nil, err
 	}
 
-	if !user.HasData {
+	if len(accepted) > 0 && h.config.App.InferTimezones && !user.HasLocation() {
+		h.inferLocation(r, user)
+	}
+
+	if len(accepted) > 0 && !user.HasData {
 		user.HasData = true
 		if _, err := h.userSrvc.Update(user); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(conf.ErrInternalServerError))
 			conf.Log().Request(r).Error("failed to update user", "userID", user.ID, "error", err)
-			return
+			return nil, err
 		}
 	}
 
-	defer func() {}()
+	if len(accepted) > 0 {
+		h.updateLastPlugin(r, user, accepted[len(accepted)-1].UserAgent)
+	}
+
+	return ignored, nil
+}
+
+// inferLocation sets the user's time zone from the one reported by wakatime-cli, which sends the machine's local time zone with every request
+func (h *HeartbeatApiHandler) inferLocation(r *http.Request, user *models.User) {
+	if _, err := h.userSrvc.InferLocation(user, r.Header.Get("TimeZone")); err != nil {
+		conf.Log().Request(r).Warn("failed to infer time zone", "userID", user.ID, "error", err)
+	}
+}
 
-	helpers.RespondJSON(w, r, http.StatusCreated, constructSuccessResponse(&heartbeats))
+// resolveLanguageDetection returns the mappings to detect the heartbeats' languages by, falling back to the defaults if the user's ones fail to load
+func (h *HeartbeatApiHandler) resolveLanguageDetection(r *http.Request, user *models.User) map[string]string {
+	if h.languageMappingSrvc == nil {
+		return models.DefaultLanguageMappings
+	}
+	mappings, err := h.languageMappingSrvc.ResolveDetectionByUser(user.ID)
+	if err != nil {
+		conf.Log().Request(r).Warn("failed to resolve language mappings", "userID", user.ID, "error", err)
+		return models.DefaultLanguageMappings
+	}
+	return mappings
+}
+
+// markNewProjectsPrivate marks projects private, which the given heartbeats are the very first ones of
+// projects that already have metadata were explicitly configured by the user before and are left as they are
+func (h *HeartbeatApiHandler) markNewProjectsPrivate(r *http.Request, user *models.User, heartbeats []*models.Heartbeat) {
+	known, err := h.heartbeatSrvc.GetEntitySetByUser(models.SummaryProject, user.ID)
+	if err != nil {
+		conf.Log().Request(r).Warn("failed to get known projects", "userID", user.ID, "error", err)
+		return
+	}
+	metadata, err := h.projectMetadataSrvc.GetMapped(user.ID)
+	if err != nil {
+		conf.Log().Request(r).Warn("failed to get project metadata", "userID", user.ID, "error", err)
+		return
+	}
+
+	seen := datastructure.New(known...)
+	for _, hb := range heartbeats {
+		if _, ok := metadata[hb.Project]; ok || hb.Project == "" || seen.Contain(hb.Project) {
+			continue
+		}
+		seen.Add(hb.Project)
+
+		if err := h.projectMetadataSrvc.Set(&models.ProjectMetadata{UserID: user.ID, Project: hb.Project, Private: true}); err != nil {
+			conf.Log().Request(r).Warn("failed to mark new project private", "userID", user.ID, "project", hb.Project, "error", err)
+		}
+	}
+}
+
+// updateLastPlugin records the plugin and version reported by the given user agent
+// unparseable user agents are ignored, plugins are never rejected for being outdated
+func (h *HeartbeatApiHandler) updateLastPlugin(r *http.Request, user *models.User, userAgent string) {
+	plugin, version, err := utils.ParsePluginVersion(userAgent)
+	if err != nil || len(plugin) > 64 || len(version) > 32 { // see column sizes
+		return
+	}
+	if _, err := h.userSrvc.SetLastPlugin(user, plugin, version); err != nil {
+		conf.Log().Request(r).Warn("failed to update last plugin", "userID", user.ID, "error", err)
+	}
 }
 
 // construct wakatime response format https://wakatime.com/developers#heartbeats (well, not quite...)
-func constructSuccessResponse(heartbeats *[]*models.Heartbeat) *v1.HeartbeatResponseViewModel {
+// ignored heartbeats are reported with status 202 instead of 201, so clients won't retry them
+func constructSuccessResponse(heartbeats *[]*models.Heartbeat, ignored []bool) *v1.HeartbeatResponseViewModel {
 	vm := &v1.HeartbeatResponseViewModel{
 		Responses: make([][]interface{}, len(*heartbeats)),
 	}
@@ -155,12 +413,42 @@ func constructSuccessResponse(heartbeats *[]*models.Heartbeat) *v1.HeartbeatResp
 			Error: nil,
 		}
 		r[1] = http.StatusCreated
+		if ignored[i] {
+			r[1] = http.StatusAccepted
+			vm.Ignored++
+		}
 		vm.Responses[i] = r
 	}
 
 	return vm
 }
 
+// construct wakatime bulk response format, where every heartbeat gets its own status code
+// invalid heartbeats are reported with status 400 (and won't be retried by wakatime-cli), ignored ones with 202
+func constructBulkResponse(errs []error, ignored []bool) *v1.HeartbeatResponseViewModel {
+	vm := &v1.HeartbeatResponseViewModel{
+		Responses: make([][]interface{}, len(errs)),
+	}
+
+	for i, err := range errs {
+		data := &v1.HeartbeatResponseData{}
+		status := http.StatusCreated
+
+		switch {
+		case err != nil:
+			data.Error = err.Error()
+			status = http.StatusBadRequest
+		case ignored[i]:
+			status = http.StatusAccepted
+			vm.Ignored++
+		}
+
+		vm.Responses[i] = []interface{}{data, status}
+	}
+
+	return vm
+}
+
 // inplace!
 func fillPlaceholders(hb *models.Heartbeat, user *models.User, srv services.IHeartbeatService) *models.Heartbeat {
 	// wakatime has a special keyword that indicates to use the most recent project for a given heartbeat
@@ -249,21 +537,10 @@ func (h *HeartbeatApiHandler) postAlias4() {}
 // @Param heartbeat body []models.Heartbeat true "Multiple heartbeats"
 // @Param user path string true "Username (or current)"
 // @Security ApiKeyAuth
-// @Success 201
+// @Success 202 {object} v1.HeartbeatResponseViewModel
 // @Router /v1/users/{user}/heartbeats.bulk [post]
 func (h *HeartbeatApiHandler) postAlias5() {}
 
-// @Summary Push new heartbeats
-// @ID post-heartbeat-7
-// @Tags heartbeat
-// @Accept json
-// @Param heartbeat body []models.Heartbeat true "Multiple heartbeats"
-// @Param user path string true "Username (or current)"
-// @Security ApiKeyAuth
-// @Success 201
-// @Router /compat/wakatime/v1/users/{user}/heartbeats.bulk [post]
-func (h *HeartbeatApiHandler) postAlias6() {}
-
 // @Summary Push new heartbeats
 // @ID post-heartbeat-8
 // @Tags heartbeat
@@ -271,6 +548,6 @@ func (h *HeartbeatApiHandler) postAlias6() {}
 // @Param heartbeat body []models.Heartbeat true "Multiple heartbeats"
 // @Param user path string true "Username (or current)"
 // @Security ApiKeyAuth
-// @Success 201
+// @Success 202 {object} v1.HeartbeatResponseViewModel
 // @Router /users/{user}/heartbeats.bulk [post]
 func (h *HeartbeatApiHandler) postAlias7() {}
@@ -1,11 +1,18 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/middlewares"
 	"github.com/muety/wakapi/mocks"
 	"github.com/muety/wakapi/models"
+	v1 "github.com/muety/wakapi/models/compat/wakatime/v1"
+	"github.com/muety/wakapi/services"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"net/http"
@@ -24,7 +31,7 @@ func TestHeartbeatHandler_Options(t *testing.T) {
 	userServiceMock := new(mocks.UserServiceMock)
 	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
 
-	heartbeatHandler := NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil)
+	heartbeatHandler := NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil)
 	heartbeatHandler.RegisterRoutes(apiRouter)
 
 	t.Run("when receiving cors preflight request", func(t *testing.T) {
@@ -104,3 +111,493 @@ func Test_fillPlaceholders(t *testing.T) {
 		})
 	})
 }
+
+func Test_constructSuccessResponse(t *testing.T) {
+	heartbeats := []*models.Heartbeat{{Entity: "main.go"}, {Entity: "node_modules/index.js"}, {Entity: "README.md"}}
+
+	vm := constructSuccessResponse(&heartbeats, []bool{false, true, false})
+
+	assert.Len(t, vm.Responses, 3)
+	assert.Equal(t, 1, vm.Ignored)
+	assert.Equal(t, http.StatusCreated, vm.Responses[0][1])
+	assert.Equal(t, http.StatusAccepted, vm.Responses[1][1])
+	assert.Equal(t, http.StatusCreated, vm.Responses[2][1])
+}
+
+func TestHeartbeatHandler_PostBulk(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxAge = "8760h"
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("InsertBatch", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil).PostBulk)
+
+	t.Run("when receiving partially invalid batch", func(t *testing.T) {
+		t.Run("should store valid heartbeats and report status per item", func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			body := fmt.Sprintf(`[
+				{"entity": "main.go", "type": "file", "project": "wakapi", "time": %d},
+				{"entity": "main.go", "type": "file", "project": "wakapi"},
+				{"entity": "README.md", "type": "file", "project": "wakapi", "time": %d}
+			]`, time.Now().Unix(), time.Now().Add(1*time.Second).Unix())
+			req := httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body))
+
+			router.ServeHTTP(rec, req)
+			res := rec.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, http.StatusAccepted, res.StatusCode)
+
+			var vm v1.HeartbeatResponseViewModel
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&vm))
+			assert.Len(t, vm.Responses, 3)
+			assert.EqualValues(t, http.StatusCreated, vm.Responses[0][1])
+			assert.EqualValues(t, http.StatusBadRequest, vm.Responses[1][1])
+			assert.EqualValues(t, http.StatusCreated, vm.Responses[2][1])
+			assert.Equal(t, "invalid heartbeat object", vm.Responses[1][0].(map[string]interface{})["error"])
+
+			heartbeatServiceMock.AssertCalled(t, "InsertBatch", mock.MatchedBy(func(heartbeats []*models.Heartbeat) bool {
+				return len(heartbeats) == 2
+			}))
+		})
+	})
+}
+
+func TestHeartbeatHandler_PostBulk_QuotaExceeded(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.MaxHeartbeats = 100
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(services.ErrHeartbeatQuotaExceeded)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil).PostBulk)
+
+	rec := httptest.NewRecorder()
+	body := fmt.Sprintf(`[{"entity": "main.go", "type": "file", "project": "wakapi", "time": %d}]`, time.Now().Unix())
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, rec.Body.String(), "maximum number of 100 stored heartbeats reached")
+	heartbeatServiceMock.AssertNotCalled(t, "InsertBatch", mock.Anything)
+}
+
+func TestHeartbeatHandler_PostBulk_LateHeartbeats(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxAge = "8760h"
+	cfg.App.LateHeartbeats = config.LateHeartbeatsReject
+	cfg.App.LateHeartbeatsHorizonDays = 3
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("InsertBatch", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil).PostBulk)
+
+	// beyond and within the horizon
+	body := fmt.Sprintf(`[
+		{"entity": "main.go", "type": "file", "project": "wakapi", "time": %d},
+		{"entity": "README.md", "type": "file", "project": "wakapi", "time": %d}
+	]`, time.Now().AddDate(0, 0, -5).Unix(), time.Now().AddDate(0, 0, -2).Unix())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body)))
+
+	var vm v1.HeartbeatResponseViewModel
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&vm))
+	assert.EqualValues(t, http.StatusBadRequest, vm.Responses[0][1])
+	assert.Equal(t, errLateHeartbeat.Error(), vm.Responses[0][0].(map[string]interface{})["error"])
+	assert.EqualValues(t, http.StatusCreated, vm.Responses[1][1])
+
+	heartbeatServiceMock.AssertCalled(t, "InsertBatch", mock.MatchedBy(func(heartbeats []*models.Heartbeat) bool {
+		return len(heartbeats) == 1 && heartbeats[0].Entity == "README.md"
+	}))
+}
+
+func TestHeartbeatHandler_PostBulk_MissingFields(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxAge = "4320h"
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("InsertBatch", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil).PostBulk)
+
+	body := fmt.Sprintf(`[
+		{"entity": "main.go", "type": "file", "project": "wakapi", "time": %d},
+		{"project": "wakapi", "time": %d}
+	]`, time.Now().Unix(), time.Now().Add(1*time.Second).Unix())
+
+	t.Run("should fill in defaults", func(t *testing.T) {
+		cfg.App.HeartbeatsMissingFields = config.HeartbeatsMissingFieldsDefaults
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body)))
+
+		var vm v1.HeartbeatResponseViewModel
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Nil(t, json.NewDecoder(rec.Body).Decode(&vm))
+		assert.EqualValues(t, http.StatusCreated, vm.Responses[0][1])
+		assert.EqualValues(t, http.StatusCreated, vm.Responses[1][1])
+
+		heartbeatServiceMock.AssertCalled(t, "InsertBatch", mock.MatchedBy(func(heartbeats []*models.Heartbeat) bool {
+			return len(heartbeats) == 2 && heartbeats[1].Entity == models.UnknownSummaryKey && heartbeats[1].Type == models.DefaultHeartbeatType
+		}))
+	})
+
+	t.Run("should reject only malformed heartbeats", func(t *testing.T) {
+		cfg.App.HeartbeatsMissingFields = config.HeartbeatsMissingFieldsReject
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body)))
+
+		var vm v1.HeartbeatResponseViewModel
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Nil(t, json.NewDecoder(rec.Body).Decode(&vm))
+		assert.EqualValues(t, http.StatusCreated, vm.Responses[0][1])
+		assert.EqualValues(t, http.StatusBadRequest, vm.Responses[1][1])
+		assert.Equal(t, "heartbeat is missing required fields: entity, type", vm.Responses[1][0].(map[string]interface{})["error"])
+
+		heartbeatServiceMock.AssertCalled(t, "InsertBatch", mock.MatchedBy(func(heartbeats []*models.Heartbeat) bool {
+			return len(heartbeats) == 1 && heartbeats[0].Entity == "main.go"
+		}))
+	})
+}
+
+func TestHeartbeatHandler_PostBulk_ServerTimestamps(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxAge = "4320h"
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true, ServerTimestamps: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("InsertBatch", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil).PostBulk)
+
+	// way too old, which would be rejected as untimely otherwise
+	clientTime := time.Now().AddDate(-10, 0, 0)
+	body := fmt.Sprintf(`[
+		{"entity": "main.go", "type": "file", "project": "wakapi", "time": %d},
+		{"entity": "README.md", "type": "file", "project": "wakapi", "time": %d}
+	]`, clientTime.Unix(), clientTime.Add(-2*time.Minute).Unix())
+
+	before := time.Now()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body)))
+
+	var vm v1.HeartbeatResponseViewModel
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&vm))
+	assert.EqualValues(t, http.StatusCreated, vm.Responses[0][1])
+	assert.EqualValues(t, http.StatusCreated, vm.Responses[1][1])
+
+	heartbeatServiceMock.AssertCalled(t, "InsertBatch", mock.MatchedBy(func(heartbeats []*models.Heartbeat) bool {
+		return len(heartbeats) == 2 &&
+			!heartbeats[0].Time.T().Before(before) && !heartbeats[0].Time.T().After(time.Now()) &&
+			heartbeats[0].Time.T().Sub(heartbeats[1].Time.T()) == 2*time.Minute // relative times kept
+	}))
+}
+
+func Test_serverTimestampOffset(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	heartbeats := []*models.Heartbeat{
+		{Time: models.CustomTime(t0)},
+		nil,
+		{Time: models.CustomTime(t0.Add(30 * time.Second))},
+		{Time: models.CustomTime(t0.Add(-1 * time.Hour))},
+	}
+	assert.Equal(t, 2*time.Hour-30*time.Second, serverTimestampOffset(heartbeats, t0.Add(2*time.Hour)))
+	assert.Equal(t, -30*time.Second, serverTimestampOffset(heartbeats, t0)) // clock ahead
+	assert.Zero(t, serverTimestampOffset([]*models.Heartbeat{{}}, t0))
+}
+
+func TestHeartbeatHandler_PostBulk_InferTimezones(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxAge = "4320h"
+	cfg.App.InferTimezones = true
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true}
+	configuredUser := &models.User{ID: "testuser02", HasData: true, Location: "Europe/London"}
+	principal := user
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("InferLocation", user, "Europe/Berlin").Return(false, nil)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("InsertBatch", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, principal)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil).PostBulk)
+
+	post := func() int {
+		body := fmt.Sprintf(`[{"entity": "main.go", "type": "file", "project": "wakapi", "time": %d}]`, time.Now().Unix())
+		req := httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body))
+		req.Header.Set("TimeZone", "Europe/Berlin")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusAccepted, post())
+	userServiceMock.AssertCalled(t, "InferLocation", user, "Europe/Berlin")
+
+	principal = configuredUser
+	assert.Equal(t, http.StatusAccepted, post())
+	userServiceMock.AssertNumberOfCalls(t, "InferLocation", 1)
+}
+
+func TestHeartbeatHandler_PostBulk_CategoryRules(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxAge = "8760h"
+	cfg.App.CategoryRules = []config.CategoryRule{
+		{Category: "browsing", Type: "url"},
+		{Category: "writing docs", Entity: "*.md"},
+	}
+	cfg.App.ParseCategoryRules()
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("InsertBatch", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil).PostBulk)
+
+	now := time.Now().Unix()
+	body := fmt.Sprintf(`[
+		{"entity": "https://go.dev", "type": "url", "project": "wakapi", "time": %d},
+		{"entity": "README.md", "type": "file", "project": "wakapi", "time": %d},
+		{"entity": "README.md", "type": "file", "category": "code reviewing", "project": "wakapi", "time": %d},
+		{"entity": "main.go", "type": "file", "project": "wakapi", "time": %d}
+	]`, now, now, now, now)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	heartbeatServiceMock.AssertCalled(t, "InsertBatch", mock.MatchedBy(func(heartbeats []*models.Heartbeat) bool {
+		return len(heartbeats) == 4 &&
+			heartbeats[0].Category == "browsing" &&
+			heartbeats[1].Category == "writing docs" &&
+			heartbeats[2].Category == "code reviewing" && // sent by plugin
+			heartbeats[3].Category == ""
+	}))
+}
+
+func TestHeartbeatHandler_PostBulk_ProjectDerivation(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxAge = "8760h"
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true, ProjectPathRoot: "/home/user/dev", ProjectPathSegment: 1, ProjectNameLowercase: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("InsertBatch", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil).PostBulk)
+
+	now := time.Now().Unix()
+	body := fmt.Sprintf(`[
+		{"entity": "/home/user/dev/Wakapi/main.go", "type": "file", "time": %d},
+		{"entity": "/home/user/dev/wakapi/main.go", "type": "file", "project": "other", "time": %d},
+		{"entity": "/tmp/main.go", "type": "file", "time": %d}
+	]`, now, now, now)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	heartbeatServiceMock.AssertCalled(t, "InsertBatch", mock.MatchedBy(func(heartbeats []*models.Heartbeat) bool {
+		return len(heartbeats) == 3 &&
+			heartbeats[0].Project == "wakapi" && // derived, then normalized
+			heartbeats[1].Project == "other" && // sent by plugin
+			heartbeats[2].Project == ""
+	}))
+}
+
+func Test_constructBulkResponse(t *testing.T) {
+	vm := constructBulkResponse([]error{nil, errInvalidHeartbeat, nil}, []bool{false, false, true})
+
+	assert.Len(t, vm.Responses, 3)
+	assert.Equal(t, 1, vm.Ignored)
+	assert.Equal(t, http.StatusCreated, vm.Responses[0][1])
+	assert.Equal(t, http.StatusBadRequest, vm.Responses[1][1])
+	assert.Equal(t, errInvalidHeartbeat.Error(), vm.Responses[1][0].(*v1.HeartbeatResponseData).Error)
+	assert.Equal(t, http.StatusAccepted, vm.Responses[2][1])
+}
+
+func TestHeartbeatHandler_PostBulk_LastPlugin(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxAge = "8760h"
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("SetLastPlugin", user, "vscode-wakatime", "24.8.0").Return(true, nil)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("InsertBatch", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, nil).PostBulk)
+
+	post := func(userAgent string) int {
+		rec := httptest.NewRecorder()
+		body := fmt.Sprintf(`[{"entity": "main.go", "type": "file", "project": "wakapi", "time": %d}]`, time.Now().Unix())
+		req := httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body))
+		req.Header.Set("User-Agent", userAgent)
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusAccepted, post("wakatime/v1.105.0 (linux-6.11.8-zen1-2-zen-unknown) go1.23.3 cursor/1.93.1 vscode-wakatime/24.8.0"))
+	userServiceMock.AssertNumberOfCalls(t, "SetLastPlugin", 1)
+
+	// unparseable user agents are ignored
+	assert.Equal(t, http.StatusAccepted, post("some-unknown-client"))
+	userServiceMock.AssertNumberOfCalls(t, "SetLastPlugin", 1)
+	userServiceMock.AssertNotCalled(t, "Update", mock.Anything)
+}
+
+func TestHeartbeatHandler_PostBulk_NewProjectsPrivate(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxAge = "8760h"
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01", HasData: true, NewProjectsPrivate: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CheckQuota", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("InsertBatch", mock.Anything).Return(nil)
+	heartbeatServiceMock.On("GetEntitySetByUser", models.SummaryProject, user.ID).Return([]string{"wakapi"}, nil)
+	projectMetadataServiceMock := new(mocks.ProjectMetadataServiceMock)
+	projectMetadataServiceMock.On("GetMapped", user.ID).Return(map[string]*models.ProjectMetadata{
+		"anchr": {UserID: user.ID, Project: "anchr", Color: "#00ff00"},
+	}, nil)
+	projectMetadataServiceMock.On("Set", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/users/{user}/heartbeats.bulk", NewHeartbeatApiHandler(userServiceMock, heartbeatServiceMock, nil, nil, projectMetadataServiceMock).PostBulk)
+
+	// known project, project with metadata configured already, new project (twice) and no project
+	body := fmt.Sprintf(`[
+		{"entity": "main.go", "type": "file", "project": "wakapi", "time": %d},
+		{"entity": "main.go", "type": "file", "project": "anchr", "time": %d},
+		{"entity": "main.go", "type": "file", "project": "secret-project", "time": %d},
+		{"entity": "README.md", "type": "file", "project": "secret-project", "time": %d},
+		{"entity": "notes.txt", "type": "file", "time": %d}
+	]`, time.Now().Unix(), time.Now().Unix(), time.Now().Unix(), time.Now().Unix(), time.Now().Unix())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	projectMetadataServiceMock.AssertNumberOfCalls(t, "Set", 1)
+	projectMetadataServiceMock.AssertCalled(t, "Set", &models.ProjectMetadata{UserID: user.ID, Project: "secret-project", Private: true})
+	heartbeatServiceMock.AssertNumberOfCalls(t, "InsertBatch", 1)
+
+	// disabled by default
+	user.NewProjectsPrivate = false
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/current/heartbeats.bulk", strings.NewReader(body)))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	projectMetadataServiceMock.AssertNumberOfCalls(t, "Set", 1)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+)
+
+const importIdLatest = "latest"
+
+type ImportsApiHandler struct {
+	config             *conf.Config
+	userSrvc           services.IUserService
+	importSnapshotSrvc services.IImportSnapshotService
+}
+
+func NewImportsApiHandler(userService services.IUserService, importSnapshotService services.IImportSnapshotService) *ImportsApiHandler {
+	return &ImportsApiHandler{
+		config:             conf.Get(),
+		userSrvc:           userService,
+		importSnapshotSrvc: importSnapshotService,
+	}
+}
+
+func (h *ImportsApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/", h.GetAll)
+	r.Get("/{id}/diff", h.GetDiff)
+
+	router.Mount("/imports", r)
+}
+
+// @Summary List the user's recent data imports
+// @Description Returns the diffs of the most recent imports, latest first. Only a limited number of imports is retained per user.
+// @ID get-imports
+// @Tags import
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.ImportDiff
+// @Failure 401 {string} string "unauthorized"
+// @Router /imports [get]
+func (h *ImportsApiHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	snapshots, err := h.importSnapshotSrvc.GetByUser(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to load import snapshots", "userID", user.ID, "error", err)
+		return
+	}
+
+	diffs := make([]*models.ImportDiff, len(snapshots))
+	for i, s := range snapshots {
+		diffs[i] = s.Diff()
+	}
+	helpers.RespondJSON(w, r, http.StatusOK, diffs)
+}
+
+// @Summary Compare a user's coding time before and after an import
+// @Description Compares the all-time totals captured right before the import against those right after it finished, listing the time added per project and language in seconds. Imports still in progress are reported as not finished.
+// @ID get-import-diff
+// @Tags import
+// @Produce json
+// @Param id path string true "Import ID or 'latest'"
+// @Security ApiKeyAuth
+// @Success 200 {object} models.ImportDiff
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "not found"
+// @Router /imports/{id}/diff [get]
+func (h *ImportsApiHandler) GetDiff(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	var (
+		snapshot *models.ImportSnapshot
+		err      error
+	)
+	if id := chi.URLParam(r, "id"); id == importIdLatest {
+		snapshot, err = h.importSnapshotSrvc.GetLatest(user)
+	} else {
+		snapshot, err = h.importSnapshotSrvc.GetById(user, id)
+	}
+	if errors.Is(err, services.ErrImportSnapshotNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to load import snapshot", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, snapshot.Diff())
+}
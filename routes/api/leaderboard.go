@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/services"
+)
+
+type leaderboardRecomputeResponse struct {
+	Interval    string `json:"interval"`
+	UsersRanked int    `json:"users_ranked"`
+	DurationMs  int64  `json:"duration_ms"`
+}
+
+type LeaderboardApiHandler struct {
+	config          *conf.Config
+	userSrvc        services.IUserService
+	leaderboardSrvc services.ILeaderboardService
+}
+
+func NewLeaderboardApiHandler(userService services.IUserService, leaderboardService services.ILeaderboardService) *LeaderboardApiHandler {
+	return &LeaderboardApiHandler{
+		config:          conf.Get(),
+		userSrvc:        userService,
+		leaderboardSrvc: leaderboardService,
+	}
+}
+
+func (h *LeaderboardApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Post("/recompute", h.PostRecompute)
+
+	router.Mount("/admin/leaderboard", r)
+}
+
+// @Summary Recompute the leaderboard
+// @Description Immediately regenerates the leaderboard of all participating users, e.g. after data corrections or imports, instead of waiting for the next scheduled run. Blocks until done. Only one generation runs at a time.
+// @ID post-admin-leaderboard-recompute
+// @Tags admin
+// @Param interval query string false "Interval identifier to recompute, defaults to the configured leaderboard scope"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.leaderboardRecomputeResponse
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 409 {string} string "leaderboard generation already in progress"
+// @Router /admin/leaderboard/recompute [post]
+func (h *LeaderboardApiHandler) PostRecompute(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil || !user.IsAdmin {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	if !h.config.App.LeaderboardEnabled {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("leaderboard is disabled"))
+		return
+	}
+
+	interval := h.leaderboardSrvc.GetDefaultScope()
+	if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+		var err error
+		if interval, err = helpers.ParseInterval(intervalParam); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid 'interval' parameter"))
+			return
+		}
+	}
+
+	t0 := time.Now()
+	ranked, err := h.leaderboardSrvc.ComputeAll(interval)
+	if errors.Is(err, services.ErrLeaderboardGenerationRunning) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to recompute leaderboard", "error", err)
+		return
+	}
+
+	took := time.Since(t0)
+	conf.Log().Request(r).Info("recomputed leaderboard on demand", "interval", (*interval)[0], "rankedCount", ranked, "duration", took)
+
+	helpers.RespondJSON(w, r, http.StatusOK, leaderboardRecomputeResponse{
+		Interval:    (*interval)[0],
+		UsersRanked: ranked,
+		DurationMs:  took.Milliseconds(),
+	})
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+	"github.com/muety/wakapi/services/mail"
+)
+
+type testMailResponse struct {
+	Recipient string `json:"recipient"`
+	Template  string `json:"template,omitempty"`
+}
+
+type MailApiHandler struct {
+	config   *conf.Config
+	userSrvc services.IUserService
+	mailSrvc services.IMailService
+}
+
+func NewMailApiHandler(userService services.IUserService, mailService services.IMailService) *MailApiHandler {
+	return &MailApiHandler{
+		config:   conf.Get(),
+		userSrvc: userService,
+		mailSrvc: mailService,
+	}
+}
+
+func (h *MailApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Post("/test", h.PostTest)
+	r.Get("/queue", h.GetQueue)
+
+	router.Mount("/admin/mail", r)
+}
+
+// @Summary Send a test mail
+// @Description Renders the given mail template with sample data and sends it to the authenticated admin's e-mail address, to verify mail settings and template overrides. Omitting the template sends a generic test mail.
+// @ID post-admin-mail-test
+// @Tags admin
+// @Param template query string false "Name of the template to render, e.g. reset_password"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.testMailResponse
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 502 {string} string "failed to send mail"
+// @Router /admin/mail/test [post]
+func (h *MailApiHandler) PostTest(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil || !user.IsAdmin {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	if !h.config.Mail.Enabled {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("mail is disabled"))
+		return
+	}
+	if user.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("no e-mail address configured for your account"))
+		return
+	}
+
+	tplName := r.URL.Query().Get("template")
+	if err := h.mailSrvc.SendTestMail(user, tplName); err != nil {
+		if errors.Is(err, mail.ErrUnknownTemplate) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		conf.Log().Request(r).Error("failed to send test mail", "template", tplName, "error", err)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(fmt.Sprintf("failed to send mail: %v", err)))
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, testMailResponse{Recipient: user.Email, Template: tplName})
+}
+
+// @Summary List queued outbound mails
+// @Description Lists the most recent mails, which are still pending to be retried or have been dead-lettered after all attempts to send them failed. Always empty if retries are disabled (see mail.max_attempts).
+// @ID get-admin-mail-queue
+// @Tags admin
+// @Produce json
+// @Param status query string false "Status of the mails to list (pending, dead_letter or sent), defaults to pending"
+// @Security ApiKeyAuth
+// @Success 200 {array} models.QueuedMail
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Router /admin/mail/queue [get]
+func (h *MailApiHandler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil || !user.IsAdmin {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.QueuedMailPending
+	}
+	if status != models.QueuedMailPending && status != models.QueuedMailDeadLetter && status != models.QueuedMailSent {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid status"))
+		return
+	}
+
+	mails, err := h.mailSrvc.GetQueued(status)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get queued mails", "status", status, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, mails)
+}
@@ -44,7 +44,10 @@ const (
 	DescAdminActiveUsers     = "Number of active users."
 
 	DescJobQueueEnqueued      = "Number of jobs currently enqueued"
+	DescJobQueueWaiting       = "Number of jobs currently waiting for a free job slot"
+	DescJobQueueRunning       = "Number of jobs currently running"
 	DescJobQueueTotalFinished = "Total number of processed jobs"
+	DescJobsMaxConcurrent     = "Maximum number of jobs to run concurrently (0 for unlimited)"
 
 	DescMemAlloc        = "Total number of bytes currently allocated for heap"
 	DescMemSys          = "Total number of bytes currently obtained from the OS"
@@ -368,6 +371,20 @@ func (h *MetricsHandler) getUserMetrics(user *models.User) (*mm.Metrics, error)
 			Labels: []mm.Label{{Key: "queue", Value: qm.Queue}},
 		})
 
+		metrics = append(metrics, &mm.GaugeMetric{
+			Name:   MetricsPrefix + "_queue_jobs_waiting",
+			Value:  int64(qm.WaitingJobs),
+			Desc:   DescJobQueueWaiting,
+			Labels: []mm.Label{{Key: "queue", Value: qm.Queue}},
+		})
+
+		metrics = append(metrics, &mm.GaugeMetric{
+			Name:   MetricsPrefix + "_queue_jobs_running",
+			Value:  int64(qm.RunningJobs),
+			Desc:   DescJobQueueRunning,
+			Labels: []mm.Label{{Key: "queue", Value: qm.Queue}},
+		})
+
 		metrics = append(metrics, &mm.CounterMetric{
 			Name:   MetricsPrefix + "_queue_jobs_total_finished",
 			Value:  int64(qm.FinishedJobs),
@@ -376,6 +393,13 @@ func (h *MetricsHandler) getUserMetrics(user *models.User) (*mm.Metrics, error)
 		})
 	}
 
+	metrics = append(metrics, &mm.GaugeMetric{
+		Name:   MetricsPrefix + "_jobs_max_concurrent",
+		Value:  int64(h.config.App.GetMaxConcurrentJobs()),
+		Desc:   DescJobsMaxConcurrent,
+		Labels: []mm.Label{},
+	})
+
 	return &metrics, nil
 }
 
@@ -0,0 +1,413 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+	"github.com/muety/wakapi/utils"
+)
+
+type createOrgRequest struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type orgInviteResponse struct {
+	Code string `json:"code"`
+	Link string `json:"link"`
+}
+
+type OrgApiHandler struct {
+	config          *conf.Config
+	userSrvc        services.IUserService
+	orgSrvc         services.IOrgService
+	leaderboardSrvc services.ILeaderboardService
+}
+
+func NewOrgApiHandler(userService services.IUserService, orgService services.IOrgService, leaderboardService services.ILeaderboardService) *OrgApiHandler {
+	return &OrgApiHandler{
+		config:          conf.Get(),
+		userSrvc:        userService,
+		orgSrvc:         orgService,
+		leaderboardSrvc: leaderboardService,
+	}
+}
+
+func (h *OrgApiHandler) RegisterRoutes(router chi.Router) {
+	if !h.config.App.OrgsEnabled {
+		return
+	}
+
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/", h.GetAll)
+	r.Post("/", h.Post)
+	r.Get("/{org}/members", h.GetMembers)
+	r.Put("/{org}/members/{user}", h.PutMember)
+	r.Delete("/{org}/members/{user}", h.DeleteMember)
+	r.Post("/{org}/invites", h.PostInvite)
+	r.Get("/{org}/leaderboard", h.GetLeaderboard)
+	r.Get("/{org}/report", h.GetReport)
+
+	router.Mount("/orgs", r)
+}
+
+// @Summary List orgs
+// @Description Super admins get all orgs, org admins only their own one
+// @ID get-orgs
+// @Tags org
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.Org
+// @Failure 401 {string} string "unauthorized"
+// @Router /orgs [get]
+func (h *OrgApiHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	principal := middlewares.GetPrincipal(r)
+
+	if principal.IsAdmin {
+		orgs, err := h.orgSrvc.GetAll()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(conf.ErrInternalServerError))
+			conf.Log().Request(r).Error("failed to get orgs", "error", err)
+			return
+		}
+		helpers.RespondJSON(w, r, http.StatusOK, orgs)
+		return
+	}
+
+	if principal.OrgID == nil || !principal.CanManageOrg(*principal.OrgID) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	org, err := h.orgSrvc.GetById(*principal.OrgID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get org", "orgID", *principal.OrgID, "error", err)
+		return
+	}
+	helpers.RespondJSON(w, r, http.StatusOK, []*models.Org{org})
+}
+
+// @Summary Create an org
+// @Description Only available to super admins
+// @ID post-org
+// @Tags org
+// @Accept json
+// @Produce json
+// @Param org body api.createOrgRequest true "Org to create"
+// @Security ApiKeyAuth
+// @Success 201 {object} models.Org
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 409 {string} string "conflict"
+// @Router /orgs [post]
+func (h *OrgApiHandler) Post(w http.ResponseWriter, r *http.Request) {
+	principal := middlewares.GetPrincipal(r)
+	if !principal.IsAdmin {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	var req createOrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(conf.ErrBadRequest))
+		return
+	}
+
+	org, err := h.orgSrvc.Create(&models.Org{ID: req.ID, Name: req.Name})
+	if errors.Is(err, services.ErrInvalidOrg) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if errors.Is(err, services.ErrOrgExists) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to create org", "orgID", req.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusCreated, org)
+}
+
+// @Summary List an org's members
+// @ID get-org-members
+// @Tags org
+// @Produce json
+// @Param org path string true "Org ID"
+// @Security ApiKeyAuth
+// @Success 200 {array} models.OrgMember
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "not found"
+// @Router /orgs/{org}/members [get]
+func (h *OrgApiHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	_, org, ok := h.loadOrg(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.orgSrvc.GetMembers(org)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get org members", "orgID", org.ID, "error", err)
+		return
+	}
+
+	result := make([]*models.OrgMember, len(members))
+	for i, m := range members {
+		result[i] = models.NewOrgMember(m)
+	}
+	helpers.RespondJSON(w, r, http.StatusOK, result)
+}
+
+// @Summary Add a member to an org or update their role
+// @Description Super admins can add any user, who isn't yet member of another org. Org admins can only change the roles of existing members.
+// @ID put-org-member
+// @Tags org
+// @Produce json
+// @Param org path string true "Org ID"
+// @Param user path string true "User ID"
+// @Param admin query bool false "Whether to make the user an org admin"
+// @Security ApiKeyAuth
+// @Success 200 {object} models.OrgMember
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "not found"
+// @Failure 409 {string} string "conflict"
+// @Router /orgs/{org}/members/{user} [put]
+func (h *OrgApiHandler) PutMember(w http.ResponseWriter, r *http.Request) {
+	principal, org, ok := h.loadOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var admin bool
+	if adminParam := r.URL.Query().Get("admin"); adminParam != "" {
+		var err error
+		if admin, err = strconv.ParseBool(adminParam); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(conf.ErrBadRequest))
+			return
+		}
+	}
+
+	// org admins can't pull in arbitrary users, but have to invite them
+	user, ok := h.loadMember(w, r, principal)
+	if !ok {
+		return
+	}
+
+	user, err := h.orgSrvc.AddMember(org, user, admin)
+	if errors.Is(err, services.ErrOtherOrg) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to update org member", "orgID", org.ID, "userID", chi.URLParam(r, "user"), "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, models.NewOrgMember(user))
+}
+
+// @Summary Remove a member from an org
+// @ID delete-org-member
+// @Tags org
+// @Param org path string true "Org ID"
+// @Param user path string true "User ID"
+// @Security ApiKeyAuth
+// @Success 204
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "not found"
+// @Router /orgs/{org}/members/{user} [delete]
+func (h *OrgApiHandler) DeleteMember(w http.ResponseWriter, r *http.Request) {
+	principal, org, ok := h.loadOrg(w, r)
+	if !ok {
+		return
+	}
+
+	user, ok := h.loadMember(w, r, principal)
+	if !ok {
+		return
+	}
+
+	if _, err := h.orgSrvc.RemoveMember(org, user); errors.Is(err, services.ErrNotOrgMember) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to remove org member", "orgID", org.ID, "userID", user.ID, "error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Generate an invite code to sign up as member of an org
+// @ID post-org-invite
+// @Tags org
+// @Produce json
+// @Param org path string true "Org ID"
+// @Security ApiKeyAuth
+// @Success 201 {object} api.orgInviteResponse
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "not found"
+// @Router /orgs/{org}/invites [post]
+func (h *OrgApiHandler) PostInvite(w http.ResponseWriter, r *http.Request) {
+	principal, org, ok := h.loadOrg(w, r)
+	if !ok {
+		return
+	}
+
+	code, err := h.orgSrvc.GenerateInvite(org, principal)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to generate org invite", "orgID", org.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusCreated, &orgInviteResponse{
+		Code: code,
+		Link: fmt.Sprintf("%s/signup?invite=%s", h.config.Server.GetBaseUrl(), code),
+	})
+}
+
+// @Summary Retrieve an org's leaderboard
+// @Description Ranks those of the org's members, who opted in to the public leaderboard, by their coding time within the leaderboard's default interval
+// @ID get-org-leaderboard
+// @Tags org
+// @Produce json
+// @Param org path string true "Org ID"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Page size"
+// @Security ApiKeyAuth
+// @Success 200 {array} models.LeaderboardItemRanked
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "not found, or leaderboard disabled"
+// @Router /orgs/{org}/leaderboard [get]
+func (h *OrgApiHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if !h.config.App.LeaderboardEnabled {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	_, org, ok := h.loadOrg(w, r)
+	if !ok {
+		return
+	}
+
+	pageParams := utils.ParsePageParamsWithDefault(r, 1, 100)
+	leaderboard, err := h.leaderboardSrvc.GetAggregatedByIntervalAndOrg(h.leaderboardSrvc.GetDefaultScope(), &org.ID, nil, pageParams, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get org leaderboard", "orgID", org.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, leaderboard)
+}
+
+// @Summary Retrieve the total coding time of each of an org's members
+// @ID get-org-report
+// @Tags org
+// @Produce json
+// @Param org path string true "Org ID"
+// @Param interval query string false "Interval to report on, defaults to the last 7 days" Enums(today, yesterday, week, last_week, month, last_month, year, last_year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, all_time)
+// @Security ApiKeyAuth
+// @Success 200 {array} models.OrgReportItem
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "not found"
+// @Router /orgs/{org}/report [get]
+func (h *OrgApiHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	_, org, ok := h.loadOrg(w, r)
+	if !ok {
+		return
+	}
+
+	interval := models.IntervalPast7Days
+	if intervalParam := r.URL.Query().Get("interval"); intervalParam != "" {
+		var err error
+		if interval, err = helpers.ParseInterval(intervalParam); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid interval"))
+			return
+		}
+	}
+
+	report, err := h.orgSrvc.GetReport(org, interval)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get org report", "orgID", org.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, report)
+}
+
+// loadOrg resolves the org from the request path and checks whether the principal may manage it, writing an error response otherwise
+func (h *OrgApiHandler) loadOrg(w http.ResponseWriter, r *http.Request) (*models.User, *models.Org, bool) {
+	principal := middlewares.GetPrincipal(r)
+	orgId := chi.URLParam(r, "org")
+
+	// check permissions before lookup to not disclose other orgs' existence
+	if !principal.CanManageOrg(orgId) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return nil, nil, false
+	}
+
+	org, err := h.orgSrvc.GetById(orgId)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return nil, nil, false
+	}
+	return principal, org, true
+}
+
+// loadMember resolves the user to modify from the request path, whom org admins may only modify if they aren't super admins
+func (h *OrgApiHandler) loadMember(w http.ResponseWriter, r *http.Request, principal *models.User) (*models.User, bool) {
+	user, err := h.userSrvc.GetUserById(chi.URLParam(r, "user"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return nil, false
+	}
+	if !principal.CanManageUser(user) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return nil, false
+	}
+	return user, true
+}
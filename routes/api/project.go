@@ -0,0 +1,515 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+)
+
+type archiveProjectRequest struct {
+	Project string `json:"project"`
+}
+
+type defaultBranchRequest struct {
+	Project string `json:"project"`
+	Branch  string `json:"branch"` // empty to unset
+}
+
+type projectMetadataRequest struct {
+	Project        string   `json:"project"`
+	Color          string   `json:"color"`           // hex code, e.g. '#00b4d8'
+	Icon           string   `json:"icon"`            // short string or emoji
+	Description    string   `json:"description"`     // all of color, icon and description empty, private false and no hourly rate to unset
+	Private        *bool    `json:"private"`         // show project as pseudonym to others, left unchanged if omitted
+	HourlyRate     *float64 `json:"hourly_rate"`     // for billing reports, requires a currency, left unchanged if omitted
+	Currency       *string  `json:"currency"`        // iso 4217 code, e.g. 'EUR', left unchanged if omitted
+	NotifyActivity bool     `json:"notify_activity"` // send project.started and project.stopped webhook events
+}
+
+type componentRuleRequest struct {
+	Project    string `json:"project"`
+	PathPrefix string `json:"path_prefix"` // e.g. 'services/api', relative to any directory of the file paths
+	Label      string `json:"label"`
+}
+
+type ProjectApiHandler struct {
+	config               *conf.Config
+	userSrvc             services.IUserService
+	projectArchiveSrvc   services.IProjectArchiveService
+	defaultBranchSrvc    services.IProjectDefaultBranchService
+	projectMetadataSrvc  services.IProjectMetadataService
+	projectComponentSrvc services.IProjectComponentService
+	projectDuplicateSrvc services.IProjectDuplicateService
+}
+
+func NewProjectApiHandler(userService services.IUserService, projectArchiveService services.IProjectArchiveService, defaultBranchService services.IProjectDefaultBranchService, projectMetadataService services.IProjectMetadataService, projectComponentService services.IProjectComponentService, projectDuplicateService services.IProjectDuplicateService) *ProjectApiHandler {
+	return &ProjectApiHandler{
+		config:               conf.Get(),
+		userSrvc:             userService,
+		projectArchiveSrvc:   projectArchiveService,
+		defaultBranchSrvc:    defaultBranchService,
+		projectMetadataSrvc:  projectMetadataService,
+		projectComponentSrvc: projectComponentService,
+		projectDuplicateSrvc: projectDuplicateService,
+	}
+}
+
+func (h *ProjectApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/archived", h.GetArchived)
+	r.Post("/archive", h.PostArchive)
+	r.Post("/unarchive", h.PostUnarchive)
+	r.Get("/default_branches", h.GetDefaultBranches)
+	r.Post("/default_branch", h.PostDefaultBranch)
+	r.Get("/metadata", h.GetMetadata)
+	r.Post("/metadata", h.PostMetadata)
+	r.Delete("/metadata", h.DeleteMetadata)
+	r.Get("/components", h.GetComponentRules)
+	r.Post("/components", h.PostComponentRule)
+	r.Delete("/components/{id}", h.DeleteComponentRule)
+	r.Get("/duplicates", h.GetDuplicates)
+
+	router.Mount("/projects", r)
+}
+
+// @Summary List the user's archived projects
+// @ID get-archived-projects
+// @Tags projects
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} string
+// @Router /projects/archived [get]
+func (h *ProjectApiHandler) GetArchived(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	archived, err := h.projectArchiveSrvc.GetArchived(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get archived projects", "userID", user.ID, "error", err)
+		return
+	}
+
+	projects := make([]string, 0, len(archived))
+	for p := range archived {
+		projects = append(projects, p)
+	}
+	sort.Strings(projects)
+
+	helpers.RespondJSON(w, r, http.StatusOK, projects)
+}
+
+// @Summary Archive a project
+// @Description Archived projects are hidden from project listings, but still count towards all totals.
+// @ID post-archive-project
+// @Tags projects
+// @Accept json
+// @Param project body api.archiveProjectRequest true "Project to archive"
+// @Security ApiKeyAuth
+// @Success 200
+// @Router /projects/archive [post]
+func (h *ProjectApiHandler) PostArchive(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, true)
+}
+
+// @Summary Unarchive a project
+// @ID post-unarchive-project
+// @Tags projects
+// @Accept json
+// @Param project body api.archiveProjectRequest true "Project to restore from archive"
+// @Security ApiKeyAuth
+// @Success 200
+// @Router /projects/unarchive [post]
+func (h *ProjectApiHandler) PostUnarchive(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, false)
+}
+
+func (h *ProjectApiHandler) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	var req archiveProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Project == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(conf.ErrBadRequest))
+		return
+	}
+
+	var err error
+	if archived {
+		err = h.projectArchiveSrvc.Archive(user, req.Project)
+	} else {
+		err = h.projectArchiveSrvc.Unarchive(user, req.Project)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to update project archive state", "userID", user.ID, "project", req.Project, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, struct{}{})
+}
+
+// @Summary List the user's default branches per project
+// @ID get-default-branches
+// @Tags projects
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.ProjectDefaultBranch
+// @Router /projects/default_branches [get]
+func (h *ProjectApiHandler) GetDefaultBranches(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	branches, err := h.defaultBranchSrvc.GetByUser(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get default branches", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, branches)
+}
+
+// @Summary Set or unset a project's default branch
+// @Description Heartbeats of the project without a meaningful branch name (empty, 'HEAD' or a commit hash on a detached checkout, as configured per unknown_branch_pattern) are attributed to its default branch instead, including when filtering by branch.
+// @ID post-default-branch
+// @Tags projects
+// @Accept json
+// @Param branch body api.defaultBranchRequest true "Project and its default branch, empty branch to unset"
+// @Security ApiKeyAuth
+// @Success 200
+// @Failure 400 {string} string "bad request"
+// @Router /projects/default_branch [post]
+func (h *ProjectApiHandler) PostDefaultBranch(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	var req defaultBranchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Project == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(conf.ErrBadRequest))
+		return
+	}
+
+	req.Branch = strings.TrimSpace(req.Branch)
+	if req.Branch != "" && h.config.App.IsUnknownBranch(req.Branch) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("default branch must not itself be an unknown branch name"))
+		return
+	}
+
+	var err error
+	if req.Branch == "" {
+		err = h.defaultBranchSrvc.Unset(user, req.Project)
+	} else {
+		err = h.defaultBranchSrvc.Set(user, req.Project, req.Branch)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to update default branch", "userID", user.ID, "project", req.Project, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, struct{}{})
+}
+
+// @Summary List the user's project metadata
+// @ID get-project-metadata
+// @Tags projects
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.ProjectMetadata
+// @Router /projects/metadata [get]
+func (h *ProjectApiHandler) GetMetadata(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	metadata, err := h.projectMetadataSrvc.GetByUser(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get project metadata", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, metadata)
+}
+
+// @Summary Create or update a project's metadata
+// @Description Sets a color, icon and description of a project, e.g. to be rendered by dashboards, and whether it's private, i.e. only shown as a pseudonym in stats shared with others. With notify_activity, the user's webhooks subscribed to 'project.started' and 'project.stopped' are called whenever they start or stop working on the project. Metadata is included in project listings and summaries. Metadata of projects renamed or merged into another one by an alias is shown for the alias target, unless that has metadata of its own.
+// @ID post-project-metadata
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param metadata body api.projectMetadataRequest true "Project and its metadata"
+// @Security ApiKeyAuth
+// @Success 200
+// @Failure 400 {string} string "bad request"
+// @Router /projects/metadata [post]
+func (h *ProjectApiHandler) PostMetadata(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	var req projectMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Project == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(conf.ErrBadRequest))
+		return
+	}
+
+	existing, err := h.projectMetadataSrvc.GetMapped(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get project metadata", "userID", user.ID, "error", err)
+		return
+	}
+
+	metadata := &models.ProjectMetadata{
+		UserID:         user.ID,
+		Project:        req.Project,
+		Color:          req.Color,
+		Icon:           req.Icon,
+		Description:    req.Description,
+		NotifyActivity: req.NotifyActivity,
+	}
+	if m, ok := existing[req.Project]; ok {
+		metadata.Private, metadata.HourlyRate, metadata.Currency = m.Private, m.HourlyRate, m.Currency
+	}
+	if req.Private != nil {
+		metadata.Private = *req.Private
+	}
+	if req.HourlyRate != nil {
+		metadata.HourlyRate = *req.HourlyRate
+	}
+	if req.Currency != nil {
+		metadata.Currency = *req.Currency
+	}
+
+	err = h.projectMetadataSrvc.Set(metadata)
+	if errors.Is(err, services.ErrInvalidProjectMetadata) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to update project metadata", "userID", user.ID, "project", req.Project, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, struct{}{})
+}
+
+// @Summary Delete a project's metadata
+// @ID delete-project-metadata
+// @Tags projects
+// @Param project query string true "Project to delete metadata of"
+// @Security ApiKeyAuth
+// @Success 204
+// @Failure 400 {string} string "bad request"
+// @Router /projects/metadata [delete]
+func (h *ProjectApiHandler) DeleteMetadata(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(conf.ErrBadRequest))
+		return
+	}
+
+	if err := h.projectMetadataSrvc.Unset(user, project); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to delete project metadata", "userID", user.ID, "project", project, "error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary List the user's project component rules
+// @ID get-project-component-rules
+// @Tags projects
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.ProjectComponentRule
+// @Router /projects/components [get]
+func (h *ProjectApiHandler) GetComponentRules(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	rules, err := h.projectComponentSrvc.GetByUser(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get project component rules", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, rules)
+}
+
+// @Summary Add a project component rule
+// @Description Attributes time spent on files of the project, whose path contains the given prefix, to a component (e.g. of a monorepo) with the given label. If multiple rules match a file, the one with the longest prefix wins. Component breakdowns are available at /summary/components.
+// @ID post-project-component-rule
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param rule body api.componentRuleRequest true "Project, path prefix and component label"
+// @Security ApiKeyAuth
+// @Success 201 {object} models.ProjectComponentRule
+// @Failure 400 {string} string "bad request"
+// @Router /projects/components [post]
+func (h *ProjectApiHandler) PostComponentRule(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	var req componentRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(conf.ErrBadRequest))
+		return
+	}
+
+	rule, err := h.projectComponentSrvc.Create(&models.ProjectComponentRule{
+		UserID:     user.ID,
+		Project:    req.Project,
+		PathPrefix: req.PathPrefix,
+		Label:      req.Label,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusCreated, rule)
+}
+
+// @Summary Delete a project component rule
+// @ID delete-project-component-rule
+// @Tags projects
+// @Param id path int true "Rule id"
+// @Security ApiKeyAuth
+// @Success 204
+// @Failure 404 {string} string "not found"
+// @Router /projects/components/{id} [delete]
+func (h *ProjectApiHandler) DeleteComponentRule(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	if err := h.projectComponentSrvc.Delete(user, uint(id)); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary List likely duplicate projects
+// @Description Suggests pairs of the user's projects, whose names likely refer to the same project (e.g. differing in case, separators or a branch-like suffix, or being very similar), most confident first. Projects already merged by an alias are omitted. Nothing is merged automatically, but suggestions can be confirmed by aliasing the duplicate to the project, e.g. via /aliases/rules.
+// @ID get-project-duplicates
+// @Tags projects
+// @Produce json
+// @Param threshold query number false "Minimum confidence between 0 and 1 (defaults to the server's duplicate_project_threshold)"
+// @Security ApiKeyAuth
+// @Success 200 {array} models.ProjectDuplicate
+// @Failure 400 {string} string "bad request"
+// @Router /projects/duplicates [get]
+func (h *ProjectApiHandler) GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	threshold := h.config.App.DuplicateProjectThreshold
+	if thresholdParam := r.URL.Query().Get("threshold"); thresholdParam != "" {
+		parsedThreshold, err := strconv.ParseFloat(thresholdParam, 64)
+		if err != nil || parsedThreshold < 0 || parsedThreshold > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("threshold must be between 0 and 1"))
+			return
+		}
+		threshold = parsedThreshold
+	}
+
+	duplicates, err := h.projectDuplicateSrvc.GetSuggestions(user, threshold)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get duplicate project suggestions", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, duplicates)
+}
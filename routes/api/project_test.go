@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProjectApiHandler_PostMetadata_KeepsOmittedFields(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01"}
+
+	projectMetadataServiceMock := new(mocks.ProjectMetadataServiceMock)
+	projectMetadataServiceMock.On("GetMapped", user.ID).Return(map[string]*models.ProjectMetadata{
+		"wakapi": {UserID: user.ID, Project: "wakapi", Color: "#00b4d8", Private: true, HourlyRate: 80, Currency: "EUR"},
+	}, nil)
+	projectMetadataServiceMock.On("Set", mock.Anything).Return(nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Post("/projects/metadata", NewProjectApiHandler(nil, nil, nil, projectMetadataServiceMock, nil, nil).PostMetadata)
+
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/projects/metadata", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post(`{"project": "wakapi", "color": "#ff0000"}`))
+	projectMetadataServiceMock.AssertCalled(t, "Set", &models.ProjectMetadata{UserID: user.ID, Project: "wakapi", Color: "#ff0000", Private: true, HourlyRate: 80, Currency: "EUR"})
+
+	assert.Equal(t, http.StatusOK, post(`{"project": "wakapi", "private": false, "hourly_rate": 0}`))
+	projectMetadataServiceMock.AssertCalled(t, "Set", &models.ProjectMetadata{UserID: user.ID, Project: "wakapi", Currency: "EUR"})
+
+	assert.Equal(t, http.StatusOK, post(`{"project": "other", "private": true}`))
+	projectMetadataServiceMock.AssertCalled(t, "Set", &models.ProjectMetadata{UserID: user.ID, Project: "other", Private: true})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+)
+
+// the underlying totals are only re-counted every few hours anyway (see MiscService), so there's no point in querying them more often
+const publicStatsRefreshInterval = 15 * time.Minute
+
+// deliberately only consists of instance-wide totals, never anything per user
+type publicStatsResponse struct {
+	TotalUsers      int64             `json:"total_users"`
+	TotalHours      int64             `json:"total_hours"`
+	TotalHeartbeats int64             `json:"total_heartbeats"` // approximate on some databases
+	UpdatedAt       models.CustomTime `json:"updated_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+}
+
+type PublicStatsHandler struct {
+	config        *conf.Config
+	keyValueSrvc  services.IKeyValueService
+	heartbeatSrvc services.IHeartbeatService
+	lock          sync.Mutex
+	stats         *publicStatsResponse
+}
+
+func NewPublicStatsHandler(keyValueService services.IKeyValueService, heartbeatService services.IHeartbeatService) *PublicStatsHandler {
+	return &PublicStatsHandler{
+		config:        conf.Get(),
+		keyValueSrvc:  keyValueService,
+		heartbeatSrvc: heartbeatService,
+	}
+}
+
+func (h *PublicStatsHandler) RegisterRoutes(router chi.Router) {
+	if !h.config.App.PublicStats {
+		return
+	}
+
+	slog.Info("exposing public instance statistics under /api/public/stats")
+	router.Get("/public/stats", h.Get)
+}
+
+// @Summary Retrieve public instance statistics
+// @Description Returns anonymous, instance-wide totals, e.g. for display on a landing page. Only available if enabled by the server operator. Numbers are refreshed periodically and may lag behind by a few hours.
+// @ID get-public-stats
+// @Tags misc
+// @Produce json
+// @Success 200 {object} api.publicStatsResponse
+// @Router /public/stats [get]
+func (h *PublicStatsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	helpers.RespondJSONCacheable(w, r, h.getStats(), true)
+}
+
+func (h *PublicStatsHandler) getStats() *publicStatsResponse {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.stats != nil && time.Since(h.stats.UpdatedAt.T()) < publicStatsRefreshInterval {
+		return h.stats
+	}
+
+	stats := &publicStatsResponse{UpdatedAt: models.CustomTime(time.Now())}
+
+	if kv, err := h.keyValueSrvc.GetString(conf.KeyLatestTotalTime); err == nil && kv != nil && kv.Value != "" {
+		if d, err := time.ParseDuration(kv.Value); err == nil {
+			stats.TotalHours = int64(d.Hours())
+		}
+	}
+
+	if kv, err := h.keyValueSrvc.GetString(conf.KeyLatestTotalUsers); err == nil && kv != nil && kv.Value != "" {
+		if n, err := strconv.ParseInt(kv.Value, 10, 64); err == nil {
+			stats.TotalUsers = n
+		}
+	}
+
+	if n, err := h.heartbeatSrvc.Count(true); err == nil {
+		stats.TotalHeartbeats = n
+	} else {
+		conf.Log().Error("failed to count heartbeats for public stats", "error", err)
+		if h.stats != nil {
+			stats.TotalHeartbeats = h.stats.TotalHeartbeats // rather show outdated than no numbers
+		}
+	}
+
+	h.stats = stats
+	return stats
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicStatsHandler_Get(t *testing.T) {
+	cfg := config.Empty()
+	config.Set(cfg)
+
+	keyValueServiceMock := new(mocks.KeyValueServiceMock)
+	keyValueServiceMock.On("GetString", config.KeyLatestTotalTime).Return(&models.KeyStringValue{Key: config.KeyLatestTotalTime, Value: "1234h30m0s"}, nil)
+	keyValueServiceMock.On("GetString", config.KeyLatestTotalUsers).Return(&models.KeyStringValue{Key: config.KeyLatestTotalUsers, Value: "42"}, nil)
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("Count", true).Return(100000, nil)
+
+	t.Run("when disabled", func(t *testing.T) {
+		router := chi.NewRouter()
+		NewPublicStatsHandler(keyValueServiceMock, heartbeatServiceMock).RegisterRoutes(router)
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/public/stats", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("when enabled", func(t *testing.T) {
+		cfg.App.PublicStats = true
+		defer func() { cfg.App.PublicStats = false }()
+
+		router := chi.NewRouter()
+		NewPublicStatsHandler(keyValueServiceMock, heartbeatServiceMock).RegisterRoutes(router)
+
+		for range 3 {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/public/stats", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Header().Get("Cache-Control"), "public")
+
+			var body map[string]interface{}
+			assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+			assert.Len(t, body, 4)
+			assert.EqualValues(t, 42, body["total_users"])
+			assert.EqualValues(t, 1234, body["total_hours"])
+			assert.EqualValues(t, 100000, body["total_heartbeats"])
+		}
+
+		// served from cache
+		heartbeatServiceMock.AssertNumberOfCalls(t, "Count", 1)
+	})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/services"
+)
+
+type RateLimitApiHandler struct {
+	config        *conf.Config
+	userSrvc      services.IUserService
+	rateLimitSrvc services.IRateLimitService
+}
+
+func NewRateLimitApiHandler(userService services.IUserService, rateLimitService services.IRateLimitService) *RateLimitApiHandler {
+	return &RateLimitApiHandler{
+		config:        conf.Get(),
+		userSrvc:      userService,
+		rateLimitSrvc: rateLimitService,
+	}
+}
+
+func (h *RateLimitApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/", h.Get)
+
+	router.Mount("/rate_limit", r)
+}
+
+// @Summary Retrieve the heartbeats rate limit status
+// @Description Tells how many heartbeat requests the authenticated user has left within the current rate limit window, intended for plugin authors to tune their heartbeat frequency. Querying the status does not count against the budget. The same numbers are sent as X-RateLimit-* headers with every heartbeat response.
+// @ID get-rate-limit
+// @Tags heartbeat
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.RateLimitStatus
+// @Router /rate_limit [get]
+func (h *RateLimitApiHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	status, err := h.rateLimitSrvc.GetStatus(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get rate limit status", "userID", user.ID, "error", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondJSON(w, r, http.StatusOK, status)
+}
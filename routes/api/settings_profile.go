@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+)
+
+// max. size of uploaded settings profiles
+const settingsProfileMaxBytes = 1 << 20
+
+type SettingsProfileApiHandler struct {
+	config              *conf.Config
+	userSrvc            services.IUserService
+	settingsProfileSrvc services.ISettingsProfileService
+}
+
+func NewSettingsProfileApiHandler(userService services.IUserService, settingsProfileService services.ISettingsProfileService) *SettingsProfileApiHandler {
+	return &SettingsProfileApiHandler{
+		config:              conf.Get(),
+		userSrvc:            userService,
+		settingsProfileSrvc: settingsProfileService,
+	}
+}
+
+func (h *SettingsProfileApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/", h.Get)
+	r.Post("/", h.Post)
+
+	router.Mount("/users/current/settings", r)
+}
+
+// @Summary Export the authenticated user's settings
+// @Description Returns the user's preferences, aliases, language mappings, project labels and default branches as a portable profile, which can be imported into another account, also on a different instance (see POST /users/current/settings). Credentials (password, api keys, 2fa), account details (name, e-mail) and any coding data are not included.
+// @ID get-settings-profile
+// @Tags user
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.SettingsProfile
+// @Router /users/current/settings [get]
+func (h *SettingsProfileApiHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	profile, err := h.settingsProfileSrvc.Export(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to export settings profile", "userID", user.ID, "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=\"wakapi_settings.json\"")
+	helpers.RespondJSON(w, r, http.StatusOK, profile)
+}
+
+// @Summary Import a settings profile
+// @Description Applies a profile previously exported from GET /users/current/settings to the authenticated user. In 'merge' mode (default), aliases, language mappings, project labels and default branches are added to the existing ones, overwriting those of the same name. In 'replace' mode, all other existing ones are removed. Preferences omitted from the profile are left unchanged. The profile is validated as a whole and rejected before anything is changed if any of its settings is invalid.
+// @ID post-settings-profile
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param profile body models.SettingsProfile true "Settings profile"
+// @Param mode query string false "Import mode" Enums(merge, replace)
+// @Security ApiKeyAuth
+// @Success 200 {object} models.SettingsImportResult
+// @Failure 400 {string} string "bad request"
+// @Router /users/current/settings [post]
+func (h *SettingsProfileApiHandler) Post(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = models.SettingsImportMerge
+	}
+	if mode != models.SettingsImportMerge && mode != models.SettingsImportReplace {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid mode"))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, settingsProfileMaxBytes)
+
+	// preferences missing from the profile keep their current value
+	profile := &models.SettingsProfile{Preferences: models.NewSettingsProfilePreferences(user)}
+	if err := json.NewDecoder(r.Body).Decode(profile); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(conf.ErrBadRequest))
+		return
+	}
+
+	result, err := h.settingsProfileSrvc.Import(user, profile, mode)
+	if errors.Is(err, services.ErrInvalidSettingsProfile) || errors.Is(err, services.ErrAliasLimitExceeded) || errors.Is(err, services.ErrAliasCycle) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to import settings profile", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, result)
+}
@@ -1,27 +1,85 @@
 package api
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/duke-git/lancet/v2/datetime"
 	"github.com/go-chi/chi/v5"
 	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/models"
 	routeutils "github.com/muety/wakapi/routes/utils"
+	"github.com/muety/wakapi/utils"
+	"io"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	conf "github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/middlewares"
 	"github.com/muety/wakapi/services"
 )
 
+const (
+	summaryDatesMaxCount     = 100 // maximum number of dates to be requested at once
+	summaryCumulativeMaxDays = 366 // maximum length of range to compute cumulative totals for
+	summaryRollupsMaxPeriods = 120 // maximum number of months or years to roll up at once
+)
+
+type dateTotalResponse struct {
+	Date  string `json:"date" example:"2006-01-02"`
+	Total int64  `json:"total"` // seconds
+}
+
+type dateCumulativeResponse struct {
+	Date       string `json:"date" example:"2006-01-02"`
+	Total      int64  `json:"total"`      // seconds
+	Cumulative int64  `json:"cumulative"` // seconds, including this day
+}
+
+type summaryRollupsResponse struct {
+	Granularity string                  `json:"granularity" example:"month"`
+	From        models.CustomTime       `json:"from" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	To          models.CustomTime       `json:"to" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	Rollups     []*models.SummaryRollup `json:"rollups"`
+}
+
+type projectComponentsResponse struct {
+	Project    string              `json:"project"`
+	From       models.CustomTime   `json:"from" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	To         models.CustomTime   `json:"to" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	Components models.SummaryItems `json:"components"`
+}
+
+type branchesAcrossProjectsResponse struct {
+	From     models.CustomTime              `json:"from" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	To       models.CustomTime              `json:"to" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	Projects []string                       `json:"projects"`
+	Branches []*models.BranchAcrossProjects `json:"branches"`
+}
+
 type SummaryApiHandler struct {
-	config      *conf.Config
-	userSrvc    services.IUserService
-	summarySrvc services.ISummaryService
+	config               *conf.Config
+	userSrvc             services.IUserService
+	summarySrvc          services.ISummaryService
+	heartbeatSrvc        services.IHeartbeatService
+	projectMetadataSrvc  services.IProjectMetadataService
+	projectComponentSrvc services.IProjectComponentService
+	keyValueSrvc         services.IKeyValueService
 }
 
-func NewSummaryApiHandler(userService services.IUserService, summaryService services.ISummaryService) *SummaryApiHandler {
+func NewSummaryApiHandler(userService services.IUserService, summaryService services.ISummaryService, heartbeatService services.IHeartbeatService, projectMetadataService services.IProjectMetadataService, projectComponentService services.IProjectComponentService, keyValueService services.IKeyValueService) *SummaryApiHandler {
 	return &SummaryApiHandler{
-		summarySrvc: summaryService,
-		userSrvc:    userService,
-		config:      conf.Get(),
+		summarySrvc:          summaryService,
+		userSrvc:             userService,
+		heartbeatSrvc:        heartbeatService,
+		projectMetadataSrvc:  projectMetadataService,
+		projectComponentSrvc: projectComponentService,
+		keyValueSrvc:         keyValueService,
+		config:               conf.Get(),
 	}
 }
 
@@ -29,17 +87,27 @@ func (h *SummaryApiHandler) RegisterRoutes(router chi.Router) {
 	r := chi.NewRouter()
 	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
 	r.Get("/", h.Get)
+	r.Get("/dates", h.GetDates)
+	r.Get("/cumulative", h.GetCumulative)
+	r.Get("/rollups", h.GetRollups)
+	r.Get("/components", h.GetComponents)
+	r.Get("/branches", h.GetBranchesAcrossProjects)
+	r.Get("/billing", h.GetBilling)
+	r.Delete("/cache", h.DeleteCache)
 
 	router.Mount("/summary", r)
 }
 
 // @Summary Retrieve a summary
+// @Description Supports conditional requests via `If-None-Match` and `If-Modified-Since` (or the equivalent `since` parameter), based on when the latest heartbeat within the requested range was received. Changes of e.g. aliases or labels alone are not considered. While recent heartbeats might not yet be reflected in a cached summary, no validators are sent. Responds with MessagePack of the same structure instead of JSON if requested via `Accept: application/msgpack`.
 // @ID get-summary
 // @Tags summary
 // @Produce json
-// @Param interval query string false "Interval identifier" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time)
-// @Param from query string false "Start date (e.g. '2021-02-07')"
-// @Param to query string false "End date (e.g. '2021-02-08')"
+// @Produce application/msgpack
+// @Param interval query string false "Interval identifier (today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time) or one of the user's custom time ranges (e.g. 'preset:sprint')"
+// @Param range query string false "Alias for interval"
+// @Param from query string false "Start date (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
 // @Param recompute query bool false "Whether to recompute the summary from raw heartbeat or use cache"
 // @Param project query string false "Project to filter by"
 // @Param language query string false "Language to filter by"
@@ -47,16 +115,603 @@ func (h *SummaryApiHandler) RegisterRoutes(router chi.Router) {
 // @Param operating_system query string false "OS to filter by"
 // @Param machine query string false "Machine to filter by"
 // @Param label query string false "Project label to filter by"
+// @Param dominant_branch query bool false "Whether to attribute every coding session entirely to the branch most time was spent on, instead of splitting exactly by branch (only relevant with a project filter)"
+// @Param write_only query bool false "Whether to only count heartbeats flagged as is_write (i.e. file saves), for an actual editing time view"
+// @Param fields query string false "Comma-separated list of fields to include, all if omitted (e.g. 'total,projects')"
+// @Param since query string false "Only return the summary if it changed after the given time (e.g. '2021-02-07T10:00:00Z'), alternative to 'If-Modified-Since'"
 // @Security ApiKeyAuth
 // @Success 200 {object} models.Summary
+// @Success 304
 // @Router /summary [get]
 func (h *SummaryApiHandler) Get(w http.ResponseWriter, r *http.Request) {
-	summary, err, status := routeutils.LoadUserSummary(h.summarySrvc, r)
+	params, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	fields, err := helpers.ParseSummaryFields(r)
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if fields != nil {
+		types := make([]uint8, 0, len(fields))
+		for name, t := range fields {
+			if name != helpers.SummaryFieldTotal {
+				types = append(types, t)
+			}
+		}
+		if len(types) == 0 {
+			types = append(types, models.SummaryProject) // total time is derived from any of the types
+		}
+		params.Filters.WithSelectFields(types...)
+	}
+
+	lastModified, conditional := h.lastModified(params)
+	if conditional {
+		etag := summaryETag(r, lastModified)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if !lastModified.IsZero() {
+			w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+
+		if utils.IsNotModified(r, etag) || utils.IsNotModifiedSince(r, lastModified) || isNotModifiedSinceParam(r, params.User, lastModified) {
+			w.Header().Set("Vary", "Accept")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	summary, err, status := routeutils.LoadUserSummaryByParams(h.summarySrvc, params)
+	if err != nil {
+		w.Header().Del("ETag")
+		w.Header().Del("Last-Modified")
 		w.WriteHeader(status)
 		w.Write([]byte(err.Error()))
 		return
 	}
 
-	helpers.RespondJSON(w, r, http.StatusOK, summary)
+	// total time is taken before bucketing, as hiding unknown languages or editors must not affect it
+	total := summary.TotalTime()
+	summary = summary.WithUnknownBucket(h.config.App.UnknownLabel, params.User.HidesUnknownBucket())
+
+	if _, ok := fields["projects"]; fields == nil || ok {
+		projects := make([]string, len(summary.Projects))
+		for i, item := range summary.Projects {
+			projects[i] = item.Key
+		}
+		// metadata is merely decorative, so failing to resolve it must not fail the entire request
+		if summary.ProjectMetadata, err = h.projectMetadataSrvc.Resolve(params.User.ID, projects); err != nil {
+			conf.Log().Request(r).Error("failed to resolve project metadata", "userID", params.User.ID, "error", err)
+		}
+	}
+
+	if fields != nil {
+		helpers.RespondNegotiated(w, r, http.StatusOK, partialSummary(summary, fields, total))
+		return
+	}
+
+	helpers.RespondNegotiated(w, r, http.StatusOK, summary)
+}
+
+// @Summary Retrieve total coding time for a list of dates
+// @Description Returns the total coding time for each of the given days in the user's timezone, including days without any activity. At most 100 dates may be requested at once.
+// @ID get-summary-dates
+// @Tags summary
+// @Produce json
+// @Param dates query string true "Comma-separated list of dates (e.g. '2021-02-06,2021-02-07')"
+// @Param project query string false "Project to filter by"
+// @Param language query string false "Language to filter by"
+// @Param editor query string false "Editor to filter by"
+// @Param operating_system query string false "OS to filter by"
+// @Param machine query string false "Machine to filter by"
+// @Param label query string false "Project label to filter by"
+// @Security ApiKeyAuth
+// @Success 200 {array} api.dateTotalResponse
+// @Failure 400 {string} string "bad request"
+// @Router /summary/dates [get]
+func (h *SummaryApiHandler) GetDates(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	dates, err := parseSummaryDates(r.URL.Query().Get("dates"), user.TZ())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	filters := helpers.ParseSummaryFilters(r).WithSelectFields(models.SummaryProject) // total time is derived from any of the types
+
+	result := make([]*dateTotalResponse, len(dates))
+	for i, date := range dates {
+		summary, err := h.summarySrvc.Aliased(date, date.AddDate(0, 0, 1), user, h.summarySrvc.Retrieve, filters, false)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(conf.ErrInternalServerError))
+			conf.Log().Request(r).Error("failed to load summary for date", "userID", user.ID, "date", date, "error", err)
+			return
+		}
+		result[i] = &dateTotalResponse{
+			Date:  helpers.FormatDate(date),
+			Total: int64(summary.TotalTime().Seconds()),
+		}
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, result)
+}
+
+// @Summary Retrieve cumulative coding time per day
+// @Description Returns the running total of coding time at the end of each day within the given range in the user's timezone, e.g. for trend charts. Days without any activity are included. The range may span at most 366 days.
+// @ID get-summary-cumulative
+// @Tags summary
+// @Produce json
+// @Param interval query string false "Interval identifier" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year)
+// @Param from query string false "Start date (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
+// @Param project query string false "Project to filter by"
+// @Param language query string false "Language to filter by"
+// @Param editor query string false "Editor to filter by"
+// @Param operating_system query string false "OS to filter by"
+// @Param machine query string false "Machine to filter by"
+// @Param label query string false "Project label to filter by"
+// @Security ApiKeyAuth
+// @Success 200 {array} api.dateCumulativeResponse
+// @Failure 400 {string} string "bad request"
+// @Router /summary/cumulative [get]
+func (h *SummaryApiHandler) GetCumulative(w http.ResponseWriter, r *http.Request) {
+	params, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if !params.To.After(params.From) || params.To.Sub(params.From) > summaryCumulativeMaxDays*24*time.Hour {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("range must not be empty and span at most %d days", summaryCumulativeMaxDays)))
+		return
+	}
+
+	filters := params.Filters.WithSelectFields(models.SummaryProject) // total time is derived from any of the types
+
+	cumulative, err := h.summarySrvc.Cumulative(params.From, params.To, params.User, filters)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to compute cumulative summary", "userID", params.User.ID, "error", err)
+		return
+	}
+
+	result := make([]*dateCumulativeResponse, len(cumulative.Days))
+	for i, day := range cumulative.Days {
+		result[i] = &dateCumulativeResponse{
+			Date:       helpers.FormatDate(day.Date),
+			Total:      int64(day.Total.Seconds()),
+			Cumulative: int64(day.Cumulative.Seconds()),
+		}
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, result)
+}
+
+// @Summary Retrieve monthly or yearly totals
+// @Description Rolls up coding time per calendar month or year (in the user's timezone), including breakdowns by project, language, editor, operating system, machine, label and category, e.g. for year-in-review pages. Every period is cached on its own. Periods at the edges of the range are cut off accordingly. For all-time ranges, the first period is the one of the user's first heartbeat. At most 120 periods may be requested at once.
+// @ID get-summary-rollups
+// @Tags summary
+// @Produce json
+// @Param granularity query string false "Length of periods, defaults to month" Enums(month, year)
+// @Param interval query string false "Interval identifier" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time)
+// @Param from query string false "Start date (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
+// @Param project query string false "Project to filter by"
+// @Param language query string false "Language to filter by"
+// @Param editor query string false "Editor to filter by"
+// @Param operating_system query string false "OS to filter by"
+// @Param machine query string false "Machine to filter by"
+// @Param label query string false "Project label to filter by"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.summaryRollupsResponse
+// @Failure 400 {string} string "bad request"
+// @Router /summary/rollups [get]
+func (h *SummaryApiHandler) GetRollups(w http.ResponseWriter, r *http.Request) {
+	params, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	granularity := r.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = models.RollupMonth
+	}
+	if !models.IsValidRollup(granularity) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("'granularity' parameter must be one of %s or %s", models.RollupMonth, models.RollupYear)))
+		return
+	}
+
+	tz := params.User.TZ()
+	from, to := params.From.In(tz), params.To.In(tz)
+	if params.From.IsZero() {
+		// all time, so start with the first day that may contain any data
+		first := routeutils.GetFirstHeartbeat(h.keyValueSrvc, params.User)
+		if first.IsZero() {
+			first = params.User.CreatedAt.T()
+		}
+		from = datetime.BeginOfDay(first.In(tz))
+	}
+
+	if !to.After(from) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("range must not be empty"))
+		return
+	}
+
+	periods := utils.SplitRangeByMonths(from, to)
+	if granularity == models.RollupYear {
+		periods = utils.SplitRangeByYears(from, to)
+	}
+	if len(periods) > summaryRollupsMaxPeriods {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("range must span at most %d periods", summaryRollupsMaxPeriods)))
+		return
+	}
+
+	rollups, err := h.summarySrvc.Rollup(from, to, params.User, params.Filters, granularity)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to compute summary rollups", "userID", params.User.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, &summaryRollupsResponse{
+		Granularity: granularity,
+		From:        models.CustomTime(from),
+		To:          models.CustomTime(to),
+		Rollups:     rollups,
+	})
+}
+
+// @Summary Flush cached summaries
+// @Description Drops the requesting user's cached summaries, so that they're recomputed on next request (e.g. after an import or data correction). Admins may flush all users' caches.
+// @ID delete-summary-cache
+// @Tags summary
+// @Produce json
+// @Param all query bool false "Whether to flush all users' caches (admins only)"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]int
+// @Failure 401 {string} string "unauthorized"
+// @Router /summary/cache [delete]
+func (h *SummaryApiHandler) DeleteCache(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	var flushed int
+	if r.URL.Query().Get("all") == "true" {
+		if !user.IsAdmin {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(conf.ErrUnauthorized))
+			return
+		}
+		flushed = h.summarySrvc.FlushAllCaches()
+		conf.Log().Request(r).Info("flushed all summary caches", "entries", flushed)
+	} else {
+		flushed = h.summarySrvc.FlushCache(user.ID)
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, map[string]int{"flushed": flushed})
+}
+
+// @Summary Retrieve a project's coding time by component
+// @Description Breaks down the time spent on a project by its components (e.g. of a monorepo), as derived from the paths of the files worked on according to the user's component rules (see /projects/components). Time spent on files matched by none of the rules is attributed to 'unknown'.
+// @ID get-summary-components
+// @Tags summary
+// @Produce json
+// @Param project query string true "Project to break down"
+// @Param interval query string false "Interval identifier" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time)
+// @Param from query string false "Start date (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
+// @Param language query string false "Language to filter by"
+// @Param editor query string false "Editor to filter by"
+// @Param operating_system query string false "OS to filter by"
+// @Param machine query string false "Machine to filter by"
+// @Param branch query string false "Branch to filter by"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.projectComponentsResponse
+// @Failure 400 {string} string "bad request"
+// @Router /summary/components [get]
+func (h *SummaryApiHandler) GetComponents(w http.ResponseWriter, r *http.Request) {
+	params, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing 'project' parameter"))
+		return
+	}
+
+	rules, err := h.projectComponentSrvc.GetByUserAndProject(params.User.ID, project)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get project component rules", "userID", params.User.ID, "error", err)
+		return
+	}
+
+	components, err := h.summarySrvc.SummarizeComponents(params.From, params.To, params.User, params.Filters, rules)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to summarize project components", "userID", params.User.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, &projectComponentsResponse{
+		Project:    project,
+		From:       models.CustomTime(params.From),
+		To:         models.CustomTime(params.To),
+		Components: components,
+	})
+}
+
+// @Summary Retrieve combined coding time per branch across multiple projects
+// @Description Groups the time spent on the given projects by branch name only, so that equally named branches of different projects add up, e.g. for features spanning multiple repositories. Unlike the branch breakdown of a single project's summary, this has to be requested explicitly, as branch names (like 'main') commonly collide. Unknown branches are left out.
+// @ID get-summary-branches
+// @Tags summary
+// @Produce json
+// @Param projects query string true "Comma-separated list of at least two projects"
+// @Param interval query string false "Interval identifier" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time)
+// @Param from query string false "Start date (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
+// @Param branch query string false "Branch to filter by"
+// @Param language query string false "Language to filter by"
+// @Param editor query string false "Editor to filter by"
+// @Param operating_system query string false "OS to filter by"
+// @Param machine query string false "Machine to filter by"
+// @Param dominant_branch query bool false "Whether to attribute every coding session entirely to the branch most time was spent on, instead of splitting exactly by branch"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.branchesAcrossProjectsResponse
+// @Failure 400 {string} string "bad request"
+// @Router /summary/branches [get]
+func (h *SummaryApiHandler) GetBranchesAcrossProjects(w http.ResponseWriter, r *http.Request) {
+	params, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	projects := make([]string, 0)
+	for _, p := range strings.Split(r.URL.Query().Get("projects"), ",") {
+		if p = strings.TrimSpace(p); p != "" && !slices.Contains(projects, p) {
+			projects = append(projects, p)
+		}
+	}
+	if len(projects) < 2 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("'projects' parameter must list at least two projects"))
+		return
+	}
+
+	branches, err := h.summarySrvc.SummarizeBranchesAcrossProjects(params.From, params.To, params.User, params.Filters, projects)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to summarize branches across projects", "userID", params.User.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, &branchesAcrossProjectsResponse{
+		From:     models.CustomTime(params.From),
+		To:       models.CustomTime(params.To),
+		Projects: projects,
+		Branches: branches,
+	})
+}
+
+// @Summary Retrieve billable amounts per project
+// @Description Multiplies the time spent on every project by its hourly rate, as set via the project's metadata, and sums up the amounts per currency. Projects without an hourly rate are excluded and listed separately (in CSV as rows without hours and amount). Amounts are rounded to the currency's minor unit. Responds with CSV instead of JSON if requested via `format=csv`, e.g. for pasting into invoicing tools.
+// @ID get-summary-billing
+// @Tags summary
+// @Produce json
+// @Produce text/csv
+// @Param interval query string false "Interval identifier" Enums(today, yesterday, week, month, year, 7_days, last_7_days, 30_days, last_30_days, 6_months, last_6_months, 12_months, last_12_months, last_year, any, all_time)
+// @Param from query string false "Start date (e.g. '2021-02-07') or relative to now (e.g. '-30d', units: m, h, d, w)"
+// @Param to query string false "End date (e.g. '2021-02-08') or relative to now (e.g. 'now', '-1h')"
+// @Param project query string false "Project to filter by"
+// @Param label query string false "Project label to filter by"
+// @Param format query string false "Response format" Enums(json, csv)
+// @Security ApiKeyAuth
+// @Success 200 {object} models.BillingReport
+// @Failure 400 {string} string "bad request"
+// @Router /summary/billing [get]
+func (h *SummaryApiHandler) GetBilling(w http.ResponseWriter, r *http.Request) {
+	params, err := helpers.ParseSummaryParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("'format' parameter must be one of json or csv"))
+		return
+	}
+
+	params.Filters.WithSelectFields(models.SummaryProject)
+	summary, err, status := routeutils.LoadUserSummaryByParams(h.summarySrvc, params)
+	if err != nil {
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	projects := make([]string, len(summary.Projects))
+	for i, item := range summary.Projects {
+		projects[i] = item.Key
+	}
+	metadata, err := h.projectMetadataSrvc.Resolve(params.User.ID, projects)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to resolve project metadata", "userID", params.User.ID, "error", err)
+		return
+	}
+
+	report := models.NewBillingReport(summary, metadata)
+
+	if format != "csv" {
+		helpers.RespondJSON(w, r, http.StatusOK, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"wakapi_billing_%s_%s.csv\"", params.From.Format(conf.SimpleDateFormat), params.To.Format(conf.SimpleDateFormat)))
+	w.WriteHeader(http.StatusOK)
+	if err := writeBillingCsv(report, w); err != nil {
+		conf.Log().Request(r).Error("failed to write billing report", "userID", params.User.ID, "error", err)
+	}
+}
+
+// writeBillingCsv writes one line per billed project, followed by the grand total of every currency and, as comments, the unbilled projects
+func writeBillingCsv(report *models.BillingReport, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"project", "hours", "hourly_rate", "currency", "amount"}); err != nil {
+		return err
+	}
+	for _, item := range report.Items {
+		if err := writer.Write([]string{
+			utils.EscapeCsvFormula(item.Project),
+			strconv.FormatFloat(item.Hours, 'f', 2, 64),
+			strconv.FormatFloat(item.HourlyRate, 'f', -1, 64),
+			utils.EscapeCsvFormula(item.Currency),
+			strconv.FormatFloat(item.Amount, 'f', models.CurrencyDecimals(item.Currency), 64),
+		}); err != nil {
+			return err
+		}
+	}
+	// projects without an hourly rate, listed without hours, rate and amount
+	for _, project := range report.Unbilled {
+		if err := writer.Write([]string{utils.EscapeCsvFormula(project), "", "", "", ""}); err != nil {
+			return err
+		}
+	}
+	for _, total := range report.Totals {
+		if err := writer.Write([]string{
+			"Total",
+			strconv.FormatFloat(total.Hours, 'f', 2, 64),
+			"",
+			utils.EscapeCsvFormula(total.Currency),
+			strconv.FormatFloat(total.Amount, 'f', models.CurrencyDecimals(total.Currency), 64),
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func partialSummary(summary *models.Summary, fields map[string]uint8, total time.Duration) map[string]interface{} {
+	result := map[string]interface{}{
+		"user_id": summary.UserID,
+		"from":    summary.FromTime,
+		"to":      summary.ToTime,
+	}
+	for name, t := range fields {
+		if name == helpers.SummaryFieldTotal {
+			result[name] = int64(total.Seconds())
+			continue
+		}
+		if items := summary.GetByType(t); *items != nil {
+			result[name] = items
+		} else {
+			result[name] = models.SummaryItems{}
+		}
+	}
+	if len(summary.ProjectMetadata) > 0 {
+		result["project_metadata"] = summary.ProjectMetadata
+	}
+	return result
+}
+
+// parseSummaryDates parses a comma-separated list of dates to the beginnings of the respective days in the given zone, sorted and without duplicates
+func parseSummaryDates(raw string, tz *time.Location) ([]time.Time, error) {
+	seen := make(map[string]bool)
+	dates := make([]time.Time, 0)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" || seen[part] {
+			continue
+		}
+		date, err := time.ParseInLocation(conf.SimpleDateFormat, part, tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date '%s'", part)
+		}
+		seen[part] = true
+		dates = append(dates, date)
+	}
+
+	if len(dates) == 0 {
+		return nil, errors.New("missing 'dates' parameter")
+	}
+	if len(dates) > summaryDatesMaxCount {
+		return nil, fmt.Errorf("must not request more than %d dates at once", summaryDatesMaxCount)
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+	return dates, nil
+}
+
+// lastModified returns the time at which the latest heartbeat within the summary's range was received and whether conditional requests may be answered based on it.
+// Summaries are cached for a while, so heartbeats received more recently than that might not be reflected by the summary yet, unless it is recomputed.
+func (h *SummaryApiHandler) lastModified(params *models.SummaryParams) (time.Time, bool) {
+	heartbeat, err := h.heartbeatSrvc.GetLatestReceivedWithin(params.From, params.To, params.User)
+	if err != nil {
+		conf.Log().Error("failed to get latest received heartbeat", "userID", params.User.ID, "error", err)
+		return time.Time{}, false
+	}
+	if heartbeat == nil {
+		return time.Time{}, true
+	}
+
+	lastModified := heartbeat.CreatedAt.T()
+	if !params.Recompute && time.Since(lastModified) < h.config.App.SummaryCacheTTL() {
+		return lastModified, false
+	}
+	return lastModified, true
+}
+
+// summaryETag derives an entity tag from the last modification and all request parameters, which affect the summary
+func summaryETag(r *http.Request, lastModified time.Time) string {
+	query := r.URL.Query()
+	query.Del("since")
+	// json and msgpack are different representations of the same summary
+	return utils.WeakETag([]byte(fmt.Sprintf("%s?%s@%d:%v", middlewares.GetPrincipal(r).ID, query.Encode(), lastModified.UnixNano(), utils.AcceptsMsgpack(r))))
+}
+
+func isNotModifiedSinceParam(r *http.Request, user *models.User, lastModified time.Time) bool {
+	sinceParam := r.URL.Query().Get("since")
+	if sinceParam == "" || lastModified.IsZero() {
+		return false
+	}
+	since, err := helpers.ParseDateTimeTZ(sinceParam, user.TZ())
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
 }
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_parseSummaryDates(t *testing.T) {
+	tz, _ := time.LoadLocation("Europe/Berlin")
+
+	dates, err := parseSummaryDates("2024-03-10, 2024-03-02,2024-03-10,", tz)
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 3, 2, 0, 0, 0, 0, tz),
+		time.Date(2024, 3, 10, 0, 0, 0, 0, tz),
+	}, dates)
+
+	_, err = parseSummaryDates("", tz)
+	assert.Error(t, err)
+
+	_, err = parseSummaryDates("2024-03-10,foo", tz)
+	assert.Error(t, err)
+
+	tooMany := make([]string, summaryDatesMaxCount+1)
+	for i := range tooMany {
+		tooMany[i] = time.Date(2024, 1, 1, 0, 0, 0, 0, tz).AddDate(0, 0, i).Format("2006-01-02")
+	}
+	_, err = parseSummaryDates(strings.Join(tooMany, ","), tz)
+	assert.Error(t, err)
+}
+
+func TestSummaryHandler_Get_Conditional(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.SummaryCacheTTLMin = 30
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01"}
+	received := time.Now().Add(-1 * time.Hour).Truncate(time.Second)
+	recentlyReceived := time.Now().Add(-1 * time.Minute)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Aliased", mock.Anything, mock.Anything, user, mock.Anything, mock.Anything).Return(&models.Summary{}, nil)
+
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("GetLatestReceivedWithin", mock.Anything, mock.Anything, user).Return(&models.Heartbeat{CreatedAt: models.CustomTime(received)}, nil).Once()
+	heartbeatServiceMock.On("GetLatestReceivedWithin", mock.Anything, mock.Anything, user).Return(&models.Heartbeat{CreatedAt: models.CustomTime(recentlyReceived)}, nil)
+
+	projectMetadataServiceMock := new(mocks.ProjectMetadataServiceMock)
+	projectMetadataServiceMock.On("Resolve", user.ID, mock.Anything).Return(map[string]*models.ProjectMetadata{}, nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/summary", NewSummaryApiHandler(new(mocks.UserServiceMock), summaryServiceMock, heartbeatServiceMock, projectMetadataServiceMock, nil, nil).Get)
+
+	// not modified since latest heartbeat was received a while ago
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/summary?interval=today", nil)
+	req.Header.Set("If-Modified-Since", received.UTC().Format(http.TimeFormat))
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, received.UTC().Format(http.TimeFormat), rec.Header().Get("Last-Modified"))
+	assert.NotEmpty(t, rec.Header().Get("ETag"))
+	summaryServiceMock.AssertNotCalled(t, "Aliased", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// latest heartbeat might not be reflected by cached summary yet
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/summary?interval=today", nil)
+	req.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Last-Modified"))
+	assert.Empty(t, rec.Header().Get("ETag"))
+}
+
+func TestSummaryHandler_Get_Msgpack(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01"}
+	summary := &models.Summary{
+		UserID:    user.ID,
+		FromTime:  models.CustomTime(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)),
+		ToTime:    models.CustomTime(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)),
+		Projects:  models.SummaryItems{{Key: "wakapi", Total: 90 * time.Minute}, {Key: "anchr", Total: 5 * time.Second}},
+		Languages: models.SummaryItems{{Key: "Go", Total: 90*time.Minute + 5*time.Second}},
+		Editors:   models.SummaryItems{{Key: "VSCode", Total: 90*time.Minute + 5*time.Second}},
+		Branches:  models.SummaryItems{},
+	}
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Aliased", mock.Anything, mock.Anything, user, mock.Anything, mock.Anything).Return(summary, nil)
+
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("GetLatestReceivedWithin", mock.Anything, mock.Anything, user).Return((*models.Heartbeat)(nil), nil)
+
+	projectMetadataServiceMock := new(mocks.ProjectMetadataServiceMock)
+	projectMetadataServiceMock.On("Resolve", user.ID, mock.Anything).Return(map[string]*models.ProjectMetadata{"wakapi": {Project: "wakapi", Color: "#00add8"}}, nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/summary", NewSummaryApiHandler(new(mocks.UserServiceMock), summaryServiceMock, heartbeatServiceMock, projectMetadataServiceMock, nil, nil).Get)
+
+	for _, url := range []string{"/summary?interval=today", "/summary?interval=today&fields=total,projects"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		jsonBody, jsonETag := rec.Body.Bytes(), rec.Header().Get("ETag")
+
+		rec = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Accept", "application/msgpack")
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/msgpack", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+		assert.NotEqual(t, jsonETag, rec.Header().Get("ETag"))
+		assert.Less(t, rec.Body.Len(), len(jsonBody))
+
+		var fromJson map[string]interface{}
+		assert.Nil(t, json.Unmarshal(jsonBody, &fromJson))
+		assert.NotEmpty(t, fromJson["projects"])
+		expected, err := utils.MarshalMsgpack(fromJson)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, rec.Body.Bytes())
+	}
+}
+
+func TestSummaryHandler_GetBranchesAcrossProjects(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01"}
+	branches := []*models.BranchAcrossProjects{
+		{Branch: "feature/login", Total: 240, Projects: models.SummaryItems{{Key: "backend", Total: 120}, {Key: "frontend", Total: 120}}},
+	}
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("SummarizeBranchesAcrossProjects", mock.Anything, mock.Anything, user, mock.Anything, []string{"backend", "frontend"}).Return(branches, nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/summary/branches", NewSummaryApiHandler(new(mocks.UserServiceMock), summaryServiceMock, nil, nil, nil, nil).GetBranchesAcrossProjects)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/summary/branches?interval=week&projects=backend,%20frontend,backend", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"projects":["backend","frontend"]`)
+	assert.Contains(t, rec.Body.String(), `"branch":"feature/login","total":240`)
+
+	// explicitly requires multiple projects
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/summary/branches?interval=week&projects=backend", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	summaryServiceMock.AssertNumberOfCalls(t, "SummarizeBranchesAcrossProjects", 1)
+}
+
+func TestSummaryHandler_GetRollups(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01", Location: "Europe/Berlin"}
+	tz := user.TZ()
+	first := time.Date(2022, 3, 4, 15, 30, 0, 0, tz)
+
+	keyValueServiceMock := new(mocks.KeyValueServiceMock)
+	keyValueServiceMock.On("MustGetString", "first_heartbeat_testuser01").Return(&models.KeyStringValue{Value: first.Format(time.RFC822Z)})
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Rollup", time.Date(2022, 3, 4, 0, 0, 0, 0, tz), mock.Anything, user, mock.Anything, models.RollupYear).Return([]*models.SummaryRollup{
+		{Period: "2022", Total: 3600},
+		{Period: "2023", Total: 7200},
+	}, nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/summary/rollups", NewSummaryApiHandler(new(mocks.UserServiceMock), summaryServiceMock, nil, nil, nil, keyValueServiceMock).GetRollups)
+
+	t.Run("when requesting all time per year", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/summary/rollups?interval=all_time&granularity=year", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"granularity":"year"`)
+		assert.Contains(t, rec.Body.String(), `"period":"2023"`)
+	})
+
+	t.Run("when requesting invalid granularity", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/summary/rollups?interval=year&granularity=week", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("when requesting too many periods", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/summary/rollups?from=2000-01-01&to=2020-01-01", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	summaryServiceMock.AssertNumberOfCalls(t, "Rollup", 1)
+}
+
+func Test_writeBillingCsv(t *testing.T) {
+	report := &models.BillingReport{
+		Items: []*models.BillingReportItem{
+			{Project: "wakapi", Hours: 1.5, HourlyRate: 80, Currency: "EUR", Amount: 120},
+			{Project: "=HYPERLINK(\"http://evil.example\")", Hours: 0.25, HourlyRate: 100, Currency: "EUR", Amount: 25},
+		},
+		Totals:   []*models.BillingTotal{{Currency: "EUR", Hours: 1.75, Amount: 145}},
+		Unbilled: []string{"-hobby", "anchr"},
+		Note:     models.BillingReportUnbilledNote,
+	}
+
+	var sb strings.Builder
+	assert.Nil(t, writeBillingCsv(report, &sb))
+	assert.Equal(t, `project,hours,hourly_rate,currency,amount
+wakapi,1.50,80,EUR,120.00
+"'=HYPERLINK(""http://evil.example"")",0.25,100,EUR,25.00
+'-hobby,,,,
+anchr,,,,
+Total,1.75,,EUR,145.00
+`, sb.String())
+}
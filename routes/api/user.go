@@ -0,0 +1,470 @@
+package api
+
+import (
+	"errors"
+	"github.com/duke-git/lancet/v2/slice"
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/models"
+	routeutils "github.com/muety/wakapi/routes/utils"
+	"github.com/muety/wakapi/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/services"
+)
+
+const (
+	adminUsersDefaultPageSize = 50
+	adminUsersMaxPageSize     = 500
+)
+
+type adminUserItem struct {
+	ID              string             `json:"id"`
+	Email           string             `json:"email"`
+	IsAdmin         bool               `json:"is_admin"`
+	OrgID           *string            `json:"org_id"`
+	OrgAdmin        bool               `json:"org_admin"`
+	HasData         bool               `json:"has_data"`
+	HasSubscription bool               `json:"has_subscription"`
+	SubscribedUntil *models.CustomTime `json:"subscribed_until" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	TrialEnd        *models.CustomTime `json:"trial_end" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	CreatedAt       models.CustomTime  `json:"created_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	LastLoggedInAt  models.CustomTime  `json:"last_logged_in_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	LastActiveAt    *models.CustomTime `json:"last_active_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+	Plugin          string             `json:"plugin" example:"vscode-wakatime"` // most recently used editor plugin
+	PluginVersion   string             `json:"plugin_version" example:"24.8.0"`
+	PluginOutdated  bool               `json:"plugin_outdated"` // older than the configured minimum version
+}
+
+type adminUsersResponse struct {
+	Data     []*adminUserItem `json:"data"`
+	Total    int64            `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+}
+
+type currentUserResponse struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"` // same as the username, as there are no separate display names
+	TimeZone    string `json:"timezone" example:"Europe/Berlin"`
+}
+
+type apiKeyResponse struct {
+	ApiKey string `json:"api_key"`
+}
+
+type UserApiHandler struct {
+	config   *conf.Config
+	userSrvc services.IUserService
+}
+
+func NewUserApiHandler(userService services.IUserService) *UserApiHandler {
+	return &UserApiHandler{
+		userSrvc: userService,
+		config:   conf.Get(),
+	}
+}
+
+func (h *UserApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/current", h.GetCurrent)
+	r.Get("/current/sessions", h.GetSessions)
+	r.Delete("/current/sessions", h.DeleteSessions)
+	r.Delete("/current/sessions/{id}", h.DeleteSession)
+	r.Post("/{user}/restore", h.PostRestore)
+	r.Post("/{user}/api_key/rotate", h.PostRotateApiKey)
+	r.Post("/{user}/impersonation", h.PostImpersonation)
+
+	router.Mount("/users", r)
+
+	adminRouter := chi.NewRouter()
+	adminRouter.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	adminRouter.Get("/", h.GetAdminUsers)
+
+	router.Mount("/admin/users", adminRouter)
+}
+
+// @Summary Retrieve the authenticated user's basic profile
+// @Description Intended as a connection test for plugin setups, as it confirms the api key and url to be working without touching any coding activity. Responds with 401 if the api key is invalid.
+// @ID get-current-user
+// @Tags user
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} api.currentUserResponse
+// @Failure 401 {string} string "unauthorized"
+// @Router /users/current [get]
+func (h *UserApiHandler) GetCurrent(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	tz := user.TZ().String()
+	if tz == "Local" {
+		tz, _ = time.Now().Zone()
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, &currentUserResponse{
+		Username:    user.ID,
+		DisplayName: user.ID,
+		TimeZone:    tz,
+	})
+}
+
+// @Summary List the authenticated user's login sessions
+// @Description Lists the browser login sessions of the user, most recently active first, to see where they're logged in. Sessions issued before they were persisted are not included. Access by api key doesn't involve sessions.
+// @ID get-current-user-sessions
+// @Tags user
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.UserSession
+// @Failure 401 {string} string "unauthorized"
+// @Router /users/current/sessions [get]
+func (h *UserApiHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	sessions, err := h.userSrvc.GetSessions(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get sessions", "userID", user.ID, "error", err)
+		return
+	}
+
+	currentId := h.currentSessionId(r)
+	for _, s := range sessions {
+		s.Current = s.ID == currentId
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, sessions)
+}
+
+// @Summary Revoke all other login sessions
+// @Description Logs the user out everywhere except for the current session, which is kept if the request was made with one. Takes effect immediately.
+// @ID delete-current-user-sessions
+// @Tags user
+// @Security ApiKeyAuth
+// @Success 204
+// @Failure 401 {string} string "unauthorized"
+// @Router /users/current/sessions [delete]
+func (h *UserApiHandler) DeleteSessions(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	if err := h.userSrvc.RevokeSessions(user, h.currentSessionId(r)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to revoke sessions", "userID", user.ID, "error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Revoke a login session
+// @Description Logs the user out of the given session, which takes effect immediately. The current session may be revoked as well.
+// @ID delete-current-user-session
+// @Tags user
+// @Param id path string true "Session ID"
+// @Security ApiKeyAuth
+// @Success 204
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "not found"
+// @Router /users/current/sessions/{id} [delete]
+func (h *UserApiHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	if err := h.userSrvc.RevokeSession(user, chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(conf.ErrNotFound))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to revoke session", "userID", user.ID, "error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentSessionId returns the id of the login session the request was made with, empty if authenticated otherwise
+func (h *UserApiHandler) currentSessionId(r *http.Request) string {
+	if session, err := helpers.ExtractCookieAuth(r, h.config); err == nil {
+		return session.ID
+	}
+	return ""
+}
+
+// @Summary List users
+// @Description Lists all users of the instance, paginated and optionally filtered by activity, subscription status and signup date. Restricted to admins. In multi-tenant mode, org admins may list their org's members only.
+// @ID get-admin-users
+// @Tags admin
+// @Produce json
+// @Param active_days query int false "Only include users with heartbeats within the last given number of days"
+// @Param has_subscription query bool false "Only include users with (true) or without (false) an active subscription"
+// @Param created_after query string false "Only include users who signed up after the given date (e.g. '2021-02-07')"
+// @Param created_before query string false "Only include users who signed up before the given date (e.g. '2021-02-08')"
+// @Param org query string false "Only include members of the given org (implied for org admins)"
+// @Param sort query string false "Column to sort by" Enums(id, created_at, last_logged_in_at, last_active_at, subscribed_until)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Number of users per page"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.adminUsersResponse
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Router /admin/users [get]
+func (h *UserApiHandler) GetAdminUsers(w http.ResponseWriter, r *http.Request) {
+	principal := middlewares.GetPrincipal(r)
+	isOrgAdmin := principal != nil && h.config.App.OrgsEnabled && principal.OrgAdmin && principal.OrgID != nil
+	if principal == nil || (!principal.IsAdmin && !isOrgAdmin) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	query, err := parseUserQuery(r, principal.TZ())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if !principal.IsAdmin {
+		// org admins must never see anyone outside their org
+		query.OrgID = principal.OrgID
+	}
+
+	pageParams := utils.ParsePageParamsWithDefault(r, 1, adminUsersDefaultPageSize)
+	if pageParams.Page < 1 || pageParams.PageSize < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid 'page' or 'page_size' parameter"))
+		return
+	}
+	pageParams.PageSize = min(pageParams.PageSize, adminUsersMaxPageSize)
+
+	users, total, err := h.userSrvc.Query(query, pageParams)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to query users", "error", err)
+		return
+	}
+
+	// deliberately picking fields, as to never leak password hashes or api keys
+	minPluginVersions := h.config.App.GetMinPluginVersions()
+	items := make([]*adminUserItem, len(users))
+	for i, u := range users {
+		items[i] = &adminUserItem{
+			ID:              u.ID,
+			Email:           u.Email,
+			IsAdmin:         u.IsAdmin,
+			OrgID:           u.OrgID,
+			OrgAdmin:        u.OrgAdmin,
+			HasData:         u.HasData,
+			HasSubscription: u.HasActiveSubscriptionStrict(),
+			SubscribedUntil: u.SubscribedUntil,
+			TrialEnd:        u.SubscriptionTrialEnd,
+			CreatedAt:       u.CreatedAt,
+			LastLoggedInAt:  u.LastLoggedInAt,
+			LastActiveAt:    u.LastActiveAt,
+			Plugin:          u.LastPlugin,
+			PluginVersion:   u.LastPluginVersion,
+			PluginOutdated:  u.HasOutdatedPlugin(minPluginVersions),
+		}
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, &adminUsersResponse{
+		Data:     items,
+		Total:    total,
+		Page:     pageParams.Page,
+		PageSize: pageParams.PageSize,
+	})
+}
+
+func parseUserQuery(r *http.Request, tz *time.Location) (*models.UserQuery, error) {
+	params := r.URL.Query()
+	query := &models.UserQuery{}
+
+	if q := params.Get("active_days"); q != "" {
+		days, err := strconv.Atoi(q)
+		if err != nil || days < 0 {
+			return nil, errors.New("invalid 'active_days' parameter")
+		}
+		activeAfter := time.Now().AddDate(0, 0, -days)
+		query.ActiveAfter = &activeAfter
+	}
+	if q := params.Get("has_subscription"); q != "" {
+		hasSubscription, err := strconv.ParseBool(q)
+		if err != nil {
+			return nil, errors.New("invalid 'has_subscription' parameter")
+		}
+		query.HasSubscription = &hasSubscription
+	}
+	if q := params.Get("created_after"); q != "" {
+		createdAfter, err := helpers.ParseDateTimeTZ(q, tz)
+		if err != nil {
+			return nil, errors.New("invalid 'created_after' parameter")
+		}
+		query.CreatedAfter = &createdAfter
+	}
+	if q := params.Get("created_before"); q != "" {
+		createdBefore, err := helpers.ParseDateTimeTZ(q, tz)
+		if err != nil {
+			return nil, errors.New("invalid 'created_before' parameter")
+		}
+		query.CreatedBefore = &createdBefore
+	}
+	if q := params.Get("org"); q != "" {
+		query.OrgID = &q
+	}
+	if q := params.Get("sort"); q != "" {
+		if !slice.Contain(models.UserQuerySortFields, q) {
+			return nil, errors.New("invalid 'sort' parameter")
+		}
+		query.SortBy = q
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.SortDesc = true
+	default:
+		return nil, errors.New("invalid 'order' parameter")
+	}
+
+	return query, nil
+}
+
+// @Summary Restore a user account pending deletion
+// @Description Cancels the deletion of an account within its grace period. As soft-deleted users cannot authenticate, this is effectively limited to admins. Users can restore their own account by logging in again and confirming the restore.
+// @ID post-user-restore
+// @Tags user
+// @Param user path string true "Username"
+// @Security ApiKeyAuth
+// @Success 200
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "user not found"
+// @Router /users/{user}/restore [post]
+func (h *UserApiHandler) PostRestore(w http.ResponseWriter, r *http.Request) {
+	user, err := routeutils.CheckEffectiveUser(w, r, h.userSrvc, "")
+	if err != nil {
+		return // response was already sent by util function
+	}
+
+	if !user.IsSoftDeleted() {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("user is not pending deletion"))
+		return
+	}
+
+	if _, err := h.userSrvc.Restore(user); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to restore user", "userID", user.ID, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, struct{}{})
+}
+
+// @Summary Rotate a user's api key
+// @Description Generates a new api key for the user, which is only returned once in the response. The previous key stops working immediately.
+// @ID post-user-api-key-rotate
+// @Tags user
+// @Produce json
+// @Param user path string true "Username (or current)"
+// @Security ApiKeyAuth
+// @Success 200 {object} api.apiKeyResponse
+// @Failure 401 {string} string "unauthorized"
+// @Router /users/{user}/api_key/rotate [post]
+func (h *UserApiHandler) PostRotateApiKey(w http.ResponseWriter, r *http.Request) {
+	user, err := routeutils.CheckEffectiveUser(w, r, h.userSrvc, "current")
+	if err != nil {
+		return // response was already sent by util function
+	}
+
+	if _, err := h.userSrvc.ResetApiKey(user); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to rotate api key", "userID", user.ID, "error", err)
+		return
+	}
+
+	if principal := middlewares.GetPrincipal(r); principal.ID != user.ID {
+		conf.Log().Request(r).Info("admin rotated api key of other user", "adminID", principal.ID, "userID", user.ID)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondJSON(w, r, http.StatusOK, &apiKeyResponse{ApiKey: user.ApiKey})
+}
+
+// @Summary Start impersonating a user
+// @Description Lets an admin browse wakapi as the given user, e.g. to reproduce their view of their stats for support purposes. Meant to be called from within the admin's browser session, as impersonation is tracked by a cookie. Impersonation is read-only, excludes the user's settings and billing and ends automatically after 30 minutes, or when posting to `/impersonation/end`. Every impersonated request is logged. Restricted to admins, other admins cannot be impersonated.
+// @ID post-user-impersonation
+// @Tags admin
+// @Produce json
+// @Param user path string true "Username"
+// @Security ApiKeyAuth
+// @Success 200 {object} models.Impersonation
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Failure 404 {string} string "user not found"
+// @Router /users/{user}/impersonation [post]
+func (h *UserApiHandler) PostImpersonation(w http.ResponseWriter, r *http.Request) {
+	principal := middlewares.GetPrincipal(r)
+	if principal == nil || !principal.IsAdmin {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	user, err := h.userSrvc.GetUserById(chi.URLParam(r, "user"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("user not found"))
+		return
+	}
+	if user.IsAdmin || user.IsSoftDeleted() {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("admins and accounts pending deletion cannot be impersonated"))
+		return
+	}
+
+	impersonation := models.NewImpersonation(principal, user)
+	encoded, err := h.config.Security.SecureCookie.Encode(models.ImpersonationCookieKey, impersonation)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to encode impersonation", "adminID", principal.ID, "userID", user.ID, "error", err)
+		return
+	}
+
+	cookie := h.config.CreateCookie(models.ImpersonationCookieKey, encoded)
+	cookie.MaxAge = int(models.ImpersonationMaxDuration.Seconds())
+	http.SetCookie(w, cookie)
+
+	conf.Log().Request(r).Info("admin started impersonating user", "adminID", principal.ID, "userID", user.ID, "expiresAt", impersonation.ExpiresAt)
+	helpers.RespondJSON(w, r, http.StatusOK, impersonation)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	mm "github.com/muety/wakapi/models/metrics"
+	"github.com/muety/wakapi/services"
+)
+
+const (
+	// number of projects and languages to report individually, all others are summed up as userMetricsOtherKey, so that the number of series stays bounded
+	userMetricsMaxLabelValues = 20
+	userMetricsOtherKey       = "other"
+)
+
+// UserMetricsHandler exposes a single user's coding stats in prometheus exposition format, e.g. to be scraped into a personal grafana.
+// Unlike the instance-wide MetricsHandler, it's available regardless of security.expose_metrics and only ever reveals the requesting user's own data.
+type UserMetricsHandler struct {
+	config        *conf.Config
+	userSrvc      services.IUserService
+	summarySrvc   services.ISummaryService
+	heartbeatSrvc services.IHeartbeatService
+}
+
+func NewUserMetricsHandler(userService services.IUserService, summaryService services.ISummaryService, heartbeatService services.IHeartbeatService) *UserMetricsHandler {
+	return &UserMetricsHandler{
+		config:        conf.Get(),
+		userSrvc:      userService,
+		summarySrvc:   summaryService,
+		heartbeatSrvc: heartbeatService,
+	}
+}
+
+func (h *UserMetricsHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).WithOptionalFor("/api/users/current/metrics").Handler)
+	r.Get("/", h.Get)
+
+	router.Mount("/users/current/metrics", r)
+}
+
+// @Summary Retrieve the authenticated user's coding stats as prometheus metrics
+// @Description Exposes the user's total coding time of today and of all time, their number of heartbeats and today's coding time by project and language in prometheus exposition format. Authenticates either by api key or by the user's metrics token (see settings), sent as plain bearer token, which grants access to this endpoint only. The top 20 projects and languages are reported individually, all others as 'other'.
+// @ID get-current-user-metrics
+// @Tags user
+// @Produce plain
+// @Security ApiKeyAuth
+// @Success 200 {string} string "prometheus metrics"
+// @Failure 401 {string} string "unauthorized"
+// @Router /users/current/metrics [get]
+func (h *UserMetricsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := h.authorize(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	metrics, err := h.getMetrics(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get user metrics", "userID", user.ID, "error", err)
+		return
+	}
+
+	sort.Stable(metrics)
+
+	w.Header().Set("content-type", "text/plain; charset=utf-8")
+	w.Write([]byte(metrics.Print()))
+}
+
+// authorize returns the user authenticated by api key or session or, as a fallback, by metrics token
+func (h *UserMetricsHandler) authorize(r *http.Request) *models.User {
+	if user := middlewares.GetPrincipal(r); user != nil {
+		return user
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil
+	}
+	user, err := h.userSrvc.GetUserByMetricsToken(strings.TrimSpace(token))
+	if err != nil || user.IsSoftDeleted() {
+		return nil
+	}
+	return user
+}
+
+func (h *UserMetricsHandler) getMetrics(user *models.User) (mm.Metrics, error) {
+	summaryAllTime, err := h.summarySrvc.Aliased(time.Time{}, time.Now(), user, h.summarySrvc.Retrieve, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := helpers.MustResolveIntervalRawTZ("today", user.TZ())
+	summaryToday, err := h.summarySrvc.Aliased(from, to, user, h.summarySrvc.Retrieve, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	heartbeatCount, err := h.heartbeatSrvc.CountByUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := mm.Metrics{
+		&mm.GaugeMetric{
+			Name:   MetricsPrefix + "_cumulative_seconds_total",
+			Desc:   DescAllTime,
+			Value:  int64(summaryAllTime.TotalTime().Seconds()),
+			Labels: []mm.Label{},
+		},
+		&mm.GaugeMetric{
+			Name:   MetricsPrefix + "_seconds_total",
+			Desc:   DescTotal,
+			Value:  int64(summaryToday.TotalTime().Seconds()),
+			Labels: []mm.Label{},
+		},
+		&mm.GaugeMetric{
+			Name:   MetricsPrefix + "_heartbeats_total",
+			Desc:   DescHeartbeats,
+			Value:  heartbeatCount,
+			Labels: []mm.Label{},
+		},
+	}
+	metrics = append(metrics, boundedItemMetrics(MetricsPrefix+"_project_seconds_total", DescProjects, "project", summaryToday.Projects)...)
+	metrics = append(metrics, boundedItemMetrics(MetricsPrefix+"_language_seconds_total", DescLanguages, "language", summaryToday.Languages)...)
+
+	return metrics, nil
+}
+
+// boundedItemMetrics returns a metric for each of the top items by total time, labeled with their key, and one with the remaining items summed up
+func boundedItemMetrics(name, desc, label string, items models.SummaryItems) mm.Metrics {
+	sorted := make(models.SummaryItems, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Total > sorted[j].Total
+	})
+
+	metrics := make(mm.Metrics, 0, userMetricsMaxLabelValues+1)
+	var other time.Duration
+	for i, item := range sorted {
+		if i >= userMetricsMaxLabelValues {
+			other += item.TotalFixed()
+			continue
+		}
+		metrics = append(metrics, &mm.GaugeMetric{
+			Name:   name,
+			Desc:   desc,
+			Value:  int64(item.TotalFixed().Seconds()),
+			Labels: []mm.Label{{Key: label, Value: item.Key}},
+		})
+	}
+	if len(sorted) > userMetricsMaxLabelValues {
+		metrics = append(metrics, &mm.GaugeMetric{
+			Name:   name,
+			Desc:   desc,
+			Value:  int64(other.Seconds()),
+			Labels: []mm.Label{{Key: label, Value: userMetricsOtherKey}},
+		})
+	}
+	return metrics
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUserMetricsHandler_Get(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01", ApiKey: "fd2b4d5a-6c0e-4c44-9a8e-4c3f07c0a5b1", MetricsToken: "0b5a6e92-5d7f-4a4e-8f3e-2b1f1c9d7e6a"}
+
+	projects := models.SummaryItems{{Type: models.SummaryProject, Key: `my "quoted" project`, Total: 3600}}
+	for i := 0; i < userMetricsMaxLabelValues+2; i++ {
+		projects = append(projects, &models.SummaryItem{Type: models.SummaryProject, Key: fmt.Sprintf("project%02d", i), Total: time.Duration(100 - i)})
+	}
+	today := &models.Summary{
+		Projects:  projects,
+		Languages: models.SummaryItems{{Type: models.SummaryLanguage, Key: "Go", Total: 5000}},
+	}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserByKey", user.ApiKey).Return(user, nil)
+	userServiceMock.On("GetUserByKey", mock.Anything).Return((*models.User)(nil), fmt.Errorf("not found"))
+	userServiceMock.On("GetUserByMetricsToken", user.MetricsToken).Return(user, nil)
+	userServiceMock.On("GetUserByMetricsToken", mock.Anything).Return((*models.User)(nil), fmt.Errorf("not found"))
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Aliased", time.Time{}, mock.Anything, user, mock.Anything, mock.Anything).Return(&models.Summary{
+		Projects: models.SummaryItems{{Type: models.SummaryProject, Key: "wakapi", Total: 86400}},
+	}, nil)
+	summaryServiceMock.On("Aliased", mock.Anything, mock.Anything, user, mock.Anything, mock.Anything).Return(today, nil)
+
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("CountByUser", user).Return(int64(42), nil)
+
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware())
+	router.Route("/api", NewUserMetricsHandler(userServiceMock, summaryServiceMock, heartbeatServiceMock).RegisterRoutes)
+
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/users/current/metrics", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("with metrics token", func(t *testing.T) {
+		rec := serve("Bearer " + user.MetricsToken)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		body := rec.Body.String()
+
+		assert.Contains(t, body, "wakatime_cumulative_seconds_total 86400\n")
+		assert.Contains(t, body, "wakatime_seconds_total 5569\n")
+		assert.Contains(t, body, "wakatime_heartbeats_total 42\n")
+		assert.Contains(t, body, `wakatime_project_seconds_total{project="my \"quoted\" project"} 3600`)
+		assert.Contains(t, body, `wakatime_project_seconds_total{project="project00"} 100`)
+		assert.NotContains(t, body, `project="project19"`)
+		assert.Contains(t, body, `wakatime_project_seconds_total{project="other"} 240`) // 81 + 80 + 79
+		assert.Contains(t, body, `wakatime_language_seconds_total{language="Go"} 5000`)
+		assert.Equal(t, userMetricsMaxLabelValues+1, strings.Count(body, "wakatime_project_seconds_total{"))
+		assert.NotContains(t, body, "wakatime_goroutines_total") // no instance-wide metrics
+	})
+
+	t.Run("with api key", func(t *testing.T) {
+		rec := serve("Bearer " + base64.StdEncoding.EncodeToString([]byte(user.ApiKey)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve("").Code)
+		assert.Equal(t, http.StatusUnauthorized, serve("Bearer invalid").Code)
+		assert.Equal(t, http.StatusUnauthorized, serve("Basic "+user.MetricsToken).Code)
+	})
+}
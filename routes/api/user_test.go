@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/securecookie"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseUserQuery(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/users?active_days=7&has_subscription=false&created_after=2024-01-01&sort=last_active_at&order=desc", nil)
+	query, err := parseUserQuery(r, time.UTC)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, -7), *query.ActiveAfter, time.Minute)
+	assert.False(t, *query.HasSubscription)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), *query.CreatedAfter)
+	assert.Nil(t, query.CreatedBefore)
+	assert.Equal(t, "last_active_at", query.SortBy)
+	assert.True(t, query.SortDesc)
+
+	for _, q := range []string{"active_days=-1", "has_subscription=maybe", "created_before=yesterday", "sort=password", "order=up"} {
+		_, err := parseUserQuery(httptest.NewRequest(http.MethodGet, "/api/admin/users?"+q, nil), time.UTC)
+		assert.Error(t, err, q)
+	}
+}
+
+func TestUserApiHandler_GetCurrent(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01", Email: "testuser01@example.org", ApiKey: "secret", Location: "Europe/Berlin"}
+
+	handler := NewUserApiHandler(new(mocks.UserServiceMock))
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" {
+				middlewares.SetPrincipal(r, user)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/users/current", handler.GetCurrent)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users/current", nil)
+	req.Header.Set("Authorization", "Basic c2VjcmV0")
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"username": "testuser01", "display_name": "testuser01", "timezone": "Europe/Berlin"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/current", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestUserApiHandler_Sessions(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.SecureCookie = securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	config.Set(cfg)
+
+	user := &models.User{ID: "testuser01"}
+	sessions := []*models.UserSession{{ID: "session01", UserID: user.ID}, {ID: "session02", UserID: user.ID}}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetSessions", user).Return(sessions, nil)
+	userServiceMock.On("RevokeSessions", user, "session01").Return(nil)
+	userServiceMock.On("RevokeSession", user, "session02").Return(nil)
+	userServiceMock.On("RevokeSession", user, "session03").Return(services.ErrSessionNotFound)
+
+	handler := NewUserApiHandler(userServiceMock)
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/users/current/sessions", handler.GetSessions)
+	router.Delete("/users/current/sessions", handler.DeleteSessions)
+	router.Delete("/users/current/sessions/{id}", handler.DeleteSession)
+
+	newRequest := func(method, path string) *http.Request {
+		session := models.NewSession(user)
+		session.ID = "session01"
+		encoded, _ := cfg.Security.SecureCookie.Encode(models.AuthCookieKey, session)
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: models.AuthCookieKey, Value: encoded})
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest(http.MethodGet, "/users/current/sessions"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result []map[string]interface{}
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&result))
+	assert.Len(t, result, 2)
+	assert.Equal(t, true, result[0]["current"])
+	assert.Equal(t, false, result[1]["current"])
+
+	// keeps the current one
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest(http.MethodDelete, "/users/current/sessions"))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	userServiceMock.AssertCalled(t, "RevokeSessions", user, "session01")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest(http.MethodDelete, "/users/current/sessions/session02"))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, newRequest(http.MethodDelete, "/users/current/sessions/session03"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+)
+
+// number of recent deliveries to return per webhook
+const webhookDeliveriesLimit = 25
+
+type createWebhookRequest struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type webhookResponse struct {
+	ID        uint              `json:"id"`
+	Url       string            `json:"url"`
+	Events    []string          `json:"events"`
+	Secret    string            `json:"secret,omitempty"` // only included right after creation
+	CreatedAt models.CustomTime `json:"created_at" swaggertype:"string" format:"date" example:"2006-01-02 15:04:05.000"`
+}
+
+type WebhookApiHandler struct {
+	config      *conf.Config
+	userSrvc    services.IUserService
+	webhookSrvc services.IWebhookService
+}
+
+func NewWebhookApiHandler(userService services.IUserService, webhookService services.IWebhookService) *WebhookApiHandler {
+	return &WebhookApiHandler{
+		config:      conf.Get(),
+		userSrvc:    userService,
+		webhookSrvc: webhookService,
+	}
+}
+
+func (h *WebhookApiHandler) RegisterRoutes(router chi.Router) {
+	if !h.config.App.WebhooksEnabled {
+		return
+	}
+
+	r := chi.NewRouter()
+	r.Use(middlewares.NewAuthenticateMiddleware(h.userSrvc).Handler)
+	r.Get("/", h.GetAll)
+	r.Post("/", h.Post)
+	r.Delete("/{id}", h.Delete)
+	r.Get("/{id}/deliveries", h.GetDeliveries)
+	r.Post("/{id}/ping", h.PostPing)
+
+	router.Mount("/webhooks", r)
+}
+
+// @Summary List the user's webhooks
+// @ID get-webhooks
+// @Tags webhooks
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} api.webhookResponse
+// @Router /webhooks [get]
+func (h *WebhookApiHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	webhooks, err := h.webhookSrvc.GetByUser(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get webhooks", "userID", user.ID, "error", err)
+		return
+	}
+
+	result := make([]*webhookResponse, len(webhooks))
+	for i, webhook := range webhooks {
+		result[i] = newWebhookResponse(webhook, false)
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, result)
+}
+
+// @Summary Register a webhook
+// @Description Registers a url to be called upon the given events. Requests carry an `X-Wakapi-Signature` header, which holds the hex-encoded HMAC-SHA256 of the request body, keyed with the webhook's secret and prefixed with `sha256=`. The secret is only returned once, in the response to this request.
+// @ID post-webhook
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body api.createWebhookRequest true "Url and events ('summary.daily', 'project.started' or 'project.stopped') to subscribe to"
+// @Security ApiKeyAuth
+// @Success 201 {object} api.webhookResponse
+// @Failure 400 {string} string "bad request"
+// @Router /webhooks [post]
+func (h *WebhookApiHandler) Post(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(conf.ErrBadRequest))
+		return
+	}
+
+	webhook, err := h.webhookSrvc.Create(user, req.Url, req.Events)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusCreated, newWebhookResponse(webhook, true))
+}
+
+// @Summary Delete a webhook
+// @ID delete-webhook
+// @Tags webhooks
+// @Param id path int true "Webhook id"
+// @Security ApiKeyAuth
+// @Success 204
+// @Failure 404 {string} string "not found"
+// @Router /webhooks/{id} [delete]
+func (h *WebhookApiHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	if err := h.webhookSrvc.Delete(user, uint(id)); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary List a webhook's recent deliveries
+// @Description Returns the webhook's latest deliveries along with their status. Failed deliveries are retried with exponential backoff. Delivery records are kept for 30 days.
+// @ID get-webhook-deliveries
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook id"
+// @Security ApiKeyAuth
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 404 {string} string "not found"
+// @Router /webhooks/{id}/deliveries [get]
+func (h *WebhookApiHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	deliveries, err := h.webhookSrvc.GetDeliveries(user, uint(id), webhookDeliveriesLimit)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, deliveries)
+}
+
+// @Summary Send a test event to a webhook
+// @ID post-webhook-ping
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook id"
+// @Security ApiKeyAuth
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 404 {string} string "not found"
+// @Router /webhooks/{id}/ping [post]
+func (h *WebhookApiHandler) PostPing(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	delivery, err := h.webhookSrvc.Ping(user, uint(id))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusAccepted, delivery)
+}
+
+func newWebhookResponse(webhook *models.Webhook, withSecret bool) *webhookResponse {
+	res := &webhookResponse{
+		ID:        webhook.ID,
+		Url:       webhook.Url,
+		Events:    webhook.EventList(),
+		CreatedAt: webhook.CreatedAt,
+	}
+	if withSecret {
+		res.Secret = webhook.Secret
+	}
+	return res
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
+	routeutils "github.com/muety/wakapi/routes/utils"
+	"github.com/muety/wakapi/services"
+)
+
+type YearReviewApiHandler struct {
+	config              *conf.Config
+	userSrvc            services.IUserService
+	yearReviewSrvc      services.IYearReviewService
+	projectMetadataSrvc services.IProjectMetadataService
+}
+
+func NewYearReviewApiHandler(userService services.IUserService, yearReviewService services.IYearReviewService, projectMetadataService services.IProjectMetadataService) *YearReviewApiHandler {
+	return &YearReviewApiHandler{
+		config:              conf.Get(),
+		userSrvc:            userService,
+		yearReviewSrvc:      yearReviewService,
+		projectMetadataSrvc: projectMetadataService,
+	}
+}
+
+func (h *YearReviewApiHandler) RegisterRoutes(router chi.Router) {
+	r := chi.NewRouter()
+	r.Use(
+		middlewares.NewAuthenticateMiddleware(h.userSrvc).WithOptionalFor("/api/year_review/").Handler,
+		middleware.Compress(9, "image/svg+xml"),
+	)
+	r.Get("/", h.Get)
+	r.Get("/{userWithExt}", h.GetShared)
+
+	router.Mount("/year_review", r)
+}
+
+// @Summary Retrieve a review of a calendar year
+// @Description Recaps the given calendar year in the user's timezone, including total coding time, top projects and languages, the busiest month and day and the longest streak of active days. Values are in seconds.
+// @ID get-year-review
+// @Tags summary
+// @Produce json
+// @Param year query int false "Calendar year (default: current year)"
+// @Security ApiKeyAuth
+// @Success 200 {object} models.YearReview
+// @Failure 400 {string} string "bad request"
+// @Failure 401 {string} string "unauthorized"
+// @Router /year_review [get]
+func (h *YearReviewApiHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.GetPrincipal(r)
+	if user == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(conf.ErrUnauthorized))
+		return
+	}
+
+	year, err := parseYearReviewYear(r, user)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	review, err := h.yearReviewSrvc.Get(user, year)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get year review for user", "userID", user.ID, "year", year, "error", err)
+		return
+	}
+
+	helpers.RespondJSON(w, r, http.StatusOK, review)
+}
+
+// @Summary Retrieve a shareable review of a calendar year
+// @Description Same as /year_review, but for any user sharing their coding activity for at least the whole year (see share_data_max_days), either as json or, with an '.svg' suffix, as an image. Unless requested by the user themselves, private projects are anonymized and projects and languages are only included if shared.
+// @ID get-year-review-shared
+// @Tags summary
+// @Produce json
+// @Produce image/svg+xml
+// @Param user path string true "User ID, optionally suffixed with '.json' or '.svg'"
+// @Param year query int false "Calendar year (default: current year)"
+// @Param dark query bool false "Whether to render the image in dark mode"
+// @Param noattr query bool false "Whether to leave out the attribution from the image"
+// @Success 200 {object} models.YearReview
+// @Failure 400 {string} string "bad request"
+// @Failure 403 {string} string "forbidden"
+// @Failure 404 {string} string "not found"
+// @Router /year_review/{user} [get]
+func (h *YearReviewApiHandler) GetShared(w http.ResponseWriter, r *http.Request) {
+	authorizedUser := middlewares.GetPrincipal(r)
+
+	// see ActivityApiHandler.GetActivityChart on why the extension is part of the parameter
+	userWithExt := chi.URLParam(r, "userWithExt")
+	asImage := strings.HasSuffix(userWithExt, ".svg")
+	requestedUser, err := h.userSrvc.GetUserById(strings.TrimSuffix(strings.TrimSuffix(userWithExt, ".svg"), ".json"))
+	if err != nil || requestedUser.IsSoftDeleted() {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(conf.ErrNotFound))
+		return
+	}
+
+	year, err := parseYearReviewYear(r, requestedUser)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	isOwner := authorizedUser != nil && authorizedUser.ID == requestedUser.ID
+	if !isOwner {
+		from := time.Date(year, 1, 1, 0, 0, 0, 0, requestedUser.TZ())
+		if requestedUser.ShareDataMaxDays >= 0 && from.Before(time.Now().AddDate(0, 0, -requestedUser.ShareDataMaxDays)) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(conf.ErrForbidden))
+			return
+		}
+	}
+
+	review, err := h.yearReviewSrvc.Get(requestedUser, year)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to get year review for user", "userID", requestedUser.ID, "year", year, "error", err)
+		return
+	}
+
+	if !isOwner {
+		if review, err = routeutils.AnonymizeSharedYearReview(review, requestedUser, h.projectMetadataSrvc); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(conf.ErrInternalServerError))
+			conf.Log().Request(r).Error("failed to anonymize year review", "userID", requestedUser.ID, "error", err)
+			return
+		}
+	}
+
+	if !asImage {
+		helpers.RespondJSONCacheable(w, r, review, authorizedUser == nil)
+		return
+	}
+
+	paramDark := r.URL.Query().Has("dark") && r.URL.Query().Get("dark") != "false"
+	paramNoAttr := r.URL.Query().Has("noattr") && r.URL.Query().Get("noattr") != "false"
+	helpers.RespondCacheable(w, r, "image/svg+xml", []byte(h.yearReviewSrvc.GetImage(review, paramDark, paramNoAttr)), authorizedUser == nil)
+}
+
+func parseYearReviewYear(r *http.Request, user *models.User) (int, error) {
+	year := time.Now().In(user.TZ()).Year()
+	if yearParam := r.URL.Query().Get("year"); yearParam != "" {
+		parsedYear, err := strconv.Atoi(yearParam)
+		if err != nil || parsedYear < 1970 || parsedYear > year {
+			return 0, errors.New("invalid year")
+		}
+		year = parsedYear
+	}
+	return year, nil
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestYearReviewHandler_GetShared(t *testing.T) {
+	config.Set(config.Empty())
+
+	year := time.Now().Year() - 1
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	user := &models.User{ID: "testuser01", ShareDataMaxDays: -1, ShareLanguages: true}
+	limitedUser := &models.User{ID: "testuser02", ShareDataMaxDays: 30, ShareLanguages: true}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", user.ID).Return(user, nil)
+	userServiceMock.On("GetUserById", limitedUser.ID).Return(limitedUser, nil)
+
+	days := models.NewCumulativeSummary(from, to)
+	days.Add(from, 2*time.Hour)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Rollup", mock.Anything, mock.Anything, user, mock.Anything, models.RollupYear).Return([]*models.SummaryRollup{{
+		Period:    from.Format("2006"),
+		From:      models.CustomTime(from),
+		To:        models.CustomTime(to),
+		Total:     7200,
+		Projects:  models.SummaryItems{{Type: models.SummaryProject, Key: "wakapi", Total: 7200}},
+		Languages: models.SummaryItems{{Type: models.SummaryLanguage, Key: "Go", Total: 7200}},
+	}}, nil)
+	summaryServiceMock.On("Rollup", mock.Anything, mock.Anything, user, mock.Anything, models.RollupMonth).Return([]*models.SummaryRollup{{Period: from.Format("2006-01"), Total: 7200}}, nil)
+	summaryServiceMock.On("Cumulative", mock.Anything, mock.Anything, user, mock.Anything).Return(days, nil)
+
+	projectMetadataServiceMock := new(mocks.ProjectMetadataServiceMock)
+	projectMetadataServiceMock.On("GetPrivate", user.ID, mock.Anything).Return([]string{}, nil)
+
+	var principal *models.User
+	handler := NewYearReviewApiHandler(userServiceMock, services.NewYearReviewService(summaryServiceMock), projectMetadataServiceMock)
+	router := chi.NewRouter()
+	router.Use(middlewares.NewPrincipalMiddleware(), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if principal != nil {
+				middlewares.SetPrincipal(r, principal)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/year_review/{userWithExt}", handler.GetShared)
+
+	t.Run("when shared", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/year_review/testuser01?year="+from.Format("2006"), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var review map[string]interface{}
+		assert.Nil(t, json.NewDecoder(rec.Body).Decode(&review))
+		assert.EqualValues(t, 7200, review["total"])
+		assert.Empty(t, review["projects"]) // not shared
+		assert.Len(t, review["languages"], 1)
+		assert.EqualValues(t, 1, review["longest_streak"].(map[string]interface{})["days"])
+	})
+
+	t.Run("when requested by owner", func(t *testing.T) {
+		principal = user
+		defer func() { principal = nil }()
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/year_review/testuser01.json?year="+from.Format("2006"), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var review map[string]interface{}
+		assert.Nil(t, json.NewDecoder(rec.Body).Decode(&review))
+		assert.Len(t, review["projects"], 1)
+	})
+
+	t.Run("as image", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/year_review/testuser01.svg?year="+from.Format("2006"), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "in review")
+		assert.NotContains(t, rec.Body.String(), "wakapi</text>")
+	})
+
+	t.Run("when not shared for the whole year", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/year_review/testuser02?year="+from.Format("2006"), nil))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("with invalid year", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/year_review/testuser01?year=3000", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	// computed only once, served from cache afterwards
+	summaryServiceMock.AssertNumberOfCalls(t, "Cumulative", 1)
+}
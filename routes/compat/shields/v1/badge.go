@@ -17,18 +17,20 @@ import (
 )
 
 type BadgeHandler struct {
-	config      *conf.Config
-	userSrvc    services.IUserService
-	summarySrvc services.ISummaryService
-	cache       *cache.Cache
+	config              *conf.Config
+	userSrvc            services.IUserService
+	summarySrvc         services.ISummaryService
+	projectMetadataSrvc services.IProjectMetadataService
+	cache               *cache.Cache
 }
 
-func NewBadgeHandler(summaryService services.ISummaryService, userService services.IUserService) *BadgeHandler {
+func NewBadgeHandler(summaryService services.ISummaryService, userService services.IUserService, projectMetadataService services.IProjectMetadataService) *BadgeHandler {
 	return &BadgeHandler{
-		summarySrvc: summaryService,
-		userSrvc:    userService,
-		cache:       cache.New(time.Hour, time.Hour),
-		config:      conf.Get(),
+		summarySrvc:         summaryService,
+		userSrvc:            userService,
+		projectMetadataSrvc: projectMetadataService,
+		cache:               cache.New(time.Hour, time.Hour),
+		config:              conf.Get(),
 	}
 }
 
@@ -49,12 +51,12 @@ func (h *BadgeHandler) RegisterRoutes(router chi.Router) {
 // @Router /compat/shields/v1/{user}/{interval}/{filter} [get]
 func (h *BadgeHandler) Get(w http.ResponseWriter, r *http.Request) {
 	user, err := h.userSrvc.GetUserById(chi.URLParam(r, "user"))
-	if err != nil {
+	if err != nil || user.IsSoftDeleted() {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	interval, filters, err := routeutils.GetBadgeParams(r.URL.Path, nil, user)
+	interval, filters, err := routeutils.GetBadgeParams(r.URL.Path, nil, user, h.projectMetadataSrvc)
 	if err != nil {
 		w.WriteHeader(http.StatusForbidden)
 		w.Write([]byte(err.Error()))
@@ -64,7 +66,7 @@ func (h *BadgeHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	cacheKey := fmt.Sprintf("%s_%v_%s", user.ID, *interval.Key, filters.Hash())
 	if cacheResult, ok := h.cache.Get(cacheKey); ok {
-		helpers.RespondJSON(w, r, http.StatusOK, cacheResult.(*v1.BadgeData))
+		helpers.RespondJSONCacheable(w, r, cacheResult.(*v1.BadgeData), true)
 		return
 	}
 
@@ -84,7 +86,7 @@ func (h *BadgeHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	vm := v1.NewBadgeDataFrom(summary)
 	h.cache.SetDefault(cacheKey, vm)
-	helpers.RespondJSON(w, r, http.StatusOK, vm)
+	helpers.RespondJSONCacheable(w, r, vm, true) // requests are never authenticated
 }
 
 func (h *BadgeHandler) loadUserSummary(user *models.User, interval *models.IntervalKey, filters *models.Filters) (*models.Summary, error, int) {
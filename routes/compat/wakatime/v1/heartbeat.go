@@ -5,20 +5,29 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/muety/wakapi/helpers"
 	"net/http"
+	"strconv"
 	"time"
 
 	conf "github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/models"
 	wakatime "github.com/muety/wakapi/models/compat/wakatime/v1"
 	routeutils "github.com/muety/wakapi/routes/utils"
 	"github.com/muety/wakapi/services"
 )
 
+const (
+	defaultHeartbeatsPageSize = 100
+	maxHeartbeatsPageSize     = 1000
+)
+
 type HeartbeatsResult struct {
-	Data     []*wakatime.HeartbeatEntry `json:"data"`
-	End      string                     `json:"end"`
-	Start    string                     `json:"start"`
-	Timezone string                     `json:"timezone"`
+	Data       []*wakatime.HeartbeatEntry `json:"data"`
+	End        string                     `json:"end"`
+	Start      string                     `json:"start"`
+	Timezone   string                     `json:"timezone"`
+	HasMore    bool                       `json:"has_more"`
+	NextCursor string                     `json:"next_cursor,omitempty"`
 }
 
 type HeartbeatHandler struct {
@@ -45,9 +54,14 @@ func (h *HeartbeatHandler) RegisterRoutes(router chi.Router) {
 // @Tags heartbeat
 // @Param date query string true "Date"
 // @Param user path string true "Username (or current)"
+// @Param limit query int false "Maximum number of heartbeats to return (enables pagination, max. 1000)"
+// @Param cursor query string false "Cursor to continue from, as returned in next_cursor of the previous page (enables pagination)"
+// @Param entity query string false "Only include heartbeats whose entity (e.g. file path) contains this string, case-insensitively (enables pagination, not part of wakatime's api)"
 // @Security ApiKeyAuth
 // @Success 200 {object} HeartbeatsResult
 // @Failure 400 {string} string "bad date"
+// @Failure 400 {string} string "bad limit"
+// @Failure 400 {string} string "bad cursor"
 // @Router /compat/wakatime/v1/users/{user}/heartbeats [get]
 func (h *HeartbeatHandler) Get(w http.ResponseWriter, r *http.Request) {
 	user, err := routeutils.CheckEffectiveUser(w, r, h.userSrvc, "current")
@@ -67,7 +81,39 @@ func (h *HeartbeatHandler) Get(w http.ResponseWriter, r *http.Request) {
 	timezone := user.TZ()
 	rangeFrom, rangeTo := datetime.BeginOfDay(date.In(timezone)), datetime.EndOfDay(date.In(timezone))
 
-	heartbeats, err := h.heartbeatSrvc.GetAllWithin(rangeFrom, rangeTo, user)
+	// pagination is opt-in to stay backwards-compatible, i.e. all heartbeats of the day are returned if neither limit nor cursor are given
+	// searching by entity always paginates, as broad matches could yield an arbitrarily large result
+	entity := params.Get("entity")
+	paginate := params.Has("limit") || params.Has("cursor") || entity != ""
+
+	limit := defaultHeartbeatsPageSize
+	if limitParam := params.Get("limit"); limitParam != "" {
+		if limit, err = strconv.Atoi(limitParam); err != nil || limit < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("bad limit"))
+			return
+		}
+		limit = min(limit, maxHeartbeatsPageSize)
+	}
+
+	var cursor *models.HeartbeatCursor
+	if cursorParam := params.Get("cursor"); cursorParam != "" {
+		if cursor, err = models.ParseHeartbeatCursor(cursorParam); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("bad cursor"))
+			return
+		}
+	}
+
+	var heartbeats []*models.Heartbeat
+	// when paginating, fetch one extra heartbeat to find out whether there are more to come
+	if entity != "" {
+		heartbeats, err = h.heartbeatSrvc.GetAllWithinByEntityPaginated(rangeFrom, rangeTo, user, entity, cursor, limit+1)
+	} else if paginate {
+		heartbeats, err = h.heartbeatSrvc.GetAllWithinPaginated(rangeFrom, rangeTo, user, cursor, limit+1)
+	} else {
+		heartbeats, err = h.heartbeatSrvc.GetAllWithin(rangeFrom, rangeTo, user)
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(conf.ErrInternalServerError))
@@ -76,10 +122,17 @@ func (h *HeartbeatHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := HeartbeatsResult{
-		Data:     wakatime.HeartbeatsToCompat(heartbeats),
 		Start:    rangeFrom.UTC().Format(time.RFC3339),
 		End:      rangeTo.UTC().Format(time.RFC3339),
 		Timezone: timezone.String(),
 	}
+
+	if paginate && len(heartbeats) > limit {
+		heartbeats = heartbeats[:limit]
+		res.HasMore = true
+		res.NextCursor = models.NewHeartbeatCursor(heartbeats[limit-1]).String()
+	}
+
+	res.Data = wakatime.HeartbeatsToCompat(heartbeats)
 	helpers.RespondJSON(w, r, http.StatusOK, res)
 }
@@ -0,0 +1,71 @@
+package v1
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHeartbeatHandler_Get_ByEntity(t *testing.T) {
+	config.Set(config.Empty())
+
+	router := chi.NewRouter()
+	apiRouter := chi.NewRouter()
+	apiRouter.Use(middlewares.NewPrincipalMiddleware())
+	router.Mount("/api", apiRouter)
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserByKey", "basic-user-api-key").Return(basicUser, nil)
+
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	heartbeats := []*models.Heartbeat{
+		{ID: 1, UserID: basicUser.ID, Entity: "/home/user/wakapi/main.go", Time: models.CustomTime(t0)},
+		{ID: 2, UserID: basicUser.ID, Entity: "/home/user/wakapi/Main.go", Time: models.CustomTime(t0.Add(time.Minute))},
+		{ID: 3, UserID: basicUser.ID, Entity: "/home/user/other/main.go", Time: models.CustomTime(t0.Add(2 * time.Minute))},
+	}
+
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("GetAllWithinByEntityPaginated", mock.Anything, mock.Anything, basicUser, "main.go", (*models.HeartbeatCursor)(nil), 3).Return(heartbeats, nil)
+	heartbeatServiceMock.On("GetAllWithinByEntityPaginated", mock.Anything, mock.Anything, basicUser, "wakapi/", (*models.HeartbeatCursor)(nil), defaultHeartbeatsPageSize+1).Return(heartbeats[:2], nil)
+
+	NewHeartbeatHandler(userServiceMock, heartbeatServiceMock).RegisterRoutes(apiRouter)
+
+	get := func(query string) (*httptest.ResponseRecorder, *HeartbeatsResult) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/compat/wakatime/v1/users/current/heartbeats?date=2024-01-01&"+query, nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", base64.StdEncoding.EncodeToString([]byte(basicUser.ApiKey))))
+		router.ServeHTTP(rec, req)
+
+		var result HeartbeatsResult
+		json.NewDecoder(rec.Body).Decode(&result)
+		return rec, &result
+	}
+
+	t.Run("should paginate matches", func(t *testing.T) {
+		rec, result := get("entity=main.go&limit=2")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Len(t, result.Data, 2)
+		assert.True(t, result.HasMore)
+		assert.Equal(t, models.NewHeartbeatCursor(heartbeats[1]).String(), result.NextCursor)
+	})
+
+	t.Run("should always paginate when searching", func(t *testing.T) {
+		rec, result := get("entity=wakapi/")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Len(t, result.Data, 2)
+		assert.False(t, result.HasMore)
+		heartbeatServiceMock.AssertNotCalled(t, "GetAllWithin", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/middlewares"
 	"github.com/muety/wakapi/models"
+	routeutils "github.com/muety/wakapi/routes/utils"
 	"github.com/muety/wakapi/utils"
 	"math"
 	"net/http"
@@ -51,12 +52,13 @@ func (h *LeadersHandler) Get(w http.ResponseWriter, r *http.Request) {
 	languageParam := strings.ToLower(r.URL.Query().Get("language"))
 	pageParams := utils.ParsePageParamsWithDefault(r, 1, 100)
 	by := models.SummaryLanguage
+	orgScope := routeutils.LeaderboardOrgScope(user)
 
 	loadPrimaryLeaderboard := func() (models.Leaderboard, error) {
 		if languageParam == "" {
-			return h.leaderboardSrvc.GetByInterval(h.leaderboardSrvc.GetDefaultScope(), pageParams, true)
+			return h.leaderboardSrvc.GetAggregatedByIntervalAndOrg(h.leaderboardSrvc.GetDefaultScope(), orgScope, nil, pageParams, true)
 		} else {
-			l, err := h.leaderboardSrvc.GetAggregatedByInterval(h.leaderboardSrvc.GetDefaultScope(), &by, pageParams, true)
+			l, err := h.leaderboardSrvc.GetAggregatedByIntervalAndOrg(h.leaderboardSrvc.GetDefaultScope(), orgScope, &by, pageParams, true)
 			if err == nil {
 				return l.TopByKey(by, languageParam), err
 			}
@@ -88,7 +90,7 @@ func (h *LeadersHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 	primaryLeaderboard.FilterEmpty()
 
-	languageLeaderboard, err := h.leaderboardSrvc.GetAggregatedByInterval(h.leaderboardSrvc.GetDefaultScope(), &by, &utils.PageParams{Page: 1, PageSize: math.MaxUint16}, true)
+	languageLeaderboard, err := h.leaderboardSrvc.GetAggregatedByIntervalAndOrg(h.leaderboardSrvc.GetDefaultScope(), orgScope, &by, &utils.PageParams{Page: 1, PageSize: math.MaxUint16}, true)
 	if err != nil {
 		conf.Log().Request(r).Error("error while fetching language-specific leaderboard items", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -96,8 +98,8 @@ func (h *LeadersHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// regardless of page, always show own rank
-	if user != nil && !primaryLeaderboard.HasUser(user.ID) {
+	// regardless of page, always show own rank, unless restricted to the user's org
+	if user != nil && orgScope == nil && !primaryLeaderboard.HasUser(user.ID) {
 		if l, err := loadPrimaryUserLeaderboard(); err == nil {
 			primaryLeaderboard.AddMany(l)
 		} else {
@@ -108,7 +110,7 @@ func (h *LeadersHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	vm := h.buildViewModel(primaryLeaderboard, languageLeaderboard, user, h.leaderboardSrvc.GetDefaultScope(), pageParams)
 	vm.Language = languageParam
-	helpers.RespondJSON(w, r, http.StatusOK, vm)
+	helpers.RespondJSONCacheable(w, r, vm, user == nil) // authenticated users' responses include their own rank
 }
 
 func (h *LeadersHandler) buildViewModel(globalLeaderboard, languageLeaderboard models.Leaderboard, user *models.User, interval *models.IntervalKey, pageParams *utils.PageParams) *v1.LeadersViewModel {
@@ -139,9 +141,10 @@ func (h *LeadersHandler) buildViewModel(globalLeaderboard, languageLeaderboard m
 
 	if len(currentUserGlobal) > 0 {
 		vm.CurrentUser = &v1.LeadersCurrentUser{
-			Rank: int(currentUserGlobal[0].Rank),
-			Page: 1,
-			User: v1.NewFromUser(currentUserGlobal[0].User),
+			Rank:       int(currentUserGlobal[0].Rank),
+			Percentile: currentUserGlobal[0].Percentile(),
+			Page:       1,
+			User:       v1.NewFromUser(currentUserGlobal[0].User),
 		}
 	}
 
@@ -149,7 +152,8 @@ func (h *LeadersHandler) buildViewModel(globalLeaderboard, languageLeaderboard m
 		dailyAverage := entry.Total / time.Duration(numDays)
 
 		vm.Data = append(vm.Data, &v1.LeadersEntry{
-			Rank: int(entry.Rank),
+			Rank:       int(entry.Rank),
+			Percentile: entry.Percentile(),
 			RunningTotal: &v1.LeadersRunningTotal{
 				TotalSeconds:              float64(entry.Total / time.Second),
 				HumanReadableTotal:        helpers.FmtWakatimeDuration(entry.Total),
@@ -19,16 +19,20 @@ import (
 )
 
 type ProjectsHandler struct {
-	config        *conf.Config
-	userSrvc      services.IUserService
-	heartbeatSrvc services.IHeartbeatService
+	config              *conf.Config
+	userSrvc            services.IUserService
+	heartbeatSrvc       services.IHeartbeatService
+	projectArchiveSrvc  services.IProjectArchiveService
+	projectMetadataSrvc services.IProjectMetadataService
 }
 
-func NewProjectsHandler(userService services.IUserService, heartbeatsService services.IHeartbeatService) *ProjectsHandler {
+func NewProjectsHandler(userService services.IUserService, heartbeatsService services.IHeartbeatService, projectArchiveService services.IProjectArchiveService, projectMetadataService services.IProjectMetadataService) *ProjectsHandler {
 	return &ProjectsHandler{
-		userSrvc:      userService,
-		heartbeatSrvc: heartbeatsService,
-		config:        conf.Get(),
+		userSrvc:            userService,
+		heartbeatSrvc:       heartbeatsService,
+		projectArchiveSrvc:  projectArchiveService,
+		projectMetadataSrvc: projectMetadataService,
+		config:              conf.Get(),
 	}
 }
 
@@ -47,6 +51,7 @@ func (h *ProjectsHandler) RegisterRoutes(router chi.Router) {
 // @Produce json
 // @Param user path string true "User ID to fetch data for (or 'current')"
 // @Param q query string false "Query to filter projects by"
+// @Param includeArchived query bool false "Whether to include archived projects"
 // @Security ApiKeyAuth
 // @Success 200 {object} v1.ProjectsViewModel
 // @Router /compat/wakatime/v1/users/{user}/projects [get]
@@ -56,7 +61,7 @@ func (h *ProjectsHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return // response was already sent by util function
 	}
 
-	projects, err := h.loadProjects(user, r.URL.Query().Get("q"), false)
+	projects, err := h.loadProjects(user, r.URL.Query().Get("q"), false, r.URL.Query().Get("includeArchived") == "true")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("something went wrong"))
@@ -84,7 +89,7 @@ func (h *ProjectsHandler) GetOne(w http.ResponseWriter, r *http.Request) {
 		return // response was already sent by util function
 	}
 
-	projects, err := h.loadProjects(user, chi.URLParam(r, "id"), true)
+	projects, err := h.loadProjects(user, chi.URLParam(r, "id"), true, true)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(conf.ErrInternalServerError))
@@ -102,23 +107,42 @@ func (h *ProjectsHandler) GetOne(w http.ResponseWriter, r *http.Request) {
 	helpers.RespondJSON(w, r, http.StatusOK, vm)
 }
 
-func (h *ProjectsHandler) loadProjects(user *models.User, q string, exact bool) ([]*v1.Project, error) {
+func (h *ProjectsHandler) loadProjects(user *models.User, q string, exact, includeArchived bool) ([]*v1.Project, error) {
 	results, err := h.heartbeatSrvc.GetUserProjectStats(user, time.Time{}, utils.BeginOfToday(time.Local), nil, false)
 	if err != nil {
 		return nil, err
 	}
 
+	if !includeArchived {
+		if results, err = h.projectArchiveSrvc.FilterProjectStats(user, results); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(results))
+	for _, p := range results {
+		names = append(names, p.Project)
+	}
+	metadata, err := h.projectMetadataSrvc.Resolve(user.ID, names)
+	if err != nil {
+		return nil, err
+	}
+
 	projects := make([]*v1.Project, 0, len(results))
 	for _, p := range results {
 		if (exact && p.Project == q) || (!exact && strings.HasPrefix(p.Project, q)) {
-			projects = append(projects, &v1.Project{
+			project := &v1.Project{
 				ID:                           p.Project,
 				Name:                         p.Project,
 				LastHeartbeatAt:              p.Last.T(),
 				HumanReadableLastHeartbeatAt: helpers.FormatDateTimeHuman(p.Last.T()),
 				UrlencodedName:               url.QueryEscape(p.Project),
 				CreatedAt:                    p.First.T(),
-			})
+			}
+			if m, ok := metadata[p.Project]; ok {
+				project.Color, project.Icon, project.Description = m.Color, m.Icon, m.Description
+			}
+			projects = append(projects, project)
 		}
 	}
 
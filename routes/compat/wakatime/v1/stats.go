@@ -11,20 +11,26 @@ import (
 	"github.com/muety/wakapi/middlewares"
 	"github.com/muety/wakapi/models"
 	v1 "github.com/muety/wakapi/models/compat/wakatime/v1"
+	routeutils "github.com/muety/wakapi/routes/utils"
 	"github.com/muety/wakapi/services"
+	"github.com/muety/wakapi/utils"
 )
 
 type StatsHandler struct {
-	config      *conf.Config
-	userSrvc    services.IUserService
-	summarySrvc services.ISummaryService
+	config              *conf.Config
+	userSrvc            services.IUserService
+	summarySrvc         services.ISummaryService
+	projectMetadataSrvc services.IProjectMetadataService
+	keyValueSrvc        services.IKeyValueService
 }
 
-func NewStatsHandler(userService services.IUserService, summaryService services.ISummaryService) *StatsHandler {
+func NewStatsHandler(userService services.IUserService, summaryService services.ISummaryService, projectMetadataService services.IProjectMetadataService, keyValueService services.IKeyValueService) *StatsHandler {
 	return &StatsHandler{
-		userSrvc:    userService,
-		summarySrvc: summaryService,
-		config:      conf.Get(),
+		userSrvc:            userService,
+		summarySrvc:         summaryService,
+		projectMetadataSrvc: projectMetadataService,
+		keyValueSrvc:        keyValueService,
+		config:              conf.Get(),
 	}
 }
 
@@ -102,20 +108,53 @@ func (h *StatsHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	summary, err, status := h.loadUserSummary(requestedUser, rangeFrom, rangeTo, helpers.ParseSummaryFilters(r))
+	filters := helpers.ParseSummaryFilters(r)
+
+	summary, err, status := h.loadUserSummary(requestedUser, rangeFrom, rangeTo, filters)
 	if err != nil {
 		w.WriteHeader(status)
 		w.Write([]byte(err.Error()))
 		return
 	}
 
-	stats := v1.NewStatsFrom(summary, &models.Filters{})
+	// persisted summaries are unfiltered, so best day is only available for unfiltered stats
+	var dailySummaries []*models.Summary
+	if filters.IsEmpty() {
+		if dailySummaries, err = h.loadDailySummaries(requestedUser, rangeFrom, rangeTo); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(conf.ErrInternalServerError))
+			conf.Log().Request(r).Error("failed to load daily summaries for stats", "userID", requestedUser.ID, "error", err)
+			return
+		}
+	}
+
+	averageDays, err := routeutils.CountAverageDays(summary, requestedUser, filters, h.summarySrvc, h.keyValueSrvc)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		conf.Log().Request(r).Error("failed to count days for stats averages", "userID", requestedUser.ID, "error", err)
+		return
+	}
+
+	isOwner := authorizedUser != nil && requestedUser.ID == authorizedUser.ID
+	if !isOwner {
+		if summary, err = routeutils.AnonymizeSharedSummary(summary, requestedUser, h.projectMetadataSrvc); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(conf.ErrInternalServerError))
+			conf.Log().Request(r).Error("failed to anonymize stats", "userID", requestedUser.ID, "error", err)
+			return
+		}
+	}
+
+	stats := v1.NewStatsFrom(summary, &models.Filters{}, averageDays)
 	stats.Data.Range = rangeParam
 	stats.Data.HumanReadableRange = helpers.MustParseInterval(rangeParam).GetHumanReadable()
 	stats.Data.IsCodingActivityVisible = requestedUser.ShareDataMaxDays != 0
 	stats.Data.IsOtherUsageVisible = requestedUser.AnyDataShared()
+	stats.Data.Timezone = requestedUser.TZ().String()
+	stats.Data.BestDay = v1.NewStatsBestDayFrom(dailySummaries, requestedUser.TZ())
 
-	if authorizedUser == nil || requestedUser.ID != authorizedUser.ID {
+	if !isOwner {
 		// post filter stats according to user's given sharing permissions
 		if !requestedUser.ShareEditors {
 			stats.Data.Editors = make([]*v1.SummariesEntry, 0)
@@ -134,7 +173,7 @@ func (h *StatsHandler) Get(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	helpers.RespondJSON(w, r, http.StatusOK, stats)
+	helpers.RespondJSONCacheable(w, r, stats, authorizedUser == nil)
 }
 
 func (h *StatsHandler) loadUserSummary(user *models.User, start, end time.Time, filters *models.Filters) (*models.Summary, error, int) {
@@ -152,3 +191,30 @@ func (h *StatsHandler) loadUserSummary(user *models.User, start, end time.Time,
 
 	return summary, nil, http.StatusOK
 }
+
+// loadDailySummaries fetches the user's persisted (usually daily) summaries for the given range to not have to re-compute a summary for every single day, even for large ranges.
+// Only the days not aggregated yet (typically today) are retrieved on the fly, assuming that every day before yesterday was aggregated already.
+func (h *StatsHandler) loadDailySummaries(user *models.User, start, end time.Time) ([]*models.Summary, error) {
+	summaries, err := h.summarySrvc.GetByUserWithin(user, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	pendingFrom := utils.BeginOfToday(user.TZ()).AddDate(0, 0, -1)
+	if len(summaries) > 0 && summaries[len(summaries)-1].ToTime.T().After(pendingFrom) {
+		pendingFrom = summaries[len(summaries)-1].ToTime.T()
+	}
+	if start.After(pendingFrom) {
+		pendingFrom = start
+	}
+
+	for _, day := range utils.SplitRangeByDays(pendingFrom, end) {
+		summary, err := h.summarySrvc.Aliased(day[0], day[1], user, h.summarySrvc.Retrieve, &models.Filters{}, day[1].After(time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
@@ -0,0 +1,126 @@
+package v1
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	v1 "github.com/muety/wakapi/models/compat/wakatime/v1"
+	"github.com/muety/wakapi/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStatsHandler_Get(t *testing.T) {
+	config.Set(config.Empty())
+
+	router := chi.NewRouter()
+	apiRouter := chi.NewRouter()
+	apiRouter.Use(middlewares.NewPrincipalMiddleware())
+	router.Mount("/api", apiRouter)
+
+	today := utils.BeginOfToday(time.Local)
+	daySummary := func(day time.Time, secs time.Duration) *models.Summary {
+		return &models.Summary{
+			UserID:    adminUser.ID,
+			FromTime:  models.CustomTime(day),
+			ToTime:    models.CustomTime(day.AddDate(0, 0, 1)),
+			Languages: models.SummaryItems{{Type: models.SummaryLanguage, Key: "Go", Total: secs}},
+		}
+	}
+
+	overall := &models.Summary{
+		UserID:   adminUser.ID,
+		FromTime: models.CustomTime(today.AddDate(0, 0, -6)),
+		ToTime:   models.CustomTime(today.AddDate(0, 0, 1)),
+		Languages: models.SummaryItems{
+			{Type: models.SummaryLanguage, Key: "Go", Total: 5400},
+			{Type: models.SummaryLanguage, Key: models.UnknownSummaryKey, Total: 1800},
+		},
+	}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", adminUser.ID).Return(adminUser, nil)
+	userServiceMock.On("GetUserByKey", adminUser.ApiKey).Return(adminUser, nil)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("GetByUserWithin", adminUser, mock.Anything, mock.Anything).Return([]*models.Summary{
+		daySummary(today.AddDate(0, 0, -3), 1200),
+		daySummary(today.AddDate(0, 0, -2), 3600),
+		daySummary(today.AddDate(0, 0, -1), 600),
+	}, nil)
+	// today, as not aggregated yet
+	summaryServiceMock.On("Aliased", today, mock.Anything, adminUser, mock.Anything, mock.Anything).Return(daySummary(today, 1800), nil)
+	summaryServiceMock.On("Aliased", mock.Anything, mock.Anything, adminUser, mock.Anything, mock.Anything).Return(overall, nil)
+
+	cumulative := models.NewCumulativeSummary(today.AddDate(0, 0, -6), today.AddDate(0, 0, 1))
+	for i, secs := range []time.Duration{0, 0, 0, 1200, 3600, 600, 1800} {
+		cumulative.Add(today.AddDate(0, 0, i-6), secs*time.Second)
+	}
+	summaryServiceMock.On("Cumulative", mock.Anything, mock.Anything, adminUser, mock.Anything).Return(cumulative, nil)
+
+	NewStatsHandler(userServiceMock, summaryServiceMock, new(mocks.ProjectMetadataServiceMock), new(mocks.KeyValueServiceMock)).RegisterRoutes(apiRouter)
+
+	t.Run("when requesting own stats", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/compat/wakatime/v1/users/current/stats/last_7_days", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", base64.StdEncoding.EncodeToString([]byte(adminUser.ApiKey))))
+
+		router.ServeHTTP(rec, req)
+
+		var result v1.StatsViewModel
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Nil(t, json.NewDecoder(rec.Body).Decode(&result))
+		assert.Equal(t, "last_7_days", result.Data.Range)
+		assert.Equal(t, float64(5400), result.Data.TotalSeconds)
+		assert.Equal(t, float64(7200), result.Data.TotalSecondsIncludingOtherLanguage)
+		assert.Equal(t, 7, result.Data.DaysIncludingHolidays)
+		assert.InDelta(t, 5400.0/7, result.Data.DailyAverage, 0.01)
+		assert.Equal(t, 75.0, result.Data.Languages[0].Percent)
+		assert.Equal(t, 25.0, result.Data.Languages[1].Percent)
+		assert.NotNil(t, result.Data.BestDay)
+		assert.Equal(t, today.AddDate(0, 0, -2).Format(time.DateOnly), result.Data.BestDay.Date)
+		assert.Equal(t, float64(3600), result.Data.BestDay.TotalSeconds)
+		assert.Equal(t, "1 hrs 0 mins", result.Data.BestDay.Text)
+	})
+
+	t.Run("when averaging over active days", func(t *testing.T) {
+		adminUser.AverageMode = models.AverageModeActiveDays
+		defer func() { adminUser.AverageMode = "" }()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/compat/wakatime/v1/users/current/stats/last_7_days", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", base64.StdEncoding.EncodeToString([]byte(adminUser.ApiKey))))
+
+		router.ServeHTTP(rec, req)
+
+		var result v1.StatsViewModel
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Nil(t, json.NewDecoder(rec.Body).Decode(&result))
+		assert.Equal(t, 7, result.Data.DaysIncludingHolidays)
+		assert.Equal(t, float64(5400/4), result.Data.DailyAverage)
+		assert.Equal(t, float64(7200/4), result.Data.DailyAverageIncludingOtherLanguage)
+	})
+
+	t.Run("when requesting filtered stats", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/compat/wakatime/v1/users/current/stats/last_7_days?project=wakapi", nil)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", base64.StdEncoding.EncodeToString([]byte(adminUser.ApiKey))))
+
+		router.ServeHTTP(rec, req)
+
+		var result v1.StatsViewModel
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Nil(t, json.NewDecoder(rec.Body).Decode(&result))
+		assert.Nil(t, result.Data.BestDay)
+	})
+}
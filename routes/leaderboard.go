@@ -1,10 +1,12 @@
 package routes
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/duke-git/lancet/v2/slice"
 	"github.com/go-chi/chi/v5"
 	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/middlewares"
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/models/view"
@@ -50,9 +52,20 @@ func (h *LeaderboardHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
 	if h.config.IsDev() {
 		loadTemplates()
 	}
-	if err := templates[conf.LeaderboardTemplate].Execute(w, h.buildViewModel(r, w)); err != nil {
+
+	vm := h.buildViewModel(r, w)
+
+	var buf bytes.Buffer
+	if err := templates[conf.LeaderboardTemplate].Execute(&buf, vm); err != nil {
 		conf.Log().Request(r).Error("failed to get leaderboard page", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(conf.ErrInternalServerError))
+		return
 	}
+
+	// only the plain, anonymous page is the same for everyone
+	public := vm.User == nil && vm.Error == "" && vm.Success == ""
+	helpers.RespondCacheable(w, r, "text/html; charset=utf-8", buf.Bytes(), public)
 }
 
 func (h *LeaderboardHandler) buildViewModel(r *http.Request, w http.ResponseWriter) *view.LeaderboardViewModel {
@@ -69,8 +82,11 @@ func (h *LeaderboardHandler) buildViewModel(r *http.Request, w http.ResponseWrit
 	var userLanguages map[string][]string
 	var topKeys []string
 
+	// in multi-tenant mode, users only compete with members of their own org, while own ranks beyond the current page are only available globally
+	orgScope := routeutils.LeaderboardOrgScope(user)
+
 	if byParam == "" {
-		leaderboard, err = h.leaderboardService.GetByInterval(h.leaderboardService.GetDefaultScope(), pageParams, true)
+		leaderboard, err = h.leaderboardService.GetAggregatedByIntervalAndOrg(h.leaderboardService.GetDefaultScope(), orgScope, nil, pageParams, true)
 		if err != nil {
 			conf.Log().Request(r).Error("error while fetching general leaderboard items", "error", err)
 			return &view.LeaderboardViewModel{
@@ -81,7 +97,7 @@ func (h *LeaderboardHandler) buildViewModel(r *http.Request, w http.ResponseWrit
 		}
 
 		// regardless of page, always show own rank
-		if user != nil && !leaderboard.HasUser(user.ID) {
+		if user != nil && orgScope == nil && !leaderboard.HasUser(user.ID) {
 			// but only if leaderboard spans multiple pages
 			if count, err := h.leaderboardService.CountUsers(true); err == nil && count > int64(pageParams.PageSize) {
 				if l, err := h.leaderboardService.GetByIntervalAndUser(h.leaderboardService.GetDefaultScope(), user.ID, true); err == nil && len(l) > 0 {
@@ -91,7 +107,7 @@ func (h *LeaderboardHandler) buildViewModel(r *http.Request, w http.ResponseWrit
 		}
 	} else {
 		if by, ok := allowedAggregations[byParam]; ok {
-			leaderboard, err = h.leaderboardService.GetAggregatedByInterval(h.leaderboardService.GetDefaultScope(), &by, pageParams, true)
+			leaderboard, err = h.leaderboardService.GetAggregatedByIntervalAndOrg(h.leaderboardService.GetDefaultScope(), orgScope, &by, pageParams, true)
 			if err != nil {
 				conf.Log().Request(r).Error("error while fetching general leaderboard items", "error", err)
 				return &view.LeaderboardViewModel{
@@ -102,7 +118,7 @@ func (h *LeaderboardHandler) buildViewModel(r *http.Request, w http.ResponseWrit
 			}
 
 			// regardless of page, always show own rank
-			if user != nil {
+			if user != nil && orgScope == nil {
 				// but only if leaderboard could, in theory, span multiple pages
 				if count, err := h.leaderboardService.CountUsers(true); err == nil && count > int64(pageParams.PageSize) {
 					if l, err := h.leaderboardService.GetAggregatedByIntervalAndUser(h.leaderboardService.GetDefaultScope(), user.ID, &by, true); err == nil {
@@ -113,6 +129,9 @@ func (h *LeaderboardHandler) buildViewModel(r *http.Request, w http.ResponseWrit
 				}
 			}
 
+			// users who chose to anonymize their languages are left out of language rankings, as these would reveal them
+			leaderboard = h.withoutAnonymizedUsers(leaderboard, user)
+
 			userLeaderboards := slice.GroupWith[*models.LeaderboardItemRanked, string](leaderboard, func(item *models.LeaderboardItemRanked) string {
 				return item.UserID
 			})
@@ -161,3 +180,18 @@ func (h *LeaderboardHandler) buildViewModel(r *http.Request, w http.ResponseWrit
 	}
 	return routeutils.WithSessionMessages(vm, r, w)
 }
+
+func (h *LeaderboardHandler) withoutAnonymizedUsers(leaderboard models.Leaderboard, principal *models.User) models.Leaderboard {
+	userIds := slice.Unique(slice.Map(leaderboard, func(i int, item *models.LeaderboardItemRanked) string {
+		return item.UserID
+	}))
+	users, err := h.userService.GetManyMapped(userIds)
+	if err != nil {
+		conf.Log().Error("failed to fetch users for leaderboard", "error", err)
+		return models.Leaderboard{}
+	}
+	return slice.Filter(leaderboard, func(i int, item *models.LeaderboardItemRanked) bool {
+		u, ok := users[item.UserID]
+		return !ok || !u.AnonymizeLanguages || (principal != nil && principal.ID == u.ID)
+	})
+}
@@ -1,11 +1,13 @@
 package routes
 
 import (
+	"errors"
 	"fmt"
 	"github.com/dchest/captcha"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/httprate"
 	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/middlewares"
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/models/view"
@@ -15,23 +17,33 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	// time to enter the second factor after having entered valid credentials
+	totpPendingMaxAge = 5 * time.Minute
+	// time to confirm restoring an account pending deletion after having logged in
+	restorePendingMaxAge = 5 * time.Minute
+)
+
 type LoginHandler struct {
 	config       *conf.Config
 	userSrvc     services.IUserService
 	mailSrvc     services.IMailService
 	keyValueSrvc services.IKeyValueService
+	totpSrvc     services.ITotpService
 }
 
-func NewLoginHandler(userService services.IUserService, mailService services.IMailService, keyValueService services.IKeyValueService) *LoginHandler {
+func NewLoginHandler(userService services.IUserService, mailService services.IMailService, keyValueService services.IKeyValueService, totpService services.ITotpService) *LoginHandler {
 	return &LoginHandler{
 		config:       conf.Get(),
 		userSrvc:     userService,
 		mailSrvc:     mailService,
 		keyValueSrvc: keyValueService,
+		totpSrvc:     totpService,
 	}
 }
 
@@ -40,12 +52,19 @@ func (h *LoginHandler) RegisterRoutes(router chi.Router) {
 	router.
 		With(httprate.LimitByRealIP(h.config.Security.GetLoginMaxRate())).
 		Post("/login", h.PostLogin)
+	router.Get("/login/2fa", h.GetTotp)
+	router.
+		With(httprate.LimitByRealIP(h.config.Security.GetLoginMaxRate())).
+		Post("/login/2fa", h.PostTotp)
+	router.Get("/login/restore", h.GetRestore)
+	router.Post("/login/restore", h.PostRestore)
 	router.Get("/signup", h.GetSignup)
 	router.
 		With(httprate.LimitByRealIP(h.config.Security.GetSignupMaxRate())).
 		Post("/signup", h.PostSignup)
 	router.Get("/set-password", h.GetSetPassword)
 	router.Post("/set-password", h.PostSetPassword)
+	router.Post("/impersonation/end", h.PostEndImpersonation)
 	router.Get("/reset-password", h.GetResetPassword)
 	router.
 		With(httprate.LimitByRealIP(h.config.Security.GetPasswordResetMaxRate())).
@@ -110,7 +129,189 @@ func (h *LoginHandler) PostLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	encoded, err := h.config.Security.SecureCookie.Encode(models.AuthCookieKey, login.Username)
+	if upgraded, err := h.userSrvc.UpgradePasswordHash(user, login.Password); err != nil {
+		conf.Log().Request(r).Warn("failed to upgrade password hash", "userID", user.ID, "error", err)
+	} else if upgraded {
+		slog.Info("upgraded password hash", "userID", user.ID)
+	}
+
+	if user.TotpEnabled {
+		// credentials are valid, but login is only completed after entering the second factor
+		pending, err := h.config.Security.SecureCookie.Encode(models.TotpPendingCookieKey, fmt.Sprintf("%s:%d", user.ID, time.Now().Add(totpPendingMaxAge).Unix()))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			conf.Log().Request(r).Error("failed to encode secure cookie", "error", err)
+			templates[conf.LoginTemplate].Execute(w, h.buildViewModel(r, w, false).WithError("internal server error"))
+			return
+		}
+		http.SetCookie(w, h.config.CreateCookie(models.TotpPendingCookieKey, pending))
+		http.Redirect(w, r, fmt.Sprintf("%s/login/2fa", h.config.Server.BasePath), http.StatusFound)
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+func (h *LoginHandler) GetTotp(w http.ResponseWriter, r *http.Request) {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	if _, err := h.getTotpPendingUser(r); err != nil {
+		http.Redirect(w, r, fmt.Sprintf("%s/login", h.config.Server.BasePath), http.StatusFound)
+		return
+	}
+
+	templates[conf.LoginTotpTemplate].Execute(w, h.buildViewModel(r, w, false))
+}
+
+func (h *LoginHandler) PostTotp(w http.ResponseWriter, r *http.Request) {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user, err := h.getTotpPendingUser(r)
+	if err != nil {
+		routeutils.SetError(r, w, "login expired, please try again")
+		http.Redirect(w, r, fmt.Sprintf("%s/login", h.config.Server.BasePath), http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		templates[conf.LoginTotpTemplate].Execute(w, h.buildViewModel(r, w, false).WithError("missing parameters"))
+		return
+	}
+
+	if ok, err := h.totpSrvc.Verify(user, r.PostForm.Get("code")); err != nil || !ok {
+		if err != nil {
+			conf.Log().Request(r).Error("failed to verify totp code", "userID", user.ID, "error", err)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		templates[conf.LoginTotpTemplate].Execute(w, h.buildViewModel(r, w, false).WithError("invalid code"))
+		return
+	}
+
+	http.SetCookie(w, h.config.GetClearCookie(models.TotpPendingCookieKey))
+	h.completeLogin(w, r, user)
+}
+
+func (h *LoginHandler) GetRestore(w http.ResponseWriter, r *http.Request) {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user, err := h.getRestorePendingUser(r)
+	if err != nil {
+		http.Redirect(w, r, fmt.Sprintf("%s/login", h.config.Server.BasePath), http.StatusFound)
+		return
+	}
+
+	templates[conf.LoginRestoreTemplate].Execute(w, &view.RestoreAccountViewModel{
+		LoginViewModel: *h.buildViewModel(r, w, false),
+		DeletionDue:    user.HardDeletionDue().Format(conf.SimpleDateFormat),
+	})
+}
+
+// PostRestore cancels the pending deletion of the user's account after they explicitly confirmed to do so and completes their login
+func (h *LoginHandler) PostRestore(w http.ResponseWriter, r *http.Request) {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user, err := h.getRestorePendingUser(r)
+	if err != nil {
+		routeutils.SetError(r, w, "login expired, please try again")
+		http.Redirect(w, r, fmt.Sprintf("%s/login", h.config.Server.BasePath), http.StatusFound)
+		return
+	}
+
+	if _, err := h.userSrvc.Restore(user); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		conf.Log().Request(r).Error("failed to restore user", "userID", user.ID, "error", err)
+		templates[conf.LoginTemplate].Execute(w, h.buildViewModel(r, w, false).WithError("internal server error"))
+		return
+	}
+	slog.Info("restored user pending deletion", "userID", user.ID)
+
+	http.SetCookie(w, h.config.GetClearCookie(models.RestorePendingCookieKey))
+	routeutils.SetSuccess(r, w, "Welcome back! Your account was restored and won't be deleted.")
+	h.completeLogin(w, r, user)
+}
+
+func (h *LoginHandler) getTotpPendingUser(r *http.Request) (*models.User, error) {
+	user, err := h.getPendingUser(r, models.TotpPendingCookieKey)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TotpEnabled {
+		return nil, errors.New("two-factor authentication not enabled")
+	}
+	return user, nil
+}
+
+func (h *LoginHandler) getRestorePendingUser(r *http.Request) (*models.User, error) {
+	user, err := h.getPendingUser(r, models.RestorePendingCookieKey)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsSoftDeleted() {
+		return nil, errors.New("user is not pending deletion")
+	}
+	return user, nil
+}
+
+// getPendingUser returns the user of a login, which was started with valid credentials, but still awaits another step, as stored in the given cookie
+func (h *LoginHandler) getPendingUser(r *http.Request, cookieKey string) (*models.User, error) {
+	cookie, err := r.Cookie(cookieKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var value string
+	if err := h.config.Security.SecureCookie.Decode(cookieKey, cookie.Value, &value); err != nil {
+		return nil, err
+	}
+
+	// username may contain colons itself
+	sep := strings.LastIndex(value, ":")
+	if sep < 0 {
+		return nil, errors.New("invalid pending login")
+	}
+	expiresAt, err := strconv.ParseInt(value[sep+1:], 10, 64)
+	if err != nil || time.Now().After(time.Unix(expiresAt, 0)) {
+		return nil, errors.New("pending login expired")
+	}
+
+	return h.userSrvc.GetUserById(value[:sep])
+}
+
+func (h *LoginHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if user.IsSoftDeleted() {
+		// logging in within the grace period only cancels a pending account deletion once the user confirmed to do so
+		pending, err := h.config.Security.SecureCookie.Encode(models.RestorePendingCookieKey, fmt.Sprintf("%s:%d", user.ID, time.Now().Add(restorePendingMaxAge).Unix()))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			conf.Log().Request(r).Error("failed to encode secure cookie", "error", err)
+			templates[conf.LoginTemplate].Execute(w, h.buildViewModel(r, w, false).WithError("internal server error"))
+			return
+		}
+		http.SetCookie(w, h.config.CreateCookie(models.RestorePendingCookieKey, pending))
+		http.Redirect(w, r, fmt.Sprintf("%s/login/restore", h.config.Server.BasePath), http.StatusFound)
+		return
+	}
+
+	persisted, err := h.userSrvc.CreateSession(user, r.UserAgent(), middlewares.ClientIP(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		conf.Log().Request(r).Error("failed to create session", "userID", user.ID, "error", err)
+		templates[conf.LoginTemplate].Execute(w, h.buildViewModel(r, w, false).WithError("internal server error"))
+		return
+	}
+
+	session := models.NewSession(user)
+	session.ID = persisted.ID
+	encoded, err := h.config.Security.SecureCookie.Encode(models.AuthCookieKey, session)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		conf.Log().Request(r).Error("failed to encode secure cookie", "error", err)
@@ -133,10 +334,28 @@ func (h *LoginHandler) PostLogout(w http.ResponseWriter, r *http.Request) {
 	if user := middlewares.GetPrincipal(r); user != nil {
 		h.userSrvc.FlushUserCache(user.ID)
 	}
+	if session, err := helpers.ExtractCookieAuth(r, h.config); err == nil && session.ID != "" {
+		// the principal might be an impersonated user, so the session's owner is looked up
+		if user, err := h.userSrvc.GetUserById(session.UserID); err == nil {
+			if err := h.userSrvc.RevokeSession(user, session.ID); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+				conf.Log().Request(r).Error("failed to revoke session on logout", "userID", user.ID, "error", err)
+			}
+		}
+	}
 	http.SetCookie(w, h.config.GetClearCookie(models.AuthCookieKey))
+	http.SetCookie(w, h.config.GetClearCookie(models.ImpersonationCookieKey))
 	http.Redirect(w, r, fmt.Sprintf("%s/", h.config.Server.BasePath), http.StatusFound)
 }
 
+// PostEndImpersonation returns an admin from impersonating another user to their own account
+func (h *LoginHandler) PostEndImpersonation(w http.ResponseWriter, r *http.Request) {
+	if impersonation, err := helpers.ExtractImpersonation(r, h.config); err == nil {
+		conf.Log().Request(r).Info("admin stopped impersonating user", "adminID", impersonation.AdminID, "userID", impersonation.UserID)
+	}
+	http.SetCookie(w, h.config.GetClearCookie(models.ImpersonationCookieKey))
+	http.Redirect(w, r, fmt.Sprintf("%s/summary", h.config.Server.BasePath), http.StatusFound)
+}
+
 func (h *LoginHandler) GetSignup(w http.ResponseWriter, r *http.Request) {
 	if h.config.IsDev() {
 		loadTemplates()
@@ -178,14 +397,18 @@ func (h *LoginHandler) PostSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var invitedBy string
+	var invitedBy, invitedToOrg string
 	var invitedDate time.Time
 	var inviteCodeKey = fmt.Sprintf("%s_%s", conf.KeyInviteCode, signup.InviteCode)
 
 	if kv, _ := h.keyValueSrvc.GetString(inviteCodeKey); kv != nil && kv.Value != "" {
-		if parts := strings.Split(kv.Value, ","); len(parts) == 2 {
+		// invites generated by org admins are pinned to their org
+		if parts := strings.Split(kv.Value, ","); len(parts) == 2 || len(parts) == 3 {
 			invitedBy = parts[0]
 			invitedDate, _ = time.Parse(time.RFC3339, parts[1])
+			if len(parts) == 3 && h.config.App.OrgsEnabled {
+				invitedToOrg = parts[2]
+			}
 		}
 
 		if err := h.keyValueSrvc.DeleteString(inviteCodeKey); err != nil {
@@ -200,6 +423,13 @@ func (h *LoginHandler) PostSignup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	signup.InvitedBy = invitedBy
+	signup.OrgID = invitedToOrg
+
+	if err := models.ValidatePasswordPolicy(signup.Password); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		templates[conf.SignupTemplate].Execute(w, h.buildViewModel(r, w, h.config.Security.SignupCaptcha).WithError(err.Error()))
+		return
+	}
 
 	if !signup.IsValid() {
 		w.WriteHeader(http.StatusBadRequest)
@@ -207,9 +437,22 @@ func (h *LoginHandler) PostSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if signup.Email != "" {
+		if existing, err := h.userSrvc.GetUserByEmail(signup.Email); err == nil && existing.IsSoftDeleted() {
+			w.WriteHeader(http.StatusConflict)
+			templates[conf.SignupTemplate].Execute(w, h.buildViewModel(r, w, h.config.Security.SignupCaptcha).WithError("e-mail address is still in use by an account pending deletion"))
+			return
+		}
+	}
+
 	numUsers, _ := h.userSrvc.Count()
 
 	_, created, err := h.userSrvc.CreateOrGet(&signup, numUsers == 0)
+	if errors.Is(err, services.ErrUsernameTaken) {
+		w.WriteHeader(http.StatusConflict)
+		templates[conf.SignupTemplate].Execute(w, h.buildViewModel(r, w, h.config.Security.SignupCaptcha).WithError("username already taken (usernames are compared case-insensitively)"))
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		conf.Log().Request(r).Error("failed to create new user", "error", err)
@@ -278,6 +521,12 @@ func (h *LoginHandler) PostSetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := models.ValidatePasswordPolicy(setRequest.Password); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		templates[conf.SetPasswordTemplate].Execute(w, h.buildViewModel(r, w, false).WithError(err.Error()))
+		return
+	}
+
 	if !setRequest.IsValid() {
 		w.WriteHeader(http.StatusBadRequest)
 		templates[conf.SetPasswordTemplate].Execute(w, h.buildViewModel(r, w, false).WithError("invalid parameters"))
@@ -286,7 +535,7 @@ func (h *LoginHandler) PostSetPassword(w http.ResponseWriter, r *http.Request) {
 
 	user.Password = setRequest.Password
 	user.ResetToken = ""
-	if hash, err := utils.HashPassword(user.Password, h.config.Security.PasswordSalt); err != nil {
+	if hash, err := utils.HashPassword(user.Password, h.config.Security.PasswordSalt, h.config.Security.GetPasswordHashOptions()); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		conf.Log().Request(r).Error("failed to set new password", "error", err)
 		templates[conf.SetPasswordTemplate].Execute(w, h.buildViewModel(r, w, false).WithError("failed to set new password"))
@@ -337,7 +586,7 @@ func (h *LoginHandler) PostResetPassword(w http.ResponseWriter, r *http.Request)
 			return
 		} else {
 			go func(user *models.User) {
-				link := fmt.Sprintf("%s/set-password?token=%s", h.config.Server.GetPublicUrl(), user.ResetToken)
+				link := fmt.Sprintf("%s/set-password?token=%s", h.config.Server.GetBaseUrl(), user.ResetToken)
 				if err := h.mailSrvc.SendPasswordReset(user, link); err != nil {
 					conf.Log().Request(r).Error("failed to send password reset mail", "userID", user.ID, "error", err)
 				} else {
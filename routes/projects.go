@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"fmt"
+
 	"github.com/go-chi/chi/v5"
 	conf "github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/middlewares"
@@ -14,16 +16,18 @@ import (
 )
 
 type ProjectsHandler struct {
-	config           *conf.Config
-	userService      services.IUserService
-	heartbeatService services.IHeartbeatService
+	config                *conf.Config
+	userService           services.IUserService
+	heartbeatService      services.IHeartbeatService
+	projectArchiveService services.IProjectArchiveService
 }
 
-func NewProjectsHandler(userService services.IUserService, heartbeatService services.IHeartbeatService) *ProjectsHandler {
+func NewProjectsHandler(userService services.IUserService, heartbeatService services.IHeartbeatService, projectArchiveService services.IProjectArchiveService) *ProjectsHandler {
 	return &ProjectsHandler{
-		config:           conf.Get(),
-		userService:      userService,
-		heartbeatService: heartbeatService,
+		config:                conf.Get(),
+		userService:           userService,
+		heartbeatService:      heartbeatService,
+		projectArchiveService: projectArchiveService,
 	}
 }
 
@@ -35,6 +39,7 @@ func (h *ProjectsHandler) RegisterRoutes(router chi.Router) {
 			WithRedirectErrorMessage("unauthorized").Handler,
 	)
 	r.Get("/", h.GetIndex)
+	r.Post("/", h.PostIndex)
 
 	router.Mount("/projects", r)
 }
@@ -48,6 +53,44 @@ func (h *ProjectsHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *ProjectsHandler) PostIndex(w http.ResponseWriter, r *http.Request) {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("project") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		templates[conf.ProjectsTemplate].Execute(w, h.buildViewModel(r, w).WithError("missing form values"))
+		return
+	}
+
+	project := r.PostForm.Get("project")
+
+	var err error
+	var msg string
+	switch r.PostForm.Get("action") {
+	case "archive":
+		err, msg = h.projectArchiveService.Archive(user, project), fmt.Sprintf("Project '%s' archived.", project)
+	case "unarchive":
+		err, msg = h.projectArchiveService.Unarchive(user, project), fmt.Sprintf("Project '%s' restored from archive.", project)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		templates[conf.ProjectsTemplate].Execute(w, h.buildViewModel(r, w).WithError("unknown action"))
+		return
+	}
+
+	if err != nil {
+		conf.Log().Request(r).Error("failed to update project archive state", "userID", user.ID, "project", project, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		templates[conf.ProjectsTemplate].Execute(w, h.buildViewModel(r, w).WithError(criticalError))
+		return
+	}
+
+	routeutils.SetSuccess(r, w, msg)
+	http.Redirect(w, r, fmt.Sprintf("%s/projects?%s", h.config.Server.BasePath, r.URL.RawQuery), http.StatusFound)
+}
+
 func (h *ProjectsHandler) buildViewModel(r *http.Request, w http.ResponseWriter) *view.ProjectsViewModel {
 	user := middlewares.GetPrincipal(r)
 	if user == nil { // this should actually never occur, because of auth middleware
@@ -62,8 +105,18 @@ func (h *ProjectsHandler) buildViewModel(r *http.Request, w http.ResponseWriter)
 
 	var err error
 	var projects []*models.ProjectStats
+	var archived map[string]bool
+
+	includeArchived := r.URL.Query().Get("includeArchived") == "true"
 
-	projects, err = h.heartbeatService.GetUserProjectStats(user, time.Time{}, utils.BeginOfToday(time.Local), pageParams, false)
+	// fetch all projects and paginate afterwards, because archived ones are filtered out
+	projects, err = h.heartbeatService.GetUserProjectStats(user, time.Time{}, utils.BeginOfToday(time.Local), nil, false)
+	if err == nil {
+		archived, err = h.projectArchiveService.GetArchived(user.ID)
+	}
+	if err == nil && !includeArchived {
+		projects, err = h.projectArchiveService.FilterProjectStats(user, projects)
+	}
 	if err != nil {
 		conf.Log().Request(r).Error("error while fetching project stats", "userID", user.ID, "error", err)
 		return &view.ProjectsViewModel{
@@ -81,8 +134,17 @@ func (h *ProjectsHandler) buildViewModel(r *http.Request, w http.ResponseWriter)
 			User:            user,
 			ApiKey:          user.ApiKey,
 		},
-		Projects:   projects,
-		PageParams: pageParams,
+		Projects:         paginateProjects(projects, pageParams),
+		PageParams:       pageParams,
+		ArchivedProjects: archived,
+		IncludeArchived:  includeArchived,
 	}
 	return routeutils.WithSessionMessages(vm, r, w)
 }
+
+func paginateProjects(projects []*models.ProjectStats, pageParams *utils.PageParams) []*models.ProjectStats {
+	if pageParams.Offset() >= len(projects) {
+		return []*models.ProjectStats{}
+	}
+	return utils.SubSlice[*models.ProjectStats](projects, uint(pageParams.Offset()), uint(pageParams.Offset()+pageParams.Limit()))
+}
@@ -2,19 +2,24 @@ package routes
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/duke-git/lancet/v2/condition"
 	"github.com/go-chi/chi/v5"
 	"github.com/gofrs/uuid/v5"
+	"io"
 	"net/http"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	datastructure "github.com/duke-git/lancet/v2/datastructure/set"
 	"github.com/gorilla/schema"
 	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/middlewares"
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/models/view"
@@ -27,6 +32,12 @@ import (
 
 const criticalError = "a critical error has occurred, sorry"
 
+// max. size of uploaded import files
+const maxImportFileSize = 64 << 20 // 64 MB
+
+// number of imported heartbeats after which to log the import's progress
+const importProgressInterval = 10000
+
 type SettingsHandler struct {
 	config              *conf.Config
 	userSrvc            services.IUserService
@@ -36,10 +47,16 @@ type SettingsHandler struct {
 	aggregationSrvc     services.IAggregationService
 	languageMappingSrvc services.ILanguageMappingService
 	projectLabelSrvc    services.IProjectLabelService
+	defaultBranchSrvc   services.IProjectDefaultBranchService
 	keyValueSrvc        services.IKeyValueService
 	mailSrvc            services.IMailService
+	exportSrvc          services.IExportService
+	totpSrvc            services.ITotpService
+	importSnapshotSrvc  services.IImportSnapshotService
+	aliasRecomputeSrvc  services.IAliasRecomputeService
 	httpClient          *http.Client
 	aggregationLocks    map[string]bool
+	importLocks         sync.Map
 }
 
 type action func(w http.ResponseWriter, r *http.Request) actionResult
@@ -51,7 +68,12 @@ type actionResult struct {
 	values  *map[string]interface{}
 }
 
-const valueInviteCode = "invite_code"
+const (
+	valueInviteCode    = "invite_code"
+	valueTotpSecret    = "totp_secret"
+	valueTotpUri       = "totp_uri"
+	valueRecoveryCodes = "recovery_codes"
+)
 
 var credentialsDecoder = schema.NewDecoder()
 
@@ -63,8 +85,13 @@ func NewSettingsHandler(
 	aggregationService services.IAggregationService,
 	languageMappingService services.ILanguageMappingService,
 	projectLabelService services.IProjectLabelService,
+	defaultBranchService services.IProjectDefaultBranchService,
 	keyValueService services.IKeyValueService,
 	mailService services.IMailService,
+	exportService services.IExportService,
+	totpService services.ITotpService,
+	importSnapshotService services.IImportSnapshotService,
+	aliasRecomputeService services.IAliasRecomputeService,
 ) *SettingsHandler {
 	return &SettingsHandler{
 		config:              conf.Get(),
@@ -73,10 +100,15 @@ func NewSettingsHandler(
 		aggregationSrvc:     aggregationService,
 		languageMappingSrvc: languageMappingService,
 		projectLabelSrvc:    projectLabelService,
+		defaultBranchSrvc:   defaultBranchService,
 		userSrvc:            userService,
 		heartbeatSrvc:       heartbeatService,
 		keyValueSrvc:        keyValueService,
 		mailSrvc:            mailService,
+		exportSrvc:          exportService,
+		totpSrvc:            totpService,
+		importSnapshotSrvc:  importSnapshotService,
+		aliasRecomputeSrvc:  aliasRecomputeService,
 		httpClient:          &http.Client{Timeout: 10 * time.Second},
 		aggregationLocks:    make(map[string]bool),
 	}
@@ -107,7 +139,15 @@ func (h *SettingsHandler) PostIndex(w http.ResponseWriter, r *http.Request) {
 		loadTemplates()
 	}
 
-	if err := r.ParseForm(); err != nil {
+	var parseErr error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		// files exceeding the in-memory limit would be buffered on disk otherwise, without any limit
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportFileSize)
+		parseErr = r.ParseMultipartForm(maxImportFileSize)
+	} else {
+		parseErr = r.ParseForm()
+	}
+	if parseErr != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		templates[conf.SettingsTemplate].Execute(w, h.buildViewModel(r, w, nil).WithError("missing form values"))
 		return
@@ -152,6 +192,20 @@ func (h *SettingsHandler) dispatchAction(action string) action {
 		return h.actionUpdateUser
 	case "reset_apikey":
 		return h.actionResetApiKey
+	case "reset_metrics_token":
+		return h.actionResetMetricsToken
+	case "revoke_metrics_token":
+		return h.actionRevokeMetricsToken
+	case "logout_all_sessions":
+		return h.actionLogoutAllSessions
+	case "totp_setup":
+		return h.actionTotpSetup
+	case "totp_enable":
+		return h.actionTotpEnable
+	case "totp_disable":
+		return h.actionTotpDisable
+	case "totp_regenerate_codes":
+		return h.actionTotpRegenerateCodes
 	case "delete_alias":
 		return h.actionDeleteAlias
 	case "add_alias":
@@ -160,6 +214,10 @@ func (h *SettingsHandler) dispatchAction(action string) action {
 		return h.actionAddLabel
 	case "delete_label":
 		return h.actionDeleteLabel
+	case "add_default_branch":
+		return h.actionAddDefaultBranch
+	case "delete_default_branch":
+		return h.actionDeleteDefaultBranch
 	case "delete_mapping":
 		return h.actionDeleteLanguageMapping
 	case "add_mapping":
@@ -172,6 +230,10 @@ func (h *SettingsHandler) dispatchAction(action string) action {
 		return h.actionSetWakatimeApiKey
 	case "import_wakatime":
 		return h.actionImportWakatime
+	case "import_file", "import_wakatime_offline", "import_wakatime_export":
+		return h.actionImportFile
+	case "export_data":
+		return h.actionExportData
 	case "regenerate_summaries":
 		return h.actionRegenerateSummaries
 	case "clear_data":
@@ -182,8 +244,36 @@ func (h *SettingsHandler) dispatchAction(action string) action {
 		return h.actionGenerateInvite
 	case "update_unknown_projects":
 		return h.actionUpdateExcludeUnknownProjects
+	case "update_unknown_bucket":
+		return h.actionUpdateUnknownBucket
+	case "update_machine_overlap":
+		return h.actionUpdateMachineOverlap
+	case "update_server_timestamps":
+		return h.actionUpdateServerTimestamps
+	case "update_override_languages":
+		return h.actionUpdateOverrideLanguages
 	case "update_heartbeats_timeout":
 		return h.actionUpdateHeartbeatsTimeout
+	case "update_default_interval":
+		return h.actionUpdateDefaultInterval
+	case "update_daily_project_cap":
+		return h.actionUpdateDailyProjectCap
+	case "update_active_day_threshold":
+		return h.actionUpdateActiveDayThreshold
+	case "update_average_mode":
+		return h.actionUpdateAverageMode
+	case "update_auto_archive":
+		return h.actionUpdateAutoArchive
+	case "update_ignore_patterns":
+		return h.actionUpdateIgnorePatterns
+	case "update_range_presets":
+		return h.actionUpdateRangePresets
+	case "update_project_normalization":
+		return h.actionUpdateProjectNormalization
+	case "update_entity_normalization":
+		return h.actionUpdateEntityNormalization
+	case "update_project_derivation":
+		return h.actionUpdateProjectDerivation
 	}
 	return nil
 }
@@ -212,8 +302,12 @@ func (h *SettingsHandler) actionUpdateUser(w http.ResponseWriter, r *http.Reques
 	}
 
 	user.Email = payload.Email
+	user.LocationFixed = user.LocationFixed || payload.Location != user.Location // also when unset, so it's not inferred again
 	user.Location = payload.Location
 	user.ReportsWeekly = payload.ReportsWeekly
+	if h.config.App.InactivityReminderDays > 0 {
+		user.InactivityReminders = payload.InactivityReminders
+	}
 	user.PublicLeaderboard = payload.PublicLeaderboard
 
 	if _, err := h.userSrvc.Update(user); err != nil {
@@ -242,121 +336,576 @@ func (h *SettingsHandler) actionChangePassword(w http.ResponseWriter, r *http.Re
 		return actionResult{http.StatusUnauthorized, "", "invalid credentials", nil}
 	}
 
+	if err := models.ValidatePasswordPolicy(credentials.PasswordNew); err != nil {
+		return actionResult{http.StatusBadRequest, "", err.Error(), nil}
+	}
+
 	if !credentials.IsValid() {
 		return actionResult{http.StatusBadRequest, "", "invalid parameters", nil}
 	}
 
 	user.Password = credentials.PasswordNew
-	if hash, err := utils.HashPassword(user.Password, h.config.Security.PasswordSalt); err != nil {
+	if hash, err := utils.HashPassword(user.Password, h.config.Security.PasswordSalt, h.config.Security.GetPasswordHashOptions()); err != nil {
 		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
 	} else {
 		user.Password = hash
 	}
 
 	if _, err := h.userSrvc.Update(user); err != nil {
-		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	// re-issue the current session as a persisted one, like upon login, so that it's listed and can be revoked
+	persisted, err := h.userSrvc.CreateSession(user, r.UserAgent(), middlewares.ClientIP(r))
+	if err != nil {
+		conf.Log().Request(r).Error("failed to create session", "userID", user.ID, "error", err)
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	session := models.NewSession(user)
+	session.ID = persisted.ID
+	encoded, err := h.config.Security.SecureCookie.Encode(models.AuthCookieKey, session)
+	if err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	if current, err := helpers.ExtractCookieAuth(r, h.config); err == nil && current.ID != "" {
+		if err := h.userSrvc.RevokeSession(user, current.ID); err != nil {
+			conf.Log().Request(r).Warn("failed to revoke replaced session", "userID", user.ID, "error", err)
+		}
+	}
+
+	http.SetCookie(w, h.config.CreateCookie(models.AuthCookieKey, encoded))
+	return actionResult{http.StatusOK, "password was updated successfully", "", nil}
+}
+
+func (h *SettingsHandler) actionResetApiKey(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	if _, err := h.userSrvc.ResetApiKey(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	msg := fmt.Sprintf("your new api key is: %s", user.ApiKey)
+	return actionResult{http.StatusOK, msg, "", nil}
+}
+
+func (h *SettingsHandler) actionResetMetricsToken(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	if _, err := h.userSrvc.ResetMetricsToken(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	msg := fmt.Sprintf("your new metrics token is: %s", user.MetricsToken)
+	return actionResult{http.StatusOK, msg, "", nil}
+}
+
+func (h *SettingsHandler) actionRevokeMetricsToken(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	if _, err := h.userSrvc.RevokeMetricsToken(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	return actionResult{http.StatusOK, "metrics token revoked", "", nil}
+}
+
+// actionLogoutAllSessions invalidates all of the user's login sessions, including the current one, while api keys stay valid
+func (h *SettingsHandler) actionLogoutAllSessions(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	if err := h.userSrvc.RevokeSessions(user, ""); err != nil {
+		conf.Log().Request(r).Error("failed to revoke sessions", "userID", user.ID, "error", err)
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+	slog.Info("user logged out all sessions", "userID", user.ID)
+
+	routeutils.SetSuccess(r, w, "You were logged out on all devices.")
+	http.SetCookie(w, h.config.GetClearCookie(models.AuthCookieKey))
+	http.Redirect(w, r, fmt.Sprintf("%s/login", h.config.Server.BasePath), http.StatusFound)
+	return actionResult{-1, "", "", nil}
+}
+
+func (h *SettingsHandler) actionTotpSetup(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	secret, uri, err := h.totpSrvc.Setup(user)
+	if err != nil {
+		if errors.Is(err, services.ErrTotpAlreadyEnabled) {
+			return actionResult{http.StatusBadRequest, "", err.Error(), nil}
+		}
+		conf.Log().Request(r).Error("failed to set up totp", "userID", user.ID, "error", err)
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	return actionResult{http.StatusOK, "", "", &map[string]interface{}{
+		valueTotpSecret: secret,
+		valueTotpUri:    uri,
+	}}
+}
+
+func (h *SettingsHandler) actionTotpEnable(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	codes, err := h.totpSrvc.Enable(user, r.PostFormValue("code"))
+	if err != nil {
+		return h.totpActionError(r, user, err)
+	}
+
+	return actionResult{http.StatusOK, "Two-factor authentication enabled. Please store your recovery codes in a safe place.", "", &map[string]interface{}{
+		valueRecoveryCodes: codes,
+	}}
+}
+
+func (h *SettingsHandler) actionTotpDisable(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	if err := h.totpSrvc.Disable(user, r.PostFormValue("code")); err != nil {
+		return h.totpActionError(r, user, err)
+	}
+
+	return actionResult{http.StatusOK, "Two-factor authentication disabled.", "", nil}
+}
+
+func (h *SettingsHandler) actionTotpRegenerateCodes(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	codes, err := h.totpSrvc.RegenerateRecoveryCodes(user, r.PostFormValue("code"))
+	if err != nil {
+		return h.totpActionError(r, user, err)
+	}
+
+	return actionResult{http.StatusOK, "New recovery codes generated, previous ones are no longer valid.", "", &map[string]interface{}{
+		valueRecoveryCodes: codes,
+	}}
+}
+
+func (h *SettingsHandler) totpActionError(r *http.Request, user *models.User, err error) actionResult {
+	switch {
+	case errors.Is(err, services.ErrTotpInvalidCode):
+		return actionResult{http.StatusUnauthorized, "", err.Error(), nil}
+	case errors.Is(err, services.ErrTotpNotSetUp), errors.Is(err, services.ErrTotpAlreadyEnabled), errors.Is(err, services.ErrTotpNotEnabled):
+		return actionResult{http.StatusBadRequest, "", err.Error(), nil}
+	}
+	conf.Log().Request(r).Error("failed to update two-factor authentication", "userID", user.ID, "error", err)
+	return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+}
+
+func (h *SettingsHandler) actionUpdateLeaderboard(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	var err error
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	user.PublicLeaderboard, err = strconv.ParseBool(r.PostFormValue("enable_leaderboard"))
+
+	if err != nil {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
+	}
+	return actionResult{http.StatusOK, "settings updated", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateExcludeUnknownProjects(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	var err error
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	if h.isAggregationLocked(user.ID) {
+		return actionResult{http.StatusConflict, "", "summary regeneration already in progress, please wait", nil}
+	}
+
+	user.ExcludeUnknownProjects, err = strconv.ParseBool(r.PostFormValue("exclude_unknown_projects"))
+
+	if err != nil {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
+	}
+
+	go func(user *models.User) {
+		h.toggleAggregationLock(user.ID, true)
+		defer h.toggleAggregationLock(user.ID, false)
+		if err := h.regenerateSummaries(user); err != nil {
+			conf.Log().Request(r).Error("failed to regenerate summaries for user", "userID", user.ID, "error", err)
+		}
+	}(user)
+
+	return actionResult{http.StatusOK, "regenerating summaries, this might take a while", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateUnknownBucket(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	mode := r.PostFormValue("unknown_bucket")
+	if mode != models.UnknownBucketShow && mode != models.UnknownBucketHide {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	user.UnknownBucket = mode
+
+	// only applied when displaying summaries, so no need to regenerate them
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	return actionResult{http.StatusOK, "settings updated", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateMachineOverlap(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	if h.isAggregationLocked(user.ID) {
+		return actionResult{http.StatusConflict, "", "summary regeneration already in progress, please wait", nil}
+	}
+
+	mode := r.PostFormValue("machine_overlap_mode")
+	if mode != models.MachineOverlapMerge && mode != models.MachineOverlapAdditive {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	if (mode == models.MachineOverlapAdditive) == user.CountsMachinesAdditively() {
+		return actionResult{http.StatusOK, "settings updated", "", nil} // nothing changed, no need to regenerate summaries
+	}
+	user.MachineOverlapMode = mode
+
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	go func(user *models.User) {
+		h.toggleAggregationLock(user.ID, true)
+		defer h.toggleAggregationLock(user.ID, false)
+		if err := h.regenerateSummaries(user); err != nil {
+			conf.Log().Request(r).Error("failed to regenerate summaries for user", "userID", user.ID, "error", err)
+		}
+	}(user)
+
+	return actionResult{http.StatusOK, "regenerating summaries, this might take a while", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateHeartbeatsTimeout(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	var err error
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	val, err := strconv.ParseInt(r.PostFormValue("heartbeats_timeout"), 0, 0)
+	if dur := time.Duration(val) * time.Second; err != nil || dur < models.MinHeartbeatsTimeout || dur > models.MaxHeartbeatsTimeout {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	user.HeartbeatsTimeoutSec = int(val)
+
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
+	}
+
+	return actionResult{http.StatusOK, "Done. To apply this change to already existing data, please regenerate your summaries.", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateServerTimestamps(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	var err error
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	if user.ServerTimestamps, err = strconv.ParseBool(r.PostFormValue("server_timestamps")); err != nil {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
+	}
+
+	return actionResult{http.StatusOK, "Done. This only affects heartbeats received from now on.", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateOverrideLanguages(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	var err error
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	if user.OverrideLanguages, err = strconv.ParseBool(r.PostFormValue("override_languages")); err != nil {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
+	}
+
+	return actionResult{http.StatusOK, "Done. This only affects heartbeats received from now on.", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateAutoArchive(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	val, err := strconv.Atoi(r.PostFormValue("auto_archive_days"))
+	if err != nil || val < 0 || val > models.MaxAutoArchiveDays {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	user.AutoArchiveDays = val
+
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	if val == 0 {
+		return actionResult{http.StatusOK, "Auto-archiving disabled. Already archived projects stay archived.", "", nil}
+	}
+	return actionResult{http.StatusOK, fmt.Sprintf("Done. Projects without activity for %d days will be archived on the next daily run.", val), "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateActiveDayThreshold(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	val, err := strconv.Atoi(r.PostFormValue("active_day_threshold"))
+	if dur := time.Duration(val) * time.Second; err != nil || val < 0 || dur > models.MaxActiveDayThreshold {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	user.ActiveDayThresholdSec = val
+
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	return actionResult{http.StatusOK, "Done. Totals shown in your summaries are not affected by this.", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateDailyProjectCap(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	val, err := strconv.Atoi(r.PostFormValue("daily_project_cap"))
+	if dur := time.Duration(val) * time.Hour; err != nil || val < 0 || dur > models.MaxDailyProjectCap {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	user.DailyProjectCapHours = val
+
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	return actionResult{http.StatusOK, "Done. To apply this change to already existing data, please regenerate your summaries.", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateAverageMode(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	mode := r.PostFormValue("average_mode")
+	if mode != models.AverageModeCalendar && mode != models.AverageModeActiveDays && mode != models.AverageModeSinceFirst {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	user.AverageMode = mode
+
+	// only applied when displaying summaries, so no need to regenerate them
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	return actionResult{http.StatusOK, "settings updated", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateDefaultInterval(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	interval := r.PostFormValue("default_interval")
+	if _, err := helpers.ParseInterval(interval); interval != "" && err != nil {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+	user.DefaultSummaryInterval = interval
+
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
 	}
 
-	login := &models.Login{
-		Username: user.ID,
-		Password: user.Password,
+	return actionResult{http.StatusOK, "settings updated", "", nil}
+}
+
+func (h *SettingsHandler) actionUpdateIgnorePatterns(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
 	}
-	encoded, err := h.config.Security.SecureCookie.Encode(models.AuthCookieKey, login.Username)
-	if err != nil {
-		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+
+	user := middlewares.GetPrincipal(r)
+	defer h.userSrvc.FlushCache()
+
+	patterns := strings.TrimSpace(strings.ReplaceAll(r.PostFormValue("ignore_patterns"), "\r\n", "\n"))
+	if _, err := models.ParseIgnorePatterns(patterns); err != nil {
+		return actionResult{http.StatusBadRequest, "", err.Error(), nil}
 	}
+	user.IgnorePatterns = patterns
 
-	http.SetCookie(w, h.config.CreateCookie(models.AuthCookieKey, encoded))
-	return actionResult{http.StatusOK, "password was updated successfully", "", nil}
+	if _, err := h.userSrvc.Update(user); err != nil {
+		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
+	}
+
+	return actionResult{http.StatusOK, "ignore patterns updated, will apply to all future heartbeats", "", nil}
 }
 
-func (h *SettingsHandler) actionResetApiKey(w http.ResponseWriter, r *http.Request) actionResult {
+func (h *SettingsHandler) actionUpdateRangePresets(w http.ResponseWriter, r *http.Request) actionResult {
 	if h.config.IsDev() {
 		loadTemplates()
 	}
 
 	user := middlewares.GetPrincipal(r)
-	if _, err := h.userSrvc.ResetApiKey(user); err != nil {
+	defer h.userSrvc.FlushCache()
+
+	presets := strings.TrimSpace(strings.ReplaceAll(r.PostFormValue("range_presets"), "\r\n", "\n"))
+	if _, err := models.ParseRangePresets(presets); err != nil {
+		return actionResult{http.StatusBadRequest, "", err.Error(), nil}
+	}
+	user.RangePresets = presets
+
+	if _, err := h.userSrvc.Update(user); err != nil {
 		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
 	}
 
-	msg := fmt.Sprintf("your new api key is: %s", user.ApiKey)
-	return actionResult{http.StatusOK, msg, "", nil}
+	return actionResult{http.StatusOK, "custom time ranges updated", "", nil}
 }
 
-func (h *SettingsHandler) actionUpdateLeaderboard(w http.ResponseWriter, r *http.Request) actionResult {
+func (h *SettingsHandler) actionUpdateProjectNormalization(w http.ResponseWriter, r *http.Request) actionResult {
 	if h.config.IsDev() {
 		loadTemplates()
 	}
 
-	var err error
 	user := middlewares.GetPrincipal(r)
 	defer h.userSrvc.FlushCache()
 
-	user.PublicLeaderboard, err = strconv.ParseBool(r.PostFormValue("enable_leaderboard"))
-
-	if err != nil {
-		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	prefix := r.PostFormValue("project_name_prefix")
+	if len(prefix) > models.MaxProjectStripPrefixLength {
+		return actionResult{http.StatusBadRequest, "", "prefix too long", nil}
 	}
+
+	user.ProjectNameTrim = r.PostFormValue("project_name_trim") == "true"
+	user.ProjectNameLowercase = r.PostFormValue("project_name_lowercase") == "true"
+	user.ProjectNamePrefix = prefix
+
 	if _, err := h.userSrvc.Update(user); err != nil {
 		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
 	}
-	return actionResult{http.StatusOK, "settings updated", "", nil}
+
+	return actionResult{http.StatusOK, "project name normalization updated, will apply to all future heartbeats", "", nil}
 }
 
-func (h *SettingsHandler) actionUpdateExcludeUnknownProjects(w http.ResponseWriter, r *http.Request) actionResult {
+func (h *SettingsHandler) actionUpdateEntityNormalization(w http.ResponseWriter, r *http.Request) actionResult {
 	if h.config.IsDev() {
 		loadTemplates()
 	}
 
-	var err error
 	user := middlewares.GetPrincipal(r)
 	defer h.userSrvc.FlushCache()
 
-	if h.isAggregationLocked(user.ID) {
-		return actionResult{http.StatusConflict, "", "summary regeneration already in progress, please wait", nil}
-	}
-
-	user.ExcludeUnknownProjects, err = strconv.ParseBool(r.PostFormValue("exclude_unknown_projects"))
+	user.EntityStripQuery = r.PostFormValue("entity_strip_query") == "true"
+	user.EntityStripHost = r.PostFormValue("entity_strip_host") == "true"
 
-	if err != nil {
-		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
-	}
 	if _, err := h.userSrvc.Update(user); err != nil {
 		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
 	}
 
-	go func(user *models.User) {
-		h.toggleAggregationLock(user.ID, true)
-		defer h.toggleAggregationLock(user.ID, false)
-		if err := h.regenerateSummaries(user); err != nil {
-			conf.Log().Request(r).Error("failed to regenerate summaries for user", "userID", user.ID, "error", err)
-		}
-	}(user)
-
-	return actionResult{http.StatusOK, "regenerating summaries, this might take a while", "", nil}
+	return actionResult{http.StatusOK, "file path normalization updated, will apply to all future heartbeats", "", nil}
 }
 
-func (h *SettingsHandler) actionUpdateHeartbeatsTimeout(w http.ResponseWriter, r *http.Request) actionResult {
+func (h *SettingsHandler) actionUpdateProjectDerivation(w http.ResponseWriter, r *http.Request) actionResult {
 	if h.config.IsDev() {
 		loadTemplates()
 	}
 
-	var err error
 	user := middlewares.GetPrincipal(r)
 	defer h.userSrvc.FlushCache()
 
-	val, err := strconv.ParseInt(r.PostFormValue("heartbeats_timeout"), 0, 0)
-	if dur := time.Duration(val) * time.Second; err != nil || dur < models.MinHeartbeatsTimeout || dur > models.MaxHeartbeatsTimeout {
-		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	root := strings.TrimSpace(r.PostFormValue("project_path_root"))
+	if len(root) > models.MaxProjectDerivationRootLength {
+		return actionResult{http.StatusBadRequest, "", "root path too long", nil}
 	}
-	user.HeartbeatsTimeoutSec = int(val)
+
+	segment, err := strconv.Atoi(r.PostFormValue("project_path_segment"))
+	if err != nil || segment < 1 || segment > 10 {
+		return actionResult{http.StatusBadRequest, "", "invalid folder level, must be between 1 and 10", nil}
+	}
+
+	user.ProjectPathRoot = root
+	user.ProjectPathSegment = segment
 
 	if _, err := h.userSrvc.Update(user); err != nil {
 		return actionResult{http.StatusInternalServerError, "", "internal sever error", nil}
 	}
 
-	return actionResult{http.StatusOK, "Done. To apply this change to already existing data, please regenerate your summaries.", "", nil}
+	return actionResult{http.StatusOK, "project detection updated, will apply to all future heartbeats", "", nil}
 }
 
 func (h *SettingsHandler) actionUpdateSharing(w http.ResponseWriter, r *http.Request) actionResult {
@@ -375,6 +924,10 @@ func (h *SettingsHandler) actionUpdateSharing(w http.ResponseWriter, r *http.Req
 	user.ShareOSs, err = strconv.ParseBool(r.PostFormValue("share_oss"))
 	user.ShareMachines, err = strconv.ParseBool(r.PostFormValue("share_machines"))
 	user.ShareLabels, err = strconv.ParseBool(r.PostFormValue("share_labels"))
+	user.AnonymizeProjects, err = strconv.ParseBool(r.PostFormValue("anonymize_projects"))
+	user.AnonymizeLanguages, err = strconv.ParseBool(r.PostFormValue("anonymize_languages"))
+	user.AnonymizeEditors, err = strconv.ParseBool(r.PostFormValue("anonymize_editors"))
+	user.NewProjectsPrivate, err = strconv.ParseBool(r.PostFormValue("new_projects_private"))
 	user.ShareDataMaxDays, err = strconv.Atoi(r.PostFormValue("max_days"))
 
 	if err != nil {
@@ -428,11 +981,24 @@ func (h *SettingsHandler) actionAddAlias(w http.ResponseWriter, r *http.Request)
 		Type:   uint8(aliasType),
 	}
 
-	if _, err := h.aliasSrvc.Create(alias); err != nil {
+	if _, err := h.aliasSrvc.Create(alias); errors.Is(err, services.ErrAliasLimitExceeded) || errors.Is(err, services.ErrAliasCycle) {
+		return actionResult{http.StatusBadRequest, "", err.Error(), nil}
+	} else if err != nil {
 		// TODO: distinguish between bad request, conflict and server error
 		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
 	}
 
+	if r.PostFormValue("recompute") == "true" {
+		to := utils.BeginOfToday(user.TZ())
+		if _, err := h.aliasRecomputeSrvc.Start(user, to.AddDate(0, 0, -models.AliasRecomputeDefaultDays), to); errors.Is(err, services.ErrAliasRecomputeInProgress) {
+			return actionResult{http.StatusOK, "alias added successfully, but another recompute is still in progress, please wait", "", nil}
+		} else if err != nil {
+			conf.Log().Request(r).Error("failed to start recompute after adding alias", "userID", user.ID, "error", err)
+			return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+		}
+		return actionResult{http.StatusAccepted, fmt.Sprintf("alias added successfully, the last %d days' summaries are being recomputed in the background", models.AliasRecomputeDefaultDays), "", nil}
+	}
+
 	return actionResult{http.StatusOK, "alias added successfully", "", nil}
 }
 
@@ -491,6 +1057,36 @@ func (h *SettingsHandler) actionDeleteLabel(w http.ResponseWriter, r *http.Reque
 	return actionResult{http.StatusNotFound, "", "label not found", nil}
 }
 
+func (h *SettingsHandler) actionAddDefaultBranch(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	project, branch := r.PostFormValue("project"), strings.TrimSpace(r.PostFormValue("branch"))
+	if project == "" || h.config.App.IsUnknownBranch(branch) {
+		return actionResult{http.StatusBadRequest, "", "invalid input", nil}
+	}
+
+	if err := h.defaultBranchSrvc.Set(user, project, branch); err != nil {
+		return actionResult{http.StatusInternalServerError, "", "could not set default branch", nil}
+	}
+	return actionResult{http.StatusOK, "default branch set successfully", "", nil}
+}
+
+func (h *SettingsHandler) actionDeleteDefaultBranch(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+
+	if err := h.defaultBranchSrvc.Unset(user, r.PostFormValue("project")); err != nil {
+		return actionResult{http.StatusInternalServerError, "", "could not delete default branch", nil}
+	}
+	return actionResult{http.StatusOK, "default branch deleted successfully", "", nil}
+}
+
 func (h *SettingsHandler) actionDeleteLanguageMapping(w http.ResponseWriter, r *http.Request) actionResult {
 	if h.config.IsDev() {
 		loadTemplates()
@@ -580,37 +1176,23 @@ func (h *SettingsHandler) actionImportWakatime(w http.ResponseWriter, r *http.Re
 	}
 
 	useLegacyImporter, _ := strconv.ParseBool(r.PostFormValue("use_legacy_importer"))
-	kvKeyLastImport := fmt.Sprintf("%s_%s", conf.KeyLastImport, user.ID)
-	kvKeyLastImportSuccess := fmt.Sprintf("%s_%s", conf.KeyLastImportSuccess, user.ID)
-
-	if !h.config.IsDev() {
-		lastImport, _ := time.Parse(time.RFC822, h.keyValueSrvc.MustGetString(kvKeyLastImport).Value)
-		if time.Now().Sub(lastImport) < time.Duration(h.config.App.ImportBackoffMin)*time.Minute {
-			return actionResult{
-				http.StatusTooManyRequests,
-				"",
-				fmt.Sprintf("Too many data imports - you are only allowed to request an import every %d minutes.", h.config.App.ImportBackoffMin),
-				nil,
-			}
-		}
+	dryRun, _ := strconv.ParseBool(r.PostFormValue("dry_run"))
+	if dryRun && (user.Email == "" || !h.config.Mail.Enabled) {
+		return actionResult{http.StatusBadRequest, "", "dry run results are sent via e-mail, which is not available for your account", nil}
+	}
 
-		lastImportSuccess, _ := time.Parse(time.RFC822, h.keyValueSrvc.MustGetString(kvKeyLastImportSuccess).Value)
-		if time.Now().Sub(lastImportSuccess) < time.Duration(h.config.App.ImportMaxRate)*time.Hour {
-			return actionResult{
-				http.StatusTooManyRequests,
-				"",
-				fmt.Sprintf("Too many data imports - last import ran less than %d hours ago, please wait.", h.config.App.ImportMaxRate),
-				nil,
-			}
-		}
+	if result := h.checkImportRate(user, dryRun); result != nil {
+		return *result
+	}
+	if !h.tryImportLock(user.ID) {
+		return actionResult{http.StatusConflict, "", "another import is still running, please wait for it to finish", nil}
 	}
 
 	go func(user *models.User) {
+		defer h.releaseImportLock(user.ID)
 		start := time.Now()
 		importer := imports.NewWakatimeImporter(user.WakatimeApiKey, useLegacyImporter)
 
-		countBefore, _ := h.heartbeatSrvc.CountByUser(user)
-
 		var (
 			stream      <-chan *models.Heartbeat
 			importError error
@@ -626,38 +1208,27 @@ func (h *SettingsHandler) actionImportWakatime(w http.ResponseWriter, r *http.Re
 			return
 		}
 
-		// import successful
-		h.keyValueSrvc.PutString(&models.KeyStringValue{
-			Key:   kvKeyLastImportSuccess,
-			Value: time.Now().Format(time.RFC822),
-		})
-
-		count := 0
-		batch := make([]*models.Heartbeat, 0, h.config.App.ImportBatchSize)
-
-		insert := func(batch []*models.Heartbeat) {
-			if err := h.heartbeatSrvc.InsertBatch(batch); err != nil {
-				slog.Warn("failed to insert imported heartbeat, already existing?", "error", err)
+		if dryRun {
+			preview, err := h.previewImport(user, stream)
+			if err != nil {
+				conf.Log().Error("wakatime import dry run for user failed", "userID", user.ID, "error", err)
+				return
 			}
-		}
-
-		for hb := range stream {
-			count++
-			batch = append(batch, hb)
-
-			if len(batch) == h.config.App.ImportBatchSize {
-				insert(batch)
-				batch = make([]*models.Heartbeat, 0, h.config.App.ImportBatchSize)
+			slog.Info("finished wakatime import dry run for user", "userID", user.ID, "newCount", preview.NumHeartbeats, "duplicateCount", preview.NumDuplicates)
+			if err := h.mailSrvc.SendImportPreview(user, preview); err != nil {
+				conf.Log().Error("failed to send import preview mail", "userID", user.ID, "error", err)
 			}
+			return
 		}
-		if len(batch) > 0 {
-			insert(batch)
-		}
 
-		countAfter, _ := h.heartbeatSrvc.CountByUser(user)
-		slog.Info("downloaded heartbeats for user", "count", count, "userID", user.ID, "importedCount", countAfter-countBefore)
+		h.markImportSuccess(user)
+
+		snapshot := h.captureImportSnapshot(user)
+		count, imported := h.insertImported(stream)
+		slog.Info("downloaded heartbeats for user", "count", count, "userID", user.ID, "importedCount", imported)
 
 		h.regenerateSummaries(user)
+		diff := h.completeImportSnapshot(user, snapshot)
 
 		if !user.HasData {
 			user.HasData = true
@@ -667,7 +1238,7 @@ func (h *SettingsHandler) actionImportWakatime(w http.ResponseWriter, r *http.Re
 		}
 
 		if user.Email != "" {
-			if err := h.mailSrvc.SendImportNotification(user, time.Now().Sub(start), int(countAfter-countBefore)); err != nil {
+			if err := h.mailSrvc.SendImportNotification(user, time.Now().Sub(start), imported, diff); err != nil {
 				conf.Log().Request(r).Error("failed to send import notification mail", "userID", user.ID, "error", err)
 			} else {
 				slog.Info("sent import notification mail", "userID", user.ID)
@@ -675,12 +1246,297 @@ func (h *SettingsHandler) actionImportWakatime(w http.ResponseWriter, r *http.Re
 		}
 	}(user)
 
+	h.markImportAttempt(user)
+
+	if dryRun {
+		return actionResult{http.StatusAccepted, "Import dry run started. This will take several minutes. You will receive the results via e-mail.", "", nil}
+	}
+	return actionResult{http.StatusAccepted, "Import started. This will take several minutes. Please check back later.", "", nil}
+}
+
+// previewImport consumes the given stream of heartbeats to be imported and determines how many of them are new, without writing anything
+func (h *SettingsHandler) previewImport(user *models.User, stream <-chan *models.Heartbeat) (*models.ImportPreview, error) {
+	preview := &models.ImportPreview{}
+	seenHashes := datastructure.New[string]()
+	days := datastructure.New[string]()
+
+	process := func(batch []*models.Heartbeat) error {
+		hashes := make([]string, len(batch))
+		for i, hb := range batch {
+			hashes[i] = hb.Hash
+		}
+		existing, err := h.heartbeatSrvc.GetExistingHashes(hashes)
+		if err != nil {
+			return err
+		}
+		existingHashes := datastructure.New[string](existing...)
+
+		for _, hb := range batch {
+			if existingHashes.Contain(hb.Hash) || seenHashes.Contain(hb.Hash) {
+				preview.NumDuplicates++
+				continue
+			}
+			seenHashes.Add(hb.Hash)
+			days.Add(hb.Time.T().In(user.TZ()).Format(time.DateOnly))
+			if preview.NumHeartbeats == 0 || hb.Time.T().Before(preview.From) {
+				preview.From = hb.Time.T()
+			}
+			if hb.Time.T().After(preview.To) {
+				preview.To = hb.Time.T()
+			}
+			preview.NumHeartbeats++
+		}
+		return nil
+	}
+
+	batch := make([]*models.Heartbeat, 0, h.config.App.ImportBatchSize)
+	for hb := range stream {
+		batch = append(batch, hb)
+		if len(batch) == h.config.App.ImportBatchSize {
+			if err := process(batch); err != nil {
+				for range stream {
+					// drain remaining heartbeats to not leave importer blocked
+				}
+				return nil, err
+			}
+			batch = make([]*models.Heartbeat, 0, h.config.App.ImportBatchSize)
+		}
+	}
+	if err := process(batch); err != nil {
+		return nil, err
+	}
+
+	preview.NumDays = days.Size()
+	return preview, nil
+}
+
+func (h *SettingsHandler) actionImportFile(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	if !h.config.App.ImportEnabled {
+		return actionResult{http.StatusForbidden, "", "imports are disabled on this server", nil}
+	}
+
+	user := middlewares.GetPrincipal(r)
+	dryRun, _ := strconv.ParseBool(r.PostFormValue("dry_run"))
+
+	if result := h.checkImportRate(user, dryRun); result != nil {
+		return *result
+	}
+	if !h.tryImportLock(user.ID) {
+		return actionResult{http.StatusConflict, "", "another import is still running, please wait for it to finish", nil}
+	}
+	var background bool // lock is released by the background import, if started
+	defer func() {
+		if !background {
+			h.releaseImportLock(user.ID)
+		}
+	}()
+
+	// legacy actions imply the format and used format-specific field names
+	format, fieldName := r.PostFormValue("format"), "import_file"
+	switch r.PostFormValue("action") {
+	case "import_wakatime_export":
+		format, fieldName = imports.FormatWakatimeExport, "wakatime_export"
+	case "import_wakatime_offline":
+		format, fieldName = imports.FormatWakatimeOffline, "offline_db"
+	}
+
+	file, _, err := r.FormFile(fieldName)
+	if err != nil {
+		return actionResult{http.StatusBadRequest, "", "missing import file", nil}
+	}
+	defer file.Close()
+
+	// uploaded files are cleaned up after the request, but the import continues in the background (also, the sqlite driver can only read from disk)
+	tmpFile, err := os.CreateTemp("", "wakapi_import_*")
+	if err != nil {
+		conf.Log().Request(r).Error("failed to create temp file for import", "error", err)
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	_, err = io.Copy(tmpFile, file)
+	tmpFile.Close()
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		conf.Log().Request(r).Error("failed to write temp file for import", "error", err)
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	importer, err := imports.NewFileImporter(format, tmpFile.Name())
+	if err == nil {
+		err = importer.Validate()
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return actionResult{http.StatusBadRequest, "", err.Error(), nil}
+	}
+
+	stream, err := importer.ImportAll(user)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return actionResult{http.StatusBadRequest, "", err.Error(), nil}
+	}
+
+	// without e-mail, dry run results can only be returned right away, which is fine for smaller files
+	if dryRun && (user.Email == "" || !h.config.Mail.Enabled) {
+		defer os.Remove(tmpFile.Name())
+		h.markImportAttempt(user)
+		preview, err := h.previewImport(user, stream)
+		if err != nil {
+			conf.Log().Request(r).Error("file import dry run failed", "userID", user.ID, "format", format, "error", err)
+			return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+		}
+		return actionResult{http.StatusOK, fmt.Sprintf("Dry run: would import %d heartbeats (%d days), skip %d duplicates. Nothing was saved.", preview.NumHeartbeats, preview.NumDays, preview.NumDuplicates), "", nil}
+	}
+
+	background = true
+	go func(user *models.User) {
+		defer h.releaseImportLock(user.ID)
+		defer os.Remove(tmpFile.Name())
+		start := time.Now()
+
+		if dryRun {
+			preview, err := h.previewImport(user, stream)
+			if err != nil {
+				conf.Log().Error("file import dry run for user failed", "userID", user.ID, "format", format, "error", err)
+				return
+			}
+			if err := h.mailSrvc.SendImportPreview(user, preview); err != nil {
+				conf.Log().Error("failed to send import preview mail", "userID", user.ID, "error", err)
+			}
+			return
+		}
+
+		h.markImportSuccess(user)
+
+		snapshot := h.captureImportSnapshot(user)
+		count, imported := h.insertImported(stream)
+		slog.Info("imported heartbeats file for user", "count", count, "userID", user.ID, "format", format, "importedCount", imported)
+
+		if imported > 0 {
+			h.regenerateSummaries(user)
+
+			if !user.HasData {
+				user.HasData = true
+				if _, err := h.userSrvc.Update(user); err != nil {
+					conf.Log().Error("failed to set 'has_data' flag for user", "userID", user.ID, "error", err)
+				}
+			}
+		}
+
+		diff := h.completeImportSnapshot(user, snapshot)
+		if user.Email != "" && h.config.Mail.Enabled {
+			if err := h.mailSrvc.SendImportNotification(user, time.Since(start), imported, diff); err != nil {
+				conf.Log().Error("failed to send import notification mail", "userID", user.ID, "error", err)
+			}
+		}
+	}(user)
+
+	h.markImportAttempt(user)
+
+	if dryRun {
+		return actionResult{http.StatusAccepted, "Import dry run started. You will receive the results via e-mail.", "", nil}
+	}
+	return actionResult{http.StatusAccepted, "Import started. Heartbeats that already exist are skipped. This may take a few minutes, please check back later.", "", nil}
+}
+
+// checkImportRate returns an error result if the user requested an import too recently or, unless for a dry run, another import has finished too recently
+func (h *SettingsHandler) checkImportRate(user *models.User, dryRun bool) *actionResult {
+	if h.config.IsDev() {
+		return nil
+	}
+
+	lastImport, _ := time.Parse(time.RFC822, h.keyValueSrvc.MustGetString(fmt.Sprintf("%s_%s", conf.KeyLastImport, user.ID)).Value)
+	if time.Now().Sub(lastImport) < time.Duration(h.config.App.ImportBackoffMin)*time.Minute {
+		return &actionResult{
+			http.StatusTooManyRequests,
+			"",
+			fmt.Sprintf("Too many data imports - you are only allowed to request an import every %d minutes.", h.config.App.ImportBackoffMin),
+			nil,
+		}
+	}
+
+	lastImportSuccess, _ := time.Parse(time.RFC822, h.keyValueSrvc.MustGetString(fmt.Sprintf("%s_%s", conf.KeyLastImportSuccess, user.ID)).Value)
+	if !dryRun && time.Now().Sub(lastImportSuccess) < time.Duration(h.config.App.ImportMaxRate)*time.Hour {
+		return &actionResult{
+			http.StatusTooManyRequests,
+			"",
+			fmt.Sprintf("Too many data imports - last import ran less than %d hours ago, please wait.", h.config.App.ImportMaxRate),
+			nil,
+		}
+	}
+
+	return nil
+}
+
+func (h *SettingsHandler) markImportAttempt(user *models.User) {
 	h.keyValueSrvc.PutString(&models.KeyStringValue{
-		Key:   kvKeyLastImport,
+		Key:   fmt.Sprintf("%s_%s", conf.KeyLastImport, user.ID),
 		Value: time.Now().Format(time.RFC822),
 	})
+}
 
-	return actionResult{http.StatusAccepted, "Import started. This will take several minutes. Please check back later.", "", nil}
+func (h *SettingsHandler) markImportSuccess(user *models.User) {
+	h.keyValueSrvc.PutString(&models.KeyStringValue{
+		Key:   fmt.Sprintf("%s_%s", conf.KeyLastImportSuccess, user.ID),
+		Value: time.Now().Format(time.RFC822),
+	})
+}
+
+// insertImported writes the streamed heartbeats in batches, logs the progress and returns the number of heartbeats read (including duplicates) and the number of those actually inserted
+func (h *SettingsHandler) insertImported(stream <-chan *models.Heartbeat) (int, int) {
+	count, inserted := 0, 0
+	batch := make([]*models.Heartbeat, 0, h.config.App.ImportBatchSize)
+
+	insert := func(batch []*models.Heartbeat) {
+		n, err := h.heartbeatSrvc.InsertImported(batch)
+		if err != nil {
+			slog.Warn("failed to insert imported heartbeats", "error", err)
+		}
+		inserted += n
+	}
+
+	for hb := range stream {
+		count++
+		batch = append(batch, hb)
+
+		if len(batch) == h.config.App.ImportBatchSize {
+			insert(batch)
+			batch = make([]*models.Heartbeat, 0, h.config.App.ImportBatchSize)
+		}
+		if count%importProgressInterval == 0 {
+			slog.Info("import in progress", "userID", hb.UserID, "count", count)
+		}
+	}
+	if len(batch) > 0 {
+		insert(batch)
+	}
+
+	return count, inserted
+}
+
+func (h *SettingsHandler) actionExportData(w http.ResponseWriter, r *http.Request) actionResult {
+	if h.config.IsDev() {
+		loadTemplates()
+	}
+
+	user := middlewares.GetPrincipal(r)
+	if user.Email == "" {
+		return actionResult{http.StatusBadRequest, "", "an e-mail address is required to receive the download link", nil}
+	}
+
+	if err := h.exportSrvc.RequestExport(user, r.PostFormValue("format")); err != nil {
+		if errors.Is(err, services.ErrInvalidExportFormat) {
+			return actionResult{http.StatusBadRequest, "", "invalid export format", nil}
+		}
+		conf.Log().Request(r).Error("failed to request export", "userID", user.ID, "error", err)
+		return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+	}
+
+	return actionResult{http.StatusAccepted, fmt.Sprintf("Export started. You will receive an e-mail with a download link at %s once it is ready.", user.Email), "", nil}
 }
 
 func (h *SettingsHandler) actionRegenerateSummaries(w http.ResponseWriter, r *http.Request) actionResult {
@@ -734,6 +1590,19 @@ func (h *SettingsHandler) actionDeleteUser(w http.ResponseWriter, r *http.Reques
 	}
 
 	user := middlewares.GetPrincipal(r)
+
+	if h.config.App.AccountDeletionGraceDays > 0 {
+		if _, err := h.userSrvc.SoftDelete(user); err != nil {
+			return actionResult{http.StatusInternalServerError, "", conf.ErrInternalServerError, nil}
+		}
+		slog.Info("user scheduled for deletion", "userID", user.ID, "due", user.HardDeletionDue())
+
+		routeutils.SetSuccess(r, w, fmt.Sprintf("Your account will be deleted permanently on %s. Until then, you can restore it by logging in again. Sorry to see you go.", user.HardDeletionDue().Format(h.config.App.DateFormat)))
+		http.SetCookie(w, h.config.GetClearCookie(models.AuthCookieKey))
+		http.Redirect(w, r, h.config.Server.BasePath, http.StatusFound)
+		return actionResult{-1, "", "", nil}
+	}
+
 	go func(user *models.User) {
 		slog.Info("deleting user shortly", "userID", user.ID)
 		time.Sleep(5 * time.Minute)
@@ -805,6 +1674,29 @@ func (h *SettingsHandler) validateWakatimeKey(apiKey string, baseUrl string) boo
 	return true
 }
 
+// captureImportSnapshot records the user's totals before an import, failing to do so must not prevent the import itself, though
+func (h *SettingsHandler) captureImportSnapshot(user *models.User) *models.ImportSnapshot {
+	snapshot, err := h.importSnapshotSrvc.Capture(user)
+	if err != nil {
+		conf.Log().Error("failed to capture pre-import snapshot", "userID", user.ID, "error", err)
+		return nil
+	}
+	return snapshot
+}
+
+func (h *SettingsHandler) completeImportSnapshot(user *models.User, snapshot *models.ImportSnapshot) *models.ImportDiff {
+	if snapshot == nil {
+		return nil
+	}
+	diff, err := h.importSnapshotSrvc.Complete(user, snapshot)
+	if err != nil {
+		conf.Log().Error("failed to compare import snapshot", "userID", user.ID, "snapshotID", snapshot.ID, "error", err)
+		return nil
+	}
+	slog.Info("compared import snapshot", "userID", user.ID, "snapshotID", snapshot.ID, "addedSeconds", diff.Added)
+	return diff
+}
+
 func (h *SettingsHandler) regenerateSummaries(user *models.User) error {
 	slog.Info("clearing summaries for user", "userID", user.ID)
 	if err := h.summarySrvc.DeleteByUser(user.ID); err != nil {
@@ -902,6 +1794,19 @@ func (h *SettingsHandler) buildViewModel(r *http.Request, w http.ResponseWriter,
 		}
 	}
 
+	// default branches
+	defaultBranches, err := h.defaultBranchSrvc.GetByUser(user.ID)
+	if err != nil {
+		conf.Log().Request(r).Error("error while fetching default branches", "error", err)
+		return &view.SettingsViewModel{
+			SharedLoggedInViewModel: view.SharedLoggedInViewModel{
+				SharedViewModel: view.NewSharedViewModel(h.config, &view.Messages{Error: criticalError}),
+				User:            user,
+				ApiKey:          user.ApiKey,
+			},
+		}
+	}
+
 	// subscriptions
 	var subscriptionPrice string
 	if h.config.Subscriptions.Enabled {
@@ -917,7 +1822,13 @@ func (h *SettingsHandler) buildViewModel(r *http.Request, w http.ResponseWriter,
 
 	// invite link
 	inviteCode := getVal[string](args, valueInviteCode, "")
-	inviteLink := condition.TernaryOperator[bool, string](inviteCode == "", "", fmt.Sprintf("%s/signup?invite=%s", h.config.Server.GetPublicUrl(), inviteCode))
+	inviteLink := condition.TernaryOperator[bool, string](inviteCode == "", "", fmt.Sprintf("%s/signup?invite=%s", h.config.Server.GetBaseUrl(), inviteCode))
+
+	// file import formats
+	importFormats := make([]*view.SettingsVMImportFormat, len(imports.FileImportFormats))
+	for i, f := range imports.FileImportFormats {
+		importFormats[i] = &view.SettingsVMImportFormat{Name: f.Name, Title: f.Title, Accept: f.Accept}
+	}
 
 	vm := &view.SettingsViewModel{
 		SharedLoggedInViewModel: view.SharedLoggedInViewModel{
@@ -925,15 +1836,26 @@ func (h *SettingsHandler) buildViewModel(r *http.Request, w http.ResponseWriter,
 			User:            user,
 			ApiKey:          user.ApiKey,
 		},
-		LanguageMappings:    mappings,
-		Aliases:             combinedAliases,
-		Labels:              combinedLabels,
-		Projects:            projects,
-		UserFirstData:       firstData,
-		SubscriptionPrice:   subscriptionPrice,
-		SupportContact:      h.config.App.SupportContact,
-		DataRetentionMonths: h.config.App.DataRetentionMonths,
-		InviteLink:          inviteLink,
+		LanguageMappings:         mappings,
+		Aliases:                  combinedAliases,
+		Labels:                   combinedLabels,
+		DefaultBranches:          defaultBranches,
+		Projects:                 projects,
+		UserFirstData:            firstData,
+		SubscriptionPrice:        subscriptionPrice,
+		SubscriptionTrialDays:    h.config.Subscriptions.TrialPeriodDays,
+		SupportContact:           h.config.App.SupportContact,
+		DataRetentionMonths:      h.config.App.DataRetentionMonths,
+		AccountDeletionGraceDays: h.config.App.AccountDeletionGraceDays,
+		ExportLinkExpiryHours:    h.config.App.ExportLinkExpiryHours,
+		ActiveDayThresholdSec:    h.config.App.ActiveDayThresholdSec,
+		InactivityReminderDays:   h.config.App.InactivityReminderDays,
+		UnknownLabel:             h.config.App.UnknownLabel,
+		InviteLink:               inviteLink,
+		TotpSecret:               getVal[string](args, valueTotpSecret, ""),
+		TotpUri:                  getVal[string](args, valueTotpUri, ""),
+		RecoveryCodes:            getVal[[]string](args, valueRecoveryCodes, nil),
+		ImportFormats:            importFormats,
 	}
 	return routeutils.WithSessionMessages(vm, r, w)
 }
@@ -947,6 +1869,16 @@ func (h *SettingsHandler) isAggregationLocked(userId string) bool {
 	return locked
 }
 
+// tryImportLock marks an import of the user as running and returns false if one is running already
+func (h *SettingsHandler) tryImportLock(userId string) bool {
+	_, running := h.importLocks.LoadOrStore(userId, true)
+	return !running
+}
+
+func (h *SettingsHandler) releaseImportLock(userId string) {
+	h.importLocks.Delete(userId)
+}
+
 func getVal[T any](values *map[string]interface{}, key string, fallback T) T {
 	if values == nil {
 		return fallback
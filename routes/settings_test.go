@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/middlewares"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSettingsHandler_previewImport(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.ImportBatchSize = 2
+	config.Set(cfg)
+
+	day1 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	heartbeats := []*models.Heartbeat{
+		{Hash: "a", Time: models.CustomTime(day1)},
+		{Hash: "b", Time: models.CustomTime(day1.Add(time.Minute))},
+		{Hash: "c", Time: models.CustomTime(day2)}, // already existing
+		{Hash: "a", Time: models.CustomTime(day1)}, // duplicate within import
+		{Hash: "d", Time: models.CustomTime(day2.Add(time.Minute))},
+	}
+
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("GetExistingHashes", mock.Anything).Return([]string{"c"}, nil)
+
+	sut := &SettingsHandler{
+		config:        config.Get(),
+		heartbeatSrvc: heartbeatServiceMock,
+	}
+
+	stream := make(chan *models.Heartbeat)
+	go func() {
+		for _, hb := range heartbeats {
+			stream <- hb
+		}
+		close(stream)
+	}()
+
+	preview, err := sut.previewImport(&models.User{ID: "user1"}, stream)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, preview.NumHeartbeats)
+	assert.Equal(t, 2, preview.NumDuplicates)
+	assert.Equal(t, 2, preview.NumDays)
+	assert.Equal(t, day1, preview.From)
+	assert.Equal(t, day2.Add(time.Minute), preview.To)
+	heartbeatServiceMock.AssertNotCalled(t, "InsertBatch", mock.Anything)
+}
+
+func TestSettingsHandler_insertImported(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.ImportBatchSize = 2
+	config.Set(cfg)
+
+	heartbeats := []*models.Heartbeat{{Hash: "a"}, {Hash: "b"}, {Hash: "c"}}
+
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("InsertImported", heartbeats[:2]).Return(1, nil) // one already existing
+	heartbeatServiceMock.On("InsertImported", heartbeats[2:]).Return(1, nil)
+
+	sut := &SettingsHandler{
+		config:        config.Get(),
+		heartbeatSrvc: heartbeatServiceMock,
+	}
+
+	stream := make(chan *models.Heartbeat)
+	go func() {
+		for _, hb := range heartbeats {
+			stream <- hb
+		}
+		close(stream)
+	}()
+
+	count, inserted := sut.insertImported(stream)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 2, inserted)
+	heartbeatServiceMock.AssertNotCalled(t, "CountByUser", mock.Anything)
+}
+
+func TestSettingsHandler_actionImportFile_Throttled(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.ImportEnabled = true
+	cfg.App.ImportBackoffMin = 5
+	cfg.App.ImportMaxRate = 24
+	config.Set(cfg)
+
+	user := &models.User{ID: "user1"}
+
+	keyValueServiceMock := new(mocks.KeyValueServiceMock)
+	keyValueServiceMock.On("MustGetString", config.KeyLastImport+"_user1").Return(&models.KeyStringValue{Value: time.Now().Add(-10 * time.Minute).Format(time.RFC822)})
+	keyValueServiceMock.On("MustGetString", config.KeyLastImportSuccess+"_user1").Return(&models.KeyStringValue{Value: time.Now().Add(-1 * time.Hour).Format(time.RFC822)})
+
+	sut := &SettingsHandler{
+		config:       config.Get(),
+		keyValueSrvc: keyValueServiceMock,
+	}
+
+	importFile := func(dryRun bool) actionResult {
+		var result actionResult
+		form := url.Values{"action": {"import_file"}, "dry_run": {strconv.FormatBool(dryRun)}}
+		r := httptest.NewRequest(http.MethodPost, "/settings", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		middlewares.NewPrincipalMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewares.SetPrincipal(r, user)
+			result = sut.actionImportFile(w, r)
+		})).ServeHTTP(httptest.NewRecorder(), r)
+		return result
+	}
+
+	// last successful import too recent
+	assert.Equal(t, http.StatusTooManyRequests, importFile(false).code)
+
+	// dry runs are only subject to the backoff, but another import is still running
+	assert.True(t, sut.tryImportLock(user.ID))
+	assert.Equal(t, http.StatusConflict, importFile(true).code)
+
+	// lock is released after rejected requests
+	sut.releaseImportLock(user.ID)
+	assert.Equal(t, http.StatusBadRequest, importFile(true).code) // missing file
+	assert.True(t, sut.tryImportLock(user.ID))
+}
+
+func TestSettingsHandler_actionChangePassword(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.SecureCookie = securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+	config.Set(cfg)
+
+	hash, _ := utils.HashPassword("old-password", "", cfg.Security.GetPasswordHashOptions())
+	user := &models.User{ID: "user1", Password: hash}
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("Update", user).Return(user, nil)
+	userServiceMock.On("CreateSession", user, "test-agent", mock.Anything).Return(&models.UserSession{ID: "session2", UserID: user.ID}, nil)
+	userServiceMock.On("RevokeSession", user, "session1").Return(nil)
+
+	sut := &SettingsHandler{
+		config:   config.Get(),
+		userSrvc: userServiceMock,
+	}
+
+	currentSession := models.NewSession(user)
+	currentSession.ID = "session1"
+	currentCookie, _ := cfg.Security.SecureCookie.Encode(models.AuthCookieKey, currentSession)
+
+	form := url.Values{"password_old": {"old-password"}, "password_new": {"New-password-1234"}, "password_repeat": {"New-password-1234"}}
+	r := httptest.NewRequest(http.MethodPost, "/settings", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("User-Agent", "test-agent")
+	r.AddCookie(&http.Cookie{Name: models.AuthCookieKey, Value: currentCookie})
+	rec := httptest.NewRecorder()
+
+	var result actionResult
+	middlewares.NewPrincipalMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middlewares.SetPrincipal(r, user)
+		result = sut.actionChangePassword(w, r)
+	})).ServeHTTP(rec, r)
+
+	assert.Equal(t, http.StatusOK, result.code, result.error)
+	userServiceMock.AssertCalled(t, "RevokeSession", user, "session1")
+
+	var session models.Session
+	cookies := rec.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Nil(t, cfg.Security.SecureCookie.Decode(models.AuthCookieKey, cookies[0].Value, &session))
+	assert.Equal(t, "session2", session.ID)
+	assert.Equal(t, user.ID, session.UserID)
+}
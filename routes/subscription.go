@@ -16,6 +16,7 @@ import (
 	stripeCheckoutSession "github.com/stripe/stripe-go/v74/checkout/session"
 	stripeCustomer "github.com/stripe/stripe-go/v74/customer"
 	stripePrice "github.com/stripe/stripe-go/v74/price"
+	stripePromotionCode "github.com/stripe/stripe-go/v74/promotioncode"
 	stripeSubscription "github.com/stripe/stripe-go/v74/subscription"
 	"github.com/stripe/stripe-go/v74/webhook"
 	"io"
@@ -36,6 +37,8 @@ import (
 
 // TODO: move all logic inside this controller into a separate service
 
+var errInvalidPromoCode = errors.New("invalid promo code")
+
 type SubscriptionHandler struct {
 	config       *conf.Config
 	eventBus     *hub.Hub
@@ -146,8 +149,8 @@ func (h *SubscriptionHandler) PostCheckout(w http.ResponseWriter, r *http.Reques
 		},
 		ClientReferenceID:   &user.ID,
 		AllowPromotionCodes: stripe.Bool(true),
-		SuccessURL:          stripe.String(fmt.Sprintf("%s%s/subscription/success", h.config.Server.PublicUrl, h.config.Server.BasePath)),
-		CancelURL:           stripe.String(fmt.Sprintf("%s%s/subscription/cancel", h.config.Server.PublicUrl, h.config.Server.BasePath)),
+		SuccessURL:          stripe.String(fmt.Sprintf("%s/subscription/success", h.config.Server.GetBaseUrl())),
+		CancelURL:           stripe.String(fmt.Sprintf("%s/subscription/cancel", h.config.Server.GetBaseUrl())),
 	}
 
 	if user.StripeCustomerId != "" {
@@ -156,6 +159,30 @@ func (h *SubscriptionHandler) PostCheckout(w http.ResponseWriter, r *http.Reques
 		checkoutParams.CustomerEmail = &user.Email
 	}
 
+	// stripe doesn't allow to both pre-apply a discount and let the user enter a code on the checkout page
+	if promoCode := strings.TrimSpace(r.PostFormValue("promo_code")); promoCode != "" {
+		promotionCode, err := h.findPromotionCode(promoCode, user)
+		if err != nil {
+			if errors.Is(err, errInvalidPromoCode) {
+				routeutils.SetError(r, w, fmt.Sprintf("promo code '%s' is invalid or has expired", promoCode))
+			} else {
+				conf.Log().Request(r).Error("failed to look up stripe promotion code", "code", promoCode, "error", err)
+				routeutils.SetError(r, w, "something went wrong")
+			}
+			http.Redirect(w, r, fmt.Sprintf("%s/settings#subscription", h.config.Server.BasePath), http.StatusFound)
+			return
+		}
+		checkoutParams.AllowPromotionCodes = nil
+		checkoutParams.Discounts = []*stripe.CheckoutSessionDiscountParams{{PromotionCode: &promotionCode.ID}}
+	}
+
+	// only first-time subscribers are eligible for a trial, i.e. those who have never been associated with a stripe customer before
+	if trialDays := h.config.Subscriptions.TrialPeriodDays; trialDays > 0 && user.StripeCustomerId == "" {
+		checkoutParams.SubscriptionData = &stripe.CheckoutSessionSubscriptionDataParams{
+			TrialPeriodDays: stripe.Int64(int64(trialDays)),
+		}
+	}
+
 	session, err := stripeCheckoutSession.New(checkoutParams)
 	if err != nil {
 		conf.Log().Request(r).Error("failed to create stripe checkout session", "error", err)
@@ -181,7 +208,7 @@ func (h *SubscriptionHandler) PostPortal(w http.ResponseWriter, r *http.Request)
 
 	portalParams := &stripe.BillingPortalSessionParams{
 		Customer:  &user.StripeCustomerId,
-		ReturnURL: &h.config.Server.PublicUrl,
+		ReturnURL: stripe.String(h.config.Server.GetBaseUrl()),
 	}
 
 	session, err := stripePortalSession.New(portalParams)
@@ -297,14 +324,22 @@ func (h *SubscriptionHandler) handleSubscriptionEvent(subscription *stripe.Subsc
 	var hasSubscribed bool
 
 	switch subscription.Status {
-	case "active":
+	case "active", "trialing": // trialing subscriptions are entitled just like active ones, their current period ends with the trial
 		until := models.CustomTime(time.Unix(subscription.CurrentPeriodEnd, 0))
 
 		if user.SubscribedUntil == nil || !user.SubscribedUntil.T().Equal(until.T()) {
 			hasSubscribed = true
 			user.SubscribedUntil = &until
 			user.SubscriptionRenewal = &until
-			slog.Info("user got active subscription", "userID", user.ID, "subscriptionID", subscription.ID, "subscribedUntil", user.SubscribedUntil)
+			slog.Info("user got active subscription", "userID", user.ID, "subscriptionID", subscription.ID, "status", subscription.Status, "subscribedUntil", user.SubscribedUntil)
+		}
+
+		if subscription.Status == "trialing" && subscription.TrialEnd > 0 {
+			trialEnd := models.CustomTime(time.Unix(subscription.TrialEnd, 0))
+			user.SubscriptionTrialEnd = &trialEnd
+		} else if user.SubscriptionTrialEnd != nil {
+			user.SubscriptionTrialEnd = nil // trial converted to paid subscription
+			slog.Info("user's subscription trial ended", "userID", user.ID, "subscriptionID", subscription.ID)
 		}
 
 		if cancelAt := time.Unix(subscription.CancelAt, 0); !cancelAt.IsZero() && cancelAt.After(time.Now()) {
@@ -314,6 +349,7 @@ func (h *SubscriptionHandler) handleSubscriptionEvent(subscription *stripe.Subsc
 	case "canceled", "unpaid", "incomplete_expired":
 		user.SubscribedUntil = nil
 		user.SubscriptionRenewal = nil
+		user.SubscriptionTrialEnd = nil
 		slog.Info("user's subscription got canceled due to status update", "userID", user.ID, "subscriptionID", subscription.ID, "status", subscription.Status)
 	default:
 		slog.Info("got subscription status update", "subscriptionID", subscription.ID, "status", subscription.Status, "userID", user.ID)
@@ -358,6 +394,28 @@ func (h *SubscriptionHandler) cancelUserSubscription(user *models.User) error {
 	return err
 }
 
+// findPromotionCode resolves the given customer-facing code to an active stripe promotion code redeemable by the user
+func (h *SubscriptionHandler) findPromotionCode(code string, user *models.User) (*stripe.PromotionCode, error) {
+	params := &stripe.PromotionCodeListParams{
+		Code:   &code,
+		Active: stripe.Bool(true),
+	}
+	params.Filters.AddFilter("limit", "", "1")
+
+	result := stripePromotionCode.List(params)
+	if result.Next() {
+		promotionCode := result.PromotionCode()
+		if err := validatePromotionCode(promotionCode, user); err != nil {
+			return nil, err
+		}
+		return promotionCode, nil
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errInvalidPromoCode
+}
+
 func (h *SubscriptionHandler) findStripeCustomerByEmail(email string) (*stripe.Customer, error) {
 	params := &stripe.CustomerSearchParams{
 		SearchParams: stripe.SearchParams{
@@ -378,23 +436,41 @@ func (h *SubscriptionHandler) findStripeCustomerByEmail(email string) (*stripe.C
 }
 
 func (h *SubscriptionHandler) findCurrentStripeSubscription(customerId string) (*stripe.Subscription, error) {
-	paramStatus := "active"
-	params := &stripe.SubscriptionListParams{
-		Customer: &customerId,
-		Price:    &h.config.Subscriptions.StandardPriceId,
-		Status:   &paramStatus,
-		CurrentPeriodEndRange: &stripe.RangeQueryParams{
-			GreaterThan: time.Now().Unix(),
-		},
-	}
-	params.Filters.AddFilter("limit", "", "1")
+	for _, status := range []string{"active", "trialing"} {
+		params := &stripe.SubscriptionListParams{
+			Customer: &customerId,
+			Price:    &h.config.Subscriptions.StandardPriceId,
+			Status:   stripe.String(status),
+			CurrentPeriodEndRange: &stripe.RangeQueryParams{
+				GreaterThan: time.Now().Unix(),
+			},
+		}
+		params.Filters.AddFilter("limit", "", "1")
 
-	if result := stripeSubscription.List(params); result.Next() {
-		return result.Subscription(), nil
+		if result := stripeSubscription.List(params); result.Next() {
+			return result.Subscription(), nil
+		}
 	}
 	return nil, fmt.Errorf("no active subscription found for customer '%s'", customerId)
 }
 
+func validatePromotionCode(promotionCode *stripe.PromotionCode, user *models.User) error {
+	now := time.Now().Unix()
+	switch {
+	case !promotionCode.Active:
+		return errInvalidPromoCode
+	case promotionCode.ExpiresAt > 0 && promotionCode.ExpiresAt < now:
+		return errInvalidPromoCode
+	case promotionCode.MaxRedemptions > 0 && promotionCode.TimesRedeemed >= promotionCode.MaxRedemptions:
+		return errInvalidPromoCode
+	case promotionCode.Coupon != nil && !promotionCode.Coupon.Valid:
+		return errInvalidPromoCode
+	case promotionCode.Customer != nil && promotionCode.Customer.ID != "" && promotionCode.Customer.ID != user.StripeCustomerId:
+		return errInvalidPromoCode // code is restricted to another customer
+	}
+	return nil
+}
+
 func (h *SubscriptionHandler) clearSubscriptionNotificationStatus(userId string) {
 	key := fmt.Sprintf("%s_%s", conf.KeySubscriptionNotificationSent, userId)
 	if err := h.keyValueSrvc.DeleteString(key); err != nil {
@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stripe/stripe-go/v74"
+)
+
+func TestSubscriptionHandler_handleSubscriptionEvent_Trial(t *testing.T) {
+	config.Set(config.Empty())
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("Update", mock.Anything).Return(&models.User{}, nil)
+	keyValueServiceMock := new(mocks.KeyValueServiceMock)
+	keyValueServiceMock.On("DeleteString", mock.Anything).Return(nil)
+
+	sut := &SubscriptionHandler{
+		config:       config.Get(),
+		userSrvc:     userServiceMock,
+		keyValueSrvc: keyValueServiceMock,
+	}
+
+	user := &models.User{ID: "user1"}
+	trialEnd := time.Now().Add(14 * 24 * time.Hour).Truncate(time.Second)
+	periodEnd := trialEnd.AddDate(0, 1, 0)
+
+	// trial started
+	err := sut.handleSubscriptionEvent(&stripe.Subscription{
+		Status:           stripe.SubscriptionStatusTrialing,
+		CurrentPeriodEnd: trialEnd.Unix(),
+		TrialEnd:         trialEnd.Unix(),
+	}, user)
+	assert.Nil(t, err)
+	assert.True(t, user.HasActiveSubscriptionStrict())
+	assert.True(t, user.IsSubscriptionTrial())
+	assert.Equal(t, trialEnd, user.SubscriptionTrialEnd.T())
+	assert.Equal(t, trialEnd, user.SubscriptionRenewal.T())
+
+	// trial converted to paid
+	err = sut.handleSubscriptionEvent(&stripe.Subscription{
+		Status:           stripe.SubscriptionStatusActive,
+		CurrentPeriodEnd: periodEnd.Unix(),
+		TrialEnd:         trialEnd.Unix(),
+	}, user)
+	assert.Nil(t, err)
+	assert.True(t, user.HasActiveSubscriptionStrict())
+	assert.False(t, user.IsSubscriptionTrial())
+	assert.Nil(t, user.SubscriptionTrialEnd)
+	assert.Equal(t, periodEnd, user.SubscribedUntil.T())
+
+	// trial canceled
+	user = &models.User{ID: "user2"}
+	err = sut.handleSubscriptionEvent(&stripe.Subscription{
+		Status:           stripe.SubscriptionStatusTrialing,
+		CurrentPeriodEnd: trialEnd.Unix(),
+		TrialEnd:         trialEnd.Unix(),
+		CancelAt:         trialEnd.Unix(),
+	}, user)
+	assert.Nil(t, err)
+	assert.True(t, user.IsSubscriptionTrial())
+	assert.Nil(t, user.SubscriptionRenewal)
+
+	err = sut.handleSubscriptionEvent(&stripe.Subscription{
+		Status:   stripe.SubscriptionStatusCanceled,
+		TrialEnd: trialEnd.Unix(),
+	}, user)
+	assert.Nil(t, err)
+	assert.False(t, user.HasActiveSubscriptionStrict())
+	assert.Nil(t, user.SubscriptionTrialEnd)
+}
+
+func Test_validatePromotionCode(t *testing.T) {
+	user := &models.User{ID: "user1", StripeCustomerId: "cus_1"}
+	now := time.Now()
+
+	assert.Nil(t, validatePromotionCode(&stripe.PromotionCode{Active: true, Coupon: &stripe.Coupon{Valid: true}}, user))
+	assert.Nil(t, validatePromotionCode(&stripe.PromotionCode{Active: true, ExpiresAt: now.Add(time.Hour).Unix(), MaxRedemptions: 2, TimesRedeemed: 1}, user))
+	assert.Nil(t, validatePromotionCode(&stripe.PromotionCode{Active: true, Customer: &stripe.Customer{ID: "cus_1"}}, user))
+
+	assert.ErrorIs(t, validatePromotionCode(&stripe.PromotionCode{Active: false}, user), errInvalidPromoCode)
+	assert.ErrorIs(t, validatePromotionCode(&stripe.PromotionCode{Active: true, ExpiresAt: now.Add(-time.Hour).Unix()}, user), errInvalidPromoCode)
+	assert.ErrorIs(t, validatePromotionCode(&stripe.PromotionCode{Active: true, MaxRedemptions: 1, TimesRedeemed: 1}, user), errInvalidPromoCode)
+	assert.ErrorIs(t, validatePromotionCode(&stripe.PromotionCode{Active: true, Coupon: &stripe.Coupon{Valid: false}}, user), errInvalidPromoCode)
+	assert.ErrorIs(t, validatePromotionCode(&stripe.PromotionCode{Active: true, Customer: &stripe.Customer{ID: "cus_2"}}, user), errInvalidPromoCode)
+}
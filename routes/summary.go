@@ -11,7 +11,6 @@ import (
 	su "github.com/muety/wakapi/routes/utils"
 	"github.com/muety/wakapi/services"
 	"net/http"
-	"time"
 )
 
 type SummaryHandler struct {
@@ -49,6 +48,14 @@ func (h *SummaryHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
 	rawQuery := r.URL.RawQuery
 	q := r.URL.Query()
 	if q.Get("interval") == "" && q.Get("from") == "" {
+		// If the user has configured a default interval, it takes precedence over the most recently used one
+		if user := middlewares.GetPrincipal(r); user != nil && user.DefaultSummaryInterval != "" {
+			q.Set("interval", user.DefaultSummaryInterval)
+			redirectAddress := fmt.Sprintf("%s/summary?%s", h.config.Server.BasePath, q.Encode())
+			http.Redirect(w, r, redirectAddress, http.StatusFound)
+			return
+		}
+
 		// If the PersistentIntervalKey cookie is set, redirect to the correct summary page
 		if intervalCookie, _ := r.Cookie(models.PersistentIntervalKey); intervalCookie != nil {
 			redirectAddress := fmt.Sprintf("%s/summary?interval=%s", h.config.Server.BasePath, intervalCookie.Value)
@@ -80,10 +87,14 @@ func (h *SummaryHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// user first data
-	var firstData time.Time
-	firstDataKv := h.keyValueSrvc.MustGetString(fmt.Sprintf("%s_%s", conf.KeyFirstHeartbeat, user.ID))
-	if firstDataKv.Value != "" {
-		firstData, _ = time.Parse(time.RFC822Z, firstDataKv.Value)
+	firstData := su.GetFirstHeartbeat(h.keyValueSrvc, user)
+
+	averageDays, err := su.CountAverageDays(summary, user, summaryParams.Filters, h.summarySrvc, h.keyValueSrvc)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		conf.Log().Request(r).Error("failed to count days for summary average", "userID", user.ID, "error", err)
+		templates[conf.SummaryTemplate].Execute(w, h.buildViewModel(r, w).WithError(conf.ErrInternalServerError))
+		return
 	}
 
 	vm := view.SummaryViewModel{
@@ -92,7 +103,7 @@ func (h *SummaryHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
 			User:            user,
 			ApiKey:          user.ApiKey,
 		},
-		Summary:             summary,
+		Summary:             summary.WithUnknownBucket(h.config.App.UnknownLabel, user.HidesUnknownBucket()),
 		SummaryParams:       summaryParams,
 		EditorColors:        su.FilterColors(h.config.App.GetEditorColors(), summary.Editors),
 		LanguageColors:      su.FilterColors(h.config.App.GetLanguageColors(), summary.Languages),
@@ -100,6 +111,7 @@ func (h *SummaryHandler) GetIndex(w http.ResponseWriter, r *http.Request) {
 		RawQuery:            rawQuery,
 		UserFirstData:       firstData,
 		DataRetentionMonths: h.config.App.DataRetentionMonths,
+		AverageDays:         averageDays,
 	}
 
 	templates[conf.SummaryTemplate].Execute(w, vm)
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/services"
 	"regexp"
 )
 
@@ -22,7 +23,7 @@ func init() {
 	entityFilterReg = regexp.MustCompile(entityFilterPattern)
 }
 
-func GetBadgeParams(reqPath string, authorizedUser, requestedUser *models.User) (*models.KeyedInterval, *models.Filters, error) {
+func GetBadgeParams(reqPath string, authorizedUser, requestedUser *models.User, projectMetadataSrvc services.IProjectMetadataService) (*models.KeyedInterval, *models.Filters, error) {
 	isSameUser := authorizedUser != nil && authorizedUser.ID == requestedUser.ID
 
 	var filterEntity, filterKey string
@@ -81,5 +82,16 @@ func GetBadgeParams(reqPath string, authorizedUser, requestedUser *models.User)
 		return nil, nil, errors.New("user did not opt in to share entity-specific data")
 	}
 
+	// private projects are only shown under their pseudonym to others, so filtering by their real name would allow to probe for them
+	if filterEntity == "project" && !isSameUser {
+		private, err := projectMetadataSrvc.GetPrivate(requestedUser.ID, []string{filterKey})
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(private) > 0 {
+			return nil, nil, errors.New("user did not opt in to share entity-specific data")
+		}
+	}
+
 	return interval, filters, nil
 }
@@ -1,12 +1,15 @@
 package utils
 
 import (
+	"fmt"
+	conf "github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/models/types"
 	"github.com/muety/wakapi/services"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func LoadUserSummary(ss services.ISummaryService, r *http.Request) (*models.Summary, error, int) {
@@ -50,3 +53,69 @@ func FilterColors(all map[string]string, haystack models.SummaryItems) map[strin
 	}
 	return subset
 }
+
+// AnonymizeSharedSummary prepares another user's summary for being shown to others, i.e. replaces keys according to the user's anonymization settings and masks projects marked private
+func AnonymizeSharedSummary(summary *models.Summary, user *models.User, projectMetadataSrvc services.IProjectMetadataService) (*models.Summary, error) {
+	summary = helpers.AnonymizeSummary(summary, user)
+
+	projects := make([]string, len(summary.Projects))
+	for i, item := range summary.Projects {
+		projects[i] = item.Key
+	}
+	private, err := projectMetadataSrvc.GetPrivate(user.ID, projects)
+	if err != nil {
+		return nil, err
+	}
+	return helpers.AnonymizeProjects(summary, user, private), nil
+}
+
+// AnonymizeSharedYearReview prepares another user's year in review for being shown to others, just like AnonymizeSharedSummary, and additionally leaves out projects and languages unless shared by the user
+func AnonymizeSharedYearReview(review *models.YearReview, user *models.User, projectMetadataSrvc services.IProjectMetadataService) (*models.YearReview, error) {
+	summary := models.NewEmptySummary()
+	summary.Projects, summary.Languages = review.Projects, review.Languages
+	summary, err := AnonymizeSharedSummary(summary, user, projectMetadataSrvc)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := *review
+	shared.Projects, shared.Languages = summary.Projects, summary.Languages
+	if !user.ShareProjects {
+		shared.Projects = models.SummaryItems{}
+	}
+	if !user.ShareLanguages {
+		shared.Languages = models.SummaryItems{}
+	}
+	return &shared, nil
+}
+
+// GetFirstHeartbeat returns the time of the user's first heartbeat as periodically recorded by the misc service, or zero if not known (yet)
+func GetFirstHeartbeat(kvs services.IKeyValueService, user *models.User) time.Time {
+	var firstData time.Time
+	if firstDataKv := kvs.MustGetString(fmt.Sprintf("%s_%s", conf.KeyFirstHeartbeat, user.ID)); firstDataKv.Value != "" {
+		firstData, _ = time.Parse(time.RFC822Z, firstDataKv.Value)
+	}
+	return firstData
+}
+
+// CountAverageDays returns the number of days to divide the summary's total coding time by to get a daily average, according to the user's averaging mode, see models.AverageDays.
+// Active days are counted with the given filters applied, i.e. a day only counts as active if there was sufficient activity matching the filters.
+func CountAverageDays(summary *models.Summary, user *models.User, filters *models.Filters, ss services.ISummaryService, kvs services.IKeyValueService) (int, error) {
+	from, to := summary.FromTime.T(), summary.ToTime.T()
+
+	var activeDays int
+	var firstHeartbeat time.Time
+
+	switch user.AverageMode {
+	case models.AverageModeActiveDays:
+		cumulative, err := ss.Cumulative(from, to, user, filters)
+		if err != nil {
+			return 0, err
+		}
+		activeDays = cumulative.ActiveDays(user.ActiveDayThreshold())
+	case models.AverageModeSinceFirst:
+		firstHeartbeat = GetFirstHeartbeat(kvs, user)
+	}
+
+	return models.AverageDays(user.AverageMode, from, to, firstHeartbeat, activeDays), nil
+}
@@ -43,3 +43,16 @@ func CheckEffectiveUser(w http.ResponseWriter, r *http.Request, userService serv
 
 	return requestedUser, nil
 }
+
+// LeaderboardOrgScope returns the org to restrict leaderboards to for the given principal in multi-tenant mode, i.e. their own one, or none ("") for anonymous users and users not belonging to any org.
+// Returns nil, meaning no restriction, if orgs are disabled.
+func LeaderboardOrgScope(principal *models.User) *string {
+	if !conf.Get().App.OrgsEnabled {
+		return nil
+	}
+	var scope string
+	if principal != nil {
+		scope = principal.OrgScope()
+	}
+	return &scope
+}
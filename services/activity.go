@@ -33,16 +33,18 @@ const (
 )
 
 type ActivityService struct {
-	config         *config.Config
-	cache          *cache.Cache
-	summaryService ISummaryService
+	config          *config.Config
+	cache           *cache.Cache
+	summaryService  ISummaryService
+	durationService IDurationService
 }
 
-func NewActivityService(summaryService ISummaryService) *ActivityService {
+func NewActivityService(summaryService ISummaryService, durationService IDurationService) *ActivityService {
 	return &ActivityService{
-		config:         config.Get(),
-		cache:          cache.New(6*time.Hour, 6*time.Hour),
-		summaryService: summaryService,
+		config:          config.Get(),
+		cache:           cache.New(6*time.Hour, 6*time.Hour),
+		summaryService:  summaryService,
+		durationService: durationService,
 	}
 }
 
@@ -66,6 +68,57 @@ func (s *ActivityService) GetChart(user *models.User, interval *models.IntervalK
 	}
 }
 
+// GetHourly buckets the user's coding time within the given range by hour of day (and optionally day of week) in their timezone.
+// It is computed from durations instead of raw heartbeats, so that idle time beyond the heartbeats timeout isn't counted.
+func (s *ActivityService) GetHourly(user *models.User, from, to time.Time, filters *models.Filters, withWeekdays bool) (*models.HourlyActivity, error) {
+	durations, err := s.durationService.Get(from, to, user, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	tz := user.TZ()
+	activity := models.NewHourlyActivity(from, to, tz, withWeekdays)
+	for _, d := range durations {
+		activity.Add(d.Time.T(), d.Duration, tz)
+	}
+	return activity, nil
+}
+
+// GetFocus computes how often the user switched between projects (or files, see models.FocusLevels) within the given range and how long they worked without interruption.
+// Like GetHourly, it's based on durations, so that coding time adds up to the same totals as in summaries.
+func (s *ActivityService) GetFocus(user *models.User, from, to time.Time, filters *models.Filters, level string) (*models.FocusStats, error) {
+	getDurations := s.durationService.Get
+	if level == models.FocusLevelFile {
+		getDurations = s.durationService.GetWithEntities
+	}
+
+	durations, err := getDurations(from, to, user, filters)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewFocusStats(from, to, user.TZ(), level, durations, user.HeartbeatsTimeout()), nil
+}
+
+// GetContributionGrid returns the user's coding time per day of the given calendar year in their timezone, laid out in week columns for a contribution heatmap.
+// Daily totals are mostly served from the persisted daily summaries, only today (if within the year) is computed from durations.
+func (s *ActivityService) GetContributionGrid(user *models.User, year int, filters *models.Filters) (*models.ContributionGrid, error) {
+	tz := user.TZ()
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, tz)
+	to := from.AddDate(1, 0, 0)
+	if now := time.Now().In(tz); now.Before(to) {
+		to = now
+	}
+	if !to.After(from) {
+		return models.NewContributionGrid(year, tz, []*models.CumulativeSummaryDay{}), nil
+	}
+
+	cumulative, err := s.summaryService.Cumulative(from, to, user, filters)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewContributionGrid(year, tz, cumulative.Days), nil
+}
+
 func (s *ActivityService) getChartPastYear(user *models.User, darkTheme, hideAttribution bool) (string, error) {
 	err, from, to := helpers.ResolveIntervalTZ(models.IntervalPast12Months, user.TZ())
 	from = datetime.BeginOfWeek(from, time.Monday)
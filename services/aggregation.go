@@ -3,8 +3,9 @@ package services
 import (
 	"errors"
 	datastructure "github.com/duke-git/lancet/v2/datastructure/set"
-	"github.com/muety/artifex/v2"
+	"github.com/leandro-lugaresi/hub"
 	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/utils"
 	"log/slog"
 	"sync"
 	"time"
@@ -20,17 +21,19 @@ var aggregationLock = sync.Mutex{}
 
 type AggregationService struct {
 	config           *config.Config
+	eventBus         *hub.Hub
 	userService      IUserService
 	summaryService   ISummaryService
 	heartbeatService IHeartbeatService
 	inProgress       datastructure.Set[string]
-	queueDefault     *artifex.Dispatcher
-	queueWorkers     *artifex.Dispatcher
+	queueDefault     *config.JobQueue
+	queueWorkers     *config.JobQueue
 }
 
 func NewAggregationService(userService IUserService, summaryService ISummaryService, heartbeatService IHeartbeatService) *AggregationService {
 	return &AggregationService{
 		config:           config.Get(),
+		eventBus:         config.EventBus(),
 		userService:      userService,
 		summaryService:   summaryService,
 		heartbeatService: heartbeatService,
@@ -147,10 +150,61 @@ func (srv *AggregationService) process(job AggregationJob) {
 		slog.Info("successfully generated summary", "from", job.From, "to", job.To, "userID", job.User.ID)
 		if err := srv.summaryService.Insert(summary); err != nil {
 			config.Log().Error("failed to save summary", "userID", summary.UserID, "fromTime", summary.FromTime, "toTime", summary.ToTime, "error", err)
+			return
 		}
+		srv.eventBus.Publish(hub.Message{
+			Name:   config.EventSummaryCreate,
+			Fields: map[string]interface{}{config.FieldPayload: summary, config.FieldUser: job.User},
+		})
 	}
 }
 
+// RegenerateSummaries synchronously recomputes the user's daily summaries between from and to and replaces any previously persisted ones in that range.
+// The range is extended to whole days in server-local time, as that is what daily summaries are persisted by (see generateUserJobs), regardless of the user's time zone.
+// It ends at the beginning of today at the latest, as a (partial) summary persisted for today would keep the rest of the day from being aggregated.
+// Optionally, progress is reported as the number of days processed so far out of the total.
+// Returns the number of summaries regenerated.
+func (srv *AggregationService) RegenerateSummaries(user *models.User, from, to time.Time, progress func(int, int)) (int, error) {
+	from, to = utils.FloorDate(from.In(time.Local)), utils.CeilDate(to.In(time.Local))
+	if today := utils.BeginOfToday(time.Local); to.After(today) {
+		to = today
+	}
+	if !from.Before(to) {
+		return 0, nil
+	}
+
+	userIds := datastructure.New(user.ID)
+	if err := srv.lockUsers(userIds); err != nil {
+		return 0, err
+	}
+	defer srv.unlockUsers(userIds)
+
+	days := utils.SplitRangeByDays(from, to)
+
+	var n int
+	for i, day := range days {
+		summary, err := srv.summaryService.Summarize(day[0], day[1], user, nil)
+		if err != nil {
+			return n, err
+		}
+
+		// replace day by day (instead of clearing the entire range upfront) to keep the window of incomplete data small, as the server might be running concurrently
+		if err := srv.summaryService.DeleteByUserWithin(user.ID, day[0], day[1]); err != nil {
+			return n, err
+		}
+		if err := srv.summaryService.Insert(summary); err != nil {
+			return n, err
+		}
+		n++
+
+		if progress != nil {
+			progress(i+1, len(days))
+		}
+	}
+
+	return n, nil
+}
+
 func generateUserJobs(user *models.User, from time.Time, jobs chan<- *AggregationJob) {
 	var to time.Time
 
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAggregationService_RegenerateSummaries_ServerLocalDays(t *testing.T) {
+	config.Set(config.Empty())
+
+	local := time.Local
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+	defer func() { time.Local = local }()
+
+	user := &models.User{ID: "testuser01", Location: "America/New_York"}
+	userTz := time.FixedZone("UTC-5", -5*60*60)
+
+	// a single day in the user's time zone spans two server-local days
+	from := time.Date(2024, 1, 2, 0, 0, 0, 0, userTz)
+	to := time.Date(2024, 1, 3, 0, 0, 0, 0, userTz)
+
+	day1 := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	day2 := time.Date(2024, 1, 3, 0, 0, 0, 0, time.Local)
+	day3 := time.Date(2024, 1, 4, 0, 0, 0, 0, time.Local)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Summarize", mock.Anything, mock.Anything, user, mock.Anything).Return(&models.Summary{}, nil)
+	summaryServiceMock.On("DeleteByUserWithin", user.ID, mock.Anything, mock.Anything).Return(nil)
+	summaryServiceMock.On("Insert", mock.Anything).Return(nil)
+
+	sut := NewAggregationService(new(mocks.UserServiceMock), summaryServiceMock, new(mocks.HeartbeatServiceMock))
+
+	n, err := sut.RegenerateSummaries(user, from, to, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	summaryServiceMock.AssertCalled(t, "DeleteByUserWithin", user.ID, day1, day2)
+	summaryServiceMock.AssertCalled(t, "DeleteByUserWithin", user.ID, day2, day3)
+	summaryServiceMock.AssertCalled(t, "Summarize", day1, day2, user, mock.Anything)
+	summaryServiceMock.AssertCalled(t, "Summarize", day2, day3, user, mock.Anything)
+}
+
+func TestAggregationService_RegenerateSummaries_NotBeyondToday(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01"}
+	today := utils.BeginOfToday(time.Local)
+	yesterday := today.AddDate(0, 0, -1)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Summarize", mock.Anything, mock.Anything, user, mock.Anything).Return(&models.Summary{}, nil)
+	summaryServiceMock.On("DeleteByUserWithin", user.ID, mock.Anything, mock.Anything).Return(nil)
+	summaryServiceMock.On("Insert", mock.Anything).Return(nil)
+
+	sut := NewAggregationService(new(mocks.UserServiceMock), summaryServiceMock, new(mocks.HeartbeatServiceMock))
+
+	n, err := sut.RegenerateSummaries(user, yesterday, today.AddDate(0, 0, 3), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	summaryServiceMock.AssertCalled(t, "Summarize", yesterday, today, user, mock.Anything)
+
+	n, err = sut.RegenerateSummaries(user, today.Add(time.Hour), today.AddDate(0, 0, 1), nil)
+	assert.Nil(t, err)
+	assert.Zero(t, n)
+	summaryServiceMock.AssertNumberOfCalls(t, "Summarize", 1)
+}
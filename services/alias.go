@@ -8,9 +8,15 @@ import (
 	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/repositories"
+	"strings"
 	"sync"
 )
 
+var (
+	ErrAliasLimitExceeded = errors.New("maximum number of aliases exceeded")
+	ErrAliasCycle         = errors.New("aliases must not form a cycle")
+)
+
 type AliasService struct {
 	config     *config.Config
 	repository repositories.IAliasRepository
@@ -92,6 +98,15 @@ func (srv *AliasService) GetAliasOrDefault(userId string, summaryType uint8, val
 }
 
 func (srv *AliasService) Create(alias *models.Alias) (*models.Alias, error) {
+	existing, err := srv.GetByUser(alias.UserID)
+	if err != nil {
+		return nil, err
+	}
+	resulting := append(append(make([]*models.Alias, 0, len(existing)+1), existing...), alias)
+	if err := srv.validate(existing, resulting); err != nil {
+		return nil, err
+	}
+
 	result, err := srv.repository.Insert(alias)
 	if err != nil {
 		return nil, err
@@ -148,6 +163,114 @@ func (srv *AliasService) DeleteMulti(aliases []*models.Alias) error {
 	return err
 }
 
+// ApplyRules creates the given aliases, replacing existing ones of the same type and original name, but different key
+func (srv *AliasService) ApplyRules(userId string, aliases []*models.Alias) (*models.AliasRulesResult, error) {
+	return srv.applyRules(userId, aliases, false)
+}
+
+// ReplaceRules works like ApplyRules, but additionally deletes all of the user's existing aliases not among the given ones.
+// Only the given aliases are validated, so that an existing set, e.g. above a since lowered limit, can be replaced as a whole.
+func (srv *AliasService) ReplaceRules(userId string, aliases []*models.Alias) (*models.AliasRulesResult, error) {
+	return srv.applyRules(userId, aliases, true)
+}
+
+func (srv *AliasService) applyRules(userId string, aliases []*models.Alias, replace bool) (*models.AliasRulesResult, error) {
+	existing, err := srv.repository.GetByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	existingByValue := make(map[string]*models.Alias, len(existing))
+	for _, a := range existing {
+		existingByValue[fmt.Sprintf("%d:%s", a.Type, a.Value)] = a
+	}
+
+	// validate the outcome as a whole before writing anything
+	resultingByValue := make(map[string]*models.Alias, len(existing)+len(aliases))
+	resulting := make([]*models.Alias, 0, len(existing)+len(aliases))
+	for _, a := range aliases {
+		resultingByValue[fmt.Sprintf("%d:%s", a.Type, a.Value)] = a
+	}
+	stale := make([]uint, 0)
+	for _, a := range existing {
+		if _, ok := resultingByValue[fmt.Sprintf("%d:%s", a.Type, a.Value)]; ok {
+			continue
+		}
+		if replace {
+			stale = append(stale, a.ID)
+		} else {
+			resulting = append(resulting, a)
+		}
+	}
+	for _, a := range aliases {
+		if resultingByValue[fmt.Sprintf("%d:%s", a.Type, a.Value)] == a {
+			resulting = append(resulting, a)
+		}
+	}
+	if err := srv.validate(existing, resulting); err != nil {
+		return nil, err
+	}
+
+	result := &models.AliasRulesResult{}
+	// reload entire cache once all rules were applied, even if failing midway
+	defer srv.MayInitializeUser(userId)
+
+	// stale aliases are deleted first, so that the stored ones never exceed the limit or form a cycle
+	if len(stale) > 0 {
+		if err := srv.repository.DeleteBatch(stale); err != nil {
+			return result, err
+		}
+		result.Deleted = len(stale)
+	}
+
+	for _, a := range aliases {
+		if a.UserID != userId {
+			return result, errors.New("alias user id mismatch")
+		}
+
+		old, ok := existingByValue[fmt.Sprintf("%d:%s", a.Type, a.Value)]
+		if ok && old.Key == a.Key {
+			result.Unchanged++
+			continue
+		}
+		if ok {
+			if err := srv.repository.Delete(old.ID); err != nil {
+				return result, err
+			}
+		}
+		if _, err := srv.repository.Insert(a); err != nil {
+			return result, err
+		}
+
+		if ok {
+			result.Updated++
+		} else {
+			result.Created++
+		}
+	}
+
+	return result, nil
+}
+
+// validate checks a user's resulting set of aliases against the per-type limit and for cycles.
+// The limit only applies to types that would grow, so users above a since lowered limit can still update their aliases.
+func (srv *AliasService) validate(existing, resulting []*models.Alias) error {
+	if maxAliases := srv.config.App.MaxAliasesPerType; maxAliases > 0 {
+		countBefore, countAfter := countAliasesByType(existing), countAliasesByType(resulting)
+		for t, n := range countAfter {
+			if n > maxAliases && n > countBefore[t] {
+				return fmt.Errorf("%w (at most %d per type)", ErrAliasLimitExceeded, maxAliases)
+			}
+		}
+	}
+
+	if cycle := findAliasCycle(resulting); cycle != nil {
+		return fmt.Errorf("%w (%s)", ErrAliasCycle, strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
+
 func (srv *AliasService) updateCache(reason *models.Alias, removal bool) {
 	if !removal {
 		if aliases, ok := userAliases.Load(reason.UserID); ok {
@@ -184,3 +307,73 @@ func (srv *AliasService) getFiltered(userId string, check func(alias *models.Ali
 		return nil, errors.New(fmt.Sprintf("no user aliases loaded for user %s", userId))
 	}
 }
+
+func countAliasesByType(aliases []*models.Alias) map[uint8]int {
+	counts := make(map[uint8]int)
+	for _, a := range aliases {
+		counts[a.Type]++
+	}
+	return counts
+}
+
+// findAliasCycle returns the keys forming a cycle among the given aliases, e.g. [a, b, a] if a is mapped to b and b is mapped back to a, or nil if there is none.
+// Key x leads to key y if x itself is matched by one of y's original names (including wildcards).
+func findAliasCycle(aliases []*models.Alias) []string {
+	for _, summaryType := range models.SummaryTypes() {
+		keys := make([]string, 0)
+		next := make(map[string][]string)
+
+		for _, a := range aliases {
+			if a.Type == summaryType {
+				if _, ok := next[a.Key]; !ok {
+					keys = append(keys, a.Key)
+					next[a.Key] = []string{}
+				}
+			}
+		}
+
+		for _, a := range aliases {
+			if a.Type != summaryType {
+				continue
+			}
+			matcher := wildmatch.NewWildMatch(a.Value)
+			for _, k := range keys {
+				if k != a.Key && matcher.IsMatch(k) {
+					next[k] = append(next[k], a.Key)
+				}
+			}
+		}
+
+		visited := make(map[string]bool)
+		onPath := make(map[string]int) // key -> position in path
+		path := make([]string, 0)
+
+		var visit func(k string) []string
+		visit = func(k string) []string {
+			if i, ok := onPath[k]; ok {
+				return append(append([]string{}, path[i:]...), k)
+			}
+			if visited[k] {
+				return nil
+			}
+			visited[k] = true
+			onPath[k] = len(path)
+			path = append(path, k)
+			for _, n := range next[k] {
+				if cycle := visit(n); cycle != nil {
+					return cycle
+				}
+			}
+			path = path[:len(path)-1]
+			delete(onPath, k)
+			return nil
+		}
+
+		for _, k := range keys {
+			if cycle := visit(k); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+)
+
+var (
+	ErrAliasRecomputeInProgress = errors.New("recompute already in progress, please wait")
+	ErrAliasRecomputeRange      = errors.New("invalid recompute range, from must be before to and at most 366 days apart")
+)
+
+// AliasRecomputeService retroactively applies a user's aliases to the given range by flushing their cached summaries and regenerating the persisted ones day by day in the background.
+// The state of each user's most recent recompute is kept in memory only, so it's lost on restart.
+type AliasRecomputeService struct {
+	config          *config.Config
+	aggregationSrvc IAggregationService
+	summarySrvc     ISummaryService
+	recomputes      map[string]*models.AliasRecompute
+	lock            sync.RWMutex
+}
+
+func NewAliasRecomputeService(aggregationService IAggregationService, summaryService ISummaryService) *AliasRecomputeService {
+	return &AliasRecomputeService{
+		config:          config.Get(),
+		aggregationSrvc: aggregationService,
+		summarySrvc:     summaryService,
+		recomputes:      map[string]*models.AliasRecompute{},
+	}
+}
+
+// Start kicks off recomputing the user's summaries between from and to (capped at the beginning of today) and returns the initial state, which can subsequently be polled for using GetStatus
+func (srv *AliasRecomputeService) Start(user *models.User, from, to time.Time) (*models.AliasRecompute, error) {
+	if !from.Before(to) || to.Sub(from) > models.AliasRecomputeMaxDays*24*time.Hour {
+		return nil, ErrAliasRecomputeRange
+	}
+
+	// today's (incomplete) summary isn't persisted anyway, and summaries are persisted per server-local day, regardless of the user's time zone
+	if today := utils.BeginOfToday(time.Local); to.After(today) {
+		to = today
+	}
+	if from.After(to) {
+		from = to
+	}
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if existing, ok := srv.recomputes[user.ID]; ok && existing.IsRunning() {
+		return nil, ErrAliasRecomputeInProgress
+	}
+
+	recompute := &models.AliasRecompute{
+		Status:    models.AliasRecomputeRunning,
+		From:      from,
+		To:        to,
+		DaysTotal: len(utils.SplitRangeByDays(utils.FloorDate(from.In(time.Local)), utils.CeilDate(to.In(time.Local)))),
+		StartedAt: time.Now(),
+	}
+	srv.recomputes[user.ID] = recompute
+
+	// aliases are resolved whenever summaries are retrieved, so flushing the cache already takes effect for most summaries, while the regeneration catches up on all the rest
+	srv.summarySrvc.FlushCache(user.ID)
+
+	go srv.run(user, recompute)
+
+	return srv.copy(recompute), nil
+}
+
+// GetStatus returns the state of the user's most recent recompute, or nil if there wasn't any since the server was started
+func (srv *AliasRecomputeService) GetStatus(userId string) *models.AliasRecompute {
+	srv.lock.RLock()
+	defer srv.lock.RUnlock()
+	if recompute, ok := srv.recomputes[userId]; ok {
+		return srv.copy(recompute)
+	}
+	return nil
+}
+
+func (srv *AliasRecomputeService) run(user *models.User, recompute *models.AliasRecompute) {
+	_, err := srv.aggregationSrvc.RegenerateSummaries(user, recompute.From, recompute.To, func(done, all int) {
+		srv.lock.Lock()
+		defer srv.lock.Unlock()
+		recompute.DaysDone = done
+		recompute.DaysTotal = all
+		recompute.Progress = float64(done) / float64(all)
+	})
+
+	srv.summarySrvc.FlushCache(user.ID)
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	now := time.Now()
+	recompute.FinishedAt = &now
+	recompute.Status = models.AliasRecomputeFinished
+	if err != nil {
+		config.Log().Error("failed to recompute summaries", "userID", user.ID, "from", recompute.From, "to", recompute.To, "error", err)
+		recompute.Status = models.AliasRecomputeFailed
+		recompute.Error = err.Error()
+	} else {
+		recompute.Progress = 1
+	}
+}
+
+func (srv *AliasRecomputeService) copy(recompute *models.AliasRecompute) *models.AliasRecompute {
+	result := *recompute
+	return &result
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAliasRecomputeService_Start(t *testing.T) {
+	config.Set(config.Empty())
+
+	local := time.Local
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+	defer func() { time.Local = local }()
+
+	user := &models.User{ID: "john", Location: "America/New_York"}
+	to := utils.BeginOfToday(time.Local) // not the user's
+	from := to.AddDate(0, 0, -2)
+
+	release := make(chan struct{})
+
+	aggregationServiceMock := new(mocks.AggregationServiceMock)
+	aggregationServiceMock.On("RegenerateSummaries", user, from, to, mock.Anything).Run(func(args mock.Arguments) {
+		progress := args.Get(3).(func(int, int))
+		progress(1, 2)
+		<-release
+		progress(2, 2)
+	}).Return(2, nil)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("FlushCache", user.ID).Return(0)
+
+	sut := NewAliasRecomputeService(aggregationServiceMock, summaryServiceMock)
+
+	assert.Nil(t, sut.GetStatus(user.ID))
+
+	_, err := sut.Start(user, to, from)
+	assert.ErrorIs(t, err, ErrAliasRecomputeRange)
+	_, err = sut.Start(user, to.AddDate(-2, 0, 0), to)
+	assert.ErrorIs(t, err, ErrAliasRecomputeRange)
+
+	// today is excluded
+	result, err := sut.Start(user, from, to.AddDate(0, 0, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, models.AliasRecomputeRunning, result.Status)
+	assert.Equal(t, to, result.To)
+	assert.Equal(t, 2, result.DaysTotal)
+
+	assert.Eventually(t, func() bool { return sut.GetStatus(user.ID).DaysDone == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0.5, sut.GetStatus(user.ID).Progress)
+
+	_, err = sut.Start(user, from, to)
+	assert.ErrorIs(t, err, ErrAliasRecomputeInProgress)
+
+	close(release)
+
+	assert.Eventually(t, func() bool { return !sut.GetStatus(user.ID).IsRunning() }, time.Second, 10*time.Millisecond)
+	status := sut.GetStatus(user.ID)
+	assert.Equal(t, models.AliasRecomputeFinished, status.Status)
+	assert.Equal(t, 2, status.DaysDone)
+	assert.Equal(t, 1.0, status.Progress)
+	assert.NotNil(t, status.FinishedAt)
+	summaryServiceMock.AssertNumberOfCalls(t, "FlushCache", 2)
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/mocks"
 	"github.com/muety/wakapi/models"
 	"github.com/stretchr/testify/assert"
@@ -16,6 +17,7 @@ type AliasServiceTestSuite struct {
 }
 
 func (suite *AliasServiceTestSuite) SetupSuite() {
+	config.Set(config.Empty())
 	suite.TestUserId = "johndoe@example.org"
 
 	aliases := []*models.Alias{
@@ -64,3 +66,156 @@ func (suite *AliasServiceTestSuite) TestAliasService_GetAliasOrDefault() {
 	assert.Equal(suite.T(), "telepush-mobile", result5)
 	assert.Nil(suite.T(), err5)
 }
+
+func (suite *AliasServiceTestSuite) TestAliasService_ApplyRules() {
+	aliasRepoMock := new(mocks.AliasRepositoryMock)
+	aliasRepoMock.On("GetByUser", suite.TestUserId).Return([]*models.Alias{
+		{ID: 1, Type: models.SummaryProject, UserID: suite.TestUserId, Key: "wakapi", Value: "wakapi-mobile"},
+		{ID: 2, Type: models.SummaryProject, UserID: suite.TestUserId, Key: "telepush", Value: "telepush-*"},
+	}, nil)
+	aliasRepoMock.On("Delete", uint(2)).Return(nil)
+	aliasRepoMock.On("Insert", mock.Anything).Return(&models.Alias{}, nil)
+
+	sut := NewAliasService(aliasRepoMock)
+
+	result, err := sut.ApplyRules(suite.TestUserId, []*models.Alias{
+		{Type: models.SummaryProject, UserID: suite.TestUserId, Key: "wakapi", Value: "wakapi-mobile"},
+		{Type: models.SummaryProject, UserID: suite.TestUserId, Key: "telepush-all", Value: "telepush-*"},
+		{Type: models.SummaryLanguage, UserID: suite.TestUserId, Key: "Go", Value: "golang"},
+	})
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), &models.AliasRulesResult{Created: 1, Updated: 1, Unchanged: 1}, result)
+	aliasRepoMock.AssertNumberOfCalls(suite.T(), "Delete", 1)
+	aliasRepoMock.AssertNumberOfCalls(suite.T(), "Insert", 2)
+}
+
+func (suite *AliasServiceTestSuite) TestAliasService_Create_LimitExceeded() {
+	userId := "limited@example.org"
+
+	cfg := config.Empty()
+	cfg.App.MaxAliasesPerType = 2
+	config.Set(cfg)
+	defer config.Set(config.Empty())
+
+	aliasRepoMock := new(mocks.AliasRepositoryMock)
+	aliasRepoMock.On("GetByUser", userId).Return([]*models.Alias{
+		{ID: 1, Type: models.SummaryProject, UserID: userId, Key: "wakapi", Value: "wakapi-mobile"},
+		{ID: 2, Type: models.SummaryProject, UserID: userId, Key: "telepush", Value: "telepush-*"},
+	}, nil)
+	aliasRepoMock.On("Insert", mock.Anything).Return(&models.Alias{}, nil)
+
+	sut := NewAliasService(aliasRepoMock)
+
+	_, err := sut.Create(&models.Alias{Type: models.SummaryProject, UserID: userId, Key: "anchr", Value: "anchr-web"})
+	assert.ErrorIs(suite.T(), err, ErrAliasLimitExceeded)
+	aliasRepoMock.AssertNotCalled(suite.T(), "Insert", mock.Anything)
+
+	_, err = sut.Create(&models.Alias{Type: models.SummaryLanguage, UserID: userId, Key: "Go", Value: "golang"})
+	assert.Nil(suite.T(), err)
+	aliasRepoMock.AssertNumberOfCalls(suite.T(), "Insert", 1)
+}
+
+func (suite *AliasServiceTestSuite) TestAliasService_Create_Cycle() {
+	userId := "cyclic@example.org"
+
+	aliasRepoMock := new(mocks.AliasRepositoryMock)
+	aliasRepoMock.On("GetByUser", userId).Return([]*models.Alias{
+		{ID: 1, Type: models.SummaryProject, UserID: userId, Key: "wakapi", Value: "wakapi-mobile"},
+	}, nil)
+	aliasRepoMock.On("Insert", mock.Anything).Return(&models.Alias{}, nil)
+
+	sut := NewAliasService(aliasRepoMock)
+
+	_, err := sut.Create(&models.Alias{Type: models.SummaryProject, UserID: userId, Key: "wakapi-mobile", Value: "wakapi"})
+	assert.ErrorIs(suite.T(), err, ErrAliasCycle)
+	aliasRepoMock.AssertNotCalled(suite.T(), "Insert", mock.Anything)
+}
+
+func (suite *AliasServiceTestSuite) TestAliasService_ApplyRules_Invalid() {
+	cfg := config.Empty()
+	cfg.App.MaxAliasesPerType = 3
+	config.Set(cfg)
+	defer config.Set(config.Empty())
+
+	aliasRepoMock := new(mocks.AliasRepositoryMock)
+	aliasRepoMock.On("GetByUser", suite.TestUserId).Return([]*models.Alias{
+		{ID: 1, Type: models.SummaryProject, UserID: suite.TestUserId, Key: "wakapi", Value: "wakapi-mobile"},
+		{ID: 2, Type: models.SummaryProject, UserID: suite.TestUserId, Key: "telepush", Value: "telepush-*"},
+	}, nil)
+
+	sut := NewAliasService(aliasRepoMock)
+
+	// replacing an existing alias does not count towards the limit
+	_, err := sut.ApplyRules(suite.TestUserId, []*models.Alias{
+		{Type: models.SummaryProject, UserID: suite.TestUserId, Key: "telepush-all", Value: "telepush-*"},
+		{Type: models.SummaryProject, UserID: suite.TestUserId, Key: "anchr", Value: "anchr-web"},
+		{Type: models.SummaryProject, UserID: suite.TestUserId, Key: "wakapi", Value: "wakapi-web"},
+	})
+	assert.ErrorIs(suite.T(), err, ErrAliasLimitExceeded)
+
+	_, err = sut.ApplyRules(suite.TestUserId, []*models.Alias{
+		{Type: models.SummaryProject, UserID: suite.TestUserId, Key: "wakapi-mobile", Value: "wakapi"},
+	})
+	assert.ErrorIs(suite.T(), err, ErrAliasCycle)
+
+	aliasRepoMock.AssertNotCalled(suite.T(), "Delete", mock.Anything)
+	aliasRepoMock.AssertNotCalled(suite.T(), "Insert", mock.Anything)
+}
+
+func (suite *AliasServiceTestSuite) TestAliasService_ReplaceRules() {
+	cfg := config.Empty()
+	cfg.App.MaxAliasesPerType = 2
+	config.Set(cfg)
+	defer config.Set(config.Empty())
+
+	aliasRepoMock := new(mocks.AliasRepositoryMock)
+	aliasRepoMock.On("GetByUser", suite.TestUserId).Return([]*models.Alias{
+		{ID: 1, Type: models.SummaryProject, UserID: suite.TestUserId, Key: "wakapi", Value: "wakapi-mobile"},
+		{ID: 2, Type: models.SummaryProject, UserID: suite.TestUserId, Key: "telepush", Value: "telepush-*"},
+	}, nil)
+	aliasRepoMock.On("DeleteBatch", []uint{2}).Return(nil)
+	aliasRepoMock.On("Insert", mock.Anything).Return(&models.Alias{}, nil)
+
+	sut := NewAliasService(aliasRepoMock)
+
+	// would exceed the limit and form a cycle together with the existing aliases, but these are replaced
+	result, err := sut.ReplaceRules(suite.TestUserId, []*models.Alias{
+		{Type: models.SummaryProject, UserID: suite.TestUserId, Key: "wakapi", Value: "wakapi-mobile"},
+		{Type: models.SummaryProject, UserID: suite.TestUserId, Key: "telepush-*", Value: "telepush"},
+	})
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), &models.AliasRulesResult{Created: 1, Unchanged: 1, Deleted: 1}, result)
+	aliasRepoMock.AssertCalled(suite.T(), "DeleteBatch", []uint{2})
+	aliasRepoMock.AssertNumberOfCalls(suite.T(), "Insert", 1)
+}
+
+func TestFindAliasCycle(t *testing.T) {
+	alias := func(key, value string) *models.Alias {
+		return &models.Alias{Type: models.SummaryProject, Key: key, Value: value}
+	}
+
+	assert.Nil(t, findAliasCycle([]*models.Alias{
+		alias("wakapi", "wakapi-mobile"),
+		alias("wakapi", "wakapi-*"), // matches its own key
+		alias("wakapi-mobile", "wakapi-ios"),
+	}))
+	assert.Nil(t, findAliasCycle([]*models.Alias{
+		alias("Go", "golang"),
+		{Type: models.SummaryLanguage, Key: "golang", Value: "Go"}, // different type
+	}))
+	assert.Equal(t, []string{"b", "a", "b"}, findAliasCycle([]*models.Alias{
+		alias("b", "a"),
+		alias("a", "b"),
+	}))
+	assert.Equal(t, []string{"a", "b", "c", "a"}, findAliasCycle([]*models.Alias{
+		alias("a", "c"),
+		alias("b", "a"),
+		alias("c", "b"),
+	}))
+	assert.Equal(t, []string{"telepush", "telepush-all", "telepush"}, findAliasCycle([]*models.Alias{
+		alias("telepush", "telepush-*"),
+		alias("telepush-all", "telepush"),
+	}))
+}
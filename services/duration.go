@@ -3,32 +3,73 @@ package services
 import (
 	"github.com/duke-git/lancet/v2/datetime"
 	"github.com/duke-git/lancet/v2/mathutil"
+	"github.com/duke-git/lancet/v2/slice"
 	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"sort"
 	"time"
 )
 
 type DurationService struct {
-	config           *config.Config
-	heartbeatService IHeartbeatService
+	config                      *config.Config
+	heartbeatService            IHeartbeatService
+	projectDefaultBranchService IProjectDefaultBranchService
 }
 
-func NewDurationService(heartbeatService IHeartbeatService) *DurationService {
+func NewDurationService(heartbeatService IHeartbeatService, projectDefaultBranchService IProjectDefaultBranchService) *DurationService {
 	srv := &DurationService{
-		config:           config.Get(),
-		heartbeatService: heartbeatService,
+		config:                      config.Get(),
+		heartbeatService:            heartbeatService,
+		projectDefaultBranchService: projectDefaultBranchService,
 	}
 	return srv
 }
 
 func (srv *DurationService) Get(from, to time.Time, user *models.User, filters *models.Filters) (models.Durations, error) {
+	return srv.get(from, to, user, filters, false)
+}
+
+// GetWithEntities computes durations the same way as Get, but additionally splits them up by entity (e.g. file), that is, switching between two files starts a new duration
+func (srv *DurationService) GetWithEntities(from, to time.Time, user *models.User, filters *models.Filters) (models.Durations, error) {
+	return srv.get(from, to, user, filters, true)
+}
+
+func (srv *DurationService) get(from, to time.Time, user *models.User, filters *models.Filters, withEntities bool) (models.Durations, error) {
 	heartbeatsTimeout := user.HeartbeatsTimeout()
 
-	heartbeats, err := srv.heartbeatService.GetAllWithin(from, to, user)
+	// the daily cap is cut off at the same point, no matter the requested range, only if computed over whole days
+	dailyCap := user.DailyProjectCap()
+	fetchFrom, fetchTo := from, to
+	if dailyCap > 0 {
+		fetchFrom, fetchTo = utils.FloorDate(from.In(user.TZ())), utils.CeilDate(to.In(user.TZ()))
+	}
+
+	heartbeats, err := srv.heartbeatService.GetAllWithin(fetchFrom, fetchTo, user)
 	if err != nil {
 		return nil, err
 	}
 
+	// unlike other filters, this one applies to heartbeats, i.e. only the time between two consecutive writes (within the timeout) counts
+	if filters != nil && filters.WriteOnly {
+		heartbeats = slice.Filter(heartbeats, func(_ int, h *models.Heartbeat) bool {
+			return h.IsWrite
+		})
+	}
+
+	defaultBranches, err := srv.projectDefaultBranchService.GetMapped(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// heartbeats with identical timestamps (e.g. sent in a burst) are processed in the order they were inserted in, so that results are reproducible
+	sort.SliceStable(heartbeats, func(i, j int) bool {
+		if heartbeats[i].Time.T().Equal(heartbeats[j].Time.T()) {
+			return heartbeats[i].ID < heartbeats[j].ID
+		}
+		return heartbeats[i].Time.T().Before(heartbeats[j].Time.T())
+	})
+
 	// Aggregation
 	// the below logic is approximately equivalent to the SQL query at scripts/aggregate_durations_mysql.sql
 	// a postgres-compatible script was contributed by @cwilby and is available at scripts/aggregate_durations_postgres.sql
@@ -36,19 +77,50 @@ func (srv *DurationService) Get(from, to time.Time, user *models.User, filters *
 	// think about adding a distrinctio here to use pure-sql aggregation for mysql and postgres, and traditional, programmatic
 	// aggregation for all other databases
 	var count int
-	var latest *models.Duration
+
+	// heartbeats are grouped into durations along separate timelines, i.e. the time until the respective next heartbeat is attributed to the previous one
+	// by default, all heartbeats share a single timeline, so that parallel activity on multiple machines is merged into wall-clock time
+	// alternatively, every machine gets a timeline of its own, so that parallel activity adds up
+	latestByTimeline := make(map[string]*models.Duration)
+	previousByTimeline := make(map[string]*models.Heartbeat)
 
 	mapping := make(map[string][]*models.Duration)
 
 	for _, h := range heartbeats {
-		d1 := models.NewDurationFromHeartbeat(h).WithEntityIgnored().Hashed()
+		var timeline string
+		if user.CountsMachinesAdditively() {
+			timeline = h.Machine
+		}
+
+		// optionally, only the first of multiple heartbeats with identical timestamps for the same entity is considered
+		if srv.config.App.CollapseSameTimestamps {
+			if previous := previousByTimeline[timeline]; previous != nil && previous.Entity == h.Entity && previous.Time.T().Equal(h.Time.T()) {
+				continue
+			}
+			previousByTimeline[timeline] = h
+		}
+
+		d1 := models.NewDurationFromHeartbeat(h)
+		// unknown branches are replaced before grouping and filtering, so that they merge with and are matched as their project's default branch
+		defaultBranch, hasDefaultBranch := defaultBranches[d1.Project]
+		normalizeBranch := hasDefaultBranch && srv.config.App.IsUnknownBranch(d1.Branch)
+		if normalizeBranch {
+			d1.Branch = defaultBranch
+		}
+		if !withEntities {
+			d1 = d1.WithEntityIgnored()
+		}
+		if normalizeBranch || !withEntities {
+			d1 = d1.Hashed()
+		}
 
 		if list, ok := mapping[d1.GroupHash]; !ok || len(list) < 1 {
 			mapping[d1.GroupHash] = []*models.Duration{d1}
 		}
 
+		latest := latestByTimeline[timeline]
 		if latest == nil {
-			latest = d1
+			latestByTimeline[timeline] = d1
 			continue
 		}
 
@@ -76,7 +148,7 @@ func (srv *DurationService) Get(from, to time.Time, user *models.User, filters *
 			if d0 := list[len(list)-1]; d0 != d1 {
 				mapping[d1.GroupHash] = append(mapping[d1.GroupHash], d1)
 			}
-			latest = d1
+			latestByTimeline[timeline] = d1
 		} else {
 			latest.NumHeartbeats++
 		}
@@ -88,18 +160,6 @@ func (srv *DurationService) Get(from, to time.Time, user *models.User, filters *
 
 	for _, list := range mapping {
 		for _, d := range list {
-			// even when filters are applied, we'll still have to compute the whole summary first and then filter out non-matching durations
-			// if we fetched only matching heartbeats in the first place, there will be false positive gaps (see DefaultHeartbeatsTimeout)
-			// in case the user worked on different projects in parallel
-			// see https://github.com/muety/wakapi/issues/535
-			if filters != nil && !filters.MatchDuration(d) {
-				continue
-			}
-
-			if user.ExcludeUnknownProjects && d.Project == "" {
-				continue
-			}
-
 			// will only happen if two heartbeats with different hashes (e.g. different project) have the same timestamp
 			// that, in turn, will most likely only happen for mysql, where `time` column's precision was set to second for a while
 			// assume that two non-identical heartbeats with identical time are sub-second apart from each other, so round up to expectancy value
@@ -111,6 +171,22 @@ func (srv *DurationService) Get(from, to time.Time, user *models.User, filters *
 		}
 	}
 
+	// has to happen before filtering, so that time is always cut off at the same point, no matter which part of a project's durations is requested
+	if dailyCap > 0 {
+		durations = durations.CappedPerProjectAndDay(dailyCap, user.TZ()).Clipped(from, to)
+	}
+
+	// even when filters are applied, we'll still have to compute the whole summary first and then filter out non-matching durations
+	// if we fetched only matching heartbeats in the first place, there will be false positive gaps (see DefaultHeartbeatsTimeout)
+	// in case the user worked on different projects in parallel
+	// see https://github.com/muety/wakapi/issues/535
+	durations = slice.Filter(durations, func(_ int, d *models.Duration) bool {
+		if filters != nil && !filters.MatchDuration(d) {
+			return false
+		}
+		return !user.ExcludeUnknownProjects || d.Project != ""
+	})
+
 	if len(heartbeats) == 1 && len(durations) == 1 {
 		durations[0].Duration = heartbeatsTimeout
 	}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/mocks"
 	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"math/rand"
@@ -37,14 +39,16 @@ const (
 
 type DurationServiceTestSuite struct {
 	suite.Suite
-	TestUser         *models.User
-	TestStartTime    time.Time
-	TestHeartbeats   []*models.Heartbeat
-	TestLabels       []*models.ProjectLabel
-	HeartbeatService *mocks.HeartbeatServiceMock
+	TestUser                    *models.User
+	TestStartTime               time.Time
+	TestHeartbeats              []*models.Heartbeat
+	TestLabels                  []*models.ProjectLabel
+	HeartbeatService            *mocks.HeartbeatServiceMock
+	ProjectDefaultBranchService *mocks.ProjectDefaultBranchServiceMock
 }
 
 func (suite *DurationServiceTestSuite) SetupSuite() {
+	config.Set(config.Empty())
 	suite.TestUser = &models.User{ID: TestUserId}
 
 	// https://anchr.io/i/F0HEK.jpg
@@ -126,6 +130,10 @@ func (suite *DurationServiceTestSuite) SetupSuite() {
 
 func (suite *DurationServiceTestSuite) BeforeTest(suiteName, testName string) {
 	suite.HeartbeatService = new(mocks.HeartbeatServiceMock)
+	suite.ProjectDefaultBranchService = new(mocks.ProjectDefaultBranchServiceMock)
+	if testName != "TestDurationService_Get_DefaultBranches" {
+		suite.ProjectDefaultBranchService.On("GetMapped", TestUserId).Return(map[string]string{}, nil)
+	}
 }
 
 func TestDurationServiceTestSuite(t *testing.T) {
@@ -134,7 +142,7 @@ func TestDurationServiceTestSuite(t *testing.T) {
 
 func (suite *DurationServiceTestSuite) TestDurationService_Get() {
 	// https://anchr.io/i/F0HEK.jpg
-	sut := NewDurationService(suite.HeartbeatService)
+	sut := NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService)
 
 	var (
 		from      time.Time
@@ -183,7 +191,7 @@ func (suite *DurationServiceTestSuite) TestDurationService_Get() {
 }
 
 func (suite *DurationServiceTestSuite) TestDurationService_Get_Filtered() {
-	sut := NewDurationService(suite.HeartbeatService)
+	sut := NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService)
 
 	var (
 		from      time.Time
@@ -204,7 +212,7 @@ func (suite *DurationServiceTestSuite) TestDurationService_Get_Filtered() {
 }
 
 func (suite *DurationServiceTestSuite) TestDurationService_Get_CustomTimeout() {
-	sut := NewDurationService(suite.HeartbeatService)
+	sut := NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService)
 
 	var (
 		from      time.Time
@@ -254,6 +262,302 @@ func (suite *DurationServiceTestSuite) TestDurationService_Get_CustomTimeout() {
 	assert.Equal(suite.T(), 3, durations[1].NumHeartbeats)
 }
 
+func (suite *DurationServiceTestSuite) TestDurationService_Get_ParallelMachines() {
+	sut := NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService)
+
+	defer func() {
+		suite.TestUser.MachineOverlapMode = "" // revert to defaults
+	}()
+
+	// interleaved heartbeats from two machines, 10 seconds apart from each other
+	heartbeats := make([]*models.Heartbeat, 0, 8)
+	for i := 0; i < 8; i++ {
+		heartbeats = append(heartbeats, &models.Heartbeat{
+			ID:              rand.Uint64(),
+			UserID:          TestUserId,
+			Project:         TestProject1,
+			Language:        TestLanguageGo,
+			Editor:          TestEditorGoland,
+			OperatingSystem: TestOsLinux,
+			Machine:         []string{TestMachine1, TestMachine2}[i%2],
+			Time:            models.CustomTime(suite.TestStartTime.Add(time.Duration(i*10) * time.Second)), // 0:00, 0:10, ..., 1:10
+		})
+	}
+
+	from, to := suite.TestStartTime, suite.TestStartTime.Add(1*time.Hour)
+	suite.HeartbeatService.On("GetAllWithin", from, to, suite.TestUser).Return(heartbeats, nil)
+
+	totalByMachine := func(durations models.Durations) map[string]time.Duration {
+		totals := make(map[string]time.Duration)
+		for _, d := range durations {
+			totals[d.Machine] += d.Duration
+		}
+		return totals
+	}
+
+	/* Test 1 */
+	suite.TestUser.MachineOverlapMode = models.MachineOverlapMerge
+	durations, err := sut.Get(from, to, suite.TestUser, nil)
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), durations, 8)
+	assert.Equal(suite.T(), 40*time.Second, totalByMachine(durations)[TestMachine1])
+	assert.Equal(suite.T(), 30*time.Second+500*time.Millisecond, totalByMachine(durations)[TestMachine2]) // very last heartbeat is rounded up
+
+	/* Test 2 */
+	suite.TestUser.MachineOverlapMode = models.MachineOverlapAdditive
+	durations, err = sut.Get(from, to, suite.TestUser, nil)
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), durations, 2)
+	assert.Equal(suite.T(), 60*time.Second, totalByMachine(durations)[TestMachine1])
+	assert.Equal(suite.T(), 60*time.Second, totalByMachine(durations)[TestMachine2])
+	assert.Equal(suite.T(), 4, durations[0].NumHeartbeats)
+	assert.Equal(suite.T(), 4, durations[1].NumHeartbeats)
+}
+
+func (suite *DurationServiceTestSuite) TestDurationService_Get_DefaultBranches() {
+	cfg := config.Empty()
+	cfg.App.UnknownBranchPattern = "^HEAD$"
+	cfg.App.ParseUnknownBranchPattern()
+	config.Set(cfg)
+
+	sut := NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService)
+
+	heartbeat := func(project, branch string, offset time.Duration) *models.Heartbeat {
+		return &models.Heartbeat{
+			ID:       rand.Uint64(),
+			UserID:   TestUserId,
+			Project:  project,
+			Language: TestLanguageGo,
+			Branch:   branch,
+			Time:     models.CustomTime(suite.TestStartTime.Add(offset)),
+		}
+	}
+
+	heartbeats := []*models.Heartbeat{
+		heartbeat(TestProject1, TestBranchMaster, 0),            // 0:00
+		heartbeat(TestProject1, "HEAD", 30*time.Second),         // 0:30
+		heartbeat(TestProject1, "", 60*time.Second),             // 1:00
+		heartbeat(TestProject2, "HEAD", 90*time.Second),         // 1:30
+		heartbeat(TestProject2, TestBranchDev, 120*time.Second), // 2:00
+	}
+
+	from, to := suite.TestStartTime, suite.TestStartTime.Add(1*time.Hour)
+	suite.HeartbeatService.On("GetAllWithin", from, to, suite.TestUser).Return(heartbeats, nil)
+	suite.ProjectDefaultBranchService.On("GetMapped", TestUserId).Return(map[string]string{TestProject1: TestBranchMaster}, nil)
+
+	/* Test 1 */
+	durations, err := sut.Get(from, to, suite.TestUser, nil)
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), durations, 3)
+	assert.Equal(suite.T(), TestProject1, durations[0].Project)
+	assert.Equal(suite.T(), TestBranchMaster, durations[0].Branch) // unknown branches merged with default branch
+	assert.Equal(suite.T(), 90*time.Second, durations[0].Duration)
+	assert.Equal(suite.T(), 3, durations[0].NumHeartbeats)
+	assert.Equal(suite.T(), "HEAD", durations[1].Branch) // no default branch set for project
+	assert.Equal(suite.T(), TestBranchDev, durations[2].Branch)
+
+	/* Test 2 */
+	durations, err = sut.Get(from, to, suite.TestUser, models.NewFiltersWith(models.SummaryBranch, TestBranchMaster))
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), durations, 1)
+	assert.Equal(suite.T(), 90*time.Second, durations[0].Duration)
+}
+
+func (suite *DurationServiceTestSuite) TestDurationService_Get_WriteOnly() {
+	config.Set(config.Empty())
+
+	sut := NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService)
+
+	heartbeat := func(isWrite bool, offset time.Duration) *models.Heartbeat {
+		return &models.Heartbeat{
+			ID:       rand.Uint64(),
+			UserID:   TestUserId,
+			Project:  TestProject1,
+			Language: TestLanguageGo,
+			IsWrite:  isWrite,
+			Time:     models.CustomTime(suite.TestStartTime.Add(offset)),
+		}
+	}
+
+	heartbeats := []*models.Heartbeat{
+		heartbeat(false, 0),               // 0:00
+		heartbeat(false, 30*time.Second),  // 0:30
+		heartbeat(true, 60*time.Second),   // 1:00
+		heartbeat(true, 90*time.Second),   // 1:30
+		heartbeat(false, 120*time.Second), // 2:00
+	}
+
+	from, to := suite.TestStartTime, suite.TestStartTime.Add(1*time.Hour)
+	suite.HeartbeatService.On("GetAllWithin", from, to, suite.TestUser).Return(heartbeats, nil)
+
+	/* Test 1 */
+	durations, err := sut.Get(from, to, suite.TestUser, nil)
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), durations, 1)
+	assert.Equal(suite.T(), 120*time.Second, durations[0].Duration)
+
+	/* Test 2 */
+	durations, err = sut.Get(from, to, suite.TestUser, &models.Filters{WriteOnly: true})
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), durations, 1)
+	assert.Equal(suite.T(), 30*time.Second, durations[0].Duration)
+	assert.Equal(suite.T(), 2, durations[0].NumHeartbeats)
+}
+
+func (suite *DurationServiceTestSuite) TestDurationService_Get_SameTimestamps() {
+	cfg := config.Empty()
+	config.Set(cfg)
+	defer func() {
+		cfg.App.CollapseSameTimestamps = false
+	}()
+
+	sut := NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService)
+
+	heartbeat := func(id uint64, project, entity string, offset time.Duration) *models.Heartbeat {
+		return &models.Heartbeat{
+			ID:       id,
+			UserID:   TestUserId,
+			Project:  project,
+			Entity:   entity,
+			Language: TestLanguageGo,
+			Time:     models.CustomTime(suite.TestStartTime.Add(offset)),
+		}
+	}
+
+	// bursts of heartbeats with identical timestamps
+	heartbeats := []*models.Heartbeat{
+		heartbeat(1, TestProject1, TestEntity1, 0),              // 0:00
+		heartbeat(2, TestProject2, TestEntity2, 0),              // 0:00
+		heartbeat(3, TestProject1, TestEntity1, 30*time.Second), // 0:30
+		heartbeat(4, TestProject1, TestEntity1, 30*time.Second), // 0:30
+		heartbeat(5, TestProject2, TestEntity2, 30*time.Second), // 0:30
+		heartbeat(6, TestProject3, TestEntity2, 60*time.Second), // 1:00
+		heartbeat(7, TestProject1, TestEntity1, 60*time.Second), // 1:00
+		heartbeat(8, TestProject1, TestEntity1, 90*time.Second), // 1:30
+	}
+
+	type result struct {
+		Project       string
+		Time          time.Time
+		Duration      time.Duration
+		NumHeartbeats int
+	}
+
+	toResults := func(durations models.Durations) []result {
+		results := make([]result, len(durations))
+		for i, d := range durations {
+			results[i] = result{d.Project, d.Time.T(), d.Duration, d.NumHeartbeats}
+		}
+		return results
+	}
+
+	getShuffled := func() []result {
+		shuffled := make([]*models.Heartbeat, len(heartbeats))
+		for i, j := range rand.Perm(len(heartbeats)) {
+			hb := *heartbeats[j]
+			shuffled[i] = &hb
+		}
+
+		from, to := suite.TestStartTime, suite.TestStartTime.Add(1*time.Hour)
+		suite.HeartbeatService.On("GetAllWithin", from, to, suite.TestUser).Return(shuffled, nil).Once()
+
+		durations, err := sut.Get(from, to, suite.TestUser, nil)
+		assert.Nil(suite.T(), err)
+		return toResults(durations)
+	}
+
+	/* Test 1 */
+	expected := getShuffled()
+	assert.Len(suite.T(), expected, 6)
+	for i := 0; i < 20; i++ {
+		assert.Equal(suite.T(), expected, getShuffled())
+	}
+
+	/* Test 2 */
+	cfg.App.CollapseSameTimestamps = true
+
+	expected = getShuffled()
+	assert.Len(suite.T(), expected, 6)
+	for i := 0; i < 20; i++ {
+		assert.Equal(suite.T(), expected, getShuffled())
+	}
+
+	var total int
+	for _, r := range expected {
+		total += r.NumHeartbeats
+	}
+	assert.Equal(suite.T(), len(heartbeats)-1, total) // second heartbeat of the same entity at 0:30 dropped
+}
+
+func (suite *DurationServiceTestSuite) TestDurationService_Get_DailyProjectCap() {
+	config.Set(config.Empty())
+
+	sut := NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService)
+
+	defer func() {
+		suite.TestUser.DailyProjectCapHours = 0
+	}()
+
+	// editor left open for 10 hours, switching languages after 5 hours
+	heartbeats := make([]*models.Heartbeat, 0)
+	for i := 0; i <= 10*60; i++ {
+		language := TestLanguageGo
+		if i >= 5*60 {
+			language = TestLanguageJava
+		}
+		heartbeats = append(heartbeats, &models.Heartbeat{
+			ID:       rand.Uint64(),
+			UserID:   TestUserId,
+			Project:  TestProject1,
+			Language: language,
+			Time:     models.CustomTime(suite.TestStartTime.Add(time.Duration(i) * time.Minute)),
+		})
+	}
+
+	from, to := suite.TestStartTime, suite.TestStartTime.Add(12*time.Hour)
+	suite.HeartbeatService.On("GetAllWithin", from, to, suite.TestUser).Return(heartbeats, nil)
+	suite.HeartbeatService.On("GetAllWithin", utils.FloorDate(from), utils.CeilDate(to), suite.TestUser).Return(heartbeats, nil) // whole days when capped
+
+	total := func(durations models.Durations) (sum time.Duration) {
+		for _, d := range durations {
+			sum += d.Duration
+		}
+		return sum
+	}
+
+	/* Test 1 */
+	durations, err := sut.Get(from, to, suite.TestUser, nil)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 10*time.Hour, total(durations))
+
+	/* Test 2 */
+	suite.TestUser.DailyProjectCapHours = 8
+	durations, err = sut.Get(from, to, suite.TestUser, nil)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 8*time.Hour, total(durations))
+
+	/* Test 3 */
+	// cap applies to the project as a whole, not only to the filtered part of it
+	durations, err = sut.Get(from, to, suite.TestUser, models.NewFiltersWith(models.SummaryLanguage, TestLanguageJava))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 3*time.Hour, total(durations))
+
+	/* Test 4 */
+	// cap applies to the day as a whole, not only to the requested part of it
+	durationsBefore, err := sut.Get(from, from.Add(6*time.Hour), suite.TestUser, nil)
+	assert.Nil(suite.T(), err)
+	durationsAfter, err := sut.Get(from.Add(6*time.Hour), to, suite.TestUser, nil)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 6*time.Hour, total(durationsBefore))
+	assert.Equal(suite.T(), 2*time.Hour, total(durationsAfter))
+}
+
 func filterHeartbeats(from, to time.Time, heartbeats []*models.Heartbeat) []*models.Heartbeat {
 	filtered := make([]*models.Heartbeat, 0, len(heartbeats))
 	for _, h := range heartbeats {
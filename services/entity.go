@@ -0,0 +1,56 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+)
+
+type EntityService struct {
+	config          *config.Config
+	durationService IDurationService
+}
+
+func NewEntityService(durationService IDurationService) *EntityService {
+	return &EntityService{
+		config:          config.Get(),
+		durationService: durationService,
+	}
+}
+
+// GetTop returns the entities (usually files) of the given project the user spent the most time with, sorted by total time in descending order
+// time is computed from entity-specific durations, so it isn't attributed to whichever file happened to be opened first after a break
+func (srv *EntityService) GetTop(from, to time.Time, user *models.User, project string, limit int) ([]*models.SummaryItem, error) {
+	durations, err := srv.durationService.GetWithEntities(from, to, user, models.NewFiltersWith(models.SummaryProject, project))
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]time.Duration)
+	for _, d := range durations {
+		totals[d.GetKey(models.SummaryEntity)] += d.Duration
+	}
+
+	items := make([]*models.SummaryItem, 0, len(totals))
+	for key, total := range totals {
+		items = append(items, &models.SummaryItem{
+			Type:  models.SummaryEntity,
+			Key:   key,
+			Total: total / time.Second,
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Total == items[j].Total {
+			return items[i].Key < items[j].Key
+		}
+		return items[i].Total > items[j].Total
+	})
+
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
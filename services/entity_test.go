@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityServiceTestSuite struct {
+	suite.Suite
+	TestUser                    *models.User
+	TestStartTime               time.Time
+	TestHeartbeats              []*models.Heartbeat
+	HeartbeatService            *mocks.HeartbeatServiceMock
+	ProjectDefaultBranchService *mocks.ProjectDefaultBranchServiceMock
+}
+
+func (suite *EntityServiceTestSuite) SetupSuite() {
+	suite.TestUser = &models.User{ID: TestUserId}
+	suite.TestStartTime = time.Unix(0, MinUnixTime1)
+
+	heartbeat := func(project, entity string, offset time.Duration) *models.Heartbeat {
+		return &models.Heartbeat{
+			UserID:   TestUserId,
+			Project:  project,
+			Language: TestLanguageGo,
+			Entity:   entity,
+			Time:     models.CustomTime(suite.TestStartTime.Add(offset)),
+		}
+	}
+
+	suite.TestHeartbeats = []*models.Heartbeat{
+		heartbeat(TestProject2, TestEntity1, -10*time.Minute), // -10:00
+		heartbeat(TestProject2, TestEntity1, -9*time.Minute),  // -9:00
+		heartbeat(TestProject1, TestEntity1, 0),               // 0:00
+		heartbeat(TestProject1, TestEntity2, 30*time.Second),  // 0:30
+		heartbeat(TestProject1, TestEntity1, 60*time.Second),  // 1:00
+		heartbeat(TestProject1, TestEntity1, 70*time.Second),  // 1:10
+		heartbeat(TestProject1, TestEntity2, 80*time.Second),  // 1:20
+		heartbeat(TestProject1, TestEntity2, 85*time.Second),  // 1:25
+	}
+}
+
+func (suite *EntityServiceTestSuite) BeforeTest(suiteName, testName string) {
+	config.Set(config.Empty())
+	suite.HeartbeatService = new(mocks.HeartbeatServiceMock)
+	suite.ProjectDefaultBranchService = new(mocks.ProjectDefaultBranchServiceMock)
+	suite.ProjectDefaultBranchService.On("GetMapped", TestUserId).Return(map[string]string{}, nil)
+}
+
+func TestEntityServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(EntityServiceTestSuite))
+}
+
+func (suite *EntityServiceTestSuite) TestEntityService_GetTop() {
+	sut := NewEntityService(NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService))
+
+	from, to := suite.TestStartTime.Add(-1*time.Hour), suite.TestStartTime.Add(1*time.Hour)
+	suite.HeartbeatService.On("GetAllWithin", from, to, suite.TestUser).Return(suite.TestHeartbeats, nil)
+
+	result, err := sut.GetTop(from, to, suite.TestUser, TestProject1, 0)
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), result, 2)
+	assert.Equal(suite.T(), TestEntity1, result[0].Key)
+	assert.Equal(suite.T(), 50*time.Second, result[0].TotalFixed())
+	assert.Equal(suite.T(), TestEntity2, result[1].Key)
+	assert.Equal(suite.T(), 35*time.Second, result[1].TotalFixed())
+}
+
+func (suite *EntityServiceTestSuite) TestEntityService_GetTop_Limit() {
+	sut := NewEntityService(NewDurationService(suite.HeartbeatService, suite.ProjectDefaultBranchService))
+
+	from, to := suite.TestStartTime.Add(-1*time.Hour), suite.TestStartTime.Add(1*time.Hour)
+	suite.HeartbeatService.On("GetAllWithin", from, to, suite.TestUser).Return(suite.TestHeartbeats, nil)
+
+	result, err := sut.GetTop(from, to, suite.TestUser, TestProject1, 1)
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), result, 1)
+	assert.Equal(suite.T(), TestEntity1, result[0].Key)
+}
@@ -0,0 +1,623 @@
+package services
+
+import (
+	"archive/zip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+)
+
+const (
+	ExportFormatCsv     = "csv"
+	ExportFormatJson    = "json"
+	ExportFormatArchive = "zip" // all of the user's data, see writeArchive
+)
+
+const (
+	exportPageSize    = 1000
+	cleanExportsEvery = 1 * time.Hour
+	exportPresignTtl  = 5 * time.Minute // of object store urls, which download links redirect to
+)
+
+var exportCsvHeader = []string{"time", "entity", "type", "category", "project", "branch", "language", "is_write", "editor", "operating_system", "machine", "user_agent", "lines", "lineno", "cursorpos"}
+
+// <uuid>.<format>, prevents path traversal when resolving export files from request parameters
+var exportIdPattern = regexp.MustCompile(`^[0-9a-f-]{36}\.(csv|json|zip)$`)
+
+var exportContentTypes = map[string]string{
+	ExportFormatCsv:     "text/csv",
+	ExportFormatJson:    "application/json",
+	ExportFormatArchive: "application/zip",
+}
+
+var (
+	ErrInvalidExportFormat = errors.New("invalid export format")
+	ErrInvalidExportLink   = errors.New("invalid or expired export link")
+)
+
+// ExportLocation is where to download an export from, either a file on local disk or, if uploaded to the object store, a presigned url
+type ExportLocation struct {
+	Path string
+	Url  string
+}
+
+// exportProfile is the user's account data as included in archive exports, leaving out credentials and other secrets
+type exportProfile struct {
+	ID                     string             `json:"id"`
+	Email                  string             `json:"email"`
+	Location               string             `json:"location"`
+	CreatedAt              models.CustomTime  `json:"created_at"`
+	LastLoggedInAt         models.CustomTime  `json:"last_logged_in_at"`
+	ShareDataMaxDays       int                `json:"share_data_max_days"`
+	ShareEditors           bool               `json:"share_editors"`
+	ShareLanguages         bool               `json:"share_languages"`
+	ShareProjects          bool               `json:"share_projects"`
+	ShareOSs               bool               `json:"share_oss"`
+	ShareMachines          bool               `json:"share_machines"`
+	ShareLabels            bool               `json:"share_labels"`
+	NewProjectsPrivate     bool               `json:"new_projects_private"`
+	PublicLeaderboard      bool               `json:"public_leaderboard"`
+	ReportsWeekly          bool               `json:"reports_weekly"`
+	InactivityReminders    bool               `json:"inactivity_reminders"`
+	ExcludeUnknownProjects bool               `json:"exclude_unknown_projects"`
+	HeartbeatsTimeoutSec   int                `json:"heartbeats_timeout_sec"`
+	DefaultSummaryInterval string             `json:"default_summary_interval"`
+	IgnorePatterns         string             `json:"ignore_patterns"` // newline-separated
+	RangePresets           string             `json:"range_presets"`   // newline-separated
+	AutoArchiveDays        int                `json:"auto_archive_days"`
+	ActiveDayThresholdSec  int                `json:"active_day_threshold_sec"`
+	DailyProjectCapHours   int                `json:"daily_project_cap_hours"`
+	MachineOverlapMode     string             `json:"machine_overlap_mode"`
+	AverageMode            string             `json:"average_mode"`
+	TotpEnabled            bool               `json:"totp_enabled"`
+	SubscribedUntil        *models.CustomTime `json:"subscribed_until"`
+}
+
+// exportProject is a project as included in archive exports, along with the user's per-project settings
+type exportProject struct {
+	Project       string            `json:"project"`
+	TopLanguage   string            `json:"top_language"`
+	Heartbeats    int64             `json:"heartbeats"`
+	First         models.CustomTime `json:"first"`
+	Last          models.CustomTime `json:"last"`
+	Archived      bool              `json:"archived"`
+	Labels        []string          `json:"labels"`
+	DefaultBranch string            `json:"default_branch,omitempty"`
+}
+
+type ExportService struct {
+	config                 *config.Config
+	heartbeatService       IHeartbeatService
+	summaryService         ISummaryService
+	aliasService           IAliasService
+	projectLabelService    IProjectLabelService
+	languageMappingService ILanguageMappingService
+	defaultBranchService   IProjectDefaultBranchService
+	projectArchiveService  IProjectArchiveService
+	keyValueService        IKeyValueService
+	mailService            IMailService
+	queueDefault           *config.JobQueue
+	queueWorkers           *config.JobQueue
+	objectStore            *utils.S3Client // nil unless configured
+	signingKey             []byte
+	signingKeyLock         sync.Mutex
+}
+
+func NewExportService(
+	heartbeatService IHeartbeatService,
+	summaryService ISummaryService,
+	aliasService IAliasService,
+	projectLabelService IProjectLabelService,
+	languageMappingService ILanguageMappingService,
+	defaultBranchService IProjectDefaultBranchService,
+	projectArchiveService IProjectArchiveService,
+	keyValueService IKeyValueService,
+	mailService IMailService,
+) *ExportService {
+	var objectStore *utils.S3Client
+	if cfg := config.Get().ObjectStore; cfg.IsEnabled() {
+		client, err := utils.NewS3Client(cfg.Endpoint, cfg.Region, cfg.Bucket, cfg.AccessKeyId, cfg.SecretAccessKey, cfg.PathStyle)
+		if err != nil {
+			config.Log().Error("failed to initialize object store, keeping exports on local disk", "error", err)
+		}
+		objectStore = client
+	}
+
+	return &ExportService{
+		config:                 config.Get(),
+		heartbeatService:       heartbeatService,
+		summaryService:         summaryService,
+		aliasService:           aliasService,
+		projectLabelService:    projectLabelService,
+		languageMappingService: languageMappingService,
+		defaultBranchService:   defaultBranchService,
+		projectArchiveService:  projectArchiveService,
+		keyValueService:        keyValueService,
+		mailService:            mailService,
+		queueDefault:           config.GetDefaultQueue(),
+		queueWorkers:           config.GetQueue(config.QueueExports),
+		objectStore:            objectStore,
+	}
+}
+
+func (srv *ExportService) Schedule() {
+	slog.Info("scheduling export cleanup")
+	if _, err := srv.queueDefault.DispatchEvery(srv.runCleanExports, cleanExportsEvery); err != nil {
+		config.Log().Error("failed to schedule export cleanup", "error", err)
+	}
+}
+
+// RequestExport generates a data export in the background and mails a signed download link to the user once finished
+func (srv *ExportService) RequestExport(user *models.User, format string) error {
+	if !isValidExportFormat(format) {
+		return ErrInvalidExportFormat
+	}
+	if user.Email == "" {
+		return errors.New("user has no e-mail address")
+	}
+
+	return srv.queueWorkers.Dispatch(func() {
+		exportId, err := srv.GenerateExport(user, format)
+		if err != nil {
+			config.Log().Error("failed to generate export", "userID", user.ID, "format", format, "error", err)
+			return
+		}
+
+		link, expiresAt, err := srv.GetSignedUrl(exportId)
+		if err != nil {
+			config.Log().Error("failed to sign export link", "userID", user.ID, "error", err)
+			return
+		}
+
+		if err := srv.mailService.SendExportNotification(user, link, expiresAt); err != nil {
+			config.Log().Error("failed to send export notification mail", "userID", user.ID, "error", err)
+			return
+		}
+		slog.Info("sent export notification mail", "userID", user.ID)
+	})
+}
+
+// GenerateExport writes all of the user's heartbeats (or, for archive exports, all of the user's data) to a new export file and returns the export's id.
+// If an object store is configured, the file is uploaded there and deleted from local disk afterwards, or kept on local disk if uploading failed.
+func (srv *ExportService) GenerateExport(user *models.User, format string) (string, error) {
+	if !isValidExportFormat(format) {
+		return "", ErrInvalidExportFormat
+	}
+
+	if err := os.MkdirAll(srv.config.App.GetExportDir(), 0700); err != nil {
+		return "", err
+	}
+
+	exportId := fmt.Sprintf("%s.%s", uuid.Must(uuid.NewV4()).String(), format)
+	exportPath := filepath.Join(srv.config.App.GetExportDir(), exportId)
+
+	file, err := os.OpenFile(exportPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case ExportFormatCsv:
+		err = srv.writeCsv(user, file)
+	case ExportFormatJson:
+		err = srv.writeJson(user, file)
+	case ExportFormatArchive:
+		err = srv.writeArchive(user, file)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(exportPath)
+		return "", err
+	}
+
+	slog.Info("generated data export", "userID", user.ID, "exportID", exportId)
+
+	if srv.objectStore != nil {
+		if err := srv.uploadExport(exportId, exportPath); err != nil {
+			config.Log().Error("failed to upload export to object store, keeping it on local disk", "userID", user.ID, "exportID", exportId, "error", err)
+		} else if err := os.Remove(exportPath); err != nil {
+			config.Log().Error("failed to delete uploaded export from local disk", "exportID", exportId, "error", err)
+		}
+	}
+
+	return exportId, nil
+}
+
+// GetSignedUrl returns a download link valid for only the given export and only until the returned expiry time
+func (srv *ExportService) GetSignedUrl(exportId string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(srv.config.App.ExportLinkExpiry())
+	signature, err := srv.sign(exportId, expiresAt.Unix())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", signature)
+
+	return fmt.Sprintf("%s/api/exports/%s?%s", srv.config.Server.GetBaseUrl(), exportId, query.Encode()), expiresAt, nil
+}
+
+// ResolveSignedUrl validates the parameters of a signed download link and returns where to download the export it refers to from.
+// Exports on local disk take precedence, otherwise a short-lived presigned url of the object store is returned (without checking for the object's existence).
+func (srv *ExportService) ResolveSignedUrl(exportId, expires, signature string) (*ExportLocation, error) {
+	if !exportIdPattern.MatchString(exportId) {
+		return nil, ErrInvalidExportLink
+	}
+
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().After(time.Unix(expiresUnix, 0)) {
+		return nil, ErrInvalidExportLink
+	}
+
+	expectedSignature, err := srv.sign(exportId, expiresUnix)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(expectedSignature), []byte(signature)) {
+		return nil, ErrInvalidExportLink
+	}
+
+	exportPath := filepath.Join(srv.config.App.GetExportDir(), exportId)
+	if _, err := os.Stat(exportPath); err == nil {
+		return &ExportLocation{Path: exportPath}, nil
+	}
+
+	if srv.objectStore != nil {
+		params := url.Values{}
+		params.Set("response-content-disposition", ExportContentDisposition(exportId))
+		return &ExportLocation{Url: srv.objectStore.PresignGetObject(srv.config.ObjectStore.Prefix+exportId, exportPresignTtl, params)}, nil
+	}
+
+	return nil, ErrInvalidExportLink
+}
+
+// CleanExports deletes all export files older than the link expiry time, i.e. which can't be downloaded anymore
+func (srv *ExportService) CleanExports() error {
+	entries, err := os.ReadDir(srv.config.App.GetExportDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var i int
+	for _, entry := range entries {
+		if !exportIdPattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < srv.config.App.ExportLinkExpiry() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(srv.config.App.GetExportDir(), entry.Name())); err != nil {
+			config.Log().Error("failed to delete expired export", "exportID", entry.Name(), "error", err)
+		} else {
+			i++
+		}
+	}
+
+	if srv.objectStore != nil {
+		objects, err := srv.objectStore.ListObjects(srv.config.ObjectStore.Prefix)
+		if err != nil {
+			return err
+		}
+		for _, o := range objects {
+			if !exportIdPattern.MatchString(strings.TrimPrefix(o.Key, srv.config.ObjectStore.Prefix)) || time.Since(o.LastModified) < srv.config.App.ExportLinkExpiry() {
+				continue
+			}
+			if err := srv.objectStore.DeleteObject(o.Key); err != nil {
+				config.Log().Error("failed to delete expired export from object store", "key", o.Key, "error", err)
+			} else {
+				i++
+			}
+		}
+	}
+
+	slog.Info("deleted expired exports", "count", i)
+	return nil
+}
+
+func (srv *ExportService) uploadExport(exportId, exportPath string) error {
+	file, err := os.Open(exportPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	format := exportId[strings.LastIndex(exportId, ".")+1:]
+	return srv.objectStore.PutObject(srv.config.ObjectStore.Prefix+exportId, file, info.Size(), exportContentTypes[format])
+}
+
+func (srv *ExportService) runCleanExports() {
+	if err := srv.CleanExports(); err != nil {
+		config.Log().Error("failed to clean expired exports", "error", err)
+	}
+}
+
+func (srv *ExportService) writeCsv(user *models.User, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportCsvHeader); err != nil {
+		return err
+	}
+
+	err := srv.forEachHeartbeat(user, func(hb *models.Heartbeat) error {
+		return writer.Write([]string{
+			hb.Time.T().UTC().Format(time.RFC3339Nano),
+			hb.Entity,
+			hb.Type,
+			hb.Category,
+			hb.Project,
+			hb.Branch,
+			hb.Language,
+			strconv.FormatBool(hb.IsWrite),
+			hb.Editor,
+			hb.OperatingSystem,
+			hb.Machine,
+			hb.UserAgent,
+			strconv.Itoa(hb.Lines),
+			strconv.Itoa(hb.LineNo),
+			strconv.Itoa(hb.CursorPos),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (srv *ExportService) writeJson(user *models.User, w io.Writer) error {
+	// written incrementally as a json array to avoid holding all heartbeats in memory at once
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	err := srv.forEachHeartbeat(user, func(hb *models.Heartbeat) error {
+		data, err := json.Marshal(hb)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]")
+	return err
+}
+
+// writeArchive writes a zip file containing the user's profile, heartbeats, summaries, aliases, projects and language mappings
+func (srv *ExportService) writeArchive(user *models.User, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	if err := writeArchiveEntry(archive, "heartbeats.csv", func(w io.Writer) error {
+		return srv.writeCsv(user, w)
+	}); err != nil {
+		return err
+	}
+
+	summaries, err := srv.summaryService.GetByUserWithin(user, time.Time{}, time.Now())
+	if err != nil {
+		return err
+	}
+	aliases, err := srv.aliasService.GetByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	languageMappings, err := srv.languageMappingService.GetByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	projects, err := srv.getExportProjects(user)
+	if err != nil {
+		return err
+	}
+
+	jsonEntries := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", newExportProfile(user)},
+		{"summaries.json", summaries},
+		{"aliases.json", aliases},
+		{"projects.json", projects},
+		{"language_mappings.json", languageMappings},
+	}
+	for _, entry := range jsonEntries {
+		if err := writeArchiveEntry(archive, entry.name, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(entry.data)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func (srv *ExportService) getExportProjects(user *models.User) ([]*exportProject, error) {
+	stats, err := srv.heartbeatService.GetUserProjectStats(user, time.Time{}, time.Now(), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := srv.projectArchiveService.GetArchived(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := srv.projectLabelService.GetByUserGrouped(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defaultBranches, err := srv.defaultBranchService.GetMapped(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make([]*exportProject, len(stats))
+	for i, s := range stats {
+		projects[i] = &exportProject{
+			Project:       s.Project,
+			TopLanguage:   s.TopLanguage,
+			Heartbeats:    s.Count,
+			First:         s.First,
+			Last:          s.Last,
+			Archived:      archived[s.Project],
+			Labels:        make([]string, 0, len(labels[s.Project])),
+			DefaultBranch: defaultBranches[s.Project],
+		}
+		for _, l := range labels[s.Project] {
+			projects[i].Labels = append(projects[i].Labels, l.Label)
+		}
+	}
+	return projects, nil
+}
+
+func (srv *ExportService) forEachHeartbeat(user *models.User, f func(*models.Heartbeat) error) error {
+	var cursor *models.HeartbeatCursor
+	for {
+		heartbeats, err := srv.heartbeatService.GetAllWithinPaginated(time.Time{}, time.Now(), user, cursor, exportPageSize)
+		if err != nil {
+			return err
+		}
+		for _, hb := range heartbeats {
+			if err := f(hb); err != nil {
+				return err
+			}
+		}
+		if len(heartbeats) < exportPageSize {
+			return nil
+		}
+		cursor = models.NewHeartbeatCursor(heartbeats[len(heartbeats)-1])
+	}
+}
+
+func writeArchiveEntry(archive *zip.Writer, name string, write func(io.Writer) error) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	return write(w)
+}
+
+func newExportProfile(user *models.User) *exportProfile {
+	return &exportProfile{
+		ID:                     user.ID,
+		Email:                  user.Email,
+		Location:               user.Location,
+		CreatedAt:              user.CreatedAt,
+		LastLoggedInAt:         user.LastLoggedInAt,
+		ShareDataMaxDays:       user.ShareDataMaxDays,
+		ShareEditors:           user.ShareEditors,
+		ShareLanguages:         user.ShareLanguages,
+		ShareProjects:          user.ShareProjects,
+		ShareOSs:               user.ShareOSs,
+		ShareMachines:          user.ShareMachines,
+		ShareLabels:            user.ShareLabels,
+		NewProjectsPrivate:     user.NewProjectsPrivate,
+		PublicLeaderboard:      user.PublicLeaderboard,
+		ReportsWeekly:          user.ReportsWeekly,
+		InactivityReminders:    user.InactivityReminders,
+		ExcludeUnknownProjects: user.ExcludeUnknownProjects,
+		HeartbeatsTimeoutSec:   user.HeartbeatsTimeoutSec,
+		DefaultSummaryInterval: user.DefaultSummaryInterval,
+		IgnorePatterns:         user.IgnorePatterns,
+		RangePresets:           user.RangePresets,
+		AutoArchiveDays:        user.AutoArchiveDays,
+		ActiveDayThresholdSec:  user.ActiveDayThresholdSec,
+		DailyProjectCapHours:   user.DailyProjectCapHours,
+		MachineOverlapMode:     user.MachineOverlapMode,
+		AverageMode:            user.AverageMode,
+		TotpEnabled:            user.TotpEnabled,
+		SubscribedUntil:        user.SubscribedUntil,
+	}
+}
+
+func isValidExportFormat(format string) bool {
+	return format == ExportFormatCsv || format == ExportFormatJson || format == ExportFormatArchive
+}
+
+func (srv *ExportService) sign(exportId string, expires int64) (string, error) {
+	key, err := srv.getSigningKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(fmt.Sprintf("export:%s:%d", exportId, expires)))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// signing key is persisted (as opposed to the cookie keys), so that links remain valid across restarts
+func (srv *ExportService) getSigningKey() ([]byte, error) {
+	srv.signingKeyLock.Lock()
+	defer srv.signingKeyLock.Unlock()
+
+	if srv.signingKey != nil {
+		return srv.signingKey, nil
+	}
+
+	if kv := srv.keyValueService.MustGetString(config.KeyExportSigningKey); kv.Value != "" {
+		key, err := hex.DecodeString(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		srv.signingKey = key
+		return key, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := srv.keyValueService.PutString(&models.KeyStringValue{
+		Key:   config.KeyExportSigningKey,
+		Value: hex.EncodeToString(key),
+	}); err != nil {
+		return nil, err
+	}
+
+	srv.signingKey = key
+	return key, nil
+}
+
+// ExportContentDisposition is the header to serve the export with, so it's downloaded under a recognizable file name
+func ExportContentDisposition(exportId string) string {
+	return fmt.Sprintf("attachment; filename=\"wakapi_export_%s\"", exportId)
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExportServiceTestSuite struct {
+	suite.Suite
+	TestUser         *models.User
+	HeartbeatService *mocks.HeartbeatServiceMock
+	KeyValueService  *mocks.KeyValueServiceMock
+}
+
+func (suite *ExportServiceTestSuite) SetupSuite() {
+	suite.TestUser = &models.User{ID: "testuser01", Email: "testuser01@example.org"}
+}
+
+func (suite *ExportServiceTestSuite) BeforeTest(suiteName, testName string) {
+	cfg := config.Empty()
+	cfg.App.ExportDir = suite.T().TempDir()
+	cfg.App.ExportLinkExpiryHours = 24
+	cfg.Server.PublicUrl = "http://localhost:3000"
+	config.Set(cfg)
+
+	suite.HeartbeatService = new(mocks.HeartbeatServiceMock)
+	suite.KeyValueService = new(mocks.KeyValueServiceMock)
+	suite.KeyValueService.On("MustGetString", config.KeyExportSigningKey).Return(&models.KeyStringValue{Key: config.KeyExportSigningKey, Value: "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"})
+}
+
+func TestExportServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ExportServiceTestSuite))
+}
+
+func (suite *ExportServiceTestSuite) TestExportService_GenerateExport() {
+	sut := NewExportService(suite.HeartbeatService, nil, nil, nil, nil, nil, nil, suite.KeyValueService, nil)
+
+	heartbeats := []*models.Heartbeat{
+		{ID: 1, UserID: suite.TestUser.ID, Entity: "main.go", Project: "wakapi", Language: "Go", Time: models.CustomTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))},
+		{ID: 2, UserID: suite.TestUser.ID, Entity: "README.md", Project: "wakapi", Language: "Markdown", Time: models.CustomTime(time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC))},
+	}
+	suite.HeartbeatService.On("GetAllWithinPaginated", mock.Anything, mock.Anything, suite.TestUser, mock.Anything, exportPageSize).Return(heartbeats, nil)
+
+	exportId, err := sut.GenerateExport(suite.TestUser, ExportFormatCsv)
+	assert.Nil(suite.T(), err)
+	assert.Regexp(suite.T(), exportIdPattern, exportId)
+
+	data, err := os.ReadFile(path.Join(config.Get().App.GetExportDir(), exportId))
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), string(data), "time,entity,type,category,project")
+	assert.Contains(suite.T(), string(data), "2024-01-01T12:00:00Z,main.go,,,wakapi,,Go,false")
+	assert.Contains(suite.T(), string(data), "README.md")
+
+	_, err = sut.GenerateExport(suite.TestUser, "xml")
+	assert.ErrorIs(suite.T(), err, ErrInvalidExportFormat)
+}
+
+func (suite *ExportServiceTestSuite) TestExportService_GenerateExport_Archive() {
+	summaryService := new(mocks.SummaryServiceMock)
+	aliasService := new(mocks.AliasServiceMock)
+	projectLabelService := new(mocks.ProjectLabelServiceMock)
+	languageMappingService := new(mocks.LanguageMappingServiceMock)
+	defaultBranchService := new(mocks.ProjectDefaultBranchServiceMock)
+	projectArchiveService := new(mocks.ProjectArchiveServiceMock)
+
+	sut := NewExportService(suite.HeartbeatService, summaryService, aliasService, projectLabelService, languageMappingService, defaultBranchService, projectArchiveService, suite.KeyValueService, nil)
+
+	user := &models.User{ID: suite.TestUser.ID, Email: suite.TestUser.Email, Password: "$2a$10$secret", ApiKey: "e1f5b2d9-secret", TotpSecret: "secret"}
+	heartbeats := []*models.Heartbeat{
+		{ID: 1, UserID: user.ID, Entity: "main.go", Project: "wakapi", Language: "Go", Time: models.CustomTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))},
+	}
+	suite.HeartbeatService.On("GetAllWithinPaginated", mock.Anything, mock.Anything, user, mock.Anything, exportPageSize).Return(heartbeats, nil)
+	suite.HeartbeatService.On("GetUserProjectStats", user, time.Time{}, mock.Anything, (*utils.PageParams)(nil), true).Return([]*models.ProjectStats{{UserId: user.ID, Project: "wakapi", TopLanguage: "Go", Count: 1}}, nil)
+	summaryService.On("GetByUserWithin", user, time.Time{}, mock.Anything).Return([]*models.Summary{{UserID: user.ID, Projects: models.SummaryItems{{Key: "wakapi", Total: 60}}}}, nil)
+	aliasService.On("GetByUser", user.ID).Return([]*models.Alias{{UserID: user.ID, Type: models.SummaryProject, Key: "wakapi", Value: "wakapi-fork"}}, nil)
+	languageMappingService.On("GetByUser", user.ID).Return([]*models.LanguageMapping{}, nil)
+	projectArchiveService.On("GetArchived", user.ID).Return(map[string]bool{"wakapi": true}, nil)
+	projectLabelService.On("GetByUserGrouped", user.ID).Return(map[string][]*models.ProjectLabel{"wakapi": {{ProjectKey: "wakapi", Label: "oss"}}}, nil)
+	defaultBranchService.On("GetMapped", user.ID).Return(map[string]string{"wakapi": "master"}, nil)
+
+	exportId, err := sut.GenerateExport(user, ExportFormatArchive)
+	assert.Nil(suite.T(), err)
+	assert.Regexp(suite.T(), exportIdPattern, exportId)
+
+	archive, err := zip.OpenReader(path.Join(config.Get().App.GetExportDir(), exportId))
+	assert.Nil(suite.T(), err)
+	defer archive.Close()
+
+	contents := make(map[string]string)
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		r.Close()
+		contents[f.Name] = string(data)
+	}
+
+	assert.Len(suite.T(), contents, 6)
+	assert.Contains(suite.T(), contents["heartbeats.csv"], "2024-01-01T12:00:00Z,main.go")
+	assert.Contains(suite.T(), contents["profile.json"], `"email":"testuser01@example.org"`)
+	assert.Contains(suite.T(), contents["summaries.json"], `"key":"wakapi"`)
+	assert.Contains(suite.T(), contents["aliases.json"], "wakapi-fork")
+	assert.Contains(suite.T(), contents["projects.json"], `"archived":true,"labels":["oss"],"default_branch":"master"`)
+	assert.Equal(suite.T(), "[]\n", contents["language_mappings.json"])
+	for name, content := range contents {
+		assert.NotContains(suite.T(), content, "secret", name)
+	}
+}
+
+func (suite *ExportServiceTestSuite) TestExportService_SignedUrl() {
+	sut := NewExportService(suite.HeartbeatService, nil, nil, nil, nil, nil, nil, suite.KeyValueService, nil)
+
+	exportId := "0b7f6a4e-3f5a-4a57-9a43-8e1e5b2d9c11.json"
+	assert.Nil(suite.T(), os.WriteFile(path.Join(config.Get().App.GetExportDir(), exportId), []byte("[]"), 0600))
+
+	link, expiresAt, err := sut.GetSignedUrl(exportId)
+	assert.Nil(suite.T(), err)
+	assert.WithinDuration(suite.T(), time.Now().Add(24*time.Hour), expiresAt, time.Minute)
+
+	parsed, _ := url.Parse(link)
+	assert.Equal(suite.T(), "/api/exports/"+exportId, parsed.Path)
+	expires, signature := parsed.Query().Get("expires"), parsed.Query().Get("signature")
+
+	location, err := sut.ResolveSignedUrl(exportId, expires, signature)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), path.Join(config.Get().App.GetExportDir(), exportId), location.Path)
+	assert.Empty(suite.T(), location.Url)
+
+	// signature only valid for this very export
+	_, err = sut.ResolveSignedUrl("1c8f6a4e-3f5a-4a57-9a43-8e1e5b2d9c11.json", expires, signature)
+	assert.ErrorIs(suite.T(), err, ErrInvalidExportLink)
+
+	// expiry date can't be tampered with
+	_, err = sut.ResolveSignedUrl(exportId, strconv.FormatInt(expiresAt.Add(time.Hour).Unix(), 10), signature)
+	assert.ErrorIs(suite.T(), err, ErrInvalidExportLink)
+
+	// expired links are rejected
+	expiredSignature, _ := sut.sign(exportId, time.Now().Add(-time.Minute).Unix())
+	_, err = sut.ResolveSignedUrl(exportId, strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10), expiredSignature)
+	assert.ErrorIs(suite.T(), err, ErrInvalidExportLink)
+
+	_, err = sut.ResolveSignedUrl("../../etc/passwd", expires, signature)
+	assert.ErrorIs(suite.T(), err, ErrInvalidExportLink)
+}
+
+func (suite *ExportServiceTestSuite) TestExportService_CleanExports() {
+	sut := NewExportService(suite.HeartbeatService, nil, nil, nil, nil, nil, nil, suite.KeyValueService, nil)
+
+	exportDir := config.Get().App.GetExportDir()
+	expired := path.Join(exportDir, "0b7f6a4e-3f5a-4a57-9a43-8e1e5b2d9c11.csv")
+	recent := path.Join(exportDir, "1c8f6a4e-3f5a-4a57-9a43-8e1e5b2d9c11.csv")
+	assert.Nil(suite.T(), os.WriteFile(expired, []byte{}, 0600))
+	assert.Nil(suite.T(), os.WriteFile(recent, []byte{}, 0600))
+	assert.Nil(suite.T(), os.Chtimes(expired, time.Now().Add(-25*time.Hour), time.Now().Add(-25*time.Hour)))
+
+	assert.Nil(suite.T(), sut.CleanExports())
+
+	_, err := os.Stat(expired)
+	assert.ErrorIs(suite.T(), err, os.ErrNotExist)
+	_, err = os.Stat(recent)
+	assert.Nil(suite.T(), err)
+}
+
+func (suite *ExportServiceTestSuite) TestExportService_ObjectStore() {
+	objects := map[string][]byte{}
+	modified := map[string]time.Time{}
+
+	// minimal fake of an s3-compatible object store
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/wakapi/")
+		switch r.Method {
+		case http.MethodPut:
+			objects[key], _ = io.ReadAll(r.Body)
+			modified[key] = time.Now()
+		case http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			w.Write([]byte("<ListBucketResult>"))
+			for k := range objects {
+				w.Write([]byte(fmt.Sprintf("<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents>", k, len(objects[k]), modified[k].UTC().Format(time.RFC3339))))
+			}
+			w.Write([]byte("</ListBucketResult>"))
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.Get()
+	cfg.ObjectStore.Endpoint = server.URL
+	cfg.ObjectStore.Region = "us-east-1"
+	cfg.ObjectStore.Bucket = "wakapi"
+	cfg.ObjectStore.Prefix = "exports/"
+	cfg.ObjectStore.AccessKeyId = "key"
+	cfg.ObjectStore.SecretAccessKey = "secret"
+	cfg.ObjectStore.PathStyle = true
+
+	sut := NewExportService(suite.HeartbeatService, nil, nil, nil, nil, nil, nil, suite.KeyValueService, nil)
+
+	heartbeats := []*models.Heartbeat{
+		{ID: 1, UserID: suite.TestUser.ID, Entity: "main.go", Project: "wakapi", Language: "Go", Time: models.CustomTime(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))},
+	}
+	suite.HeartbeatService.On("GetAllWithinPaginated", mock.Anything, mock.Anything, suite.TestUser, mock.Anything, exportPageSize).Return(heartbeats, nil)
+
+	exportId, err := sut.GenerateExport(suite.TestUser, ExportFormatCsv)
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), string(objects["exports/"+exportId]), "main.go")
+
+	// uploaded exports are removed from local disk
+	_, err = os.Stat(path.Join(cfg.App.GetExportDir(), exportId))
+	assert.ErrorIs(suite.T(), err, os.ErrNotExist)
+
+	link, _, _ := sut.GetSignedUrl(exportId)
+	parsed, _ := url.Parse(link)
+	location, err := sut.ResolveSignedUrl(exportId, parsed.Query().Get("expires"), parsed.Query().Get("signature"))
+	assert.Nil(suite.T(), err)
+	assert.Empty(suite.T(), location.Path)
+	assert.True(suite.T(), strings.HasPrefix(location.Url, server.URL+"/wakapi/exports/"+exportId+"?"))
+	assert.Contains(suite.T(), location.Url, "X-Amz-Signature=")
+	assert.Contains(suite.T(), location.Url, "response-content-disposition=attachment")
+
+	// expired exports are deleted from the store, others are kept
+	expiredId := "0b7f6a4e-3f5a-4a57-9a43-8e1e5b2d9c11.zip"
+	objects["exports/"+expiredId] = []byte{}
+	modified["exports/"+expiredId] = time.Now().Add(-25 * time.Hour)
+	objects["exports/unrelated.txt"] = []byte{}
+	modified["exports/unrelated.txt"] = time.Now().Add(-25 * time.Hour)
+
+	assert.Nil(suite.T(), sut.CleanExports())
+	assert.Contains(suite.T(), objects, "exports/"+exportId)
+	assert.NotContains(suite.T(), objects, "exports/"+expiredId)
+	assert.Contains(suite.T(), objects, "exports/unrelated.txt")
+}
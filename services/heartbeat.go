@@ -1,9 +1,11 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	datastructure "github.com/duke-git/lancet/v2/datastructure/set"
 	"github.com/duke-git/lancet/v2/maputil"
+	"github.com/duke-git/lancet/v2/slice"
 	"github.com/leandro-lugaresi/hub"
 	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/repositories"
@@ -24,8 +26,16 @@ type HeartbeatService struct {
 	repository          repositories.IHeartbeatRepository
 	languageMappingSrvc ILanguageMappingService
 	entityCacheLock     *sync.RWMutex
+	bufferLock          *sync.Mutex
+	buffer              []*models.Heartbeat
+	bufferFull          chan struct{}
 }
 
+var ErrHeartbeatQuotaExceeded = errors.New("heartbeat quota exceeded")
+
+// maximum number of heartbeats to write within a single statement when flushing the buffer
+const heartbeatBufferChunkSize = 500
+
 func NewHeartbeatService(heartbeatRepo repositories.IHeartbeatRepository, languageMappingService ILanguageMappingService) *HeartbeatService {
 	srv := &HeartbeatService{
 		config:              config.Get(),
@@ -34,6 +44,8 @@ func NewHeartbeatService(heartbeatRepo repositories.IHeartbeatRepository, langua
 		repository:          heartbeatRepo,
 		languageMappingSrvc: languageMappingService,
 		entityCacheLock:     &sync.RWMutex{},
+		bufferLock:          &sync.Mutex{},
+		bufferFull:          make(chan struct{}, 1),
 	}
 
 	// using event hub is an unnecessary indirection here, however, we might
@@ -49,6 +61,22 @@ func NewHeartbeatService(heartbeatRepo repositories.IHeartbeatRepository, langua
 		}
 	}(&sub1)
 
+	if srv.config.App.HeartbeatBufferingEnabled() {
+		// flushes periodically and whenever the buffer is full, but never within the request that happened to fill it up
+		go func() {
+			ticker := time.NewTicker(srv.config.App.HeartbeatBufferInterval())
+			for {
+				select {
+				case <-ticker.C:
+				case <-srv.bufferFull:
+				}
+				if err := srv.Flush(); err != nil {
+					config.Log().Error("failed to flush heartbeat buffer", "error", err)
+				}
+			}
+		}()
+	}
+
 	return srv
 }
 
@@ -62,24 +90,77 @@ func (srv *HeartbeatService) InsertBatch(heartbeats []*models.Heartbeat) error {
 		return nil
 	}
 
+	filteredHeartbeats := srv.prepareBatch(heartbeats)
+
+	if srv.config.App.HeartbeatBufferingEnabled() {
+		return srv.enqueue(filteredHeartbeats)
+	}
+
+	err := srv.repository.InsertBatch(filteredHeartbeats)
+	if err == nil {
+		go srv.notifyBatch(filteredHeartbeats)
+	}
+	return err
+}
+
+// InsertImported inserts the heartbeats like InsertBatch, but always right away (regardless of buffering) and returns the number of heartbeats actually written, i.e. excluding duplicates
+func (srv *HeartbeatService) InsertImported(heartbeats []*models.Heartbeat) (int, error) {
+	if len(heartbeats) == 0 {
+		return 0, nil
+	}
+
+	filteredHeartbeats := srv.prepareBatch(heartbeats)
+
+	n, err := srv.repository.InsertBatchCounted(filteredHeartbeats)
+	if err == nil {
+		go srv.notifyBatch(filteredHeartbeats)
+	}
+	return int(n), err
+}
+
+// prepareBatch removes duplicates and oversized heartbeats from the batch and sanitizes the remaining ones
+func (srv *HeartbeatService) prepareBatch(heartbeats []*models.Heartbeat) []*models.Heartbeat {
 	hashes := datastructure.New[string]()
 
 	// https://github.com/muety/wakapi/issues/139
 	filteredHeartbeats := make([]*models.Heartbeat, 0, len(heartbeats))
 	for _, hb := range heartbeats {
 		if !hashes.Contain(hb.Hash) {
+			if !srv.fitFieldLengths(hb) {
+				continue
+			}
 			hb = hb.Sanitize()
 			filteredHeartbeats = append(filteredHeartbeats, hb)
 			hashes.Add(hb.Hash)
 		}
 		go srv.updateEntityUserCacheByHeartbeat(hb)
 	}
+	return filteredHeartbeats
+}
 
-	err := srv.repository.InsertBatch(filteredHeartbeats)
-	if err == nil {
-		go srv.notifyBatch(filteredHeartbeats)
+// fitFieldLengths either truncates the heartbeat's oversized text fields or reports that it must be skipped, depending on truncate_heartbeats
+func (srv *HeartbeatService) fitFieldLengths(hb *models.Heartbeat) bool {
+	if !srv.config.App.TruncateHeartbeats {
+		if oversized := hb.OversizedFields(srv.config.App.HeartbeatMaxFieldLen); len(oversized) > 0 {
+			config.Log().Warn("skipping heartbeat with oversized fields", "userID", hb.UserID, "fields", oversized)
+			return false
+		}
+		return true
 	}
-	return err
+	if truncated := hb.Truncate(srv.config.App.HeartbeatMaxFieldLen); len(truncated) > 0 {
+		config.Log().Warn("truncated oversized heartbeat fields", "userID", hb.UserID, "fields", truncated)
+	}
+	return true
+}
+
+// Flush writes all heartbeats currently held in the buffer (see heartbeat_buffer_sec) to the database. Heartbeats failed to be written are put back into the buffer.
+func (srv *HeartbeatService) Flush() error {
+	srv.bufferLock.Lock()
+	heartbeats := srv.buffer
+	srv.buffer = nil
+	srv.bufferLock.Unlock()
+
+	return srv.persistBuffered(heartbeats)
 }
 
 func (srv *HeartbeatService) Count(approximate bool) (int64, error) {
@@ -107,6 +188,31 @@ func (srv *HeartbeatService) CountByUser(user *models.User) (int64, error) {
 	return count, err
 }
 
+// CheckQuota returns ErrHeartbeatQuotaExceeded if the user has already reached their maximum number of stored heartbeats.
+// The first time this happens within a day, an event is published to have the user notified.
+func (srv *HeartbeatService) CheckQuota(user *models.User) error {
+	quota := user.HeartbeatQuota()
+	if quota <= 0 {
+		return nil
+	}
+
+	count, err := srv.CountByUser(user) // cached and kept up to date by heartbeat events, so this doesn't hit the database per request
+	if err != nil {
+		return err
+	}
+	if count < quota {
+		return nil
+	}
+
+	if err := srv.cache.Add(srv.quotaNotifiedCacheKey(user.ID), true, 24*time.Hour); err == nil {
+		srv.eventBus.Publish(hub.Message{
+			Name:   config.EventHeartbeatQuota,
+			Fields: map[string]interface{}{config.FieldPayload: quota, config.FieldUser: user},
+		})
+	}
+	return ErrHeartbeatQuotaExceeded
+}
+
 func (srv *HeartbeatService) CountByUsers(users []*models.User) ([]*models.CountByUser, error) {
 	missingUsers := make([]*models.User, 0, len(users))
 	userCounts := make([]*models.CountByUser, 0, len(users))
@@ -143,6 +249,22 @@ func (srv *HeartbeatService) GetAllWithin(from, to time.Time, user *models.User)
 	return srv.augmented(heartbeats, user.ID)
 }
 
+func (srv *HeartbeatService) GetAllWithinPaginated(from, to time.Time, user *models.User, after *models.HeartbeatCursor, limit int) ([]*models.Heartbeat, error) {
+	heartbeats, err := srv.repository.GetAllWithinPaginated(from, to, user, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return srv.augmented(heartbeats, user.ID)
+}
+
+func (srv *HeartbeatService) GetAllWithinByEntityPaginated(from, to time.Time, user *models.User, entity string, after *models.HeartbeatCursor, limit int) ([]*models.Heartbeat, error) {
+	heartbeats, err := srv.repository.GetAllWithinByEntityPaginated(from, to, user, entity, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return srv.augmented(heartbeats, user.ID)
+}
+
 func (srv *HeartbeatService) GetAllWithinByFilters(from, to time.Time, user *models.User, filters *models.Filters) ([]*models.Heartbeat, error) {
 	heartbeats, err := srv.repository.GetAllWithinByFilters(from, to, user, srv.filtersToColumnMap(filters))
 	if err != nil {
@@ -163,10 +285,18 @@ func (srv *HeartbeatService) GetLatestByFilters(user *models.User, filters *mode
 	return srv.repository.GetLatestByFilters(user, srv.filtersToColumnMap(filters))
 }
 
+func (srv *HeartbeatService) GetLatestReceivedWithin(from, to time.Time, user *models.User) (*models.Heartbeat, error) {
+	return srv.repository.GetLatestReceivedWithin(from, to, user)
+}
+
 func (srv *HeartbeatService) GetFirstByUsers() ([]*models.TimeByUser, error) {
 	return srv.repository.GetFirstByUsers()
 }
 
+func (srv *HeartbeatService) GetExistingHashes(hashes []string) ([]string, error) {
+	return srv.repository.GetExistingHashes(hashes)
+}
+
 func (srv *HeartbeatService) GetEntitySetByUser(entityType uint8, userId string) ([]string, error) {
 	cacheKey := srv.getEntityUserCacheKey(entityType, userId)
 	if results, found := srv.cache.Get(cacheKey); found {
@@ -289,6 +419,39 @@ func (srv *HeartbeatService) updateEntityUserCacheByHeartbeat(hb *models.Heartbe
 	go srv.updateEntityUserCache(models.SummaryCategory, hb.Category, hb.UserID)
 }
 
+func (srv *HeartbeatService) enqueue(heartbeats []*models.Heartbeat) error {
+	srv.bufferLock.Lock()
+	srv.buffer = append(srv.buffer, heartbeats...)
+	full := len(srv.buffer) >= srv.config.App.HeartbeatBufferSize
+	srv.bufferLock.Unlock()
+
+	if full {
+		select {
+		case srv.bufferFull <- struct{}{}:
+		default: // flush already pending
+		}
+	}
+	return nil
+}
+
+func (srv *HeartbeatService) persistBuffered(heartbeats []*models.Heartbeat) error {
+	if len(heartbeats) == 0 {
+		return nil
+	}
+	for i, chunk := range slice.Chunk(heartbeats, heartbeatBufferChunkSize) {
+		if err := srv.repository.InsertBatch(chunk); err != nil {
+			remaining := heartbeats[i*heartbeatBufferChunkSize:]
+			config.Log().Error("failed to write buffered heartbeats, retrying with next flush", "count", len(remaining), "error", err)
+			srv.bufferLock.Lock()
+			srv.buffer = append(append(make([]*models.Heartbeat, 0, len(remaining)+len(srv.buffer)), remaining...), srv.buffer...)
+			srv.bufferLock.Unlock()
+			return err
+		}
+		go srv.notifyBatch(chunk)
+	}
+	return nil
+}
+
 func (srv *HeartbeatService) notifyBatch(heartbeats []*models.Heartbeat) {
 	for _, hb := range heartbeats {
 		srv.eventBus.Publish(hub.Message{
@@ -302,6 +465,10 @@ func (srv *HeartbeatService) countByUserCacheKey(userId string) string {
 	return fmt.Sprintf("%s--hearbeat-count", userId)
 }
 
+func (srv *HeartbeatService) quotaNotifiedCacheKey(userId string) string {
+	return fmt.Sprintf("%s--quota-notified", userId)
+}
+
 func (srv *HeartbeatService) countTotalCacheKey() string {
 	return "heartbeat-count"
 }
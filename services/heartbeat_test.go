@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHeartbeatService_InsertImported(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatBufferSec = 3600 // imports are written right away regardless
+	cfg.App.HeartbeatBufferSize = 100
+	config.Set(cfg)
+
+	repo := new(mocks.HeartbeatRepositoryMock)
+	repo.On("InsertBatchCounted", mock.Anything).Return(int64(1), nil)
+
+	sut := NewHeartbeatService(repo, nil)
+
+	hb1 := (&models.Heartbeat{UserID: "user1", Entity: "a", Time: models.CustomTime(time.Now())}).Hashed()
+	hb2 := (&models.Heartbeat{UserID: "user1", Entity: "b", Time: models.CustomTime(time.Now())}).Hashed()
+
+	n, err := sut.InsertImported([]*models.Heartbeat{hb1, hb2, hb1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	repo.AssertNumberOfCalls(t, "InsertBatchCounted", 1)
+	assert.Len(t, repo.Calls[0].Arguments.Get(0), 2)
+	repo.AssertNotCalled(t, "InsertBatch", mock.Anything)
+}
+
+func TestHeartbeatService_InsertBatch_Buffered(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatBufferSec = 3600 // only flush explicitly or by size within this test
+	cfg.App.HeartbeatBufferSize = 3
+	config.Set(cfg)
+
+	flushed := make(chan int, 10)
+
+	repo := new(mocks.HeartbeatRepositoryMock)
+	repo.On("InsertBatch", mock.Anything).Run(func(args mock.Arguments) {
+		flushed <- len(args.Get(0).([]*models.Heartbeat))
+	}).Return(nil)
+
+	sut := NewHeartbeatService(repo, nil)
+
+	newHeartbeat := func(entity string) *models.Heartbeat {
+		return (&models.Heartbeat{UserID: "user1", Entity: entity, Time: models.CustomTime(time.Now())}).Hashed()
+	}
+
+	assert.Nil(t, sut.InsertBatch([]*models.Heartbeat{newHeartbeat("a"), newHeartbeat("b")}))
+	assert.Empty(t, flushed)
+
+	// size threshold reached, flushed in the background instead of within the request
+	assert.Nil(t, sut.InsertBatch([]*models.Heartbeat{newHeartbeat("c")}))
+	select {
+	case n := <-flushed:
+		assert.Equal(t, 3, n)
+	case <-time.After(time.Second):
+		assert.Fail(t, "buffer not flushed")
+	}
+
+	// explicit flush, e.g. on shutdown
+	assert.Nil(t, sut.InsertBatch([]*models.Heartbeat{newHeartbeat("d")}))
+	assert.Nil(t, sut.Flush())
+	assert.Equal(t, 1, <-flushed)
+
+	// nothing left to flush
+	assert.Nil(t, sut.Flush())
+	assert.Empty(t, flushed)
+}
+
+func TestHeartbeatService_Flush_Failed(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatBufferSec = 3600
+	cfg.App.HeartbeatBufferSize = 100
+	config.Set(cfg)
+
+	repo := new(mocks.HeartbeatRepositoryMock)
+	repo.On("InsertBatch", mock.Anything).Return(errors.New("database unavailable")).Once()
+	repo.On("InsertBatch", mock.Anything).Return(nil).Once()
+
+	sut := NewHeartbeatService(repo, nil)
+
+	heartbeats := []*models.Heartbeat{
+		(&models.Heartbeat{UserID: "user1", Entity: "a", Time: models.CustomTime(time.Now())}).Hashed(),
+		(&models.Heartbeat{UserID: "user1", Entity: "b", Time: models.CustomTime(time.Now())}).Hashed(),
+	}
+	assert.Nil(t, sut.InsertBatch(heartbeats))
+
+	// heartbeats are kept for the next flush instead of being dropped
+	assert.Error(t, sut.Flush())
+	assert.Len(t, sut.buffer, 2)
+
+	assert.Nil(t, sut.Flush())
+	assert.Empty(t, sut.buffer)
+	repo.AssertNumberOfCalls(t, "InsertBatch", 2)
+	assert.Equal(t, heartbeats, repo.Calls[1].Arguments.Get(0))
+}
+
+func TestHeartbeatService_InsertBatch_OversizedFields(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.HeartbeatMaxFieldLen = 16
+	config.Set(cfg)
+
+	newBatch := func() []*models.Heartbeat {
+		return []*models.Heartbeat{
+			(&models.Heartbeat{UserID: "user1", Entity: "a", Time: models.CustomTime(time.Now())}).Hashed(),
+			(&models.Heartbeat{UserID: "user1", Entity: "b", Branch: strings.Repeat("x", 17), Time: models.CustomTime(time.Now())}).Hashed(),
+			(&models.Heartbeat{UserID: "user1", Entity: "c", Category: strings.Repeat("y", 300), Time: models.CustomTime(time.Now())}).Hashed(),
+		}
+	}
+
+	// skipped if truncation is disabled
+	repo := new(mocks.HeartbeatRepositoryMock)
+	repo.On("InsertBatch", mock.Anything).Return(nil)
+
+	sut := NewHeartbeatService(repo, nil)
+	assert.Nil(t, sut.InsertBatch(newBatch()))
+	inserted := repo.Calls[0].Arguments.Get(0).([]*models.Heartbeat)
+	assert.Len(t, inserted, 1)
+	assert.Equal(t, "a", inserted[0].Entity)
+
+	// truncated if enabled
+	cfg.App.TruncateHeartbeats = true
+	repo = new(mocks.HeartbeatRepositoryMock)
+	repo.On("InsertBatch", mock.Anything).Return(nil)
+
+	sut = NewHeartbeatService(repo, nil)
+	assert.Nil(t, sut.InsertBatch(newBatch()))
+	inserted = repo.Calls[0].Arguments.Get(0).([]*models.Heartbeat)
+	assert.Len(t, inserted, 3)
+	assert.Equal(t, strings.Repeat("x", 16), inserted[1].Branch)
+	assert.Equal(t, strings.Repeat("y", 16), inserted[2].Category)
+}
+
+func TestHeartbeatService_CheckQuota(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.MaxHeartbeats = 10
+	cfg.App.CountCacheTTLMin = 30
+	config.Set(cfg)
+
+	user := &models.User{ID: "user1"}
+
+	repo := new(mocks.HeartbeatRepositoryMock)
+	repo.On("CountByUser", user).Return(int64(9), nil)
+
+	sut := NewHeartbeatService(repo, nil)
+	sub := sut.eventBus.Subscribe(1, config.EventHeartbeatQuota)
+	defer sut.eventBus.Unsubscribe(sub)
+
+	assert.Nil(t, sut.CheckQuota(user))
+
+	sut.cache.IncrementInt64(sut.countByUserCacheKey(user.ID), 1) // as done upon heartbeat creation
+	assert.ErrorIs(t, sut.CheckQuota(user), ErrHeartbeatQuotaExceeded)
+	assert.ErrorIs(t, sut.CheckQuota(user), ErrHeartbeatQuotaExceeded)
+	repo.AssertNumberOfCalls(t, "CountByUser", 1) // counted only once
+
+	// notified only once
+	assert.Equal(t, int64(10), (<-sub.Receiver).Fields[config.FieldPayload])
+	assert.Len(t, sub.Receiver, 0)
+
+	// no limit for subscribers
+	cfg.Subscriptions.Enabled = true
+	subscribedUntil := models.CustomTime(time.Now().Add(24 * time.Hour))
+	user.SubscribedUntil = &subscribedUntil
+	assert.Nil(t, sut.CheckQuota(user))
+}
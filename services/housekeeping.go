@@ -1,22 +1,38 @@
 package services
 
 import (
+	datastructure "github.com/duke-git/lancet/v2/datastructure/set"
+	"github.com/duke-git/lancet/v2/datetime"
 	"github.com/duke-git/lancet/v2/slice"
-	"github.com/muety/artifex/v2"
 	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/utils"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// delay between dispatching the summary cache warming jobs of two consecutive users, to not flood the database right after startup
+const summaryCacheWarmingStagger = 500 * time.Millisecond
+
+// intervals to pre-compute summaries for
+// intervals ending at the current time (e.g. today or 7_days) never hit the summary cache and are therefore not warmed
+var summaryCacheWarmingIntervals = []*models.IntervalKey{
+	models.IntervalYesterday,
+	models.IntervalPast7DaysYesterday,
+	models.IntervalLastWeek,
+	models.IntervalLastMonth,
+}
+
 type HousekeepingService struct {
 	config        *config.Config
 	userSrvc      IUserService
 	heartbeatSrvc IHeartbeatService
 	summarySrvc   ISummaryService
-	queueDefault  *artifex.Dispatcher
-	queueWorkers  *artifex.Dispatcher
+	queueDefault  *config.JobQueue
+	queueWorkers  *config.JobQueue
 }
 
 func NewHousekeepingService(userService IUserService, heartbeatService IHeartbeatService, summaryService ISummaryService) *HousekeepingService {
@@ -32,10 +48,16 @@ func NewHousekeepingService(userService IUserService, heartbeatService IHeartbea
 
 func (s *HousekeepingService) Schedule() {
 	s.scheduleDataCleanups()
+	s.scheduleDownsampling()
 	s.scheduleInactiveUsersCleanup()
+	s.scheduleDeletedUsersCleanup()
+	s.scheduleStaleSessionsCleanup()
 	if s.config.App.WarmCaches {
 		s.scheduleProjectStatsCacheWarming()
 	}
+	if s.config.App.WarmSummaryCaches {
+		s.scheduleSummaryCacheWarming()
+	}
 }
 
 func (s *HousekeepingService) CleanUserDataBefore(user *models.User, before time.Time) error {
@@ -59,6 +81,68 @@ func (s *HousekeepingService) CleanUserDataBefore(user *models.User, before time
 	return nil
 }
 
+// DownsampleUserData replaces the user's raw heartbeats between the beginning of from's day and before (expected to be midnight) by persisted summaries of the configured granularity.
+// Summaries are already served from persisted summaries wherever present, so the downsampled period remains available transparently, except for features requiring heartbeats (e.g. filtered summaries or durations).
+func (s *HousekeepingService) DownsampleUserData(user *models.User, from, before time.Time) error {
+	slog.Info("downsampling user heartbeats older than", "userID", user.ID, "date", before, "granularity", s.config.App.DownsampleGranularity)
+
+	from = datetime.BeginOfDay(from.In(before.Location()))
+	if !from.Before(before) {
+		return nil
+	}
+
+	existing, err := s.summarySrvc.GetByUserWithin(user, from, before)
+	if err != nil {
+		return err
+	}
+	persisted := datastructure.New[int64]()
+	for _, summary := range existing {
+		persisted.Add(summary.FromTime.T().Unix())
+	}
+
+	for _, day := range utils.SplitRangeByDays(from, before) {
+		var summaries []*models.Summary
+
+		if s.config.App.DownsampleGranularity == config.DownsampleHourly {
+			for hour := day[0]; hour.Before(day[1]); hour = hour.Add(time.Hour) {
+				summary, err := s.summarySrvc.Summarize(hour, hour.Add(time.Hour), user, nil)
+				if err != nil {
+					return err
+				}
+				if summary.TotalTime() > 0 {
+					summaries = append(summaries, summary)
+				}
+			}
+		} else if !persisted.Contain(day[0].Unix()) {
+			// days covered by the regular aggregation already are kept as is, i.e. no need to re-compute them
+			summary, err := s.summarySrvc.Summarize(day[0], day[1], user, nil)
+			if err != nil {
+				return err
+			}
+			summaries = append(summaries, summary)
+		} else {
+			continue
+		}
+
+		if err := s.summarySrvc.DeleteByUserWithin(user.ID, day[0], day[1]); err != nil {
+			return err
+		}
+		for _, summary := range summaries {
+			if err := s.summarySrvc.Insert(summary); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.config.App.DataCleanupDryRun {
+		slog.Info("skipping actual heartbeat deletion for dry run", "userID", user.ID)
+		return nil
+	}
+
+	// only delete heartbeats once all summaries have been persisted
+	return s.heartbeatSrvc.DeleteByUserBefore(user, before)
+}
+
 func (s *HousekeepingService) CleanInactiveUsers(before time.Time) error {
 	slog.Info("cleaning up users inactive since", "date", before)
 	users, err := s.userSrvc.GetAll()
@@ -84,6 +168,28 @@ func (s *HousekeepingService) CleanInactiveUsers(before time.Time) error {
 	return nil
 }
 
+// CleanDeletedUsers permanently deletes all users who requested their account to be deleted and whose grace period has passed
+func (s *HousekeepingService) CleanDeletedUsers() error {
+	slog.Info("cleaning up users pending deletion")
+	users, err := s.userSrvc.GetAllDeletionDue()
+	if err != nil {
+		return err
+	}
+
+	var i int
+	for _, u := range users {
+		slog.Warn("permanently deleting user after deletion grace period", "userID", u.ID)
+		if err := s.userSrvc.Delete(u); err != nil {
+			config.Log().Error("failed to delete user", "userID", u.ID)
+		} else {
+			i++
+		}
+	}
+	slog.Info("deleted users pending deletion", "deletedCount", i)
+
+	return nil
+}
+
 func (s *HousekeepingService) WarmUserProjectStatsCache(user *models.User) error {
 	slog.Info("pre-warming project stats cache for user", "userID", user.ID)
 	if _, err := s.heartbeatSrvc.GetUserProjectStats(user, time.Time{}, utils.BeginOfToday(time.Local), nil, true); err != nil {
@@ -92,6 +198,53 @@ func (s *HousekeepingService) WarmUserProjectStatsCache(user *models.User) error
 	return nil
 }
 
+// WarmUserSummaryCache pre-computes the user's summaries for commonly requested intervals, so that they are served from cache on the next request
+func (s *HousekeepingService) WarmUserSummaryCache(user *models.User) error {
+	for _, interval := range summaryCacheWarmingIntervals {
+		_, from, to := helpers.ResolveIntervalTZ(interval, user.TZ())
+		// same (empty) filters as for a plain dashboard request, to match its cache key
+		if _, err := s.summarySrvc.Aliased(from, to, user, s.summarySrvc.Retrieve, &models.Filters{}, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *HousekeepingService) runWarmSummaryCache() {
+	minDate := time.Now().AddDate(0, 0, -s.config.App.WarmSummaryCachesDays)
+	users, _, err := s.userSrvc.Query(&models.UserQuery{ActiveAfter: &minDate}, nil)
+	if err != nil {
+		config.Log().Error("failed to get recently active users for summary cache warming", "error", err)
+		return
+	}
+
+	slog.Info("pre-warming summary caches of recently active users", "userCount", len(users))
+
+	var wg sync.WaitGroup
+	var warmed atomic.Int32
+	for i, u := range users {
+		user := u.User
+		wg.Add(1)
+		// jobs are run by the housekeeping queue's workers, which bounds the number of users warmed concurrently
+		if err := s.queueWorkers.DispatchIn(func() {
+			defer wg.Done()
+			if err := s.WarmUserSummaryCache(&user); err != nil {
+				config.Log().Error("failed to pre-warm summary cache", "userID", user.ID, "error", err)
+				return
+			}
+			warmed.Add(1)
+		}, time.Duration(i)*summaryCacheWarmingStagger); err != nil {
+			wg.Done()
+			config.Log().Error("failed to dispatch summary cache warming", "userID", user.ID, "error", err)
+		}
+	}
+
+	go func() {
+		wg.Wait()
+		slog.Info("finished pre-warming summary caches", "warmedCount", warmed.Load(), "userCount", len(users))
+	}()
+}
+
 func (s *HousekeepingService) runWarmProjectStatsCache() {
 	// fetch active users
 	users, err := s.userSrvc.GetActive(false)
@@ -149,6 +302,41 @@ func (s *HousekeepingService) runCleanData() {
 	}
 }
 
+func (s *HousekeepingService) runDownsampling() {
+	before := s.config.App.DownsampledBefore()
+
+	users, err := s.userSrvc.GetAll()
+	if err != nil {
+		config.Log().Error("failed to get users for downsampling", "error", err)
+		return
+	}
+
+	firstHeartbeats, err := s.heartbeatSrvc.GetFirstByUsers()
+	if err != nil {
+		config.Log().Error("failed to get first heartbeats for downsampling", "error", err)
+		return
+	}
+	firstHeartbeatsByUser := make(map[string]time.Time, len(firstHeartbeats))
+	for _, t := range firstHeartbeats {
+		firstHeartbeatsByUser[t.User] = t.Time.T()
+	}
+
+	// schedule jobs
+	for _, u := range users {
+		first, ok := firstHeartbeatsByUser[u.ID]
+		if !ok || !first.Before(before) {
+			continue
+		}
+
+		user := *u
+		s.queueWorkers.Dispatch(func() {
+			if err := s.DownsampleUserData(&user, first, before); err != nil {
+				config.Log().Error("failed to downsample user data", "userID", user.ID, "error", err)
+			}
+		})
+	}
+}
+
 func (s *HousekeepingService) runCleanInactiveUsers() {
 	s.queueWorkers.Dispatch(func() {
 		if s.config.App.MaxInactiveMonths <= 0 {
@@ -160,6 +348,22 @@ func (s *HousekeepingService) runCleanInactiveUsers() {
 	})
 }
 
+func (s *HousekeepingService) runCleanDeletedUsers() {
+	s.queueWorkers.Dispatch(func() {
+		if err := s.CleanDeletedUsers(); err != nil {
+			config.Log().Error("failed to clean up users pending deletion", "error", err)
+		}
+	})
+}
+
+func (s *HousekeepingService) runCleanStaleSessions() {
+	s.queueWorkers.Dispatch(func() {
+		if err := s.userSrvc.DeleteStaleSessions(); err != nil {
+			config.Log().Error("failed to clean up stale sessions", "error", err)
+		}
+	})
+}
+
 // individual scheduling functions
 
 func (s *HousekeepingService) scheduleDataCleanups() {
@@ -175,6 +379,19 @@ func (s *HousekeepingService) scheduleDataCleanups() {
 	}
 }
 
+func (s *HousekeepingService) scheduleDownsampling() {
+	if s.config.App.DownsampleAfterDays <= 0 {
+		return
+	}
+
+	slog.Info("scheduling heartbeat downsampling")
+
+	_, err := s.queueDefault.DispatchCron(s.runDownsampling, s.config.App.DataCleanupTime)
+	if err != nil {
+		config.Log().Error("failed to dispatch downsampling jobs", "error", err)
+	}
+}
+
 func (s *HousekeepingService) scheduleInactiveUsersCleanup() {
 	if s.config.App.MaxInactiveMonths <= 0 {
 		return
@@ -188,6 +405,24 @@ func (s *HousekeepingService) scheduleInactiveUsersCleanup() {
 	}
 }
 
+func (s *HousekeepingService) scheduleDeletedUsersCleanup() {
+	slog.Info("scheduling deleted users cleanup")
+
+	_, err := s.queueDefault.DispatchEvery(s.runCleanDeletedUsers, 1*time.Hour)
+	if err != nil {
+		config.Log().Error("failed to dispatch deleted users cleanup job", "error", err)
+	}
+}
+
+func (s *HousekeepingService) scheduleStaleSessionsCleanup() {
+	slog.Info("scheduling stale sessions cleanup")
+
+	_, err := s.queueDefault.DispatchEvery(s.runCleanStaleSessions, 1*time.Hour)
+	if err != nil {
+		config.Log().Error("failed to dispatch stale sessions cleanup job", "error", err)
+	}
+}
+
 func (s *HousekeepingService) scheduleProjectStatsCacheWarming() {
 	slog.Info("scheduling project stats cache pre-warming")
 
@@ -203,3 +438,16 @@ func (s *HousekeepingService) scheduleProjectStatsCacheWarming() {
 		}
 	}
 }
+
+func (s *HousekeepingService) scheduleSummaryCacheWarming() {
+	if s.config.QuickStart {
+		return
+	}
+
+	slog.Info("scheduling summary cache pre-warming")
+
+	// run once, 1 min after start
+	if err := s.queueDefault.DispatchIn(s.runWarmSummaryCache, 1*time.Minute); err != nil {
+		config.Log().Error("failed to dispatch pre-warming summary cache", "error", err)
+	}
+}
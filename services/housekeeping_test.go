@@ -1,9 +1,11 @@
 package services
 
 import (
+	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/mocks"
 	"github.com/muety/wakapi/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"testing"
 	"time"
@@ -48,3 +50,74 @@ func (suite *HousekeepingServiceTestSuite) TestHousekeepingService_CleanInactive
 	suite.UserService.AssertNumberOfCalls(suite.T(), "Delete", 1)
 	suite.UserService.AssertCalled(suite.T(), "Delete", suite.TestUsers[0])
 }
+
+func (suite *HousekeepingServiceTestSuite) TestHousekeepingService_WarmUserSummaryCache() {
+	sut := NewHousekeepingService(suite.UserService, suite.HeartbeatService, suite.SummaryService)
+
+	user := &models.User{ID: "testuser01"}
+	suite.SummaryService.On("Aliased", mock.Anything, mock.Anything, user, mock.Anything, mock.Anything).Return(&models.Summary{}, nil)
+
+	err := sut.WarmUserSummaryCache(user)
+
+	assert.Nil(suite.T(), err)
+	suite.SummaryService.AssertNumberOfCalls(suite.T(), "Aliased", len(summaryCacheWarmingIntervals))
+}
+
+func (suite *HousekeepingServiceTestSuite) TestHousekeepingService_DownsampleUserData_Daily() {
+	cfg := config.Empty()
+	cfg.App.DownsampleGranularity = config.DownsampleDaily
+	config.Set(cfg)
+
+	sut := NewHousekeepingService(suite.UserService, suite.HeartbeatService, suite.SummaryService)
+
+	user := &models.User{ID: "testuser01"}
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	day2, day3, before := day1.AddDate(0, 0, 1), day1.AddDate(0, 0, 2), day1.AddDate(0, 0, 3)
+	existing := &models.Summary{UserID: user.ID, FromTime: models.CustomTime(day2), ToTime: models.CustomTime(day3)}
+
+	suite.SummaryService.On("GetByUserWithin", user, day1, before).Return([]*models.Summary{existing}, nil)
+	suite.SummaryService.On("Summarize", mock.Anything, mock.Anything, user, mock.Anything).Return(&models.Summary{}, nil)
+	suite.SummaryService.On("DeleteByUserWithin", user.ID, mock.Anything, mock.Anything).Return(nil)
+	suite.SummaryService.On("Insert", mock.Anything).Return(nil)
+	suite.HeartbeatService.On("DeleteByUserBefore", user, before).Return(nil)
+
+	err := sut.DownsampleUserData(user, day1.Add(10*time.Hour), before)
+
+	assert.Nil(suite.T(), err)
+	// day 2 was aggregated already
+	suite.SummaryService.AssertNumberOfCalls(suite.T(), "Summarize", 2)
+	suite.SummaryService.AssertCalled(suite.T(), "Summarize", day1, day2, user, mock.Anything)
+	suite.SummaryService.AssertCalled(suite.T(), "Summarize", day3, before, user, mock.Anything)
+	suite.SummaryService.AssertNumberOfCalls(suite.T(), "Insert", 2)
+	suite.HeartbeatService.AssertCalled(suite.T(), "DeleteByUserBefore", user, before)
+}
+
+func (suite *HousekeepingServiceTestSuite) TestHousekeepingService_DownsampleUserData_Hourly() {
+	cfg := config.Empty()
+	cfg.App.DownsampleGranularity = config.DownsampleHourly
+	config.Set(cfg)
+
+	sut := NewHousekeepingService(suite.UserService, suite.HeartbeatService, suite.SummaryService)
+
+	user := &models.User{ID: "testuser01"}
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	before := day1.AddDate(0, 0, 1)
+	active := day1.Add(9 * time.Hour)
+	activeSummary := &models.Summary{Projects: models.SummaryItems{{Type: models.SummaryProject, Key: "wakapi", Total: 600}}}
+
+	suite.SummaryService.On("GetByUserWithin", user, day1, before).Return([]*models.Summary{{UserID: user.ID, FromTime: models.CustomTime(day1), ToTime: models.CustomTime(before)}}, nil)
+	suite.SummaryService.On("Summarize", active, active.Add(time.Hour), user, mock.Anything).Return(activeSummary, nil)
+	suite.SummaryService.On("Summarize", mock.Anything, mock.Anything, user, mock.Anything).Return(&models.Summary{}, nil)
+	suite.SummaryService.On("DeleteByUserWithin", user.ID, day1, before).Return(nil)
+	suite.SummaryService.On("Insert", activeSummary).Return(nil)
+	suite.HeartbeatService.On("DeleteByUserBefore", user, before).Return(nil)
+
+	err := sut.DownsampleUserData(user, active, before)
+
+	assert.Nil(suite.T(), err)
+	suite.SummaryService.AssertNumberOfCalls(suite.T(), "Summarize", 24)
+	// daily summary is replaced by the only non-empty hourly one
+	suite.SummaryService.AssertCalled(suite.T(), "DeleteByUserWithin", user.ID, day1, before)
+	suite.SummaryService.AssertNumberOfCalls(suite.T(), "Insert", 1)
+	suite.HeartbeatService.AssertCalled(suite.T(), "DeleteByUserBefore", user, before)
+}
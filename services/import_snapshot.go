@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+)
+
+const importSnapshotsRetained = 5 // per user, older snapshots are deleted when new imports start
+
+var ErrImportSnapshotNotFound = errors.New("import snapshot not found")
+
+// ImportSnapshotService persists a lightweight snapshot of a user's per-project and per-language totals before each import as key-value pair, to report what an import actually added
+type ImportSnapshotService struct {
+	config       *config.Config
+	keyValueSrvc IKeyValueService
+	summarySrvc  ISummaryService
+}
+
+func NewImportSnapshotService(keyValueService IKeyValueService, summaryService ISummaryService) *ImportSnapshotService {
+	return &ImportSnapshotService{
+		config:       config.Get(),
+		keyValueSrvc: keyValueService,
+		summarySrvc:  summaryService,
+	}
+}
+
+// Capture computes and stores the user's all-time totals as a new snapshot, to be called right before heartbeats are imported
+func (srv *ImportSnapshotService) Capture(user *models.User) (*models.ImportSnapshot, error) {
+	totals, err := srv.totals(user)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.ImportSnapshot{
+		ID:        uuid.Must(uuid.NewV4()).String(),
+		UserID:    user.ID,
+		CreatedAt: time.Now(),
+		Before:    totals,
+	}
+	if err := srv.put(snapshot); err != nil {
+		return nil, err
+	}
+
+	srv.prune(user)
+	return snapshot, nil
+}
+
+// Complete computes the user's totals after the import has finished and returns the difference to the snapshot taken before
+func (srv *ImportSnapshotService) Complete(user *models.User, snapshot *models.ImportSnapshot) (*models.ImportDiff, error) {
+	totals, err := srv.totals(user)
+	if err != nil {
+		return nil, err
+	}
+
+	finishedAt := time.Now()
+	snapshot.After = totals
+	snapshot.FinishedAt = &finishedAt
+	if err := srv.put(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot.Diff(), nil
+}
+
+func (srv *ImportSnapshotService) GetById(user *models.User, id string) (*models.ImportSnapshot, error) {
+	kv, err := srv.keyValueSrvc.GetString(srv.key(user.ID, id))
+	if err != nil {
+		return nil, ErrImportSnapshotNotFound
+	}
+	snapshot, err := srv.parse(kv)
+	if err != nil || snapshot.UserID != user.ID {
+		return nil, ErrImportSnapshotNotFound
+	}
+	return snapshot, nil
+}
+
+func (srv *ImportSnapshotService) GetLatest(user *models.User) (*models.ImportSnapshot, error) {
+	snapshots, err := srv.GetByUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, ErrImportSnapshotNotFound
+	}
+	return snapshots[0], nil
+}
+
+// GetByUser returns all snapshots of the given user, latest first
+func (srv *ImportSnapshotService) GetByUser(user *models.User) ([]*models.ImportSnapshot, error) {
+	kvs, err := srv.keyValueSrvc.GetByPrefix(srv.key(user.ID, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*models.ImportSnapshot, 0, len(kvs))
+	for _, kv := range kvs {
+		// prefix might also match keys of other users, whose id starts with this user's id
+		if snapshot, err := srv.parse(kv); err == nil && snapshot.UserID == user.ID {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+func (srv *ImportSnapshotService) totals(user *models.User) (*models.ImportTotals, error) {
+	summary, err := srv.summarySrvc.Aliased(time.Time{}, time.Now(), user, srv.summarySrvc.Retrieve, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewImportTotals(summary), nil
+}
+
+func (srv *ImportSnapshotService) prune(user *models.User) {
+	snapshots, err := srv.GetByUser(user)
+	if err != nil || len(snapshots) <= importSnapshotsRetained {
+		return
+	}
+	for _, snapshot := range snapshots[importSnapshotsRetained:] {
+		if err := srv.keyValueSrvc.DeleteString(srv.key(user.ID, snapshot.ID)); err != nil {
+			config.Log().Error("failed to delete outdated import snapshot", "userID", user.ID, "snapshotID", snapshot.ID, "error", err)
+		}
+	}
+}
+
+func (srv *ImportSnapshotService) put(snapshot *models.ImportSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return srv.keyValueSrvc.PutString(&models.KeyStringValue{
+		Key:   srv.key(snapshot.UserID, snapshot.ID),
+		Value: string(data),
+	})
+}
+
+func (srv *ImportSnapshotService) parse(kv *models.KeyStringValue) (*models.ImportSnapshot, error) {
+	var snapshot models.ImportSnapshot
+	if err := json.Unmarshal([]byte(kv.Value), &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (srv *ImportSnapshotService) key(userId, snapshotId string) string {
+	return fmt.Sprintf("%s_%s_%s", config.KeyImportSnapshot, userId, snapshotId)
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestImportSnapshotService_CaptureAndComplete(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "john"}
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("Aliased", mock.Anything, mock.Anything, user, mock.Anything, mock.Anything).Return(&models.Summary{
+		Projects:  models.SummaryItems{{Key: "wakapi", Total: 600}},
+		Languages: models.SummaryItems{{Key: "Go", Total: 600}},
+	}, nil).Once()
+	summaryServiceMock.On("Aliased", mock.Anything, mock.Anything, user, mock.Anything, mock.Anything).Return(&models.Summary{
+		Projects:  models.SummaryItems{{Key: "wakapi", Total: 900}, {Key: "anchr", Total: 3600}},
+		Languages: models.SummaryItems{{Key: "Go", Total: 4500}},
+	}, nil).Once()
+
+	var stored []string
+	keyValueServiceMock := new(mocks.KeyValueServiceMock)
+	keyValueServiceMock.On("PutString", mock.Anything).Run(func(args mock.Arguments) {
+		stored = append(stored, args.Get(0).(*models.KeyStringValue).Value)
+	}).Return(nil)
+	keyValueServiceMock.On("GetByPrefix", "import_snapshot_john_").Return([]*models.KeyStringValue{}, nil)
+
+	sut := NewImportSnapshotService(keyValueServiceMock, summaryServiceMock)
+
+	snapshot, err := sut.Capture(user)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, snapshot.ID)
+	assert.Equal(t, int64(600), snapshot.Before.Projects["wakapi"])
+	keyValueServiceMock.AssertCalled(t, "PutString", mock.MatchedBy(func(kv *models.KeyStringValue) bool {
+		return kv.Key == "import_snapshot_john_"+snapshot.ID
+	}))
+
+	diff, err := sut.Complete(user, snapshot)
+	assert.Nil(t, err)
+	assert.True(t, diff.Finished)
+	assert.Equal(t, int64(3900), diff.Added)
+	assert.Equal(t, []*models.ImportDiffItem{
+		{Key: "anchr", Before: 0, After: 3600, Added: 3600},
+		{Key: "wakapi", Before: 600, After: 900, Added: 300},
+	}, diff.Projects)
+	assert.Equal(t, []*models.ImportDiffItem{{Key: "Go", Before: 600, After: 4500, Added: 3900}}, diff.Languages)
+
+	// snapshot is persisted again, including the totals after the import
+	var persisted models.ImportSnapshot
+	assert.Len(t, stored, 2)
+	assert.Nil(t, json.Unmarshal([]byte(stored[1]), &persisted))
+	assert.Equal(t, diff.Added, persisted.Diff().Added)
+	assert.Equal(t, diff.Projects, persisted.Diff().Projects)
+}
+
+func TestImportSnapshotService_GetLatest(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "john"}
+	now := time.Now()
+
+	marshal := func(s *models.ImportSnapshot) *models.KeyStringValue {
+		data, _ := json.Marshal(s)
+		return &models.KeyStringValue{Key: "import_snapshot_" + s.UserID + "_" + s.ID, Value: string(data)}
+	}
+
+	keyValueServiceMock := new(mocks.KeyValueServiceMock)
+	keyValueServiceMock.On("GetByPrefix", "import_snapshot_john_").Return([]*models.KeyStringValue{
+		marshal(&models.ImportSnapshot{ID: "first", UserID: "john", CreatedAt: now.Add(-time.Hour)}),
+		marshal(&models.ImportSnapshot{ID: "other", UserID: "john_doe", CreatedAt: now}), // other user, whose id shares the prefix
+		marshal(&models.ImportSnapshot{ID: "second", UserID: "john", CreatedAt: now.Add(-time.Minute)}),
+		{Key: "import_snapshot_john_broken", Value: "{"},
+	}, nil)
+	keyValueServiceMock.On("GetByPrefix", "import_snapshot_jane_").Return([]*models.KeyStringValue{}, nil)
+
+	sut := NewImportSnapshotService(keyValueServiceMock, nil)
+
+	snapshots, err := sut.GetByUser(user)
+	assert.Nil(t, err)
+	assert.Len(t, snapshots, 2)
+
+	latest, err := sut.GetLatest(user)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", latest.ID)
+
+	_, err = sut.GetLatest(&models.User{ID: "jane"})
+	assert.ErrorIs(t, err, ErrImportSnapshotNotFound)
+}
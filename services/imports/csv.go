@@ -0,0 +1,169 @@
+package imports
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muety/wakapi/models"
+)
+
+const OriginCsv = "csv"
+
+var ErrInvalidCsv = errors.New("not a valid heartbeats csv file, requires a header row with at least a 'time' and an 'entity' or 'project' column")
+
+// CsvImporter reads heartbeats from a generic csv file, e.g. as converted from another time tracker's export.
+// The first row is a header, columns are matched by name (case-insensitive) and unknown columns are ignored.
+// Supported columns: time (unix seconds or rfc 3339), entity, type, category, project, branch, language, editor, operating_system, machine, is_write, lines.
+type CsvImporter struct {
+	filePath string
+}
+
+func NewCsvImporter(filePath string) *CsvImporter {
+	return &CsvImporter{filePath: filePath}
+}
+
+func (c *CsvImporter) Validate() error {
+	file, _, _, err := c.open()
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (c *CsvImporter) Import(user *models.User, minFrom time.Time, maxTo time.Time) (<-chan *models.Heartbeat, error) {
+	file, reader, columns, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *models.Heartbeat)
+	go func() {
+		defer close(out)
+		defer file.Close()
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					slog.Warn("failed to read csv row, aborting", "userID", user.ID, "line", parseErr.StartLine, "error", err)
+				} else {
+					slog.Warn("failed to read csv row, aborting", "userID", user.ID, "error", err)
+				}
+				return
+			}
+			line, _ := reader.FieldPos(0)
+
+			hb, err := mapCsvHeartbeat(record, columns, strconv.Itoa(line), user)
+			if err != nil {
+				slog.Warn("failed to parse csv heartbeat", "userID", user.ID, "line", line, "error", err)
+				continue
+			}
+			if hb.Time.T().Before(minFrom) || hb.Time.T().After(maxTo) || !hb.Valid() {
+				continue
+			}
+			out <- hb
+		}
+	}()
+
+	return out, nil
+}
+
+func (c *CsvImporter) ImportAll(user *models.User) (<-chan *models.Heartbeat, error) {
+	return c.Import(user, time.Time{}, time.Now())
+}
+
+// open reads the header row and returns the indices of all columns by their lower-cased name
+func (c *CsvImporter) open() (*os.File, *csv.Reader, map[string]int, error) {
+	file, err := os.Open(c.filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, ErrInvalidCsv
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	_, hasTime := columns["time"]
+	_, hasEntity := columns["entity"]
+	_, hasProject := columns["project"]
+	if !hasTime || (!hasEntity && !hasProject) {
+		file.Close()
+		return nil, nil, nil, ErrInvalidCsv
+	}
+
+	return file, reader, columns, nil
+}
+
+func mapCsvHeartbeat(record []string, columns map[string]int, id string, user *models.User) (*models.Heartbeat, error) {
+	get := func(column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	t, err := parseCsvTime(get("time"))
+	if err != nil {
+		return nil, err
+	}
+
+	hb := &models.Heartbeat{
+		User:            user,
+		UserID:          user.ID,
+		Entity:          get("entity"),
+		Type:            get("type"),
+		Category:        get("category"),
+		Project:         get("project"),
+		Branch:          get("branch"),
+		Language:        get("language"),
+		Editor:          get("editor"),
+		OperatingSystem: get("operating_system"),
+		Machine:         get("machine"),
+		Time:            models.CustomTime(t),
+		Origin:          OriginCsv,
+		OriginId:        id,
+	}
+
+	if hb.Entity == "" {
+		hb.Entity = hb.Project
+	}
+	if hb.Type == "" {
+		hb.Type = "file"
+	}
+	if isWrite := get("is_write"); isWrite != "" {
+		hb.IsWrite, _ = strconv.ParseBool(isWrite)
+	}
+	if lines := get("lines"); lines != "" {
+		hb.Lines, _ = strconv.Atoi(lines)
+	}
+
+	return hb.Sanitize().Hashed(), nil
+}
+
+func parseCsvTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*1e9)), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,96 @@
+package imports
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCsvImporter_ImportAll(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "heartbeats.csv")
+	assert.Nil(t, os.WriteFile(csvPath, []byte(`Time,Project,Language,Entity,Editor,OS_Unknown,is_write,lines
+1650000000.5,wakapi,Go,/home/user/main.go,vscode,ignored,true,42
+not a time,wakapi,Go,/home/user/main.go,vscode,,,
+2022-04-17T12:00:00Z,other,Markdown,,goland,,,
+`), 0600))
+
+	user := &models.User{ID: "user1"}
+	importer := NewCsvImporter(csvPath)
+	assert.Nil(t, importer.Validate())
+
+	stream, err := importer.ImportAll(user)
+	assert.Nil(t, err)
+
+	var heartbeats []*models.Heartbeat
+	for hb := range stream {
+		heartbeats = append(heartbeats, hb)
+	}
+
+	assert.Len(t, heartbeats, 2)
+
+	hb := heartbeats[0]
+	assert.Equal(t, "user1", hb.UserID)
+	assert.Equal(t, "wakapi", hb.Project)
+	assert.Equal(t, "Go", hb.Language)
+	assert.Equal(t, "/home/user/main.go", hb.Entity)
+	assert.Equal(t, "Vscode", hb.Editor)
+	assert.Equal(t, "file", hb.Type)
+	assert.True(t, hb.IsWrite)
+	assert.Equal(t, 42, hb.Lines)
+	assert.Equal(t, time.UnixMilli(1650000000500), hb.Time.T())
+	assert.Equal(t, OriginCsv, hb.Origin)
+	assert.Equal(t, "2", hb.OriginId)
+	assert.NotEmpty(t, hb.Hash)
+
+	hb = heartbeats[1]
+	assert.Equal(t, "other", hb.Entity) // falls back to project
+	assert.Equal(t, time.Date(2022, 4, 17, 12, 0, 0, 0, time.UTC), hb.Time.T().UTC())
+	assert.Equal(t, "4", hb.OriginId)
+}
+
+func TestCsvImporter_ImportAll_Malformed(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "heartbeats.csv")
+	assert.Nil(t, os.WriteFile(csvPath, []byte(`time,project
+1650000000,wakapi
+"1650000060,wakapi
+1650000120,wakapi
+`), 0600))
+
+	stream, err := NewCsvImporter(csvPath).ImportAll(&models.User{ID: "user1"})
+	assert.Nil(t, err)
+
+	var heartbeats []*models.Heartbeat
+	for hb := range stream {
+		heartbeats = append(heartbeats, hb)
+	}
+
+	// aborted at the malformed row
+	assert.Len(t, heartbeats, 1)
+	assert.Equal(t, "2", heartbeats[0].OriginId)
+}
+
+func TestCsvImporter_Validate_InvalidHeader(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "heartbeats.csv")
+	assert.Nil(t, os.WriteFile(csvPath, []byte("date,seconds\n2022-04-17,3600\n"), 0600))
+
+	assert.ErrorIs(t, NewCsvImporter(csvPath).Validate(), ErrInvalidCsv)
+	_, err := NewCsvImporter(csvPath).ImportAll(&models.User{ID: "user1"})
+	assert.ErrorIs(t, err, ErrInvalidCsv)
+}
+
+func TestNewFileImporter(t *testing.T) {
+	importer, err := NewFileImporter(FormatCsv, "heartbeats.csv")
+	assert.Nil(t, err)
+	assert.IsType(t, &CsvImporter{}, importer)
+
+	importer, err = NewFileImporter(FormatWakatimeOffline, ".wakatime.db")
+	assert.Nil(t, err)
+	assert.IsType(t, &WakatimeOfflineImporter{}, importer)
+
+	_, err = NewFileImporter("codestats", "export.json")
+	assert.ErrorIs(t, err, ErrInvalidImportFormat)
+}
@@ -1,11 +1,66 @@
 package imports
 
 import (
-	"github.com/muety/wakapi/models"
+	"errors"
 	"time"
+
+	"github.com/muety/wakapi/models"
+)
+
+const (
+	FormatWakatimeExport  = "wakatime_export"
+	FormatWakatimeOffline = "wakatime_offline"
+	FormatCsv             = "csv"
+)
+
+var (
+	ErrMissingApiKey       = errors.New("missing api key")
+	ErrInvalidImportFormat = errors.New("invalid import format")
 )
 
+// DataImporter streams heartbeats from some source, e.g. another service's api or an uploaded file
 type DataImporter interface {
+	// Validate checks whether the source can be read by this importer at all, without importing anything yet
+	Validate() error
 	Import(*models.User, time.Time, time.Time) (<-chan *models.Heartbeat, error)
 	ImportAll(*models.User) (<-chan *models.Heartbeat, error)
 }
+
+// FileImportFormat describes a file format that heartbeats can be imported from
+type FileImportFormat struct {
+	Name   string // form value and key to look up the format
+	Title  string // human-readable name, e.g. to display in a dropdown
+	Accept string // accepted file types of the upload input
+	create func(filePath string) DataImporter
+}
+
+// FileImportFormats are all supported file formats, in order of display
+var FileImportFormats = []*FileImportFormat{
+	{
+		Name:   FormatWakatimeExport,
+		Title:  "WakaTime Data Export (JSON)",
+		Accept: ".json,application/json",
+		create: func(filePath string) DataImporter { return NewWakatimeExportImporter(filePath) },
+	},
+	{
+		Name:   FormatWakatimeOffline,
+		Title:  "WakaTime Offline Heartbeats (~/.wakatime.db)",
+		create: func(filePath string) DataImporter { return NewWakatimeOfflineImporter(filePath) },
+	},
+	{
+		Name:   FormatCsv,
+		Title:  "Generic CSV",
+		Accept: ".csv,text/csv",
+		create: func(filePath string) DataImporter { return NewCsvImporter(filePath) },
+	},
+}
+
+// NewFileImporter creates an importer for the file at the given path according to the given format name
+func NewFileImporter(format, filePath string) (DataImporter, error) {
+	for _, f := range FileImportFormats {
+		if f.Name == format {
+			return f.create(filePath), nil
+		}
+	}
+	return nil, ErrInvalidImportFormat
+}
@@ -16,6 +16,13 @@ func NewWakatimeImporter(apiKey string, forceLegacy bool) *WakatimeImporter {
 	return &WakatimeImporter{apiKey: apiKey, forceLegacy: forceLegacy}
 }
 
+func (w *WakatimeImporter) Validate() error {
+	if w.apiKey == "" {
+		return ErrMissingApiKey
+	}
+	return nil
+}
+
 func (w *WakatimeImporter) Import(user *models.User, minFrom time.Time, maxTo time.Time) (<-chan *models.Heartbeat, error) {
 	if strings.Contains(user.WakaTimeURL(config.WakatimeApiUrl), "wakatime.com") && !w.forceLegacy {
 		return NewWakatimeDumpImporter(w.apiKey).Import(user, minFrom, maxTo)
@@ -23,7 +23,7 @@ import (
 type WakatimeDumpImporter struct {
 	apiKey     string
 	httpClient *http.Client
-	queue      *artifex.Dispatcher
+	queue      *config.JobQueue
 }
 
 func NewWakatimeDumpImporter(apiKey string) *WakatimeDumpImporter {
@@ -34,6 +34,13 @@ func NewWakatimeDumpImporter(apiKey string) *WakatimeDumpImporter {
 	}
 }
 
+func (w *WakatimeDumpImporter) Validate() error {
+	if w.apiKey == "" {
+		return ErrMissingApiKey
+	}
+	return nil
+}
+
 func (w *WakatimeDumpImporter) Import(user *models.User, minFrom time.Time, maxTo time.Time) (<-chan *models.Heartbeat, error) {
 	out := make(chan *models.Heartbeat)
 	slog.Info("running wakatime dump import for user", "userID", user.ID)
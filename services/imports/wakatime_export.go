@@ -0,0 +1,134 @@
+package imports
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	wakatime "github.com/muety/wakapi/models/compat/wakatime/v1"
+)
+
+var (
+	ErrNoWakatimeExport      = errors.New("not a wakatime data export")
+	ErrWakatimeSummaryExport = errors.New("this is a wakatime export of daily summaries, please export your heartbeats instead")
+)
+
+type wakatimeExportDay struct {
+	Date       string                     `json:"date"`
+	Heartbeats []*wakatime.HeartbeatEntry `json:"heartbeats"`
+}
+
+// WakatimeExportImporter reads heartbeats from a json data export file as downloadable from wakatime's settings, without requiring api access.
+// The file is decoded day by day to not have to hold the entire export in memory.
+type WakatimeExportImporter struct {
+	filePath string
+}
+
+func NewWakatimeExportImporter(filePath string) *WakatimeExportImporter {
+	return &WakatimeExportImporter{filePath: filePath}
+}
+
+func (w *WakatimeExportImporter) Validate() error {
+	file, _, _, err := w.open()
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (w *WakatimeExportImporter) Import(user *models.User, minFrom time.Time, maxTo time.Time) (<-chan *models.Heartbeat, error) {
+	file, decoder, firstDay, err := w.open()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *models.Heartbeat)
+	go func() {
+		defer close(out)
+		defer file.Close()
+
+		// user agents and machines are only referenced by id and can't be resolved without api access
+		userAgents, machineNames := map[string]*wakatime.UserAgentEntry{}, map[string]*wakatime.MachineEntry{}
+
+		for day := firstDay; day != nil; {
+			for _, h := range day.Heartbeats {
+				hb := mapHeartbeat(h, userAgents, machineNames, user)
+				if hb.Time.T().Before(minFrom) || hb.Time.T().After(maxTo) {
+					continue
+				}
+				out <- hb
+			}
+
+			day = nil
+			if decoder.More() {
+				if err := decoder.Decode(&day); err != nil {
+					config.Log().Error("failed to decode wakatime export, aborting", "userID", user.ID, "error", err)
+					return
+				}
+			}
+		}
+		slog.Info("finished reading wakatime export", "userID", user.ID)
+	}()
+
+	return out, nil
+}
+
+func (w *WakatimeExportImporter) ImportAll(user *models.User) (<-chan *models.Heartbeat, error) {
+	return w.Import(user, config.BeginningOfWakatime(), time.Now())
+}
+
+// open positions a decoder at the export's first day, which is validated right away to reject mismatching exports before starting to stream
+func (w *WakatimeExportImporter) open() (*os.File, *json.Decoder, *wakatimeExportDay, error) {
+	file, err := os.Open(w.filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	decoder := json.NewDecoder(file)
+	if err := seekExportDays(decoder); err != nil {
+		file.Close()
+		return nil, nil, nil, err
+	}
+
+	var firstDay *wakatimeExportDay
+	if decoder.More() {
+		if err := decoder.Decode(&firstDay); err != nil {
+			file.Close()
+			return nil, nil, nil, ErrNoWakatimeExport
+		}
+		if firstDay.Heartbeats == nil {
+			file.Close()
+			return nil, nil, nil, ErrWakatimeSummaryExport
+		}
+	}
+
+	return file, decoder, firstDay, nil
+}
+
+// seekExportDays advances the decoder to the beginning of the export's array of days, skipping all other top-level fields (e.g. user or range)
+func seekExportDays(decoder *json.Decoder) error {
+	if t, err := decoder.Token(); err != nil || t != json.Delim('{') {
+		return ErrNoWakatimeExport
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return ErrNoWakatimeExport
+		}
+		if key == "days" {
+			if t, err := decoder.Token(); err != nil || t != json.Delim('[') {
+				return ErrNoWakatimeExport
+			}
+			return nil
+		}
+		var skipped json.RawMessage
+		if err := decoder.Decode(&skipped); err != nil {
+			return ErrNoWakatimeExport
+		}
+	}
+	return ErrNoWakatimeExport
+}
@@ -0,0 +1,75 @@
+package imports
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWakatimeExportImporter_ImportAll(t *testing.T) {
+	exportPath := filepath.Join(t.TempDir(), "wakatime.json")
+	assert.Nil(t, os.WriteFile(exportPath, []byte(`{
+		"user": {"username": "johndoe", "email": "johndoe@example.org"},
+		"range": {"start": 1649980800, "end": 1650153599},
+		"days": [
+			{"date": "2022-04-15", "heartbeats": [
+				{"id": "a1", "entity": "/home/user/main.go", "type": "file", "category": "coding", "project": "wakapi", "branch": "master", "language": "Go", "is_write": true, "time": 1650000000.5, "machine_name_id": "m1", "user_agent_id": "wakatime/v1.18.9 (linux-5.13.0-39-generic-x86_64) go1.18 vscode/1.66.2 vscode-wakatime/18.1.5"}
+			]},
+			{"date": "2022-04-16", "heartbeats": []},
+			{"date": "2022-04-17", "heartbeats": [
+				{"id": "a2", "entity": "/home/user/README.md", "type": "file", "category": "coding", "project": "wakapi", "language": "Markdown", "time": 1650200000, "machine_name_id": "m1", "user_agent_id": "u1"}
+			]}
+		]
+	}`), 0600))
+
+	user := &models.User{ID: "user1"}
+	stream, err := NewWakatimeExportImporter(exportPath).ImportAll(user)
+	assert.Nil(t, err)
+
+	var heartbeats []*models.Heartbeat
+	for hb := range stream {
+		heartbeats = append(heartbeats, hb)
+	}
+
+	assert.Len(t, heartbeats, 2)
+	hb := heartbeats[0]
+	assert.Equal(t, "user1", hb.UserID)
+	assert.Equal(t, "wakapi", hb.Project)
+	assert.Equal(t, "Go", hb.Language)
+	assert.Equal(t, "vscode", hb.Editor)
+	assert.Equal(t, "Linux", hb.OperatingSystem)
+	assert.Equal(t, "m1", hb.Machine)
+	assert.Equal(t, time.UnixMilli(1650000000500), hb.Time.T())
+	assert.Equal(t, OriginWakatime, hb.Origin)
+	assert.Equal(t, "a1", hb.OriginId)
+	assert.NotEmpty(t, hb.Hash)
+	assert.Equal(t, "Markdown", heartbeats[1].Language)
+	assert.Equal(t, "unknown", heartbeats[1].Editor)
+}
+
+func TestWakatimeExportImporter_ImportAll_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	user := &models.User{ID: "user1"}
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	_, err := NewWakatimeExportImporter(write("garbage.json", `not json`)).ImportAll(user)
+	assert.ErrorIs(t, err, ErrNoWakatimeExport)
+
+	_, err = NewWakatimeExportImporter(write("other.json", `{"data": []}`)).ImportAll(user)
+	assert.ErrorIs(t, err, ErrNoWakatimeExport)
+
+	_, err = NewWakatimeExportImporter(write("summaries.json", `{"days": [{"date": "2022-04-15", "grand_total": {"total_seconds": 60}}]}`)).ImportAll(user)
+	assert.ErrorIs(t, err, ErrWakatimeSummaryExport)
+
+	_, err = NewWakatimeExportImporter(filepath.Join(dir, "missing.json")).ImportAll(user)
+	assert.Error(t, err)
+}
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"github.com/alitto/pond"
 	"github.com/duke-git/lancet/v2/datetime"
-	"github.com/muety/artifex/v2"
 	"github.com/muety/wakapi/utils"
 	"net/http"
 	"strings"
@@ -32,7 +31,7 @@ const (
 type WakatimeHeartbeatsImporter struct {
 	apiKey     string
 	httpClient *http.Client
-	queue      *artifex.Dispatcher
+	queue      *config.JobQueue
 }
 
 func NewWakatimeHeartbeatImporter(apiKey string) *WakatimeHeartbeatsImporter {
@@ -43,6 +42,13 @@ func NewWakatimeHeartbeatImporter(apiKey string) *WakatimeHeartbeatsImporter {
 	}
 }
 
+func (w *WakatimeHeartbeatsImporter) Validate() error {
+	if w.apiKey == "" {
+		return ErrMissingApiKey
+	}
+	return nil
+}
+
 func (w *WakatimeHeartbeatsImporter) Import(user *models.User, minFrom time.Time, maxTo time.Time) (<-chan *models.Heartbeat, error) {
 	out := make(chan *models.Heartbeat)
 
@@ -0,0 +1,145 @@
+package imports
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const OriginWakatimeOffline = "wakatime_offline"
+
+var ErrNoWakatimeOfflineDatabase = errors.New("not a wakatime offline database")
+
+// table in which wakatime-cli (legacy python implementation) buffers heartbeats while offline
+// see https://github.com/wakatime/legacy-python-cli/blob/master/wakatime/offlinequeue.py
+const wakatimeOfflineTable = "heartbeat_2"
+
+type wakatimeOfflineRow struct {
+	ID        string `gorm:"column:id"`
+	Heartbeat string `gorm:"column:heartbeat"`
+}
+
+type wakatimeOfflineHeartbeat struct {
+	Entity    string  `json:"entity"`
+	Type      string  `json:"type"`
+	Category  string  `json:"category"`
+	Project   string  `json:"project"`
+	Branch    string  `json:"branch"`
+	Language  string  `json:"language"`
+	IsWrite   bool    `json:"is_write"`
+	Lines     int     `json:"lines"`
+	LineNo    int     `json:"lineno"`
+	CursorPos int     `json:"cursorpos"`
+	UserAgent string  `json:"user_agent"`
+	Time      float64 `json:"time"`
+}
+
+// WakatimeOfflineImporter reads heartbeats from a wakatime-cli offline queue database (usually ~/.wakatime.db), which never made it to any server
+type WakatimeOfflineImporter struct {
+	dbPath string
+}
+
+func NewWakatimeOfflineImporter(dbPath string) *WakatimeOfflineImporter {
+	return &WakatimeOfflineImporter{dbPath: dbPath}
+}
+
+func (w *WakatimeOfflineImporter) Validate() error {
+	db, err := w.open()
+	if err != nil {
+		return err
+	}
+	if sqlDb, err := db.DB(); err == nil {
+		sqlDb.Close()
+	}
+	return nil
+}
+
+func (w *WakatimeOfflineImporter) Import(user *models.User, minFrom time.Time, maxTo time.Time) (<-chan *models.Heartbeat, error) {
+	db, err := w.open()
+	if err != nil {
+		return nil, err
+	}
+	sqlDb, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*wakatimeOfflineRow
+	if err := db.Table(wakatimeOfflineTable).Find(&rows).Error; err != nil {
+		sqlDb.Close()
+		return nil, err
+	}
+	sqlDb.Close()
+
+	out := make(chan *models.Heartbeat, len(rows))
+	go func() {
+		defer close(out)
+
+		for _, row := range rows {
+			var entry wakatimeOfflineHeartbeat
+			if err := json.Unmarshal([]byte(row.Heartbeat), &entry); err != nil {
+				slog.Warn("failed to parse offline heartbeat", "userID", user.ID, "id", row.ID, "error", err)
+				continue
+			}
+
+			hb := mapWakatimeOfflineHeartbeat(&entry, row.ID, user)
+			if hb.Time.T().Before(minFrom) || hb.Time.T().After(maxTo) || !hb.Valid() {
+				continue
+			}
+			out <- hb
+		}
+	}()
+
+	return out, nil
+}
+
+func (w *WakatimeOfflineImporter) ImportAll(user *models.User) (<-chan *models.Heartbeat, error) {
+	return w.Import(user, time.Time{}, time.Now())
+}
+
+// open connects to the offline database and makes sure it actually contains a heartbeats queue
+func (w *WakatimeOfflineImporter) open() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(w.dbPath), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, err
+	}
+	if !db.Migrator().HasTable(wakatimeOfflineTable) {
+		if sqlDb, err := db.DB(); err == nil {
+			sqlDb.Close()
+		}
+		return nil, ErrNoWakatimeOfflineDatabase
+	}
+	return db, nil
+}
+
+func mapWakatimeOfflineHeartbeat(entry *wakatimeOfflineHeartbeat, id string, user *models.User) *models.Heartbeat {
+	opSys, editor, _ := utils.ParseUserAgent(entry.UserAgent)
+
+	return (&models.Heartbeat{
+		User:            user,
+		UserID:          user.ID,
+		Entity:          entry.Entity,
+		Type:            entry.Type,
+		Category:        entry.Category,
+		Project:         entry.Project,
+		Branch:          entry.Branch,
+		Language:        entry.Language,
+		IsWrite:         entry.IsWrite,
+		Editor:          editor,
+		OperatingSystem: opSys,
+		UserAgent:       entry.UserAgent,
+		Lines:           entry.Lines,
+		LineNo:          entry.LineNo,
+		CursorPos:       entry.CursorPos,
+		Time:            models.CustomTime(time.Unix(0, int64(entry.Time*1e9))),
+		Origin:          OriginWakatimeOffline,
+		OriginId:        id,
+	}).Hashed()
+}
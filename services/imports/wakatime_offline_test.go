@@ -0,0 +1,54 @@
+package imports
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestWakatimeOfflineImporter_ImportAll(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), ".wakatime.db")
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, db.Exec("create table heartbeat_2 (id text, heartbeat text)").Error)
+	assert.Nil(t, db.Exec("insert into heartbeat_2 (id, heartbeat) values (?, ?), (?, ?)",
+		"1", `{"entity":"/home/user/main.go","type":"file","category":"coding","project":"wakapi","branch":"master","language":"Go","is_write":true,"lines":42,"lineno":7,"cursorpos":3,"user_agent":"wakatime/v1.18.9 (linux-5.13.0-39-generic-x86_64) go1.18 vscode/1.66.2 vscode-wakatime/18.1.5","time":1650000000.5}`,
+		"2", `not json`,
+	).Error)
+	sqlDb, _ := db.DB()
+	sqlDb.Close()
+
+	user := &models.User{ID: "user1"}
+	stream, err := NewWakatimeOfflineImporter(dbPath).ImportAll(user)
+	assert.Nil(t, err)
+
+	var heartbeats []*models.Heartbeat
+	for hb := range stream {
+		heartbeats = append(heartbeats, hb)
+	}
+
+	assert.Len(t, heartbeats, 1)
+	hb := heartbeats[0]
+	assert.Equal(t, "user1", hb.UserID)
+	assert.Equal(t, "wakapi", hb.Project)
+	assert.Equal(t, "Go", hb.Language)
+	assert.Equal(t, "vscode", hb.Editor)
+	assert.Equal(t, "Linux", hb.OperatingSystem)
+	assert.True(t, hb.IsWrite)
+	assert.Equal(t, 42, hb.Lines)
+	assert.Equal(t, time.UnixMilli(1650000000500), hb.Time.T())
+	assert.Equal(t, OriginWakatimeOffline, hb.Origin)
+	assert.Equal(t, "1", hb.OriginId)
+	assert.NotEmpty(t, hb.Hash)
+}
+
+func TestWakatimeOfflineImporter_ImportAll_InvalidDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "empty.db")
+	_, err := NewWakatimeOfflineImporter(dbPath).ImportAll(&models.User{ID: "user1"})
+	assert.NotNil(t, err)
+}
@@ -5,7 +5,9 @@ import (
 	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/repositories"
+	"github.com/muety/wakapi/utils"
 	"github.com/patrickmn/go-cache"
+	"strings"
 	"time"
 )
 
@@ -53,6 +55,23 @@ func (srv *LanguageMappingService) ResolveByUser(userId string) (map[string]stri
 	return mappings, nil
 }
 
+// ResolveDetectionByUser returns the mappings to detect heartbeats' languages by upon ingest, i.e. the default ones, overridden by the server's and then the user's mappings, all with lower case extensions
+func (srv *LanguageMappingService) ResolveDetectionByUser(userId string) (map[string]string, error) {
+	userMappings, err := srv.GetByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := utils.CloneStringMap(models.DefaultLanguageMappings, false)
+	for k, v := range utils.CloneStringMap(srv.getServerMappings(), true) {
+		resolved[k] = v
+	}
+	for _, m := range userMappings {
+		resolved[strings.ToLower(m.Extension)] = m.Language
+	}
+	return resolved, nil
+}
+
 func (srv *LanguageMappingService) Create(mapping *models.LanguageMapping) (*models.LanguageMapping, error) {
 	result, err := srv.repository.Insert(mapping)
 	if err != nil {
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguageMappingService_ResolveDetectionByUser(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.CustomLanguages = map[string]string{"Vue": "Vue.js", "h": "C++"}
+	config.Set(cfg)
+
+	repositoryMock := new(mocks.LanguageMappingRepositoryMock)
+	repositoryMock.On("GetByUser", "john").Return([]*models.LanguageMapping{
+		{UserID: "john", Extension: "H", Language: "Objective-C"},
+		{UserID: "john", Extension: "blade.php", Language: "Blade"},
+	}, nil)
+
+	sut := NewLanguageMappingService(repositoryMock)
+	mappings, err := sut.ResolveDetectionByUser("john")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Go", mappings["go"])         // default
+	assert.Equal(t, "Vue.js", mappings["vue"])    // server's mapping overrides default
+	assert.Equal(t, "Objective-C", mappings["h"]) // user's mapping overrides both
+	assert.Equal(t, "Blade", mappings["blade.php"])
+	assert.NotContains(t, mappings, "H")
+	assert.NotContains(t, mappings, "Vue")
+	assert.Equal(t, "Go", models.DefaultLanguageMappings["go"]) // defaults left untouched
+	assert.Equal(t, "C", models.DefaultLanguageMappings["h"])
+
+	assert.Equal(t, "Blade", models.LanguageByExtension("views/home.blade.php", mappings))
+	assert.Equal(t, "PHP", models.LanguageByExtension("index.php", mappings))
+}
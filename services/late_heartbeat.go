@@ -0,0 +1,152 @@
+package services
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	datastructure "github.com/duke-git/lancet/v2/datastructure/set"
+	"github.com/duke-git/lancet/v2/datetime"
+	"github.com/leandro-lugaresi/hub"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+)
+
+const lateHeartbeatsPollInterval = 1 * time.Minute
+
+// LateHeartbeatService keeps persisted summaries in line with heartbeats arriving after their day was summarized already, e.g. from clients syncing after having been offline for a while.
+// The ranges of late heartbeats are collected per user and the persisted summaries within them are regenerated periodically, so that a client's backlog doesn't cause a recompute for every single batch.
+// Days whose raw heartbeats were downsampled are never recomputed, as their previous data would be lost (see late_heartbeats).
+type LateHeartbeatService struct {
+	config          *config.Config
+	eventBus        *hub.Hub
+	userSrvc        IUserService
+	summarySrvc     ISummaryService
+	aggregationSrvc IAggregationService
+	pending         map[string]*models.Interval // by user id
+	lock            sync.Mutex
+	queueDefault    *config.JobQueue
+	queueWorkers    *config.JobQueue
+}
+
+func NewLateHeartbeatService(userService IUserService, summaryService ISummaryService, aggregationService IAggregationService) *LateHeartbeatService {
+	srv := &LateHeartbeatService{
+		config:          config.Get(),
+		eventBus:        config.EventBus(),
+		userSrvc:        userService,
+		summarySrvc:     summaryService,
+		aggregationSrvc: aggregationService,
+		pending:         map[string]*models.Interval{},
+		queueDefault:    config.GetDefaultQueue(),
+		queueWorkers:    config.GetQueue(config.QueueProcessing),
+	}
+
+	sub := srv.eventBus.Subscribe(0, config.EventHeartbeatCreate)
+	go func(sub *hub.Subscription) {
+		for m := range sub.Receiver {
+			srv.addIfLate(m.Fields[config.FieldPayload].(*models.Heartbeat))
+		}
+	}(&sub)
+
+	return srv
+}
+
+// Schedule periodically recomputes the summaries affected by late heartbeats
+func (srv *LateHeartbeatService) Schedule() {
+	slog.Info("scheduling late heartbeat recomputation")
+
+	if _, err := srv.queueDefault.DispatchEvery(func() {
+		if err := srv.queueWorkers.Dispatch(srv.RecomputePending); err != nil {
+			config.Log().Error("failed to dispatch late heartbeat recomputation", "error", err)
+		}
+	}, lateHeartbeatsPollInterval); err != nil {
+		config.Log().Error("failed to schedule late heartbeat recomputation", "error", err)
+	}
+}
+
+// Add marks the user's persisted summaries between from and to (both inclusive) for recomputation
+func (srv *LateHeartbeatService) Add(userId string, from, to time.Time) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if interval, ok := srv.pending[userId]; ok {
+		if from.Before(interval.Start) {
+			interval.Start = from
+		}
+		if to.After(interval.End) {
+			interval.End = to
+		}
+		return
+	}
+	srv.pending[userId] = &models.Interval{Start: from, End: to}
+}
+
+// addIfLate marks the heartbeat's day for recomputation if it was summarized already, i.e. if it's a server-local day before today, regardless of the user's time zone (see recompute)
+func (srv *LateHeartbeatService) addIfLate(heartbeat *models.Heartbeat) {
+	if heartbeat.Time.T().Before(utils.BeginOfToday(time.Local)) {
+		srv.Add(heartbeat.UserID, heartbeat.Time.T(), heartbeat.Time.T())
+	}
+}
+
+// RecomputePending regenerates all persisted summaries marked for recomputation. Ranges failing to be recomputed (e.g. because of a concurrent aggregation) are retried next time.
+func (srv *LateHeartbeatService) RecomputePending() {
+	srv.lock.Lock()
+	pending := srv.pending
+	srv.pending = map[string]*models.Interval{}
+	srv.lock.Unlock()
+
+	for userId, interval := range pending {
+		user, err := srv.userSrvc.GetUserById(userId)
+		if err != nil {
+			config.Log().Warn("failed to get user for late heartbeat recomputation", "userID", userId, "error", err)
+			continue
+		}
+		if err := srv.recompute(user, interval.Start, interval.End); err != nil {
+			config.Log().Error("failed to recompute summaries for late heartbeats", "userID", userId, "error", err)
+			srv.Add(userId, interval.Start, interval.End)
+		}
+	}
+}
+
+func (srv *LateHeartbeatService) recompute(user *models.User, from, to time.Time) error {
+	tz := time.Local // summaries are persisted per server-local day, regardless of the user's time zone
+	from = datetime.BeginOfDay(from.In(tz))
+	to = datetime.BeginOfDay(to.In(tz)).AddDate(0, 0, 1)
+
+	if downsampled := srv.config.App.DownsampledBefore(); from.Before(downsampled) {
+		from = downsampled // heartbeats of the downsampled period might still arrive via imports or from before rejecting them was configured
+	}
+	if today := utils.BeginOfToday(tz); to.After(today) {
+		to = today
+	}
+	if !from.Before(to) {
+		return nil
+	}
+
+	// only days summarized already need to be recomputed, all others will be taken care of by the regular aggregation
+	summaries, err := srv.summarySrvc.GetByUserWithin(user, from, to)
+	if err != nil {
+		return err
+	}
+	days := datastructure.New[int64]()
+	for _, summary := range summaries {
+		days.Add(datetime.BeginOfDay(summary.FromTime.T().In(tz)).Unix())
+	}
+	if days.IsEmpty() {
+		return nil
+	}
+
+	for _, day := range utils.SplitRangeByDays(from, to) {
+		if !days.Contain(day[0].Unix()) {
+			continue
+		}
+		if _, err := srv.aggregationSrvc.RegenerateSummaries(user, day[0], day[1], nil); err != nil {
+			return err
+		}
+	}
+	srv.summarySrvc.FlushCache(user.ID)
+
+	slog.Info("recomputed summaries for late heartbeats", "userID", user.ID, "days", days.Size())
+	return nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLateHeartbeatService_RecomputePending(t *testing.T) {
+	config.Set(config.Empty())
+
+	local := time.Local
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+	defer func() { time.Local = local }()
+
+	user := &models.User{ID: "john", Location: "America/New_York"}
+	today := utils.BeginOfToday(time.Local) // not the user's
+	day1, day2, day3 := today.AddDate(0, 0, -3), today.AddDate(0, 0, -2), today.AddDate(0, 0, -1)
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", user.ID).Return(user, nil)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("GetByUserWithin", user, day1, day3).Return([]*models.Summary{
+		{UserID: user.ID, FromTime: models.CustomTime(day1), ToTime: models.CustomTime(day2)}, // day 2 wasn't summarized, yet
+	}, nil)
+	summaryServiceMock.On("FlushCache", user.ID).Return(0)
+
+	aggregationServiceMock := new(mocks.AggregationServiceMock)
+	aggregationServiceMock.On("RegenerateSummaries", user, day1, day2, mock.Anything).Return(0, errors.New("aggregation in progress")).Once()
+	aggregationServiceMock.On("RegenerateSummaries", user, day1, day2, mock.Anything).Return(1, nil).Once()
+
+	sut := NewLateHeartbeatService(userServiceMock, summaryServiceMock, aggregationServiceMock)
+	sut.Add(user.ID, day2.Add(3*time.Hour), day2.Add(4*time.Hour))
+	sut.Add(user.ID, day1.Add(10*time.Hour), day1.Add(11*time.Hour))
+
+	// failed to regenerate, so retried next time
+	sut.RecomputePending()
+	summaryServiceMock.AssertNotCalled(t, "FlushCache", user.ID)
+	assert.Len(t, sut.pending, 1)
+
+	sut.RecomputePending()
+	aggregationServiceMock.AssertNumberOfCalls(t, "RegenerateSummaries", 2)
+	summaryServiceMock.AssertCalled(t, "FlushCache", user.ID)
+	assert.Empty(t, sut.pending)
+}
+
+func TestLateHeartbeatService_addIfLate(t *testing.T) {
+	config.Set(config.Empty())
+
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	user := &models.User{ID: "john", Location: "Australia/Brisbane"} // utc+10
+	today := utils.BeginOfToday(time.Local)
+
+	sut := NewLateHeartbeatService(new(mocks.UserServiceMock), new(mocks.SummaryServiceMock), new(mocks.AggregationServiceMock))
+
+	// server-local today, no matter which day it is for the user
+	sut.addIfLate(&models.Heartbeat{UserID: user.ID, User: user, Time: models.CustomTime(today.Add(time.Minute))})
+	assert.Empty(t, sut.pending)
+
+	// server-local yesterday, no matter which day it is for the user
+	sut.addIfLate(&models.Heartbeat{UserID: user.ID, User: user, Time: models.CustomTime(today.Add(-time.Minute))})
+	assert.Len(t, sut.pending, 1)
+	assert.Equal(t, today.Add(-time.Minute), sut.pending[user.ID].Start)
+}
+
+func TestLateHeartbeatService_RecomputePending_Downsampled(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.DownsampleAfterDays = 2
+	config.Set(cfg)
+
+	user := &models.User{ID: "john"}
+	today := utils.BeginOfToday(time.Local)
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", user.ID).Return(user, nil)
+
+	summaryServiceMock := new(mocks.SummaryServiceMock)
+	summaryServiceMock.On("GetByUserWithin", user, today.AddDate(0, 0, -2), today).Return([]*models.Summary{}, nil)
+
+	aggregationServiceMock := new(mocks.AggregationServiceMock)
+
+	sut := NewLateHeartbeatService(userServiceMock, summaryServiceMock, aggregationServiceMock)
+	sut.Add(user.ID, today.AddDate(0, 0, -5), today.Add(-time.Hour))
+	sut.Add("unknown", today.AddDate(0, 0, -1), today.AddDate(0, 0, -1))
+	userServiceMock.On("GetUserById", "unknown").Return((*models.User)(nil), errors.New("not found"))
+
+	sut.RecomputePending()
+
+	summaryServiceMock.AssertExpectations(t)
+	aggregationServiceMock.AssertNotCalled(t, "RegenerateSummaries")
+	assert.Empty(t, sut.pending)
+}
@@ -1,9 +1,9 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"github.com/leandro-lugaresi/hub"
-	"github.com/muety/artifex/v2"
 	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/models"
@@ -14,9 +14,12 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+var ErrLeaderboardGenerationRunning = errors.New("leaderboard generation already in progress")
+
 type LeaderboardService struct {
 	config         *config.Config
 	cache          *cache.Cache
@@ -24,9 +27,10 @@ type LeaderboardService struct {
 	repository     repositories.ILeaderboardRepository
 	summaryService ISummaryService
 	userService    IUserService
-	queueDefault   *artifex.Dispatcher
-	queueWorkers   *artifex.Dispatcher
+	queueDefault   *config.JobQueue
+	queueWorkers   *config.JobQueue
 	defaultScope   *models.IntervalKey
+	generating     atomic.Bool // whether a full leaderboard generation is in progress
 }
 
 func NewLeaderboardService(leaderboardRepo repositories.ILeaderboardRepository, summaryService ISummaryService, userService IUserService) *LeaderboardService {
@@ -59,10 +63,12 @@ func NewLeaderboardService(leaderboardRepo repositories.ILeaderboardRepository,
 				config.Log().Error("failed to check existing leaderboards upon user update", "error", err)
 			}
 
-			if user.PublicLeaderboard && !exists {
+			ranked := user.PublicLeaderboard && !user.IsSoftDeleted() // users pending deletion are left out until restored
+
+			if ranked && !exists {
 				slog.Info("generating leaderboard after settings update", "userID", user.ID)
 				srv.ComputeLeaderboard([]*models.User{user}, srv.defaultScope, []uint8{models.SummaryLanguage})
-			} else if !user.PublicLeaderboard && exists {
+			} else if !ranked && exists {
 				slog.Info("clearing leaderboard after settings update", "userID", user.ID)
 				if err := srv.repository.DeleteByUser(user.ID); err != nil {
 					config.Log().Error("failed to clear leaderboard for user", "userID", user.ID, "error", err)
@@ -72,6 +78,14 @@ func NewLeaderboardService(leaderboardRepo repositories.ILeaderboardRepository,
 		}
 	}(&onUserUpdate)
 
+	// org leaderboards are cached, while members are determined when querying them
+	onUserOrgUpdate := srv.eventBus.Subscribe(0, config.EventUserOrgUpdate)
+	go func(sub *hub.Subscription) {
+		for range sub.Receiver {
+			srv.cache.Flush()
+		}
+	}(&onUserOrgUpdate)
+
 	return srv
 }
 
@@ -83,12 +97,9 @@ func (srv *LeaderboardService) Schedule() {
 	slog.Info("scheduling leaderboard generation")
 
 	generate := func() {
-		users, err := srv.userService.GetAllByLeaderboard(true)
-		if err != nil {
-			config.Log().Error("failed to get users for leaderboard generation", "error", err)
-			return
+		if _, err := srv.ComputeAll(srv.defaultScope); err != nil {
+			config.Log().Error("failed to generate leaderboard", "error", err)
 		}
-		srv.ComputeLeaderboard(users, srv.defaultScope, []uint8{models.SummaryLanguage})
 	}
 
 	for _, cronExp := range srv.config.App.GetLeaderboardGenerationTimeCron() {
@@ -98,7 +109,29 @@ func (srv *LeaderboardService) Schedule() {
 	}
 }
 
+// ComputeAll regenerates the leaderboard of all participating users for the given interval and returns the number of users ranked.
+// Only one such generation runs at a time, ErrLeaderboardGenerationRunning is returned if another one is still in progress.
+func (srv *LeaderboardService) ComputeAll(interval *models.IntervalKey) (int, error) {
+	if !srv.generating.CompareAndSwap(false, true) {
+		return 0, ErrLeaderboardGenerationRunning
+	}
+	defer srv.generating.Store(false)
+
+	users, err := srv.userService.GetAllByLeaderboard(true)
+	if err != nil {
+		return 0, err
+	}
+	return srv.computeLeaderboard(users, interval, []uint8{models.SummaryLanguage}), nil
+}
+
 func (srv *LeaderboardService) ComputeLeaderboard(users []*models.User, interval *models.IntervalKey, by []uint8) error {
+	srv.computeLeaderboard(users, interval, by)
+	return nil
+}
+
+// computeLeaderboard returns the number of users, for whom a general leaderboard item was persisted
+func (srv *LeaderboardService) computeLeaderboard(users []*models.User, interval *models.IntervalKey, by []uint8) int {
+	var ranked int
 	slog.Info("generating leaderboard", "interval", (*interval)[0], "userCount", len(users), "aggregationCount", len(by))
 
 	for _, user := range users {
@@ -117,6 +150,7 @@ func (srv *LeaderboardService) ComputeLeaderboard(users []*models.User, interval
 			config.Log().Error("failed to persist general leaderboard for user", "userID", user.ID, "error", err)
 			continue
 		}
+		ranked++
 
 		for _, by := range by {
 			items, err := srv.GenerateAggregatedByUser(user, interval, by)
@@ -137,8 +171,8 @@ func (srv *LeaderboardService) ComputeLeaderboard(users []*models.User, interval
 	}
 
 	srv.cache.Flush()
-	slog.Info("finished leaderboard generation")
-	return nil
+	slog.Info("finished leaderboard generation", "rankedCount", ranked)
+	return ranked
 }
 
 func (srv *LeaderboardService) ExistsAnyByUser(userId string) (bool, error) {
@@ -169,13 +203,21 @@ func (srv *LeaderboardService) GetByIntervalAndUser(interval *models.IntervalKey
 }
 
 func (srv *LeaderboardService) GetAggregatedByInterval(interval *models.IntervalKey, by *uint8, pageParams *utils.PageParams, resolveUsers bool) (models.Leaderboard, error) {
+	return srv.GetAggregatedByIntervalAndOrg(interval, nil, by, pageParams, resolveUsers)
+}
+
+// GetAggregatedByIntervalAndOrg ranks only the members of the given org ("" for users not belonging to any org), or all users, if nil
+func (srv *LeaderboardService) GetAggregatedByIntervalAndOrg(interval *models.IntervalKey, orgId *string, by *uint8, pageParams *utils.PageParams, resolveUsers bool) (models.Leaderboard, error) {
 	// check cache
 	cacheKey := srv.getHash(interval, by, "", pageParams)
+	if orgId != nil {
+		cacheKey += "__org__" + *orgId
+	}
 	if cacheResult, ok := srv.cache.Get(cacheKey); ok {
 		return cacheResult.([]*models.LeaderboardItemRanked), nil
 	}
 
-	items, err := srv.repository.GetAllAggregatedByInterval(interval, by, pageParams.Limit(), pageParams.Offset())
+	items, err := srv.repository.GetAllAggregatedByInterval(interval, by, orgId, pageParams.Limit(), pageParams.Offset())
 	if err != nil {
 		return nil, err
 	}
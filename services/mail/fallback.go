@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+)
+
+// FallbackSendingService sends mails via the first of its sending services (e.g. smtp servers) to succeed, trying them in order
+type FallbackSendingService struct {
+	services []SendingService
+}
+
+func NewFallbackSendingService(services ...SendingService) *FallbackSendingService {
+	return &FallbackSendingService{services: services}
+}
+
+func (f *FallbackSendingService) Send(mail *models.Mail) error {
+	errs := make([]error, 0, len(f.services))
+	for i, s := range f.services {
+		err := s.Send(mail)
+		if err == nil {
+			if i > 0 {
+				slog.Info("sent mail via fallback server", "server", fmt.Sprint(s), "attempt", i+1)
+			}
+			return nil
+		}
+		conf.Log().Warn("failed to send mail, trying next server if any", "server", fmt.Sprint(s), "error", err)
+		errs = append(errs, fmt.Errorf("%v: %w", s, err))
+	}
+	return errors.Join(errs...)
+}
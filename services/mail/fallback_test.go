@@ -0,0 +1,145 @@
+package mail
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/muety/wakapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// in-process smtp server, which records all mails it receives
+type fakeSmtpBackend struct {
+	mu       sync.Mutex
+	received []string
+}
+
+type fakeSmtpSession struct {
+	backend *fakeSmtpBackend
+}
+
+func (b *fakeSmtpBackend) NewSession(_ *smtp.Conn) (smtp.Session, error) {
+	return &fakeSmtpSession{backend: b}, nil
+}
+
+func (b *fakeSmtpBackend) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.received)
+}
+
+func (s *fakeSmtpSession) AuthMechanisms() []string {
+	return []string{sasl.Plain}
+}
+
+func (s *fakeSmtpSession) Auth(_ string) (sasl.Server, error) {
+	return sasl.NewPlainServer(func(identity, username, password string) error {
+		return nil
+	}), nil
+}
+
+func (s *fakeSmtpSession) Mail(_ string, _ *smtp.MailOptions) error { return nil }
+func (s *fakeSmtpSession) Rcpt(_ string, _ *smtp.RcptOptions) error { return nil }
+func (s *fakeSmtpSession) Reset()                                   {}
+func (s *fakeSmtpSession) Logout() error                            { return nil }
+
+func (s *fakeSmtpSession) Data(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	s.backend.received = append(s.backend.received, string(data))
+	return nil
+}
+
+func startFakeSmtpServer(t *testing.T) (*fakeSmtpBackend, uint) {
+	backend := &fakeSmtpBackend{}
+	server := smtp.NewServer(backend)
+	server.AllowInsecureAuth = true
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+
+	return backend, uint(l.Addr().(*net.TCPAddr).Port)
+}
+
+// returns the port of a server, which accepts connections, but never responds
+func startDeadSmtpServer(t *testing.T) uint {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+
+	return uint(l.Addr().(*net.TCPAddr).Port)
+}
+
+// returns a port that nothing listens on
+func unusedPort(t *testing.T) uint {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	return uint(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestFallbackSendingService_Send(t *testing.T) {
+	backend, port := startFakeSmtpServer(t)
+
+	cfg := config.SMTPMailConfig{
+		Host:       "127.0.0.1",
+		Port:       unusedPort(t),
+		Username:   TestSmtpUser,
+		Password:   TestSmtpPass,
+		TimeoutSec: 1,
+		Fallbacks: []config.SMTPFallbackConfig{
+			{Host: "127.0.0.1", Port: startDeadSmtpServer(t), Username: TestSmtpUser, Password: TestSmtpPass},
+			{Host: "127.0.0.1", Port: port, Username: TestSmtpUser, Password: TestSmtpPass},
+		},
+	}
+
+	t.Run("when primary server is down", func(t *testing.T) {
+		t0 := time.Now()
+		err := newSmtpSendingService(cfg).Send(createTestMail())
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, backend.count())
+		assert.Contains(t, backend.received[0], "This is just a test")
+		assert.Less(t, time.Since(t0), 5*time.Second) // dead server timed out
+	})
+
+	t.Run("when all servers are down", func(t *testing.T) {
+		cfgDown := cfg
+		cfgDown.Fallbacks = cfg.Fallbacks[:1]
+
+		err := newSmtpSendingService(cfgDown).Send(createTestMail())
+
+		assert.Error(t, err)
+		assert.Equal(t, 1, backend.count())
+	})
+
+	t.Run("when only the primary server is configured", func(t *testing.T) {
+		cfgSingle := config.SMTPMailConfig{Host: "127.0.0.1", Port: port, Username: TestSmtpUser, Password: TestSmtpPass, TimeoutSec: 1}
+
+		sut := newSmtpSendingService(cfgSingle)
+
+		assert.IsType(t, &SMTPSendingService{}, sut)
+		assert.Nil(t, sut.Send(createTestMail()))
+		assert.Equal(t, 2, backend.count())
+	})
+}
@@ -2,13 +2,13 @@ package mail
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/muety/wakapi/helpers"
 	"github.com/muety/wakapi/models"
-	"github.com/muety/wakapi/routes"
+	"github.com/muety/wakapi/repositories"
 	"github.com/muety/wakapi/services"
 	"github.com/muety/wakapi/utils"
-	"github.com/muety/wakapi/views/mail"
 	"time"
 
 	conf "github.com/muety/wakapi/config"
@@ -20,13 +20,29 @@ const (
 	tplNameWakatimeFailureNotification = "wakatime_connection_failure"
 	tplNameReport                      = "report"
 	tplNameSubscriptionNotification    = "subscription_expiring"
+	tplNameSubscriptionReminder        = "subscription_reminder"
+	tplNameInactivityReminder          = "inactivity_reminder"
+	tplNameHeartbeatQuota              = "heartbeat_quota"
+	tplNameExportNotification          = "export_finished"
+	tplNameTestMail                    = "test_mail"
 	subjectPasswordReset               = "Wakapi - Password Reset"
 	subjectImportNotification          = "Wakapi - Data Import Finished"
+	subjectImportPreview               = "Wakapi - Data Import Preview"
 	subjectWakatimeFailureNotification = "Wakapi - WakaTime Connection Failure"
 	subjectReport                      = "Wakapi - Report from %s"
 	subjectSubscriptionNotification    = "Wakapi - Subscription expiring / expired"
+	subjectSubscriptionRenewal         = "Wakapi - Subscription renewing soon"
+	subjectSubscriptionEnding          = "Wakapi - Subscription ending soon"
+	subjectInactivityReminder          = "Wakapi - Still coding?"
+	subjectHeartbeatQuota              = "Wakapi - Storage quota reached"
+	subjectExportNotification          = "Wakapi - Data Export Ready"
+	subjectTestMail                    = "Wakapi - Test Mail"
 )
 
+const importDiffMaxItems = 5 // per entity type in import notifications
+
+var ErrUnknownTemplate = errors.New("unknown mail template")
+
 type SendingService interface {
 	Send(*models.Mail) error
 }
@@ -34,10 +50,12 @@ type SendingService interface {
 type MailService struct {
 	config         *conf.Config
 	sendingService SendingService
+	directService  SendingService       // bypasses the queue, e.g. for test mails, whose errors are to be reported immediately
+	queue          *QueueSendingService // nil if disabled
 	templates      utils.TemplateMap
 }
 
-func NewMailService() services.IMailService {
+func NewMailService(queuedMailRepository repositories.IQueuedMailRepository) services.IMailService {
 	config := conf.Get()
 
 	var sendingService SendingService
@@ -45,18 +63,58 @@ func NewMailService() services.IMailService {
 
 	if config.Mail.Enabled {
 		if config.Mail.Provider == conf.MailProviderSmtp {
-			sendingService = NewSMTPSendingService(config.Mail.Smtp)
+			sendingService = newSmtpSendingService(config.Mail.Smtp)
 		}
 	}
 
-	// Use local file system when in 'dev' environment, go embed file system otherwise
-	templateFs := conf.ChooseFS("views/mail", mail.TemplateFiles)
-	templates, err := utils.LoadTemplates(templateFs, routes.DefaultTemplateFuncs())
+	templates, err := loadTemplates(config.Mail.TemplatesDir)
 	if err != nil {
 		panic(err)
 	}
 
-	return &MailService{sendingService: sendingService, config: config, templates: templates}
+	srv := &MailService{sendingService: sendingService, directService: sendingService, config: config, templates: templates}
+	if config.Mail.QueueEnabled() {
+		srv.queue = NewQueueSendingService(sendingService, queuedMailRepository)
+		srv.sendingService = srv.queue
+	}
+	return srv
+}
+
+// Schedule starts retrying queued mails, if retries are enabled
+func (m *MailService) Schedule() {
+	if m.queue != nil {
+		m.queue.Schedule()
+	}
+}
+
+// FlushQueue makes a final attempt to send all pending mails, e.g. before shutting down
+func (m *MailService) FlushQueue() error {
+	if m.queue == nil {
+		return nil
+	}
+	return m.queue.Flush()
+}
+
+// GetQueued returns the latest queued mails of the given status (see models.QueuedMail), or none if retries are disabled
+func (m *MailService) GetQueued(status string) ([]*models.QueuedMail, error) {
+	if m.queue == nil {
+		return []*models.QueuedMail{}, nil
+	}
+	return m.queue.GetByStatus(status)
+}
+
+// newSmtpSendingService sends mails via the primary smtp server, falling back to the other ones, if configured
+func newSmtpSendingService(config conf.SMTPMailConfig) SendingService {
+	if len(config.Fallbacks) == 0 {
+		return NewSMTPSendingService(config)
+	}
+
+	servers := config.GetServers()
+	senders := make([]SendingService, len(servers))
+	for i, server := range servers {
+		senders[i] = NewSMTPSendingService(server)
+	}
+	return NewFallbackSendingService(senders...)
 }
 
 func (m *MailService) SendPasswordReset(recipient *models.User, resetLink string) error {
@@ -75,7 +133,7 @@ func (m *MailService) SendPasswordReset(recipient *models.User, resetLink string
 
 func (m *MailService) SendWakatimeFailureNotification(recipient *models.User, numFailures int) error {
 	tpl, err := m.getWakatimeFailureNotificationTemplate(WakatimeFailureNotificationNotificationTplData{
-		PublicUrl:   m.config.Server.PublicUrl,
+		PublicUrl:   m.config.Server.GetBaseUrl(),
 		NumFailures: numFailures,
 	})
 	if err != nil {
@@ -90,12 +148,19 @@ func (m *MailService) SendWakatimeFailureNotification(recipient *models.User, nu
 	return m.sendingService.Send(mail)
 }
 
-func (m *MailService) SendImportNotification(recipient *models.User, duration time.Duration, numHeartbeats int) error {
-	tpl, err := m.getImportNotificationTemplate(ImportNotificationTplData{
-		PublicUrl:     m.config.Server.PublicUrl,
+func (m *MailService) SendImportNotification(recipient *models.User, duration time.Duration, numHeartbeats int, diff *models.ImportDiff) error {
+	data := ImportNotificationTplData{
+		PublicUrl:     m.config.Server.GetBaseUrl(),
 		Duration:      fmt.Sprintf("%.0f seconds", duration.Seconds()),
 		NumHeartbeats: numHeartbeats,
-	})
+	}
+	if diff != nil && diff.Finished {
+		data.AddedTime = helpers.FmtWakatimeDuration(time.Duration(diff.Added) * time.Second)
+		data.AddedProjects = importDiffTplItems(diff.Projects)
+		data.AddedLangs = importDiffTplItems(diff.Languages)
+	}
+
+	tpl, err := m.getImportNotificationTemplate(data)
 	if err != nil {
 		return err
 	}
@@ -108,6 +173,32 @@ func (m *MailService) SendImportNotification(recipient *models.User, duration ti
 	return m.sendingService.Send(mail)
 }
 
+func (m *MailService) SendImportPreview(recipient *models.User, preview *models.ImportPreview) error {
+	data := ImportNotificationTplData{
+		PublicUrl:     m.config.Server.GetBaseUrl(),
+		NumHeartbeats: preview.NumHeartbeats,
+		DryRun:        true,
+		NumDuplicates: preview.NumDuplicates,
+		NumDays:       preview.NumDays,
+	}
+	if preview.NumHeartbeats > 0 {
+		data.From = helpers.FormatDateHuman(preview.From.In(recipient.TZ()))
+		data.To = helpers.FormatDateHuman(preview.To.In(recipient.TZ()))
+	}
+
+	tpl, err := m.getImportNotificationTemplate(data)
+	if err != nil {
+		return err
+	}
+	mail := &models.Mail{
+		From:    models.MailAddress(m.config.Mail.Sender),
+		To:      models.MailAddresses([]models.MailAddress{models.MailAddress(recipient.Email)}),
+		Subject: subjectImportPreview,
+	}
+	mail.WithHTML(tpl.String())
+	return m.sendingService.Send(mail)
+}
+
 func (m *MailService) SendReport(recipient *models.User, report *models.Report) error {
 	tpl, err := m.getReportTemplate(ReportTplData{report})
 	if err != nil {
@@ -124,7 +215,7 @@ func (m *MailService) SendReport(recipient *models.User, report *models.Report)
 
 func (m *MailService) SendSubscriptionNotification(recipient *models.User, hasExpired bool) error {
 	tpl, err := m.getSubscriptionNotificationTemplate(SubscriptionNotificationTplData{
-		PublicUrl:           m.config.Server.PublicUrl,
+		PublicUrl:           m.config.Server.GetBaseUrl(),
 		DataRetentionMonths: m.config.App.DataRetentionMonths,
 		HasExpired:          hasExpired,
 	})
@@ -140,6 +231,111 @@ func (m *MailService) SendSubscriptionNotification(recipient *models.User, hasEx
 	return m.sendingService.Send(mail)
 }
 
+func (m *MailService) SendSubscriptionReminder(recipient *models.User, willRenew bool) error {
+	var periodEnd string
+	if recipient.SubscribedUntil != nil {
+		periodEnd = helpers.FormatDateHuman(recipient.SubscribedUntil.T().In(recipient.TZ()))
+	}
+
+	tpl, err := m.getSubscriptionReminderTemplate(SubscriptionReminderTplData{
+		PublicUrl: m.config.Server.GetBaseUrl(),
+		WillRenew: willRenew,
+		PeriodEnd: periodEnd,
+		Price:     m.config.Subscriptions.StandardPrice,
+	})
+	if err != nil {
+		return err
+	}
+	subject := subjectSubscriptionEnding
+	if willRenew {
+		subject = subjectSubscriptionRenewal
+	}
+	mail := &models.Mail{
+		From:    models.MailAddress(m.config.Mail.Sender),
+		To:      models.MailAddresses([]models.MailAddress{models.MailAddress(recipient.Email)}),
+		Subject: subject,
+	}
+	mail.WithHTML(tpl.String())
+	return m.sendingService.Send(mail)
+}
+
+func (m *MailService) SendInactivityReminder(recipient *models.User, inactiveDays int) error {
+	tpl, err := m.getInactivityReminderTemplate(InactivityReminderTplData{
+		PublicUrl:    m.config.Server.GetBaseUrl(),
+		InactiveDays: inactiveDays,
+	})
+	if err != nil {
+		return err
+	}
+	mail := &models.Mail{
+		From:    models.MailAddress(m.config.Mail.Sender),
+		To:      models.MailAddresses([]models.MailAddress{models.MailAddress(recipient.Email)}),
+		Subject: subjectInactivityReminder,
+	}
+	mail.WithHTML(tpl.String())
+	return m.sendingService.Send(mail)
+}
+
+func (m *MailService) SendHeartbeatQuotaNotification(recipient *models.User, quota int64) error {
+	tpl, err := m.getHeartbeatQuotaTemplate(HeartbeatQuotaTplData{
+		PublicUrl:     m.config.Server.GetBaseUrl(),
+		Quota:         quota,
+		Subscriptions: m.config.Subscriptions.Enabled && !recipient.HasActiveSubscription(),
+	})
+	if err != nil {
+		return err
+	}
+	mail := &models.Mail{
+		From:    models.MailAddress(m.config.Mail.Sender),
+		To:      models.MailAddresses([]models.MailAddress{models.MailAddress(recipient.Email)}),
+		Subject: subjectHeartbeatQuota,
+	}
+	mail.WithHTML(tpl.String())
+	return m.sendingService.Send(mail)
+}
+
+func (m *MailService) SendExportNotification(recipient *models.User, downloadLink string, expiresAt time.Time) error {
+	tpl, err := m.getExportNotificationTemplate(ExportNotificationTplData{
+		DownloadLink: downloadLink,
+		ExpiresAt:    helpers.FormatDateTimeHuman(expiresAt.In(recipient.TZ())),
+	})
+	if err != nil {
+		return err
+	}
+	mail := &models.Mail{
+		From:    models.MailAddress(m.config.Mail.Sender),
+		To:      models.MailAddresses([]models.MailAddress{models.MailAddress(recipient.Email)}),
+		Subject: subjectExportNotification,
+	}
+	mail.WithHTML(tpl.String())
+	return m.sendingService.Send(mail)
+}
+
+// SendTestMail sends the given template rendered with sample data, or a generic test mail if no template name is given
+func (m *MailService) SendTestMail(recipient *models.User, tplName string) error {
+	if tplName == "" {
+		tplName = tplNameTestMail
+	}
+
+	data, ok := sampleTemplateData()[tplName]
+	if !ok {
+		return ErrUnknownTemplate
+	}
+
+	var rendered bytes.Buffer
+	if err := m.templates[m.fmtName(tplName)].Execute(&rendered, data); err != nil {
+		return err
+	}
+
+	mail := &models.Mail{
+		From:    models.MailAddress(m.config.Mail.Sender),
+		To:      models.MailAddresses([]models.MailAddress{models.MailAddress(recipient.Email)}),
+		Subject: fmt.Sprintf("%s (%s)", subjectTestMail, tplName),
+	}
+	mail.WithHTML(rendered.String())
+	return m.directService.Send(mail)
+}
+
 func (m *MailService) getPasswordResetTemplate(data PasswordResetTplData) (*bytes.Buffer, error) {
 	var rendered bytes.Buffer
 	if err := m.templates[m.fmtName(tplNamePasswordReset)].Execute(&rendered, data); err != nil {
@@ -180,6 +376,53 @@ func (m *MailService) getSubscriptionNotificationTemplate(data SubscriptionNotif
 	return &rendered, nil
 }
 
+func (m *MailService) getSubscriptionReminderTemplate(data SubscriptionReminderTplData) (*bytes.Buffer, error) {
+	var rendered bytes.Buffer
+	if err := m.templates[m.fmtName(tplNameSubscriptionReminder)].Execute(&rendered, data); err != nil {
+		return nil, err
+	}
+	return &rendered, nil
+}
+
+func (m *MailService) getInactivityReminderTemplate(data InactivityReminderTplData) (*bytes.Buffer, error) {
+	var rendered bytes.Buffer
+	if err := m.templates[m.fmtName(tplNameInactivityReminder)].Execute(&rendered, data); err != nil {
+		return nil, err
+	}
+	return &rendered, nil
+}
+
+func (m *MailService) getHeartbeatQuotaTemplate(data HeartbeatQuotaTplData) (*bytes.Buffer, error) {
+	var rendered bytes.Buffer
+	if err := m.templates[m.fmtName(tplNameHeartbeatQuota)].Execute(&rendered, data); err != nil {
+		return nil, err
+	}
+	return &rendered, nil
+}
+
+func (m *MailService) getExportNotificationTemplate(data ExportNotificationTplData) (*bytes.Buffer, error) {
+	var rendered bytes.Buffer
+	if err := m.templates[m.fmtName(tplNameExportNotification)].Execute(&rendered, data); err != nil {
+		return nil, err
+	}
+	return &rendered, nil
+}
+
 func (m *MailService) fmtName(name string) string {
-	return fmt.Sprintf("%s.tpl.html", name)
+	return fmtTplName(name)
+}
+
+// importDiffTplItems picks the items with the most time added, ignoring those that lost time (e.g. due to changed aliases)
+func importDiffTplItems(items []*models.ImportDiffItem) []*ImportDiffItemTplData {
+	result := make([]*ImportDiffItemTplData, 0, importDiffMaxItems)
+	for _, item := range items {
+		if item.Added <= 0 || len(result) == importDiffMaxItems {
+			break
+		}
+		result = append(result, &ImportDiffItemTplData{
+			Key:   item.Key,
+			Added: helpers.FmtWakatimeDuration(time.Duration(item.Added) * time.Second),
+		})
+	}
+	return result
 }
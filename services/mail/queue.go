@@ -0,0 +1,141 @@
+package mail
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/repositories"
+)
+
+const (
+	mailQueueBaseBackoff   = 5 * time.Minute // doubled after every failed attempt, i.e. retries after 5, 10, 20, 40 and 80 minutes by default
+	mailQueueMaxBackoff    = 24 * time.Hour
+	mailQueuePollInterval  = 1 * time.Minute
+	mailQueuePollBatchSize = 50
+	mailQueueMaxAge        = 30 * 24 * time.Hour // after which sent and dead-lettered mails are deleted
+	mailQueueListLimit     = 100
+)
+
+// QueueSendingService persists every outbound mail before sending it via its delegate and retries sending with exponential backoff upon failure,
+// so that mails aren't lost on temporary outages of the mail server. Mails that failed for the configured maximum number of attempts are dead-lettered.
+type QueueSendingService struct {
+	config       *conf.Config
+	delegate     SendingService
+	repository   repositories.IQueuedMailRepository
+	inProgress   sync.Map
+	queueDefault *conf.JobQueue
+	queueWorkers *conf.JobQueue
+}
+
+func NewQueueSendingService(delegate SendingService, queuedMailRepository repositories.IQueuedMailRepository) *QueueSendingService {
+	return &QueueSendingService{
+		config:       conf.Get(),
+		delegate:     delegate,
+		repository:   queuedMailRepository,
+		queueDefault: conf.GetDefaultQueue(),
+		queueWorkers: conf.GetQueue(conf.QueueMails),
+	}
+}
+
+// Send makes a first attempt to send the mail right away, but only returns an error if the mail couldn't even be queued (and sending it directly failed as well)
+func (s *QueueSendingService) Send(mail *models.Mail) error {
+	queued, err := s.repository.Insert(models.NewQueuedMail(mail))
+	if err != nil {
+		conf.Log().Error("failed to queue mail, sending directly", "subject", mail.Subject, "error", err)
+		return s.delegate.Send(mail)
+	}
+	s.attempt(queued)
+	return nil
+}
+
+// Schedule periodically retries failed mails and cleans up old ones
+func (s *QueueSendingService) Schedule() {
+	slog.Info("scheduling outbound mail queue")
+
+	if _, err := s.queueDefault.DispatchEvery(func() {
+		if err := s.queueWorkers.Dispatch(s.sendDue); err != nil {
+			conf.Log().Error("failed to dispatch queued mails", "error", err)
+		}
+	}, mailQueuePollInterval); err != nil {
+		conf.Log().Error("failed to schedule queued mails", "error", err)
+	}
+	if _, err := s.queueDefault.DispatchEvery(func() {
+		if err := s.repository.DeleteFinishedBefore(time.Now().Add(-mailQueueMaxAge)); err != nil {
+			conf.Log().Error("failed to delete old queued mails", "error", err)
+		}
+	}, 24*time.Hour); err != nil {
+		conf.Log().Error("failed to schedule queued mail cleanup", "error", err)
+	}
+}
+
+// Flush makes another attempt to send all pending mails, regardless of their backoff, e.g. before shutting down. Mails failing again remain queued.
+func (s *QueueSendingService) Flush() error {
+	mails, err := s.repository.GetDue(time.Now().Add(mailQueueMaxBackoff), mailQueuePollBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, m := range mails {
+		s.attempt(m)
+	}
+	return nil
+}
+
+func (s *QueueSendingService) GetByStatus(status string) ([]*models.QueuedMail, error) {
+	return s.repository.GetByStatus(status, mailQueueListLimit)
+}
+
+func (s *QueueSendingService) sendDue() {
+	mails, err := s.repository.GetDue(time.Now(), mailQueuePollBatchSize)
+	if err != nil {
+		conf.Log().Error("failed to fetch due queued mails", "error", err)
+		return
+	}
+	for _, m := range mails {
+		s.attempt(m)
+	}
+}
+
+// attempt sends the mail once and records the outcome, scheduling another attempt with exponential backoff on failure
+func (s *QueueSendingService) attempt(mail *models.QueuedMail) {
+	if _, running := s.inProgress.LoadOrStore(mail.ID, true); running {
+		return
+	}
+	defer s.inProgress.Delete(mail.ID)
+
+	mail.Attempts++
+	mail.Error = ""
+
+	if err := s.delegate.Send(mail.Mail()); err != nil {
+		mail.Error = err.Error()
+		if mail.Attempts >= s.config.Mail.MaxAttempts {
+			mail.Status = models.QueuedMailDeadLetter
+			mail.NextAttemptAt = nil
+			conf.Log().Error("failed to send mail, giving up", "mailID", mail.ID, "subject", mail.Subject, "attempts", mail.Attempts, "error", err)
+		} else {
+			nextAttempt := models.CustomTime(time.Now().Add(mailQueueBackoff(mail.Attempts)))
+			mail.NextAttemptAt = &nextAttempt
+			slog.Warn("failed to send mail, retrying later", "mailID", mail.ID, "subject", mail.Subject, "attempt", mail.Attempts, "next_attempt", nextAttempt.T(), "error", err)
+		}
+	} else {
+		mail.Status = models.QueuedMailSent
+		mail.NextAttemptAt = nil
+	}
+
+	if mail.Status != models.QueuedMailPending {
+		mail.Body = "" // won't be sent again, but might contain sensitive data, e.g. password reset links
+	}
+
+	if err := s.repository.Update(mail); err != nil {
+		conf.Log().Error("failed to update queued mail", "mailID", mail.ID, "error", err)
+	}
+}
+
+func mailQueueBackoff(attempts int) time.Duration {
+	if attempts > 10 { // avoid overflows
+		return mailQueueMaxBackoff
+	}
+	return min(mailQueueBaseBackoff*time.Duration(1<<(attempts-1)), mailQueueMaxBackoff)
+}
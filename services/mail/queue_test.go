@@ -0,0 +1,175 @@
+package mail
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// sending service failing for the first n mails
+type flakySendingService struct {
+	mu       sync.Mutex
+	failures int
+	sent     int
+}
+
+func (f *flakySendingService) Send(_ *models.Mail) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("421 service not available")
+	}
+	f.sent++
+	return nil
+}
+
+// in-memory queued mail repository
+type fakeQueuedMailRepository struct {
+	mails     []*models.QueuedMail
+	insertErr error
+}
+
+func (r *fakeQueuedMailRepository) Insert(mail *models.QueuedMail) (*models.QueuedMail, error) {
+	if r.insertErr != nil {
+		return nil, r.insertErr
+	}
+	mail.ID = uint(len(r.mails) + 1)
+	r.mails = append(r.mails, mail)
+	return mail, nil
+}
+
+func (r *fakeQueuedMailRepository) Update(_ *models.QueuedMail) error { return nil }
+
+func (r *fakeQueuedMailRepository) GetByStatus(status string, _ int) ([]*models.QueuedMail, error) {
+	result := make([]*models.QueuedMail, 0)
+	for _, m := range r.mails {
+		if m.Status == status {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeQueuedMailRepository) GetDue(t time.Time, _ int) ([]*models.QueuedMail, error) {
+	result := make([]*models.QueuedMail, 0)
+	for _, m := range r.mails {
+		if m.Status == models.QueuedMailPending && !m.NextAttemptAt.T().After(t) {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeQueuedMailRepository) DeleteFinishedBefore(_ time.Time) error { return nil }
+
+func testQueuedMail() *models.Mail {
+	return (&models.Mail{
+		From:    "Wakapi <noreply@wakapi.dev>",
+		To:      models.MailAddresses{"john@example.org", "Jane <jane@example.org>"},
+		Subject: "Wakapi - Test",
+	}).WithHTML("<p>Hello</p>")
+}
+
+func TestQueueSendingService_Send(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Mail.MaxAttempts = 3
+	config.Set(cfg)
+
+	delegate := &flakySendingService{}
+	repo := &fakeQueuedMailRepository{}
+	sut := NewQueueSendingService(delegate, repo)
+
+	assert.Nil(t, sut.Send(testQueuedMail()))
+	assert.Equal(t, 1, delegate.sent)
+	assert.Len(t, repo.mails, 1)
+	assert.Equal(t, models.QueuedMailSent, repo.mails[0].Status)
+	assert.Equal(t, 1, repo.mails[0].Attempts)
+	assert.Nil(t, repo.mails[0].NextAttemptAt)
+	assert.Empty(t, repo.mails[0].Body)
+	assert.Equal(t, testQueuedMail().Subject, repo.mails[0].Mail().Subject)
+	assert.Equal(t, testQueuedMail().To, repo.mails[0].Mail().To)
+}
+
+func TestQueueSendingService_Send_Retry(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Mail.MaxAttempts = 3
+	config.Set(cfg)
+
+	delegate := &flakySendingService{failures: 1}
+	repo := &fakeQueuedMailRepository{}
+	sut := NewQueueSendingService(delegate, repo)
+
+	// temporary failure is not reported, but mail is queued instead
+	assert.Nil(t, sut.Send(testQueuedMail()))
+	assert.Equal(t, 0, delegate.sent)
+	assert.Equal(t, models.QueuedMailPending, repo.mails[0].Status)
+	assert.Equal(t, 1, repo.mails[0].Attempts)
+	assert.NotEmpty(t, repo.mails[0].Error)
+	assert.Equal(t, testQueuedMail(), repo.mails[0].Mail())
+	assert.WithinDuration(t, time.Now().Add(mailQueueBaseBackoff), repo.mails[0].NextAttemptAt.T(), time.Second)
+
+	// not due yet
+	sut.sendDue()
+	assert.Equal(t, 1, repo.mails[0].Attempts)
+
+	// flushing ignores backoff
+	assert.Nil(t, sut.Flush())
+	assert.Equal(t, 1, delegate.sent)
+	assert.Equal(t, models.QueuedMailSent, repo.mails[0].Status)
+	assert.Equal(t, 2, repo.mails[0].Attempts)
+	assert.Empty(t, repo.mails[0].Error)
+	assert.Empty(t, repo.mails[0].Body)
+}
+
+func TestQueueSendingService_Send_DeadLetter(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Mail.MaxAttempts = 3
+	config.Set(cfg)
+
+	delegate := &flakySendingService{failures: 10}
+	repo := &fakeQueuedMailRepository{}
+	sut := NewQueueSendingService(delegate, repo)
+
+	assert.Nil(t, sut.Send(testQueuedMail()))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, sut.Flush())
+	}
+
+	assert.Equal(t, 0, delegate.sent)
+	assert.Equal(t, models.QueuedMailDeadLetter, repo.mails[0].Status)
+	assert.Equal(t, 3, repo.mails[0].Attempts)
+	assert.Nil(t, repo.mails[0].NextAttemptAt)
+	assert.Empty(t, repo.mails[0].Body)
+
+	deadLetters, _ := sut.GetByStatus(models.QueuedMailDeadLetter)
+	assert.Len(t, deadLetters, 1)
+}
+
+func TestQueueSendingService_Send_QueueUnavailable(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Mail.MaxAttempts = 3
+	config.Set(cfg)
+
+	delegate := &flakySendingService{failures: 1}
+	repo := &fakeQueuedMailRepository{insertErr: errors.New("database is locked")}
+	sut := NewQueueSendingService(delegate, repo)
+
+	// falls back to sending directly
+	assert.Error(t, sut.Send(testQueuedMail()))
+	assert.Nil(t, sut.Send(testQueuedMail()))
+	assert.Equal(t, 1, delegate.sent)
+}
+
+func Test_mailQueueBackoff(t *testing.T) {
+	assert.Equal(t, 5*time.Minute, mailQueueBackoff(1))
+	assert.Equal(t, 10*time.Minute, mailQueueBackoff(2))
+	assert.Equal(t, 80*time.Minute, mailQueueBackoff(5))
+	assert.Equal(t, mailQueueMaxBackoff, mailQueueBackoff(10))
+	assert.Equal(t, mailQueueMaxBackoff, mailQueueBackoff(100))
+}
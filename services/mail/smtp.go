@@ -8,6 +8,9 @@ import (
 	conf "github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/models"
 	"io"
+	"log/slog"
+	"net"
+	"time"
 )
 
 type SMTPSendingService struct {
@@ -29,24 +32,22 @@ func NewSMTPSendingService(config conf.SMTPMailConfig) *SMTPSendingService {
 func (s *SMTPSendingService) Send(mail *models.Mail) error {
 	mail = mail.Sanitized()
 
-	dial := smtp.Dial
-	if s.config.TLS {
-		dial = func(addr string) (*smtp.Client, error) {
-			return smtp.DialTLS(addr, &tls.Config{InsecureSkipVerify: s.config.SkipVerify})
-		}
-	}
-
-	c, err := dial(s.config.ConnStr())
+	c, err := s.dial(false)
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
+	// greet explicitly to fail on unresponsive servers, as extension checks would just report them as not supporting anything
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+
 	// if server offers starttls, automatically switch to starttls instead
 	// for backwards-compatibility, we switch to starttls even if forced tls was requested
 	// TODO: actually use forced tls if requested
 	if ok, _ := c.Extension("STARTTLS"); ok {
-		cNew, err := smtp.DialStartTLS(s.config.ConnStr(), &tls.Config{InsecureSkipVerify: s.config.SkipVerify})
+		cNew, err := s.dial(true)
 
 		if err != nil {
 			if errSmtp, ok := err.(*smtp.SMTPError); ok {
@@ -104,5 +105,52 @@ func (s *SMTPSendingService) Send(mail *models.Mail) error {
 		return err
 	}
 
-	return c.Quit()
+	// mail was accepted at this point, so don't report an error (and have it sent again via a fallback server) only because the connection wasn't closed properly
+	if err := c.Quit(); err != nil {
+		slog.Warn("failed to close smtp connection after sending mail", "server", s.String(), "error", err)
+	}
+	return nil
+}
+
+func (s *SMTPSendingService) String() string {
+	return s.config.ConnStr()
+}
+
+// dial connects to the smtp server, giving up after the configured timeout, which also applies to every subsequent command
+func (s *SMTPSendingService) dial(startTls bool) (*smtp.Client, error) {
+	dialer := &net.Dialer{Timeout: s.config.GetTimeout()}
+	tlsConfig := &tls.Config{ServerName: s.config.Host, InsecureSkipVerify: s.config.SkipVerify}
+
+	var conn net.Conn
+	var err error
+	if s.config.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.config.ConnStr(), tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.config.ConnStr())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := s.config.GetTimeout()
+
+	var c *smtp.Client
+	if startTls {
+		// handshake happens before command timeouts can be set on the client
+		if timeout > 0 {
+			conn.SetDeadline(time.Now().Add(timeout))
+		}
+		if c, err = smtp.NewClientStartTLS(conn, tlsConfig); err != nil {
+			return nil, err
+		}
+		conn.SetDeadline(time.Time{})
+	} else {
+		c = smtp.NewClient(conn)
+	}
+
+	if timeout > 0 {
+		c.CommandTimeout = timeout
+		c.SubmissionTimeout = timeout
+	}
+	return c, nil
 }
@@ -0,0 +1,120 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/duke-git/lancet/v2/slice"
+	conf "github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/routes"
+	"github.com/muety/wakapi/utils"
+	"github.com/muety/wakapi/views/mail"
+)
+
+// overlayFs serves files from the override directory, falling back to the built-in templates for files not present there
+type overlayFs struct {
+	override fs.FS
+	base     fs.FS
+}
+
+func (o *overlayFs) Open(name string) (fs.File, error) {
+	if f, err := o.override.Open(name); err == nil {
+		return f, nil
+	}
+	return o.base.Open(name)
+}
+
+func (o *overlayFs) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(o.base, name)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := fs.ReadDir(o.override, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range overrides {
+		if !slice.ContainBy(entries, func(b fs.DirEntry) bool { return b.Name() == e.Name() }) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func loadTemplates(overrideDir string) (utils.TemplateMap, error) {
+	// Use local file system when in 'dev' environment, go embed file system otherwise
+	templateFs := conf.ChooseFS("views/mail", mail.TemplateFiles)
+
+	if overrideDir != "" {
+		if info, err := os.Stat(overrideDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("mail templates directory '%s' does not exist", overrideDir)
+		}
+		templateFs = &overlayFs{override: os.DirFS(overrideDir), base: templateFs}
+	}
+
+	templates, err := utils.LoadTemplates(templateFs, routes.DefaultTemplateFuncs())
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTemplates(templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// validateTemplates renders every template with sample data, so that broken overrides are detected at startup instead of when sending
+func validateTemplates(templates utils.TemplateMap) error {
+	for name, data := range sampleTemplateData() {
+		tpl, ok := templates[fmtTplName(name)]
+		if !ok {
+			return fmt.Errorf("mail template '%s' not found", name)
+		}
+		if err := tpl.Execute(&bytes.Buffer{}, data); err != nil {
+			return fmt.Errorf("failed to render mail template '%s': %v", name, err)
+		}
+	}
+	return nil
+}
+
+func sampleTemplateData() map[string]interface{} {
+	cfg := conf.Get()
+	now := time.Now()
+
+	sampleSummary := &models.Summary{
+		FromTime:  models.CustomTime(now.AddDate(0, 0, -1)),
+		ToTime:    models.CustomTime(now),
+		Projects:  models.SummaryItems{{Type: models.SummaryProject, Key: "wakapi", Total: 5400}},
+		Languages: models.SummaryItems{{Type: models.SummaryLanguage, Key: "Go", Total: 5400}},
+		Editors:   models.SummaryItems{{Type: models.SummaryEditor, Key: "vscode", Total: 5400}},
+	}
+
+	return map[string]interface{}{
+		tplNamePasswordReset:               PasswordResetTplData{ResetLink: fmt.Sprintf("%s/set-password?token=sample", cfg.Server.GetBaseUrl())},
+		tplNameImportNotification:          ImportNotificationTplData{PublicUrl: cfg.Server.GetBaseUrl(), Duration: "42 seconds", NumHeartbeats: 1337, AddedTime: "12 hrs 34 mins", AddedProjects: []*ImportDiffItemTplData{{Key: "wakapi", Added: "12 hrs 34 mins"}}, AddedLangs: []*ImportDiffItemTplData{{Key: "Go", Added: "12 hrs 34 mins"}}},
+		tplNameWakatimeFailureNotification: WakatimeFailureNotificationNotificationTplData{PublicUrl: cfg.Server.GetBaseUrl(), NumFailures: 10},
+		tplNameReport: ReportTplData{Report: &models.Report{
+			From:           now.AddDate(0, 0, -7),
+			To:             now,
+			User:           &models.User{ID: "sample"},
+			Summary:        sampleSummary,
+			DailySummaries: []*models.Summary{sampleSummary},
+			ActiveDays:     1,
+		}},
+		tplNameSubscriptionNotification: SubscriptionNotificationTplData{PublicUrl: cfg.Server.GetBaseUrl(), DataRetentionMonths: cfg.App.DataRetentionMonths, HasExpired: true},
+		tplNameSubscriptionReminder:     SubscriptionReminderTplData{PublicUrl: cfg.Server.GetBaseUrl(), WillRenew: true, PeriodEnd: now.AddDate(0, 0, 3).Format(time.RFC822), Price: cfg.Subscriptions.StandardPrice},
+		tplNameInactivityReminder:       InactivityReminderTplData{PublicUrl: cfg.Server.GetBaseUrl(), InactiveDays: 14},
+		tplNameHeartbeatQuota:           HeartbeatQuotaTplData{PublicUrl: cfg.Server.GetBaseUrl(), Quota: 1000000, Subscriptions: true},
+		tplNameExportNotification:       ExportNotificationTplData{DownloadLink: fmt.Sprintf("%s/api/exports/sample", cfg.Server.GetBaseUrl()), ExpiresAt: now.Format(time.RFC822)},
+		tplNameTestMail:                 TestMailTplData{PublicUrl: cfg.Server.GetBaseUrl(), SentAt: now.Format(time.RFC822)},
+	}
+}
+
+func fmtTplName(name string) string {
+	return fmt.Sprintf("%s.tpl.html", name)
+}
@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTemplates_Builtin(t *testing.T) {
+	config.Set(config.Empty())
+
+	templates, err := loadTemplates("")
+	assert.Nil(t, err)
+	assert.Contains(t, templates, fmtTplName(tplNamePasswordReset))
+	assert.Contains(t, templates, fmtTplName(tplNameTestMail))
+}
+
+func TestLoadTemplates_Override(t *testing.T) {
+	config.Set(config.Empty())
+
+	dir := t.TempDir()
+	custom := `{{ template "head.tpl.html" . }}<p>Acme Corp: reset your password at {{ .ResetLink }}</p>`
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, fmtTplName(tplNamePasswordReset)), []byte(custom), 0644))
+
+	templates, err := loadTemplates(dir)
+	assert.Nil(t, err)
+
+	var rendered bytes.Buffer
+	assert.Nil(t, templates[fmtTplName(tplNamePasswordReset)].Execute(&rendered, PasswordResetTplData{ResetLink: "https://example.org/reset"}))
+	assert.Contains(t, rendered.String(), "Acme Corp: reset your password at https://example.org/reset")
+
+	// not overridden, falls back to built-in template
+	rendered.Reset()
+	assert.Nil(t, templates[fmtTplName(tplNameTestMail)].Execute(&rendered, TestMailTplData{PublicUrl: "https://example.org"}))
+	assert.Contains(t, rendered.String(), "your mail settings are working")
+}
+
+func TestLoadTemplates_InvalidOverride(t *testing.T) {
+	config.Set(config.Empty())
+
+	dir := t.TempDir()
+
+	// syntax error
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, fmtTplName(tplNamePasswordReset)), []byte(`{{ if .ResetLink }}`), 0644))
+	_, err := loadTemplates(dir)
+	assert.Error(t, err)
+
+	// refers to unknown field
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, fmtTplName(tplNamePasswordReset)), []byte(`{{ .Foo }}`), 0644))
+	_, err = loadTemplates(dir)
+	assert.ErrorContains(t, err, tplNamePasswordReset)
+
+	_, err = loadTemplates(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -10,6 +10,19 @@ type ImportNotificationTplData struct {
 	PublicUrl     string
 	Duration      string
 	NumHeartbeats int
+	DryRun        bool
+	NumDuplicates int
+	NumDays       int
+	From          string
+	To            string
+	AddedTime     string                   // total coding time added by the import, if it could be determined
+	AddedProjects []*ImportDiffItemTplData // projects with the most coding time added
+	AddedLangs    []*ImportDiffItemTplData // languages with the most coding time added
+}
+
+type ImportDiffItemTplData struct {
+	Key   string
+	Added string
 }
 
 type WakatimeFailureNotificationNotificationTplData struct {
@@ -26,3 +39,31 @@ type SubscriptionNotificationTplData struct {
 	HasExpired          bool
 	DataRetentionMonths int
 }
+
+type SubscriptionReminderTplData struct {
+	PublicUrl string
+	WillRenew bool // false if the user chose to cancel at the end of the current period
+	PeriodEnd string
+	Price     string
+}
+
+type InactivityReminderTplData struct {
+	PublicUrl    string
+	InactiveDays int
+}
+
+type HeartbeatQuotaTplData struct {
+	PublicUrl     string
+	Quota         int64
+	Subscriptions bool // whether subscribing would raise the quota
+}
+
+type ExportNotificationTplData struct {
+	DownloadLink string
+	ExpiresAt    string
+}
+
+type TestMailTplData struct {
+	PublicUrl string
+	SentAt    string
+}
@@ -3,7 +3,6 @@ package services
 import (
 	"fmt"
 	"github.com/duke-git/lancet/v2/slice"
-	"github.com/muety/artifex/v2"
 	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/utils"
 	"go.uber.org/atomic"
@@ -20,6 +19,8 @@ const (
 	countUsersEvery                  = 3 * time.Hour
 	computeOldestDataEvery           = 6 * time.Hour
 	notifyExpiringSubscriptionsEvery = 12 * time.Hour
+	remindSubscriptionRenewalsEvery  = 12 * time.Hour
+	remindInactiveUsersEvery         = 12 * time.Hour
 )
 
 const (
@@ -36,9 +37,9 @@ type MiscService struct {
 	summaryService   ISummaryService
 	keyValueService  IKeyValueService
 	mailService      IMailService
-	queueDefault     *artifex.Dispatcher
-	queueWorkers     *artifex.Dispatcher
-	queueMails       *artifex.Dispatcher
+	queueDefault     *config.JobQueue
+	queueWorkers     *config.JobQueue
+	queueMails       *config.JobQueue
 }
 
 func NewMiscService(userService IUserService, heartbeatService IHeartbeatService, summaryService ISummaryService, keyValueService IKeyValueService, mailService IMailService) *MiscService {
@@ -73,6 +74,20 @@ func (srv *MiscService) Schedule() {
 		}
 	}
 
+	if srv.config.Subscriptions.Enabled && srv.config.Subscriptions.RenewalReminderDays > 0 {
+		slog.Info("scheduling subscription renewal reminders")
+		if _, err := srv.queueDefault.DispatchEvery(srv.RemindSubscriptionRenewals, remindSubscriptionRenewalsEvery); err != nil {
+			config.Log().Error("failed to schedule subscription renewal reminder jobs", "error", err)
+		}
+	}
+
+	if srv.config.App.InactivityReminderDays > 0 {
+		slog.Info("scheduling inactivity reminders")
+		if _, err := srv.queueDefault.DispatchEvery(srv.RemindInactiveUsers, remindInactiveUsersEvery); err != nil {
+			config.Log().Error("failed to schedule inactivity reminder jobs", "error", err)
+		}
+	}
+
 	// run once initially for a fresh instance
 	if !srv.existsUsersTotalTime() {
 		if err := srv.queueDefault.Dispatch(srv.CountTotalTime); err != nil {
@@ -238,6 +253,115 @@ func (srv *MiscService) NotifyExpiringSubscription() {
 	}
 }
 
+// RemindSubscriptionRenewals sends an e-mail to all users whose current subscription period ends within the configured number of days,
+// telling them either that their subscription is about to renew or, if they chose to cancel it, that it's about to end.
+// Only one reminder is sent per billing period.
+func (srv *MiscService) RemindSubscriptionRenewals() {
+	if !srv.config.Subscriptions.Enabled || srv.config.Subscriptions.RenewalReminderDays <= 0 {
+		return
+	}
+
+	now := time.Now()
+	window := time.Duration(srv.config.Subscriptions.RenewalReminderDays) * 24 * time.Hour
+	slog.Info("reminding users about upcoming subscription renewals")
+
+	users, err := srv.userService.GetAll()
+	if err != nil {
+		config.Log().Error("failed to fetch users for subscription renewal reminders", "error", err)
+		return
+	}
+
+	lastReminders := make(map[string]string)
+	if result, err := srv.keyValueService.GetByPrefix(config.KeySubscriptionRenewalReminder); err == nil {
+		for _, kv := range result {
+			lastReminders[strings.Replace(kv.Key, config.KeySubscriptionRenewalReminder+"_", "", 1)] = kv.Value
+		}
+	} else {
+		config.Log().Error("failed to fetch key-values for subscription renewal reminders", "error", err)
+		return
+	}
+
+	for _, u := range users {
+		if !subscriptionReminderDue(u, lastReminders[u.ID], now, window) {
+			continue
+		}
+		// users who chose to cancel will already be notified about their expiring subscription and the consequences for their data
+		willRenew := u.SubscriptionRenewal != nil
+		if !willRenew && srv.config.Subscriptions.ExpiryNotifications && srv.config.App.DataRetentionMonths > 0 {
+			continue
+		}
+		srv.sendSubscriptionReminderScheduled(u, willRenew)
+	}
+}
+
+// subscriptionReminderDue checks whether the user's current subscription period ends within the given window and no reminder has been sent for it, yet
+func subscriptionReminderDue(user *models.User, lastReminder string, now time.Time, window time.Duration) bool {
+	if user.Email == "" || user.SubscribedUntil == nil {
+		return false
+	}
+	periodEnd := user.SubscribedUntil.T()
+	if !periodEnd.After(now) || periodEnd.Sub(now) > window {
+		return false
+	}
+	return lastReminder != periodEnd.Format(time.RFC822Z)
+}
+
+// RemindInactiveUsers sends an e-mail to all users who opted in to it and haven't sent any heartbeats for the configured number of days,
+// at most once within the configured cooldown period
+func (srv *MiscService) RemindInactiveUsers() {
+	if srv.config.App.InactivityReminderDays <= 0 {
+		return
+	}
+
+	now := time.Now()
+	threshold := time.Duration(srv.config.App.InactivityReminderDays) * 24 * time.Hour
+	cooldown := time.Duration(srv.config.App.InactivityCooldownDays) * 24 * time.Hour
+	slog.Info("reminding inactive users")
+
+	users, _, err := srv.userService.Query(&models.UserQuery{}, nil)
+	if err != nil {
+		config.Log().Error("failed to fetch users for inactivity reminders", "error", err)
+		return
+	}
+
+	lastReminders := make(map[string]string)
+	if result, err := srv.keyValueService.GetByPrefix(config.KeyInactivityReminderSent); err == nil {
+		for _, kv := range result {
+			lastReminders[strings.Replace(kv.Key, config.KeyInactivityReminderSent+"_", "", 1)] = kv.Value
+		}
+	} else {
+		config.Log().Error("failed to fetch key-values for inactivity reminders", "error", err)
+		return
+	}
+
+	for _, u := range users {
+		if !inactivityReminderDue(&u.User, u.LastActiveAt, lastReminders[u.ID], now, threshold, cooldown) {
+			continue
+		}
+		srv.sendInactivityReminderScheduled(&u.User, int(now.Sub(u.LastActiveAt.T()).Hours()/24))
+	}
+}
+
+// inactivityReminderDue checks whether the user opted in to inactivity reminders, has been inactive for at least the given threshold and wasn't reminded within the given cooldown period
+// users who never sent any heartbeats as well as users who requested their account to be deleted are not reminded
+func inactivityReminderDue(user *models.User, lastActive *models.CustomTime, lastReminder string, now time.Time, threshold, cooldown time.Duration) bool {
+	if user.Email == "" || !user.InactivityReminders || user.IsSoftDeleted() || lastActive == nil {
+		return false
+	}
+	if now.Sub(lastActive.T()) < threshold {
+		return false
+	}
+	if lastReminder == "" {
+		return true
+	}
+	sendDate, err := time.Parse(time.RFC822Z, lastReminder)
+	if err != nil {
+		config.Log().Error("failed to parse date for last sent inactivity reminder mail", "userID", user.ID, "error", err)
+		return false
+	}
+	return now.Sub(sendDate) >= cooldown
+}
+
 func (srv *MiscService) countUserTotalTime(userId string) time.Duration {
 	result, err := srv.summaryService.Aliased(time.Time{}, time.Now(), &models.User{ID: userId}, srv.summaryService.Retrieve, nil, false)
 	if err != nil {
@@ -267,6 +391,46 @@ func (srv *MiscService) sendSubscriptionNotificationScheduled(user *models.User,
 	})
 }
 
+func (srv *MiscService) sendSubscriptionReminderScheduled(user *models.User, willRenew bool) {
+	u := *user
+	srv.queueMails.Dispatch(func() {
+		slog.Info("sending subscription renewal reminder mail", "userID", u.ID, "willRenew", willRenew)
+		defer time.Sleep(10 * time.Second)
+
+		if err := srv.mailService.SendSubscriptionReminder(&u, willRenew); err != nil {
+			config.Log().Error("failed to send subscription renewal reminder mail to user", "userID", u.ID, "error", err)
+			return
+		}
+
+		if err := srv.keyValueService.PutString(&models.KeyStringValue{
+			Key:   fmt.Sprintf("%s_%s", config.KeySubscriptionRenewalReminder, u.ID),
+			Value: u.SubscribedUntil.T().Format(time.RFC822Z),
+		}); err != nil {
+			config.Log().Error("failed to update subscription renewal reminder key-value for user", "userID", u.ID, "error", err)
+		}
+	})
+}
+
+func (srv *MiscService) sendInactivityReminderScheduled(user *models.User, inactiveDays int) {
+	u := *user
+	srv.queueMails.Dispatch(func() {
+		slog.Info("sending inactivity reminder mail", "userID", u.ID, "inactiveDays", inactiveDays)
+		defer time.Sleep(10 * time.Second)
+
+		if err := srv.mailService.SendInactivityReminder(&u, inactiveDays); err != nil {
+			config.Log().Error("failed to send inactivity reminder mail to user", "userID", u.ID, "error", err)
+			return
+		}
+
+		if err := srv.keyValueService.PutString(&models.KeyStringValue{
+			Key:   fmt.Sprintf("%s_%s", config.KeyInactivityReminderSent, u.ID),
+			Value: time.Now().Format(time.RFC822Z),
+		}); err != nil {
+			config.Log().Error("failed to update inactivity reminder key-value for user", "userID", u.ID, "error", err)
+		}
+	})
+}
+
 func (srv *MiscService) existsUsersTotalTime() bool {
 	results, err := srv.keyValueService.GetByPrefix(config.KeyLatestTotalTime)
 	if err != nil {
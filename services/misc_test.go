@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_subscriptionReminderDue(t *testing.T) {
+	now := time.Now()
+	window := 3 * 24 * time.Hour
+	soon := models.CustomTime(now.Add(2 * 24 * time.Hour))
+	later := models.CustomTime(now.Add(5 * 24 * time.Hour))
+	past := models.CustomTime(now.Add(-time.Hour))
+
+	assert.True(t, subscriptionReminderDue(&models.User{Email: "foo@example.org", SubscribedUntil: &soon}, "", now, window))
+	assert.True(t, subscriptionReminderDue(&models.User{Email: "foo@example.org", SubscribedUntil: &soon}, later.T().Format(time.RFC822Z), now, window))
+	assert.False(t, subscriptionReminderDue(&models.User{Email: "foo@example.org", SubscribedUntil: &soon}, soon.T().Format(time.RFC822Z), now, window))
+	assert.False(t, subscriptionReminderDue(&models.User{Email: "foo@example.org", SubscribedUntil: &later}, "", now, window))
+	assert.False(t, subscriptionReminderDue(&models.User{Email: "foo@example.org", SubscribedUntil: &past}, "", now, window))
+	assert.False(t, subscriptionReminderDue(&models.User{Email: "foo@example.org"}, "", now, window))
+	assert.False(t, subscriptionReminderDue(&models.User{SubscribedUntil: &soon}, "", now, window))
+}
+
+func Test_inactivityReminderDue(t *testing.T) {
+	now := time.Now()
+	threshold := 14 * 24 * time.Hour
+	cooldown := 30 * 24 * time.Hour
+	recent := models.CustomTime(now.Add(-2 * 24 * time.Hour))
+	lapsed := models.CustomTime(now.Add(-20 * 24 * time.Hour))
+	deletedAt := models.CustomTime(now)
+
+	optedIn := &models.User{Email: "foo@example.org", InactivityReminders: true}
+
+	assert.True(t, inactivityReminderDue(optedIn, &lapsed, "", now, threshold, cooldown))
+	assert.True(t, inactivityReminderDue(optedIn, &lapsed, now.Add(-40*24*time.Hour).Format(time.RFC822Z), now, threshold, cooldown))
+	assert.False(t, inactivityReminderDue(optedIn, &lapsed, now.Add(-10*24*time.Hour).Format(time.RFC822Z), now, threshold, cooldown))
+	assert.False(t, inactivityReminderDue(optedIn, &recent, "", now, threshold, cooldown))
+	assert.False(t, inactivityReminderDue(optedIn, nil, "", now, threshold, cooldown))
+	assert.False(t, inactivityReminderDue(&models.User{Email: "foo@example.org"}, &lapsed, "", now, threshold, cooldown))
+	assert.False(t, inactivityReminderDue(&models.User{InactivityReminders: true}, &lapsed, "", now, threshold, cooldown))
+	assert.False(t, inactivityReminderDue(&models.User{Email: "foo@example.org", InactivityReminders: true, SoftDeletedAt: &deletedAt}, &lapsed, "", now, threshold, cooldown))
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/repositories"
+)
+
+var (
+	ErrOrgNotFound  = errors.New("org not found")
+	ErrInvalidOrg   = errors.New("invalid org, id must be a lowercase slug of 2 to 64 characters and name must not be empty")
+	ErrOrgExists    = errors.New("org already exists")
+	ErrNotOrgMember = errors.New("user is not a member of this org")
+	ErrOtherOrg     = errors.New("user already belongs to another org")
+)
+
+type OrgService struct {
+	config       *config.Config
+	repository   repositories.IOrgRepository
+	userSrvc     IUserService
+	summarySrvc  ISummaryService
+	keyValueSrvc IKeyValueService
+}
+
+func NewOrgService(orgRepository repositories.IOrgRepository, userService IUserService, summaryService ISummaryService, keyValueService IKeyValueService) *OrgService {
+	return &OrgService{
+		config:       config.Get(),
+		repository:   orgRepository,
+		userSrvc:     userService,
+		summarySrvc:  summaryService,
+		keyValueSrvc: keyValueService,
+	}
+}
+
+func (srv *OrgService) GetAll() ([]*models.Org, error) {
+	return srv.repository.GetAll()
+}
+
+func (srv *OrgService) GetById(id string) (*models.Org, error) {
+	org, err := srv.repository.GetById(id)
+	if err != nil {
+		return nil, ErrOrgNotFound
+	}
+	return org, nil
+}
+
+func (srv *OrgService) Create(org *models.Org) (*models.Org, error) {
+	if !org.IsValid() {
+		return nil, ErrInvalidOrg
+	}
+	if _, err := srv.repository.GetById(org.ID); err == nil {
+		return nil, ErrOrgExists
+	}
+	return srv.repository.Insert(org)
+}
+
+func (srv *OrgService) GetMembers(org *models.Org) ([]*models.User, error) {
+	return srv.userSrvc.GetByOrg(org.ID)
+}
+
+// AddMember makes the user a member of the org or, if already a member, updates their role. Users can't be moved from one org to another directly, but have to be removed first.
+func (srv *OrgService) AddMember(org *models.Org, user *models.User, admin bool) (*models.User, error) {
+	if user.OrgID != nil && !user.BelongsTo(org.ID) {
+		return nil, ErrOtherOrg
+	}
+	user.OrgID = &org.ID
+	user.OrgAdmin = admin
+	return srv.userSrvc.UpdateOrgMembership(user)
+}
+
+func (srv *OrgService) RemoveMember(org *models.Org, user *models.User) (*models.User, error) {
+	if !user.BelongsTo(org.ID) {
+		return nil, ErrNotOrgMember
+	}
+	user.OrgID = nil
+	user.OrgAdmin = false
+	return srv.userSrvc.UpdateOrgMembership(user)
+}
+
+// GenerateInvite creates a single-use invite code (see security.invite_codes), which makes the invited user join the org upon signup
+func (srv *OrgService) GenerateInvite(org *models.Org, inviter *models.User) (string, error) {
+	inviteCode := uuid.Must(uuid.NewV4()).String()[0:8]
+	if err := srv.keyValueSrvc.PutString(&models.KeyStringValue{
+		Key:   fmt.Sprintf("%s_%s", config.KeyInviteCode, inviteCode),
+		Value: fmt.Sprintf("%s,%s,%s", inviter.ID, time.Now().Format(time.RFC3339), org.ID),
+	}); err != nil {
+		return "", err
+	}
+	return inviteCode, nil
+}
+
+// GetReport sums up every member's coding time within the given interval, resolved in each member's time zone
+func (srv *OrgService) GetReport(org *models.Org, interval *models.IntervalKey) ([]*models.OrgReportItem, error) {
+	members, err := srv.GetMembers(org)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*models.OrgReportItem, 0, len(members))
+	for _, member := range members {
+		err, from, to := helpers.ResolveIntervalTZ(interval, member.TZ())
+		if err != nil {
+			return nil, err
+		}
+		summary, err := srv.summarySrvc.Aliased(from, to, member, srv.summarySrvc.Retrieve, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &models.OrgReportItem{
+			UserID: member.ID,
+			Total:  int64(summary.TotalTime().Seconds()),
+		})
+	}
+	return items, nil
+}
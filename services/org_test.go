@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type OrgServiceTestSuite struct {
+	suite.Suite
+	TestOrg         *models.Org
+	OrgRepository   *mocks.OrgRepositoryMock
+	UserService     *mocks.UserServiceMock
+	SummaryService  *mocks.SummaryServiceMock
+	KeyValueService *mocks.KeyValueServiceMock
+}
+
+func (suite *OrgServiceTestSuite) BeforeTest(suiteName, testName string) {
+	cfg := config.Empty()
+	cfg.App.OrgsEnabled = true
+	config.Set(cfg)
+	suite.TestOrg = &models.Org{ID: "acme", Name: "ACME Corp."}
+	suite.OrgRepository = new(mocks.OrgRepositoryMock)
+	suite.UserService = new(mocks.UserServiceMock)
+	suite.SummaryService = new(mocks.SummaryServiceMock)
+	suite.KeyValueService = new(mocks.KeyValueServiceMock)
+}
+
+func TestOrgServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(OrgServiceTestSuite))
+}
+
+func (suite *OrgServiceTestSuite) TestOrgService_Create() {
+	sut := NewOrgService(suite.OrgRepository, suite.UserService, suite.SummaryService, suite.KeyValueService)
+
+	suite.OrgRepository.On("GetById", "acme").Return(suite.TestOrg, nil)
+	suite.OrgRepository.On("GetById", "initech").Return((*models.Org)(nil), errors.New("record not found"))
+	suite.OrgRepository.On("Insert", mock.Anything).Return(&models.Org{ID: "initech", Name: "Initech"}, nil)
+
+	_, err := sut.Create(&models.Org{ID: "acme", Name: "ACME Corp."})
+	assert.ErrorIs(suite.T(), err, ErrOrgExists)
+
+	_, err = sut.Create(&models.Org{ID: "Not A Slug", Name: "Invalid"})
+	assert.ErrorIs(suite.T(), err, ErrInvalidOrg)
+
+	org, err := sut.Create(&models.Org{ID: "initech", Name: "Initech"})
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), "initech", org.ID)
+	suite.OrgRepository.AssertNumberOfCalls(suite.T(), "Insert", 1)
+}
+
+func (suite *OrgServiceTestSuite) TestOrgService_AddMember() {
+	sut := NewOrgService(suite.OrgRepository, suite.UserService, suite.SummaryService, suite.KeyValueService)
+
+	otherOrg := "initech"
+	newUser := &models.User{ID: "new_user"}
+	otherUser := &models.User{ID: "other_user", OrgID: &otherOrg}
+
+	suite.UserService.On("UpdateOrgMembership", mock.Anything).Return(newUser, nil)
+
+	user, err := sut.AddMember(suite.TestOrg, newUser, true)
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), user.BelongsTo(suite.TestOrg.ID))
+	assert.True(suite.T(), user.OrgAdmin)
+
+	// demote existing member
+	user, err = sut.AddMember(suite.TestOrg, newUser, false)
+	assert.Nil(suite.T(), err)
+	assert.False(suite.T(), user.OrgAdmin)
+
+	_, err = sut.AddMember(suite.TestOrg, otherUser, false)
+	assert.ErrorIs(suite.T(), err, ErrOtherOrg)
+	assert.True(suite.T(), otherUser.BelongsTo(otherOrg))
+	suite.UserService.AssertNumberOfCalls(suite.T(), "UpdateOrgMembership", 2)
+}
+
+func (suite *OrgServiceTestSuite) TestOrgService_RemoveMember() {
+	sut := NewOrgService(suite.OrgRepository, suite.UserService, suite.SummaryService, suite.KeyValueService)
+
+	member := &models.User{ID: "member", OrgID: &suite.TestOrg.ID, OrgAdmin: true}
+	noMember := &models.User{ID: "no_member"}
+
+	suite.UserService.On("UpdateOrgMembership", mock.Anything).Return(member, nil)
+
+	_, err := sut.RemoveMember(suite.TestOrg, noMember)
+	assert.ErrorIs(suite.T(), err, ErrNotOrgMember)
+
+	user, err := sut.RemoveMember(suite.TestOrg, member)
+	assert.Nil(suite.T(), err)
+	assert.Nil(suite.T(), user.OrgID)
+	assert.False(suite.T(), user.OrgAdmin)
+}
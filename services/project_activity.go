@@ -0,0 +1,147 @@
+package services
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/leandro-lugaresi/hub"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+)
+
+const (
+	projectActivityPollInterval = 1 * time.Minute
+	// a project is considered stopped after this long without heartbeats for it, which debounces short breaks and switching between projects.
+	// at least models.MaxHeartbeatsTimeout, so that a stop is never announced in the middle of what's a single coding session in terms of durations.
+	projectActivityIdleTimeout = 5 * time.Minute
+)
+
+type projectActivity struct {
+	userId   string
+	project  string
+	start    time.Time
+	lastSeen time.Time
+}
+
+// ProjectActivityService announces users starting and stopping to work on projects, which they opted in for activity notifications (see models.ProjectMetadata), to their webhooks.
+// Coding sessions are tracked in memory while heartbeats are ingested. Only recent heartbeats are considered, i.e. imports or clients syncing their backlog don't cause any notifications.
+type ProjectActivityService struct {
+	config              *config.Config
+	eventBus            *hub.Hub
+	userSrvc            IUserService
+	projectMetadataSrvc IProjectMetadataService
+	webhookSrvc         IWebhookService
+	active              map[string]*projectActivity // by user id and project
+	lock                sync.Mutex
+	queueDefault        *config.JobQueue
+}
+
+func NewProjectActivityService(userService IUserService, projectMetadataService IProjectMetadataService, webhookService IWebhookService) *ProjectActivityService {
+	srv := &ProjectActivityService{
+		config:              config.Get(),
+		eventBus:            config.EventBus(),
+		userSrvc:            userService,
+		projectMetadataSrvc: projectMetadataService,
+		webhookSrvc:         webhookService,
+		active:              map[string]*projectActivity{},
+		queueDefault:        config.GetDefaultQueue(),
+	}
+
+	sub := srv.eventBus.Subscribe(0, config.EventHeartbeatCreate)
+	go func(sub *hub.Subscription) {
+		for m := range sub.Receiver {
+			if !srv.config.App.WebhooksEnabled {
+				continue
+			}
+			srv.Process(m.Fields[config.FieldPayload].(*models.Heartbeat))
+		}
+	}(&sub)
+
+	return srv
+}
+
+// Schedule periodically announces projects that were stopped being worked on
+func (srv *ProjectActivityService) Schedule() {
+	if !srv.config.App.WebhooksEnabled {
+		return
+	}
+
+	slog.Info("scheduling project activity notifications")
+
+	if _, err := srv.queueDefault.DispatchEvery(srv.StopIdle, projectActivityPollInterval); err != nil {
+		config.Log().Error("failed to schedule project activity notifications", "error", err)
+	}
+}
+
+// Process keeps track of the coding session the heartbeat belongs to and announces it, if it's a new one
+func (srv *ProjectActivityService) Process(heartbeat *models.Heartbeat) {
+	t := heartbeat.Time.T()
+	if heartbeat.Project == "" || time.Since(t) > projectActivityIdleTimeout {
+		return
+	}
+
+	metadata, err := srv.projectMetadataSrvc.GetMapped(heartbeat.UserID)
+	if err != nil {
+		config.Log().Error("failed to get project metadata for activity notifications", "userID", heartbeat.UserID, "error", err)
+		return
+	}
+	if m, ok := metadata[heartbeat.Project]; !ok || !m.NotifyActivity {
+		return
+	}
+
+	key := heartbeat.UserID + "/" + heartbeat.Project
+
+	srv.lock.Lock()
+	if activity, ok := srv.active[key]; ok {
+		if t.After(activity.lastSeen) {
+			activity.lastSeen = t
+		}
+		srv.lock.Unlock()
+		return
+	}
+	activity := &projectActivity{userId: heartbeat.UserID, project: heartbeat.Project, start: t, lastSeen: t}
+	srv.active[key] = activity
+	srv.lock.Unlock()
+
+	srv.notify(activity, models.WebhookEventProjectStarted)
+}
+
+// StopIdle announces all coding sessions without any heartbeats for a while as stopped
+func (srv *ProjectActivityService) StopIdle() {
+	srv.lock.Lock()
+	stopped := make([]*projectActivity, 0)
+	for key, activity := range srv.active {
+		if time.Since(activity.lastSeen) > projectActivityIdleTimeout {
+			stopped = append(stopped, activity)
+			delete(srv.active, key)
+		}
+	}
+	srv.lock.Unlock()
+
+	for _, activity := range stopped {
+		srv.notify(activity, models.WebhookEventProjectStopped)
+	}
+}
+
+func (srv *ProjectActivityService) notify(activity *projectActivity, event string) {
+	user, err := srv.userSrvc.GetUserById(activity.userId)
+	if err != nil {
+		config.Log().Warn("failed to get user for project activity notification", "userID", activity.userId, "error", err)
+		return
+	}
+
+	data := &models.ProjectActivity{
+		Project:   activity.project,
+		StartedAt: models.CustomTime(activity.start),
+	}
+	if event == models.WebhookEventProjectStopped {
+		stoppedAt := models.CustomTime(activity.lastSeen)
+		data.StoppedAt = &stoppedAt
+		data.Duration = int64(activity.lastSeen.Sub(activity.start).Seconds())
+	}
+
+	if err := srv.webhookSrvc.Dispatch(user, event, data); err != nil {
+		config.Log().Error("failed to dispatch webhooks", "userID", user.ID, "event", event, "error", err)
+	}
+}
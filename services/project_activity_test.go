@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProjectActivityService_Process(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "john"}
+	now := time.Now()
+
+	userServiceMock := new(mocks.UserServiceMock)
+	userServiceMock.On("GetUserById", user.ID).Return(user, nil)
+
+	projectMetadataServiceMock := new(mocks.ProjectMetadataServiceMock)
+	projectMetadataServiceMock.On("GetMapped", user.ID).Return(map[string]*models.ProjectMetadata{
+		"wakapi": {Project: "wakapi", NotifyActivity: true},
+		"anchr":  {Project: "anchr", Color: "#00b4d8"},
+	}, nil)
+
+	webhookServiceMock := new(mocks.WebhookServiceMock)
+	webhookServiceMock.On("Dispatch", user, mock.Anything, mock.Anything).Return(nil)
+
+	sut := NewProjectActivityService(userServiceMock, projectMetadataServiceMock, webhookServiceMock)
+
+	sut.Process(&models.Heartbeat{UserID: user.ID, Project: "wakapi", Time: models.CustomTime(now.Add(-2 * time.Minute))})
+	sut.Process(&models.Heartbeat{UserID: user.ID, Project: "wakapi", Time: models.CustomTime(now.Add(-1 * time.Minute))})
+	sut.Process(&models.Heartbeat{UserID: user.ID, Project: "anchr", Time: models.CustomTime(now)})                         // not opted in
+	sut.Process(&models.Heartbeat{UserID: user.ID, Project: "wakapi", Time: models.CustomTime(now.Add(-10 * time.Minute))}) // not recent
+
+	webhookServiceMock.AssertNumberOfCalls(t, "Dispatch", 1)
+	webhookServiceMock.AssertCalled(t, "Dispatch", user, models.WebhookEventProjectStarted, &models.ProjectActivity{
+		Project:   "wakapi",
+		StartedAt: models.CustomTime(now.Add(-2 * time.Minute)),
+	})
+
+	// still active
+	sut.StopIdle()
+	webhookServiceMock.AssertNumberOfCalls(t, "Dispatch", 1)
+
+	sut.active["john/wakapi"].start = now.Add(-20 * time.Minute)
+	sut.active["john/wakapi"].lastSeen = now.Add(-6 * time.Minute)
+	sut.StopIdle()
+
+	stoppedAt := models.CustomTime(now.Add(-6 * time.Minute))
+	webhookServiceMock.AssertNumberOfCalls(t, "Dispatch", 2)
+	webhookServiceMock.AssertCalled(t, "Dispatch", user, models.WebhookEventProjectStopped, &models.ProjectActivity{
+		Project:   "wakapi",
+		StartedAt: models.CustomTime(now.Add(-20 * time.Minute)),
+		StoppedAt: &stoppedAt,
+		Duration:  840,
+	})
+	assert.Empty(t, sut.active)
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/repositories"
+	"github.com/muety/wakapi/utils"
+	"github.com/patrickmn/go-cache"
+)
+
+type ProjectArchiveService struct {
+	config        *config.Config
+	cache         *cache.Cache
+	repository    repositories.IArchivedProjectRepository
+	userSrvc      IUserService
+	heartbeatSrvc IHeartbeatService
+	queueDefault  *config.JobQueue
+	queueWorkers  *config.JobQueue
+}
+
+func NewProjectArchiveService(archivedProjectRepository repositories.IArchivedProjectRepository, userService IUserService, heartbeatService IHeartbeatService) *ProjectArchiveService {
+	return &ProjectArchiveService{
+		config:        config.Get(),
+		cache:         cache.New(1*time.Hour, 1*time.Hour),
+		repository:    archivedProjectRepository,
+		userSrvc:      userService,
+		heartbeatSrvc: heartbeatService,
+		queueDefault:  config.GetDefaultQueue(),
+		queueWorkers:  config.GetQueue(config.QueueHousekeeping),
+	}
+}
+
+func (srv *ProjectArchiveService) Schedule() {
+	slog.Info("scheduling project auto-archiving")
+
+	if _, err := srv.queueDefault.DispatchEvery(srv.runAutoArchive, 24*time.Hour); err != nil {
+		config.Log().Error("failed to dispatch project auto-archiving jobs", "error", err)
+	}
+}
+
+// GetArchived returns the set of the user's currently archived projects
+func (srv *ProjectArchiveService) GetArchived(userId string) (map[string]bool, error) {
+	if archived, found := srv.cache.Get(userId); found {
+		return archived.(map[string]bool), nil
+	}
+
+	states, err := srv.repository.GetByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	archived := make(map[string]bool, len(states))
+	for _, s := range states {
+		if s.Archived {
+			archived[s.Project] = true
+		}
+	}
+
+	srv.cache.SetDefault(userId, archived)
+	return archived, nil
+}
+
+func (srv *ProjectArchiveService) Archive(user *models.User, project string) error {
+	return srv.setArchived(user, project, true, false)
+}
+
+func (srv *ProjectArchiveService) Unarchive(user *models.User, project string) error {
+	return srv.setArchived(user, project, false, false)
+}
+
+// FilterProjectStats drops the user's archived projects from the given list
+func (srv *ProjectArchiveService) FilterProjectStats(user *models.User, stats []*models.ProjectStats) ([]*models.ProjectStats, error) {
+	archived, err := srv.GetArchived(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]*models.ProjectStats, 0, len(stats))
+	for _, p := range stats {
+		if !archived[p.Project] {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered, nil
+}
+
+// AutoArchive archives all of the user's projects that haven't received any heartbeats for as many days as configured by the user.
+// Projects unarchived manually are left alone, unless there has been new activity after they were unarchived.
+func (srv *ProjectArchiveService) AutoArchive(user *models.User) (int, error) {
+	if user.AutoArchiveDays <= 0 {
+		return 0, nil
+	}
+
+	stats, err := srv.heartbeatSrvc.GetUserProjectStats(user, time.Time{}, utils.BeginOfToday(time.Local), nil, false)
+	if err != nil {
+		return 0, err
+	}
+
+	states, err := srv.repository.GetByUser(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	statesByProject := make(map[string]*models.ArchivedProject, len(states))
+	for _, s := range states {
+		statesByProject[s.Project] = s
+	}
+
+	var count int
+	cutoff := time.Now().AddDate(0, 0, -user.AutoArchiveDays)
+	for _, p := range stats {
+		if !p.Last.T().Before(cutoff) {
+			continue
+		}
+		if state, ok := statesByProject[p.Project]; ok && (state.Archived || state.UpdatedAt.T().After(p.Last.T())) {
+			continue
+		}
+		if err := srv.setArchived(user, p.Project, true, true); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func (srv *ProjectArchiveService) setArchived(user *models.User, project string, archived, automatic bool) error {
+	if _, err := srv.repository.Upsert(&models.ArchivedProject{
+		UserID:    user.ID,
+		Project:   project,
+		Archived:  archived,
+		Automatic: automatic,
+		UpdatedAt: models.CustomTime(time.Now()),
+	}); err != nil {
+		return err
+	}
+	srv.cache.Delete(user.ID)
+	return nil
+}
+
+func (srv *ProjectArchiveService) runAutoArchive() {
+	users, err := srv.userSrvc.GetAll()
+	if err != nil {
+		config.Log().Error("failed to get users for project auto-archiving", "error", err)
+		return
+	}
+
+	for _, u := range users {
+		if u.AutoArchiveDays <= 0 {
+			continue
+		}
+
+		user := *u
+		srv.queueWorkers.Dispatch(func() {
+			if n, err := srv.AutoArchive(&user); err != nil {
+				config.Log().Error("failed to auto-archive projects", "userID", user.ID, "error", err)
+			} else if n > 0 {
+				slog.Info("auto-archived inactive projects", "userID", user.ID, "count", n)
+			}
+		})
+	}
+}
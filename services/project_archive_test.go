@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProjectArchiveServiceTestSuite struct {
+	suite.Suite
+	TestUser                  *models.User
+	ArchivedProjectRepository *mocks.ArchivedProjectRepositoryMock
+	HeartbeatService          *mocks.HeartbeatServiceMock
+}
+
+func (suite *ProjectArchiveServiceTestSuite) BeforeTest(suiteName, testName string) {
+	config.Set(config.Empty())
+	suite.TestUser = &models.User{ID: "testuser01", AutoArchiveDays: 30}
+	suite.ArchivedProjectRepository = new(mocks.ArchivedProjectRepositoryMock)
+	suite.HeartbeatService = new(mocks.HeartbeatServiceMock)
+}
+
+func TestProjectArchiveServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ProjectArchiveServiceTestSuite))
+}
+
+func (suite *ProjectArchiveServiceTestSuite) TestProjectArchiveService_AutoArchive() {
+	sut := NewProjectArchiveService(suite.ArchivedProjectRepository, nil, suite.HeartbeatService)
+
+	now := time.Now()
+	stats := []*models.ProjectStats{
+		{Project: "active", Last: models.CustomTime(now.AddDate(0, 0, -1))},
+		{Project: "inactive", Last: models.CustomTime(now.AddDate(0, 0, -60))},
+		{Project: "already_archived", Last: models.CustomTime(now.AddDate(0, 0, -60))},
+		{Project: "unarchived_manually", Last: models.CustomTime(now.AddDate(0, 0, -60))},
+		{Project: "unarchived_then_inactive", Last: models.CustomTime(now.AddDate(0, 0, -40))},
+	}
+	states := []*models.ArchivedProject{
+		{UserID: suite.TestUser.ID, Project: "already_archived", Archived: true},
+		{UserID: suite.TestUser.ID, Project: "unarchived_manually", Archived: false, UpdatedAt: models.CustomTime(now.AddDate(0, 0, -10))},
+		{UserID: suite.TestUser.ID, Project: "unarchived_then_inactive", Archived: false, UpdatedAt: models.CustomTime(now.AddDate(0, 0, -50))},
+	}
+
+	suite.HeartbeatService.On("GetUserProjectStats", suite.TestUser, time.Time{}, mock.Anything, mock.Anything, false).Return(stats, nil)
+	suite.ArchivedProjectRepository.On("GetByUser", suite.TestUser.ID).Return(states, nil)
+	suite.ArchivedProjectRepository.On("Upsert", mock.Anything).Return(&models.ArchivedProject{}, nil)
+
+	n, err := sut.AutoArchive(suite.TestUser)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), 2, n)
+
+	suite.ArchivedProjectRepository.AssertCalled(suite.T(), "Upsert", mock.MatchedBy(func(p *models.ArchivedProject) bool {
+		return p.Project == "inactive" && p.Archived && p.Automatic
+	}))
+	suite.ArchivedProjectRepository.AssertCalled(suite.T(), "Upsert", mock.MatchedBy(func(p *models.ArchivedProject) bool {
+		return p.Project == "unarchived_then_inactive" && p.Archived && p.Automatic
+	}))
+}
+
+func (suite *ProjectArchiveServiceTestSuite) TestProjectArchiveService_AutoArchive_Disabled() {
+	sut := NewProjectArchiveService(suite.ArchivedProjectRepository, nil, suite.HeartbeatService)
+
+	suite.TestUser.AutoArchiveDays = 0
+	n, err := sut.AutoArchive(suite.TestUser)
+	assert.Nil(suite.T(), err)
+	assert.Zero(suite.T(), n)
+	suite.HeartbeatService.AssertNotCalled(suite.T(), "GetUserProjectStats", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *ProjectArchiveServiceTestSuite) TestProjectArchiveService_FilterProjectStats() {
+	sut := NewProjectArchiveService(suite.ArchivedProjectRepository, nil, suite.HeartbeatService)
+
+	suite.ArchivedProjectRepository.On("GetByUser", suite.TestUser.ID).Return([]*models.ArchivedProject{
+		{UserID: suite.TestUser.ID, Project: "archived", Archived: true},
+		{UserID: suite.TestUser.ID, Project: "unarchived", Archived: false},
+	}, nil)
+
+	filtered, err := sut.FilterProjectStats(suite.TestUser, []*models.ProjectStats{{Project: "archived"}, {Project: "unarchived"}, {Project: "other"}})
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), filtered, 2)
+	assert.Equal(suite.T(), "unarchived", filtered[0].Project)
+	assert.Equal(suite.T(), "other", filtered[1].Project)
+}
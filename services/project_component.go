@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/duke-git/lancet/v2/slice"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/repositories"
+	"github.com/patrickmn/go-cache"
+)
+
+type ProjectComponentService struct {
+	config     *config.Config
+	cache      *cache.Cache
+	repository repositories.IProjectComponentRuleRepository
+}
+
+func NewProjectComponentService(projectComponentRuleRepository repositories.IProjectComponentRuleRepository) *ProjectComponentService {
+	return &ProjectComponentService{
+		config:     config.Get(),
+		cache:      cache.New(1*time.Hour, 1*time.Hour),
+		repository: projectComponentRuleRepository,
+	}
+}
+
+func (srv *ProjectComponentService) GetByUser(userId string) ([]*models.ProjectComponentRule, error) {
+	if rules, found := srv.cache.Get(userId); found {
+		return rules.([]*models.ProjectComponentRule), nil
+	}
+
+	rules, err := srv.repository.GetByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	srv.cache.SetDefault(userId, rules)
+	return rules, nil
+}
+
+func (srv *ProjectComponentService) GetByUserAndProject(userId, project string) ([]*models.ProjectComponentRule, error) {
+	rules, err := srv.GetByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Filter[*models.ProjectComponentRule](rules, func(i int, r *models.ProjectComponentRule) bool {
+		return r.Project == project
+	}), nil
+}
+
+func (srv *ProjectComponentService) Create(rule *models.ProjectComponentRule) (*models.ProjectComponentRule, error) {
+	existing, err := srv.GetByUser(rule.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= models.MaxProjectComponentRulesPerUser {
+		return nil, fmt.Errorf("must not define more than %d component rules", models.MaxProjectComponentRulesPerUser)
+	}
+
+	rule.PathPrefix = strings.TrimSpace(rule.PathPrefix)
+	rule.Label = strings.TrimSpace(rule.Label)
+	if !rule.IsValid() {
+		return nil, errors.New("invalid project, path prefix or label")
+	}
+
+	result, err := srv.repository.Insert(rule)
+	if err != nil {
+		return nil, err
+	}
+	srv.cache.Delete(rule.UserID)
+	return result, nil
+}
+
+func (srv *ProjectComponentService) Delete(user *models.User, id uint) error {
+	rule, err := srv.repository.GetById(id)
+	if err != nil || rule.UserID != user.ID {
+		return errors.New("component rule not found")
+	}
+	if err := srv.repository.Delete(rule.ID); err != nil {
+		return err
+	}
+	srv.cache.Delete(user.ID)
+	return nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/leandro-lugaresi/hub"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/repositories"
+	"github.com/patrickmn/go-cache"
+)
+
+type ProjectDefaultBranchService struct {
+	config     *config.Config
+	cache      *cache.Cache
+	eventBus   *hub.Hub
+	repository repositories.IProjectDefaultBranchRepository
+}
+
+func NewProjectDefaultBranchService(projectDefaultBranchRepository repositories.IProjectDefaultBranchRepository) *ProjectDefaultBranchService {
+	return &ProjectDefaultBranchService{
+		config:     config.Get(),
+		cache:      cache.New(1*time.Hour, 1*time.Hour),
+		eventBus:   config.EventBus(),
+		repository: projectDefaultBranchRepository,
+	}
+}
+
+func (srv *ProjectDefaultBranchService) GetByUser(userId string) ([]*models.ProjectDefaultBranch, error) {
+	return srv.repository.GetByUser(userId)
+}
+
+// GetMapped returns the user's default branches keyed by project
+func (srv *ProjectDefaultBranchService) GetMapped(userId string) (map[string]string, error) {
+	if mapped, found := srv.cache.Get(userId); found {
+		return mapped.(map[string]string), nil
+	}
+
+	branches, err := srv.repository.GetByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := make(map[string]string, len(branches))
+	for _, b := range branches {
+		mapped[b.Project] = b.Branch
+	}
+
+	srv.cache.SetDefault(userId, mapped)
+	return mapped, nil
+}
+
+func (srv *ProjectDefaultBranchService) Set(user *models.User, project, branch string) error {
+	defaultBranch := &models.ProjectDefaultBranch{
+		UserID:  user.ID,
+		Project: project,
+		Branch:  strings.TrimSpace(branch),
+	}
+	if _, err := srv.repository.Upsert(defaultBranch); err != nil {
+		return err
+	}
+	srv.notifyUpdate(defaultBranch, false)
+	return nil
+}
+
+func (srv *ProjectDefaultBranchService) Unset(user *models.User, project string) error {
+	if err := srv.repository.Delete(user.ID, project); err != nil {
+		return err
+	}
+	srv.notifyUpdate(&models.ProjectDefaultBranch{UserID: user.ID, Project: project}, true)
+	return nil
+}
+
+func (srv *ProjectDefaultBranchService) notifyUpdate(defaultBranch *models.ProjectDefaultBranch, isUnset bool) {
+	srv.cache.Delete(defaultBranch.UserID)
+
+	name := config.EventDefaultBranchSet
+	if isUnset {
+		name = config.EventDefaultBranchUnset
+	}
+	srv.eventBus.Publish(hub.Message{
+		Name:   name,
+		Fields: map[string]interface{}{config.FieldPayload: defaultBranch, config.FieldUserId: defaultBranch.UserID},
+	})
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+)
+
+const (
+	projectDuplicateMaxSuggestions   = 100
+	projectDuplicateMaxFuzzyProjects = 200 // fuzzy matching compares all projects pairwise, so users with more projects only get exact suggestions
+)
+
+type ProjectDuplicateService struct {
+	config        *config.Config
+	heartbeatSrvc IHeartbeatService
+	aliasSrvc     IAliasService
+}
+
+func NewProjectDuplicateService(heartbeatService IHeartbeatService, aliasService IAliasService) *ProjectDuplicateService {
+	return &ProjectDuplicateService{
+		config:        config.Get(),
+		heartbeatSrvc: heartbeatService,
+		aliasSrvc:     aliasService,
+	}
+}
+
+// GetSuggestions compares the user's project names and returns likely duplicates with a confidence of at least the given threshold, most confident first.
+// Projects already merged by an alias aren't suggested again. Nothing is merged automatically, but users may confirm suggestions by creating project aliases.
+func (srv *ProjectDuplicateService) GetSuggestions(user *models.User, threshold float64) ([]*models.ProjectDuplicate, error) {
+	projects, err := srv.heartbeatSrvc.GetEntitySetByUser(models.SummaryProject, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(projects)
+
+	resolved := make(map[string]string, len(projects))
+	for _, p := range projects {
+		if resolved[p], err = srv.aliasSrvc.GetAliasOrDefault(user.ID, models.SummaryProject, p); err != nil {
+			return nil, err
+		}
+	}
+
+	suggestions := make([]*models.ProjectDuplicate, 0)
+	for _, pair := range projectDuplicateCandidates(projects, len(projects) <= projectDuplicateMaxFuzzyProjects) {
+		if resolved[pair[0]] == resolved[pair[1]] {
+			continue
+		}
+		if d := models.NewProjectDuplicate(pair[0], pair[1]); d != nil && d.Confidence >= threshold {
+			suggestions = append(suggestions, d)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Confidence > suggestions[j].Confidence
+	})
+	if len(suggestions) > projectDuplicateMaxSuggestions {
+		suggestions = suggestions[:projectDuplicateMaxSuggestions]
+	}
+	return suggestions, nil
+}
+
+// projectDuplicateCandidates returns the pairs of (sorted) projects to compare, in order. These are all pairs if fuzzy, otherwise only those sharing a normalized name.
+func projectDuplicateCandidates(projects []string, fuzzy bool) [][2]string {
+	pairs := make([][2]string, 0)
+	if fuzzy {
+		for i := 0; i < len(projects); i++ {
+			for j := i + 1; j < len(projects); j++ {
+				pairs = append(pairs, [2]string{projects[i], projects[j]})
+			}
+		}
+		return pairs
+	}
+
+	buckets := make(map[string][]int)
+	for i, p := range projects {
+		for _, key := range models.ProjectDuplicateKeys(p) {
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	seen := make(map[[2]int]bool)
+	for _, bucket := range buckets {
+		for i := 0; i < len(bucket); i++ {
+			for j := i + 1; j < len(bucket); j++ {
+				seen[[2]int{bucket[i], bucket[j]}] = true
+			}
+		}
+	}
+
+	indices := make([][2]int, 0, len(seen))
+	for pair := range seen {
+		indices = append(indices, pair)
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return indices[i][0] < indices[j][0] || (indices[i][0] == indices[j][0] && indices[i][1] < indices[j][1])
+	})
+	for _, pair := range indices {
+		pairs = append(pairs, [2]string{projects[pair[0]], projects[pair[1]]})
+	}
+	return pairs
+}
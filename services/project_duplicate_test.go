@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectDuplicateService_GetSuggestions(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "john"}
+
+	heartbeatServiceMock := new(mocks.HeartbeatServiceMock)
+	heartbeatServiceMock.On("GetEntitySetByUser", models.SummaryProject, "john").Return([]string{"wakapi", "Wakapi", "wakapi-main", "anchr", "anchr-legacy", "anchr-old", "telepush"}, nil)
+
+	aliasServiceMock := new(mocks.AliasServiceMock)
+	aliasServiceMock.On("GetAliasOrDefault", "john", models.SummaryProject, "anchr-legacy").Return("anchr", nil)
+	for _, p := range []string{"wakapi", "Wakapi", "wakapi-main", "anchr", "anchr-old", "telepush"} {
+		aliasServiceMock.On("GetAliasOrDefault", "john", models.SummaryProject, p).Return(p, nil)
+	}
+
+	sut := NewProjectDuplicateService(heartbeatServiceMock, aliasServiceMock)
+
+	result, err := sut.GetSuggestions(user, 0.9)
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.ProjectDuplicate{
+		{Project: "Wakapi", Duplicate: "wakapi", Confidence: 1, Reason: models.ProjectDuplicateCase},
+		{Project: "Wakapi", Duplicate: "wakapi-main", Confidence: 0.9, Reason: models.ProjectDuplicateSuffix},
+		{Project: "wakapi", Duplicate: "wakapi-main", Confidence: 0.9, Reason: models.ProjectDuplicateSuffix},
+	}, result) // anchr-legacy already aliased to anchr
+
+	result, err = sut.GetSuggestions(user, 1)
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+}
+
+func Test_projectDuplicateCandidates(t *testing.T) {
+	projects := []string{"Wakapi", "anchr", "anchr-old", "wakapi", "wakapi-main", "wakapy"}
+
+	assert.Len(t, projectDuplicateCandidates(projects, true), 15)
+	assert.Equal(t, [][2]string{
+		{"Wakapi", "wakapi"},
+		{"Wakapi", "wakapi-main"},
+		{"wakapi", "wakapi-main"},
+	}, projectDuplicateCandidates(projects, false))
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/repositories"
+	"github.com/patrickmn/go-cache"
+)
+
+var ErrInvalidProjectMetadata = errors.New("invalid project metadata, color must be a hex code (e.g. '#00b4d8') and icon a short string or emoji")
+
+type ProjectMetadataService struct {
+	config       *config.Config
+	cache        *cache.Cache
+	aliasService IAliasService
+	repository   repositories.IProjectMetadataRepository
+}
+
+func NewProjectMetadataService(projectMetadataRepository repositories.IProjectMetadataRepository, aliasService IAliasService) *ProjectMetadataService {
+	return &ProjectMetadataService{
+		config:       config.Get(),
+		cache:        cache.New(1*time.Hour, 1*time.Hour),
+		aliasService: aliasService,
+		repository:   projectMetadataRepository,
+	}
+}
+
+func (srv *ProjectMetadataService) GetByUser(userId string) ([]*models.ProjectMetadata, error) {
+	return srv.repository.GetByUser(userId)
+}
+
+// GetMapped returns the user's project metadata keyed by project
+func (srv *ProjectMetadataService) GetMapped(userId string) (map[string]*models.ProjectMetadata, error) {
+	if mapped, found := srv.cache.Get(userId); found {
+		return mapped.(map[string]*models.ProjectMetadata), nil
+	}
+
+	metadata, err := srv.repository.GetByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := make(map[string]*models.ProjectMetadata, len(metadata))
+	for _, m := range metadata {
+		mapped[m.Project] = m
+	}
+
+	srv.cache.SetDefault(userId, mapped)
+	return mapped, nil
+}
+
+// Resolve returns the metadata of the given projects, as displayed (i.e. after aliases were applied).
+// Projects, which got renamed or merged into others by an alias, pass their metadata on, unless the alias target has metadata of its own.
+func (srv *ProjectMetadataService) Resolve(userId string, projects []string) (map[string]*models.ProjectMetadata, error) {
+	mapped, err := srv.GetMapped(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]*models.ProjectMetadata)
+	if len(mapped) == 0 {
+		return resolved, nil
+	}
+
+	for _, project := range projects {
+		if m, ok := mapped[project]; ok {
+			resolved[project] = m
+			continue
+		}
+
+		aliases, err := srv.aliasService.GetByUserAndKeyAndType(userId, project, models.SummaryProject)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range aliases {
+			if m, ok := mapped[a.Value]; ok {
+				resolved[project] = m
+				break
+			}
+		}
+	}
+
+	return resolved, nil
+}
+
+// GetPrivate returns those of the given (displayed) projects, which are marked private, resolving aliases the same way as Resolve
+func (srv *ProjectMetadataService) GetPrivate(userId string, projects []string) ([]string, error) {
+	resolved, err := srv.Resolve(userId, projects)
+	if err != nil {
+		return nil, err
+	}
+
+	private := make([]string, 0)
+	for _, project := range projects {
+		if m, ok := resolved[project]; ok && m.Private {
+			private = append(private, project)
+		}
+	}
+	return private, nil
+}
+
+// Set creates or updates the project's metadata, or removes it, if empty
+func (srv *ProjectMetadataService) Set(metadata *models.ProjectMetadata) error {
+	metadata.Color = strings.ToLower(strings.TrimSpace(metadata.Color))
+	metadata.Icon = strings.TrimSpace(metadata.Icon)
+	metadata.Description = strings.TrimSpace(metadata.Description)
+	metadata.Currency = strings.ToUpper(strings.TrimSpace(metadata.Currency))
+
+	if metadata.IsEmpty() {
+		return srv.Unset(&models.User{ID: metadata.UserID}, metadata.Project)
+	}
+	if !metadata.IsValid() {
+		return ErrInvalidProjectMetadata
+	}
+
+	if _, err := srv.repository.Upsert(metadata); err != nil {
+		return err
+	}
+	srv.cache.Delete(metadata.UserID)
+	return nil
+}
+
+func (srv *ProjectMetadataService) Unset(user *models.User, project string) error {
+	if err := srv.repository.Delete(user.ID, project); err != nil {
+		return err
+	}
+	srv.cache.Delete(user.ID)
+	return nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProjectMetadataService_Resolve(t *testing.T) {
+	config.Set(config.Empty())
+
+	repositoryMock := new(mocks.ProjectMetadataRepositoryMock)
+	repositoryMock.On("GetByUser", "john").Return([]*models.ProjectMetadata{
+		{UserID: "john", Project: "wakapi", Color: "#00b4d8"},
+		{UserID: "john", Project: "wakapi-mobile", Color: "#ff0000"},
+		{UserID: "john", Project: "anchr-legacy", Icon: "⚓"},
+	}, nil)
+
+	aliasServiceMock := new(mocks.AliasServiceMock)
+	aliasServiceMock.On("GetByUserAndKeyAndType", "john", "wakapi", models.SummaryProject).Return([]*models.Alias{{Key: "wakapi", Value: "wakapi-mobile"}}, nil)
+	aliasServiceMock.On("GetByUserAndKeyAndType", "john", "anchr", models.SummaryProject).Return([]*models.Alias{{Key: "anchr", Value: "anchr-*"}, {Key: "anchr", Value: "anchr-legacy"}}, nil)
+	aliasServiceMock.On("GetByUserAndKeyAndType", "john", mock.Anything, models.SummaryProject).Return([]*models.Alias{}, nil)
+
+	sut := NewProjectMetadataService(repositoryMock, aliasServiceMock)
+
+	result, err := sut.Resolve("john", []string{"wakapi", "anchr", "telepush"})
+	assert.Nil(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "#00b4d8", result["wakapi"].Color) // own metadata takes precedence over that of aliased projects
+	assert.Equal(t, "⚓", result["anchr"].Icon)         // renamed project passes on its metadata
+	assert.NotContains(t, result, "telepush")
+}
+
+func TestProjectMetadataService_Set(t *testing.T) {
+	config.Set(config.Empty())
+
+	repositoryMock := new(mocks.ProjectMetadataRepositoryMock)
+	repositoryMock.On("Upsert", mock.Anything).Return(&models.ProjectMetadata{}, nil)
+	repositoryMock.On("Delete", "john", "wakapi").Return(nil)
+
+	sut := NewProjectMetadataService(repositoryMock, nil)
+
+	assert.Nil(t, sut.Set(&models.ProjectMetadata{UserID: "john", Project: "wakapi", Color: " #00B4D8 "}))
+	repositoryMock.AssertCalled(t, "Upsert", mock.MatchedBy(func(m *models.ProjectMetadata) bool {
+		return m.Color == "#00b4d8"
+	}))
+
+	assert.ErrorIs(t, sut.Set(&models.ProjectMetadata{UserID: "john", Project: "wakapi", Color: "blue"}), ErrInvalidProjectMetadata)
+
+	assert.Nil(t, sut.Set(&models.ProjectMetadata{UserID: "john", Project: "wakapi"}))
+	repositoryMock.AssertCalled(t, "Delete", "john", "wakapi")
+}
+
+func TestProjectMetadataService_GetPrivate(t *testing.T) {
+	config.Set(config.Empty())
+
+	repositoryMock := new(mocks.ProjectMetadataRepositoryMock)
+	repositoryMock.On("GetByUser", "jane").Return([]*models.ProjectMetadata{
+		{UserID: "jane", Project: "wakapi", Color: "#00b4d8"},
+		{UserID: "jane", Project: "secret-project", Private: true},
+	}, nil)
+
+	aliasServiceMock := new(mocks.AliasServiceMock)
+	aliasServiceMock.On("GetByUserAndKeyAndType", "jane", mock.Anything, models.SummaryProject).Return([]*models.Alias{}, nil)
+
+	sut := NewProjectMetadataService(repositoryMock, aliasServiceMock)
+
+	result, err := sut.GetPrivate("jane", []string{"wakapi", "secret-project", "telepush"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"secret-project"}, result)
+}
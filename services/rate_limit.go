@@ -0,0 +1,58 @@
+package services
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/httprate"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+)
+
+// RateLimitService keeps track of the users' heartbeat requests (see security.heartbeats_max_rate) using a sliding window, counted separately per user
+type RateLimitService struct {
+	config  *config.Config
+	limiter *httprate.RateLimiter
+	limit   int
+	window  time.Duration
+}
+
+func NewRateLimitService() *RateLimitService {
+	srv := &RateLimitService{config: config.Get()}
+	srv.limit, srv.window = srv.config.Security.GetHeartbeatsMaxRate()
+	if srv.limit > 0 {
+		srv.limiter = httprate.NewRateLimiter(srv.limit, srv.window)
+	}
+	return srv
+}
+
+// Consume counts another request against the user's budget and sets the X-RateLimit-* response headers accordingly. Returns false if the budget is exhausted, in which case the request is not counted.
+func (srv *RateLimitService) Consume(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	if srv.limiter == nil {
+		return true
+	}
+	// counting and checking happens atomically within the limiter, so headers are accurate for concurrent requests as well
+	return !srv.limiter.OnLimit(w, r, user.ID)
+}
+
+func (srv *RateLimitService) GetStatus(user *models.User) (*models.RateLimitStatus, error) {
+	if srv.limiter == nil {
+		return &models.RateLimitStatus{Enabled: false}, nil
+	}
+
+	_, rate, err := srv.limiter.Status(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	used := min(int(math.Round(rate)), srv.limit)
+	return &models.RateLimitStatus{
+		Enabled:   true,
+		Limit:     srv.limit,
+		Used:      used,
+		Remaining: srv.limit - used,
+		WindowSec: int(srv.window.Seconds()),
+		ResetAt:   models.CustomTime(time.Now().UTC().Truncate(srv.window).Add(srv.window)),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitService_Consume(t *testing.T) {
+	cfg := config.Empty()
+	cfg.Security.HeartbeatsMaxRate = "10/1h"
+	config.Set(cfg)
+
+	sut := NewRateLimitService()
+	user1, user2 := &models.User{ID: "testuser01"}, &models.User{ID: "testuser02"}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var accepted int
+	remaining := make(map[string]bool)
+
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			ok := sut.Consume(rec, httptest.NewRequest(http.MethodPost, "/api/heartbeat", nil), user1)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				accepted++
+				remaining[rec.Header().Get("X-RateLimit-Remaining")] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, accepted)
+	for i := 0; i < 10; i++ {
+		assert.True(t, remaining[strconv.Itoa(i)]) // every accepted request saw a distinct remaining budget
+	}
+
+	status, err := sut.GetStatus(user1)
+	assert.Nil(t, err)
+	assert.True(t, status.Enabled)
+	assert.Equal(t, 10, status.Used)
+	assert.Equal(t, 0, status.Remaining)
+	assert.Equal(t, 3600, status.WindowSec)
+
+	// budgets are per user
+	assert.True(t, sut.Consume(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/heartbeat", nil), user2))
+}
+
+func TestRateLimitService_Disabled(t *testing.T) {
+	config.Set(config.Empty())
+
+	sut := NewRateLimitService()
+	user := &models.User{ID: "testuser01"}
+
+	rec := httptest.NewRecorder()
+	assert.True(t, sut.Consume(rec, httptest.NewRequest(http.MethodPost, "/api/heartbeat", nil), user))
+	assert.Empty(t, rec.Header().Get("X-RateLimit-Limit"))
+
+	status, err := sut.GetStatus(user)
+	assert.Nil(t, err)
+	assert.False(t, status.Enabled)
+}
@@ -4,7 +4,6 @@ import (
 	"github.com/duke-git/lancet/v2/datetime"
 	"github.com/duke-git/lancet/v2/slice"
 	"github.com/leandro-lugaresi/hub"
-	"github.com/muety/artifex/v2"
 	"github.com/muety/wakapi/config"
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/utils"
@@ -26,8 +25,8 @@ type ReportService struct {
 	userService    IUserService
 	mailService    IMailService
 	rand           *rand.Rand
-	queueDefault   *artifex.Dispatcher
-	queueWorkers   *artifex.Dispatcher
+	queueDefault   *config.JobQueue
+	queueWorkers   *config.JobQueue
 }
 
 func NewReportService(summaryService ISummaryService, userService IUserService, mailService IMailService) *ReportService {
@@ -131,6 +130,7 @@ func (srv *ReportService) SendReport(user *models.User, duration time.Duration)
 		Summary:        fullSummary,
 		DailySummaries: dailySummaries,
 	}
+	report.ActiveDays = report.CountActiveDays()
 
 	if err := srv.mailService.SendReport(user, report); err != nil {
 		config.Log().Error("failed to send report", "userID", user.ID, "error", err)
@@ -5,12 +5,14 @@ import (
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/models/types"
 	"github.com/muety/wakapi/utils"
+	"net/http"
 	"time"
 )
 
 type IAggregationService interface {
 	Schedule()
 	AggregateSummaries(set datastructure.Set[string]) error
+	RegenerateSummaries(*models.User, time.Time, time.Time, func(int, int)) (int, error)
 }
 
 type IMiscService interface {
@@ -22,6 +24,8 @@ type IAliasService interface {
 	Create(*models.Alias) (*models.Alias, error)
 	Delete(*models.Alias) error
 	DeleteMulti([]*models.Alias) error
+	ApplyRules(string, []*models.Alias) (*models.AliasRulesResult, error)
+	ReplaceRules(string, []*models.Alias) (*models.AliasRulesResult, error)
 	IsInitialized(string) bool
 	InitializeUser(string) error
 	GetByUser(string) ([]*models.Alias, error)
@@ -30,19 +34,43 @@ type IAliasService interface {
 	GetAliasOrDefault(string, uint8, string) (string, error)
 }
 
+type IAliasRecomputeService interface {
+	Start(*models.User, time.Time, time.Time) (*models.AliasRecompute, error)
+	GetStatus(string) *models.AliasRecompute
+}
+
+type ILateHeartbeatService interface {
+	Schedule()
+	Add(string, time.Time, time.Time)
+	RecomputePending()
+}
+
+type IProjectActivityService interface {
+	Schedule()
+	Process(*models.Heartbeat)
+	StopIdle()
+}
+
 type IHeartbeatService interface {
 	Insert(*models.Heartbeat) error
 	InsertBatch([]*models.Heartbeat) error
+	InsertImported([]*models.Heartbeat) (int, error)
+	Flush() error
 	Count(bool) (int64, error)
 	CountByUser(*models.User) (int64, error)
+	CheckQuota(*models.User) error
 	CountByUsers([]*models.User) ([]*models.CountByUser, error)
 	GetAllWithin(time.Time, time.Time, *models.User) ([]*models.Heartbeat, error)
+	GetAllWithinPaginated(time.Time, time.Time, *models.User, *models.HeartbeatCursor, int) ([]*models.Heartbeat, error)
+	GetAllWithinByEntityPaginated(time.Time, time.Time, *models.User, string, *models.HeartbeatCursor, int) ([]*models.Heartbeat, error)
 	GetAllWithinByFilters(time.Time, time.Time, *models.User, *models.Filters) ([]*models.Heartbeat, error)
 	GetFirstByUsers() ([]*models.TimeByUser, error)
 	GetLatestByUser(*models.User) (*models.Heartbeat, error)
 	GetLatestByOriginAndUser(string, *models.User) (*models.Heartbeat, error)
 	GetLatestByFilters(*models.User, *models.Filters) (*models.Heartbeat, error)
+	GetLatestReceivedWithin(time.Time, time.Time, *models.User) (*models.Heartbeat, error)
 	GetEntitySetByUser(uint8, string) ([]string, error)
+	GetExistingHashes([]string) ([]string, error)
 	DeleteBefore(time.Time) error
 	DeleteByUser(*models.User) error
 	DeleteByUserBefore(*models.User, time.Time) error
@@ -61,14 +89,80 @@ type IKeyValueService interface {
 	DeleteString(string) error
 }
 
+type IOrgService interface {
+	GetAll() ([]*models.Org, error)
+	GetById(string) (*models.Org, error)
+	Create(*models.Org) (*models.Org, error)
+	GetMembers(*models.Org) ([]*models.User, error)
+	AddMember(*models.Org, *models.User, bool) (*models.User, error)
+	RemoveMember(*models.Org, *models.User) (*models.User, error)
+	GenerateInvite(*models.Org, *models.User) (string, error)
+	GetReport(*models.Org, *models.IntervalKey) ([]*models.OrgReportItem, error)
+}
+
+type IImportSnapshotService interface {
+	Capture(*models.User) (*models.ImportSnapshot, error)
+	Complete(*models.User, *models.ImportSnapshot) (*models.ImportDiff, error)
+	GetById(*models.User, string) (*models.ImportSnapshot, error)
+	GetLatest(*models.User) (*models.ImportSnapshot, error)
+	GetByUser(*models.User) ([]*models.ImportSnapshot, error)
+}
+
 type ILanguageMappingService interface {
 	GetById(uint) (*models.LanguageMapping, error)
 	GetByUser(string) ([]*models.LanguageMapping, error)
 	ResolveByUser(string) (map[string]string, error)
+	ResolveDetectionByUser(string) (map[string]string, error)
 	Create(*models.LanguageMapping) (*models.LanguageMapping, error)
 	Delete(mapping *models.LanguageMapping) error
 }
 
+type IProjectDuplicateService interface {
+	GetSuggestions(*models.User, float64) ([]*models.ProjectDuplicate, error)
+}
+
+type IProjectArchiveService interface {
+	Schedule()
+	GetArchived(string) (map[string]bool, error)
+	Archive(*models.User, string) error
+	Unarchive(*models.User, string) error
+	FilterProjectStats(*models.User, []*models.ProjectStats) ([]*models.ProjectStats, error)
+	AutoArchive(*models.User) (int, error)
+}
+
+type IProjectDefaultBranchService interface {
+	GetByUser(string) ([]*models.ProjectDefaultBranch, error)
+	GetMapped(string) (map[string]string, error)
+	Set(*models.User, string, string) error
+	Unset(*models.User, string) error
+}
+
+type IProjectMetadataService interface {
+	GetByUser(string) ([]*models.ProjectMetadata, error)
+	GetMapped(string) (map[string]*models.ProjectMetadata, error)
+	Resolve(string, []string) (map[string]*models.ProjectMetadata, error)
+	GetPrivate(string, []string) ([]string, error)
+	Set(*models.ProjectMetadata) error
+	Unset(*models.User, string) error
+}
+
+type IProjectComponentService interface {
+	GetByUser(string) ([]*models.ProjectComponentRule, error)
+	GetByUserAndProject(string, string) ([]*models.ProjectComponentRule, error)
+	Create(*models.ProjectComponentRule) (*models.ProjectComponentRule, error)
+	Delete(*models.User, uint) error
+}
+
+type IWebhookService interface {
+	Schedule()
+	GetByUser(string) ([]*models.Webhook, error)
+	Create(*models.User, string, []string) (*models.Webhook, error)
+	Delete(*models.User, uint) error
+	GetDeliveries(*models.User, uint, int) ([]*models.WebhookDelivery, error)
+	Ping(*models.User, uint) (*models.WebhookDelivery, error)
+	Dispatch(*models.User, string, interface{}) error
+}
+
 type IProjectLabelService interface {
 	GetById(uint) (*models.ProjectLabel, error)
 	GetByUser(string) ([]*models.ProjectLabel, error)
@@ -81,27 +175,57 @@ type IProjectLabelService interface {
 type IMailService interface {
 	SendPasswordReset(*models.User, string) error
 	SendWakatimeFailureNotification(*models.User, int) error
-	SendImportNotification(*models.User, time.Duration, int) error
+	SendImportNotification(*models.User, time.Duration, int, *models.ImportDiff) error
+	SendImportPreview(*models.User, *models.ImportPreview) error
 	SendReport(*models.User, *models.Report) error
 	SendSubscriptionNotification(*models.User, bool) error
+	SendSubscriptionReminder(*models.User, bool) error
+	SendInactivityReminder(*models.User, int) error
+	SendHeartbeatQuotaNotification(*models.User, int64) error
+	SendExportNotification(*models.User, string, time.Time) error
+	SendTestMail(*models.User, string) error
+	Schedule()
+	FlushQueue() error
+	GetQueued(string) ([]*models.QueuedMail, error)
 }
 
 type IDurationService interface {
 	Get(time.Time, time.Time, *models.User, *models.Filters) (models.Durations, error)
+	GetWithEntities(time.Time, time.Time, *models.User, *models.Filters) (models.Durations, error)
+}
+
+type IEntityService interface {
+	GetTop(time.Time, time.Time, *models.User, string, int) ([]*models.SummaryItem, error)
 }
 
 type ISummaryService interface {
 	Aliased(time.Time, time.Time, *models.User, types.SummaryRetriever, *models.Filters, bool) (*models.Summary, error)
 	Retrieve(time.Time, time.Time, *models.User, *models.Filters) (*models.Summary, error)
 	Summarize(time.Time, time.Time, *models.User, *models.Filters) (*models.Summary, error)
+	Cumulative(time.Time, time.Time, *models.User, *models.Filters) (*models.CumulativeSummary, error)
+	Rollup(time.Time, time.Time, *models.User, *models.Filters, string) ([]*models.SummaryRollup, error)
+	SummarizeComponents(time.Time, time.Time, *models.User, *models.Filters, []*models.ProjectComponentRule) (models.SummaryItems, error)
+	SummarizeBranchesAcrossProjects(time.Time, time.Time, *models.User, *models.Filters, []string) ([]*models.BranchAcrossProjects, error)
 	GetLatestByUser() ([]*models.TimeByUser, error)
+	GetByUserWithin(*models.User, time.Time, time.Time) ([]*models.Summary, error)
 	DeleteByUser(string) error
 	DeleteByUserBefore(string, time.Time) error
+	DeleteByUserWithin(string, time.Time, time.Time) error
 	Insert(*models.Summary) error
+	FlushCache(string) int
+	FlushAllCaches() int
 }
 
 type IActivityService interface {
 	GetChart(*models.User, *models.IntervalKey, bool, bool, bool) (string, error)
+	GetHourly(*models.User, time.Time, time.Time, *models.Filters, bool) (*models.HourlyActivity, error)
+	GetContributionGrid(*models.User, int, *models.Filters) (*models.ContributionGrid, error)
+	GetFocus(*models.User, time.Time, time.Time, *models.Filters, string) (*models.FocusStats, error)
+}
+
+type IYearReviewService interface {
+	Get(*models.User, int) (*models.YearReview, error)
+	GetImage(*models.YearReview, bool, bool) string
 }
 
 type IReportService interface {
@@ -109,6 +233,32 @@ type IReportService interface {
 	SendReport(*models.User, time.Duration) error
 }
 
+type ITotpService interface {
+	Setup(*models.User) (string, string, error)
+	Enable(*models.User, string) ([]string, error)
+	Disable(*models.User, string) error
+	RegenerateRecoveryCodes(*models.User, string) ([]string, error)
+	Verify(*models.User, string) (bool, error)
+}
+
+type IExportService interface {
+	Schedule()
+	RequestExport(*models.User, string) error
+	GenerateExport(*models.User, string) (string, error)
+	GetSignedUrl(string) (string, time.Time, error)
+	ResolveSignedUrl(string, string, string) (*ExportLocation, error)
+}
+
+type ISettingsProfileService interface {
+	Export(*models.User) (*models.SettingsProfile, error)
+	Import(*models.User, *models.SettingsProfile, string) (*models.SettingsImportResult, error)
+}
+
+type IRateLimitService interface {
+	Consume(http.ResponseWriter, *http.Request, *models.User) bool
+	GetStatus(*models.User) (*models.RateLimitStatus, error)
+}
+
 type IHousekeepingService interface {
 	Schedule()
 	CleanUserDataBefore(*models.User, time.Time) error
@@ -118,11 +268,13 @@ type ILeaderboardService interface {
 	GetDefaultScope() *models.IntervalKey
 	Schedule()
 	ComputeLeaderboard([]*models.User, *models.IntervalKey, []uint8) error
+	ComputeAll(*models.IntervalKey) (int, error)
 	ExistsAnyByUser(string) (bool, error)
 	CountUsers(bool) (int64, error)
 	GetByInterval(*models.IntervalKey, *utils.PageParams, bool) (models.Leaderboard, error)
 	GetByIntervalAndUser(*models.IntervalKey, string, bool) (models.Leaderboard, error)
 	GetAggregatedByInterval(*models.IntervalKey, *uint8, *utils.PageParams, bool) (models.Leaderboard, error)
+	GetAggregatedByIntervalAndOrg(*models.IntervalKey, *string, *uint8, *utils.PageParams, bool) (models.Leaderboard, error)
 	GetAggregatedByIntervalAndUser(*models.IntervalKey, string, *uint8, bool) (models.Leaderboard, error)
 	GenerateByUser(*models.User, *models.IntervalKey) (*models.LeaderboardItem, error)
 	GenerateAggregatedByUser(*models.User, *models.IntervalKey, uint8) ([]*models.LeaderboardItem, error)
@@ -131,6 +283,7 @@ type ILeaderboardService interface {
 type IUserService interface {
 	GetUserById(string) (*models.User, error)
 	GetUserByKey(string) (*models.User, error)
+	GetUserByMetricsToken(string) (*models.User, error)
 	GetUserByEmail(string) (*models.User, error)
 	GetUserByResetToken(string) (*models.User, error)
 	GetUserByStripeCustomerId(string) (*models.User, error)
@@ -139,15 +292,34 @@ type IUserService interface {
 	GetMany([]string) ([]*models.User, error)
 	GetManyMapped([]string) (map[string]*models.User, error)
 	GetAllByReports(bool) ([]*models.User, error)
+	GetAllDeletionDue() ([]*models.User, error)
 	GetAllByLeaderboard(bool) ([]*models.User, error)
+	GetByOrg(string) ([]*models.User, error)
 	GetActive(bool) ([]*models.User, error)
+	Query(*models.UserQuery, *utils.PageParams) ([]*models.UserWithActivity, int64, error)
 	Count() (int64, error)
 	CreateOrGet(*models.Signup, bool) (*models.User, bool, error)
+	ProvisionByApiKey(string) (*models.User, error)
 	Update(*models.User) (*models.User, error)
+	UpdateOrgMembership(*models.User) (*models.User, error)
 	Delete(*models.User) error
+	SoftDelete(*models.User) (*models.User, error)
+	Restore(*models.User) (*models.User, error)
+	UpgradePasswordHash(*models.User, string) (bool, error)
 	ResetApiKey(*models.User) (*models.User, error)
+	ResetMetricsToken(*models.User) (*models.User, error)
+	RevokeMetricsToken(*models.User) (*models.User, error)
+	InferLocation(*models.User, string) (bool, error)
+	SetLastPlugin(*models.User, string, string) (bool, error)
 	SetWakatimeApiCredentials(*models.User, string, string) (*models.User, error)
 	GenerateResetToken(*models.User) (*models.User, error)
+	CreateSession(*models.User, string, string) (*models.UserSession, error)
+	GetSession(string) (*models.UserSession, error)
+	GetSessions(*models.User) ([]*models.UserSession, error)
+	TouchSession(*models.UserSession) error
+	RevokeSession(*models.User, string) error
+	RevokeSessions(*models.User, string) error
+	DeleteStaleSessions() error
 	FlushCache()
 	FlushUserCache(string)
 }
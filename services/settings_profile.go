@@ -0,0 +1,356 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/models"
+)
+
+const (
+	settingsProfileMaxExtensionLength = 16 // see models.LanguageMapping
+	settingsProfileMaxLabelLength     = 64 // see models.LanguageMapping and models.ProjectLabel
+)
+
+var ErrInvalidSettingsProfile = errors.New("invalid settings profile")
+
+// SettingsProfileService exports and imports users' settings as portable profiles (see models.SettingsProfile), e.g. to copy them between accounts on different instances
+type SettingsProfileService struct {
+	config                 *config.Config
+	userService            IUserService
+	aliasService           IAliasService
+	languageMappingService ILanguageMappingService
+	projectLabelService    IProjectLabelService
+	defaultBranchService   IProjectDefaultBranchService
+}
+
+func NewSettingsProfileService(userService IUserService, aliasService IAliasService, languageMappingService ILanguageMappingService, projectLabelService IProjectLabelService, defaultBranchService IProjectDefaultBranchService) *SettingsProfileService {
+	return &SettingsProfileService{
+		config:                 config.Get(),
+		userService:            userService,
+		aliasService:           aliasService,
+		languageMappingService: languageMappingService,
+		projectLabelService:    projectLabelService,
+		defaultBranchService:   defaultBranchService,
+	}
+}
+
+func (srv *SettingsProfileService) Export(user *models.User) (*models.SettingsProfile, error) {
+	aliases, err := srv.aliasService.GetByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := srv.languageMappingService.GetByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := srv.projectLabelService.GetByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := srv.defaultBranchService.GetByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &models.SettingsProfile{
+		Version:          models.SettingsProfileVersion,
+		ExportedAt:       models.CustomTime(time.Now()),
+		Preferences:      models.NewSettingsProfilePreferences(user),
+		Aliases:          helpers.AliasRulesFromAliases(aliases),
+		LanguageMappings: make(map[string]string, len(mappings)),
+		ProjectLabels:    make(map[string][]string),
+		DefaultBranches:  make(map[string]string, len(branches)),
+	}
+	for _, m := range mappings {
+		profile.LanguageMappings[m.Extension] = m.Language
+	}
+	for _, l := range labels {
+		profile.ProjectLabels[l.ProjectKey] = append(profile.ProjectLabels[l.ProjectKey], l.Label)
+	}
+	for _, b := range branches {
+		profile.DefaultBranches[b.Project] = b.Branch
+	}
+	return profile, nil
+}
+
+// Import applies the profile's preferences to the user and adds its aliases, language mappings, project labels and default branches to the user's existing ones.
+// Entries of the same name (e.g. an alias for the same original name or a mapping for the same file extension) are overwritten. In replace mode, all other existing entries are removed.
+// The profile is validated as a whole before anything is written, errors wrap ErrInvalidSettingsProfile (or ErrAliasLimitExceeded or ErrAliasCycle).
+func (srv *SettingsProfileService) Import(user *models.User, profile *models.SettingsProfile, mode string) (*models.SettingsImportResult, error) {
+	if mode != models.SettingsImportMerge && mode != models.SettingsImportReplace {
+		return nil, fmt.Errorf("%w: unknown mode '%s'", ErrInvalidSettingsProfile, mode)
+	}
+	if err := srv.validate(profile); err != nil {
+		return nil, err
+	}
+
+	aliases, conflicts, err := helpers.AliasesFromRules(profile.Aliases, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSettingsProfile, err)
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("%w: '%s' is aliased to multiple keys (%s)", ErrInvalidSettingsProfile, conflicts[0].Value, strings.Join(conflicts[0].Keys, ", "))
+	}
+
+	result := &models.SettingsImportResult{Mode: mode}
+	replace := mode == models.SettingsImportReplace
+
+	// aliases go first, as they are the only ones, which might be rejected in combination with the existing ones
+	if result.Aliases, err = srv.importAliases(user, aliases, replace); err != nil {
+		return nil, err
+	}
+	if result.LanguageMappings, err = srv.importLanguageMappings(user, profile.LanguageMappings, replace); err != nil {
+		return result, err
+	}
+	if result.ProjectLabels, err = srv.importProjectLabels(user, profile.ProjectLabels, replace); err != nil {
+		return result, err
+	}
+	if result.DefaultBranches, err = srv.importDefaultBranches(user, profile.DefaultBranches, replace); err != nil {
+		return result, err
+	}
+
+	if profile.Preferences != nil {
+		profile.Preferences.ApplyTo(user)
+		if _, err := srv.userService.Update(user); err != nil {
+			return result, err
+		}
+		srv.userService.FlushUserCache(user.ID)
+	}
+
+	return result, nil
+}
+
+func (srv *SettingsProfileService) importAliases(user *models.User, aliases []*models.Alias, replace bool) (*models.SettingsImportCounts, error) {
+	apply := srv.aliasService.ApplyRules
+	if replace {
+		apply = srv.aliasService.ReplaceRules
+	}
+
+	applied, err := apply(user.ID, aliases)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SettingsImportCounts{Created: applied.Created, Updated: applied.Updated, Unchanged: applied.Unchanged, Deleted: applied.Deleted}, nil
+}
+
+func (srv *SettingsProfileService) importLanguageMappings(user *models.User, mappings map[string]string, replace bool) (*models.SettingsImportCounts, error) {
+	existing, err := srv.languageMappingService.GetByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	existingByExtension := make(map[string]*models.LanguageMapping, len(existing))
+	for _, m := range existing {
+		existingByExtension[m.Extension] = m
+	}
+
+	counts := &models.SettingsImportCounts{}
+	imported := make(map[string]bool, len(mappings))
+	for extension, language := range mappings {
+		extension = strings.TrimPrefix(strings.TrimSpace(extension), ".")
+		imported[extension] = true
+
+		old, ok := existingByExtension[extension]
+		if ok && old.Language == language {
+			counts.Unchanged++
+			continue
+		}
+		if ok {
+			if err := srv.languageMappingService.Delete(old); err != nil {
+				return counts, err
+			}
+		}
+		if _, err := srv.languageMappingService.Create(&models.LanguageMapping{UserID: user.ID, Extension: extension, Language: language}); err != nil {
+			return counts, err
+		}
+
+		if ok {
+			counts.Updated++
+		} else {
+			counts.Created++
+		}
+	}
+
+	if replace {
+		for _, m := range existing {
+			if imported[m.Extension] {
+				continue
+			}
+			if err := srv.languageMappingService.Delete(m); err != nil {
+				return counts, err
+			}
+			counts.Deleted++
+		}
+	}
+
+	return counts, nil
+}
+
+func (srv *SettingsProfileService) importProjectLabels(user *models.User, labels map[string][]string, replace bool) (*models.SettingsImportCounts, error) {
+	existing, err := srv.projectLabelService.GetByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	existingSet := make(map[string]bool, len(existing))
+	for _, l := range existing {
+		existingSet[l.ProjectKey+"/"+l.Label] = true
+	}
+
+	counts := &models.SettingsImportCounts{}
+	imported := make(map[string]bool)
+	for project, projectLabels := range labels {
+		for _, label := range projectLabels {
+			key := project + "/" + label
+			if imported[key] {
+				continue // duplicate
+			}
+			imported[key] = true
+
+			if existingSet[key] {
+				counts.Unchanged++
+				continue
+			}
+			if _, err := srv.projectLabelService.Create(&models.ProjectLabel{UserID: user.ID, ProjectKey: project, Label: label}); err != nil {
+				return counts, err
+			}
+			counts.Created++
+		}
+	}
+
+	if replace {
+		for _, l := range existing {
+			if imported[l.ProjectKey+"/"+l.Label] {
+				continue
+			}
+			if err := srv.projectLabelService.Delete(l); err != nil {
+				return counts, err
+			}
+			counts.Deleted++
+		}
+	}
+
+	return counts, nil
+}
+
+func (srv *SettingsProfileService) importDefaultBranches(user *models.User, branches map[string]string, replace bool) (*models.SettingsImportCounts, error) {
+	existing, err := srv.defaultBranchService.GetMapped(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := &models.SettingsImportCounts{}
+	for project, branch := range branches {
+		old, ok := existing[project]
+		if ok && old == strings.TrimSpace(branch) {
+			counts.Unchanged++
+			continue
+		}
+		if err := srv.defaultBranchService.Set(user, project, branch); err != nil {
+			return counts, err
+		}
+
+		if ok {
+			counts.Updated++
+		} else {
+			counts.Created++
+		}
+	}
+
+	if replace {
+		for project := range existing {
+			if _, ok := branches[project]; ok {
+				continue
+			}
+			if err := srv.defaultBranchService.Unset(user, project); err != nil {
+				return counts, err
+			}
+			counts.Deleted++
+		}
+	}
+
+	return counts, nil
+}
+
+// validate checks the profile the same way as when changing the respective settings individually
+func (srv *SettingsProfileService) validate(profile *models.SettingsProfile) error {
+	invalid := func(format string, a ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidSettingsProfile, fmt.Sprintf(format, a...))
+	}
+
+	if profile.Version < 1 || profile.Version > models.SettingsProfileVersion {
+		return invalid("unsupported version %d", profile.Version)
+	}
+
+	if p := profile.Preferences; p != nil {
+		if p.Location != "" && !models.ValidateTimezone(p.Location) {
+			return invalid("unknown time zone '%s'", p.Location)
+		}
+		if p.ShareDataMaxDays < -1 {
+			return invalid("share_data_max_days must be -1 or greater")
+		}
+		if len(p.ProjectPathRoot) > models.MaxProjectDerivationRootLength {
+			return invalid("project_path_root too long")
+		}
+		if p.ProjectPathSegment < 1 || p.ProjectPathSegment > 10 {
+			return invalid("project_path_segment must be between 1 and 10")
+		}
+		if dur := time.Duration(p.HeartbeatsTimeoutSec) * time.Second; p.HeartbeatsTimeoutSec != 0 && (dur < models.MinHeartbeatsTimeout || dur > models.MaxHeartbeatsTimeout) { // 0 means default
+			return invalid("heartbeats_timeout_sec must be between %d and %d", int(models.MinHeartbeatsTimeout.Seconds()), int(models.MaxHeartbeatsTimeout.Seconds()))
+		}
+		if _, err := helpers.ParseInterval(p.DefaultSummaryInterval); p.DefaultSummaryInterval != "" && err != nil {
+			return invalid("unknown default_summary_interval '%s'", p.DefaultSummaryInterval)
+		}
+		if _, err := models.ParseIgnorePatterns(p.IgnorePatterns); err != nil {
+			return invalid("invalid ignore_patterns: %v", err)
+		}
+		if _, err := models.ParseRangePresets(p.RangePresets); err != nil {
+			return invalid("invalid range_presets: %v", err)
+		}
+		if p.AutoArchiveDays < 0 || p.AutoArchiveDays > models.MaxAutoArchiveDays {
+			return invalid("auto_archive_days must be between 0 and %d", models.MaxAutoArchiveDays)
+		}
+		if dur := time.Duration(p.ActiveDayThresholdSec) * time.Second; p.ActiveDayThresholdSec < 0 || dur > models.MaxActiveDayThreshold {
+			return invalid("active_day_threshold_sec must be between 0 and %d", int(models.MaxActiveDayThreshold.Seconds()))
+		}
+		if dur := time.Duration(p.DailyProjectCapHours) * time.Hour; p.DailyProjectCapHours < 0 || dur > models.MaxDailyProjectCap {
+			return invalid("daily_project_cap_hours must be between 0 and %d", int(models.MaxDailyProjectCap.Hours()))
+		}
+		if p.MachineOverlapMode != "" && p.MachineOverlapMode != models.MachineOverlapMerge && p.MachineOverlapMode != models.MachineOverlapAdditive {
+			return invalid("unknown machine_overlap_mode '%s'", p.MachineOverlapMode)
+		}
+		if p.UnknownBucket != "" && p.UnknownBucket != models.UnknownBucketShow && p.UnknownBucket != models.UnknownBucketHide {
+			return invalid("unknown unknown_bucket '%s'", p.UnknownBucket)
+		}
+		if p.AverageMode != "" && p.AverageMode != models.AverageModeCalendar && p.AverageMode != models.AverageModeActiveDays && p.AverageMode != models.AverageModeSinceFirst {
+			return invalid("unknown average_mode '%s'", p.AverageMode)
+		}
+	}
+
+	for extension, language := range profile.LanguageMappings {
+		extension = strings.TrimPrefix(strings.TrimSpace(extension), ".")
+		mapping := &models.LanguageMapping{Extension: extension, Language: language}
+		if !mapping.IsValid() || len(extension) > settingsProfileMaxExtensionLength || len(language) > settingsProfileMaxLabelLength {
+			return invalid("invalid language mapping '%s' -> '%s'", extension, language)
+		}
+	}
+
+	for project, labels := range profile.ProjectLabels {
+		for _, label := range labels {
+			if l := (&models.ProjectLabel{ProjectKey: project, Label: label}); !l.IsValid() || len(label) > settingsProfileMaxLabelLength {
+				return invalid("invalid label '%s' for project '%s'", label, project)
+			}
+		}
+	}
+
+	for project, branch := range profile.DefaultBranches {
+		if b := (&models.ProjectDefaultBranch{UserID: "-", Project: project, Branch: strings.TrimSpace(branch)}); !b.IsValid() {
+			return invalid("invalid default branch '%s' for project '%s'", branch, project)
+		}
+	}
+
+	return nil
+}
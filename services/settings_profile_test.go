@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type SettingsProfileServiceTestSuite struct {
+	suite.Suite
+	TestUser               *models.User
+	UserService            *mocks.UserServiceMock
+	AliasService           *mocks.AliasServiceMock
+	LanguageMappingService *mocks.LanguageMappingServiceMock
+	ProjectLabelService    *mocks.ProjectLabelServiceMock
+	DefaultBranchService   *mocks.ProjectDefaultBranchServiceMock
+}
+
+func (suite *SettingsProfileServiceTestSuite) SetupTest() {
+	config.Set(config.Empty())
+
+	suite.TestUser = &models.User{ID: "testuser01", Location: "Europe/Berlin", ShareDataMaxDays: 30, HeartbeatsTimeoutSec: 120, ProjectPathSegment: 1, AverageMode: models.AverageModeCalendar}
+
+	suite.UserService = new(mocks.UserServiceMock)
+	suite.AliasService = new(mocks.AliasServiceMock)
+	suite.LanguageMappingService = new(mocks.LanguageMappingServiceMock)
+	suite.ProjectLabelService = new(mocks.ProjectLabelServiceMock)
+	suite.DefaultBranchService = new(mocks.ProjectDefaultBranchServiceMock)
+
+	suite.AliasService.On("GetByUser", suite.TestUser.ID).Return([]*models.Alias{
+		{ID: 1, Type: models.SummaryProject, UserID: suite.TestUser.ID, Key: "wakapi", Value: "wakapi-mobile"},
+		{ID: 2, Type: models.SummaryEditor, UserID: suite.TestUser.ID, Key: "VSCode", Value: "vscode"},
+	}, nil)
+	suite.LanguageMappingService.On("GetByUser", suite.TestUser.ID).Return([]*models.LanguageMapping{
+		{ID: 1, UserID: suite.TestUser.ID, Extension: "tpl", Language: "HTML"},
+		{ID: 2, UserID: suite.TestUser.ID, Extension: "h", Language: "C"},
+	}, nil)
+	suite.ProjectLabelService.On("GetByUser", suite.TestUser.ID).Return([]*models.ProjectLabel{
+		{ID: 1, UserID: suite.TestUser.ID, ProjectKey: "wakapi", Label: "oss"},
+	}, nil)
+	suite.DefaultBranchService.On("GetByUser", suite.TestUser.ID).Return([]*models.ProjectDefaultBranch{
+		{UserID: suite.TestUser.ID, Project: "wakapi", Branch: "master"},
+	}, nil)
+	suite.DefaultBranchService.On("GetMapped", suite.TestUser.ID).Return(map[string]string{"wakapi": "master"}, nil)
+}
+
+func TestSettingsProfileServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(SettingsProfileServiceTestSuite))
+}
+
+func (suite *SettingsProfileServiceTestSuite) TestSettingsProfileService_Export() {
+	sut := NewSettingsProfileService(suite.UserService, suite.AliasService, suite.LanguageMappingService, suite.ProjectLabelService, suite.DefaultBranchService)
+
+	profile, err := sut.Export(suite.TestUser)
+
+	suite.Nil(err)
+	suite.Equal(models.SettingsProfileVersion, profile.Version)
+	suite.Equal("Europe/Berlin", profile.Preferences.Location)
+	suite.Equal(30, profile.Preferences.ShareDataMaxDays)
+	suite.Equal(models.AliasRules{"projects": {"wakapi": {"wakapi-mobile"}}, "editors": {"VSCode": {"vscode"}}}, profile.Aliases)
+	suite.Equal(map[string]string{"tpl": "HTML", "h": "C"}, profile.LanguageMappings)
+	suite.Equal(map[string][]string{"wakapi": {"oss"}}, profile.ProjectLabels)
+	suite.Equal(map[string]string{"wakapi": "master"}, profile.DefaultBranches)
+}
+
+func (suite *SettingsProfileServiceTestSuite) TestSettingsProfileService_Import_Merge() {
+	sut := NewSettingsProfileService(suite.UserService, suite.AliasService, suite.LanguageMappingService, suite.ProjectLabelService, suite.DefaultBranchService)
+
+	preferences := models.NewSettingsProfilePreferences(suite.TestUser)
+	preferences.Location = "America/New_York"
+	preferences.DailyProjectCapHours = 10
+
+	profile := &models.SettingsProfile{
+		Version:          models.SettingsProfileVersion,
+		Preferences:      preferences,
+		Aliases:          models.AliasRules{"projects": {"wakapi": {"wakapi-mobile", "wakapi-web"}}},
+		LanguageMappings: map[string]string{".tpl": "Go Template", "h": "C", "vue": "Vue.js"},
+		ProjectLabels:    map[string][]string{"wakapi": {"oss", "go"}},
+		DefaultBranches:  map[string]string{"wakapi": "main", "anchr": "master"},
+	}
+
+	suite.AliasService.On("ApplyRules", suite.TestUser.ID, mock.Anything).Return(&models.AliasRulesResult{Created: 1, Unchanged: 1}, nil)
+	suite.LanguageMappingService.On("Delete", mock.Anything).Return(nil)
+	suite.LanguageMappingService.On("Create", mock.Anything).Return(&models.LanguageMapping{}, nil)
+	suite.ProjectLabelService.On("Create", mock.Anything).Return(&models.ProjectLabel{}, nil)
+	suite.DefaultBranchService.On("Set", suite.TestUser, mock.Anything, mock.Anything).Return(nil)
+	suite.UserService.On("Update", suite.TestUser).Return(suite.TestUser, nil)
+	suite.UserService.On("FlushUserCache", suite.TestUser.ID).Return()
+
+	result, err := sut.Import(suite.TestUser, profile, models.SettingsImportMerge)
+
+	suite.Nil(err)
+	suite.Equal(&models.SettingsImportCounts{Created: 1, Unchanged: 1}, result.Aliases)
+	suite.Equal(&models.SettingsImportCounts{Created: 1, Updated: 1, Unchanged: 1}, result.LanguageMappings)
+	suite.Equal(&models.SettingsImportCounts{Created: 1, Unchanged: 1}, result.ProjectLabels)
+	suite.Equal(&models.SettingsImportCounts{Created: 1, Updated: 1}, result.DefaultBranches)
+
+	suite.LanguageMappingService.AssertCalled(suite.T(), "Delete", mock.MatchedBy(func(m *models.LanguageMapping) bool { return m.ID == 1 }))
+	suite.LanguageMappingService.AssertCalled(suite.T(), "Create", &models.LanguageMapping{UserID: suite.TestUser.ID, Extension: "tpl", Language: "Go Template"})
+	suite.ProjectLabelService.AssertCalled(suite.T(), "Create", &models.ProjectLabel{UserID: suite.TestUser.ID, ProjectKey: "wakapi", Label: "go"})
+	suite.AliasService.AssertNotCalled(suite.T(), "DeleteMulti", mock.Anything)
+	suite.ProjectLabelService.AssertNotCalled(suite.T(), "Delete", mock.Anything)
+	suite.DefaultBranchService.AssertNotCalled(suite.T(), "Unset", mock.Anything, mock.Anything)
+
+	suite.Equal("America/New_York", suite.TestUser.Location)
+	suite.True(suite.TestUser.LocationFixed)
+	suite.Equal(10, suite.TestUser.DailyProjectCapHours)
+	suite.Equal(30, suite.TestUser.ShareDataMaxDays)
+	suite.UserService.AssertNumberOfCalls(suite.T(), "Update", 1)
+}
+
+func (suite *SettingsProfileServiceTestSuite) TestSettingsProfileService_Import_Replace() {
+	sut := NewSettingsProfileService(suite.UserService, suite.AliasService, suite.LanguageMappingService, suite.ProjectLabelService, suite.DefaultBranchService)
+
+	profile := &models.SettingsProfile{
+		Version:          models.SettingsProfileVersion,
+		Aliases:          models.AliasRules{"projects": {"wakapi": {"wakapi-mobile"}}},
+		LanguageMappings: map[string]string{"h": "C"},
+		DefaultBranches:  map[string]string{"anchr": "main"},
+	}
+
+	suite.AliasService.On("ReplaceRules", suite.TestUser.ID, mock.Anything).Return(&models.AliasRulesResult{Unchanged: 1, Deleted: 1}, nil)
+	suite.LanguageMappingService.On("Delete", mock.Anything).Return(nil)
+	suite.ProjectLabelService.On("Delete", mock.Anything).Return(nil)
+	suite.DefaultBranchService.On("Set", suite.TestUser, "anchr", "main").Return(nil)
+	suite.DefaultBranchService.On("Unset", suite.TestUser, "wakapi").Return(nil)
+
+	result, err := sut.Import(suite.TestUser, profile, models.SettingsImportReplace)
+
+	suite.Nil(err)
+	suite.Equal(&models.SettingsImportCounts{Unchanged: 1, Deleted: 1}, result.Aliases)
+	suite.Equal(&models.SettingsImportCounts{Unchanged: 1, Deleted: 1}, result.LanguageMappings)
+	suite.Equal(&models.SettingsImportCounts{Deleted: 1}, result.ProjectLabels)
+	suite.Equal(&models.SettingsImportCounts{Created: 1, Deleted: 1}, result.DefaultBranches)
+
+	suite.AliasService.AssertNotCalled(suite.T(), "ApplyRules", mock.Anything, mock.Anything)
+	suite.LanguageMappingService.AssertCalled(suite.T(), "Delete", mock.MatchedBy(func(m *models.LanguageMapping) bool { return m.ID == 1 }))
+
+	// preferences are left untouched if missing from the profile
+	suite.UserService.AssertNotCalled(suite.T(), "Update", mock.Anything)
+}
+
+func (suite *SettingsProfileServiceTestSuite) TestSettingsProfileService_Import_Invalid() {
+	sut := NewSettingsProfileService(suite.UserService, suite.AliasService, suite.LanguageMappingService, suite.ProjectLabelService, suite.DefaultBranchService)
+
+	validPreferences := func() *models.SettingsProfilePreferences {
+		return models.NewSettingsProfilePreferences(suite.TestUser)
+	}
+	withPreferences := func(f func(p *models.SettingsProfilePreferences)) *models.SettingsProfile {
+		p := validPreferences()
+		f(p)
+		return &models.SettingsProfile{Version: models.SettingsProfileVersion, Preferences: p}
+	}
+
+	profiles := []*models.SettingsProfile{
+		{Version: 0},
+		{Version: models.SettingsProfileVersion + 1},
+		withPreferences(func(p *models.SettingsProfilePreferences) { p.Location = "Mars/Olympus_Mons" }),
+		withPreferences(func(p *models.SettingsProfilePreferences) { p.HeartbeatsTimeoutSec = 1 }),
+		withPreferences(func(p *models.SettingsProfilePreferences) { p.DefaultSummaryInterval = "fortnight" }),
+		withPreferences(func(p *models.SettingsProfilePreferences) { p.DailyProjectCapHours = 25 }),
+		withPreferences(func(p *models.SettingsProfilePreferences) { p.AverageMode = "median" }),
+		{Version: models.SettingsProfileVersion, Aliases: models.AliasRules{"foo": {"bar": {"baz"}}}},
+		{Version: models.SettingsProfileVersion, Aliases: models.AliasRules{"projects": {"wakapi": {"anchr"}, "other": {"anchr"}}}},
+		{Version: models.SettingsProfileVersion, LanguageMappings: map[string]string{"": "Go"}},
+		{Version: models.SettingsProfileVersion, ProjectLabels: map[string][]string{"wakapi": {""}}},
+		{Version: models.SettingsProfileVersion, DefaultBranches: map[string]string{"wakapi": " "}},
+	}
+
+	for _, profile := range profiles {
+		_, err := sut.Import(suite.TestUser, profile, models.SettingsImportMerge)
+		suite.True(errors.Is(err, ErrInvalidSettingsProfile), "%v", err)
+	}
+
+	_, err := sut.Import(suite.TestUser, &models.SettingsProfile{Version: models.SettingsProfileVersion}, "overwrite")
+	suite.True(errors.Is(err, ErrInvalidSettingsProfile))
+
+	// nothing is written for invalid profiles
+	suite.AliasService.AssertNotCalled(suite.T(), "ApplyRules", mock.Anything, mock.Anything)
+	suite.LanguageMappingService.AssertNotCalled(suite.T(), "Create", mock.Anything)
+	suite.UserService.AssertNotCalled(suite.T(), "Update", mock.Anything)
+	suite.Equal("Europe/Berlin", suite.TestUser.Location)
+}
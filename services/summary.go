@@ -10,6 +10,7 @@ import (
 	"github.com/muety/wakapi/models"
 	"github.com/muety/wakapi/models/types"
 	"github.com/muety/wakapi/repositories"
+	"github.com/muety/wakapi/utils"
 	"github.com/patrickmn/go-cache"
 	"log/slog"
 	"sort"
@@ -29,9 +30,10 @@ type SummaryService struct {
 }
 
 func NewSummaryService(summaryRepo repositories.ISummaryRepository, heartbeatService IHeartbeatService, durationService IDurationService, aliasService IAliasService, projectLabelService IProjectLabelService) *SummaryService {
+	cfg := config.Get()
 	srv := &SummaryService{
-		config:              config.Get(),
-		cache:               cache.New(24*time.Hour, 24*time.Hour),
+		config:              cfg,
+		cache:               cache.New(cfg.App.SummaryCacheTTL(), cfg.App.SummaryCacheTTL()),
 		eventBus:            config.EventBus(),
 		repository:          summaryRepo,
 		heartbeatService:    heartbeatService,
@@ -47,6 +49,13 @@ func NewSummaryService(summaryRepo repositories.ISummaryRepository, heartbeatSer
 		}
 	}(&sub1)
 
+	sub2 := srv.eventBus.Subscribe(0, config.TopicDefaultBranch)
+	go func(sub *hub.Subscription) {
+		for m := range sub.Receiver {
+			srv.invalidateUserCache(m.Fields[config.FieldUserId].(string))
+		}
+	}(&sub2)
+
 	return srv
 }
 
@@ -95,6 +104,14 @@ func (srv *SummaryService) Aliased(from, to time.Time, user *models.User, f type
 		summary.Entities = nil
 	}
 
+	if filters != nil && len(filters.SelectFields) > 0 {
+		keep := make(map[uint8]bool, len(filters.SelectFields))
+		for _, t := range filters.SelectFields {
+			keep[t] = true
+		}
+		summary.KeepOnly(keep)
+	}
+
 	srv.cache.SetDefault(cacheKey, summary)
 	return summary.Sorted(), nil
 }
@@ -102,10 +119,7 @@ func (srv *SummaryService) Aliased(from, to time.Time, user *models.User, f type
 func (srv *SummaryService) Retrieve(from, to time.Time, user *models.User, filters *models.Filters) (*models.Summary, error) {
 	summaries := make([]*models.Summary, 0)
 
-	// Filtered summaries are not persisted currently
-	// Special case: if (a) filters apply to only one entity type and (b) we're only interested in the summary items of that particular entity type,
-	// we can still fetch the persisted summary and drop all irrelevant parts from it
-	if filters == nil || filters.IsEmpty() || (filters.CountDistinctTypes() == 1 && filters.SelectFilteredOnly) {
+	if usesPersistedSummaries(filters) {
 		// Get all already existing, pre-generated summaries that fall into the requested interval
 		result, err := srv.repository.GetByUserWithin(user, from, to)
 		if err == nil {
@@ -115,6 +129,64 @@ func (srv *SummaryService) Retrieve(from, to time.Time, user *models.User, filte
 		}
 	}
 
+	return srv.retrieveFrom(from, to, user, filters, summaries)
+}
+
+// Cumulative computes the user's running total of coding time at the end of every day between from and to, including days without any activity.
+// All persisted daily summaries within the range are fetched at once, only the parts not covered by them are computed from durations.
+func (srv *SummaryService) Cumulative(from, to time.Time, user *models.User, filters *models.Filters) (*models.CumulativeSummary, error) {
+	persisted := make([]*models.Summary, 0)
+	if usesPersistedSummaries(filters) {
+		result, err := srv.repository.GetByUserWithin(user, from, to)
+		if err != nil {
+			return nil, err
+		}
+		persisted = result
+	}
+
+	// filters might have been altered (e.g. by resolving aliases) when passed to the retriever
+	retrieve := func(from, to time.Time, user *models.User, filters *models.Filters) (*models.Summary, error) {
+		summaries := make([]*models.Summary, 0)
+		if usesPersistedSummaries(filters) {
+			summaries = slice.Filter(persisted, func(_ int, s *models.Summary) bool {
+				return !s.FromTime.T().Before(from) && !s.ToTime.T().After(to)
+			})
+		}
+		return srv.retrieveFrom(from, to, user, filters, summaries)
+	}
+
+	result := models.NewCumulativeSummary(from, to)
+	for _, day := range utils.SplitRangeByDays(from, to) {
+		summary, err := srv.Aliased(day[0], day[1], user, retrieve, filters, false)
+		if err != nil {
+			return nil, err
+		}
+		result.Add(day[0], summary.TotalTime())
+	}
+	return result, nil
+}
+
+// Rollup summarizes every calendar month or year (depending on the granularity) between from and to, split in from's time zone.
+// Each period is retrieved just like any other aliased summary, i.e. mostly from persisted daily summaries, and cached on its own, so that subsequent requests for overlapping ranges are cheap.
+func (srv *SummaryService) Rollup(from, to time.Time, user *models.User, filters *models.Filters, granularity string) ([]*models.SummaryRollup, error) {
+	periods := utils.SplitRangeByMonths(from, to)
+	if granularity == models.RollupYear {
+		periods = utils.SplitRangeByYears(from, to)
+	}
+
+	rollups := make([]*models.SummaryRollup, len(periods))
+	for i, period := range periods {
+		summary, err := srv.Aliased(period[0], period[1], user, srv.Retrieve, filters, false)
+		if err != nil {
+			return nil, err
+		}
+		rollups[i] = models.NewSummaryRollup(granularity, period[0], period[1], summary)
+	}
+	return rollups, nil
+}
+
+// retrieveFrom merges the given persisted summaries and computes all parts of the interval not covered by them
+func (srv *SummaryService) retrieveFrom(from, to time.Time, user *models.User, filters *models.Filters, summaries []*models.Summary) (*models.Summary, error) {
 	// Generate missing slots (especially before and after existing summaries) from durations (formerly raw heartbeats)
 	missingIntervals := srv.getMissingIntervals(from, to, summaries, false)
 	for _, interval := range missingIntervals {
@@ -158,10 +230,15 @@ func (srv *SummaryService) Summarize(from, to time.Time, user *models.User, filt
 		types = append(types, models.SummaryBranch)
 		types = append(types, models.SummaryEntity)
 	}
+	types = filters.SelectedTypes(types) // skip aggregations for types not asked for
 
 	typedAggregations := make(chan models.SummaryItemContainer)
 	defer close(typedAggregations)
 	for _, t := range types {
+		if t == models.SummaryBranch && filters != nil && filters.DominantBranch {
+			go srv.aggregateBy(durations.WithDominantBranches(user.HeartbeatsTimeout()), t, typedAggregations)
+			continue
+		}
 		go srv.aggregateBy(durations, t, typedAggregations)
 	}
 
@@ -220,12 +297,102 @@ func (srv *SummaryService) Summarize(from, to time.Time, user *models.User, filt
 	return summary.Sorted(), nil
 }
 
+// SummarizeComponents breaks down the time spent within the filtered project(s) by components, as derived from the paths of the entities worked on according to the given rules.
+// Time spent on entities not matched by any rule is attributed to the "unknown" component.
+func (srv *SummaryService) SummarizeComponents(from, to time.Time, user *models.User, filters *models.Filters, rules []*models.ProjectComponentRule) (models.SummaryItems, error) {
+	if filters != nil {
+		filters = filters.WithAliases(srv.getAliasReverseResolver(user))
+		filters = filters.WithProjectLabels(srv.getProjectLabelsReverseResolver(user))
+	}
+
+	// durations are split up by entity, as components are derived from the entities' paths
+	durations, err := srv.durationService.GetWithEntities(from, to, user, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[string]time.Duration)
+	for _, d := range durations {
+		component := models.ResolveProjectComponent(rules, d.Entity)
+		if component == "" {
+			component = models.UnknownSummaryKey
+		}
+		mapping[component] += d.Duration
+	}
+
+	items := make(models.SummaryItems, 0, len(mapping))
+	for k, v := range mapping {
+		items = append(items, &models.SummaryItem{Key: k, Total: v / time.Second})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Total > items[j].Total
+	})
+
+	return items, nil
+}
+
+// SummarizeBranchesAcrossProjects groups the time spent on the given projects by branch name only, so that equally named branches of different projects add up.
+// Durations are computed along the user's single timeline before being filtered by project, so parallel activity in multiple projects is never counted twice.
+// Unknown branches are left out, as these would collide across all projects.
+func (srv *SummaryService) SummarizeBranchesAcrossProjects(from, to time.Time, user *models.User, filters *models.Filters, projects []string) ([]*models.BranchAcrossProjects, error) {
+	var copied models.Filters
+	if filters != nil {
+		copied = *filters
+	}
+	copied.Project = nil
+	filters = copied.WithMultiple(models.SummaryProject, projects).WithAliases(srv.getAliasReverseResolver(user))
+
+	durations, err := srv.durationService.Get(from, to, user, filters)
+	if err != nil {
+		return nil, err
+	}
+	if filters.DominantBranch {
+		durations = durations.WithDominantBranches(user.HeartbeatsTimeout())
+	}
+
+	resolveAliases := srv.getAliasResolver(user)
+	mapping := make(map[string]map[string]time.Duration)
+	for _, d := range durations {
+		if srv.config.App.IsUnknownBranch(d.Branch) {
+			continue
+		}
+		if _, ok := mapping[d.Branch]; !ok {
+			mapping[d.Branch] = make(map[string]time.Duration)
+		}
+		mapping[d.Branch][resolveAliases(models.SummaryProject, d.Project)] += d.Duration
+	}
+
+	result := make([]*models.BranchAcrossProjects, 0, len(mapping))
+	for branch, byProject := range mapping {
+		item := &models.BranchAcrossProjects{Branch: branch, Projects: make(models.SummaryItems, 0, len(byProject))}
+		for project, total := range byProject {
+			item.Total += total
+			item.Projects = append(item.Projects, &models.SummaryItem{Key: project, Total: total / time.Second})
+		}
+		item.Total /= time.Second
+		sort.Slice(item.Projects, func(i, j int) bool {
+			return item.Projects[i].Total > item.Projects[j].Total || (item.Projects[i].Total == item.Projects[j].Total && item.Projects[i].Key < item.Projects[j].Key)
+		})
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Total > result[j].Total || (result[i].Total == result[j].Total && result[i].Branch < result[j].Branch)
+	})
+
+	return result, nil
+}
+
 // CRUD methods
 
 func (srv *SummaryService) GetLatestByUser() ([]*models.TimeByUser, error) {
 	return srv.repository.GetLastByUser()
 }
 
+// GetByUserWithin returns the user's persisted summaries within the given interval, without aliases or labels applied
+func (srv *SummaryService) GetByUserWithin(user *models.User, from, to time.Time) ([]*models.Summary, error) {
+	return srv.repository.GetByUserWithin(user, from, to)
+}
+
 func (srv *SummaryService) DeleteByUser(userId string) error {
 	srv.invalidateUserCache(userId)
 	return srv.repository.DeleteByUser(userId)
@@ -236,6 +403,23 @@ func (srv *SummaryService) DeleteByUserBefore(userId string, t time.Time) error
 	return srv.repository.DeleteByUserBefore(userId, t)
 }
 
+func (srv *SummaryService) DeleteByUserWithin(userId string, from, to time.Time) error {
+	srv.invalidateUserCache(userId)
+	return srv.repository.DeleteByUserWithin(userId, from, to)
+}
+
+// FlushCache drops all cached summaries of the given user and returns the number of removed entries
+func (srv *SummaryService) FlushCache(userId string) int {
+	return srv.invalidateUserCache(userId)
+}
+
+// FlushAllCaches drops all cached summaries of all users and returns the number of removed entries
+func (srv *SummaryService) FlushAllCaches() int {
+	n := srv.cache.ItemCount()
+	srv.cache.Flush()
+	return n
+}
+
 func (srv *SummaryService) Insert(summary *models.Summary) error {
 	srv.invalidateUserCache(summary.UserID)
 	return srv.repository.Insert(summary)
@@ -462,16 +646,29 @@ func (srv *SummaryService) getMissingIntervals(from, to time.Time, summaries []*
 	return intervals
 }
 
+// Filtered summaries are not persisted currently
+// Special case: if (a) filters apply to only one entity type and (b) we're only interested in the summary items of that particular entity type,
+// we can still fetch the persisted summary and drop all irrelevant parts from it
+func usesPersistedSummaries(filters *models.Filters) bool {
+	if filters != nil && filters.WriteOnly {
+		return false // summaries are persisted for all heartbeats only
+	}
+	return filters == nil || filters.IsEmpty() || (filters.CountDistinctTypes() == 1 && filters.SelectFilteredOnly)
+}
+
 func (srv *SummaryService) getHash(args ...string) string {
 	return strings.Join(args, "__")
 }
 
-func (srv *SummaryService) invalidateUserCache(userId string) {
+func (srv *SummaryService) invalidateUserCache(userId string) (n int) {
 	for key := range srv.cache.Items() {
-		if strings.Contains(key, userId) {
+		// match user id segment exactly, otherwise flushing user "bob" would also flush "bobby"'s entries
+		if strings.Contains(key, "__"+userId+"__") {
 			srv.cache.Delete(key)
+			n++
 		}
 	}
+	return n
 }
 
 func (srv *SummaryService) getAliasResolver(user *models.User) models.AliasResolver {
@@ -463,6 +463,101 @@ func (suite *SummaryServiceTestSuite) TestSummaryService_Aliased_ProjectLabels()
 	assert.Equal(suite.T(), 6, result.NumHeartbeats)
 }
 
+func (suite *SummaryServiceTestSuite) TestSummaryService_Cumulative() {
+	sut := NewSummaryService(suite.SummaryRepository, suite.HeartbeatService, suite.DurationService, suite.AliasService, suite.ProjectLabelService)
+
+	day := time.Date(suite.TestStartTime.Year(), suite.TestStartTime.Month(), suite.TestStartTime.Day(), 0, 0, 0, 0, suite.TestStartTime.Location())
+	from, to := day, day.AddDate(0, 0, 3)
+
+	newDailySummary := func(date time.Time, total time.Duration) *models.Summary {
+		return &models.Summary{
+			ID:       uint(rand.Uint32()),
+			UserID:   TestUserId,
+			FromTime: models.CustomTime(date),
+			ToTime:   models.CustomTime(date.AddDate(0, 0, 1)),
+			Projects: []*models.SummaryItem{
+				{
+					Type:  models.SummaryProject,
+					Key:   TestProject1,
+					Total: total / time.Second, // hack
+				},
+			},
+			Languages:        []*models.SummaryItem{},
+			Editors:          []*models.SummaryItem{},
+			OperatingSystems: []*models.SummaryItem{},
+			Machines:         []*models.SummaryItem{},
+		}
+	}
+
+	// no summary on the second day
+	summaries := []*models.Summary{
+		newDailySummary(day, 45*time.Minute),
+		newDailySummary(day.AddDate(0, 0, 2), 30*time.Minute),
+	}
+
+	suite.SummaryRepository.On("GetByUserWithin", suite.TestUser, from, to).Return(summaries, nil)
+	suite.DurationService.On("Get", mock.Anything, mock.Anything, suite.TestUser, mock.Anything).Return(models.Durations{}, nil)
+	suite.AliasService.On("InitializeUser", TestUserId).Return(nil)
+	suite.AliasService.On("GetAliasOrDefault", TestUserId, mock.Anything, mock.Anything).Return("", nil)
+	suite.ProjectLabelService.On("GetByUser", suite.TestUser.ID).Return([]*models.ProjectLabel{}, nil)
+
+	result, err := sut.Cumulative(from, to, suite.TestUser, nil)
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), result.Days, 3)
+	assert.Equal(suite.T(), day.AddDate(0, 0, 1), result.Days[1].Date)
+	assert.Equal(suite.T(), []time.Duration{45 * time.Minute, 0, 30 * time.Minute}, []time.Duration{result.Days[0].Total, result.Days[1].Total, result.Days[2].Total})
+	assert.Equal(suite.T(), []time.Duration{45 * time.Minute, 45 * time.Minute, 75 * time.Minute}, []time.Duration{result.Days[0].Cumulative, result.Days[1].Cumulative, result.Days[2].Cumulative})
+	assert.Equal(suite.T(), 75*time.Minute, result.TotalTime())
+	suite.SummaryRepository.AssertNumberOfCalls(suite.T(), "GetByUserWithin", 1)
+}
+
+func (suite *SummaryServiceTestSuite) TestSummaryService_Rollup() {
+	sut := NewSummaryService(suite.SummaryRepository, suite.HeartbeatService, suite.DurationService, suite.AliasService, suite.ProjectLabelService)
+
+	tz := suite.TestStartTime.Location()
+	from, to := time.Date(2023, 12, 20, 0, 0, 0, 0, tz), time.Date(2024, 2, 10, 0, 0, 0, 0, tz)
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, tz)
+	feb := time.Date(2024, 2, 1, 0, 0, 0, 0, tz)
+
+	summary := &models.Summary{
+		ID:       uint(rand.Uint32()),
+		UserID:   TestUserId,
+		FromTime: models.CustomTime(jan),
+		ToTime:   models.CustomTime(jan.AddDate(0, 0, 1)),
+		Projects: []*models.SummaryItem{
+			{Type: models.SummaryProject, Key: TestProject1, Total: (90 * time.Minute) / time.Second}, // hack
+		},
+		Languages:        []*models.SummaryItem{},
+		Editors:          []*models.SummaryItem{},
+		OperatingSystems: []*models.SummaryItem{},
+		Machines:         []*models.SummaryItem{},
+	}
+
+	suite.SummaryRepository.On("GetByUserWithin", suite.TestUser, from, jan).Return([]*models.Summary{}, nil)
+	suite.SummaryRepository.On("GetByUserWithin", suite.TestUser, jan, feb).Return([]*models.Summary{summary}, nil)
+	suite.SummaryRepository.On("GetByUserWithin", suite.TestUser, feb, to).Return([]*models.Summary{}, nil)
+	suite.DurationService.On("Get", mock.Anything, mock.Anything, suite.TestUser, mock.Anything).Return(models.Durations{}, nil)
+	suite.AliasService.On("InitializeUser", TestUserId).Return(nil)
+	suite.AliasService.On("GetAliasOrDefault", TestUserId, mock.Anything, mock.Anything).Return("", nil)
+	suite.ProjectLabelService.On("GetByUser", suite.TestUser.ID).Return([]*models.ProjectLabel{}, nil)
+
+	result, err := sut.Rollup(from, to, suite.TestUser, nil, models.RollupMonth)
+
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), result, 3)
+	assert.Equal(suite.T(), []string{"2023-12", "2024-01", "2024-02"}, []string{result[0].Period, result[1].Period, result[2].Period})
+	assert.Equal(suite.T(), []int64{0, 5400, 0}, []int64{result[0].Total, result[1].Total, result[2].Total})
+	assert.Len(suite.T(), result[1].Projects, 1)
+	assert.Equal(suite.T(), from, result[0].From.T())
+	assert.Equal(suite.T(), to, result[2].To.T())
+
+	// served from cache the second time
+	_, err = sut.Rollup(from, to, suite.TestUser, nil, models.RollupMonth)
+	assert.Nil(suite.T(), err)
+	suite.SummaryRepository.AssertNumberOfCalls(suite.T(), "GetByUserWithin", 3)
+}
+
 func (suite *SummaryServiceTestSuite) TestSummaryService_Filters() {
 	sut := NewSummaryService(suite.SummaryRepository, suite.HeartbeatService, suite.DurationService, suite.AliasService, suite.ProjectLabelService)
 
@@ -570,3 +665,82 @@ func assertNumAllItems(t *testing.T, expected int, summary *models.Summary, exce
 		assert.Len(t, summary.Machines, expected)
 	}
 }
+
+func (suite *SummaryServiceTestSuite) TestSummaryService_FlushCache() {
+	sut := NewSummaryService(suite.SummaryRepository, suite.HeartbeatService, suite.DurationService, suite.AliasService, suite.ProjectLabelService)
+
+	from, to := suite.TestStartTime.Add(-1*time.Hour), suite.TestStartTime
+	sut.cache.SetDefault(sut.getHash(from.String(), to.String(), "bob", "", "--aliased"), &models.Summary{})
+	sut.cache.SetDefault(sut.getHash(from.String(), to.String(), "bobby", "", "--aliased"), &models.Summary{})
+	sut.cache.SetDefault(sut.getHash(from.String(), to.String(), "alice", "", "--aliased"), &models.Summary{})
+
+	assert.Equal(suite.T(), 1, sut.FlushCache("bob"))
+	assert.Equal(suite.T(), 2, sut.cache.ItemCount())
+	assert.Equal(suite.T(), 0, sut.FlushCache("bob"))
+	assert.Equal(suite.T(), 2, sut.FlushAllCaches())
+	assert.Equal(suite.T(), 0, sut.cache.ItemCount())
+}
+
+func (suite *SummaryServiceTestSuite) TestSummaryService_SummarizeComponents() {
+	sut := NewSummaryService(suite.SummaryRepository, suite.HeartbeatService, suite.DurationService, suite.AliasService, suite.ProjectLabelService)
+
+	from, to := suite.TestStartTime, suite.TestStartTime.Add(1*time.Hour)
+	durations := models.Durations{
+		{UserID: TestUserId, Project: "monorepo", Entity: "/home/john/dev/monorepo/services/api/main.go", Duration: 120 * time.Second},
+		{UserID: TestUserId, Project: "monorepo", Entity: "/home/john/dev/monorepo/services/api/v2/routes.go", Duration: 60 * time.Second},
+		{UserID: TestUserId, Project: "monorepo", Entity: "/home/john/dev/monorepo/services/api/README.md", Duration: 30 * time.Second},
+		{UserID: TestUserId, Project: "monorepo", Entity: "C:\\dev\\monorepo\\web\\index.ts", Duration: 90 * time.Second},
+		{UserID: TestUserId, Project: "monorepo", Entity: "/home/john/dev/monorepo/go.mod", Duration: 10 * time.Second},
+	}
+	rules := []*models.ProjectComponentRule{
+		{UserID: TestUserId, Project: "monorepo", PathPrefix: "services/api", Label: "api"},
+		{UserID: TestUserId, Project: "monorepo", PathPrefix: "/services/api/v2/", Label: "api-v2"},
+		{UserID: TestUserId, Project: "monorepo", PathPrefix: "web", Label: "frontend"},
+	}
+
+	suite.AliasService.On("GetByUserAndKeyAndType", TestUserId, "monorepo", models.SummaryProject).Return([]*models.Alias{}, nil)
+	suite.HeartbeatService.On("GetEntitySetByUser", models.SummaryProject, TestUserId).Return([]string{"monorepo"}, nil)
+	suite.ProjectLabelService.On("GetByUserGroupedInverted", TestUserId).Return(map[string][]*models.ProjectLabel{}, nil)
+	suite.DurationService.On("GetWithEntities", from, to, suite.TestUser, mock.Anything).Return(durations, nil)
+
+	result, err := sut.SummarizeComponents(from, to, suite.TestUser, models.NewFiltersWith(models.SummaryProject, "monorepo"), rules)
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), models.SummaryItems{
+		{Key: "api", Total: 150},
+		{Key: "frontend", Total: 90},
+		{Key: "api-v2", Total: 60},
+		{Key: models.UnknownSummaryKey, Total: 10},
+	}, result)
+}
+
+func (suite *SummaryServiceTestSuite) TestSummaryService_SummarizeBranchesAcrossProjects() {
+	sut := NewSummaryService(suite.SummaryRepository, suite.HeartbeatService, suite.DurationService, suite.AliasService, suite.ProjectLabelService)
+
+	from, to := suite.TestStartTime, suite.TestStartTime.Add(1*time.Hour)
+	durations := models.Durations{
+		{UserID: TestUserId, Project: "backend", Branch: "feature/login", Duration: 120 * time.Second},
+		{UserID: TestUserId, Project: "frontend", Branch: "feature/login", Duration: 90 * time.Second},
+		{UserID: TestUserId, Project: "backend", Branch: "main", Duration: 30 * time.Second},
+		{UserID: TestUserId, Project: "frontend", Branch: "", Duration: 60 * time.Second}, // unknown, left out
+		{UserID: TestUserId, Project: "frontend", Branch: "feature/login", Duration: 30 * time.Second},
+	}
+
+	suite.AliasService.On("GetByUserAndKeyAndType", TestUserId, mock.Anything, models.SummaryProject).Return([]*models.Alias{}, nil)
+	suite.HeartbeatService.On("GetEntitySetByUser", models.SummaryProject, TestUserId).Return([]string{"backend", "frontend"}, nil)
+	suite.AliasService.On("GetAliasOrDefault", TestUserId, models.SummaryProject, "backend").Return("backend", nil)
+	suite.AliasService.On("GetAliasOrDefault", TestUserId, models.SummaryProject, "frontend").Return("frontend", nil)
+	suite.DurationService.On("Get", from, to, suite.TestUser, mock.MatchedBy(func(f *models.Filters) bool {
+		return len(f.Project) == 2 && f.Project.MatchAny("backend") && f.Project.MatchAny("frontend")
+	})).Return(durations, nil)
+
+	filters := models.NewFiltersWith(models.SummaryProject, "other")
+	result, err := sut.SummarizeBranchesAcrossProjects(from, to, suite.TestUser, filters, []string{"backend", "frontend"})
+
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []*models.BranchAcrossProjects{
+		{Branch: "feature/login", Total: 240, Projects: models.SummaryItems{{Key: "backend", Total: 120}, {Key: "frontend", Total: 120}}},
+		{Branch: "main", Total: 30, Projects: models.SummaryItems{{Key: "backend", Total: 30}}},
+	}, result)
+	assert.Equal(suite.T(), models.OrFilter{"other"}, filters.Project) // caller's filters untouched
+}
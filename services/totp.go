@@ -0,0 +1,232 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+)
+
+const (
+	totpIssuer         = "Wakapi"
+	numRecoveryCodes   = 10
+	recoveryCodeLength = 11 // xxxxx-xxxxx
+)
+
+var (
+	ErrTotpNotSetUp       = errors.New("two-factor authentication is not set up")
+	ErrTotpAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTotpInvalidCode    = errors.New("invalid two-factor authentication code")
+	ErrTotpNotEnabled     = errors.New("two-factor authentication is not enabled")
+)
+
+type TotpService struct {
+	config      *config.Config
+	userService IUserService
+	lock        sync.Mutex // serializes code verification to make replay checks atomic
+}
+
+func NewTotpService(userService IUserService) *TotpService {
+	return &TotpService{
+		config:      config.Get(),
+		userService: userService,
+	}
+}
+
+// Setup generates a new secret for the user, which only becomes effective after being confirmed through Enable
+func (srv *TotpService) Setup(user *models.User) (string, string, error) {
+	if user.TotpEnabled {
+		return "", "", ErrTotpAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	encrypted, err := utils.Encrypt(secret, srv.config.Security.GetSecretsKey())
+	if err != nil {
+		return "", "", err
+	}
+
+	user.TotpSecret = encrypted
+	user.TotpLastStep = 0
+	if _, err := srv.userService.Update(user); err != nil {
+		return "", "", err
+	}
+
+	return secret, utils.TotpProvisioningUri(totpIssuer, user.ID, secret), nil
+}
+
+// Enable turns on two-factor authentication, given a valid code for the previously set up secret, and returns a fresh set of recovery codes
+func (srv *TotpService) Enable(user *models.User, code string) ([]string, error) {
+	if user.TotpEnabled {
+		return nil, ErrTotpAlreadyEnabled
+	}
+	if user.TotpSecret == "" {
+		return nil, ErrTotpNotSetUp
+	}
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	ok, err := srv.checkTotp(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTotpInvalidCode
+	}
+
+	codes, err := srv.resetRecoveryCodes(user)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TotpEnabled = true
+	if _, err := srv.userService.Update(user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns off two-factor authentication, given a valid code or recovery code
+func (srv *TotpService) Disable(user *models.User, code string) error {
+	if !user.TotpEnabled {
+		return ErrTotpNotEnabled
+	}
+
+	ok, err := srv.Verify(user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTotpInvalidCode
+	}
+
+	user.TotpEnabled = false
+	user.TotpSecret = ""
+	user.TotpRecoveryCodes = ""
+	user.TotpLastStep = 0
+	_, err = srv.userService.Update(user)
+	return err
+}
+
+// RegenerateRecoveryCodes invalidates all previous recovery codes, given a valid code
+func (srv *TotpService) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if !user.TotpEnabled {
+		return nil, ErrTotpNotEnabled
+	}
+
+	ok, err := srv.Verify(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTotpInvalidCode
+	}
+
+	codes, err := srv.resetRecoveryCodes(user)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := srv.userService.Update(user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks either a time-based code or a recovery code. Time-based codes are only accepted once, recovery codes get used up.
+func (srv *TotpService) Verify(user *models.User, code string) (bool, error) {
+	if !user.TotpEnabled {
+		return false, ErrTotpNotEnabled
+	}
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	code = strings.ToLower(strings.TrimSpace(code))
+	if len(code) == recoveryCodeLength {
+		return srv.useRecoveryCode(user, code)
+	}
+
+	ok, err := srv.checkTotp(user, code)
+	if err != nil || !ok {
+		return false, err
+	}
+	if _, err := srv.userService.Update(user); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// requires lock to be held, updates TotpLastStep in place
+func (srv *TotpService) checkTotp(user *models.User, code string) (bool, error) {
+	secret, err := utils.Decrypt(user.TotpSecret, srv.config.Security.GetSecretsKey())
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := utils.ValidateTotp(secret, code, time.Now())
+	if !ok || step <= user.TotpLastStep {
+		return false, nil
+	}
+
+	user.TotpLastStep = step
+	return true, nil
+}
+
+// requires lock to be held
+func (srv *TotpService) useRecoveryCode(user *models.User, code string) (bool, error) {
+	hashed := []byte(srv.hashRecoveryCode(code))
+
+	var found bool
+	remaining := make([]string, 0, numRecoveryCodes)
+	for _, h := range strings.Split(user.TotpRecoveryCodes, ",") {
+		if h == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(h), hashed) == 1 {
+			found = true
+			continue
+		}
+		remaining = append(remaining, h)
+	}
+
+	if !found {
+		return false, nil
+	}
+
+	user.TotpRecoveryCodes = strings.Join(remaining, ",")
+	if _, err := srv.userService.Update(user); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (srv *TotpService) resetRecoveryCodes(user *models.User) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(numRecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = srv.hashRecoveryCode(c)
+	}
+	user.TotpRecoveryCodes = strings.Join(hashes, ",")
+
+	return codes, nil
+}
+
+func (srv *TotpService) hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code + srv.config.Security.PasswordSalt))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type TotpServiceTestSuite struct {
+	suite.Suite
+	TestUser    *models.User
+	UserService *mocks.UserServiceMock
+}
+
+func (suite *TotpServiceTestSuite) BeforeTest(suiteName, testName string) {
+	cfg := config.Empty()
+	cfg.Security.PasswordSalt = "testsalt"
+	config.Set(cfg)
+
+	suite.TestUser = &models.User{ID: "testuser01"}
+	suite.UserService = new(mocks.UserServiceMock)
+	suite.UserService.On("Update", mock.Anything).Return(suite.TestUser, nil)
+}
+
+func TestTotpServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(TotpServiceTestSuite))
+}
+
+func (suite *TotpServiceTestSuite) TestTotpService_EnableAndVerify() {
+	sut := NewTotpService(suite.UserService)
+
+	secret, uri, err := sut.Setup(suite.TestUser)
+	assert.Nil(suite.T(), err)
+	assert.Contains(suite.T(), uri, secret)
+	assert.NotEqual(suite.T(), secret, suite.TestUser.TotpSecret) // stored encrypted
+	assert.False(suite.T(), suite.TestUser.TotpEnabled)
+
+	_, err = sut.Enable(suite.TestUser, "000000")
+	assert.ErrorIs(suite.T(), err, ErrTotpInvalidCode)
+
+	step := utils.TotpStep(time.Now())
+	codes, err := sut.Enable(suite.TestUser, suite.code(secret, step))
+	assert.Nil(suite.T(), err)
+	assert.Len(suite.T(), codes, numRecoveryCodes)
+	assert.True(suite.T(), suite.TestUser.TotpEnabled)
+
+	// same code must not be accepted twice
+	ok, err := sut.Verify(suite.TestUser, suite.code(secret, step))
+	assert.Nil(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	ok, err = sut.Verify(suite.TestUser, suite.code(secret, step+1))
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), ok)
+}
+
+func (suite *TotpServiceTestSuite) TestTotpService_RecoveryCodes() {
+	sut := NewTotpService(suite.UserService)
+
+	secret, _, _ := sut.Setup(suite.TestUser)
+	codes, err := sut.Enable(suite.TestUser, suite.code(secret, utils.TotpStep(time.Now())))
+	assert.Nil(suite.T(), err)
+
+	ok, err := sut.Verify(suite.TestUser, codes[0])
+	assert.Nil(suite.T(), err)
+	assert.True(suite.T(), ok)
+
+	// recovery codes are single-use
+	ok, err = sut.Verify(suite.TestUser, codes[0])
+	assert.Nil(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	assert.Nil(suite.T(), sut.Disable(suite.TestUser, codes[1]))
+	assert.False(suite.T(), suite.TestUser.TotpEnabled)
+	assert.Empty(suite.T(), suite.TestUser.TotpSecret)
+}
+
+func (suite *TotpServiceTestSuite) code(secret string, step int64) string {
+	code, err := utils.TotpCode(secret, step)
+	assert.Nil(suite.T(), err)
+	return code
+}
@@ -1,6 +1,9 @@
 package services
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/duke-git/lancet/v2/convertor"
@@ -13,24 +16,53 @@ import (
 	"github.com/muety/wakapi/utils"
 	"github.com/patrickmn/go-cache"
 	"log/slog"
+	"sync"
 	"time"
 )
 
+const (
+	// number of consecutive requests, which have to report the same time zone, before it's assigned to a user
+	locationInferenceMinRequests = 3
+	// candidates not confirmed within this time are forgotten, so that only a consistently reported time zone is assigned
+	locationInferenceExpiry = 24 * time.Hour
+	// min. time between two updates of a user's last plugin, e.g. to not write on every request when alternating between editors
+	lastPluginUpdateInterval = 1 * time.Hour
+)
+
+var ErrInvalidApiKey = errors.New("api key is not a valid uuid")
+
+// user names are unique case-insensitively, as users are identified by their name (e.g. when logging in) and "Bob" and "bob" would be confused easily
+var ErrUsernameTaken = errors.New("username already taken")
+
+var ErrSessionNotFound = errors.New("session not found")
+
 type UserService struct {
-	config      *config.Config
-	cache       *cache.Cache
-	eventBus    *hub.Hub
-	mailService IMailService
-	repository  repositories.IUserRepository
+	config            *config.Config
+	cache             *cache.Cache
+	eventBus          *hub.Hub
+	mailService       IMailService
+	repository        repositories.IUserRepository
+	sessionRepository repositories.IUserSessionRepository
+	locations         *cache.Cache // time zones reported for users without one, see InferLocation
+	locationsLock     sync.Mutex
+	lastPluginUpdates *cache.Cache // users whose last plugin was updated recently, see SetLastPlugin
 }
 
-func NewUserService(mailService IMailService, userRepo repositories.IUserRepository) *UserService {
+type locationCandidate struct {
+	location string
+	count    int
+}
+
+func NewUserService(mailService IMailService, userRepo repositories.IUserRepository, sessionRepo repositories.IUserSessionRepository) *UserService {
 	srv := &UserService{
-		config:      config.Get(),
-		eventBus:    config.EventBus(),
-		cache:       cache.New(1*time.Hour, 2*time.Hour),
-		mailService: mailService,
-		repository:  userRepo,
+		config:            config.Get(),
+		eventBus:          config.EventBus(),
+		cache:             cache.New(1*time.Hour, 2*time.Hour),
+		mailService:       mailService,
+		repository:        userRepo,
+		sessionRepository: sessionRepo,
+		locations:         cache.New(locationInferenceExpiry, locationInferenceExpiry),
+		lastPluginUpdates: cache.New(lastPluginUpdateInterval, lastPluginUpdateInterval),
 	}
 
 	sub1 := srv.eventBus.Subscribe(0, config.EventWakatimeFailure)
@@ -55,6 +87,24 @@ func NewUserService(mailService IMailService, userRepo repositories.IUserReposit
 		}
 	}(&sub1)
 
+	sub2 := srv.eventBus.Subscribe(0, config.EventHeartbeatQuota)
+	go func(sub *hub.Subscription) {
+		for m := range sub.Receiver {
+			user := m.Fields[config.FieldUser].(*models.User)
+			quota := m.Fields[config.FieldPayload].(int64)
+
+			slog.Warn("user reached heartbeat quota", "userID", user.ID, "quota", quota)
+
+			if user.Email != "" {
+				if err := mailService.SendHeartbeatQuotaNotification(user, quota); err != nil {
+					config.Log().Error("failed to send heartbeat quota notification mail to user", "userID", user.ID, "error", err)
+				} else {
+					slog.Info("sent heartbeat quota mail", "userID", user.ID)
+				}
+			}
+		}
+	}(&sub2)
+
 	return srv
 }
 
@@ -81,10 +131,7 @@ func (srv *UserService) GetUserByKey(key string) (*models.User, error) {
 		return nil, errors.New("key must not be empty")
 	}
 
-	if u, ok := srv.cache.Get(key); ok {
-		return u.(*models.User), nil
-	}
-
+	// deliberately not looked up from cache, so that rotated keys stop working right away, also on other instances
 	u, err := srv.repository.FindOne(models.User{ApiKey: key})
 	if err != nil {
 		return nil, err
@@ -94,6 +141,15 @@ func (srv *UserService) GetUserByKey(key string) (*models.User, error) {
 	return u, nil
 }
 
+// GetUserByMetricsToken returns the user the token was generated for, which is only to be used for scraping the user's personal metrics
+func (srv *UserService) GetUserByMetricsToken(token string) (*models.User, error) {
+	if token == "" {
+		return nil, errors.New("token must not be empty")
+	}
+	// not looked up from cache for the same reason as api keys are not
+	return srv.repository.FindOne(models.User{MetricsToken: token})
+}
+
 func (srv *UserService) GetUserByEmail(email string) (*models.User, error) {
 	if email == "" {
 		return nil, errors.New("email must not be empty")
@@ -143,10 +199,19 @@ func (srv *UserService) GetAllByReports(reportsEnabled bool) ([]*models.User, er
 	return srv.repository.GetAllByReports(reportsEnabled)
 }
 
+// GetAllDeletionDue returns all users pending deletion, whose grace period has passed
+func (srv *UserService) GetAllDeletionDue() ([]*models.User, error) {
+	return srv.repository.GetBySoftDeletedBefore(time.Now().AddDate(0, 0, -srv.config.App.AccountDeletionGraceDays))
+}
+
 func (srv *UserService) GetAllByLeaderboard(leaderboardEnabled bool) ([]*models.User, error) {
 	return srv.repository.GetAllByLeaderboard(leaderboardEnabled)
 }
 
+func (srv *UserService) GetByOrg(orgId string) ([]*models.User, error) {
+	return srv.repository.GetByOrg(orgId)
+}
+
 func (srv *UserService) GetActive(exact bool) ([]*models.User, error) {
 	minDate := time.Now().AddDate(0, 0, -1*srv.config.App.InactiveDays)
 	if !exact {
@@ -167,11 +232,20 @@ func (srv *UserService) GetActive(exact bool) ([]*models.User, error) {
 	return results, nil
 }
 
+func (srv *UserService) Query(query *models.UserQuery, pageParams *utils.PageParams) ([]*models.UserWithActivity, int64, error) {
+	return srv.repository.Query(query, pageParams)
+}
+
 func (srv *UserService) Count() (int64, error) {
 	return srv.repository.Count()
 }
 
+// CreateOrGet creates a new user from the given signup or returns the existing one with exactly the same name, fails with ErrUsernameTaken if a user differing only by case exists
 func (srv *UserService) CreateOrGet(signup *models.Signup, isAdmin bool) (*models.User, bool, error) {
+	if existing, err := srv.repository.FindOneIgnoreCase(signup.Username); err == nil && existing.ID != signup.Username {
+		return nil, false, ErrUsernameTaken
+	}
+
 	u := &models.User{
 		ID:        signup.Username,
 		ApiKey:    uuid.Must(uuid.NewV4()).String(),
@@ -181,8 +255,11 @@ func (srv *UserService) CreateOrGet(signup *models.Signup, isAdmin bool) (*model
 		IsAdmin:   isAdmin,
 		InvitedBy: signup.InvitedBy,
 	}
+	if signup.OrgID != "" {
+		u.OrgID = &signup.OrgID
+	}
 
-	if hash, err := utils.HashPassword(u.Password, srv.config.Security.PasswordSalt); err != nil {
+	if hash, err := utils.HashPassword(u.Password, srv.config.Security.PasswordSalt, srv.config.Security.GetPasswordHashOptions()); err != nil {
 		return nil, false, err
 	} else {
 		u.Password = hash
@@ -191,16 +268,170 @@ func (srv *UserService) CreateOrGet(signup *models.Signup, isAdmin bool) (*model
 	return srv.repository.InsertOrGet(u)
 }
 
+// ProvisionByApiKey creates a new user with the given, yet unknown api key, e.g. for heartbeats sent from a trusted network.
+// The username is a keyed hash of the key, so it doesn't reveal any part of it, and the password is random, so the account is only accessible by its key until the password is reset.
+func (srv *UserService) ProvisionByApiKey(apiKey string) (*models.User, error) {
+	if key, err := uuid.FromString(apiKey); err != nil || key.String() != apiKey {
+		return nil, ErrInvalidApiKey
+	}
+
+	mac := hmac.New(sha256.New, srv.config.Security.GetSecretsKey())
+	mac.Write([]byte(apiKey))
+	username := "user-" + hex.EncodeToString(mac.Sum(nil))[:12]
+	if _, err := srv.repository.FindOneIgnoreCase(username); err == nil {
+		return nil, ErrUsernameTaken
+	}
+
+	hash, err := utils.HashPassword(uuid.Must(uuid.NewV4()).String(), srv.config.Security.PasswordSalt, srv.config.Security.GetPasswordHashOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	user, created, err := srv.repository.InsertOrGet(&models.User{
+		ID:       username,
+		ApiKey:   apiKey,
+		Password: hash,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrUsernameTaken
+	}
+	return user, nil
+}
+
 func (srv *UserService) Update(user *models.User) (*models.User, error) {
 	srv.FlushUserCache(user.ID)
 	srv.notifyUpdate(user)
 	return srv.repository.Update(user)
 }
 
+func (srv *UserService) UpdateOrgMembership(user *models.User) (*models.User, error) {
+	srv.FlushUserCache(user.ID)
+	srv.notifyUpdate(user)
+	u, err := srv.repository.UpdateOrgMembership(user)
+	if err == nil {
+		srv.notifyOrgUpdate(user)
+	}
+	return u, err
+}
+
+// UpgradePasswordHash re-hashes the user's (previously verified) plain password if the stored hash is weaker than currently configured
+func (srv *UserService) UpgradePasswordHash(user *models.User, plainPassword string) (bool, error) {
+	opts := srv.config.Security.GetPasswordHashOptions()
+	if !utils.PasswordNeedsRehash(user.Password, opts) {
+		return false, nil
+	}
+
+	hash, err := utils.HashPassword(plainPassword, srv.config.Security.PasswordSalt, opts)
+	if err != nil {
+		return false, err
+	}
+
+	srv.FlushUserCache(user.ID)
+	if err := srv.repository.UpdatePassword(user, user.Password, hash); err != nil {
+		return false, err
+	}
+	user.Password = hash
+
+	return true, nil
+}
+
+// ResetApiKey replaces the user's api key with a newly generated one, the previous key is invalid right away
 func (srv *UserService) ResetApiKey(user *models.User) (*models.User, error) {
 	srv.FlushUserCache(user.ID)
 	user.ApiKey = uuid.Must(uuid.NewV4()).String()
-	return srv.Update(user)
+	u, err := srv.Update(user)
+	if err == nil {
+		slog.Info("rotated api key for user", "userID", user.ID)
+	}
+	return u, err
+}
+
+// ResetMetricsToken generates a new token for the user to scrape their personal metrics with, the previous one is invalid right away
+func (srv *UserService) ResetMetricsToken(user *models.User) (*models.User, error) {
+	srv.FlushUserCache(user.ID)
+	token := uuid.Must(uuid.NewV4()).String()
+	u, err := srv.repository.UpdateField(user, "metrics_token", token)
+	if err == nil {
+		u.MetricsToken = token
+	}
+	return u, err
+}
+
+// RevokeMetricsToken invalidates the user's metrics token, if any
+func (srv *UserService) RevokeMetricsToken(user *models.User) (*models.User, error) {
+	if user.MetricsToken == "" {
+		return user, nil
+	}
+	srv.FlushUserCache(user.ID)
+	u, err := srv.repository.UpdateField(user, "metrics_token", nil) // null rather than empty, as tokens are unique
+	if err == nil {
+		u.MetricsToken = ""
+	}
+	return u, err
+}
+
+// InferLocation assigns the time zone reported by the user's client (e.g. wakatime-cli's time zone header) to them, if they haven't configured one yet.
+// To not be fooled by a single misconfigured machine, it's only assigned once reported by a number of consecutive requests and never changed afterwards, not even after the user unset it.
+// Returns whether the user's time zone was set.
+func (srv *UserService) InferLocation(user *models.User, location string) (bool, error) {
+	if user.HasLocation() || user.LocationFixed || location == "" || location == "Local" || !models.ValidateTimezone(location) {
+		return false, nil
+	}
+
+	srv.locationsLock.Lock()
+	candidate := &locationCandidate{location: location}
+	if cached, ok := srv.locations.Get(user.ID); ok && cached.(*locationCandidate).location == location {
+		candidate = cached.(*locationCandidate)
+	}
+	candidate.count++
+	confirmed := candidate.count >= locationInferenceMinRequests
+	if confirmed {
+		srv.locations.Delete(user.ID)
+	} else {
+		srv.locations.SetDefault(user.ID, candidate)
+	}
+	srv.locationsLock.Unlock()
+
+	if !confirmed {
+		return false, nil
+	}
+
+	srv.FlushUserCache(user.ID)
+	if _, err := srv.repository.UpdateField(user, "location", location); err != nil {
+		return false, err
+	}
+	if _, err := srv.repository.UpdateField(user, "location_fixed", true); err != nil {
+		return false, err
+	}
+	user.Location = location
+	user.LocationFixed = true
+
+	slog.Info("inferred time zone for user", "userID", user.ID, "location", location)
+	return true, nil
+}
+
+// SetLastPlugin records the plugin and version last used by the user, at most once per lastPluginUpdateInterval, and returns whether they were updated
+func (srv *UserService) SetLastPlugin(user *models.User, plugin, version string) (bool, error) {
+	if plugin == user.LastPlugin && version == user.LastPluginVersion {
+		return false, nil
+	}
+	if _, recent := srv.lastPluginUpdates.Get(user.ID); recent {
+		return false, nil
+	}
+	srv.lastPluginUpdates.SetDefault(user.ID, true)
+
+	srv.FlushUserCache(user.ID)
+	if _, err := srv.repository.UpdateField(user, "last_plugin", plugin); err != nil {
+		return false, err
+	}
+	if _, err := srv.repository.UpdateField(user, "last_plugin_version", version); err != nil {
+		return false, err
+	}
+	user.LastPlugin, user.LastPluginVersion = plugin, version
+	return true, nil
 }
 
 func (srv *UserService) SetWakatimeApiCredentials(user *models.User, apiKey string, apiUrl string) (*models.User, error) {
@@ -233,6 +464,23 @@ func (srv *UserService) Delete(user *models.User) error {
 	return srv.repository.Delete(user)
 }
 
+// SoftDelete marks the user for deletion, which disables their account and will cause it to be deleted permanently once the grace period has passed (see HousekeepingService).
+// Like upon deletion, weekly reports are disabled right away, while the update event removes the user from leaderboards.
+func (srv *UserService) SoftDelete(user *models.User) (*models.User, error) {
+	now := models.CustomTime(time.Now())
+	user.SoftDeletedAt = &now
+	user.ReportsWeekly = false
+	return srv.Update(user)
+}
+
+func (srv *UserService) Restore(user *models.User) (*models.User, error) {
+	if !user.IsSoftDeleted() {
+		return user, nil
+	}
+	user.SoftDeletedAt = nil
+	return srv.Update(user)
+}
+
 func (srv *UserService) MapUsersById(users []*models.User) map[string]*models.User {
 	return convertor.ToMap[*models.User, string, *models.User](users, func(u *models.User) (string, *models.User) {
 		return u.ID, u
@@ -243,6 +491,75 @@ func (srv *UserService) FlushCache() {
 	srv.cache.Flush()
 }
 
+// CreateSession persists a new login session of the user, whose id is to be included in the auth cookie, see models.Session
+func (srv *UserService) CreateSession(user *models.User, userAgent, ip string) (*models.UserSession, error) {
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	now := models.CustomTime(time.Now())
+	return srv.sessionRepository.Insert(&models.UserSession{
+		ID:         uuid.Must(uuid.NewV4()).String(),
+		UserID:     user.ID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		UserAgent:  userAgent,
+		IP:         ip,
+	})
+}
+
+// GetSession is not cached on purpose, so that revoking a session takes effect immediately across all instances
+func (srv *UserService) GetSession(id string) (*models.UserSession, error) {
+	return srv.sessionRepository.GetById(id)
+}
+
+func (srv *UserService) GetSessions(user *models.User) ([]*models.UserSession, error) {
+	return srv.sessionRepository.GetByUser(user.ID)
+}
+
+func (srv *UserService) TouchSession(session *models.UserSession) error {
+	session.LastSeenAt = models.CustomTime(time.Now())
+	return srv.sessionRepository.Touch(session)
+}
+
+func (srv *UserService) RevokeSession(user *models.User, id string) error {
+	n, err := srv.sessionRepository.Delete(user.ID, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	slog.Info("revoked session of user", "userID", user.ID)
+	return nil
+}
+
+// RevokeSessions revokes all of the user's sessions apart from the given one (empty to revoke all), including those issued before sessions were persisted
+func (srv *UserService) RevokeSessions(user *models.User, exceptId string) error {
+	if err := srv.sessionRepository.DeleteByUserExcept(user.ID, exceptId); err != nil {
+		return err
+	}
+	now := models.CustomTime(time.Now())
+	user.SessionsRevokedAt = &now
+	if _, err := srv.Update(user); err != nil {
+		return err
+	}
+	slog.Info("revoked sessions of user", "userID", user.ID, "keptCurrent", exceptId != "")
+	return nil
+}
+
+// DeleteStaleSessions deletes persisted sessions whose auth cookie has certainly expired, according to the cookie and session lifetimes
+func (srv *UserService) DeleteStaleSessions() error {
+	maxIdle := time.Duration(srv.config.Security.CookieMaxAgeSec) * time.Second
+	if idleTimeout := srv.config.Security.GetSessionIdleTimeout(); idleTimeout > 0 && idleTimeout < maxIdle {
+		maxIdle = idleTimeout
+	}
+	var createdBefore time.Time
+	if maxAge := srv.config.Security.GetSessionMaxAge(); maxAge > 0 {
+		createdBefore = time.Now().Add(-maxAge)
+	}
+	return srv.sessionRepository.DeleteStale(time.Now().Add(-maxIdle), createdBefore)
+}
+
 func (srv *UserService) FlushUserCache(userId string) {
 	srv.cache.Delete(userId)
 }
@@ -254,6 +571,13 @@ func (srv *UserService) notifyUpdate(user *models.User) {
 	})
 }
 
+func (srv *UserService) notifyOrgUpdate(user *models.User) {
+	srv.eventBus.Publish(hub.Message{
+		Name:   config.EventUserOrgUpdate,
+		Fields: map[string]interface{}{config.FieldPayload: user},
+	})
+}
+
 func (srv *UserService) notifyDelete(user *models.User) {
 	srv.eventBus.Publish(hub.Message{
 		Name:   config.EventUserDelete,
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUserService_InferLocation(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01"}
+
+	userRepoMock := new(mocks.UserRepositoryMock)
+	userRepoMock.On("UpdateField", user, "location", "Europe/Berlin").Return(user, nil)
+	userRepoMock.On("UpdateField", user, "location_fixed", true).Return(user, nil)
+
+	sut := NewUserService(nil, userRepoMock, nil)
+
+	for _, location := range []string{"", "Local", "Mars/Olympus_Mons"} {
+		ok, err := sut.InferLocation(user, location)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+
+	// candidate is reset when a different time zone is reported in between
+	for _, location := range []string{"Europe/Berlin", "Europe/Berlin", "Europe/London", "Europe/Berlin", "Europe/Berlin"} {
+		ok, err := sut.InferLocation(user, location)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+	userRepoMock.AssertNotCalled(t, "UpdateField", mock.Anything, mock.Anything, mock.Anything)
+
+	ok, err := sut.InferLocation(user, "Europe/Berlin")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "Europe/Berlin", user.Location)
+
+	// never changed once set
+	for i := 0; i < locationInferenceMinRequests; i++ {
+		ok, err = sut.InferLocation(user, "Europe/London")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+	assert.Equal(t, "Europe/Berlin", user.Location)
+	assert.True(t, user.LocationFixed)
+
+	// not even after being unset by the user
+	user.Location = ""
+	for i := 0; i < locationInferenceMinRequests; i++ {
+		ok, err = sut.InferLocation(user, "Europe/London")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+	userRepoMock.AssertNumberOfCalls(t, "UpdateField", 2)
+}
+
+func TestUserService_SetLastPlugin(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01", LastPlugin: "vscode-wakatime", LastPluginVersion: "24.0.0"}
+
+	userRepoMock := new(mocks.UserRepositoryMock)
+	userRepoMock.On("UpdateField", user, mock.Anything, mock.Anything).Return(user, nil)
+
+	sut := NewUserService(nil, userRepoMock, nil)
+
+	ok, err := sut.SetLastPlugin(user, "vscode-wakatime", "24.0.0")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	userRepoMock.AssertNotCalled(t, "UpdateField", mock.Anything, mock.Anything, mock.Anything)
+
+	ok, err = sut.SetLastPlugin(user, "vscode-wakatime", "24.8.0")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "24.8.0", user.LastPluginVersion)
+	userRepoMock.AssertCalled(t, "UpdateField", user, "last_plugin", "vscode-wakatime")
+	userRepoMock.AssertCalled(t, "UpdateField", user, "last_plugin_version", "24.8.0")
+
+	// throttled, e.g. when alternating between editors
+	ok, err = sut.SetLastPlugin(user, "GoLand-wakatime", "11.0.1")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "vscode-wakatime", user.LastPlugin)
+	userRepoMock.AssertNumberOfCalls(t, "UpdateField", 2)
+}
+
+func TestUserService_ProvisionByApiKey(t *testing.T) {
+	config.Set(config.Empty())
+
+	apiKey := "b9d9f6f0-3b5a-4c1e-9d2f-7a8b6c5d4e3f"
+
+	userRepoMock := new(mocks.UserRepositoryMock)
+	userRepoMock.On("FindOneIgnoreCase", mock.Anything).Return((*models.User)(nil), errors.New("not found"))
+	userRepoMock.On("InsertOrGet", mock.Anything).Return(&models.User{}, true, nil)
+
+	sut := NewUserService(nil, userRepoMock, nil)
+
+	_, err := sut.ProvisionByApiKey("not-a-key")
+	assert.ErrorIs(t, err, ErrInvalidApiKey)
+
+	_, err = sut.ProvisionByApiKey(apiKey)
+	assert.Nil(t, err)
+	userRepoMock.AssertCalled(t, "InsertOrGet", mock.MatchedBy(func(u *models.User) bool {
+		return u.ApiKey == apiKey &&
+			strings.HasPrefix(u.ID, "user-") && len(u.ID) == 17 &&
+			!strings.HasPrefix(apiKey, strings.TrimPrefix(u.ID, "user-")[:4]) // must not reveal parts of the key
+	}))
+}
+
+func TestUserService_SoftDelete(t *testing.T) {
+	config.Set(config.Empty())
+
+	user := &models.User{ID: "testuser01", ReportsWeekly: true, PublicLeaderboard: true}
+
+	userRepoMock := new(mocks.UserRepositoryMock)
+	userRepoMock.On("Update", user).Return(user, nil)
+
+	sut := NewUserService(nil, userRepoMock, nil)
+
+	sub := config.EventBus().Subscribe(1, config.EventUserUpdate)
+	defer config.EventBus().Unsubscribe(sub)
+
+	result, err := sut.SoftDelete(user)
+	assert.Nil(t, err)
+	assert.True(t, result.IsSoftDeleted())
+	assert.False(t, result.ReportsWeekly)
+
+	select {
+	case m := <-sub.Receiver:
+		assert.Equal(t, user, m.Fields[config.FieldPayload]) // for leaderboards to drop the user
+	case <-time.After(time.Second):
+		assert.Fail(t, "no user update event published")
+	}
+}
+
+func TestUserService_GetAllDeletionDue(t *testing.T) {
+	cfg := config.Empty()
+	cfg.App.AccountDeletionGraceDays = 7
+	config.Set(cfg)
+
+	users := []*models.User{{ID: "testuser01"}}
+
+	userRepoMock := new(mocks.UserRepositoryMock)
+	userRepoMock.On("GetBySoftDeletedBefore", mock.MatchedBy(func(t time.Time) bool {
+		due := time.Now().AddDate(0, 0, -7)
+		return t.After(due.Add(-time.Minute)) && t.Before(due.Add(time.Minute))
+	})).Return(users, nil)
+
+	sut := NewUserService(nil, userRepoMock, nil)
+
+	result, err := sut.GetAllDeletionDue()
+	assert.Nil(t, err)
+	assert.Equal(t, users, result)
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/duke-git/lancet/v2/slice"
+	"github.com/leandro-lugaresi/hub"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/repositories"
+	"github.com/muety/wakapi/utils"
+)
+
+const (
+	HeaderWebhookEvent     = "X-Wakapi-Event"
+	HeaderWebhookDelivery  = "X-Wakapi-Delivery"
+	HeaderWebhookSignature = "X-Wakapi-Signature"
+)
+
+const (
+	webhookTimeout          = 10 * time.Second
+	webhookMaxAttempts      = 6
+	webhookBaseBackoff      = 1 * time.Minute // doubled after every failed attempt, i.e. retries after 1, 2, 4, 8 and 16 minutes
+	webhookPollInterval     = 1 * time.Minute
+	webhookPollBatchSize    = 100
+	webhookDeliveryMaxAge   = 30 * 24 * time.Hour
+	webhookDailySummaryLag  = 48 * time.Hour // daily summaries older than this (e.g. when aggregating a user's history for the first time) are not announced
+	webhookMaxResponseBytes = 1024
+)
+
+// WebhookPayload is the json body posted to webhooks
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	UserID    string      `json:"user_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type WebhookService struct {
+	config       *config.Config
+	eventBus     *hub.Hub
+	repository   repositories.IWebhookRepository
+	httpClient   *http.Client
+	inProgress   sync.Map
+	queueDefault *config.JobQueue
+	queueWorkers *config.JobQueue
+}
+
+func NewWebhookService(webhookRepository repositories.IWebhookRepository) *WebhookService {
+	srv := &WebhookService{
+		config:       config.Get(),
+		eventBus:     config.EventBus(),
+		repository:   webhookRepository,
+		httpClient:   newWebhookHttpClient(utils.IsPublicIP),
+		queueDefault: config.GetDefaultQueue(),
+		queueWorkers: config.GetQueue(config.QueueWebhooks),
+	}
+
+	sub1 := srv.eventBus.Subscribe(0, config.EventSummaryCreate)
+	go func(sub *hub.Subscription) {
+		for m := range sub.Receiver {
+			user := m.Fields[config.FieldUser].(*models.User)
+			summary := m.Fields[config.FieldPayload].(*models.Summary)
+
+			if time.Since(summary.ToTime.T()) > webhookDailySummaryLag {
+				continue
+			}
+			if err := srv.Dispatch(user, models.WebhookEventDailySummary, summary); err != nil {
+				config.Log().Error("failed to dispatch webhooks", "userID", user.ID, "event", models.WebhookEventDailySummary, "error", err)
+			}
+		}
+	}(&sub1)
+
+	return srv
+}
+
+// Schedule periodically retries failed deliveries and cleans up old delivery records
+func (srv *WebhookService) Schedule() {
+	if !srv.config.App.WebhooksEnabled {
+		return
+	}
+
+	slog.Info("scheduling webhook deliveries")
+
+	if _, err := srv.queueDefault.DispatchEvery(srv.deliverDue, webhookPollInterval); err != nil {
+		config.Log().Error("failed to schedule webhook deliveries", "error", err)
+	}
+	if _, err := srv.queueDefault.DispatchEvery(func() {
+		if err := srv.repository.DeleteDeliveriesBefore(time.Now().Add(-webhookDeliveryMaxAge)); err != nil {
+			config.Log().Error("failed to delete old webhook deliveries", "error", err)
+		}
+	}, 24*time.Hour); err != nil {
+		config.Log().Error("failed to schedule webhook delivery cleanup", "error", err)
+	}
+}
+
+func (srv *WebhookService) GetByUser(userId string) ([]*models.Webhook, error) {
+	return srv.repository.GetByUser(userId)
+}
+
+// Create registers a new webhook for the user and generates its signing secret
+func (srv *WebhookService) Create(user *models.User, url string, events []string) (*models.Webhook, error) {
+	existing, err := srv.repository.GetByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= models.MaxWebhooksPerUser {
+		return nil, fmt.Errorf("must not register more than %d webhooks", models.MaxWebhooksPerUser)
+	}
+
+	secret, err := utils.GenerateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &models.Webhook{
+		UserID: user.ID,
+		Url:    strings.TrimSpace(url),
+		Secret: secret,
+		Events: strings.Join(slice.Unique(events), ","),
+	}
+	if !webhook.IsValid() {
+		return nil, errors.New("invalid url or events")
+	}
+	return srv.repository.Insert(webhook)
+}
+
+func (srv *WebhookService) Delete(user *models.User, id uint) error {
+	webhook, err := srv.getOwned(user, id)
+	if err != nil {
+		return err
+	}
+	return srv.repository.Delete(webhook.ID)
+}
+
+// GetDeliveries returns the webhook's most recent deliveries
+func (srv *WebhookService) GetDeliveries(user *models.User, id uint, limit int) ([]*models.WebhookDelivery, error) {
+	webhook, err := srv.getOwned(user, id)
+	if err != nil {
+		return nil, err
+	}
+	return srv.repository.GetDeliveriesByWebhook(webhook.ID, limit)
+}
+
+// Ping sends a test event to the given webhook
+func (srv *WebhookService) Ping(user *models.User, id uint) (*models.WebhookDelivery, error) {
+	webhook, err := srv.getOwned(user, id)
+	if err != nil {
+		return nil, err
+	}
+	return srv.enqueue(user, webhook, models.WebhookEventPing, nil)
+}
+
+// Dispatch enqueues deliveries of the event to all of the user's webhooks that subscribed to it
+func (srv *WebhookService) Dispatch(user *models.User, event string, data interface{}) error {
+	if !srv.config.App.WebhooksEnabled {
+		return nil
+	}
+
+	webhooks, err := srv.repository.GetByUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+		if _, err := srv.enqueue(user, webhook, event, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (srv *WebhookService) enqueue(user *models.User, webhook *models.Webhook, event string, data interface{}) (*models.WebhookDelivery, error) {
+	payload, err := json.Marshal(&WebhookPayload{
+		Event:     event,
+		UserID:    user.ID,
+		CreatedAt: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// in case the server goes down before the first attempt, the delivery will be picked up by the next poll of due deliveries
+	nextAttempt := models.CustomTime(time.Now().Add(webhookBaseBackoff))
+	delivery, err := srv.repository.InsertDelivery(&models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         event,
+		Payload:       string(payload),
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: &nextAttempt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery.Webhook = webhook
+
+	attempted := *delivery // copy, as delivery is returned to the caller while being attempted concurrently
+	if err := srv.queueWorkers.Dispatch(func() {
+		srv.attempt(&attempted)
+	}); err != nil {
+		config.Log().Error("failed to dispatch webhook delivery", "deliveryID", delivery.ID, "error", err)
+	}
+
+	return delivery, nil
+}
+
+func (srv *WebhookService) deliverDue() {
+	deliveries, err := srv.repository.GetDueDeliveries(time.Now(), webhookPollBatchSize)
+	if err != nil {
+		config.Log().Error("failed to fetch due webhook deliveries", "error", err)
+		return
+	}
+
+	for _, d := range deliveries {
+		delivery := d
+		if err := srv.queueWorkers.Dispatch(func() {
+			srv.attempt(delivery)
+		}); err != nil {
+			config.Log().Error("failed to dispatch webhook delivery", "deliveryID", delivery.ID, "error", err)
+		}
+	}
+}
+
+// attempt sends the delivery to its webhook once and records the outcome, scheduling another attempt with exponential backoff on failure
+func (srv *WebhookService) attempt(delivery *models.WebhookDelivery) {
+	if _, running := srv.inProgress.LoadOrStore(delivery.ID, true); running {
+		return
+	}
+	defer srv.inProgress.Delete(delivery.ID)
+
+	delivery.Attempts++
+	delivery.StatusCode, delivery.Error = 0, ""
+
+	if status, err := srv.send(delivery); err != nil {
+		delivery.StatusCode = status
+		delivery.Error = "request failed" // deliveries are visible to the user, so don't reveal details about the network wakapi runs in
+		if status != 0 {
+			delivery.Error = err.Error()
+		}
+		if delivery.Attempts >= webhookMaxAttempts {
+			delivery.Status = models.WebhookDeliveryFailed
+			delivery.NextAttemptAt = nil
+		} else {
+			nextAttempt := models.CustomTime(time.Now().Add(webhookBackoff(delivery.Attempts)))
+			delivery.NextAttemptAt = &nextAttempt
+		}
+		slog.Warn("webhook delivery failed", "deliveryID", delivery.ID, "webhookID", delivery.WebhookID, "attempt", delivery.Attempts, "error", err)
+	} else {
+		delivery.StatusCode = status
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+	}
+
+	if err := srv.repository.UpdateDelivery(delivery); err != nil {
+		config.Log().Error("failed to update webhook delivery", "deliveryID", delivery.ID, "error", err)
+	}
+}
+
+func (srv *WebhookService) send(delivery *models.WebhookDelivery) (int, error) {
+	if delivery.Webhook == nil {
+		return 0, errors.New("webhook not found")
+	}
+
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, delivery.Webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wakapi/"+srv.config.Version)
+	req.Header.Set(HeaderWebhookEvent, delivery.Event)
+	req.Header.Set(HeaderWebhookDelivery, strconv.Itoa(int(delivery.ID)))
+	req.Header.Set(HeaderWebhookSignature, utils.SignWebhookPayload(delivery.Webhook.Secret, payload))
+
+	res, err := srv.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, webhookMaxResponseBytes))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("got status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+func (srv *WebhookService) getOwned(user *models.User, id uint) (*models.Webhook, error) {
+	webhook, err := srv.repository.GetById(id)
+	if err != nil || webhook.UserID != user.ID {
+		return nil, errors.New("webhook not found")
+	}
+	return webhook, nil
+}
+
+// newWebhookHttpClient returns a client that refuses to follow redirects and to connect to any address not permitted by isAllowed.
+// Addresses are checked right before connecting, so hosts resolving to a different address than at the time of checking are caught as well.
+func newWebhookHttpClient(isAllowed func(net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isAllowed(ip) {
+				return fmt.Errorf("destination address %s not allowed", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func webhookBackoff(attempts int) time.Duration {
+	return webhookBaseBackoff * time.Duration(1<<(attempts-1))
+}
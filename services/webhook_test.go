@@ -0,0 +1,210 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/mocks"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type WebhookServiceTestSuite struct {
+	suite.Suite
+	TestUser          *models.User
+	WebhookRepository *mocks.WebhookRepositoryMock
+}
+
+func (suite *WebhookServiceTestSuite) BeforeTest(suiteName, testName string) {
+	cfg := config.Empty()
+	cfg.App.WebhooksEnabled = true
+	config.Set(cfg)
+	suite.TestUser = &models.User{ID: "testuser01"}
+	suite.WebhookRepository = new(mocks.WebhookRepositoryMock)
+}
+
+func TestWebhookServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookServiceTestSuite))
+}
+
+func (suite *WebhookServiceTestSuite) TestWebhookService_Create() {
+	sut := NewWebhookService(suite.WebhookRepository)
+
+	suite.WebhookRepository.On("GetByUser", suite.TestUser.ID).Return([]*models.Webhook{}, nil)
+	suite.WebhookRepository.On("Insert", mock.Anything).Return(&models.Webhook{}, nil)
+
+	_, err := sut.Create(suite.TestUser, " https://example.org/hook ", []string{models.WebhookEventDailySummary, models.WebhookEventDailySummary})
+	assert.Nil(suite.T(), err)
+	suite.WebhookRepository.AssertCalled(suite.T(), "Insert", mock.MatchedBy(func(w *models.Webhook) bool {
+		return w.Url == "https://example.org/hook" && w.Events == models.WebhookEventDailySummary && len(w.Secret) == 64
+	}))
+
+	_, err = sut.Create(suite.TestUser, "ftp://example.org", []string{models.WebhookEventDailySummary})
+	assert.Error(suite.T(), err)
+	_, err = sut.Create(suite.TestUser, "https://example.org/hook", []string{"unknown.event"})
+	assert.Error(suite.T(), err)
+	_, err = sut.Create(suite.TestUser, "https://example.org/hook", []string{})
+	assert.Error(suite.T(), err)
+}
+
+func (suite *WebhookServiceTestSuite) TestWebhookService_Create_Limit() {
+	sut := NewWebhookService(suite.WebhookRepository)
+
+	suite.WebhookRepository.On("GetByUser", suite.TestUser.ID).Return(make([]*models.Webhook, models.MaxWebhooksPerUser), nil)
+
+	_, err := sut.Create(suite.TestUser, "https://example.org/hook", []string{models.WebhookEventDailySummary})
+	assert.Error(suite.T(), err)
+	suite.WebhookRepository.AssertNotCalled(suite.T(), "Insert", mock.Anything)
+}
+
+func (suite *WebhookServiceTestSuite) TestWebhookService_Attempt_Success() {
+	sut := NewWebhookService(suite.WebhookRepository)
+	sut.httpClient = newWebhookHttpClient(allowAllIPs) // test server listens on loopback
+
+	payload := `{"event":"ping"}`
+	webhook := &models.Webhook{ID: 1, UserID: suite.TestUser.ID, Secret: "secret"}
+
+	var received *http.Request
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	webhook.Url = server.URL
+
+	suite.WebhookRepository.On("UpdateDelivery", mock.Anything).Return(nil)
+
+	delivery := &models.WebhookDelivery{ID: 42, WebhookID: 1, Webhook: webhook, Event: models.WebhookEventPing, Payload: payload, Status: models.WebhookDeliveryPending}
+	sut.attempt(delivery)
+
+	assert.Equal(suite.T(), models.WebhookDeliverySucceeded, delivery.Status)
+	assert.Equal(suite.T(), 1, delivery.Attempts)
+	assert.Equal(suite.T(), http.StatusOK, delivery.StatusCode)
+	assert.Nil(suite.T(), delivery.NextAttemptAt)
+	assert.Equal(suite.T(), payload, string(receivedBody))
+	assert.Equal(suite.T(), models.WebhookEventPing, received.Header.Get(HeaderWebhookEvent))
+	assert.Equal(suite.T(), "42", received.Header.Get(HeaderWebhookDelivery))
+	assert.Equal(suite.T(), utils.SignWebhookPayload("secret", []byte(payload)), received.Header.Get(HeaderWebhookSignature))
+	suite.WebhookRepository.AssertCalled(suite.T(), "UpdateDelivery", delivery)
+}
+
+func (suite *WebhookServiceTestSuite) TestWebhookService_Attempt_Retry() {
+	sut := NewWebhookService(suite.WebhookRepository)
+	sut.httpClient = newWebhookHttpClient(allowAllIPs) // test server listens on loopback
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	suite.WebhookRepository.On("UpdateDelivery", mock.Anything).Return(nil)
+
+	webhook := &models.Webhook{ID: 1, UserID: suite.TestUser.ID, Url: server.URL, Secret: "secret"}
+	delivery := &models.WebhookDelivery{ID: 42, WebhookID: 1, Webhook: webhook, Event: models.WebhookEventPing, Status: models.WebhookDeliveryPending}
+
+	t0 := time.Now()
+	sut.attempt(delivery)
+	assert.Equal(suite.T(), models.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(suite.T(), http.StatusBadGateway, delivery.StatusCode)
+	assert.NotEmpty(suite.T(), delivery.Error)
+	assert.WithinDuration(suite.T(), t0.Add(webhookBaseBackoff), delivery.NextAttemptAt.T(), 5*time.Second)
+
+	sut.attempt(delivery)
+	assert.WithinDuration(suite.T(), t0.Add(2*webhookBaseBackoff), delivery.NextAttemptAt.T(), 5*time.Second)
+
+	for delivery.Attempts < webhookMaxAttempts {
+		sut.attempt(delivery)
+	}
+	assert.Equal(suite.T(), models.WebhookDeliveryFailed, delivery.Status)
+	assert.Nil(suite.T(), delivery.NextAttemptAt)
+}
+
+func (suite *WebhookServiceTestSuite) TestWebhookService_Attempt_PrivateDestination() {
+	sut := NewWebhookService(suite.WebhookRepository)
+
+	var requested bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+
+	suite.WebhookRepository.On("UpdateDelivery", mock.Anything).Return(nil)
+
+	webhook := &models.Webhook{ID: 1, UserID: suite.TestUser.ID, Url: server.URL, Secret: "secret"}
+	delivery := &models.WebhookDelivery{ID: 42, WebhookID: 1, Webhook: webhook, Event: models.WebhookEventPing, Status: models.WebhookDeliveryPending}
+
+	sut.attempt(delivery)
+	assert.False(suite.T(), requested)
+	assert.Equal(suite.T(), models.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(suite.T(), 0, delivery.StatusCode)
+	assert.Equal(suite.T(), "request failed", delivery.Error)
+}
+
+func (suite *WebhookServiceTestSuite) TestWebhookService_Attempt_Redirect() {
+	sut := NewWebhookService(suite.WebhookRepository)
+	sut.httpClient = newWebhookHttpClient(allowAllIPs)
+
+	var redirected bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/target" {
+			redirected = true
+			return
+		}
+		http.Redirect(w, r, "/target", http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	suite.WebhookRepository.On("UpdateDelivery", mock.Anything).Return(nil)
+
+	webhook := &models.Webhook{ID: 1, UserID: suite.TestUser.ID, Url: server.URL, Secret: "secret"}
+	delivery := &models.WebhookDelivery{ID: 42, WebhookID: 1, Webhook: webhook, Event: models.WebhookEventPing, Status: models.WebhookDeliveryPending}
+
+	sut.attempt(delivery)
+	assert.False(suite.T(), redirected)
+	assert.Equal(suite.T(), models.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(suite.T(), http.StatusTemporaryRedirect, delivery.StatusCode)
+}
+
+func (suite *WebhookServiceTestSuite) TestWebhookService_Dispatch() {
+	sut := NewWebhookService(suite.WebhookRepository)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	webhooks := []*models.Webhook{
+		{ID: 1, UserID: suite.TestUser.ID, Url: server.URL, Secret: "secret", Events: models.WebhookEventDailySummary},
+		{ID: 2, UserID: suite.TestUser.ID, Url: server.URL, Secret: "secret", Events: "other.event"},
+	}
+
+	suite.WebhookRepository.On("GetByUser", suite.TestUser.ID).Return(webhooks, nil)
+	suite.WebhookRepository.On("InsertDelivery", mock.Anything).Return(&models.WebhookDelivery{ID: 1}, nil)
+	suite.WebhookRepository.On("UpdateDelivery", mock.Anything).Return(nil).Maybe()
+
+	err := sut.Dispatch(suite.TestUser, models.WebhookEventDailySummary, map[string]int{"foo": 1})
+	assert.Nil(suite.T(), err)
+
+	suite.WebhookRepository.AssertNumberOfCalls(suite.T(), "InsertDelivery", 1)
+	suite.WebhookRepository.AssertCalled(suite.T(), "InsertDelivery", mock.MatchedBy(func(d *models.WebhookDelivery) bool {
+		var payload WebhookPayload
+		return d.WebhookID == 1 &&
+			d.Status == models.WebhookDeliveryPending &&
+			d.NextAttemptAt != nil &&
+			json.Unmarshal([]byte(d.Payload), &payload) == nil &&
+			payload.Event == models.WebhookEventDailySummary &&
+			payload.UserID == suite.TestUser.ID
+	}))
+}
+
+func allowAllIPs(net.IP) bool {
+	return true
+}
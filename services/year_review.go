@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	svg "github.com/ajstarks/svgo/float"
+	"github.com/duke-git/lancet/v2/condition"
+	"github.com/muety/wakapi/config"
+	"github.com/muety/wakapi/helpers"
+	"github.com/muety/wakapi/models"
+	"github.com/muety/wakapi/utils"
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	yearReviewCacheTTL     = 1 * time.Hour
+	yearReviewPastCacheTTL = 24 * time.Hour // past years only change upon imports or alias changes
+	yearReviewImageWidth   = 480
+	yearReviewImageHeight  = 400
+	yearReviewBarsHeight   = 60
+)
+
+type YearReviewService struct {
+	config         *config.Config
+	cache          *cache.Cache
+	summaryService ISummaryService
+}
+
+func NewYearReviewService(summaryService ISummaryService) *YearReviewService {
+	return &YearReviewService{
+		config:         config.Get(),
+		cache:          cache.New(yearReviewCacheTTL, yearReviewCacheTTL),
+		summaryService: summaryService,
+	}
+}
+
+// Get assembles the user's review of the given calendar year in their timezone from monthly rollups and daily totals.
+// It is computed from their unfiltered data, i.e. the caller has to take care of anonymizing it before sharing it with others.
+func (s *YearReviewService) Get(user *models.User, year int) (*models.YearReview, error) {
+	cacheKey := fmt.Sprintf("year_review_%s_%d_%d", user.ID, year, user.ActiveDayThreshold())
+	if result, found := s.cache.Get(cacheKey); found {
+		return result.(*models.YearReview), nil
+	}
+
+	tz := user.TZ()
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, tz)
+	to := from.AddDate(1, 0, 0)
+	isPast := true
+	if now := time.Now().In(tz); now.Before(to) {
+		to, isPast = now, false
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("year %d hasn't started yet", year)
+	}
+
+	total, err := s.summaryService.Rollup(from, to, user, nil, models.RollupYear)
+	if err != nil {
+		return nil, err
+	}
+	months, err := s.summaryService.Rollup(from, to, user, nil, models.RollupMonth)
+	if err != nil {
+		return nil, err
+	}
+	days, err := s.summaryService.Cumulative(from, to, user, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	review := models.NewYearReview(year, total[0], months, days, user.ActiveDayThreshold())
+	if isPast {
+		s.cache.Set(cacheKey, review, yearReviewPastCacheTTL)
+	} else {
+		s.cache.SetDefault(cacheKey, review)
+	}
+	return review, nil
+}
+
+// GetImage renders the given review as a shareable svg card
+func (s *YearReviewService) GetImage(review *models.YearReview, darkTheme, hideAttribution bool) string {
+	var (
+		colorRGBAMin = utils.HexToRGBA(condition.TernaryOperator[bool, string](darkTheme, colorMinDark, colorMinLight))
+		colorRGBAMax = utils.HexToRGBA(condition.TernaryOperator[bool, string](darkTheme, colorMaxDark, colorMaxLight))
+		colorText    = condition.TernaryOperator[bool, string](darkTheme, textDark, textLight)
+		w, h         = float64(yearReviewImageWidth), float64(yearReviewImageHeight)
+	)
+
+	buf := &bytes.Buffer{}
+
+	canvas := svg.New(buf)
+	canvas.Start(w, h)
+	canvas.Style("text/css",
+		fmt.Sprintf("text { font-family: 'Source Sans 3', Roboto, Helvetica, Arial, sans-serif; font-size: 0.9rem; font-weight: 500; fill: %s; }", colorText),
+		"text.title { font-size: 1.4rem; font-weight: 700; }",
+		"text.label { font-weight: 700; }",
+		"rect { fill-opacity: 1; rx: 3px; ry: 3px; }",
+	)
+
+	canvas.Text(0, 24, fmt.Sprintf("%d in review", review.Year), "class=\"title\"")
+	canvas.Text(0, 50, fmt.Sprintf("%.1f hours of coding on %d active days", review.Hours, review.ActiveDays))
+
+	facts := [][2]string{
+		{"Longest streak", fmt.Sprintf("%d days", review.LongestStreak.Days)},
+		{"Busiest month", "-"},
+		{"Busiest day", "-"},
+	}
+	if review.BusiestMonth != nil {
+		if month, err := time.Parse("2006-01", review.BusiestMonth.Period); err == nil {
+			facts[1][1] = fmt.Sprintf("%s (%s)", month.Month().String(), helpers.FmtWakatimeDuration(time.Duration(review.BusiestMonth.Total)*time.Second))
+		}
+	}
+	if review.BusiestDay != nil {
+		if day, err := time.Parse(time.DateOnly, review.BusiestDay.Period); err == nil {
+			facts[2][1] = fmt.Sprintf("%s (%s)", helpers.FormatDateHuman(day), helpers.FmtWakatimeDuration(time.Duration(review.BusiestDay.Total)*time.Second))
+		}
+	}
+	for i, fact := range facts {
+		canvas.Text(0, 85+float64(i)*22, fact[0], "class=\"label\"")
+		canvas.Text(130, 85+float64(i)*22, fact[1])
+	}
+
+	for i, list := range []struct {
+		title string
+		items models.SummaryItems
+	}{{"Top languages", review.Languages}, {"Top projects", review.Projects}} {
+		x := float64(i) * w / 2
+		canvas.Text(x, 170, list.title, "class=\"label\"")
+		if len(list.items) == 0 {
+			canvas.Text(x, 192, "-")
+		}
+		for j, item := range list.items {
+			canvas.Text(x, 192+float64(j)*20, fmt.Sprintf("%d. %s", j+1, truncateLabel(item.Key, 24)))
+		}
+	}
+
+	// monthly coding time as bar chart
+	var maxTotal int64
+	for _, m := range review.Months {
+		maxTotal = max(maxTotal, m.Total)
+	}
+	barWidth := w / 12
+	for i, m := range review.Months {
+		var ratio float64
+		if maxTotal > 0 {
+			ratio = float64(m.Total) / float64(maxTotal)
+		}
+		barHeight := max(2, ratio*yearReviewBarsHeight)
+		fillColor := utils.RGBAToHex(utils.FadeColors(colorRGBAMin, colorRGBAMax, ratio))
+
+		canvas.Group()
+		canvas.Title(fmt.Sprintf("%s in %s", helpers.FmtWakatimeDuration(time.Duration(m.Total)*time.Second), m.Period))
+		canvas.Rect(float64(i)*barWidth+2, h-30-barHeight, barWidth-4, barHeight, fmt.Sprintf("fill: %s", fillColor))
+		canvas.Gend()
+	}
+
+	if !hideAttribution {
+		canvas.Group()
+		canvas.Title("Wakapi.dev")
+		canvas.Image(w-60, h-24, 60, 24, "https://wakapi.dev/assets/images/logo-gh.svg")
+		canvas.Gend()
+	}
+
+	canvas.End()
+
+	return buf.String()
+}
+
+func truncateLabel(label string, maxLength int) string {
+	if runes := []rune(label); len(runes) > maxLength {
+		return string(runes[:maxLength-1]) + "…"
+	}
+	return label
+}
@@ -24,9 +24,11 @@ PetiteVue.createApp({
         }
     },
     confirmWakatimeImport() {
-        if (confirm("Are you sure? The import can not be undone.")) {
-            // weird hack to sync the "legacy importer" form field from the wakatime connection form to the (invisible) import form
+        const dryRun = document.getElementById('dry_run_tmp').checked
+        if (dryRun || confirm("Are you sure? The import can not be undone.")) {
+            // weird hack to sync the "legacy importer" and "dry run" form fields from the wakatime connection form to the (invisible) import form
             document.getElementById('use_legacy_importer').value = document.getElementById('use_legacy_importer_tmp').checked.toString()
+            document.getElementById('dry_run').value = dryRun.toString()
             document.querySelector("#form-import-wakatime").submit();
         }
     },
@@ -45,26 +45,55 @@ func ExtractBearerAuth(r *http.Request) (key string, err error) {
 
 // password hashing
 
+const (
+	PasswordHashArgon2Id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+)
+
+type PasswordHashOptions struct {
+	Algorithm  string
+	BcryptCost int
+}
+
+// ComparePassword checks a password against a bcrypt or argon2id hash, both of which perform a constant-time comparison internally
 func ComparePassword(hashed, plain, pepper string) bool {
-	if hashed[0:10] == "$argon2id$" {
+	if strings.HasPrefix(hashed, "$argon2id$") {
 		return CompareArgon2Id(hashed, plain, pepper)
 	}
 	return CompareBcrypt(hashed, plain, pepper)
 }
 
-func HashPassword(plain, pepper string) (string, error) {
+func HashPassword(plain, pepper string, opts PasswordHashOptions) (string, error) {
+	if opts.Algorithm == PasswordHashBcrypt {
+		return HashBcrypt(plain, pepper, opts.BcryptCost)
+	}
 	return HashArgon2Id(plain, pepper)
 }
 
+// PasswordNeedsRehash tells whether a hash was created with a different algorithm or weaker parameters than the given ones
+func PasswordNeedsRehash(hashed string, opts PasswordHashOptions) bool {
+	if opts.Algorithm == PasswordHashBcrypt {
+		cost, err := bcrypt.Cost([]byte(hashed))
+		return err != nil || cost < opts.BcryptCost
+	}
+
+	params, _, _, err := argon2id.DecodeHash(hashed)
+	if err != nil {
+		return true
+	}
+	defaults := argon2id.DefaultParams
+	return params.Iterations < defaults.Iterations || params.Memory < defaults.Memory || params.KeyLength < defaults.KeyLength
+}
+
 func CompareBcrypt(hashed, plain, pepper string) bool {
 	plainPepperedPassword := []byte(strings.TrimSpace(plain) + pepper)
 	err := bcrypt.CompareHashAndPassword([]byte(hashed), plainPepperedPassword)
 	return err == nil
 }
 
-func HashBcrypt(plain, pepper string) (string, error) {
+func HashBcrypt(plain, pepper string, cost int) (string, error) {
 	plainPepperedPassword := []byte(strings.TrimSpace(plain) + pepper)
-	bytes, err := bcrypt.GenerateFromPassword(plainPepperedPassword, bcrypt.DefaultCost)
+	bytes, err := bcrypt.GenerateFromPassword(plainPepperedPassword, cost)
 	if err == nil {
 		return string(bytes), nil
 	}
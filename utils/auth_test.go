@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuth_PasswordNeedsRehash(t *testing.T) {
+	argonOpts := PasswordHashOptions{Algorithm: PasswordHashArgon2Id}
+	bcryptOpts := PasswordHashOptions{Algorithm: PasswordHashBcrypt, BcryptCost: 12}
+
+	argonHash, _ := HashPassword("secret", "pepper", argonOpts)
+	weakBcryptHash, _ := HashBcrypt("secret", "pepper", bcrypt.MinCost)
+	strongBcryptHash, _ := HashPassword("secret", "pepper", bcryptOpts)
+
+	assert.True(t, ComparePassword(argonHash, "secret", "pepper"))
+	assert.True(t, ComparePassword(weakBcryptHash, "secret", "pepper"))
+	assert.True(t, ComparePassword(strongBcryptHash, "secret", "pepper"))
+	assert.False(t, ComparePassword(strongBcryptHash, "wrong", "pepper"))
+
+	assert.False(t, PasswordNeedsRehash(argonHash, argonOpts))
+	assert.True(t, PasswordNeedsRehash(weakBcryptHash, argonOpts))
+	assert.True(t, PasswordNeedsRehash(weakBcryptHash, bcryptOpts))
+	assert.False(t, PasswordNeedsRehash(strongBcryptHash, bcryptOpts))
+	assert.True(t, PasswordNeedsRehash(argonHash, bcryptOpts))
+}
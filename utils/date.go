@@ -27,6 +27,11 @@ func BeginOfThisYear(tz *time.Location) time.Time {
 	return datetime.BeginOfYear(time.Now().In(tz))
 }
 
+// FloorDate rounds date down to the start of its day
+func FloorDate(date time.Time) time.Time {
+	return datetime.BeginOfDay(date)
+}
+
 // CeilDate rounds date up to the start of next day if date is not already a start (00:00:00)
 func CeilDate(date time.Time) time.Time {
 	floored := datetime.BeginOfDay(date)
@@ -77,3 +82,32 @@ func ParseWeekday(s string) time.Weekday {
 	}
 	return time.Monday
 }
+
+// SplitRangeByMonths creates a slice of intervals between from and to, each of which is split at the beginning of a calendar month in from's time zone
+func SplitRangeByMonths(from time.Time, to time.Time) [][]time.Time {
+	return splitRangeBy(from, to, func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).AddDate(0, 1, 0)
+	})
+}
+
+// SplitRangeByYears creates a slice of intervals between from and to, each of which is split at the beginning of a calendar year in from's time zone
+func SplitRangeByYears(from time.Time, to time.Time) [][]time.Time {
+	return splitRangeBy(from, to, func(t time.Time) time.Time {
+		return time.Date(t.Year()+1, 1, 1, 0, 0, 0, 0, t.Location())
+	})
+}
+
+func splitRangeBy(from time.Time, to time.Time, next func(time.Time) time.Time) [][]time.Time {
+	intervals := make([][]time.Time, 0)
+
+	for t1 := from; t1.Before(to); {
+		t2 := next(t1)
+		if t2.After(to) {
+			t2 = to
+		}
+		intervals = append(intervals, []time.Time{t1, t2})
+		t1 = t2
+	}
+
+	return intervals
+}
@@ -57,3 +57,33 @@ func TestDate_SplitRangeByDays(t *testing.T) {
 
 	assert.Len(t, result4, 0)
 }
+
+func TestDate_SplitRangeByMonths(t *testing.T) {
+	from := time.Date(2023, 11, 15, 10, 0, 0, 0, tzCet)
+	to := time.Date(2024, 2, 3, 0, 0, 0, 0, tzCet)
+
+	result := SplitRangeByMonths(from, to)
+
+	assert.Len(t, result, 4)
+	assert.Equal(t, from, result[0][0])
+	assert.Equal(t, time.Date(2023, 12, 1, 0, 0, 0, 0, tzCet), result[0][1])
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, tzCet), result[1][1])
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, tzCet), result[2][1])
+	assert.Equal(t, result[2][1], result[3][0])
+	assert.Equal(t, to, result[3][1])
+
+	assert.Len(t, SplitRangeByMonths(from, from), 0)
+}
+
+func TestDate_SplitRangeByYears(t *testing.T) {
+	from := time.Date(2022, 12, 31, 23, 0, 0, 0, tzPst)
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, tzPst)
+
+	result := SplitRangeByYears(from, to)
+
+	assert.Len(t, result, 2)
+	assert.Equal(t, from, result[0][0])
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, tzPst), result[0][1])
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, tzPst), result[1][0])
+	assert.Equal(t, to, result[1][1])
+}
@@ -79,3 +79,8 @@ func QuoteSql(db *gorm.DB, queryTemplate string, identifiers ...string) string {
 	}
 	return fmt.Sprintf(queryTemplate, quotedIdentifiers...)
 }
+
+// EscapeLike escapes wildcards in the given string to have them matched literally by a like expression with escape character '!'
+func EscapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
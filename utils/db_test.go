@@ -0,0 +1,12 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, "foo", EscapeLike("foo"))
+	assert.Equal(t, "100!% !_done!!", EscapeLike("100% _done!"))
+}
@@ -14,3 +14,14 @@ func CheckEmailMX(email string) bool {
 	records, err := net.LookupMX(parts[1])
 	return len(records) > 0 && err == nil
 }
+
+// IsPublicIP reports whether the given address is publicly routable, i.e. neither loopback, private, link-local, unspecified nor multicast
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified())
+}
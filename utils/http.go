@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/duke-git/lancet/v2/strutil"
 	"github.com/mileusna/useragent"
+	"hash/fnv"
 	"io"
 	"net/http"
 	"regexp"
@@ -17,16 +18,19 @@ import (
 const (
 	userAgentPattern   = `(?iU)^(?:(?:wakatime|chrome|firefox|edge)\/(?:v?[\d+.]+|unset)?\s)(?:\(?(\w+)[-_].*\)?.+\s)?(?:([^\/\s]+)\/[\w\d\.]+\s)?([^\/\s]+)-wakatime\/.+$`
 	cacheMaxAgePattern = `max-age=(\d+)`
+	pluginPattern      = `(?i)(?:^|\s)([\w.]+-wakatime|wakatime)\/v?(\d[\w.+-]*)`
 )
 
 var (
 	userAgent     *regexp.Regexp
 	cacheMaxAgeRe *regexp.Regexp
+	pluginRe      *regexp.Regexp
 )
 
 func init() {
 	userAgent = regexp.MustCompile(userAgentPattern)
 	cacheMaxAgeRe = regexp.MustCompile(cacheMaxAgePattern)
+	pluginRe = regexp.MustCompile(pluginPattern)
 }
 
 type PageParams struct {
@@ -62,6 +66,64 @@ func IsNoCache(r *http.Request, cacheTtl time.Duration) bool {
 	return false
 }
 
+// WeakETag derives a weak entity tag from the given response body
+func WeakETag(data []byte) string {
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf("W/\"%x\"", h.Sum64())
+}
+
+// IsNotModified checks whether any of the entity tags in the request's If-None-Match header matches the given one, i.e. the client's copy is still up-to-date
+func IsNotModified(r *http.Request, etag string) bool {
+	ifNoneMatch := r.Header.Get("if-none-match")
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotModifiedSince checks whether the given modification time is not after the request's If-Modified-Since header. As per RFC 9110, the header is ignored if If-None-Match is present.
+func IsNotModifiedSince(r *http.Request, lastModified time.Time) bool {
+	if r.Header.Get("if-none-match") != "" || lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("if-modified-since"))
+	if err != nil {
+		return false
+	}
+	// http dates only have a precision of seconds
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// AcceptsMsgpack checks whether the request's Accept header asks for MessagePack (application/msgpack or application/x-msgpack), with at least the same preference as for JSON
+func AcceptsMsgpack(r *http.Request) bool {
+	var msgpackQ, jsonQ float64 = -1, -1
+	for _, accept := range strings.Split(r.Header.Get("accept"), ",") {
+		parts := strings.Split(accept, ";")
+		q := 1.0
+		for _, param := range parts[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && k == "q" {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(parts[0])) {
+		case MimeTypeMsgpack, "application/x-msgpack":
+			msgpackQ = max(msgpackQ, q)
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	return msgpackQ > 0 && msgpackQ >= jsonQ
+}
+
 func ParsePageParams(r *http.Request) *PageParams {
 	pageParams := &PageParams{}
 	page := r.URL.Query().Get("page")
@@ -121,6 +183,23 @@ func ParseUserAgent(ua string) (string, string, error) { // os, editor, err
 	return "", "", errors.New("failed to parse user agent string")
 }
 
+// ParsePluginVersion extracts the editor plugin and its version from a wakatime client user agent (e.g. "vscode-wakatime" and "24.8.0").
+// Falls back to wakatime-cli itself (as "wakatime") for clients that don't report a plugin.
+func ParsePluginVersion(ua string) (string, string, error) { // plugin, version, err
+	var cli []string
+	for _, groups := range pluginRe.FindAllStringSubmatch(ua, -1) {
+		if strings.EqualFold(groups[1], "wakatime") {
+			cli = groups
+			continue
+		}
+		return groups[1], groups[2], nil
+	}
+	if cli != nil {
+		return strings.ToLower(cli[1]), cli[2], nil
+	}
+	return "", "", errors.New("failed to parse plugin version from user agent string")
+}
+
 func RaiseForStatus(res *http.Response, err error) (*http.Response, error) {
 	if err != nil {
 		return res, err
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeakETag(t *testing.T) {
+	etag := WeakETag([]byte("foo"))
+	assert.Regexp(t, `^W/"[0-9a-f]+"$`, etag)
+	assert.Equal(t, etag, WeakETag([]byte("foo")))
+	assert.NotEqual(t, etag, WeakETag([]byte("bar")))
+}
+
+func TestIsNotModified(t *testing.T) {
+	etag := WeakETag([]byte("foo"))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.False(t, IsNotModified(r, etag))
+
+	r.Header.Set("If-None-Match", WeakETag([]byte("bar")))
+	assert.False(t, IsNotModified(r, etag))
+
+	r.Header.Set("If-None-Match", etag)
+	assert.True(t, IsNotModified(r, etag))
+
+	r.Header.Set("If-None-Match", `"abc", `+etag[2:])
+	assert.True(t, IsNotModified(r, etag))
+
+	r.Header.Set("If-None-Match", "*")
+	assert.True(t, IsNotModified(r, etag))
+}
+
+func TestIsNotModifiedSince(t *testing.T) {
+	lastModified := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.False(t, IsNotModifiedSince(r, lastModified))
+
+	r.Header.Set("If-Modified-Since", lastModified.Format(http.TimeFormat))
+	assert.True(t, IsNotModifiedSince(r, lastModified))
+	assert.False(t, IsNotModifiedSince(r, lastModified.Add(time.Second)))
+	assert.False(t, IsNotModifiedSince(r, time.Time{}))
+
+	r.Header.Set("If-None-Match", WeakETag([]byte("foo")))
+	assert.False(t, IsNotModifiedSince(r, lastModified))
+}
+
+func TestAcceptsMsgpack(t *testing.T) {
+	testCases := []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"application/msgpack", true},
+		{"application/x-msgpack", true},
+		{"application/json, application/msgpack", true},
+		{"application/json, application/msgpack;q=0.5", false},
+		{"application/json;q=0.8, application/msgpack", true},
+		{"application/msgpack;q=0", false},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", tc.accept)
+		assert.Equal(t, tc.expected, AcceptsMsgpack(r), tc.accept)
+	}
+}
+
+func TestParsePluginVersion(t *testing.T) {
+	tests := []struct {
+		in         string
+		outPlugin  string
+		outVersion string
+		outError   error
+	}{
+		{"wakatime/v1.105.0 (linux-6.11.8-zen1-2-zen-unknown) go1.23.3 cursor/1.93.1 vscode-wakatime/24.8.0", "vscode-wakatime", "24.8.0", nil},
+		{"wakatime/13.0.7 (Linux-4.15.0-96-generic-x86_64-with-glibc2.4) Python3.8.0.final.0 GoLand/2019.3.4 GoLand-wakatime/11.0.1", "GoLand-wakatime", "11.0.1", nil},
+		{"Chrome/117.0.0.0 win_x86-64 chrome-wakatime/3.0.19", "chrome-wakatime", "3.0.19", nil},
+		{"wakatime/v1.86.5 (linux-6.6.4-200.fc39.x86_64-unknown) go1.21.3", "wakatime", "1.86.5", nil},
+		{"wakatime/unset (linux-5.11.0-44-generic-x86_64) go1.16.13 emacs-wakatime/unset", "", "", errors.New("")},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36", "", "", errors.New("")},
+		{"", "", "", errors.New("")},
+	}
+
+	for _, test := range tests {
+		plugin, version, err := ParsePluginVersion(test.in)
+		assert.True(t, checkErr(err, test.outError))
+		assert.Equal(t, test.outPlugin, plugin)
+		assert.Equal(t, test.outVersion, version)
+	}
+}
@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type msgpackTestItem struct {
+	Key   string        `json:"key"`
+	Total time.Duration `json:"total"`
+}
+
+type msgpackTestObject struct {
+	ID       string             `json:"id"`
+	From     time.Time          `json:"from"`
+	Ratio    float64            `json:"ratio"`
+	Offset   int                `json:"offset"`
+	Active   bool               `json:"active"`
+	Parent   *msgpackTestObject `json:"parent"`
+	Items    []*msgpackTestItem `json:"items"`
+	Counts   map[string]int64   `json:"counts"`
+	Ignored  string             `json:"-"`
+	Optional string             `json:"optional,omitempty"`
+}
+
+func TestMsgpack_RoundTrip(t *testing.T) {
+	items := make([]*msgpackTestItem, 300) // beyond fixarray and 8-bit length
+	for i := range items {
+		items[i] = &msgpackTestItem{Key: strings.Repeat("x", i), Total: time.Duration(i) * time.Hour}
+	}
+
+	sut := &msgpackTestObject{
+		ID:     "test",
+		From:   time.Date(2024, 3, 10, 12, 30, 0, 123, time.UTC),
+		Ratio:  0.25,
+		Offset: -3600,
+		Active: true,
+		Items:  items,
+		Counts: map[string]int64{
+			"zero":     0,
+			"fixneg":   -32,
+			"int8":     -100,
+			"uint8":    200,
+			"int16":    -30000,
+			"uint16":   60000,
+			"int32":    -2000000000,
+			"uint32":   4000000000,
+			"int64":    -5000000000,
+			"maxInt64": 9223372036854775807,
+		},
+		Ignored: "foo",
+	}
+
+	data, err := MarshalMsgpack(sut)
+	assert.Nil(t, err)
+
+	jsonData, _ := json.Marshal(sut)
+	assert.Less(t, len(data), len(jsonData))
+
+	var result msgpackTestObject
+	assert.Nil(t, unmarshalMsgpack(data, &result))
+
+	var expected msgpackTestObject
+	json.Unmarshal(jsonData, &expected)
+	assert.Equal(t, expected, result)
+	assert.Empty(t, result.Ignored)
+	assert.Nil(t, result.Parent)
+	assert.Equal(t, sut.Counts, result.Counts)
+	assert.Equal(t, 299*time.Hour, result.Items[299].Total)
+}
+
+func TestMsgpack_SameStructureAsJson(t *testing.T) {
+	sut := map[string]interface{}{
+		"from":  time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+		"total": 3 * time.Hour,
+		"items": []string{},
+		"meta":  nil,
+	}
+
+	data, err := MarshalMsgpack(sut)
+	assert.Nil(t, err)
+
+	result, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(data)))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"from":  "2024-03-10T00:00:00Z",
+		"total": int64(3 * time.Hour),
+		"items": []interface{}{},
+		"meta":  nil,
+	}, result)
+
+	// keys are sorted
+	assert.Equal(t, []byte{0x84, 0xa4, 'f', 'r', 'o', 'm'}, data[:6])
+}
+
+func TestMsgpack_DecodeInvalid(t *testing.T) {
+	_, err := decodeMsgpack(bufio.NewReader(strings.NewReader("")))
+	assert.Error(t, err)
+
+	// truncated string
+	_, err = decodeMsgpack(bufio.NewReader(strings.NewReader("\xa5ab")))
+	assert.Error(t, err)
+
+	// array announcing more items than present
+	_, err = decodeMsgpack(bufio.NewReader(strings.NewReader("\xdd\xff\xff\xff\xff\x01")))
+	assert.Error(t, err)
+
+	// non-string map key
+	_, err = decodeMsgpack(bufio.NewReader(strings.NewReader("\x81\x01\x02")))
+	assert.Error(t, err)
+
+	// unsupported (bin 8)
+	_, err = decodeMsgpack(bufio.NewReader(strings.NewReader("\xc4\x01a")))
+	assert.Error(t, err)
+}
+
+// decoding is only needed to verify the encoder
+
+// unmarshalMsgpack decodes MessagePack data produced by MarshalMsgpack into the given object, in the same way as json.Unmarshal would do with its JSON counterpart
+func unmarshalMsgpack(data []byte, v interface{}) error {
+	tmp, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(tmp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, v)
+}
+
+// decodeMsgpack decodes a single MessagePack value into generic objects, resembling what json.Unmarshal produces for interface{} (except for integers, which are kept as int64, or uint64 if too large)
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	code, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xe0 == 0xa0:
+		return decodeMsgpackString(r, int(code&0x1f))
+	case code&0xf0 == 0x90:
+		return decodeMsgpackArray(r, int(code&0x0f))
+	case code&0xf0 == 0x80:
+		return decodeMsgpackMap(r, int(code&0x0f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		var bits uint32
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return float64(math.Float32frombits(bits)), err
+	case 0xcb:
+		var bits uint64
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := readMsgpackUint(r, 1<<(code-0xcc))
+		if err != nil || n > math.MaxInt64 {
+			return n, err
+		}
+		return int64(n), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n, err := readMsgpackUint(r, 1<<(code-0xd0))
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*(1<<(code-0xd0))
+		return int64(n<<shift) >> shift, nil // sign extension
+	case 0xd9, 0xda, 0xdb:
+		n, err := readMsgpackUint(r, 1<<(code-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackString(r, int(n))
+	case 0xdc, 0xdd:
+		n, err := readMsgpackUint(r, 2<<(code-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackArray(r, int(n))
+	case 0xde, 0xdf:
+		n, err := readMsgpackUint(r, 2<<(code-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackMap(r, int(n))
+	}
+
+	return nil, fmt.Errorf("unsupported msgpack type 0x%x", code)
+}
+
+func decodeMsgpackString(r io.Reader, n int) (string, error) {
+	var sb strings.Builder
+	if _, err := io.CopyN(&sb, r, int64(n)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func decodeMsgpackArray(r *bufio.Reader, n int) ([]interface{}, error) {
+	result := make([]interface{}, 0, min(n, 1024)) // length is untrusted input
+	for i := 0; i < n; i++ {
+		item, err := decodeMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func decodeMsgpackMap(r *bufio.Reader, n int) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, min(n, 1024))
+	for i := 0; i < n; i++ {
+		key, err := decodeMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		keyStr, ok := key.(string)
+		if !ok {
+			return nil, errors.New("unsupported non-string msgpack map key")
+		}
+		if result[keyStr], err = decodeMsgpack(r); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func readMsgpackUint(r io.Reader, size int) (uint64, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
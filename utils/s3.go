@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3Service         = "s3"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3Client is a minimal client for s3-compatible object stores (aws s3, minio, garage, ...), only supporting what's required to store exports.
+// Requests are authenticated with aws signature version 4 (https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html).
+type S3Client struct {
+	endpoint        *url.URL
+	region          string
+	bucket          string
+	accessKeyId     string
+	secretAccessKey string
+	pathStyle       bool // address the bucket as first path segment instead of as sub-domain
+	httpClient      *http.Client
+	now             func() time.Time
+}
+
+type S3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func NewS3Client(endpoint, region, bucket, accessKeyId, secretAccessKey string, pathStyle bool) (*S3Client, error) {
+	endpointUrl, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || (endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https") || endpointUrl.Host == "" {
+		return nil, fmt.Errorf("invalid object store endpoint '%s'", endpoint)
+	}
+	return &S3Client{
+		endpoint:        endpointUrl,
+		region:          region,
+		bucket:          bucket,
+		accessKeyId:     accessKeyId,
+		secretAccessKey: secretAccessKey,
+		pathStyle:       pathStyle,
+		httpClient:      &http.Client{Timeout: 10 * time.Minute}, // exports may be large
+		now:             time.Now,
+	}, nil
+}
+
+// PutObject uploads the given content of known size, which is streamed as unsigned payload, so it doesn't need to be read twice
+func (c *S3Client) PutObject(key string, content io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequest(http.MethodPut, c.objectUrl(key).String(), content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	_, err = c.do(req, http.StatusOK)
+	return err
+}
+
+// DeleteObject deletes the object, which is not considered an error if it doesn't exist
+func (c *S3Client) DeleteObject(key string) error {
+	req, err := http.NewRequest(http.MethodDelete, c.objectUrl(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(req, http.StatusNoContent, http.StatusOK)
+	return err
+}
+
+// ListObjects returns all objects whose key starts with the given prefix, following pagination
+func (c *S3Client) ListObjects(prefix string) ([]*S3Object, error) {
+	objects := make([]*S3Object, 0)
+	var continuationToken string
+
+	for {
+		u := c.objectUrl("")
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		u.RawQuery = query.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.do(req, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+		for _, o := range result.Contents {
+			objects = append(objects, &S3Object{Key: o.Key, Size: o.Size, LastModified: o.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// PresignGetObject returns a url to download the object without further authentication until it expires. Additional query parameters (e.g. response-content-disposition) are signed as well.
+func (c *S3Client) PresignGetObject(key string, ttl time.Duration, params url.Values) string {
+	now := c.now().UTC()
+	u := c.objectUrl(key)
+
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", c.accessKeyId+"/"+c.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		s3CanonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", c.signature(now, canonicalRequest))
+	u.RawQuery = s3CanonicalQuery(query)
+	return u.String()
+}
+
+func (c *S3Client) do(req *http.Request, expectedStatus ...int) ([]byte, error) {
+	c.sign(req)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expectedStatus {
+		if res.StatusCode == status {
+			return body, nil
+		}
+	}
+	return nil, fmt.Errorf("object store responded with status %d to %s %s: %s", res.StatusCode, req.Method, req.URL.Path, strings.TrimSpace(string(body)))
+}
+
+// sign adds signature headers to the request, only signing host, content hash and date
+func (c *S3Client) sign(req *http.Request) {
+	now := c.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, s3UnsignedPayload, now.Format(s3TimeFormat)),
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, c.accessKeyId, c.scope(now), signedHeaders, c.signature(now, canonicalRequest),
+	))
+}
+
+func (c *S3Client) signature(t time.Time, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, t.Format(s3TimeFormat), c.scope(t), hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := s3Hmac([]byte("AWS4"+c.secretAccessKey), t.Format(s3DateFormat))
+	key = s3Hmac(key, c.region)
+	key = s3Hmac(key, s3Service)
+	key = s3Hmac(key, "aws4_request")
+	return hex.EncodeToString(s3Hmac(key, stringToSign))
+}
+
+func (c *S3Client) scope(t time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", t.Format(s3DateFormat), c.region, s3Service)
+}
+
+func (c *S3Client) objectUrl(key string) *url.URL {
+	u := *c.endpoint
+	if c.pathStyle {
+		u.Path = u.Path + "/" + c.bucket + "/" + key
+	} else {
+		u.Host = c.bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	return &u
+}
+
+func s3Hmac(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery encodes query parameters sorted by key, with spaces encoded as %20 rather than '+', as required for signing
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
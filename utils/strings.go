@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"strconv"
 	"strings"
 )
 
@@ -15,6 +16,14 @@ func SplitMulti(s string, delimiters ...string) []string {
 	})
 }
 
+// EscapeCsvFormula prefixes values that spreadsheet applications would interpret as formulas (starting with =, +, -, @, tab or carriage return) with a single quote, to prevent csv injection
+func EscapeCsvFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
 func FindString(needle string, haystack []string, defaultVal string) string {
 	for _, s := range haystack {
 		if s == needle {
@@ -23,3 +32,60 @@ func FindString(needle string, haystack []string, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+// CompareVersions compares two dot-separated version strings segment by segment (e.g. "1.10.2" > "1.9"), returning -1, 0 or 1.
+// Pre-release or build suffixes (everything after the first non-numeric character of a segment) are ignored, missing segments count as 0.
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var av, bv int
+		if i < len(as) {
+			av = leadingInt(as[i])
+		}
+		if i < len(bs) {
+			bv = leadingInt(bs[i])
+		}
+		if av != bv {
+			if av < bv {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func leadingInt(s string) int {
+	end := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		end = len(s)
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
+
+// Similarity returns the normalized levenshtein similarity of two strings, ranging from 0 (entirely different) to 1 (equal), comparing runes
+func Similarity(a, b string) float64 {
+	ar, br := []rune(a), []rune(b)
+	if len(ar) == 0 && len(br) == 0 {
+		return 1
+	}
+
+	// single-row dynamic programming, prev[j] holds the edit distance between ar[:i] and br[:j]
+	prev := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		diag := prev[0]
+		prev[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			diag, prev[j] = prev[j], min(prev[j]+1, prev[j-1]+1, diag+cost)
+		}
+	}
+	return 1 - float64(prev[len(br)])/float64(max(len(ar), len(br)))
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeCsvFormula(t *testing.T) {
+	assert.Equal(t, "wakapi", EscapeCsvFormula("wakapi"))
+	assert.Equal(t, "", EscapeCsvFormula(""))
+	assert.Equal(t, "'=HYPERLINK(\"http://evil.example\")", EscapeCsvFormula("=HYPERLINK(\"http://evil.example\")"))
+	assert.Equal(t, "'+1", EscapeCsvFormula("+1"))
+	assert.Equal(t, "'-1", EscapeCsvFormula("-1"))
+	assert.Equal(t, "'@SUM(A1)", EscapeCsvFormula("@SUM(A1)"))
+	assert.Equal(t, "'\tcmd", EscapeCsvFormula("\tcmd"))
+	assert.Equal(t, "my-app", EscapeCsvFormula("my-app"))
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, CompareVersions("1.2.3", "1.2.3"))
+	assert.Equal(t, 0, CompareVersions("v1.2", "1.2.0"))
+	assert.Equal(t, 1, CompareVersions("1.10.0", "1.9.9"))
+	assert.Equal(t, -1, CompareVersions("24.0.0", "24.8.0"))
+	assert.Equal(t, -1, CompareVersions("3.0.19-beta", "3.0.20"))
+	assert.Equal(t, 0, CompareVersions("3.0.19-beta", "3.0.19"))
+	assert.Equal(t, 1, CompareVersions("2", "1.99"))
+	assert.Equal(t, -1, CompareVersions("unknown", "0.1"))
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, Similarity("", ""))
+	assert.Equal(t, 1.0, Similarity("wakapi", "wakapi"))
+	assert.Equal(t, 0.0, Similarity("wakapi", ""))
+	assert.Equal(t, 0.0, Similarity("abc", "xyz"))
+	assert.InDelta(t, 5.0/6, Similarity("wakapi", "wakapy"), 0.001)
+	assert.InDelta(t, 4.0/7, Similarity("kitten", "sitting"), 0.001)
+	assert.InDelta(t, 0.75, Similarity("äöüß", "äöüs"), 0.001) // compares runes, not bytes
+	assert.Equal(t, Similarity("wakapi", "wakapi-cli"), Similarity("wakapi-cli", "wakapi"))
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTotp_Code(t *testing.T) {
+	// test vectors from rfc 6238, appendix b (sha1, truncated to 6 digits)
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	testCases := []struct {
+		time     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range testCases {
+		code, err := TotpCode(secret, TotpStep(time.Unix(tc.time, 0)))
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expected, code)
+	}
+}
+
+func TestTotp_Validate(t *testing.T) {
+	secret, _ := GenerateTotpSecret()
+	now := time.Now()
+
+	code, _ := TotpCode(secret, TotpStep(now.Add(-TotpPeriod)))
+	step, ok := ValidateTotp(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, TotpStep(now)-1, step)
+
+	code, _ = TotpCode(secret, TotpStep(now.Add(-3*TotpPeriod)))
+	_, ok = ValidateTotp(secret, code, now)
+	assert.False(t, ok)
+
+	_, ok = ValidateTotp(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTotp_ProvisioningUri(t *testing.T) {
+	uri := TotpProvisioningUri("Wakapi", "john", "JBSWY3DPEHPK3PXP")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Wakapi:john?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=Wakapi")
+}
+
+func TestCrypto_EncryptDecrypt(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	encrypted, err := Encrypt("JBSWY3DPEHPK3PXP", key)
+	assert.Nil(t, err)
+	assert.NotContains(t, encrypted, "JBSWY3DPEHPK3PXP")
+
+	decrypted, err := Decrypt(encrypted, key)
+	assert.Nil(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", decrypted)
+
+	_, err = Decrypt(encrypted, []byte("fedcba9876543210fedcba9876543210"))
+	assert.NotNil(t, err)
+}
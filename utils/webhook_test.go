@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateWebhookSecret(t *testing.T) {
+	secret1, err := GenerateWebhookSecret()
+	assert.Nil(t, err)
+	assert.Len(t, secret1, 64)
+
+	secret2, _ := GenerateWebhookSecret()
+	assert.NotEqual(t, secret1, secret2)
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// echo -n '{"event":"ping"}' | openssl dgst -sha256 -hmac 'secret'
+	assert.Equal(t, "sha256=4f4bb3a54e99c4a20e243485229f9b08c66e09104ba6f79c23ce647242a4ce84", SignWebhookPayload("secret", []byte(`{"event":"ping"}`)))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	conf "github.com/muety/wakapi/config"
+)
+
+type configValidationResult struct {
+	Config string   `json:"config"`
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// validateConfig loads the config at the given location, checks it for all problems that would make Wakapi fail either at startup or later on and prints them as json.
+// It is intended to be run from the command line (see validate-config command), e.g. before deploying a new config, and returns the process exit code.
+func validateConfig(configPath string, out io.Writer) int {
+	_, errs := conf.Check(configPath, version)
+
+	result := &configValidationResult{
+		Config: configPath,
+		Valid:  len(errs) == 0,
+		Errors: make([]string, len(errs)),
+	}
+	for i, err := range errs {
+		result.Errors[i] = err.Error()
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		return 2
+	}
+	if !result.Valid {
+		return 1
+	}
+	return 0
+}